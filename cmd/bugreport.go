@@ -0,0 +1,395 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Quidge/choir/internal/bugreport"
+	"github.com/Quidge/choir/internal/config"
+	"github.com/Quidge/choir/internal/msg"
+	"github.com/Quidge/choir/internal/preflight"
+	"github.com/Quidge/choir/internal/state"
+	"github.com/spf13/cobra"
+)
+
+// Limits on how much of the state database and logs a bug report includes.
+const (
+	bugreportEnvironments = 20  // Most recent environments summarized
+	bugreportLogFiles     = 5   // Most recently written setup logs
+	bugreportLogLines     = 200 // Lines kept from the end of each log
+)
+
+var bugreportCmd = &cobra.Command{
+	Use:   "bugreport",
+	Short: "Bundle diagnostics for a bug report",
+	Long: `Write a tarball of the information needed to reproduce a problem, for
+attaching to a GitHub issue:
+
+  version.txt     choir, Go, OS, and git versions
+  doctor.txt      the output of "choir doctor"
+  config/         the global and project configs, redacted
+  state.txt       schema migrations and a summary of recent environments
+  diagnostics/    bundles captured when recent environments failed
+  logs/           the end of the most recent setup logs
+
+Config values that may be secret (env values, hook URLs, email addresses,
+signing keys, and anything named like a token or password) are replaced with
+[REDACTED], and the home directory is shown as ~. Repository paths and
+remote URLs are left out of the state summary. Logs are included as is, so
+look over the archive before attaching it.
+
+Writes choir-bugreport-<time>.tar.gz in the current directory, or to -o
+FILE ("-" for stdout).`,
+	Args: cobra.NoArgs,
+	RunE: runBugreport,
+}
+
+func init() {
+	rootCmd.AddCommand(bugreportCmd)
+	bugreportCmd.Flags().StringP("output", "o", "", "write the archive to FILE (- for stdout)")
+}
+
+func runBugreport(cmd *cobra.Command, _ []string) error {
+	now := time.Now()
+	name := "choir-bugreport-" + now.Format("20060102-150405")
+	output, _ := cmd.Flags().GetString("output")
+	if output == "" {
+		output = name + ".tar.gz"
+	}
+
+	var buf bytes.Buffer
+	archive := bugreport.NewArchive(&buf, name)
+	if err := writeBugreport(context.Background(), archive); err != nil {
+		return err
+	}
+	if err := archive.Close(); err != nil {
+		return fmt.Errorf("failed to write archive: %w", err)
+	}
+
+	if output == "-" {
+		_, err := os.Stdout.Write(buf.Bytes())
+		return err
+	}
+	if err := os.WriteFile(output, buf.Bytes(), 0600); err != nil {
+		return fmt.Errorf("failed to write %s: %w", output, err)
+	}
+	msg.Fprintf(os.Stderr, "Wrote %s\n", output)
+	fmt.Fprintln(os.Stderr, "Look it over before attaching it to an issue: setup logs are included as is.")
+	return nil
+}
+
+// writeBugreport adds each part of the report to archive. A part that can't
+// be collected is replaced by a note saying why, so that one broken piece
+// (often the thing being reported) doesn't prevent the rest.
+func writeBugreport(ctx context.Context, archive *bugreport.Archive) error {
+	parts := []struct {
+		name    string
+		collect func() ([]byte, error)
+	}{
+		{"version.txt", bugreportVersion},
+		{"doctor.txt", func() ([]byte, error) {
+			var buf bytes.Buffer
+			printDoctorResults(&buf, preflight.Run(ctx, doctorChecks()))
+			return buf.Bytes(), nil
+		}},
+		{"config/global.yaml", bugreportGlobalConfig},
+		{"config/project.yaml", bugreportProjectConfig},
+		{"state.txt", bugreportState},
+	}
+	for _, p := range parts {
+		data, err := p.collect()
+		if err != nil {
+			data = []byte(fmt.Sprintf("not collected: %v\n", err))
+		}
+		if err := archive.Add(p.name, data); err != nil {
+			return err
+		}
+	}
+
+	diagnostics, err := bugreportDiagnostics()
+	if err != nil {
+		return archive.Add("diagnostics/error.txt", []byte(err.Error()+"\n"))
+	}
+	for _, name := range slices.Sorted(maps.Keys(diagnostics)) {
+		if err := archive.Add("diagnostics/"+name, diagnostics[name]); err != nil {
+			return err
+		}
+	}
+
+	logs, err := bugreportLogs()
+	if err != nil {
+		return archive.Add("logs/error.txt", []byte(err.Error()+"\n"))
+	}
+	for _, name := range slices.Sorted(maps.Keys(logs)) {
+		if err := archive.Add("logs/"+name, logs[name]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// bugreportVersion describes the choir build and the tools it depends on.
+func bugreportVersion() ([]byte, error) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "choir:  %s\n", Version)
+	fmt.Fprintf(&b, "go:     %s\n", runtime.Version())
+	fmt.Fprintf(&b, "os:     %s/%s\n", runtime.GOOS, runtime.GOARCH)
+	git, err := exec.Command("git", "--version").Output()
+	if err != nil {
+		fmt.Fprintf(&b, "git:    unavailable (%v)\n", err)
+	} else {
+		fmt.Fprintf(&b, "git:    %s\n", strings.TrimPrefix(strings.TrimSpace(string(git)), "git version "))
+	}
+	return []byte(b.String()), nil
+}
+
+// bugreportGlobalConfig returns the global config file, redacted.
+func bugreportGlobalConfig() ([]byte, error) {
+	path, err := config.GlobalConfigPath()
+	if err != nil {
+		return nil, err
+	}
+	return readRedacted(path)
+}
+
+// bugreportProjectConfig returns the project config for the current
+// directory, redacted.
+func bugreportProjectConfig() ([]byte, error) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+	path, err := config.FindProjectConfig(cwd)
+	if err != nil {
+		return nil, err
+	}
+	if path == "" {
+		return []byte("# no " + config.ProjectConfigFilename + " found from the current directory\n"), nil
+	}
+	return readRedacted(path)
+}
+
+// readRedacted reads the config file at path and redacts it.
+func readRedacted(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return []byte("# no config at " + path + "\n"), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte("# "+path+"\n"), bugreport.Redact(data)...), nil
+}
+
+// bugreportState summarizes the state database: its migrations, how many
+// environments are in each status, and the most recent environments. If
+// migrations are pending the database is left untouched, since opening it
+// would apply them and might hide the problem being reported.
+func bugreportState() ([]byte, error) {
+	var b strings.Builder
+	statuses, err := state.MigrationStatuses("")
+	if err != nil {
+		return nil, err
+	}
+	fmt.Fprintln(&b, "Migrations:")
+	for _, s := range statuses {
+		applied := "pending"
+		if s.Applied {
+			applied = s.AppliedAt.Format(time.RFC3339)
+		}
+		fmt.Fprintf(&b, "  %3d  %-45s %s\n", s.Version, s.Name, applied)
+	}
+	if ok, err := stateSummarizable(); !ok {
+		fmt.Fprintf(&b, "\nenvironments not summarized: %v\n", err)
+		return []byte(b.String()), nil
+	}
+
+	db, err := state.OpenReadOnly("")
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	counts, err := db.CountByStatus()
+	if err != nil {
+		return nil, err
+	}
+	fmt.Fprintln(&b, "\nEnvironments by status:")
+	for _, status := range slices.Sorted(maps.Keys(counts)) {
+		fmt.Fprintf(&b, "  %-14s %d\n", status, counts[status])
+	}
+
+	envs, err := db.ListEnvironments(state.ListOptions{Limit: bugreportEnvironments})
+	if err != nil {
+		return nil, err
+	}
+	fmt.Fprintf(&b, "\nMost recent environments (up to %d):\n", bugreportEnvironments)
+	tw := tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "  ID\tBACKEND\tSTATUS\tCREATED\tEXPIRES\tSETUP")
+	for _, env := range envs {
+		expires := "-"
+		if !env.ExpiresAt.IsZero() {
+			expires = env.ExpiresAt.Format(time.RFC3339)
+		}
+		fmt.Fprintf(tw, "  %s\t%s\t%s\t%s\t%s\t%s\n", state.ShortID(env.ID), env.Backend, env.Status,
+			env.CreatedAt.Format(time.RFC3339), expires, setupSummary(db, env.ID))
+	}
+	if err := tw.Flush(); err != nil {
+		return nil, err
+	}
+	return []byte(b.String()), nil
+}
+
+// setupSummary describes how far environment id's setup got, e.g.,
+// "3/4 steps, failed at 4: npm test".
+func setupSummary(db *state.DB, id string) string {
+	steps, err := db.ListSetupSteps(id)
+	if err != nil {
+		return "unknown"
+	}
+	if len(steps) == 0 {
+		return "-"
+	}
+	var done int
+	for _, s := range steps {
+		if !s.Finished() {
+			return fmt.Sprintf("%d/%d steps, interrupted at %d: %s", done, len(steps), s.Step, s.Name)
+		}
+		if s.Error != "" {
+			return fmt.Sprintf("%d/%d steps, failed at %d: %s", done, len(steps), s.Step, s.Name)
+		}
+		done++
+	}
+	return fmt.Sprintf("%d/%d steps", done, len(steps))
+}
+
+// stateSummarizable reports whether the state database exists and is fully
+// migrated, so that opening it changes nothing. If not, the error says why.
+func stateSummarizable() (bool, error) {
+	path, err := state.DefaultDBPath()
+	if err != nil {
+		return false, err
+	}
+	if _, err := os.Stat(path); err != nil {
+		return false, err
+	}
+	statuses, err := state.MigrationStatuses(path)
+	if err != nil {
+		return false, err
+	}
+	for _, s := range statuses {
+		if !s.Applied {
+			return false, fmt.Errorf("migration %d is pending", s.Version)
+		}
+	}
+	return true, nil
+}
+
+// bugreportDiagnostics returns the diagnostic bundles of recent failed
+// environments, by file name.
+func bugreportDiagnostics() (map[string][]byte, error) {
+	if ok, _ := stateSummarizable(); !ok {
+		return nil, nil
+	}
+
+	db, err := state.OpenReadOnly("")
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	envs, err := db.ListEnvironments(state.ListOptions{
+		Statuses: []state.EnvironmentStatus{state.StatusFailed},
+		Limit:    bugreportEnvironments,
+	})
+	if err != nil {
+		return nil, err
+	}
+	files := make(map[string][]byte)
+	for _, env := range envs {
+		d, err := db.GetDiagnostics(env.ID)
+		if errors.Is(err, state.ErrNoDiagnostics) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		var buf bytes.Buffer
+		if err := json.Indent(&buf, []byte(d.Bundle), "", "  "); err != nil {
+			buf.Reset()
+			buf.WriteString(d.Bundle)
+		}
+		buf.WriteByte('\n')
+		files[state.ShortID(env.ID)+".json"] = buf.Bytes()
+	}
+	return files, nil
+}
+
+// bugreportLogs returns the end of the most recently written setup logs, by
+// file name. Setup logs are kept in a logs directory next to the state
+// database.
+func bugreportLogs() (map[string][]byte, error) {
+	dbPath, err := state.DefaultDBPath()
+	if err != nil {
+		return nil, err
+	}
+	dir := filepath.Join(filepath.Dir(dbPath), "logs")
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	type logFile struct {
+		name    string
+		modTime time.Time
+	}
+	var logs []logFile
+	for _, e := range entries {
+		if !strings.HasSuffix(e.Name(), ".setup.log") {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		logs = append(logs, logFile{e.Name(), info.ModTime()})
+	}
+	slices.SortFunc(logs, func(a, b logFile) int { return b.modTime.Compare(a.modTime) })
+	logs = logs[:min(len(logs), bugreportLogFiles)]
+
+	files := make(map[string][]byte)
+	for _, l := range logs {
+		data, err := os.ReadFile(filepath.Join(dir, l.name))
+		if err != nil {
+			return nil, err
+		}
+		id := strings.TrimSuffix(l.name, ".setup.log")
+		files[state.ShortID(id)+".setup.log"] = tailLines(data, bugreportLogLines)
+	}
+	return files, nil
+}
+
+// tailLines returns the last n lines of data.
+func tailLines(data []byte, n int) []byte {
+	data = bytes.TrimSuffix(data, []byte("\n"))
+	lines := bytes.Split(data, []byte("\n"))
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return append(bytes.Join(lines, []byte("\n")), '\n')
+}
@@ -5,6 +5,8 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"reflect"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
@@ -12,6 +14,7 @@ import (
 	"github.com/Quidge/choir/internal/backend"
 	_ "github.com/Quidge/choir/internal/backend/worktree"
 	"github.com/Quidge/choir/internal/config"
+	"github.com/Quidge/choir/internal/daemon"
 	"github.com/Quidge/choir/internal/state"
 	"github.com/spf13/cobra"
 )
@@ -567,3 +570,37 @@ func TestEnvListAlias(t *testing.T) {
 		t.Error("expected 'ls' to be an alias for 'list'")
 	}
 }
+
+func TestServeHelpListsCreateFields(t *testing.T) {
+	// The help documents every field a create request accepts
+	fields := reflect.TypeOf(daemon.CreateRequest{})
+	for i := range fields.NumField() {
+		name, _, _ := strings.Cut(fields.Field(i).Tag.Get("json"), ",")
+		if !strings.Contains(serveCmd.Long, strconv.Quote(name)) {
+			t.Errorf("serve help doesn't list create field %q", name)
+		}
+	}
+}
+
+func TestRecordsUsage(t *testing.T) {
+	tests := []struct {
+		args []string
+		want bool
+	}{
+		{[]string{"env", "list"}, true},
+		{[]string{"stats"}, true},
+		// Run by shell prompts and completion, not by people
+		{[]string{"env", "current"}, false},
+		{[]string{"env", "prompt"}, false},
+		{[]string{"env"}, false},
+	}
+	for _, tt := range tests {
+		cmd, _, err := rootCmd.Find(tt.args)
+		if err != nil {
+			t.Fatalf("Find(%v) failed: %v", tt.args, err)
+		}
+		if got := recordsUsage(cmd); got != tt.want {
+			t.Errorf("recordsUsage(%s) = %v, want %v", cmd.CommandPath(), got, tt.want)
+		}
+	}
+}
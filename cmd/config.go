@@ -1,11 +1,19 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
 
+	"github.com/Quidge/choir/internal/cache"
+	"github.com/Quidge/choir/internal/clierr"
 	"github.com/Quidge/choir/internal/config"
+	"github.com/Quidge/choir/internal/hooks"
+	"github.com/Quidge/choir/internal/msg"
+	"github.com/Quidge/choir/internal/naming"
+	"github.com/Quidge/choir/internal/prompt"
+	"github.com/Quidge/choir/internal/theme"
 	"github.com/spf13/cobra"
 	"gopkg.in/yaml.v3"
 )
@@ -16,9 +24,11 @@ var configCmd = &cobra.Command{
 	Long: `View or modify the global choir configuration.
 
 Subcommands:
-  show   Print current configuration
-  edit   Open configuration in $EDITOR
-  set    Set a specific configuration key`,
+  show      Print current configuration
+  edit      Open configuration in $EDITOR
+  set       Set a specific configuration key
+  validate  Check global and project configuration for problems
+  schema    Print the JSON Schema for .choir.yaml or the global config`,
 }
 
 var configShowCmd = &cobra.Command{
@@ -40,17 +50,69 @@ var configSetCmd = &cobra.Command{
 	Short: "Set a configuration key",
 	Long: `Set a specific configuration key using dot notation.
 
-Example:
-  choir config set backends.local.memory 8GB`,
-	Args: cobra.ExactArgs(2),
-	RunE: runConfigSet,
+The value is checked against the key's type (integer, true/false, or a
+comma-separated list) and the whole configuration is validated before it is
+saved. Comments in the config file are kept.
+
+Examples:
+  choir config set backends.local.memory 8GB
+  choir config set credentials.ssh_keys ~/.ssh/choir
+  choir config set theme.mode high-contrast`,
+	Args:              cobra.ExactArgs(2),
+	RunE:              runConfigSet,
+	ValidArgsFunction: completeConfigKeys,
+}
+
+var configValidateCmd = &cobra.Command{
+	Use:   "validate [FILE...]",
+	Short: "Check configuration files for problems",
+	Long: `Check the global config and the project's .choir.yaml for problems,
+listing every one found with its file and line:
+
+  - YAML syntax errors, unknown keys, and values of the wrong type
+  - invalid memory and disk sizes, durations, and branch prefixes
+  - env from_file paths and file mount sources that don't exist, and
+    mount targets outside the workspace
+  - invalid agent, network, cache, hook, naming, and theme settings
+
+Without arguments, the global config and the .choir.yaml found from the
+current directory are checked. Files given as arguments are checked as
+project configs, or as global configs with --global.
+
+Exits non-zero if any problem is found, so it can run in CI.`,
+	RunE: runConfigValidate,
 }
 
+var configValidateGlobal bool
+
+var configSchemaCmd = &cobra.Command{
+	Use:   "schema",
+	Short: "Print the JSON Schema for .choir.yaml",
+	Long: `Print a JSON Schema describing .choir.yaml, or the global config with
+--global, for editor completion and validation in CI.
+
+With the YAML language server (e.g., the VS Code YAML extension), add this
+to the top of .choir.yaml after saving the schema:
+
+  # yaml-language-server: $schema=./choir.schema.json
+
+The schemas are also in docs/schema in the choir repository.`,
+	Args: cobra.NoArgs,
+	RunE: runConfigSchema,
+}
+
+var configSchemaGlobal bool
+
 func init() {
 	rootCmd.AddCommand(configCmd)
 	configCmd.AddCommand(configShowCmd)
 	configCmd.AddCommand(configEditCmd)
 	configCmd.AddCommand(configSetCmd)
+	configCmd.AddCommand(configValidateCmd)
+	configCmd.AddCommand(configSchemaCmd)
+
+	configValidateCmd.Flags().BoolVar(&configValidateGlobal, "global", false, "check the given files as global configs")
+	configSchemaCmd.Flags().BoolVar(&configSchemaGlobal, "global", false, "print the schema for the global config")
 }
 
 func runConfigShow(_ *cobra.Command, _ []string) error {
@@ -81,6 +143,10 @@ func runConfigShow(_ *cobra.Command, _ []string) error {
 }
 
 func runConfigEdit(_ *cobra.Command, _ []string) error {
+	if err := prompt.RequireInteractive("open an editor"); err != nil {
+		return err
+	}
+
 	configPath, err := config.GlobalConfigPath()
 	if err != nil {
 		return err
@@ -116,8 +182,174 @@ func runConfigSet(_ *cobra.Command, args []string) error {
 	key := args[0]
 	value := args[1]
 
-	// TODO(#1): Implement config set with dot notation for nested YAML values.
-	// This requires reflection or a library like "github.com/tidwall/sjson" adapted for YAML.
-	// See spec Section 5.2.10 for requirements.
-	return fmt.Errorf("config set not implemented: %s=%s\nPlease use 'choir config edit' instead", key, value)
+	configPath, err := config.GlobalConfigPath()
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(configPath)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read config: %w", err)
+	}
+
+	data, err = config.SetKey(data, key, value)
+	if err != nil {
+		return err
+	}
+	cfg, err := config.ParseGlobalConfig(data, configPath)
+	if err != nil {
+		return err
+	}
+	if err := validateGlobalConfig(cfg); err != nil {
+		return fmt.Errorf("invalid %s: %w", key, err)
+	}
+
+	if err := config.EnsureGlobalConfigDir(); err != nil {
+		return fmt.Errorf("failed to create config directory: %w", err)
+	}
+	tmp := configPath + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write config: %w", err)
+	}
+	if err := os.Rename(tmp, configPath); err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("failed to write config: %w", err)
+	}
+	msg.Printf("Set %s in %s\n", key, configPath)
+	return nil
+}
+
+// validateGlobalConfig checks the settings in cfg that are interpreted by
+// other packages, which ParseGlobalConfig can't check itself.
+func validateGlobalConfig(cfg config.GlobalConfig) error {
+	if _, err := config.ParseTTL(cfg.DefaultTTL); err != nil {
+		return fmt.Errorf("default_ttl: %w", err)
+	}
+	if _, err := config.ParseTrashRetention(cfg.TrashRetention); err != nil {
+		return fmt.Errorf("trash_retention: %w", err)
+	}
+	if cfg.MaxParallelProvisions < 0 {
+		return fmt.Errorf("max_parallel_provisions: must not be negative, got %d", cfg.MaxParallelProvisions)
+	}
+	if _, err := naming.FromConfig(cfg.Naming); err != nil {
+		return err
+	}
+	if _, err := theme.New(cfg.Theme, false); err != nil {
+		return err
+	}
+	return cfg.Clone.Validate()
+}
+
+// completeConfigKeys completes the KEY argument of config set.
+func completeConfigKeys(_ *cobra.Command, args []string, _ string) ([]string, cobra.ShellCompDirective) {
+	if len(args) > 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	cfg, err := config.LoadGlobalConfig()
+	if err != nil {
+		cfg = config.DefaultGlobalConfig()
+	}
+	return config.SettableKeys(cfg), cobra.ShellCompDirectiveNoFileComp
+}
+
+func runConfigValidate(_ *cobra.Command, args []string) error {
+	type configFile struct {
+		path   string
+		global bool
+	}
+	var files []configFile
+	for _, arg := range args {
+		files = append(files, configFile{path: arg, global: configValidateGlobal})
+	}
+	if len(args) == 0 {
+		if path, err := config.GlobalConfigPath(); err == nil {
+			if _, err := os.Stat(path); err == nil {
+				files = append(files, configFile{path: path, global: true})
+			}
+		}
+		if cwd, err := os.Getwd(); err == nil {
+			if path, _ := config.FindProjectConfig(cwd); path != "" {
+				files = append(files, configFile{path: path})
+			}
+		}
+		if len(files) == 0 {
+			fmt.Println("No config files found; the defaults are in effect.")
+			return nil
+		}
+	}
+
+	total := 0
+	for _, f := range files {
+		data, err := os.ReadFile(f.path)
+		if err != nil {
+			return fmt.Errorf("failed to read config: %w", err)
+		}
+		var problems []config.Problem
+		if f.global {
+			problems = validateGlobalConfigFile(data)
+		} else {
+			problems = validateProjectConfigFile(data)
+		}
+		if len(problems) == 0 {
+			fmt.Printf("%s: OK\n", f.path)
+			continue
+		}
+		for _, p := range problems {
+			fmt.Println(p.Format(f.path))
+		}
+		total += len(problems)
+	}
+	switch {
+	case total == 1:
+		return clierr.Validation(errors.New("found 1 problem"))
+	case total > 1:
+		return clierr.Validation(fmt.Errorf("found %d problems", total))
+	}
+	return nil
+}
+
+// validateGlobalConfigFile returns the problems in global config YAML,
+// including those in settings interpreted outside the config package.
+func validateGlobalConfigFile(data []byte) []config.Problem {
+	problems := config.ValidateGlobalConfig(data)
+	var cfg config.GlobalConfig
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return problems // Already reported
+	}
+	if _, err := naming.FromConfig(cfg.Naming); err != nil {
+		problems = append(problems, config.Problem{Message: err.Error()})
+	}
+	if _, err := theme.New(cfg.Theme, false); err != nil {
+		problems = append(problems, config.Problem{Message: err.Error()})
+	}
+	if _, err := hooks.FromConfig(cfg.Hooks); err != nil {
+		problems = append(problems, config.Problem{Message: err.Error()})
+	}
+	return problems
+}
+
+// validateProjectConfigFile returns the problems in project config YAML,
+// including those in settings interpreted outside the config package.
+func validateProjectConfigFile(data []byte) []config.Problem {
+	problems := config.ValidateProjectConfig(data)
+	var cfg config.ProjectConfig
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return problems // Already reported
+	}
+	if err := cache.Validate(cfg.Cache); err != nil {
+		problems = append(problems, config.Problem{Message: "cache: " + err.Error()})
+	}
+	return problems
+}
+
+func runConfigSchema(_ *cobra.Command, _ []string) error {
+	generate := config.ProjectSchema
+	if configSchemaGlobal {
+		generate = config.GlobalSchema
+	}
+	data, err := generate()
+	if err != nil {
+		return err
+	}
+	_, err = os.Stdout.Write(data)
+	return err
 }
@@ -0,0 +1,101 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/Quidge/choir/cmd/env"
+	"github.com/Quidge/choir/internal/daemon"
+	"github.com/Quidge/choir/internal/state"
+	"github.com/spf13/cobra"
+)
+
+var (
+	daemonIntervalFlag time.Duration
+	daemonSocketFlag   string
+)
+
+var daemonCmd = &cobra.Command{
+	Use:   "daemon",
+	Short: "Run the background reconciliation daemon",
+	Long: `Run choir's background daemon in the foreground until interrupted.
+
+Every --interval the daemon reconciles each environment:
+  - environments whose TTL has expired are removed (like "choir gc")
+  - ready or stopped environments whose workspace has disappeared are
+    marked failed
+  - environments stuck provisioning for over an hour (because the create
+    process died) are marked failed
+
+It also serves a local API on a unix socket (default
+$XDG_RUNTIME_DIR/choir/daemon.sock, or ~/.local/share/choir/daemon.sock).
+Set ` + daemon.EnvUseDaemon + `=1 to make "choir env list" query the daemon
+instead of opening the state database; it falls back to the database if the
+daemon is not running.
+
+Run it under your service manager (systemd --user, launchd) to keep it up.`,
+	Args: cobra.NoArgs,
+	RunE: runDaemon,
+}
+
+func init() {
+	rootCmd.AddCommand(daemonCmd)
+
+	daemonCmd.Flags().DurationVar(&daemonIntervalFlag, "interval", daemon.DefaultInterval, "time between reconciliations")
+	daemonCmd.Flags().StringVar(&daemonSocketFlag, "socket", "", "unix socket path for the API")
+}
+
+func runDaemon(cmd *cobra.Command, args []string) error {
+	if daemonIntervalFlag <= 0 {
+		return fmt.Errorf("--interval must be positive")
+	}
+
+	socket := daemonSocketFlag
+	if socket == "" {
+		var err error
+		socket, err = daemon.SocketPath()
+		if err != nil {
+			return fmt.Errorf("failed to determine socket path: %w", err)
+		}
+	}
+
+	db, err := state.Open("")
+	if err != nil {
+		return fmt.Errorf("failed to open state database: %w", err)
+	}
+	defer db.Close()
+
+	ln, err := daemon.Listen(socket)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(socket)
+
+	logger := log.New(os.Stderr, "choir daemon: ", log.LstdFlags)
+	srv := &daemon.Server{
+		DB:       db,
+		Interval: daemonIntervalFlag,
+		Logger:   logger,
+		Tasks: []daemon.Task{
+			{
+				Name: "reconcile",
+				Run: func(ctx context.Context) error {
+					return env.ReconcileAll(ctx, db, time.Now(), func(e *state.Environment, action env.Action) {
+						logger.Printf("%s %s", action, state.ShortID(e.ID))
+					})
+				},
+			},
+		},
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	logger.Printf("listening on %s, reconciling every %s", socket, daemonIntervalFlag)
+	return srv.Serve(ctx, ln)
+}
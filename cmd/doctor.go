@@ -0,0 +1,203 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/Quidge/choir/cmd/env"
+
+	"github.com/Quidge/choir/internal/backend"
+	_ "github.com/Quidge/choir/internal/backend/worktree" // Register worktree backend
+	"github.com/Quidge/choir/internal/config"
+	"github.com/Quidge/choir/internal/gitutil"
+	"github.com/Quidge/choir/internal/preflight"
+	"github.com/Quidge/choir/internal/state"
+	"github.com/spf13/cobra"
+)
+
+// minDataDirSpace is the free space below which doctor warns about the
+// choir data directory (state database and worktrees).
+const minDataDirSpace = 1 << 30 // 1 GiB
+
+var doctorCmd = &cobra.Command{
+	Use:   "doctor",
+	Short: "Check that choir's prerequisites are met",
+	Long: `Check that choir's prerequisites are met.
+
+Verifies required tools are installed, configuration files parse, the state
+database opens, and there is enough free disk space. When run inside a git
+repository, also runs the backend's pre-create checks for the current branch.`,
+	Args: cobra.NoArgs,
+	RunE: runDoctor,
+}
+
+func init() {
+	rootCmd.AddCommand(doctorCmd)
+}
+
+func runDoctor(cmd *cobra.Command, _ []string) error {
+	results := preflight.Run(context.Background(), doctorChecks())
+	printDoctorResults(os.Stdout, results)
+
+	if err := preflight.Failed(results); err != nil {
+		var failed int
+		for _, r := range results {
+			if r.Err != nil {
+				failed++
+			}
+		}
+		return fmt.Errorf("%d of %d checks failed", failed, len(results))
+	}
+	return nil
+}
+
+// doctorChecks returns the checks doctor runs.
+func doctorChecks() []preflight.Check {
+	checks := []preflight.Check{
+		preflight.RequireCommand("git"),
+		{
+			Name: "global config",
+			Run: func(ctx context.Context) error {
+				_, err := config.LoadGlobalConfig()
+				return err
+			},
+		},
+		{
+			Name: "project config",
+			Run: func(ctx context.Context) error {
+				_, err := config.LoadProjectConfig("")
+				return err
+			},
+		},
+		{
+			Name: "state database",
+			Run: func(ctx context.Context) error {
+				db, err := state.Open("")
+				if err != nil {
+					return err
+				}
+				return db.Close()
+			},
+		},
+		{
+			Name: "interrupted setups",
+			Run: func(ctx context.Context) error {
+				db, err := state.OpenReadOnly("")
+				if err != nil {
+					return err
+				}
+				defer db.Close()
+				interrupted, err := env.InterruptedSetups(db, time.Now())
+				if err != nil {
+					return err
+				}
+				if len(interrupted) > 0 {
+					return errors.New(strings.Join(interrupted, "; "))
+				}
+				return nil
+			},
+		},
+	}
+
+	if dbPath, err := state.DefaultDBPath(); err == nil {
+		checks = append(checks, preflight.RequireFreeSpace(filepath.Dir(dbPath), minDataDirSpace))
+	}
+
+	checks = append(checks, backendHealthCheck())
+	if repoRoot, err := gitutil.RepoRoot(""); err == nil {
+		checks = append(checks, backendPreflightCheck(repoRoot))
+	}
+
+	return checks
+}
+
+// printDoctorResults writes a line to w for each check result.
+func printDoctorResults(w io.Writer, results []preflight.Result) {
+	for _, r := range results {
+		if r.Err != nil {
+			fmt.Fprintf(w, "✗ %s: %v\n", r.Name, r.Err)
+		} else {
+			fmt.Fprintf(w, "✓ %s\n", r.Name)
+		}
+	}
+}
+
+// backendHealthCheck returns a check that runs the default backend's
+// health check.
+func backendHealthCheck() preflight.Check {
+	return preflight.Check{
+		Name: "backend health",
+		Run: func(ctx context.Context) error {
+			global, err := config.LoadGlobalConfig()
+			if err != nil {
+				return err
+			}
+
+			// For MVP, force worktree backend
+			be, err := backend.Get(backend.BackendConfig{
+				Name:  global.DefaultBackend,
+				Type:  "worktree",
+				Shell: global.Shell,
+			})
+			if err != nil {
+				return err
+			}
+			if h, ok := be.(backend.HealthChecker); ok {
+				return h.HealthCheck(ctx)
+			}
+			return nil
+		},
+	}
+}
+
+// backendPreflightCheck returns a check that runs the default backend's
+// pre-create checks against the repository at repoRoot.
+func backendPreflightCheck(repoRoot string) preflight.Check {
+	return preflight.Check{
+		Name: "backend pre-create checks",
+		Run: func(ctx context.Context) error {
+			merged, err := config.LoadFromCwd(config.FlagOverrides{})
+			if err != nil {
+				return err
+			}
+
+			// For MVP, force worktree backend
+			be, err := backend.Get(backend.BackendConfig{
+				Name:  merged.Backend,
+				Type:  "worktree",
+				Shell: merged.Shell,
+			})
+			if err != nil {
+				return err
+			}
+
+			p, ok := be.(backend.Preflighter)
+			if !ok {
+				return nil
+			}
+
+			baseBranch, err := gitutil.CurrentBranch(repoRoot)
+			if errors.Is(err, gitutil.ErrDetachedHead) {
+				baseBranch = "HEAD"
+			} else if err != nil {
+				return err
+			}
+
+			return p.Preflight(ctx, &config.CreateConfig{
+				ID:          "doctor",
+				Backend:     merged.Backend,
+				BackendType: "worktree",
+				Repository: config.RepositoryInfo{
+					Path:       repoRoot,
+					BaseBranch: baseBranch,
+				},
+			})
+		},
+	}
+}
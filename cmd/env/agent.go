@@ -0,0 +1,286 @@
+package env
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/Quidge/choir/internal/backend"
+	"github.com/Quidge/choir/internal/config"
+	"github.com/Quidge/choir/internal/resolve"
+	"github.com/Quidge/choir/internal/state"
+	"github.com/spf13/cobra"
+)
+
+var runAgentCmd = &cobra.Command{
+	Use:   "run-agent ID",
+	Short: "Start the project's coding agent in an environment",
+	Long: `Start the coding agent configured under agent: in .choir.yaml in an
+environment, with the environment's variables loaded and its task passed
+in, and wait for it to exit.
+
+The ID can be a prefix if it uniquely identifies an environment. The agent
+config is read from the .choir.yaml in the environment's workspace, falling
+back to the repository's:
+
+  agent:
+    command: claude
+    prompt: arg        # pass the task as the last argument (default),
+                       # on stdin, or none
+    env:
+      CLAUDE_CODE_USE_BEDROCK: "1"
+
+The task is the one recorded with "env create --prompt" or --task-file, or
+--prompt here. The agent also gets it in $CHOIR_TASK, and the environment's
+ID in $CHOIR_ENV_ID. Each run is recorded with the agent's process ID and
+exit code, and "choir env status" shows whether the agent is still running.
+Only one agent runs in an environment at a time; stop one with
+"choir env stop --agent".`,
+	Args: cobra.ExactArgs(1),
+	RunE: runRunAgent,
+}
+
+var runAgentPromptFlag string
+
+func init() {
+	runAgentCmd.Flags().StringVar(&runAgentPromptFlag, "prompt", "", "task to give the agent instead of the environment's (- to read it from stdin)")
+}
+
+func runRunAgent(cmd *cobra.Command, args []string) error {
+	ctx := context.Background()
+
+	db, err := state.Open("")
+	if err != nil {
+		return fmt.Errorf("failed to open state database: %w", err)
+	}
+	defer db.Close()
+
+	env, err := resolve.Environment(db, args[0])
+	if err != nil {
+		return err
+	}
+	if env.Status != state.StatusReady {
+		return fmt.Errorf("environment %s is %s, not ready", state.ShortID(env.ID), env.Status)
+	}
+
+	agent, err := loadAgentConfig(env)
+	if err != nil {
+		return err
+	}
+
+	task := env.Task
+	if runAgentPromptFlag != "" {
+		if task, err = readTask(runAgentPromptFlag, "", os.Stdin); err != nil {
+			return err
+		}
+	}
+
+	be, err := getBackend(env.Backend, "")
+	if err != nil {
+		return err
+	}
+	launcher, ok := be.(backend.Launcher)
+	if !ok {
+		return fmt.Errorf("the %s backend can't run agents", env.Backend)
+	}
+	if last, err := checkAgentRun(ctx, db, be, env); err != nil {
+		return err
+	} else if last != nil && last.Status == state.AgentRunning {
+		return fmt.Errorf("an agent is already running in %s (process %s); stop it with \"choir env stop --agent\"",
+			state.ShortID(env.ID), last.ProcessID)
+	}
+
+	spec := agentLaunchSpec(env, agent, task)
+	if runAgentPromptFlag == "-" && spec.Stdin == os.Stdin {
+		// Stdin was used up reading the task
+		spec.Stdin = nil
+	}
+
+	// Leave interrupts to the agent, which shares the terminal, and wait
+	// to record how it exited. Catching rather than ignoring them keeps
+	// the agent from inheriting the ignored disposition.
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt)
+	defer signal.Stop(interrupts)
+
+	proc, err := launcher.Launch(ctx, env.BackendID, spec)
+	if err != nil {
+		return err
+	}
+	run := &state.AgentRun{
+		EnvironmentID: env.ID,
+		Command:       agent.Command,
+		ProcessID:     proc.ID(),
+		StartedAt:     time.Now(),
+	}
+	if err := db.StartAgentRun(run); err != nil {
+		fmt.Fprintf(os.Stderr, "warning: %v\n", err)
+	}
+
+	exitCode, waitErr := proc.Wait()
+	if run.ID != 0 {
+		if err := db.FinishAgentRun(run.ID, time.Now(), exitCode); err != nil {
+			fmt.Fprintf(os.Stderr, "warning: %v\n", err)
+		}
+	}
+	if waitErr != nil {
+		return fmt.Errorf("failed to wait for agent: %w", waitErr)
+	}
+	if exitCode != 0 {
+		if last, err := db.LatestAgentRun(env.ID); err == nil && last.ID == run.ID && last.Status == state.AgentStopped {
+			return errors.New("agent was stopped")
+		}
+		return fmt.Errorf("agent exited with code %d", exitCode)
+	}
+	return nil
+}
+
+// loadAgentConfig returns the agent config from env's project config,
+// preferring the copy in its workspace over the one in its repository.
+func loadAgentConfig(env *state.Environment) (config.AgentConfig, error) {
+	dir := env.RepoPath
+	if env.BackendID != "" && config.ProjectConfigExists(env.BackendID) {
+		dir = env.BackendID
+	}
+	project, err := config.LoadProjectConfigFromDir(dir)
+	if err != nil {
+		return config.AgentConfig{}, fmt.Errorf("failed to load project config: %w", err)
+	}
+	if project.Agent.Command == "" {
+		return config.AgentConfig{}, fmt.Errorf("no agent configured: add an agent: section with a command to %s",
+			config.ProjectConfigFilename)
+	}
+	if err := project.Agent.Validate(); err != nil {
+		return config.AgentConfig{}, err
+	}
+	return project.Agent, nil
+}
+
+// agentLaunchSpec builds the launch spec for running agent in env with
+// task, connected to the terminal.
+func agentLaunchSpec(env *state.Environment, agent config.AgentConfig, task string) backend.LaunchSpec {
+	spec := backend.LaunchSpec{
+		Command: agent.Command,
+		Env:     map[string]string{"CHOIR_ENV_ID": env.ID, "CHOIR_TASK": task},
+		Stdin:   os.Stdin,
+		Stdout:  os.Stdout,
+		Stderr:  os.Stderr,
+	}
+	for k, v := range agent.Env {
+		spec.Env[k] = v
+	}
+	if task == "" {
+		return spec
+	}
+	switch agent.Prompt {
+	case "", config.AgentPromptArg:
+		// Quoting the variable works in both POSIX shells and fish
+		spec.Command = strings.TrimSpace(agent.Command) + ` "$CHOIR_TASK"`
+	case config.AgentPromptStdin:
+		spec.Stdin = strings.NewReader(task + "\n")
+	}
+	return spec
+}
+
+// agentStopTimeout is how long stopAgent waits for an agent to exit after
+// asking it to before killing it.
+const agentStopTimeout = 10 * time.Second
+
+// latestAgentRun returns the latest agent run in env, or nil if no agent
+// ever ran there. A run still recorded as running whose process is gone,
+// because it crashed or choir was killed while waiting for it, is returned
+// as crashed; the change is not saved (see checkAgentRun). Backends that
+// can't supervise processes report recorded runs as they are.
+func latestAgentRun(ctx context.Context, db *state.DB, be backend.Backend, env *state.Environment) (*state.AgentRun, error) {
+	run, err := db.LatestAgentRun(env.ID)
+	if errors.Is(err, state.ErrNoAgentRun) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	sup, ok := be.(backend.Supervisor)
+	if run.Status != state.AgentRunning || !ok {
+		return run, nil
+	}
+	alive, err := sup.ProcessAlive(ctx, env.BackendID, run.ProcessID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check agent: %w", err)
+	}
+	if !alive {
+		run.Status = state.AgentCrashed
+	}
+	return run, nil
+}
+
+// checkAgentRun is latestAgentRun, but it records a crash it finds, dated
+// now since the actual time is unknown.
+func checkAgentRun(ctx context.Context, db *state.DB, be backend.Backend, env *state.Environment) (*state.AgentRun, error) {
+	run, err := latestAgentRun(ctx, db, be, env)
+	if err != nil || run == nil {
+		return run, err
+	}
+	if run.Status == state.AgentCrashed && !run.Finished() {
+		run.FinishedAt, run.ExitCode = time.Now(), -1
+		if err := db.FinishAgentRun(run.ID, run.FinishedAt, run.ExitCode); err != nil {
+			return nil, err
+		}
+	}
+	return run, nil
+}
+
+// stopAgent stops the agent running in env, if there is one: it marks the
+// run stopped and sends the agent SIGTERM, then SIGKILL if it hasn't exited
+// within agentStopTimeout. It reports whether an agent was stopped.
+func stopAgent(ctx context.Context, db *state.DB, be backend.Backend, env *state.Environment) (bool, error) {
+	run, err := checkAgentRun(ctx, db, be, env)
+	if err != nil || run == nil || run.Status != state.AgentRunning {
+		return false, err
+	}
+	sup, ok := be.(backend.Supervisor)
+	if !ok {
+		return false, fmt.Errorf("the %s backend can't stop agents", env.Backend)
+	}
+
+	if err := db.StopAgentRun(run.ID); err != nil {
+		return false, err
+	}
+	if err := sup.SignalProcess(ctx, env.BackendID, run.ProcessID, syscall.SIGTERM); err != nil {
+		return false, fmt.Errorf("failed to stop agent: %w", err)
+	}
+	deadline := time.Now().Add(agentStopTimeout)
+	for time.Now().Before(deadline) {
+		alive, err := sup.ProcessAlive(ctx, env.BackendID, run.ProcessID)
+		if err != nil {
+			return false, fmt.Errorf("failed to check agent: %w", err)
+		}
+		if !alive {
+			return true, nil
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	if err := sup.SignalProcess(ctx, env.BackendID, run.ProcessID, syscall.SIGKILL); err != nil {
+		return false, fmt.Errorf("failed to kill agent: %w", err)
+	}
+	return true, nil
+}
+
+// describeAgentRun summarizes run for env status, e.g., "running (process
+// 4242, started 5m ago)" or "exited with code 1, 2h ago".
+func describeAgentRun(run *state.AgentRun) string {
+	switch run.Status {
+	case state.AgentRunning:
+		return fmt.Sprintf("running (process %s, started %s)", run.ProcessID, formatTimeAgo(run.StartedAt))
+	case state.AgentExited:
+		return fmt.Sprintf("exited with code %d, %s", run.ExitCode, formatTimeAgo(run.FinishedAt))
+	}
+	if run.Finished() {
+		return fmt.Sprintf("%s, %s", run.Status, formatTimeAgo(run.FinishedAt))
+	}
+	return fmt.Sprintf("%s (started %s)", run.Status, formatTimeAgo(run.StartedAt))
+}
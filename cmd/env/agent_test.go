@@ -0,0 +1,148 @@
+package env
+
+import (
+	"context"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/Quidge/choir/internal/config"
+	"github.com/Quidge/choir/internal/state"
+)
+
+func TestAgentLaunchSpec(t *testing.T) {
+	env := &state.Environment{ID: "agentspec1234567890123456789012"}
+
+	tests := []struct {
+		name        string
+		prompt      string
+		task        string
+		wantCommand string
+		wantStdin   string // empty means the terminal's stdin
+	}{
+		{name: "arg", task: "Fix login", wantCommand: `claude "$CHOIR_TASK"`},
+		{name: "explicit arg", prompt: config.AgentPromptArg, task: "Fix login", wantCommand: `claude "$CHOIR_TASK"`},
+		{name: "stdin", prompt: config.AgentPromptStdin, task: "Fix login", wantCommand: "claude", wantStdin: "Fix login\n"},
+		{name: "none", prompt: config.AgentPromptNone, task: "Fix login", wantCommand: "claude"},
+		{name: "no task", task: "", wantCommand: "claude"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			agent := config.AgentConfig{
+				Command: "claude",
+				Prompt:  tt.prompt,
+				Env:     map[string]string{"AGENT_MODE": "auto"},
+			}
+			spec := agentLaunchSpec(env, agent, tt.task)
+
+			if spec.Command != tt.wantCommand {
+				t.Errorf("Command = %q, want %q", spec.Command, tt.wantCommand)
+			}
+			if spec.Env["CHOIR_ENV_ID"] != env.ID || spec.Env["CHOIR_TASK"] != tt.task || spec.Env["AGENT_MODE"] != "auto" {
+				t.Errorf("Env = %v, want CHOIR_ENV_ID, CHOIR_TASK and the agent's variables", spec.Env)
+			}
+			if tt.wantStdin == "" {
+				if spec.Stdin != os.Stdin {
+					t.Errorf("Stdin is not the terminal's")
+				}
+				return
+			}
+			got, err := io.ReadAll(spec.Stdin)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.wantStdin {
+				t.Errorf("Stdin = %q, want %q", got, tt.wantStdin)
+			}
+		})
+	}
+}
+
+func TestDescribeAgentRun(t *testing.T) {
+	started := time.Now().Add(-10 * time.Minute)
+	finished := time.Now().Add(-5 * time.Minute)
+
+	tests := []struct {
+		name string
+		run  state.AgentRun
+		want string
+	}{
+		{
+			name: "running",
+			run:  state.AgentRun{ProcessID: "4242", StartedAt: started, Status: state.AgentRunning},
+			want: "running (process 4242, started 10m ago)",
+		},
+		{
+			name: "exited",
+			run:  state.AgentRun{StartedAt: started, FinishedAt: finished, ExitCode: 1, Status: state.AgentExited},
+			want: "exited with code 1, 5m ago",
+		},
+		{
+			name: "crashed",
+			run:  state.AgentRun{StartedAt: started, FinishedAt: finished, ExitCode: -1, Status: state.AgentCrashed},
+			want: "crashed, 5m ago",
+		},
+		{
+			name: "crash not yet recorded",
+			run:  state.AgentRun{StartedAt: started, Status: state.AgentCrashed},
+			want: "crashed (started 10m ago)",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := describeAgentRun(&tt.run); got != tt.want {
+				t.Errorf("describeAgentRun() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStopAgent(t *testing.T) {
+	db := openReconcileDB(t)
+	ctx := context.Background()
+
+	env := newTestEnv("agentstop1234567890123456789012")
+	env.Status = state.StatusReady
+	env.BackendID = t.TempDir()
+	if err := db.CreateEnvironment(env); err != nil {
+		t.Fatalf("failed to create environment: %v", err)
+	}
+	be, err := getBackend(env.Backend, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if stopped, err := stopAgent(ctx, db, be, env); err != nil || stopped {
+		t.Fatalf("stopAgent() with no agent = %v, %v; want false, nil", stopped, err)
+	}
+
+	// An agent under a shell, as Launch starts it
+	agent := exec.Command("sh", "-c", "sleep 60; true")
+	if err := agent.Start(); err != nil {
+		t.Fatal(err)
+	}
+	waited := make(chan struct{})
+	go func() {
+		agent.Wait()
+		close(waited)
+	}()
+	run := &state.AgentRun{EnvironmentID: env.ID, Command: "sleep 60", ProcessID: strconv.Itoa(agent.Process.Pid), StartedAt: time.Now()}
+	if err := db.StartAgentRun(run); err != nil {
+		t.Fatalf("StartAgentRun() failed: %v", err)
+	}
+
+	if stopped, err := stopAgent(ctx, db, be, env); err != nil || !stopped {
+		t.Fatalf("stopAgent() = %v, %v; want true, nil", stopped, err)
+	}
+	select {
+	case <-waited:
+	case <-time.After(5 * time.Second):
+		t.Fatal("agent still running after stopAgent()")
+	}
+	if got, err := db.LatestAgentRun(env.ID); err != nil || got.Status != state.AgentStopped {
+		t.Errorf("agent run = %+v, %v; want stopped", got, err)
+	}
+}
@@ -2,29 +2,45 @@ package env
 
 import (
 	"context"
-	"errors"
 	"fmt"
+	"os"
+	"os/signal"
 
-	"github.com/Quidge/choir/internal/backend"
-	_ "github.com/Quidge/choir/internal/backend/worktree" // Register worktree backend
+	"github.com/Quidge/choir/internal/msg"
+	"github.com/Quidge/choir/internal/prompt"
 	"github.com/Quidge/choir/internal/state"
 	"github.com/spf13/cobra"
 )
 
 var attachCmd = &cobra.Command{
-	Use:   "attach ID",
+	Use:   "attach [ID]",
 	Short: "Enter an existing environment",
 	Long: `Enter an existing environment's shell.
 
 The ID can be a prefix if it uniquely identifies an environment.
-When you exit the shell, the environment continues to exist.`,
-	Args: cobra.ExactArgs(1),
+Without an ID, choir lists the environments to choose from when run at a
+terminal.
+When you exit the shell, the environment continues to exist. Attaching to a
+stopped environment offers to start it first.
+
+With --wait, attaching to an environment that is still provisioning shows
+its setup output as it runs and enters the shell as soon as it is ready.`,
+	Args: OptionalIDArg,
 	RunE: runAttach,
 }
 
+var attachWaitFlag bool
+
+func init() {
+	attachCmd.Flags().BoolVar(&attachWaitFlag, "wait", false, "follow setup of a provisioning environment, then attach")
+}
+
 func runAttach(cmd *cobra.Command, args []string) error {
 	ctx := context.Background()
-	idPrefix := args[0]
+
+	if err := prompt.RequireInteractive("attach a shell"); err != nil {
+		return err
+	}
 
 	// Open state database
 	db, err := state.Open("")
@@ -33,43 +49,48 @@ func runAttach(cmd *cobra.Command, args []string) error {
 	}
 	defer db.Close()
 
-	// Get environment from database by prefix
-	env, err := db.GetEnvironmentByPrefix(idPrefix)
+	// Resolve environment by ID prefix, or pick one
+	env, err := resolveEnvironmentArg(db, args)
 	if err != nil {
-		if errors.Is(err, state.ErrEnvironmentNotFound) {
-			return fmt.Errorf("environment %q not found", idPrefix)
-		}
-		var ambiguousErr *state.AmbiguousPrefixError
-		if errors.As(err, &ambiguousErr) {
-			return FormatAmbiguousPrefixError(ambiguousErr)
-		}
-		if errors.Is(err, state.ErrInvalidPrefix) {
-			return fmt.Errorf("invalid environment ID %q: must contain only hexadecimal characters", idPrefix)
+		return err
+	}
+
+	if env.Status == state.StatusProvisioning && attachWaitFlag {
+		env, err = waitForSetup(db, env)
+		if err != nil {
+			return err
 		}
-		return fmt.Errorf("failed to get environment: %w", err)
 	}
 
 	// Check environment status
+	shortID := state.ShortID(env.ID)
 	switch env.Status {
 	case state.StatusRemoved:
-		return fmt.Errorf("environment %q has been removed", idPrefix)
+		return fmt.Errorf("environment %q has been removed", shortID)
 	case state.StatusFailed:
-		return fmt.Errorf("environment %q is in failed state", idPrefix)
+		return fmt.Errorf("environment %q is in failed state", shortID)
 	case state.StatusProvisioning:
-		return fmt.Errorf("environment %q is still provisioning", idPrefix)
+		return fmt.Errorf("environment %q is still provisioning (use --wait to follow setup)", shortID)
+	case state.StatusStopped:
+		ok, err := prompt.Confirm(fmt.Sprintf("Environment %s is stopped. Start it?", shortID), true)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return fmt.Errorf("environment %q is stopped", shortID)
+		}
+		if err := StartEnvironment(ctx, db, env); err != nil {
+			return err
+		}
 	}
 
 	if env.BackendID == "" {
-		return fmt.Errorf("environment %q has no backend ID (may not be fully provisioned)", idPrefix)
+		return fmt.Errorf("environment %q has no backend ID (may not be fully provisioned)", shortID)
 	}
 
-	// Get backend - for MVP, always use worktree
-	be, err := backend.Get(backend.BackendConfig{
-		Name: env.Backend,
-		Type: "worktree",
-	})
+	be, err := getBackend(env.Backend, "")
 	if err != nil {
-		return fmt.Errorf("failed to get backend: %w", err)
+		return err
 	}
 
 	// Open shell
@@ -79,3 +100,20 @@ func runAttach(cmd *cobra.Command, args []string) error {
 
 	return nil
 }
+
+// waitForSetup shows env's setup output until it stops provisioning and
+// returns its final record. Interrupting stops waiting without attaching.
+func waitForSetup(db *state.DB, env *state.Environment) (*state.Environment, error) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	msg.Fprintf(os.Stderr, "Waiting for %s to finish provisioning...\n", state.ShortID(env.ID))
+	env, err := followSetup(ctx, db, env, os.Stdout)
+	if err != nil {
+		return nil, err
+	}
+	if env.Status == state.StatusFailed {
+		fmt.Fprintf(os.Stderr, "\nSetup failed. Inspect with: choir env status %s\n", state.ShortID(env.ID))
+	}
+	return env, nil
+}
@@ -0,0 +1,51 @@
+package env
+
+import (
+	"fmt"
+
+	"github.com/Quidge/choir/internal/backend"
+	_ "github.com/Quidge/choir/internal/backend/worktree" // Register worktree backend
+	"github.com/Quidge/choir/internal/config"
+)
+
+// backendOverride, if set, is the backend getBackend returns for every
+// environment (see UseBackend).
+var backendOverride backend.Backend
+
+// UseBackend makes the lifecycle operations in this package act on be for
+// every environment, whatever backend it was created with, until the
+// returned function is called. It lets the simulation harness drive them
+// against the fake backend, which is deliberately not in the registry.
+func UseBackend(be backend.Backend) (restore func()) {
+	prev := backendOverride
+	backendOverride = be
+	return func() { backendOverride = prev }
+}
+
+// getBackend returns a backend instance for the named backend, configured
+// from the global config. If shell is non-empty it overrides the configured
+// shell.
+func getBackend(name, shell string) (backend.Backend, error) {
+	if backendOverride != nil {
+		return backendOverride, nil
+	}
+	global, err := config.LoadGlobalConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load config: %w", err)
+	}
+
+	if shell == "" {
+		shell = global.ShellFor(name)
+	}
+
+	// For MVP, always use worktree
+	be, err := backend.Get(backend.BackendConfig{
+		Name:  name,
+		Type:  "worktree",
+		Shell: shell,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get backend: %w", err)
+	}
+	return be, nil
+}
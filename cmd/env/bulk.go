@@ -0,0 +1,219 @@
+package env
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Quidge/choir/internal/clierr"
+	"github.com/Quidge/choir/internal/config"
+	"github.com/Quidge/choir/internal/msg"
+	"github.com/Quidge/choir/internal/state"
+	"github.com/spf13/cobra"
+)
+
+// bulkSelection holds the flags with which rm, stop, and start act on every
+// environment matching a filter instead of one named by ID.
+type bulkSelection struct {
+	all       bool   // Every environment in the status the command acts on (stop, start)
+	allFailed bool   // Failed environments (rm)
+	olderThan string // Created longer ago than this, e.g., 7d
+	repo      bool   // Narrows the others to the current repository
+}
+
+// addFlags registers the selection flags on cmd, whose action is verb
+// (e.g., "stop"). allStatus, if set, adds --all for the environments in that
+// status; withFailed adds --all-failed.
+func (s *bulkSelection) addFlags(cmd *cobra.Command, verb string, allStatus state.EnvironmentStatus, withFailed bool) {
+	if allStatus != "" {
+		cmd.Flags().BoolVar(&s.all, "all", false, fmt.Sprintf("%s every %s environment", verb, allStatus))
+	}
+	if withFailed {
+		cmd.Flags().BoolVar(&s.allFailed, "all-failed", false, verb+" every failed environment")
+	}
+	cmd.Flags().StringVar(&s.olderThan, "older-than", "", verb+" environments created longer ago than this (e.g., 7d, 12h)")
+	cmd.Flags().BoolVar(&s.repo, "repo", false, "with a selector, only the current repository's environments")
+}
+
+// active reports whether a selector flag was given.
+func (s *bulkSelection) active() bool {
+	return s.all || s.allFailed || s.olderThan != ""
+}
+
+// args returns a cobra.PositionalArgs that accepts no arguments when a
+// selector flag is given, and otherwise checks them with single.
+func (s *bulkSelection) args(single cobra.PositionalArgs) cobra.PositionalArgs {
+	return func(cmd *cobra.Command, args []string) error {
+		if !s.active() {
+			if s.repo {
+				return clierr.Validation(fmt.Errorf("--repo only narrows %s", selectorFlags(cmd)))
+			}
+			return single(cmd, args)
+		}
+		if len(args) > 0 {
+			return clierr.Validation(fmt.Errorf("can't give an environment ID with %s", selectorFlags(cmd)))
+		}
+		return nil
+	}
+}
+
+// selectorFlags lists the selector flags cmd has, for messages.
+func selectorFlags(cmd *cobra.Command) string {
+	var names []string
+	for _, name := range []string{"all", "all-failed", "older-than"} {
+		if cmd.Flags().Lookup(name) != nil {
+			names = append(names, "--"+name)
+		}
+	}
+	return strings.Join(names, " or ")
+}
+
+// environments returns the environments in one of statuses that the
+// selection matches, oldest first.
+func (s *bulkSelection) environments(db *state.DB, statuses []state.EnvironmentStatus) ([]*state.Environment, error) {
+	opts := state.ListOptions{Statuses: statuses}
+	if s.allFailed {
+		opts.Statuses = []state.EnvironmentStatus{state.StatusFailed}
+	}
+	if s.olderThan != "" {
+		age, err := config.ParseTTL(s.olderThan)
+		if err != nil || age <= 0 {
+			return nil, clierr.Validation(fmt.Errorf("invalid --older-than %q: use a duration such as 7d or 12h", s.olderThan))
+		}
+		opts.CreatedBefore = time.Now().Add(-age)
+	}
+	if s.repo {
+		repos, closeRepos := openRepoCache()
+		repoRoot, err := repos.RepoRoot("")
+		closeRepos()
+		if err != nil {
+			return nil, fmt.Errorf("not in a git repository: %w", err)
+		}
+		opts.RepoPath = repoRoot
+	}
+
+	envs, err := db.ListEnvironments(opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list environments: %w", err)
+	}
+	// Oldest first reads naturally for cleanup
+	for i, j := 0, len(envs)-1; i < j; i, j = i+1, j-1 {
+		envs[i], envs[j] = envs[j], envs[i]
+	}
+	return envs, nil
+}
+
+// printBulkList lists envs before a bulk operation asks for confirmation.
+// note, if set, adds a remark to an environment's line.
+func printBulkList(envs []*state.Environment, note func(*state.Environment) string) {
+	var idWidth, statusWidth, branchWidth int
+	for _, env := range envs {
+		idWidth = max(idWidth, len(state.ShortID(env.ID)))
+		statusWidth = max(statusWidth, len(env.Status))
+		branchWidth = max(branchWidth, len(env.BranchName))
+	}
+	for _, env := range envs {
+		line := fmt.Sprintf("  %-*s  %-*s  %-*s  %s", idWidth, state.ShortID(env.ID),
+			statusWidth, env.Status, branchWidth, env.BranchName, formatTimeAgo(env.CreatedAt))
+		if note != nil {
+			if n := note(env); n != "" {
+				line += "  (" + n + ")"
+			}
+		}
+		fmt.Println(strings.TrimRight(line, " "))
+	}
+}
+
+// runBulk calls fn on each of envs, reporting each result with verb (e.g.,
+// "Removed"), and continues past failures. It fails if any call did.
+func runBulk(envs []*state.Environment, verb string, fn func(*state.Environment) error) error {
+	var failed int
+	for _, env := range envs {
+		if err := fn(env); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %s: %v\n", state.ShortID(env.ID), err)
+			failed++
+			continue
+		}
+		msg.Printf("%s %s\n", verb, state.ShortID(env.ID))
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d environments failed", failed, len(envs))
+	}
+	return nil
+}
+
+// runBulkTransition calls fn on each of envs, as runBulk does, then moves
+// those it succeeded on to status to together (see transitionEnvironments),
+// reporting each result with verb once its status is recorded.
+func runBulkTransition(db *state.DB, envs []*state.Environment, verb string, to state.EnvironmentStatus, fn func(*state.Environment) error) error {
+	var failed int
+	var done []*state.Environment
+	for _, env := range envs {
+		if err := fn(env); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %s: %v\n", state.ShortID(env.ID), err)
+			failed++
+			continue
+		}
+		done = append(done, env)
+	}
+	errs := transitionEnvironments(db, done, to)
+	for _, env := range done {
+		if err, ok := errs[env.ID]; ok {
+			fmt.Fprintf(os.Stderr, "error: %s: %v\n", state.ShortID(env.ID), err)
+			failed++
+			continue
+		}
+		msg.Printf("%s %s\n", verb, state.ShortID(env.ID))
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d environments failed", failed, len(envs))
+	}
+	return nil
+}
+
+// transitionEnvironments moves each of envs from its current status to
+// status to, with one db.BulkUpdateStatus transaction per current status
+// rather than an update per environment. If a transaction fails, usually
+// because one of its environments changed status meanwhile, its
+// environments are moved one at a time instead, so the others still are.
+// Moved environments have their Status set to to; the others are returned
+// by ID with the reason they weren't moved.
+func transitionEnvironments(db *state.DB, envs []*state.Environment, to state.EnvironmentStatus) map[string]error {
+	var froms []state.EnvironmentStatus
+	groups := make(map[state.EnvironmentStatus][]*state.Environment)
+	for _, env := range envs {
+		if _, ok := groups[env.Status]; !ok {
+			froms = append(froms, env.Status)
+		}
+		groups[env.Status] = append(groups[env.Status], env)
+	}
+
+	failed := make(map[string]error)
+	for _, from := range froms {
+		group := groups[from]
+		ids := make([]string, len(group))
+		for i, env := range group {
+			ids[i] = env.ID
+		}
+		if err := db.BulkUpdateStatus(ids, from, to); err == nil {
+			for _, env := range group {
+				env.Status = to
+			}
+			continue
+		}
+		for _, env := range group {
+			if err := db.BulkUpdateStatus([]string{env.ID}, from, to); err != nil {
+				failed[env.ID] = fmt.Errorf("failed to update status: %w", err)
+				continue
+			}
+			env.Status = to
+		}
+	}
+	return failed
+}
+
+// countEnvironments formats n environments, e.g., "3 environments".
+func countEnvironments(n int) string {
+	return fmt.Sprintf("%d %s", n, plural(n, "environment", "environments"))
+}
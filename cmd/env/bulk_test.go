@@ -0,0 +1,66 @@
+package env
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/Quidge/choir/internal/state"
+)
+
+func TestBulkSelection(t *testing.T) {
+	db := openReconcileDB(t)
+
+	for _, e := range []struct {
+		id     string
+		status state.EnvironmentStatus
+		age    time.Duration
+	}{
+		{"aaaa0000000000000000000000000000", state.StatusReady, 10 * 24 * time.Hour},
+		{"bbbb0000000000000000000000000000", state.StatusFailed, 8 * 24 * time.Hour},
+		{"cccc0000000000000000000000000000", state.StatusFailed, time.Hour},
+		{"dddd0000000000000000000000000000", state.StatusProvisioning, 9 * 24 * time.Hour},
+		{"eeee0000000000000000000000000000", state.StatusStopped, time.Hour},
+	} {
+		env := newTestEnv(e.id)
+		env.Status = e.status
+		env.CreatedAt = time.Now().Add(-e.age)
+		if err := db.CreateEnvironment(env); err != nil {
+			t.Fatalf("CreateEnvironment() failed: %v", err)
+		}
+	}
+
+	ids := func(envs []*state.Environment) []string {
+		var out []string
+		for _, env := range envs {
+			out = append(out, env.ID[:4])
+		}
+		return out
+	}
+	tests := []struct {
+		name     string
+		sel      bulkSelection
+		statuses []state.EnvironmentStatus
+		want     []string
+	}{
+		{"all failed", bulkSelection{allFailed: true}, rmBulkStatuses, []string{"bbbb", "cccc"}},
+		{"older than, oldest first", bulkSelection{olderThan: "7d"}, rmBulkStatuses, []string{"aaaa", "bbbb"}},
+		{"failed and older", bulkSelection{allFailed: true, olderThan: "2d"}, rmBulkStatuses, []string{"bbbb"}},
+		{"all stopped", bulkSelection{all: true}, []state.EnvironmentStatus{state.StatusStopped}, []string{"eeee"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			envs, err := tt.sel.environments(db, tt.statuses)
+			if err != nil {
+				t.Fatalf("environments() failed: %v", err)
+			}
+			if got := ids(envs); !slices.Equal(got, tt.want) {
+				t.Errorf("environments() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := (&bulkSelection{olderThan: "soon"}).environments(db, nil); err == nil {
+		t.Error("environments() with an invalid --older-than succeeded, want error")
+	}
+}
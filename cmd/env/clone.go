@@ -0,0 +1,91 @@
+package env
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Quidge/choir/internal/clierr"
+	"github.com/Quidge/choir/internal/prompt"
+	"github.com/Quidge/choir/internal/resolve"
+	"github.com/Quidge/choir/internal/state"
+	"github.com/spf13/cobra"
+)
+
+var cloneCmd = &cobra.Command{
+	Use:   "clone ID",
+	Short: "Create an environment branched from another one",
+	Long: `Create a new environment branched from an existing environment's branch,
+to fork an experiment without setting up from the base branch again.
+
+The new environment gets its own branch (env/<short-id> by default) starting
+at the source's last commit, in the same repository, with the source's
+profile, backend, remote, and task. Instead of running setup, the source
+workspace's env file, TASK.md, and file mounts are copied into it, so edits
+made to them since setup carry over. Git settings (identity, commit trailer,
+excludes) are applied as env create would. What setup commands produced,
+such as installed dependencies, is not copied; run them in the new
+environment if it needs them.
+
+Uncommitted changes in the source stay behind; commit them first to take
+them along.
+
+The ID can be a prefix if it uniquely identifies an environment. The new
+environment's ID is printed on success.`,
+	Args: cobra.ExactArgs(1),
+	RunE: runClone,
+}
+
+var (
+	cloneTTLFlag    string
+	cloneAttachFlag bool
+	cloneIgnoreFlag bool
+)
+
+func init() {
+	cloneCmd.Flags().StringVar(&cloneTTLFlag, "ttl", "", "remove the environment with choir gc after this long (e.g., 8h, 2d; 0 for never)")
+	cloneCmd.Flags().BoolVar(&cloneAttachFlag, "attach", false, "enter the environment shell after creation")
+	cloneCmd.Flags().BoolVar(&cloneIgnoreFlag, "ignore-resource-check", false, "create even if the CPUs and memory asked for don't fit on the host")
+}
+
+func runClone(cmd *cobra.Command, args []string) error {
+	ctx := context.Background()
+
+	if cloneAttachFlag {
+		if err := prompt.RequireInteractive("attach a shell (omit --attach)"); err != nil {
+			return err
+		}
+	}
+
+	db, err := state.OpenReadOnly("")
+	if err != nil {
+		return fmt.Errorf("failed to open state database: %w", err)
+	}
+	src, err := resolve.Environment(db, args[0])
+	db.Close()
+	if err != nil {
+		return err
+	}
+	if src.Status != state.StatusReady && src.Status != state.StatusStopped {
+		return clierr.Validation(fmt.Errorf("environment %s is %s; only ready or stopped environments can be cloned", state.ShortID(src.ID), src.Status))
+	}
+
+	env, be, err := createEnvironment(ctx, CreateOptions{
+		TTL:       cloneTTLFlag,
+		Task:      src.Task,
+		CloneFrom: src,
+
+		IgnoreResourceCheck: cloneIgnoreFlag,
+	}, &createResult{})
+	if err != nil {
+		return err
+	}
+
+	if cloneAttachFlag {
+		if err := be.Shell(ctx, env.BackendID); err != nil {
+			return fmt.Errorf("shell exited with error: %w", err)
+		}
+		return nil
+	}
+	fmt.Println(state.ShortID(env.ID))
+	return nil
+}
@@ -2,14 +2,27 @@ package env
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"maps"
+	"os"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/Quidge/choir/internal/backend"
 	_ "github.com/Quidge/choir/internal/backend/worktree" // Register worktree backend
+	"github.com/Quidge/choir/internal/bugreport"
+	"github.com/Quidge/choir/internal/cache"
+	"github.com/Quidge/choir/internal/clierr"
 	"github.com/Quidge/choir/internal/config"
 	"github.com/Quidge/choir/internal/gitutil"
+	"github.com/Quidge/choir/internal/msg"
+	"github.com/Quidge/choir/internal/naming"
+	"github.com/Quidge/choir/internal/prompt"
+	"github.com/Quidge/choir/internal/repocache"
 	"github.com/Quidge/choir/internal/state"
 	"github.com/spf13/cobra"
 )
@@ -22,172 +35,821 @@ var createCmd = &cobra.Command{
 The environment runs in an isolated workspace with a clone of the current repository
 on a dedicated branch (env/<short-id> by default).
 
-The environment ID is printed on success for scripting use.`,
+Use --repo to create an environment for another repository without changing
+directory. It accepts a local path or a remote URL; remote repositories are
+cloned into ~/.local/share/choir/repos/ on first use and fast-forwarded on
+later uses. For heavy repositories, --clone-depth and --clone-filter (or
+clone: in the global config) make the first clone shallow or partial.
+
+Use --from-branch to check out an existing branch in the environment, for
+work already started on it, instead of creating a new branch. A branch that
+only exists on the remote gets a local branch tracking it. Git checks a
+branch out in only one worktree at a time, so the branch must not be
+checked out elsewhere, including in the repository itself.
+
+The environment ID is printed on success for scripting use. Wrappers that
+need more detail can pass --result-file to get a JSON summary (ID, path,
+branch, status, timing) written when create finishes, whether it succeeds
+or fails.
+
+Use --fetch (or fetch_before_create in the global or project config) to
+fetch the remote first and fast-forward the base branch to it, so the
+environment doesn't start from stale code. If the base branch has diverged
+from the remote, or is checked out with uncommitted changes, create warns
+how far behind it is and uses it as it is. A failed fetch fails --fetch but
+only warns with fetch_before_create.
+
+Use --ttl (or default_ttl in the global config, ttl in the project config)
+to give the environment an expiry time; "choir gc" removes expired
+environments.
+
+Use --profile to create the environment from one of the profiles defined
+under profiles: in .choir.yaml, merged on top of the rest of the project
+config.
+
+Use --template to set the environment up from a template saved with
+"choir env template create" instead of the project config's env, files,
+setup, and cache settings.
+
+Use --prompt (or --prompt - to read it from stdin) or --task-file to record
+the task the environment is for; "env status" shows it. With --task-md the
+task is also written to TASK.md in the workspace, excluded from git.
+
+Use --detach to return as soon as the environment is recorded: its ID is
+printed while a background process creates the workspace and runs setup.
+The environment is provisioning until then; wait for it with "choir env
+wait", or follow its setup with "choir env attach --wait".
+
+With pool: N in .choir.yaml, create takes a ready environment from the
+repository's warm pool, rebased onto the base branch, instead of
+provisioning one, and refills the pool in the background (see "choir env
+pool").
+
+Use --plan to see what create would do without doing it: the workspace
+path and branch, the files mounted and how, the environment variables
+(secret values redacted), and the setup commands in order. The ID shown is
+provisional; create picks a fresh one.
+
+Backends that allocate CPUs and memory to each environment, such as VM
+backends, check the resources asked for against the host first, counting
+what running environments already hold. Create refuses if they don't fit
+in the host's memory or ask for more CPUs than it has, and warns if the
+host's CPUs would be oversubscribed or less memory is free than asked for.
+Use --ignore-resource-check to create anyway.`,
 	Args: cobra.NoArgs,
 	RunE: runCreate,
 }
 
 var (
-	baseFlag    string
-	backendFlag string
-	noSetupFlag bool
-	attachFlag  bool
+	baseFlag     string
+	fromBranch   string
+	backendFlag  string
+	profileFlag  string
+	templateFlag string
+	noSetupFlag  bool
+	attachFlag   bool
+	repoFlag     string
+	cloneDepth   int
+	cloneFilter  string
+	ttlFlag      string
+	remoteFlag   string
+
+	promptFlag   string
+	taskFileFlag string
+	taskMDFlag   bool
+
+	createResultFileFlag string
+	planFlag             bool
+	ignoreResourcesFlag  bool
+	detachFlag           bool
+	fetchFlag            bool
 )
 
 func init() {
 	createCmd.Flags().StringVar(&baseFlag, "base", "", "base branch to create from (default: current branch)")
 	createCmd.Flags().StringVar(&backendFlag, "backend", "", "override default backend")
+	createCmd.Flags().StringVar(&fromBranch, "from-branch", "", "check out this existing branch instead of creating one")
+	createCmd.Flags().StringVar(&profileFlag, "profile", "", "use this profile from the project config")
+	createCmd.Flags().StringVar(&templateFlag, "template", "", "set up from a saved template (see 'choir env template')")
 	createCmd.Flags().BoolVar(&noSetupFlag, "no-setup", false, "skip setup commands from project config")
 	createCmd.Flags().BoolVar(&attachFlag, "attach", false, "enter the environment shell after creation")
+	createCmd.Flags().StringVar(&repoFlag, "repo", "", "repository path or remote URL (default: current repository)")
+	createCmd.Flags().IntVar(&cloneDepth, "clone-depth", 0, "when cloning a --repo URL, fetch only this many commits per branch")
+	createCmd.Flags().StringVar(&cloneFilter, "clone-filter", "", "when cloning a --repo URL, use this partial clone filter (e.g., blob:none)")
+	createCmd.Flags().StringVar(&ttlFlag, "ttl", "", "remove the environment with choir gc after this long (e.g., 8h, 2d; 0 for never)")
+	createCmd.Flags().StringVar(&remoteFlag, "remote", "", "git remote to record and push to (default: remote from config, else origin)")
+	createCmd.Flags().StringVar(&promptFlag, "prompt", "", "record this task for the environment (- to read it from stdin)")
+	createCmd.Flags().StringVar(&taskFileFlag, "task-file", "", "record the task in this file for the environment")
+	createCmd.Flags().BoolVar(&taskMDFlag, "task-md", false, "also write the task to TASK.md in the workspace")
+	createCmd.Flags().StringVar(&createResultFileFlag, "result-file", "", "write a JSON result to this path when create finishes")
+	createCmd.Flags().BoolVar(&planFlag, "plan", false, "print what create would do, without creating anything")
+	createCmd.Flags().BoolVar(&fetchFlag, "fetch", false, "fetch the remote and fast-forward the base branch first")
+	createCmd.Flags().BoolVar(&detachFlag, "detach", false, "print the ID and provision the environment in the background")
+	createCmd.Flags().BoolVar(&ignoreResourcesFlag, "ignore-resource-check", false, "create even if the CPUs and memory asked for don't fit on the host")
+
+	_ = createCmd.RegisterFlagCompletionFunc("profile", completeProfiles)
 }
 
-func runCreate(cmd *cobra.Command, args []string) error {
+// completeProfiles completes --profile with the profiles in the project
+// config found from the current directory.
+func completeProfiles(_ *cobra.Command, _ []string, _ string) ([]string, cobra.ShellCompDirective) {
+	project, err := config.LoadProjectConfig("")
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	return project.ProfileNames(), cobra.ShellCompDirectiveNoFileComp
+}
+
+// createResult is the JSON document written to --result-file.
+type createResult struct {
+	ID         string    `json:"id,omitempty"`
+	ShortID    string    `json:"short_id,omitempty"`
+	Path       string    `json:"path,omitempty"`
+	Branch     string    `json:"branch,omitempty"`
+	BaseBranch string    `json:"base_branch,omitempty"`
+	Repo       string    `json:"repo,omitempty"`
+	Status     string    `json:"status"` // "ready" or "failed"
+	Error      string    `json:"error,omitempty"`
+	ErrorKind  string    `json:"error_kind,omitempty"` // clierr kind of Error
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+	DurationMs int64     `json:"duration_ms"`
+	SetupMs    int64     `json:"setup_ms"`
+
+	SetupCommands []setupCommandResult `json:"setup_commands,omitempty"`
+}
+
+// setupCommandResult summarizes one setup command in a createResult.
+type setupCommandResult struct {
+	Command    string `json:"command"`
+	ExitCode   int    `json:"exit_code"`
+	DurationMs int64  `json:"duration_ms"`
+}
+
+// writeResultFile finalizes res with the outcome of create and writes it to
+// path. The file is written to a temporary name and renamed into place so
+// wrappers polling for it never read a partial document.
+func writeResultFile(path string, res *createResult, createErr error) error {
+	res.FinishedAt = time.Now()
+	res.DurationMs = res.FinishedAt.Sub(res.StartedAt).Milliseconds()
+	res.Status = string(state.StatusReady)
+	if createErr != nil {
+		res.Status = string(state.StatusFailed)
+		res.Error = createErr.Error()
+		res.ErrorKind = string(clierr.KindOf(createErr))
+	}
+
+	data, err := json.MarshalIndent(res, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal result: %w", err)
+	}
+	data = append(data, '\n')
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write result file: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("failed to write result file: %w", err)
+	}
+	return nil
+}
+
+func runCreate(cmd *cobra.Command, args []string) (err error) {
 	ctx := context.Background()
 
-	// Generate environment ID
-	envID, err := state.GenerateID()
+	result := &createResult{StartedAt: time.Now()}
+	resultWritten := false
+	defer func() {
+		if createResultFileFlag == "" || resultWritten {
+			return
+		}
+		if werr := writeResultFile(createResultFileFlag, result, err); werr != nil {
+			fmt.Fprintf(os.Stderr, "warning: %v\n", werr)
+		}
+	}()
+
+	if planFlag && (attachFlag || createResultFileFlag != "") {
+		return clierr.Validation(errors.New("--plan can't be used with --attach or --result-file"))
+	}
+	if detachFlag && (planFlag || attachFlag || createResultFileFlag != "") {
+		return clierr.Validation(errors.New("--detach can't be used with --plan, --attach, or --result-file"))
+	}
+
+	// Fail before provisioning anything if --attach can't be honored
+	if attachFlag {
+		if err := prompt.RequireInteractive("attach a shell (omit --attach)"); err != nil {
+			return err
+		}
+		if promptFlag == "-" {
+			return clierr.Validation(errors.New("--prompt - can't be used with --attach, which needs stdin for the shell"))
+		}
+	}
+
+	task, err := readTask(promptFlag, taskFileFlag, os.Stdin)
 	if err != nil {
-		return fmt.Errorf("failed to generate environment ID: %w", err)
+		return err
+	}
+	if taskMDFlag && task == "" {
+		return clierr.Validation(errors.New("--task-md requires --prompt or --task-file"))
+	}
+
+	env, be, err := createEnvironment(ctx, CreateOptions{
+		Repo:        repoFlag,
+		CloneDepth:  cloneDepth,
+		CloneFilter: cloneFilter,
+		Base:        baseFlag,
+		FromBranch:  fromBranch,
+		Backend:     backendFlag,
+		Profile:     profileFlag,
+		Template:    templateFlag,
+		TTL:         ttlFlag,
+		Remote:      remoteFlag,
+		NoSetup:     noSetupFlag,
+		Task:        task,
+		TaskMD:      taskMDFlag,
+		Plan:        planFlag,
+		Detach:      detachFlag,
+		Fetch:       fetchFlag,
+
+		IgnoreResourceCheck: ignoreResourcesFlag,
+	}, result)
+	if err != nil || planFlag {
+		return err
 	}
-	shortID := state.ShortID(envID)
 
-	// Get base branch from flag or current branch
-	baseBranch := baseFlag
+	// Write the result before attaching, since the shell may run for hours
+	if createResultFileFlag != "" {
+		resultWritten = true
+		if err := writeResultFile(createResultFileFlag, result, nil); err != nil {
+			fmt.Fprintf(os.Stderr, "warning: %v\n", err)
+		}
+	}
+
+	if attachFlag {
+		if err := be.Shell(ctx, env.BackendID); err != nil {
+			return fmt.Errorf("shell exited with error: %w", err)
+		}
+	} else {
+		// Print just the short ID for scripting
+		fmt.Println(state.ShortID(env.ID))
+		if detachFlag && env.Status == state.StatusProvisioning {
+			shortID := state.ShortID(env.ID)
+			msg.Fprintf(os.Stderr, "Provisioning %s in the background; follow it with: choir env attach %s --wait\n", shortID, shortID)
+		}
+	}
+
+	return nil
+}
+
+// CreateOptions are the inputs to CreateEnvironment, mirroring the
+// env create flags.
+type CreateOptions struct {
+	Repo        string // Repository path or remote URL (default: current repository)
+	CloneDepth  int    // History to fetch when cloning a remote Repo (see config.CloneConfig)
+	CloneFilter string // Partial clone filter for a remote Repo (see config.CloneConfig)
+	Base        string // Base branch (default: the repository's current branch)
+	FromBranch  string // Existing branch to check out instead of creating one
+	Backend     string // Backend name override
+	Profile     string // Project config profile to use (see config.Profile)
+	Template    string // Template to set up from (see config.Template)
+	TTL         string // Lifetime override (see config.ParseTTL)
+	Remote      string // Git remote to record and push to (default: from config, else origin)
+	NoSetup     bool   // Skip setup
+	Task        string // What the environment is for, recorded with it
+	TaskMD      bool   // Also write Task to TASK.md in the workspace
+	Plan        bool   // Print what would be done instead of doing it; no environment is returned
+	Fetch       bool   // Fetch and fast-forward the base branch first (see refreshBase)
+
+	// Detach records the environment and provisions it in a background
+	// process instead of waiting; the environment returned is still
+	// provisioning (see startDetachedProvision).
+	Detach bool
+
+	// IgnoreResourceCheck creates the environment even if the resources it
+	// asks for don't fit on the host (see checkHostResources).
+	IgnoreResourceCheck bool
+
+	// Pooled creates the environment for its repository's warm pool, with
+	// no task or expiry, rather than for use (see fillPool).
+	Pooled bool
+
+	// CloneFrom, if set, is the environment to fork (env clone): the new
+	// environment branches from its branch in its repository, with its
+	// profile, backend, and remote, and its setup is copied rather than run
+	// again (see ProvisionSpec.CloneFrom). Repo, Base, Profile, Backend, and
+	// Remote are ignored.
+	CloneFrom *state.Environment
+}
+
+// readTask returns the task given by --prompt or --task-file, or "" if
+// neither was. A prompt of "-" is read from stdin.
+func readTask(promptText, taskFile string, stdin io.Reader) (string, error) {
+	if promptText != "" && taskFile != "" {
+		return "", clierr.Validation(errors.New("--prompt and --task-file can't be used together"))
+	}
+	var task string
+	switch {
+	case promptText == "-":
+		data, err := io.ReadAll(stdin)
+		if err != nil {
+			return "", fmt.Errorf("failed to read task from stdin: %w", err)
+		}
+		task = string(data)
+	case promptText != "":
+		task = promptText
+	case taskFile != "":
+		data, err := os.ReadFile(taskFile)
+		if err != nil {
+			return "", fmt.Errorf("failed to read task file: %w", err)
+		}
+		task = string(data)
+	default:
+		return "", nil
+	}
+	task = strings.TrimSpace(task)
+	if task == "" {
+		return "", clierr.Validation(errors.New("task is empty"))
+	}
+	return task, nil
+}
+
+// selectRemote returns the git remote of repoRoot an environment records
+// and pushes to, and its URL. An empty name selects origin, and a
+// repository without origin has no remote; a remote asked for by name must
+// exist.
+func selectRemote(repos *repocache.Cache, repoRoot, name string) (string, string, error) {
+	if name == "" {
+		url, err := repos.RemoteURL(repoRoot, "origin")
+		if err != nil {
+			return "", "", nil
+		}
+		return "origin", url, nil
+	}
+	url, err := repos.RemoteURL(repoRoot, name)
+	if err != nil {
+		return "", "", clierr.NotFound(fmt.Errorf("remote %q not found in %s", name, repoRoot))
+	}
+	return name, url, nil
+}
+
+// checkFromBranch checks that branch, given to --from-branch, can be
+// checked out in a new worktree of repoRoot: it must exist, locally or on
+// remote (where it is tracked from), and not be checked out already.
+func checkFromBranch(repoRoot, remote, branch string) error {
+	if err := gitutil.ValidateBranchName(branch); err != nil {
+		return clierr.Validation(fmt.Errorf("invalid --from-branch: %w", err))
+	}
+	if remote == "" {
+		remote = "origin"
+	}
+	if !gitutil.RefExists(repoRoot, "refs/heads/"+branch) && !gitutil.RefExists(repoRoot, "refs/remotes/"+remote+"/"+branch) {
+		return clierr.NotFound(fmt.Errorf("branch %q not found in %s or its %s remote (run git fetch if it's new)", branch, repoRoot, remote))
+	}
+	if err := gitutil.TrackRemoteBranch(repoRoot, remote, branch); err != nil {
+		return err
+	}
+	path, err := gitutil.WorktreeForBranch(repoRoot, branch)
+	if err != nil {
+		return err
+	}
+	if path != "" {
+		return clierr.Validation(fmt.Errorf("branch %q is checked out in %s; switch that checkout to another branch first", branch, path))
+	}
+	return nil
+}
+
+// CreateEnvironment creates and provisions a new environment, as env create
+// does, and returns it once ready.
+func CreateEnvironment(ctx context.Context, opts CreateOptions) (*state.Environment, error) {
+	env, _, err := createEnvironment(ctx, opts, &createResult{StartedAt: time.Now()})
+	return env, err
+}
+
+// createEnvironment implements CreateEnvironment, filling in result as it
+// learns details and returning the backend for attaching.
+func createEnvironment(ctx context.Context, opts CreateOptions, result *createResult) (*state.Environment, backend.Backend, error) {
+	if src := opts.CloneFrom; src != nil {
+		opts.Repo = src.RepoPath
+		opts.Base = src.BranchName
+		opts.Profile = src.Profile
+		opts.Backend = src.Backend
+		opts.Remote = src.Remote
+	}
+
+	// Get base branch from options or current branch
+	baseBranch := opts.Base
+
+	// Open the state database, which the repo cache shares. Printing the
+	// plan must not write to it, so then the cache is only read.
+	var db *state.DB
+	var repos *repocache.Cache
+	if opts.Plan {
+		var closeRepos func()
+		repos, closeRepos = openRepoCache()
+		defer closeRepos()
+	} else {
+		var err error
+		db, err = state.Open("")
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to open state database: %w", err)
+		}
+		defer db.Close()
+		repos = repocache.New(db)
+	}
 
 	// Get repository info
-	repoRoot, err := gitutil.RepoRoot("")
+	var clone gitutil.CloneOptions
+	if gitutil.IsRemoteURL(opts.Repo) {
+		var err error
+		if clone, err = cloneOptions(opts.CloneDepth, opts.CloneFilter); err != nil {
+			return nil, nil, err
+		}
+	} else if opts.CloneDepth != 0 || opts.CloneFilter != "" {
+		fmt.Fprintf(os.Stderr, "warning: --clone-depth and --clone-filter only apply when cloning a --repo URL\n")
+	}
+	repoRoot, managed, err := resolveRepo(repos, opts.Repo, clone)
 	if err != nil {
-		return fmt.Errorf("not in a git repository: %w", err)
+		return nil, nil, err
 	}
 
-	remoteURL, _ := gitutil.RemoteURL(repoRoot, "origin")
+	// Managed clones only have the default branch locally
+	if managed && baseBranch != "" {
+		if err := gitutil.TrackRemoteBranch(repoRoot, "origin", baseBranch); err != nil {
+			return nil, nil, clierr.NotFound(fmt.Errorf("base branch %q not found in %s: %w", baseBranch, opts.Repo, err))
+		}
+	}
 
 	if baseBranch == "" {
-		baseBranch, err = gitutil.CurrentBranch(repoRoot)
+		baseBranch, err = repos.CurrentBranch(repoRoot)
 		if err != nil {
 			if errors.Is(err, gitutil.ErrDetachedHead) {
-				return fmt.Errorf("cannot create environment from detached HEAD, use --base to specify a branch")
+				return nil, nil, clierr.Validation(errors.New("cannot create environment from detached HEAD, use --base to specify a branch"))
 			}
-			return fmt.Errorf("failed to get current branch: %w", err)
+			return nil, nil, fmt.Errorf("failed to get current branch: %w", err)
 		}
 	}
 
-	// Load configuration
-	merged, err := config.LoadFromCwd(config.FlagOverrides{
-		Backend: backendFlag,
-	})
+	// Load configuration. With --repo, the project config comes from that
+	// repository rather than the current directory.
+	flags := config.FlagOverrides{
+		Backend: opts.Backend,
+		Profile: opts.Profile,
+		Remote:  opts.Remote,
+	}
+	if opts.Template != "" {
+		tmpl, err := config.LoadTemplate(opts.Template)
+		if err != nil {
+			return nil, nil, err
+		}
+		flags.Template = &tmpl
+	}
+	var merged config.MergedConfig
+	if opts.Repo != "" {
+		merged, err = config.Load(repoRoot, flags)
+	} else {
+		merged, err = config.LoadFromCwd(flags)
+	}
 	if err != nil {
-		return fmt.Errorf("failed to load config: %w", err)
+		return nil, nil, fmt.Errorf("failed to load config: %w", err)
 	}
 
 	// For MVP, force worktree backend
 	merged.BackendType = "worktree"
 
+	// Managed clones only have origin, the URL they were cloned from
+	if managed {
+		if opts.Remote != "" && opts.Remote != "origin" {
+			return nil, nil, clierr.Validation(errors.New("--remote can't be used with a remote URL --repo; its clone only has origin"))
+		}
+		merged.Remote = ""
+	}
+	remote, remoteURL, err := selectRemote(repos, repoRoot, merged.Remote)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if opts.FromBranch != "" {
+		if err := checkFromBranch(repoRoot, remote, opts.FromBranch); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	// Bring the base branch up to date. Environments checking out an
+	// existing branch or cloning another don't start from it, and pooled
+	// ones are rebased onto it when taken.
+	if (opts.Fetch || merged.FetchBeforeCreate) && opts.FromBranch == "" && opts.CloneFrom == nil && !opts.Pooled && !opts.Plan {
+		if err := refreshBase(repoRoot, remote, baseBranch); err != nil {
+			if opts.Fetch {
+				return nil, nil, err
+			}
+			fmt.Fprintf(os.Stderr, "warning: %v\n", err)
+		}
+	}
+
+	// An explicit TTL overrides the configured one
+	ttl := merged.TTL
+	if opts.TTL != "" {
+		ttl, err = config.ParseTTL(opts.TTL)
+		if err != nil {
+			return nil, nil, clierr.Validation(fmt.Errorf("invalid ttl: %w", err))
+		}
+	}
+	if opts.Pooled {
+		ttl = 0
+		opts.Task = ""
+	}
+
 	// Build repository info
 	repoInfo := config.RepositoryInfo{
 		Path:       repoRoot,
+		Remote:     remote,
 		RemoteURL:  remoteURL,
 		BaseBranch: baseBranch,
 	}
 
-	// Build CreateConfig
-	createCfg, err := config.NewCreateConfig(merged, repoInfo, envID)
+	// Reserve an environment ID and branch name
+	allocator, err := naming.FromConfig(merged.Naming)
 	if err != nil {
-		return fmt.Errorf("failed to build config: %w", err)
+		return nil, nil, err
 	}
+	reservation, err := allocator.Reserve(ctx, naming.Request{
+		RepoPath:     repoRoot,
+		RemoteURL:    remoteURL,
+		BaseBranch:   baseBranch,
+		BranchPrefix: merged.BranchPrefix,
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to reserve environment ID: %w", err)
+	}
+	envID := reservation.ID
+	shortID := state.ShortID(envID)
+	branchName := reservation.Branch
+	if opts.FromBranch != "" {
+		branchName = opts.FromBranch
+	}
+
+	result.ID = envID
+	result.ShortID = shortID
+	result.Branch = branchName
+	result.BaseBranch = baseBranch
+	result.Repo = repoRoot
 
-	// Determine branch name
-	branchPrefix := merged.BranchPrefix
-	if branchPrefix == "" {
-		branchPrefix = "env/"
+	// Release the reservation if we fail before the environment is
+	// recorded; after that it is released by `env rm`.
+	recorded := false
+	defer func() {
+		if !recorded {
+			_ = allocator.Release(ctx, reservation)
+		}
+	}()
+
+	// Build CreateConfig
+	plan, err := config.PlanCreate(merged, repoInfo, envID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to build config: %w", err)
+	}
+	createCfg := plan.Config
+	createCfg.BranchName = branchName
+	createCfg.ExistingBranch = opts.FromBranch != ""
+	if opts.TaskMD {
+		createCfg.TaskFile = opts.Task
+	}
+	if err := cache.Validate(createCfg.Cache); err != nil {
+		return nil, nil, fmt.Errorf("invalid cache config: %w", err)
 	}
-	branchName := branchPrefix + shortID
 
-	// Open state database
-	db, err := state.Open("")
+	// Get backend
+	beCfg := backend.BackendConfig{
+		Name:  merged.Backend,
+		Type:  merged.BackendType,
+		Shell: merged.Shell,
+	}
+	be, err := backend.Get(beCfg)
 	if err != nil {
-		return fmt.Errorf("failed to open state database: %w", err)
+		return nil, nil, fmt.Errorf("failed to get backend: %w", err)
+	}
+
+	// Refuse config the backend would ignore, and check prerequisites,
+	// before recording or provisioning anything
+	if h, ok := be.(backend.HealthChecker); ok {
+		if err := h.HealthCheck(ctx); err != nil {
+			return nil, nil, clierr.Backend(fmt.Errorf("%s backend is unavailable:\n%w", merged.BackendType, err))
+		}
+	}
+	caps := backend.CapabilitiesOf(be)
+	createCfg.Files = backend.NormalizeMounts(caps, createCfg.Files)
+	if err := backend.Validate(merged.BackendType, caps, &createCfg); err != nil {
+		return nil, nil, err
+	}
+	if p, ok := be.(backend.Preflighter); ok {
+		if err := p.Preflight(ctx, &createCfg); err != nil {
+			return nil, nil, clierr.Backend(fmt.Errorf("preflight checks failed:\n%w", err))
+		}
+	}
+
+	if opts.Plan {
+		plan.Config = createCfg
+		return nil, nil, printCreatePlan(os.Stdout, plan, be, opts)
 	}
-	defer db.Close()
 
-	// Create environment record with provisioning status
+	if merged.Pool > 0 && !opts.Pooled {
+		// Refill whether or not this create takes from the pool, so it is
+		// ready for the next one
+		defer func() {
+			if err := startPoolFill(repoRoot); err != nil {
+				fmt.Fprintf(os.Stderr, "warning: failed to refill the pool: %v\n", err)
+			}
+		}()
+		if poolable(opts) {
+			env, err := takePooled(ctx, db, be, repoRoot, merged.Backend, remote, baseBranch)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "warning: failed to take an environment from the pool: %v\n", err)
+			} else if env != nil {
+				if err := useTaken(ctx, db, env, opts, ttl); err != nil {
+					return nil, nil, err
+				}
+				result.ID = env.ID
+				result.ShortID = state.ShortID(env.ID)
+				result.Branch = env.BranchName
+				result.Path = env.BackendID
+				return env, be, nil
+			}
+		}
+	}
+
+	if caps.Resources && !opts.IgnoreResourceCheck {
+		if err := checkHostResources(ctx, db, createCfg.Resources); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	// Provision records the environment, creates its workspace, and runs setup
 	env := &state.Environment{
 		ID:         envID,
 		Backend:    merged.Backend,
 		RepoPath:   repoRoot,
+		Remote:     remote,
 		RemoteURL:  remoteURL,
 		BranchName: branchName,
 		BaseBranch: baseBranch,
 		CreatedAt:  time.Now(),
 		Status:     state.StatusProvisioning,
+		Task:       opts.Task,
+		Profile:    opts.Profile,
+		Pooled:     opts.Pooled,
+	}
+	if caps.Resources {
+		env.CPUs = createCfg.Resources.CPUs
+		env.Memory = uint64(createCfg.Resources.Memory)
+	}
+	if ttl > 0 {
+		env.ExpiresAt = env.CreatedAt.Add(ttl)
 	}
 
-	if err := db.CreateEnvironment(env); err != nil {
-		return fmt.Errorf("failed to create environment record: %w", err)
+	spec := ProvisionSpec{
+		Backend:   be,
+		Config:    &createCfg,
+		SkipSetup: opts.NoSetup,
+	}
+	if opts.CloneFrom != nil {
+		spec.CloneFrom = opts.CloneFrom.BackendID
 	}
 
-	// Get backend
-	be, err := backend.Get(backend.BackendConfig{
-		Name: merged.Backend,
-		Type: merged.BackendType,
-	})
-	if err != nil {
-		// Clean up environment record on failure
-		_ = db.DeleteEnvironment(envID)
-		return fmt.Errorf("failed to get backend: %w", err)
+	if opts.Detach {
+		if err := db.CreateEnvironment(env); err != nil {
+			return nil, nil, fmt.Errorf("failed to create environment record: %w", err)
+		}
+		err := startDetachedProvision(envID, provisionJob{
+			Backend:   beCfg,
+			Config:    createCfg,
+			SkipSetup: spec.SkipSetup,
+			CloneFrom: spec.CloneFrom,
+		})
+		if err != nil {
+			_ = db.DeleteEnvironment(envID)
+			_ = removeSetupLog(envID)
+			return nil, nil, err
+		}
+		recorded = true
+		return env, be, nil
 	}
 
-	// Create workspace
-	backendID, err := be.Create(ctx, &createCfg)
+	release, err := waitForProvisionSlot(ctx, db, envID)
+	if err != nil {
+		return nil, nil, err
+	}
+	res, err := Provision(ctx, db, env, spec)
+	release()
+	result.Path = env.BackendID
+	result.SetupMs = res.SetupDuration.Milliseconds()
+	if res.Setup != nil {
+		for _, c := range res.Setup.Commands {
+			result.SetupCommands = append(result.SetupCommands, setupCommandResult{
+				Command:    c.Command,
+				ExitCode:   c.ExitCode,
+				DurationMs: c.Duration.Milliseconds(),
+			})
+		}
+	}
+	if _, gerr := db.GetEnvironment(envID); gerr == nil {
+		// Once recorded, the name is released by env rm
+		recorded = true
+	}
 	if err != nil {
-		// Mark environment as failed
-		env.Status = state.StatusFailed
-		_ = db.UpdateEnvironment(env)
-		return fmt.Errorf("failed to create worktree: %w", err)
+		return nil, nil, err
 	}
+	return env, be, nil
+}
 
-	// Update environment with backendID
-	env.BackendID = backendID
-	if err := db.UpdateEnvironment(env); err != nil {
-		// Try to clean up the worktree
-		_ = be.Destroy(ctx, backendID)
-		_ = db.DeleteEnvironment(envID)
-		return fmt.Errorf("failed to update environment record: %w", err)
+// withCacheEnv returns env plus the variables that point package managers at
+// the shared caches in entries. Variables set explicitly in env take
+// precedence over cache variables.
+func withCacheEnv(entries []config.CacheEntry, env map[string]string) (map[string]string, error) {
+	if len(entries) == 0 {
+		return env, nil
 	}
 
-	// Run setup unless --no-setup is specified
-	// Setup handles environment variables, file mounts, and setup commands
-	hasSetupWork := len(createCfg.SetupCommands) > 0 ||
-		len(createCfg.Files) > 0 ||
-		len(createCfg.Environment) > 0
-	if !noSetupFlag && hasSetupWork {
-		runner := be.NewSetupRunner(backendID)
-		setupCfg := &backend.SetupConfig{
-			Environment:   createCfg.Environment,
-			Files:         createCfg.Files,
-			SetupCommands: createCfg.SetupCommands,
-		}
-		if err := runner.Run(ctx, setupCfg); err != nil {
-			env.Status = state.StatusFailed
-			_ = db.UpdateEnvironment(env)
-			return fmt.Errorf("setup failed: %w", err)
+	base, err := cache.Dir()
+	if err != nil {
+		return nil, err
+	}
+	merged, err := cache.Env(base, entries)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range env {
+		merged[k] = v
+	}
+	return merged, nil
+}
+
+// printCreatePlan writes what creating an environment from plan with be
+// would do, for env create --plan. Secret environment values are redacted.
+func printCreatePlan(w io.Writer, plan config.CreatePlan, be backend.Backend, opts CreateOptions) error {
+	cfg := &plan.Config
+	workspace := "(chosen by the " + cfg.BackendType + " backend)"
+	if p, ok := be.(backend.WorkspacePlanner); ok {
+		path, err := p.WorkspacePath(cfg)
+		if err != nil {
+			return err
 		}
+		workspace = path
+	}
+	branch := fmt.Sprintf("%s (new, from %s)", cfg.BranchName, cfg.Repository.BaseBranch)
+	if cfg.ExistingBranch {
+		branch = cfg.BranchName + " (existing)"
 	}
+	env, err := withCacheEnv(cfg.Cache, cfg.Environment)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintln(w, "Plan (nothing has been created):")
+	fmt.Fprintf(w, "  ID:          %s (provisional)\n", state.ShortID(cfg.ID))
+	fmt.Fprintf(w, "  Repository:  %s\n", cfg.Repository.Path)
+	fmt.Fprintf(w, "  Backend:     %s (%s)\n", cfg.Backend, cfg.BackendType)
+	fmt.Fprintf(w, "  Workspace:   %s\n", workspace)
+	fmt.Fprintf(w, "  Branch:      %s\n", branch)
 
-	// Update environment status to ready
-	env.Status = state.StatusReady
-	if err := db.UpdateEnvironment(env); err != nil {
-		return fmt.Errorf("failed to update environment status: %w", err)
+	fmt.Fprintln(w, "\nFiles:")
+	if len(cfg.Files) == 0 {
+		fmt.Fprintln(w, "  none")
+	}
+	for _, f := range cfg.Files {
+		mode := "copy"
+		if f.ReadOnly {
+			mode = "symlink, read-only"
+		}
+		fmt.Fprintf(w, "  %s -> %s (%s)\n", f.Source, f.Target, mode)
 	}
 
-	if attachFlag {
-		if err := be.Shell(ctx, backendID); err != nil {
-			return fmt.Errorf("shell exited with error: %w", err)
+	fmt.Fprintln(w, "\nEnvironment:")
+	if len(env) == 0 {
+		fmt.Fprintln(w, "  none")
+	}
+	for _, name := range slices.Sorted(maps.Keys(env)) {
+		value := env[name]
+		if plan.IsSecret(name) {
+			value = bugreport.Redacted
 		}
-	} else {
-		// Print just the short ID for scripting
-		fmt.Println(shortID)
+		fmt.Fprintf(w, "  %s=%s\n", name, value)
 	}
 
+	fmt.Fprintln(w, "\nSetup commands:")
+	if cfg.SetupWrapper != "" && len(cfg.SetupCommands) > 0 && !opts.NoSetup {
+		fmt.Fprintf(w, "  (run through: %s)\n", cfg.SetupWrapper)
+	}
+	switch {
+	case len(cfg.SetupCommands) == 0:
+		fmt.Fprintln(w, "  none")
+	case opts.NoSetup:
+		fmt.Fprintf(w, "  skipped (--no-setup): %d configured\n", len(cfg.SetupCommands))
+	default:
+		for i, c := range cfg.SetupCommands {
+			fmt.Fprintf(w, "  %d. %s\n", i+1, c)
+		}
+	}
 	return nil
 }
@@ -0,0 +1,127 @@
+package env
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Quidge/choir/internal/config"
+)
+
+func TestWriteResultFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "result.json")
+	started := time.Now().Add(-1500 * time.Millisecond)
+
+	read := func() createResult {
+		t.Helper()
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("failed to read result file: %v", err)
+		}
+		var res createResult
+		if err := json.Unmarshal(data, &res); err != nil {
+			t.Fatalf("invalid result JSON: %v\n%s", err, data)
+		}
+		return res
+	}
+
+	res := &createResult{ID: "abc123", Branch: "env/abc123", StartedAt: started}
+	if err := writeResultFile(path, res, nil); err != nil {
+		t.Fatalf("writeResultFile() failed: %v", err)
+	}
+	got := read()
+	if got.Status != "ready" || got.Error != "" || got.ID != "abc123" || got.Branch != "env/abc123" {
+		t.Errorf("unexpected success result: %+v", got)
+	}
+	if got.DurationMs < 1500 {
+		t.Errorf("DurationMs = %d, want >= 1500", got.DurationMs)
+	}
+
+	res = &createResult{StartedAt: started}
+	if err := writeResultFile(path, res, errors.New("setup failed: exit 1")); err != nil {
+		t.Fatalf("writeResultFile() failed: %v", err)
+	}
+	got = read()
+	if got.Status != "failed" || got.Error != "setup failed: exit 1" {
+		t.Errorf("unexpected failure result: %+v", got)
+	}
+
+	if _, err := os.Stat(path + ".tmp"); !os.IsNotExist(err) {
+		t.Error("temporary file left behind")
+	}
+}
+
+func TestReadTask(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "task.md")
+	if err := os.WriteFile(file, []byte("# Fix login\n\nIt flakes.\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name         string
+		prompt, file string
+		stdin        string
+		want         string
+		wantErr      bool
+	}{
+		{name: "none"},
+		{name: "prompt", prompt: "  Fix login  ", want: "Fix login"},
+		{name: "stdin", prompt: "-", stdin: "Fix login\n", want: "Fix login"},
+		{name: "file", file: file, want: "# Fix login\n\nIt flakes."},
+		{name: "both", prompt: "x", file: file, wantErr: true},
+		{name: "empty stdin", prompt: "-", wantErr: true},
+		{name: "missing file", file: file + ".missing", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := readTask(tt.prompt, tt.file, strings.NewReader(tt.stdin))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("readTask() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("readTask() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPrintCreatePlan(t *testing.T) {
+	plan, err := config.PlanCreate(config.MergedConfig{
+		Backend:     "local",
+		BackendType: "worktree",
+		Env:         map[string]string{"NODE_ENV": "development", "API_TOKEN": "hunter2"},
+		Files: []config.FileMount{
+			{Source: "/home/u/.npmrc", Target: ".npmrc", ReadOnly: true},
+			{Source: "/home/u/.env", Target: ".env"},
+		},
+		Setup: []string{"npm ci", "npm run build"},
+	}, config.RepositoryInfo{Path: "/repo", BaseBranch: "main"}, "abc123def456")
+	if err != nil {
+		t.Fatalf("PlanCreate() failed: %v", err)
+	}
+	plan.Config.BranchName = "env/abc123def456"
+
+	var out strings.Builder
+	if err := printCreatePlan(&out, plan, nil, CreateOptions{}); err != nil {
+		t.Fatalf("printCreatePlan() failed: %v", err)
+	}
+	for _, want := range []string{
+		"env/abc123def456 (new, from main)",
+		"/home/u/.npmrc -> .npmrc (symlink, read-only)",
+		"/home/u/.env -> .env (copy)",
+		"API_TOKEN=[REDACTED]",
+		"NODE_ENV=development",
+		"1. npm ci\n  2. npm run build",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("plan missing %q:\n%s", want, out.String())
+		}
+	}
+	if strings.Contains(out.String(), "hunter2") {
+		t.Errorf("plan shows a secret:\n%s", out.String())
+	}
+}
@@ -0,0 +1,95 @@
+package env
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/Quidge/choir/internal/backend/worktree"
+	"github.com/Quidge/choir/internal/state"
+	"github.com/spf13/cobra"
+)
+
+var currentCmd = &cobra.Command{
+	Use:   "current",
+	Short: "Show the environment containing the current directory",
+	Long: `Show the environment whose workspace contains the current directory.
+
+With --porcelain, print one line for scripts and shell prompts without
+opening the state database: the short ID, branch, and full ID, separated by
+tabs. This format is stable; future versions will only append fields.
+
+With --json, print the environment's record as "choir state export" and
+the API do, for scripts that want its status, base branch, or task too.
+
+Exits with status 1 outside an environment.`,
+	Args: cobra.NoArgs,
+	RunE: runCurrent,
+
+	// Failing outside an environment is routine for prompts; don't add usage
+	SilenceUsage: true,
+}
+
+var (
+	currentPorcelainFlag bool
+	currentJSONFlag      bool
+)
+
+func init() {
+	currentCmd.Flags().BoolVar(&currentPorcelainFlag, "porcelain", false, "print a stable, tab-separated line using only the marker file")
+	currentCmd.Flags().BoolVar(&currentJSONFlag, "json", false, "print the environment's record as JSON")
+	currentCmd.MarkFlagsMutuallyExclusive("porcelain", "json")
+}
+
+func runCurrent(cmd *cobra.Command, args []string) error {
+	marker, err := worktree.FindMarker(".")
+	if err != nil {
+		return err
+	}
+
+	if currentPorcelainFlag {
+		fmt.Printf("%s\t%s\t%s\n", state.ShortID(marker.ID), marker.Branch, marker.ID)
+		return nil
+	}
+
+	db, err := state.OpenReadOnly("")
+	if err != nil {
+		return fmt.Errorf("failed to open state database: %w", err)
+	}
+	defer db.Close()
+
+	env, err := db.GetEnvironment(marker.ID)
+	if errors.Is(err, state.ErrEnvironmentNotFound) {
+		fmt.Fprintf(os.Stderr, "warning: %s has no record in the state database\n", state.ShortID(marker.ID))
+		if currentJSONFlag {
+			return printJSON(state.SnapshotEnvironment{ID: marker.ID, BackendID: marker.Dir, BranchName: marker.Branch})
+		}
+		fmt.Printf("ID:          %s\n", marker.ID)
+		fmt.Printf("Path:        %s\n", marker.Dir)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get environment: %w", err)
+	}
+
+	if currentJSONFlag {
+		return printJSON(state.SnapshotOf(env))
+	}
+	fmt.Printf("ID:          %s\n", env.ID)
+	fmt.Printf("Status:      %s\n", env.Status)
+	fmt.Printf("Branch:      %s\n", env.BranchName)
+	fmt.Printf("Path:        %s\n", marker.Dir)
+	fmt.Printf("Repository:  %s\n", env.RepoPath)
+	return nil
+}
+
+// printJSON prints v as indented JSON.
+func printJSON(v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode JSON: %w", err)
+	}
+	fmt.Println(string(data))
+	return nil
+}
@@ -0,0 +1,146 @@
+package env
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"syscall"
+
+	"github.com/Quidge/choir/internal/backend"
+	"github.com/Quidge/choir/internal/config"
+	"github.com/Quidge/choir/internal/msg"
+	"github.com/Quidge/choir/internal/state"
+	"github.com/spf13/cobra"
+)
+
+// provisionJob is what env create --detach hands the background process
+// that provisions the environment it recorded. It is written to the
+// process's stdin rather than a file, since the config may hold secrets.
+type provisionJob struct {
+	Backend   backend.BackendConfig `json:"backend"`
+	Config    config.CreateConfig   `json:"config"`
+	SkipSetup bool                  `json:"skip_setup,omitempty"`
+	CloneFrom string                `json:"clone_from,omitempty"`
+}
+
+// provisionCmd is the background half of env create --detach. It isn't
+// meant to be run by hand.
+var provisionCmd = &cobra.Command{
+	Use:    "provision ID",
+	Short:  "Provision an environment recorded by env create --detach",
+	Hidden: true,
+	Args:   cobra.ExactArgs(1),
+	RunE:   runProvision,
+
+	// Its output goes to the setup log, where usage would only be noise
+	SilenceUsage: true,
+}
+
+// startDetachedProvision starts a background choir process, in its own
+// session so it outlives the terminal, to provision environment id from
+// job. Its output is appended to the environment's setup log, where env
+// attach --wait and env diag find it.
+func startDetachedProvision(id string, job provisionJob) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to find the choir executable: %w", err)
+	}
+	logPath, err := setupLogPath(id)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(logPath), 0700); err != nil {
+		return fmt.Errorf("failed to create log directory: %w", err)
+	}
+	log, err := os.OpenFile(logPath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open setup log: %w", err)
+	}
+	defer log.Close()
+
+	cmd := exec.Command(exe, "env", provisionCmd.Name(), id)
+	// Setup output goes to the log already; keep it from being logged twice
+	cmd.Env = append(os.Environ(), msg.EnvQuiet+"=1")
+	cmd.Stdout = log
+	cmd.Stderr = log
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start %s: %w", exe, err)
+	}
+
+	err = json.NewEncoder(stdin).Encode(job)
+	if cerr := stdin.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+		return fmt.Errorf("failed to hand the environment to the background process: %w", err)
+	}
+	return cmd.Process.Release()
+}
+
+func runProvision(cmd *cobra.Command, args []string) error {
+	ctx := context.Background()
+
+	var job provisionJob
+	if err := json.NewDecoder(os.Stdin).Decode(&job); err != nil {
+		return fmt.Errorf("failed to read provision job: %w", err)
+	}
+
+	db, err := state.Open("")
+	if err != nil {
+		return fmt.Errorf("failed to open state database: %w", err)
+	}
+	defer db.Close()
+
+	env, err := db.GetEnvironment(args[0])
+	if err != nil {
+		return fmt.Errorf("failed to get environment: %w", err)
+	}
+	if env.Status != state.StatusProvisioning {
+		return fmt.Errorf("environment %s is %s, not provisioning", state.ShortID(env.ID), env.Status)
+	}
+
+	// Provision marks the environment failed if it fails; do the same
+	// for anything that stops it getting that far
+	failed := func(err error) error {
+		env.Status = state.StatusFailed
+		if uerr := db.UpdateEnvironment(env); uerr != nil {
+			err = errors.Join(err, uerr)
+		}
+		return err
+	}
+	be, err := backend.Get(job.Backend)
+	if err != nil {
+		return failed(fmt.Errorf("failed to get backend: %w", err))
+	}
+	release, err := waitForProvisionSlot(ctx, db, env.ID)
+	if err != nil {
+		return failed(err)
+	}
+	defer release()
+
+	// It may have been removed while it waited
+	if env, err = db.GetEnvironment(env.ID); err != nil {
+		return fmt.Errorf("failed to get environment: %w", err)
+	}
+	if env.Status != state.StatusProvisioning {
+		return fmt.Errorf("environment %s became %s while waiting to be provisioned", state.ShortID(env.ID), env.Status)
+	}
+	_, err = Provision(ctx, db, env, ProvisionSpec{
+		Backend:   be,
+		Config:    &job.Config,
+		SkipSetup: job.SkipSetup,
+		CloneFrom: job.CloneFrom,
+	})
+	return err
+}
@@ -0,0 +1,40 @@
+package env
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/Quidge/choir/internal/backend"
+	"github.com/Quidge/choir/internal/config"
+)
+
+func TestProvisionJobRoundTrip(t *testing.T) {
+	job := provisionJob{
+		Backend: backend.BackendConfig{Name: "local", Type: "worktree", Shell: "/bin/sh"},
+		Config: config.CreateConfig{
+			ID:            "abc123def456abc123def456abc12345",
+			Resources:     config.ResourceLimits{CPUs: 2, Memory: 4 * config.GiB},
+			Repository:    config.RepositoryInfo{Path: "/repo", BaseBranch: "main"},
+			Environment:   map[string]string{"TOKEN": "s3cret"},
+			Files:         []config.FileMount{{Source: "/src", Target: "dst", ReadOnly: true}},
+			SetupCommands: []string{"make deps"},
+			Ports:         []config.PortMapping{{Host: 8080, Guest: 80}},
+			BranchName:    "env/abc123def456",
+		},
+		SkipSetup: true,
+		CloneFrom: "/worktrees/src",
+	}
+
+	data, err := json.Marshal(job)
+	if err != nil {
+		t.Fatalf("Marshal() failed: %v", err)
+	}
+	var got provisionJob
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("Unmarshal() failed: %v", err)
+	}
+	if !reflect.DeepEqual(got, job) {
+		t.Errorf("round trip = %+v, want %+v", got, job)
+	}
+}
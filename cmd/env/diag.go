@@ -0,0 +1,129 @@
+package env
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Quidge/choir/internal/diag"
+	"github.com/Quidge/choir/internal/preflight"
+	"github.com/Quidge/choir/internal/resolve"
+	"github.com/Quidge/choir/internal/state"
+	"github.com/spf13/cobra"
+)
+
+var diagCmd = &cobra.Command{
+	Use:   "diag ID",
+	Short: "Show diagnostics captured when an environment failed",
+	Long: `Show the diagnostic bundle captured when an environment last failed:
+free disk, memory, and load on the host, git status in the workspace, and
+the last lines of the setup log.
+
+The ID can be a prefix if it uniquely identifies an environment. Use --json
+to get the bundle for attaching to a bug report.`,
+	Args: cobra.ExactArgs(1),
+	RunE: runDiag,
+}
+
+var diagJSONFlag bool
+
+func init() {
+	diagCmd.Flags().BoolVar(&diagJSONFlag, "json", false, "print the bundle as JSON")
+}
+
+func runDiag(cmd *cobra.Command, args []string) error {
+	db, err := state.OpenReadOnly("")
+	if err != nil {
+		return fmt.Errorf("failed to open state database: %w", err)
+	}
+	defer db.Close()
+
+	env, err := resolve.Environment(db, args[0])
+	if err != nil {
+		return err
+	}
+	d, err := db.GetDiagnostics(env.ID)
+	if errors.Is(err, state.ErrNoDiagnostics) {
+		return fmt.Errorf("no diagnostics for environment %s; they are captured when an environment fails", state.ShortID(env.ID))
+	}
+	if err != nil {
+		return err
+	}
+
+	if diagJSONFlag {
+		fmt.Println(d.Bundle)
+		return nil
+	}
+	var b diag.Bundle
+	if err := json.Unmarshal([]byte(d.Bundle), &b); err != nil {
+		return fmt.Errorf("invalid diagnostics: %w", err)
+	}
+	printBundle(env, &b)
+	return nil
+}
+
+// printBundle prints b, captured for env, for reading.
+func printBundle(env *state.Environment, b *diag.Bundle) {
+	fmt.Printf("ID:          %s\n", state.ShortID(env.ID))
+	fmt.Printf("Captured:    %s\n", b.CapturedAt.Local().Format("2006-01-02 15:04:05"))
+	fmt.Printf("Reason:      %s\n", b.Reason)
+	if b.DiskPath != "" && b.DiskFree > 0 {
+		fmt.Printf("Disk free:   %s (%s)\n", preflight.FormatBytes(b.DiskFree), b.DiskPath)
+	}
+	switch {
+	case b.MemAvailable > 0:
+		fmt.Printf("Memory:      %s available of %s\n", preflight.FormatBytes(b.MemAvailable), preflight.FormatBytes(b.MemTotal))
+	case b.MemTotal > 0:
+		fmt.Printf("Memory:      %s\n", preflight.FormatBytes(b.MemTotal))
+	}
+	if b.Load != "" {
+		fmt.Printf("Load:        %s\n", b.Load)
+	}
+	if b.GitStatus != "" {
+		fmt.Printf("\nGit status:\n%s", indent(b.GitStatus))
+	}
+	if b.SetupLog != "" {
+		fmt.Printf("\nSetup log (last %d lines):\n%s", diag.SetupLogLines, indent(b.SetupLog))
+	}
+	if len(b.Errors) > 0 {
+		fmt.Printf("\nNot collected:\n%s", indent(strings.Join(b.Errors, "\n")+"\n"))
+	}
+}
+
+// indent indents each line of s by two spaces.
+func indent(s string) string {
+	lines := strings.SplitAfter(s, "\n")
+	for i, line := range lines {
+		if line != "" {
+			lines[i] = "  " + line
+		}
+	}
+	return strings.Join(lines, "")
+}
+
+// captureDiagnostics stores a diagnostic bundle for env, which just failed
+// for reason. Failing to capture one is only warned about, so it never hides
+// the failure itself.
+func captureDiagnostics(ctx context.Context, db *state.DB, env *state.Environment, reason string) {
+	opts := diag.Options{Reason: reason}
+	if filepath.IsAbs(env.BackendID) {
+		opts.Workspace = env.BackendID
+	}
+	if logPath, err := setupLogPath(env.ID); err == nil {
+		opts.SetupLogPath = logPath
+		opts.DataDir = filepath.Dir(filepath.Dir(logPath))
+	}
+
+	b := diag.Capture(ctx, opts)
+	data, err := json.Marshal(b)
+	if err == nil {
+		err = db.SaveDiagnostics(&state.Diagnostics{EnvironmentID: env.ID, CapturedAt: b.CapturedAt, Bundle: string(data)})
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "warning: failed to capture diagnostics: %v\n", err)
+	}
+}
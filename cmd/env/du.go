@@ -0,0 +1,120 @@
+package env
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/Quidge/choir/internal/preflight"
+	"github.com/Quidge/choir/internal/resolve"
+	"github.com/Quidge/choir/internal/state"
+	"github.com/Quidge/choir/internal/table"
+	"github.com/spf13/cobra"
+)
+
+var duCmd = &cobra.Command{
+	Use:   "du [ID...]",
+	Short: "Show environment disk usage",
+	Long: `Show how much disk space each environment's workspace uses, largest
+first, to find environments worth removing.
+
+With no IDs, all environments shown by "choir env list" are measured (use
+--all to include failed ones). Sizes exclude data shared between
+environments, such as a worktree's git objects.`,
+	RunE: runDu,
+}
+
+var duAllFlag bool
+
+func init() {
+	duCmd.Flags().BoolVar(&duAllFlag, "all", false, "include removed/failed environments")
+}
+
+func runDu(cmd *cobra.Command, args []string) error {
+	db, err := state.OpenReadOnly("")
+	if err != nil {
+		return fmt.Errorf("failed to open state database: %w", err)
+	}
+	defer db.Close()
+
+	var envs []*state.Environment
+	if len(args) > 0 {
+		for _, idPrefix := range args {
+			env, err := resolve.Environment(db, idPrefix)
+			if err != nil {
+				return err
+			}
+			envs = append(envs, env)
+		}
+	} else {
+		opts := state.ListOptions{}
+		if !duAllFlag {
+			opts.Statuses = resolve.VisibleStatuses
+		}
+		envs, err = db.ListEnvironments(opts)
+		if err != nil {
+			return fmt.Errorf("failed to list environments: %w", err)
+		}
+	}
+	if len(envs) == 0 {
+		fmt.Println("No environments found.")
+		return nil
+	}
+
+	sizes := measureEnvironments(cmd.Context(), envs)
+	sort.SliceStable(envs, func(i, j int) bool {
+		return sizes[envs[i].ID] > sizes[envs[j].ID]
+	})
+
+	t := table.New(
+		table.Column{Header: "SIZE"},
+		table.Column{Header: "ID"},
+		table.Column{Header: "STATUS"},
+		table.Column{Header: "BRANCH", Min: 16},
+	)
+	var total uint64
+	for _, env := range envs {
+		total += sizes[env.ID]
+		t.Row(formatSize(sizes, env), state.ShortID(env.ID), string(env.Status), env.BranchName)
+	}
+	if err := t.Render(os.Stdout, table.TerminalWidth(os.Stdout)); err != nil {
+		return err
+	}
+	if len(envs) > 1 {
+		fmt.Printf("\nTotal: %s\n", preflight.FormatBytes(total))
+	}
+	return nil
+}
+
+// measureEnvironments returns the disk usage of each environment's workspace
+// by ID. Environments without a workspace, or whose size can't be
+// determined, are omitted.
+func measureEnvironments(ctx context.Context, envs []*state.Environment) map[string]uint64 {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	sizes := make(map[string]uint64, len(envs))
+	for _, env := range envs {
+		if env.BackendID == "" {
+			continue
+		}
+		be, err := getBackend(env.Backend, "")
+		if err != nil {
+			continue
+		}
+		if size, err := be.DiskUsage(ctx, env.BackendID); err == nil {
+			sizes[env.ID] = size
+		}
+	}
+	return sizes
+}
+
+// formatSize formats env's size from sizes, or "-" if it is unknown.
+func formatSize(sizes map[string]uint64, env *state.Environment) string {
+	size, ok := sizes[env.ID]
+	if !ok {
+		return "-"
+	}
+	return preflight.FormatBytes(size)
+}
@@ -17,8 +17,29 @@ Environments can be created, attached to, listed, and removed.`,
 
 func init() {
 	Cmd.AddCommand(createCmd)
+	Cmd.AddCommand(cloneCmd)
 	Cmd.AddCommand(attachCmd)
+	Cmd.AddCommand(waitCmd)
+	Cmd.AddCommand(provisionCmd)
 	Cmd.AddCommand(listCmd)
 	Cmd.AddCommand(rmCmd)
+	Cmd.AddCommand(restoreCmd)
 	Cmd.AddCommand(statusCmd)
+	Cmd.AddCommand(execCmd)
+	Cmd.AddCommand(historyCmd)
+	Cmd.AddCommand(prCmd)
+	Cmd.AddCommand(reviewCmd)
+	Cmd.AddCommand(currentCmd)
+	Cmd.AddCommand(stopCmd)
+	Cmd.AddCommand(startCmd)
+	Cmd.AddCommand(duCmd)
+	Cmd.AddCommand(templateCmd)
+	Cmd.AddCommand(imageCmd)
+	Cmd.AddCommand(poolCmd)
+	Cmd.AddCommand(findCommitCmd)
+	Cmd.AddCommand(ignoreCmd)
+	Cmd.AddCommand(diagCmd)
+	Cmd.AddCommand(runAgentCmd)
+	Cmd.AddCommand(portCmd)
+	Cmd.AddCommand(promptCmd)
 }
@@ -0,0 +1,197 @@
+package env
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Quidge/choir/internal/clierr"
+	"github.com/Quidge/choir/internal/fault"
+	"github.com/Quidge/choir/internal/metrics"
+	"github.com/Quidge/choir/internal/state"
+	"github.com/spf13/cobra"
+)
+
+var execCmd = &cobra.Command{
+	Use:   "exec {[ID] | --all} -- COMMAND [ARGS]...",
+	Short: "Run a command in an environment",
+	Long: `Run a command inside an environment and print its output.
+
+The ID can be a prefix if it uniquely identifies an environment.
+Without an ID ("choir env exec -- make test"), choir lists the environments
+to choose from when run at a terminal.
+The command runs in the environment's workspace with its environment
+variables loaded. Arguments are passed as they are, spaces and all; for
+pipes and &&, run "sh -c '...'". Each invocation is recorded and can be
+reviewed with 'choir env history'.
+
+With --all, the command runs in every ready environment (of the current
+repository, with --repo) in turn. --artifacts writes each environment's
+result as JSON and JUnit XML to a directory, along with a summary.json
+and a combined junit.xml, for CI systems to ingest.`,
+	Args: func(cmd *cobra.Command, args []string) error {
+		if execAllFlag {
+			return cobra.MinimumNArgs(1)(cmd, args)
+		}
+		if cmd.ArgsLenAtDash() == 0 {
+			// No ID before --
+			if !canPick() {
+				return errors.New("requires an environment ID")
+			}
+			return cobra.MinimumNArgs(1)(cmd, args)
+		}
+		return cobra.MinimumNArgs(2)(cmd, args)
+	},
+	RunE: runExec,
+}
+
+var (
+	execShellFlag     string
+	execAllFlag       bool
+	execRepoFlag      bool
+	execArtifactsFlag string
+)
+
+func init() {
+	execCmd.Flags().StringVar(&execShellFlag, "shell", "", "interpreter to run the command with (absolute path)")
+	execCmd.Flags().BoolVar(&execAllFlag, "all", false, "run in every ready environment")
+	execCmd.Flags().BoolVar(&execRepoFlag, "repo", false, "with --all, only environments of the current repository")
+	execCmd.Flags().StringVar(&execArtifactsFlag, "artifacts", "", "with --all, write JSON and JUnit XML results to this directory")
+
+	// Stop flag parsing at the first positional argument so the command's
+	// own flags (e.g. "ls -la") are passed through untouched.
+	execCmd.Flags().SetInterspersed(false)
+}
+
+func runExec(cmd *cobra.Command, args []string) error {
+	ctx := context.Background()
+	if execAllFlag {
+		return runExecAll(ctx, commandLine(args))
+	}
+	if execRepoFlag || execArtifactsFlag != "" {
+		return fmt.Errorf("--repo and --artifacts require --all")
+	}
+	var idArgs []string
+	if cmd.ArgsLenAtDash() != 0 {
+		idArgs, args = args[:1], args[1:]
+	}
+	// Flag parsing stops at the ID, so a -- after it is still in args
+	if len(args) > 0 && args[0] == "--" {
+		args = args[1:]
+	}
+	if len(args) == 0 {
+		return errors.New("requires a command to run")
+	}
+	command := commandLine(args)
+
+	// Open state database
+	db, err := state.Open("")
+	if err != nil {
+		return fmt.Errorf("failed to open state database: %w", err)
+	}
+	defer db.Close()
+
+	// Resolve environment by ID prefix, or pick one
+	env, err := resolveEnvironmentArg(db, idArgs)
+	if err != nil {
+		return err
+	}
+
+	res, execErr := ExecCommand(ctx, db, env, command, execShellFlag)
+	fmt.Print(res.Output)
+
+	if execErr != nil {
+		return execErr
+	}
+	if res.ExitCode != 0 {
+		return fmt.Errorf("command exited with code %d", res.ExitCode)
+	}
+
+	return nil
+}
+
+// commandLine joins args into a command line for the environment's shell,
+// quoting each argument that the shell would otherwise split or expand, so
+// "sh -c 'echo a b'" runs as typed. Plain words are left unquoted to keep
+// the command readable in history.
+func commandLine(args []string) string {
+	words := make([]string, len(args))
+	for i, arg := range args {
+		words[i] = arg
+		if arg == "" || strings.IndexFunc(arg, needsQuote) >= 0 {
+			words[i] = shellQuote(arg)
+		}
+	}
+	return strings.Join(words, " ")
+}
+
+// needsQuote reports whether r is special to the shell in an unquoted word.
+func needsQuote(r rune) bool {
+	switch {
+	case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		return false
+	}
+	return !strings.ContainsRune("-_./:=,+@%", r)
+}
+
+// ExecResult is the outcome of ExecCommand.
+type ExecResult struct {
+	Output   string
+	ExitCode int
+	Duration time.Duration
+}
+
+// ExecCommand runs command in env's workspace, as env exec does, and records
+// it in the command history and metrics. If shell is non-empty it overrides
+// the configured interpreter. A nonzero exit code is not an error.
+func ExecCommand(ctx context.Context, db *state.DB, env *state.Environment, command, shell string) (ExecResult, error) {
+	if env.Status == state.StatusStopped {
+		return ExecResult{}, fmt.Errorf("environment %s is stopped; start it with \"choir env start %s\"", state.ShortID(env.ID), state.ShortID(env.ID))
+	}
+	if env.Status != state.StatusReady {
+		return ExecResult{}, fmt.Errorf("environment %s is %s, not ready", state.ShortID(env.ID), env.Status)
+	}
+
+	be, err := getBackend(env.Backend, shell)
+	if err != nil {
+		return ExecResult{}, err
+	}
+
+	if err := fault.SlowExec(ctx); err != nil {
+		return ExecResult{}, err
+	}
+
+	started := time.Now()
+	output, exitCode, execErr := be.Exec(ctx, env.BackendID, command)
+	res := ExecResult{Output: output, ExitCode: exitCode, Duration: time.Since(started)}
+
+	// Record the command even if it failed to start, so history reflects
+	// everything that was attempted.
+	rec := &state.CommandRecord{
+		EnvironmentID: env.ID,
+		Source:        state.SourceExec,
+		Command:       command,
+		ExitCode:      exitCode,
+		StartedAt:     started,
+		Duration:      res.Duration,
+		Output:        output,
+	}
+	if err := db.RecordCommand(rec); err != nil {
+		fmt.Fprintf(os.Stderr, "warning: failed to record command history: %v\n", err)
+	}
+
+	result := "success"
+	if execErr != nil || exitCode != 0 {
+		result = "failure"
+	}
+	_ = metrics.IncCounter(db, metrics.ExecTotal, "result", result)
+	_ = metrics.ObserveDuration(db, metrics.ExecDuration, res.Duration)
+
+	if execErr != nil {
+		return res, clierr.Backend(fmt.Errorf("failed to run command: %w", execErr))
+	}
+	return res, nil
+}
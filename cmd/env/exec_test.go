@@ -0,0 +1,33 @@
+package env
+
+import (
+	"os/exec"
+	"testing"
+)
+
+func TestCommandLine(t *testing.T) {
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"make", "build"}, "make build"},
+		{[]string{"go", "test", "./..."}, "go test ./..."},
+		{[]string{"sh", "-c", "echo a b"}, "sh -c 'echo a b'"},
+		{[]string{"echo", "it's", ""}, `echo 'it'\''s' ''`},
+		{[]string{"echo", "$HOME", "*"}, `echo '$HOME' '*'`},
+	}
+	for _, tt := range tests {
+		if got := commandLine(tt.args); got != tt.want {
+			t.Errorf("commandLine(%q) = %q, want %q", tt.args, got, tt.want)
+		}
+	}
+
+	// Arguments with spaces reach the command intact
+	out, err := exec.Command("/bin/sh", "-c", commandLine([]string{"printf", "[%s]", "hello   world", "sh -c 'x'"})).Output()
+	if err != nil {
+		t.Fatalf("running command line failed: %v", err)
+	}
+	if want := "[hello   world][sh -c 'x']"; string(out) != want {
+		t.Errorf("output = %q, want %q", out, want)
+	}
+}
@@ -0,0 +1,267 @@
+package env
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/Quidge/choir/internal/state"
+)
+
+// execOutcome is the result of running a command in one environment with
+// env exec --all. It is written as <short-id>.json to --artifacts.
+type execOutcome struct {
+	Environment string    `json:"environment"`
+	Branch      string    `json:"branch"`
+	Command     string    `json:"command"`
+	Status      string    `json:"status"` // "passed", "failed", or "error"
+	ExitCode    int       `json:"exit_code"`
+	Error       string    `json:"error,omitempty"`
+	StartedAt   time.Time `json:"started_at"`
+	DurationMs  int64     `json:"duration_ms"`
+	Output      string    `json:"output"`
+}
+
+// execSummary aggregates the outcomes of env exec --all. It is written as
+// summary.json to --artifacts.
+type execSummary struct {
+	Command      string         `json:"command"`
+	Total        int            `json:"total"`
+	Passed       int            `json:"passed"`
+	Failed       int            `json:"failed"`
+	Errors       int            `json:"errors"`
+	DurationMs   int64          `json:"duration_ms"`
+	Environments []*execOutcome `json:"environments"`
+}
+
+// Outcome statuses.
+const (
+	outcomePassed = "passed"
+	outcomeFailed = "failed"
+	outcomeError  = "error"
+)
+
+// runExecAll runs command in every ready environment (of the current
+// repository, with --repo) one at a time, printing each one's output under
+// a header, and writes the results to --artifacts if set.
+func runExecAll(ctx context.Context, command string) error {
+	db, err := state.Open("")
+	if err != nil {
+		return fmt.Errorf("failed to open state database: %w", err)
+	}
+	defer db.Close()
+
+	opts := state.ListOptions{Statuses: []state.EnvironmentStatus{state.StatusReady}}
+	if execRepoFlag {
+		repos, closeRepos := openRepoCache()
+		opts.RepoPath, err = repos.RepoRoot("")
+		closeRepos()
+		if err != nil {
+			return fmt.Errorf("not in a git repository: %w", err)
+		}
+	}
+	envs, err := db.ListEnvironments(opts)
+	if err != nil {
+		return fmt.Errorf("failed to list environments: %w", err)
+	}
+	if len(envs) == 0 {
+		return fmt.Errorf("no ready environments")
+	}
+
+	summary := &execSummary{Command: command}
+	started := time.Now()
+	for _, env := range envs {
+		fmt.Printf("==> %s (%s)\n", state.ShortID(env.ID), env.BranchName)
+		outcome := &execOutcome{
+			Environment: env.ID,
+			Branch:      env.BranchName,
+			Command:     command,
+			StartedAt:   time.Now(),
+		}
+		res, err := ExecCommand(ctx, db, env, command, execShellFlag)
+		fmt.Print(res.Output)
+		outcome.Output = res.Output
+		outcome.ExitCode = res.ExitCode
+		outcome.DurationMs = res.Duration.Milliseconds()
+		switch {
+		case err != nil:
+			outcome.Status = outcomeError
+			outcome.Error = err.Error()
+			summary.Errors++
+			fmt.Fprintf(os.Stderr, "error: %s: %v\n", state.ShortID(env.ID), err)
+		case res.ExitCode != 0:
+			outcome.Status = outcomeFailed
+			summary.Failed++
+		default:
+			outcome.Status = outcomePassed
+			summary.Passed++
+		}
+		summary.Environments = append(summary.Environments, outcome)
+	}
+	summary.Total = len(envs)
+	summary.DurationMs = time.Since(started).Milliseconds()
+
+	if execArtifactsFlag != "" {
+		if err := writeExecArtifacts(execArtifactsFlag, summary); err != nil {
+			return err
+		}
+	}
+
+	fmt.Printf("\n%d passed, %d failed, %d errors\n", summary.Passed, summary.Failed, summary.Errors)
+	if n := summary.Failed + summary.Errors; n > 0 {
+		return fmt.Errorf("command failed in %d of %d environments", n, summary.Total)
+	}
+	return nil
+}
+
+// writeExecArtifacts writes summary to dir: a JSON result and a JUnit XML
+// report per environment (<short-id>.json and <short-id>.xml), plus
+// summary.json and a combined junit.xml for CI systems to ingest.
+func writeExecArtifacts(dir string, summary *execSummary) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create artifacts directory: %w", err)
+	}
+
+	var suites []junitSuite
+	for _, outcome := range summary.Environments {
+		shortID := state.ShortID(outcome.Environment)
+		if err := writeJSON(filepath.Join(dir, shortID+".json"), outcome); err != nil {
+			return err
+		}
+		suite := newJUnitSuite(outcome)
+		report := junitReport{Name: "choir env exec", Suites: []junitSuite{suite}}
+		report.total(suite)
+		if err := writeXML(filepath.Join(dir, shortID+".xml"), report); err != nil {
+			return err
+		}
+		suites = append(suites, suite)
+	}
+
+	if err := writeJSON(filepath.Join(dir, "summary.json"), summary); err != nil {
+		return err
+	}
+	report := junitReport{Name: "choir env exec", Suites: suites}
+	report.total(suites...)
+	return writeXML(filepath.Join(dir, "junit.xml"), report)
+}
+
+// junitReport is a JUnit XML <testsuites> document. Each environment is a
+// test suite with a single test case: the command.
+type junitReport struct {
+	XMLName  xml.Name     `xml:"testsuites"`
+	Name     string       `xml:"name,attr"`
+	Tests    int          `xml:"tests,attr"`
+	Failures int          `xml:"failures,attr"`
+	Errors   int          `xml:"errors,attr"`
+	Time     string       `xml:"time,attr"`
+	Suites   []junitSuite `xml:"testsuite"`
+}
+
+type junitSuite struct {
+	Name       string          `xml:"name,attr"`
+	Tests      int             `xml:"tests,attr"`
+	Failures   int             `xml:"failures,attr"`
+	Errors     int             `xml:"errors,attr"`
+	Time       string          `xml:"time,attr"`
+	Timestamp  string          `xml:"timestamp,attr"`
+	Properties []junitProperty `xml:"properties>property"`
+	Cases      []junitCase     `xml:"testcase"`
+	SystemOut  string          `xml:"system-out,omitempty"`
+
+	seconds float64
+}
+
+type junitProperty struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+type junitCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitProblem `xml:"failure,omitempty"`
+	Error     *junitProblem `xml:"error,omitempty"`
+}
+
+type junitProblem struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+}
+
+// newJUnitSuite returns the test suite for one environment's outcome.
+func newJUnitSuite(outcome *execOutcome) junitSuite {
+	seconds := float64(outcome.DurationMs) / 1000
+	tc := junitCase{
+		Name:      outcome.Command,
+		ClassName: outcome.Branch,
+		Time:      formatSeconds(seconds),
+	}
+	suite := junitSuite{
+		Name:      state.ShortID(outcome.Environment),
+		Tests:     1,
+		Time:      tc.Time,
+		Timestamp: outcome.StartedAt.UTC().Format(time.RFC3339),
+		Properties: []junitProperty{
+			{Name: "environment", Value: outcome.Environment},
+			{Name: "branch", Value: outcome.Branch},
+		},
+		SystemOut: outcome.Output,
+		seconds:   seconds,
+	}
+	switch outcome.Status {
+	case outcomeFailed:
+		tc.Failure = &junitProblem{Message: fmt.Sprintf("exited with code %d", outcome.ExitCode), Type: "exit"}
+		suite.Failures = 1
+	case outcomeError:
+		tc.Error = &junitProblem{Message: outcome.Error, Type: "error"}
+		suite.Errors = 1
+	}
+	suite.Cases = []junitCase{tc}
+	return suite
+}
+
+// total sets the report's counts from suites.
+func (r *junitReport) total(suites ...junitSuite) {
+	var seconds float64
+	for _, s := range suites {
+		r.Tests += s.Tests
+		r.Failures += s.Failures
+		r.Errors += s.Errors
+		seconds += s.seconds
+	}
+	r.Time = formatSeconds(seconds)
+}
+
+func formatSeconds(s float64) string {
+	return fmt.Sprintf("%.3f", s)
+}
+
+// writeJSON writes v to path as indented JSON.
+func writeJSON(path string, v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s: %w", filepath.Base(path), err)
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return nil
+}
+
+// writeXML writes v to path as an indented XML document.
+func writeXML(path string, v any) error {
+	data, err := xml.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s: %w", filepath.Base(path), err)
+	}
+	data = append([]byte(xml.Header), data...)
+	if err := os.WriteFile(path, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return nil
+}
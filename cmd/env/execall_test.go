@@ -0,0 +1,87 @@
+package env
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteExecArtifacts(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "artifacts")
+	started := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	summary := &execSummary{
+		Command: "make test",
+		Total:   3,
+		Passed:  1,
+		Failed:  1,
+		Errors:  1,
+		Environments: []*execOutcome{
+			{Environment: "aaaa11112222333344445555aaaabbbb", Branch: "env/a", Command: "make test",
+				Status: outcomePassed, StartedAt: started, DurationMs: 1500, Output: "ok\n"},
+			{Environment: "bbbb11112222333344445555aaaabbbb", Branch: "env/b", Command: "make test",
+				Status: outcomeFailed, ExitCode: 2, StartedAt: started, DurationMs: 250, Output: "FAIL <x>\n"},
+			{Environment: "brave-otter-3f9c", Branch: "env/brave-otter-3f9c", Command: "make test",
+				Status: outcomeError, Error: "workspace missing", StartedAt: started},
+		},
+	}
+
+	if err := writeExecArtifacts(dir, summary); err != nil {
+		t.Fatalf("writeExecArtifacts() failed: %v", err)
+	}
+
+	for _, name := range []string{
+		"aaaa11112222.json", "aaaa11112222.xml",
+		"bbbb11112222.json", "bbbb11112222.xml",
+		"brave-otter-3f9c.json", "brave-otter-3f9c.xml",
+		"summary.json", "junit.xml",
+	} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Errorf("missing artifact %s: %v", name, err)
+		}
+	}
+
+	var got execSummary
+	data, _ := os.ReadFile(filepath.Join(dir, "summary.json"))
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("failed to parse summary.json: %v", err)
+	}
+	if got.Total != 3 || got.Passed != 1 || got.Failed != 1 || got.Errors != 1 || len(got.Environments) != 3 {
+		t.Errorf("summary = %+v", got)
+	}
+
+	var report junitReport
+	data, _ = os.ReadFile(filepath.Join(dir, "junit.xml"))
+	if err := xml.Unmarshal(data, &report); err != nil {
+		t.Fatalf("failed to parse junit.xml: %v", err)
+	}
+	if report.Tests != 3 || report.Failures != 1 || report.Errors != 1 || report.Time != "1.750" {
+		t.Errorf("junit.xml totals = %d tests, %d failures, %d errors, %s s",
+			report.Tests, report.Failures, report.Errors, report.Time)
+	}
+	if len(report.Suites) != 3 {
+		t.Fatalf("junit.xml has %d suites, want 3", len(report.Suites))
+	}
+	failed := report.Suites[1]
+	if failed.Cases[0].Failure == nil || failed.Cases[0].Failure.Message != "exited with code 2" {
+		t.Errorf("failed suite case = %+v, want a failure", failed.Cases[0])
+	}
+	if !strings.Contains(failed.SystemOut, "FAIL <x>") {
+		t.Errorf("failed suite system-out = %q", failed.SystemOut)
+	}
+	if errored := report.Suites[2].Cases[0]; errored.Error == nil || errored.Error.Message != "workspace missing" {
+		t.Errorf("errored suite case = %+v, want an error", errored)
+	}
+
+	var single junitReport
+	data, _ = os.ReadFile(filepath.Join(dir, "bbbb11112222.xml"))
+	if err := xml.Unmarshal(data, &single); err != nil {
+		t.Fatalf("failed to parse per-environment report: %v", err)
+	}
+	if single.Tests != 1 || single.Failures != 1 || len(single.Suites) != 1 {
+		t.Errorf("per-environment report = %d tests, %d failures, %d suites", single.Tests, single.Failures, len(single.Suites))
+	}
+}
@@ -0,0 +1,57 @@
+package env
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/Quidge/choir/internal/gitutil"
+	"github.com/Quidge/choir/internal/msg"
+)
+
+// refreshBase fetches from remote and fast-forwards base to its upstream
+// there, so the environment starts from the remote's latest commit rather
+// than whatever was last pulled. The upstream is the branch base tracks, or
+// else remote's branch of the same name; if there is neither, base is left as
+// it is. A base that can't be fast-forwarded, because it has diverged, is
+// checked out with uncommitted changes, or is being rebased, is only warned
+// about: the environment is created from it as it is. It fails only if the
+// fetch does.
+func refreshBase(repoRoot, remote, base string) error {
+	upstreamRemote, upstream, err := gitutil.Upstream(repoRoot, base)
+	if err != nil {
+		return err
+	}
+	if upstreamRemote == "" || upstreamRemote == "." {
+		// Tracks nothing, or a local branch
+		upstreamRemote, upstream = remote, "refs/remotes/"+remote+"/"+base
+	}
+	if upstreamRemote == "" {
+		fmt.Fprintf(os.Stderr, "warning: %s has no remote to fetch from\n", base)
+		return nil
+	}
+
+	msg.Fprintf(os.Stderr, "Fetching %s...\n", upstreamRemote)
+	if err := gitutil.Fetch(repoRoot, upstreamRemote); err != nil {
+		return err
+	}
+	if !gitutil.RefExists(repoRoot, upstream) {
+		return nil
+	}
+
+	name := strings.TrimPrefix(upstream, "refs/remotes/")
+	behind, err := gitutil.FastForward(repoRoot, base, upstream)
+	commits := plural(behind, "commit", "commits")
+	switch {
+	case errors.Is(err, gitutil.ErrNotFastForward):
+		fmt.Fprintf(os.Stderr, "warning: %s has diverged from %s and is %d %s behind it; creating from it as it is\n", base, name, behind, commits)
+	case err != nil && behind > 0:
+		fmt.Fprintf(os.Stderr, "warning: %s is %d %s behind %s; creating from it as it is: %v\n", base, behind, commits, name, err)
+	case err != nil:
+		fmt.Fprintf(os.Stderr, "warning: failed to check %s against %s: %v\n", base, name, err)
+	case behind > 0:
+		msg.Fprintf(os.Stderr, "Fast-forwarded %s by %d %s to %s\n", base, behind, commits, name)
+	}
+	return nil
+}
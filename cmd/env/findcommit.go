@@ -0,0 +1,58 @@
+package env
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/Quidge/choir/internal/backend"
+	"github.com/Quidge/choir/internal/gitutil"
+	"github.com/Quidge/choir/internal/state"
+	"github.com/spf13/cobra"
+)
+
+var findCommitCmd = &cobra.Command{
+	Use:   "find-commit SHA",
+	Short: "Show the environment a commit was made in",
+	Long: `Show the environment a commit was made in, read from the commit's
+` + backend.CommitTrailerKey + ` trailer.
+
+Commits get the trailer when commit_trailer is enabled in the global or
+project config. SHA can be any revision in the current repository. The
+environment is shown even if it has since been removed.`,
+	Args: cobra.ExactArgs(1),
+	RunE: runFindCommit,
+}
+
+func runFindCommit(cmd *cobra.Command, args []string) error {
+	id, err := gitutil.Trailer("", args[0], backend.CommitTrailerKey)
+	if err != nil {
+		return err
+	}
+	if id == "" {
+		return fmt.Errorf("commit %s has no %s trailer", args[0], backend.CommitTrailerKey)
+	}
+
+	db, err := state.OpenReadOnly("")
+	if err != nil {
+		return fmt.Errorf("failed to open state database: %w", err)
+	}
+	defer db.Close()
+
+	env, err := db.GetEnvironment(id)
+	if errors.Is(err, state.ErrEnvironmentNotFound) {
+		fmt.Printf("ID:          %s\n", id)
+		fmt.Printf("Status:      removed\n")
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get environment: %w", err)
+	}
+
+	fmt.Printf("ID:          %s\n", env.ID)
+	fmt.Printf("Short ID:    %s\n", state.ShortID(env.ID))
+	fmt.Printf("Status:      %s\n", env.Status)
+	fmt.Printf("Branch:      %s\n", env.BranchName)
+	fmt.Printf("Repository:  %s\n", env.RepoPath)
+	fmt.Printf("Created:     %s\n", env.CreatedAt.Format("2006-01-02 15:04:05"))
+	return nil
+}
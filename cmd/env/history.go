@@ -0,0 +1,157 @@
+package env
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/Quidge/choir/internal/clierr"
+	"github.com/Quidge/choir/internal/msg"
+	"github.com/Quidge/choir/internal/resolve"
+	"github.com/Quidge/choir/internal/state"
+	"github.com/Quidge/choir/internal/table"
+	"github.com/spf13/cobra"
+)
+
+var historyCmd = &cobra.Command{
+	Use:   "history ID",
+	Short: "Show commands run in an environment",
+	Long: `Show the commands run in an environment, oldest first.
+
+The ID can be a prefix if it uniquely identifies an environment.
+History includes setup commands run while provisioning and commands run
+with 'choir env exec'; --setup and --exec select one kind.
+Each entry shows the exit code, duration, and start time. Use --output
+to also print the captured (possibly truncated) output of each command.
+
+Use --replay N to run command #N from the history again, as
+'choir env exec' would; the rerun is recorded as a new exec entry.`,
+	Args: cobra.ExactArgs(1),
+	RunE: runHistory,
+}
+
+var (
+	historyExecFlag   bool
+	historySetupFlag  bool
+	historyOutputFlag bool
+	historyReplayFlag int64
+)
+
+func init() {
+	historyCmd.Flags().BoolVar(&historyExecFlag, "exec", false, "only show commands run via 'choir env exec'")
+	historyCmd.Flags().BoolVar(&historySetupFlag, "setup", false, "only show setup commands run while provisioning")
+	historyCmd.Flags().BoolVar(&historyOutputFlag, "output", false, "include captured command output")
+	historyCmd.Flags().Int64Var(&historyReplayFlag, "replay", 0, "run command `N` from the history again")
+}
+
+func runHistory(cmd *cobra.Command, args []string) error {
+	idPrefix := args[0]
+	if cmd.Flags().Changed("replay") {
+		if historyExecFlag || historySetupFlag || historyOutputFlag {
+			return clierr.Validation(errors.New("--replay can't be used with --exec, --setup, or --output"))
+		}
+		return runReplay(idPrefix, historyReplayFlag)
+	}
+
+	// Open state database
+	db, err := state.OpenReadOnly("")
+	if err != nil {
+		return fmt.Errorf("failed to open state database: %w", err)
+	}
+	defer db.Close()
+
+	// Resolve environment by ID prefix
+	env, err := resolve.Environment(db, idPrefix)
+	if err != nil {
+		return err
+	}
+
+	opts := state.CommandListOptions{EnvironmentID: env.ID}
+	if historyExecFlag {
+		opts.Sources = append(opts.Sources, state.SourceExec)
+	}
+	if historySetupFlag {
+		opts.Sources = append(opts.Sources, state.SourceSetup)
+	}
+
+	cmds, err := db.ListCommands(opts)
+	if err != nil {
+		return fmt.Errorf("failed to list commands: %w", err)
+	}
+
+	if len(cmds) == 0 {
+		fmt.Println("No commands recorded.")
+		return nil
+	}
+
+	if historyOutputFlag {
+		for _, c := range cmds {
+			fmt.Printf("#%d [%s] %s (exit %d, %s)\n", c.ID, c.Source, c.Command, c.ExitCode, formatDuration(c.Duration))
+			if c.Output != "" {
+				fmt.Print(c.Output)
+				if c.Output[len(c.Output)-1] != '\n' {
+					fmt.Println()
+				}
+			}
+			fmt.Println()
+		}
+		return nil
+	}
+
+	// Print table
+	t := table.New(
+		table.Column{Header: "#"},
+		table.Column{Header: "SOURCE"},
+		table.Column{Header: "EXIT"},
+		table.Column{Header: "DURATION"},
+		table.Column{Header: "STARTED"},
+		table.Column{Header: "COMMAND", Min: 20},
+	)
+	for _, c := range cmds {
+		t.Row(strconv.FormatInt(c.ID, 10), string(c.Source), strconv.Itoa(c.ExitCode),
+			formatDuration(c.Duration), c.StartedAt.Local().Format("2006-01-02 15:04:05"), c.Command)
+	}
+	return t.Render(os.Stdout, table.TerminalWidth(os.Stdout))
+}
+
+// runReplay runs command n from the history of the environment idPrefix
+// again, as env exec does.
+func runReplay(idPrefix string, n int64) error {
+	return withEnvironment(idPrefix, func(db *state.DB, env *state.Environment) error {
+		cmds, err := db.ListCommands(state.CommandListOptions{EnvironmentID: env.ID})
+		if err != nil {
+			return fmt.Errorf("failed to list commands: %w", err)
+		}
+		i := slices.IndexFunc(cmds, func(c *state.CommandRecord) bool { return c.ID == n })
+		if i < 0 {
+			return clierr.NotFound(fmt.Errorf("command #%d not found in the history of %s", n, state.ShortID(env.ID)))
+		}
+
+		msg.Fprintf(os.Stderr, "Replaying #%d: %s\n", n, cmds[i].Command)
+		res, err := ExecCommand(context.Background(), db, env, cmds[i].Command, "")
+		fmt.Print(res.Output)
+		if err != nil {
+			return err
+		}
+		if res.ExitCode != 0 {
+			return fmt.Errorf("command exited with code %d", res.ExitCode)
+		}
+		return nil
+	})
+}
+
+// formatDuration formats a duration for compact display.
+func formatDuration(d time.Duration) string {
+	switch {
+	case d < time.Second:
+		return fmt.Sprintf("%dms", d.Milliseconds())
+	case d < time.Minute:
+		return fmt.Sprintf("%.1fs", d.Seconds())
+	default:
+		return d.Round(time.Second).String()
+	}
+}
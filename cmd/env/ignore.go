@@ -0,0 +1,63 @@
+package env
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Quidge/choir/internal/backend"
+	"github.com/Quidge/choir/internal/msg"
+	"github.com/Quidge/choir/internal/resolve"
+	"github.com/Quidge/choir/internal/state"
+	"github.com/spf13/cobra"
+)
+
+var ignoreCmd = &cobra.Command{
+	Use:   "ignore ID PATTERN...",
+	Short: "Add patterns to an environment's git excludes",
+	Long: `Add gitignore patterns to an environment's git excludes
+(.git/info/exclude), so files matching them don't show up as untracked
+changes there.
+
+The ID can be a prefix if it uniquely identifies an environment.
+Patterns already listed are not added again. To add patterns to every new
+environment, list them under ignore: in .choir.yaml.
+
+A worktree shares its excludes file with the repository it was created
+from, so the patterns also apply to the repository and its other
+environments.`,
+	Args: cobra.MinimumNArgs(2),
+	RunE: runIgnore,
+}
+
+func runIgnore(cmd *cobra.Command, args []string) error {
+	ctx := context.Background()
+
+	db, err := state.OpenReadOnly("")
+	if err != nil {
+		return fmt.Errorf("failed to open state database: %w", err)
+	}
+	defer db.Close()
+
+	env, err := resolve.Environment(db, args[0])
+	if err != nil {
+		return err
+	}
+
+	be, err := getBackend(env.Backend, "")
+	if err != nil {
+		return err
+	}
+	exists, err := workspaceExists(ctx, be, env)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("environment %s has no workspace", state.ShortID(env.ID))
+	}
+
+	if _, err := be.NewSetupRunner(env.BackendID).Run(ctx, &backend.SetupConfig{Ignore: args[1:]}); err != nil {
+		return err
+	}
+	msg.Printf("Updated git excludes for %s\n", state.ShortID(env.ID))
+	return nil
+}
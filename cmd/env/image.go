@@ -0,0 +1,217 @@
+package env
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Quidge/choir/internal/backend"
+	"github.com/Quidge/choir/internal/clierr"
+	"github.com/Quidge/choir/internal/config"
+	"github.com/Quidge/choir/internal/msg"
+	"github.com/Quidge/choir/internal/state"
+	"github.com/Quidge/choir/internal/table"
+	"github.com/spf13/cobra"
+)
+
+var imageCmd = &cobra.Command{
+	Use:   "image",
+	Short: "Manage baked base images",
+	Long: `Manage the base images backends that clone workspaces from a disk image,
+such as VM backends, bake so packages and credentials are installed once
+rather than in every environment.
+
+An image is baked the first time an environment asks for its base_image and
+packages, and reused by every later environment asking for the same ones, in
+any order. The worktree backend doesn't bake images.
+
+Subcommands:
+  list  List baked images
+  rm    Remove a baked image`,
+}
+
+var imageListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List baked images",
+	Args:  cobra.NoArgs,
+	RunE:  runImageList,
+}
+
+var imageRmCmd = &cobra.Command{
+	Use:   "rm KEY",
+	Short: "Remove a baked image",
+	Long: `Remove a baked image from its backend. Environments created from it are
+unaffected; the next environment asking for its base image and packages
+bakes it again.
+
+The KEY can be a prefix if it uniquely identifies an image.`,
+	Args: cobra.ExactArgs(1),
+	RunE: runImageRm,
+}
+
+func init() {
+	imageCmd.AddCommand(imageListCmd)
+	imageCmd.AddCommand(imageRmCmd)
+}
+
+// needsImage reports whether cfg asks for anything baked into an image.
+func needsImage(cfg *config.CreateConfig) bool {
+	return cfg.BaseImage != "" || len(cfg.Packages) > 0
+}
+
+// ensureImage returns the ID of the image baker baked for cfg's base image
+// and packages, baking it first if there isn't one. If another process
+// bakes the same image at the same time, the one recorded first is used
+// and the other is deleted.
+func ensureImage(ctx context.Context, db *state.DB, backendName string, baker backend.ImageBaker, cfg *config.CreateConfig) (string, error) {
+	spec := backend.ImageSpec{
+		BaseImage:   cfg.BaseImage,
+		Packages:    cfg.Packages,
+		Credentials: cfg.Credentials,
+	}
+	key := spec.Key()
+
+	img, err := db.GetImage(backendName, key)
+	if err == nil {
+		if err := db.TouchImage(img.ID, time.Now()); err != nil {
+			fmt.Fprintf(os.Stderr, "warning: %v\n", err)
+		}
+		return img.ImageID, nil
+	}
+	if !errors.Is(err, state.ErrImageNotFound) {
+		return "", err
+	}
+
+	msg.Fprintf(os.Stderr, "Baking base image %s (%s)...\n", key, describeImage(cfg.BaseImage, cfg.Packages))
+	imageID, err := baker.BakeImage(ctx, spec)
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	added, err := db.AddImage(&state.Image{
+		Backend:    backendName,
+		Key:        key,
+		BaseImage:  cfg.BaseImage,
+		Packages:   cfg.Packages,
+		ImageID:    imageID,
+		CreatedAt:  now,
+		LastUsedAt: now,
+	})
+	if err != nil {
+		_ = baker.DeleteImage(ctx, imageID)
+		return "", err
+	}
+	if added {
+		return imageID, nil
+	}
+
+	// Another process baked it first; use theirs.
+	if err := baker.DeleteImage(ctx, imageID); err != nil {
+		fmt.Fprintf(os.Stderr, "warning: failed to delete duplicate image %s: %v\n", imageID, err)
+	}
+	img, err = db.GetImage(backendName, key)
+	if err != nil {
+		return "", err
+	}
+	return img.ImageID, nil
+}
+
+// describeImage summarizes a base image and its packages for output.
+func describeImage(baseImage string, packages []string) string {
+	if baseImage == "" {
+		baseImage = "default image"
+	}
+	switch len(packages) {
+	case 0:
+		return baseImage
+	case 1:
+		return baseImage + " + 1 package"
+	default:
+		return fmt.Sprintf("%s + %d packages", baseImage, len(packages))
+	}
+}
+
+func runImageList(cmd *cobra.Command, args []string) error {
+	db, err := state.OpenReadOnly("")
+	if err != nil {
+		return fmt.Errorf("failed to open state database: %w", err)
+	}
+	defer db.Close()
+
+	images, err := db.ListImages()
+	if err != nil {
+		return err
+	}
+	if len(images) == 0 {
+		fmt.Println("No images found.")
+		return nil
+	}
+
+	t := table.New(
+		table.Column{Header: "KEY"},
+		table.Column{Header: "BACKEND"},
+		table.Column{Header: "BASE IMAGE"},
+		table.Column{Header: "LAST USED"},
+		table.Column{Header: "PACKAGES", Min: 16},
+	)
+	for _, img := range images {
+		baseImage := img.BaseImage
+		if baseImage == "" {
+			baseImage = "-"
+		}
+		t.Row(img.Key, img.Backend, baseImage, formatTimeAgo(img.LastUsedAt), strings.Join(img.Packages, " "))
+	}
+	return t.Render(os.Stdout, table.TerminalWidth(os.Stdout))
+}
+
+func runImageRm(cmd *cobra.Command, args []string) error {
+	db, err := state.Open("")
+	if err != nil {
+		return fmt.Errorf("failed to open state database: %w", err)
+	}
+	defer db.Close()
+
+	img, err := findImage(db, args[0])
+	if err != nil {
+		return err
+	}
+	be, err := getBackend(img.Backend, "")
+	if err != nil {
+		return err
+	}
+	if baker, ok := be.(backend.ImageBaker); ok {
+		if err := baker.DeleteImage(cmd.Context(), img.ImageID); err != nil {
+			return fmt.Errorf("failed to delete image: %w", err)
+		}
+	}
+	if err := db.DeleteImage(img.ID); err != nil {
+		return err
+	}
+	msg.Printf("Removed image %s\n", img.Key)
+	return nil
+}
+
+// findImage returns the image whose key starts with prefix.
+func findImage(db *state.DB, prefix string) (*state.Image, error) {
+	images, err := db.ListImages()
+	if err != nil {
+		return nil, err
+	}
+	var matches []*state.Image
+	for _, img := range images {
+		if strings.HasPrefix(img.Key, prefix) {
+			matches = append(matches, img)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return nil, fmt.Errorf("%w: %s", state.ErrImageNotFound, prefix)
+	case 1:
+		return matches[0], nil
+	default:
+		return nil, clierr.Validation(fmt.Errorf("ambiguous image key %q: matches %d images", prefix, len(matches)))
+	}
+}
@@ -1,13 +1,25 @@
 package env
 
 import (
+	"bytes"
+	"context"
 	"fmt"
 	"os"
-	"text/tabwriter"
+	"os/signal"
+	"slices"
+	"strconv"
+	"syscall"
 	"time"
 
+	"github.com/Quidge/choir/internal/config"
+	"github.com/Quidge/choir/internal/daemon"
 	"github.com/Quidge/choir/internal/gitutil"
+	"github.com/Quidge/choir/internal/pathutil"
+	"github.com/Quidge/choir/internal/prompt"
+	"github.com/Quidge/choir/internal/resolve"
 	"github.com/Quidge/choir/internal/state"
+	"github.com/Quidge/choir/internal/table"
+	"github.com/Quidge/choir/internal/theme"
 	"github.com/spf13/cobra"
 )
 
@@ -17,55 +29,120 @@ var listCmd = &cobra.Command{
 	Short:   "List environments",
 	Long: `List all environments, optionally filtered by backend or repository.
 
-By default, removed and failed environments are hidden. Use --all to show them.`,
+By default, removed and failed environments, and environments waiting in a
+warm pool (see "choir env pool"), are hidden. Use --all to show them.
+
+With --watch, the table is redrawn every --interval until interrupted.
+Environments whose status changed since the previous refresh are marked
+with the old status (and highlighted on a terminal), which is useful while
+several environments provision concurrently.
+
+On a terminal, long branch names are shortened with "…" so the table fits
+the window. Use --wide to show full values plus each workspace path.
+
+--sort orders the table by created (newest first, the default), status
+(through the lifecycle), last-used (most recent command first), or name
+(branch name). --limit shows at most that many environments, and --offset
+skips the first ones, for paging through a long list.
+
+--verify asks each environment's backend for the state of its workspace and
+marks rows whose recorded status disagrees, such as a ready environment
+whose worktree was deleted by hand. --fix also updates those records (for
+example, marking the environment failed).
+
+--size adds each workspace's disk usage, which requires scanning every
+workspace (see "choir env du").
+
+--verbose (-v) adds AHEAD and BEHIND columns, counting the commits on each
+environment's branch that its base branch doesn't have and the reverse, and
+a DIRTY column marking workspaces with uncommitted changes, so environments
+with work worth reviewing stand out. Workspaces that aren't directories on
+this machine show -.`,
 	Args: cobra.NoArgs,
 	RunE: runList,
 }
 
 var (
-	listBackendFlag string
-	listRepoFlag    bool
-	listAllFlag     bool
+	listBackendFlag  string
+	listRepoFlag     bool
+	listAllFlag      bool
+	listWatchFlag    bool
+	listIntervalFlag time.Duration
+	listWideFlag     bool
+	listSizeFlag     bool
+	listSortFlag     string
+	listLimitFlag    int
+	listOffsetFlag   int
+	listVerifyFlag   bool
+	listFixFlag      bool
 )
 
 func init() {
 	listCmd.Flags().StringVar(&listBackendFlag, "backend", "", "filter by backend")
 	listCmd.Flags().BoolVar(&listRepoFlag, "repo", false, "filter by current repository")
-	listCmd.Flags().BoolVar(&listAllFlag, "all", false, "include removed/failed environments")
+	listCmd.Flags().BoolVar(&listAllFlag, "all", false, "include removed/failed and pooled environments")
+	listCmd.Flags().BoolVarP(&listWatchFlag, "watch", "w", false, "refresh the table until interrupted")
+	listCmd.Flags().BoolVar(&listWideFlag, "wide", false, "show workspace paths and don't truncate to the terminal width")
+	listCmd.Flags().BoolVar(&listSizeFlag, "size", false, "show each workspace's disk usage")
+	listCmd.Flags().StringVar(&listSortFlag, "sort", string(state.SortCreated), "order by created, status, last-used, or name")
+	listCmd.Flags().IntVar(&listLimitFlag, "limit", 0, "show at most this many environments (0 for all)")
+	listCmd.Flags().IntVar(&listOffsetFlag, "offset", 0, "skip this many environments")
+	listCmd.Flags().BoolVar(&listVerifyFlag, "verify", false, "check each workspace with its backend and mark drifted statuses")
+	listCmd.Flags().BoolVar(&listFixFlag, "fix", false, "with --verify, update drifted statuses to match the workspaces")
+	listCmd.Flags().DurationVar(&listIntervalFlag, "interval", 2*time.Second, "refresh interval for --watch")
 }
 
 func runList(cmd *cobra.Command, args []string) error {
-	// Open state database
-	db, err := state.Open("")
-	if err != nil {
-		return fmt.Errorf("failed to open state database: %w", err)
-	}
-	defer db.Close()
+	verbose, _ := cmd.Flags().GetBool("verbose")
 
 	// Build list options
 	opts := state.ListOptions{
 		Backend: listBackendFlag,
+		Sort:    state.SortOrder(listSortFlag),
+		Limit:   listLimitFlag,
+		Offset:  listOffsetFlag,
+	}
+	if !slices.Contains(state.SortOrders, opts.Sort) {
+		return fmt.Errorf("unknown --sort %q (want created, status, last-used, or name)", listSortFlag)
+	}
+	if opts.Limit < 0 || opts.Offset < 0 {
+		return fmt.Errorf("--limit and --offset must not be negative")
+	}
+	if listFixFlag && !listVerifyFlag {
+		return fmt.Errorf("--fix requires --verify")
+	}
+	if listFixFlag && listWatchFlag {
+		return fmt.Errorf("--fix can't be used with --watch")
 	}
 
 	// Filter by current repository if requested
 	if listRepoFlag {
-		repoRoot, err := gitutil.RepoRoot("")
+		repos, closeRepos := openRepoCache()
+		repoRoot, err := repos.RepoRoot("")
+		closeRepos()
 		if err != nil {
 			return fmt.Errorf("not in a git repository: %w", err)
 		}
 		opts.RepoPath = repoRoot
 	}
 
-	// By default, exclude removed and failed environments
+	// By default, exclude removed and failed environments, and those
+	// waiting in a warm pool
 	if !listAllFlag {
-		opts.Statuses = []state.EnvironmentStatus{
-			state.StatusProvisioning,
-			state.StatusReady,
+		opts.Statuses = resolve.VisibleStatuses
+		opts.Pooled = state.PoolExclude
+	}
+
+	if listWatchFlag {
+		db, err := state.OpenReadOnly("")
+		if err != nil {
+			return fmt.Errorf("failed to open state database: %w", err)
 		}
+		defer db.Close()
+		return watchList(cmd.Context(), db, opts, verbose)
 	}
 
-	// Get environments
-	envs, err := db.ListEnvironments(opts)
+	envs, err := listEnvironments(cmd.Context(), opts)
 	if err != nil {
 		return fmt.Errorf("failed to list environments: %w", err)
 	}
@@ -75,16 +152,326 @@ func runList(cmd *cobra.Command, args []string) error {
 		return nil
 	}
 
-	// Print table
-	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
-	fmt.Fprintln(w, "ID\tSTATUS\tBRANCH\tCREATED")
+	th, err := loadTheme(prompt.IsTerminal(os.Stdout))
+	if err != nil {
+		return err
+	}
+	style := listStyle{
+		wide:  listWideFlag,
+		width: table.TerminalWidth(os.Stdout),
+		theme: th,
+	}
+	if listSizeFlag {
+		style.sizes = measureEnvironments(cmd.Context(), envs)
+	}
+	if verbose {
+		style.progress = measureProgress(envs)
+	}
+	if listVerifyFlag {
+		style.drift, err = verifyList(cmd.Context(), envs, listFixFlag)
+		if err != nil {
+			return err
+		}
+	}
+	os.Stdout.Write(renderList(envs, nil, style))
+	if n := len(style.drift); n > 0 && !listFixFlag {
+		fmt.Fprintf(os.Stderr, "%d %s drifted from the recorded status; use --verify --fix to update\n",
+			n, plural(n, "environment has", "environments have"))
+	}
+	return nil
+}
+
+// verifyList checks envs with their backends and returns a note for each
+// drifted environment. If fix is set, drifted records are updated (in envs
+// too) and the notes name the status they had.
+func verifyList(ctx context.Context, envs []*state.Environment, fix bool) (map[string]string, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	drifts := verifyEnvironments(ctx, envs)
+	notes := make(map[string]string, len(drifts))
+	if len(drifts) == 0 {
+		return notes, nil
+	}
+
+	var db *state.DB
+	if fix {
+		var err error
+		db, err = state.Open("")
+		if err != nil {
+			return nil, fmt.Errorf("failed to open state database: %w", err)
+		}
+		defer db.Close()
+	}
+	var drifted []*state.Environment
+	was := make(map[string]state.EnvironmentStatus)
 	for _, env := range envs {
-		created := formatTimeAgo(env.CreatedAt)
-		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", state.ShortID(env.ID), env.Status, env.BranchName, created)
+		drift, ok := drifts[env.ID]
+		if !ok {
+			continue
+		}
+		notes[env.ID] = drift.Problem
+		drifted = append(drifted, env)
+		was[env.ID] = env.Status
+	}
+	if !fix {
+		return notes, nil
 	}
-	w.Flush()
 
-	return nil
+	failed := fixDrifts(ctx, db, drifted, drifts)
+	for _, env := range drifted {
+		if err, ok := failed[env.ID]; ok {
+			fmt.Fprintf(os.Stderr, "warning: %s: %v\n", state.ShortID(env.ID), err)
+			continue
+		}
+		notes[env.ID] = fmt.Sprintf("was %s: %s", was[env.ID], drifts[env.ID].Problem)
+	}
+	return notes, nil
+}
+
+// listEnvironments lists environments through the daemon if it is enabled
+// and running, and from the state database otherwise.
+func listEnvironments(ctx context.Context, opts state.ListOptions) ([]*state.Environment, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if daemon.Enabled() {
+		if socket, err := daemon.SocketPath(); err == nil {
+			if client, err := daemon.Dial(socket); err == nil {
+				defer client.Close()
+				return client.ListEnvironments(ctx, opts)
+			}
+		}
+	}
+
+	db, err := state.OpenReadOnly("")
+	if err != nil {
+		return nil, fmt.Errorf("failed to open state database: %w", err)
+	}
+	defer db.Close()
+	return db.ListEnvironments(opts)
+}
+
+// watchList redraws the environment table every listIntervalFlag until ctx
+// is cancelled or the process is interrupted. With verbose, it includes the
+// git progress columns.
+func watchList(ctx context.Context, db *state.DB, opts state.ListOptions, verbose bool) error {
+	if listIntervalFlag <= 0 {
+		return fmt.Errorf("--interval must be positive")
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	tty := prompt.IsTerminal(os.Stdout)
+	th, err := loadTheme(tty)
+	if err != nil {
+		return err
+	}
+	ticker := time.NewTicker(listIntervalFlag)
+	defer ticker.Stop()
+
+	var prev map[string]state.EnvironmentStatus
+	for {
+		envs, err := db.ListEnvironments(opts)
+		if err != nil {
+			return fmt.Errorf("failed to list environments: %w", err)
+		}
+
+		var out bytes.Buffer
+		if tty {
+			out.WriteString("\033[H\033[2J") // Clear screen, cursor home
+		}
+		fmt.Fprintf(&out, "Every %s: choir env list (Ctrl-C to stop)  %s\n\n",
+			listIntervalFlag, time.Now().Format("15:04:05"))
+		if len(envs) == 0 {
+			out.WriteString("No environments found.\n")
+		} else {
+			style := listStyle{
+				highlight: tty,
+				wide:      listWideFlag,
+				width:     table.TerminalWidth(os.Stdout),
+				theme:     th,
+			}
+			if listSizeFlag {
+				style.sizes = measureEnvironments(ctx, envs)
+			}
+			if verbose {
+				style.progress = measureProgress(envs)
+			}
+			if listVerifyFlag {
+				style.drift, _ = verifyList(ctx, envs, false)
+			}
+			out.Write(renderList(envs, prev, style))
+		}
+		os.Stdout.Write(out.Bytes())
+
+		prev = make(map[string]state.EnvironmentStatus, len(envs))
+		for _, env := range envs {
+			prev[env.ID] = env.Status
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// listStyle controls how renderList draws the table.
+type listStyle struct {
+	highlight bool // bold changed rows
+	wide      bool // include the PATH column and don't truncate
+	width     int  // terminal width to fit the table in; 0 for no limit
+
+	// theme colors and marks statuses. If nil, statuses are plain.
+	theme *theme.Theme
+
+	// sizes holds disk usage by environment ID. If non-nil, a SIZE column
+	// is shown.
+	sizes map[string]uint64
+
+	// progress holds git progress by environment ID. If non-nil, AHEAD,
+	// BEHIND, and DIRTY columns are shown.
+	progress map[string]gitProgress
+
+	// drift holds notes on environments whose workspace disagrees with
+	// their status, by environment ID (see env list --verify).
+	drift map[string]string
+}
+
+// renderList formats environments as a table. If prev is non-nil,
+// environments whose status differs from prev (or that are new) are marked,
+// and highlighted with bold text when style.highlight is true.
+// Unless style.wide is set, long branch names are elided to fit style.width.
+func renderList(envs []*state.Environment, prev map[string]state.EnvironmentStatus, style listStyle) []byte {
+	cols := []table.Column{
+		{Header: "ID"},
+		{Header: "STATUS"},
+		{Header: "BRANCH", Min: 16},
+		{Header: "CREATED"},
+	}
+	if style.progress != nil {
+		cols = append(cols, table.Column{Header: "AHEAD"}, table.Column{Header: "BEHIND"}, table.Column{Header: "DIRTY"})
+	}
+	if style.sizes != nil {
+		cols = append(cols, table.Column{Header: "SIZE"})
+	}
+	if style.wide {
+		cols = append(cols, table.Column{Header: "PATH"})
+	}
+	t := table.New(cols...)
+
+	for _, env := range envs {
+		status := string(env.Status)
+		if style.theme != nil {
+			status = style.theme.Label(string(env.Status))
+		}
+		if env.Pooled {
+			status += " (pooled)"
+		}
+		if note, ok := style.drift[env.ID]; ok {
+			status += " (" + note + ")"
+		}
+		changed := false
+		if prev != nil {
+			old, seen := prev[env.ID]
+			switch {
+			case !seen:
+				status += " (new)"
+				changed = true
+			case old != env.Status:
+				status += fmt.Sprintf(" (was %s)", old)
+				changed = true
+			}
+		}
+
+		cells := []string{state.ShortID(env.ID), status, env.BranchName, formatTimeAgo(env.CreatedAt)}
+		if style.progress != nil {
+			cells = append(cells, formatProgress(style.progress, env)...)
+		}
+		if style.sizes != nil {
+			cells = append(cells, formatSize(style.sizes, env))
+		}
+		cells = append(cells, env.BackendID)
+		if changed && style.highlight {
+			t.StyledRow("1", cells...)
+		} else {
+			t.Row(cells...)
+		}
+		if style.theme != nil {
+			t.StyleCell(1, style.theme.Style(string(env.Status)))
+		}
+	}
+
+	width := style.width
+	if style.wide {
+		width = 0
+	}
+	var buf bytes.Buffer
+	_ = t.Render(&buf, width)
+	return buf.Bytes()
+}
+
+// gitProgress is how far an environment's branch has come from its base
+// branch, for the git progress columns of env list --verbose.
+type gitProgress struct {
+	ahead  int
+	behind int
+	dirty  bool
+}
+
+// measureProgress returns the git progress of envs whose workspaces are
+// directories on this machine, by environment ID. Environments it can't
+// measure are left out.
+func measureProgress(envs []*state.Environment) map[string]gitProgress {
+	progress := make(map[string]gitProgress, len(envs))
+	for _, env := range envs {
+		if env.BackendID == "" || !pathutil.ExistsAndIsDir(env.BackendID) {
+			continue
+		}
+		ahead, behind, err := gitutil.CommitsAheadBehind(env.BackendID, env.BaseBranch, "HEAD")
+		if err != nil {
+			continue
+		}
+		dirty, err := gitutil.HasUncommittedChanges(env.BackendID)
+		if err != nil {
+			continue
+		}
+		progress[env.ID] = gitProgress{ahead: ahead, behind: behind, dirty: dirty}
+	}
+	return progress
+}
+
+// formatProgress formats env's AHEAD, BEHIND, and DIRTY cells from
+// progress, or - for each if it is unknown.
+func formatProgress(progress map[string]gitProgress, env *state.Environment) []string {
+	p, ok := progress[env.ID]
+	if !ok {
+		return []string{"-", "-", "-"}
+	}
+	dirty := "no"
+	if p.dirty {
+		dirty = "yes"
+	}
+	return []string{strconv.Itoa(p.ahead), strconv.Itoa(p.behind), dirty}
+}
+
+// loadTheme returns the status theme from the global config, with colors
+// enabled if the output is a terminal (and NO_COLOR is unset).
+func loadTheme(terminal bool) (*theme.Theme, error) {
+	global, err := config.LoadGlobalConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load config: %w", err)
+	}
+	th, err := theme.New(global.Theme, theme.UseColor(terminal))
+	if err != nil {
+		return nil, fmt.Errorf("invalid theme config: %w", err)
+	}
+	return th, nil
 }
 
 // formatTimeAgo formats a time as a human-readable relative time.
@@ -0,0 +1,96 @@
+package env
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Quidge/choir/internal/state"
+)
+
+func TestRenderList(t *testing.T) {
+	envs := []*state.Environment{
+		{ID: "aaaa1111aaaa1111aaaa1111aaaa1111", BranchName: "env/aaaa1111", Status: state.StatusReady, CreatedAt: time.Now()},
+		{ID: "bbbb2222bbbb2222bbbb2222bbbb2222", BranchName: "env/bbbb2222", Status: state.StatusProvisioning, CreatedAt: time.Now()},
+		{ID: "cccc3333cccc3333cccc3333cccc3333", BranchName: "env/cccc3333", Status: state.StatusReady, CreatedAt: time.Now()},
+	}
+	prev := map[string]state.EnvironmentStatus{
+		envs[0].ID: state.StatusProvisioning,
+		envs[1].ID: state.StatusProvisioning,
+	}
+
+	out := string(renderList(envs, prev, listStyle{}))
+	if !strings.Contains(out, "ready (was provisioning)") {
+		t.Errorf("expected transition marker:\n%s", out)
+	}
+	if !strings.Contains(out, "ready (new)") {
+		t.Errorf("expected new marker:\n%s", out)
+	}
+	if strings.Contains(out, "\033[") {
+		t.Errorf("unexpected escape codes without highlight:\n%s", out)
+	}
+
+	lines := strings.Split(string(renderList(envs, prev, listStyle{highlight: true})), "\n")
+	if !strings.HasPrefix(lines[1], "\033[1m") || strings.HasPrefix(lines[2], "\033[1m") {
+		t.Errorf("expected only changed rows highlighted:\n%q", lines)
+	}
+
+	if out := string(renderList(envs, nil, listStyle{})); strings.Contains(out, "(") {
+		t.Errorf("expected no markers without previous snapshot:\n%s", out)
+	}
+}
+
+func TestRenderListWidth(t *testing.T) {
+	envs := []*state.Environment{
+		{ID: "aaaa1111aaaa1111aaaa1111aaaa1111", BranchName: "feature/an-extremely-long-branch-name-for-testing", BackendID: "/worktrees/choir-aaaa1111aaaa", Status: state.StatusReady, CreatedAt: time.Now()},
+		{ID: "bbbb2222bbbb2222bbbb2222bbbb2222", BranchName: "機能/ブランチ", Status: state.StatusReady, CreatedAt: time.Now()},
+	}
+
+	out := string(renderList(envs, nil, listStyle{width: 60}))
+	if !strings.Contains(out, "…") || strings.Contains(out, "for-testing") {
+		t.Errorf("expected long branch elided to fit:\n%s", out)
+	}
+	if strings.Contains(out, "PATH") {
+		t.Errorf("unexpected PATH column without --wide:\n%s", out)
+	}
+
+	out = string(renderList(envs, nil, listStyle{width: 60, wide: true}))
+	if !strings.Contains(out, "for-testing") || !strings.Contains(out, "/worktrees/choir-aaaa1111aaaa") {
+		t.Errorf("expected full values with --wide:\n%s", out)
+	}
+}
+
+func TestRenderListSizes(t *testing.T) {
+	envs := []*state.Environment{
+		{ID: "aaaa1111aaaa1111aaaa1111aaaa1111", BranchName: "env/aaaa1111", Status: state.StatusReady, CreatedAt: time.Now()},
+		{ID: "bbbb2222bbbb2222bbbb2222bbbb2222", BranchName: "env/bbbb2222", Status: state.StatusProvisioning, CreatedAt: time.Now()},
+	}
+	sizes := map[string]uint64{envs[0].ID: 3 << 20}
+
+	lines := strings.Split(string(renderList(envs, nil, listStyle{sizes: sizes})), "\n")
+	if !strings.HasSuffix(lines[0], "SIZE") || !strings.HasSuffix(lines[1], "3 MiB") || !strings.HasSuffix(lines[2], "-") {
+		t.Errorf("expected SIZE column with unknown sizes as -:\n%s", strings.Join(lines, "\n"))
+	}
+}
+
+func TestRenderListProgress(t *testing.T) {
+	envs := []*state.Environment{
+		{ID: "aaaa1111aaaa1111aaaa1111aaaa1111", BranchName: "env/aaaa1111", Status: state.StatusReady, CreatedAt: time.Now()},
+		{ID: "bbbb2222bbbb2222bbbb2222bbbb2222", BranchName: "env/bbbb2222", Status: state.StatusProvisioning, CreatedAt: time.Now()},
+	}
+	progress := map[string]gitProgress{envs[0].ID: {ahead: 3, behind: 1, dirty: true}}
+
+	lines := strings.Split(string(renderList(envs, nil, listStyle{progress: progress})), "\n")
+	if got := strings.Fields(lines[0]); strings.Join(got[len(got)-3:], " ") != "AHEAD BEHIND DIRTY" {
+		t.Errorf("expected progress columns last:\n%s", strings.Join(lines, "\n"))
+	}
+	if got := strings.Fields(lines[1]); strings.Join(got[len(got)-3:], " ") != "3 1 yes" {
+		t.Errorf("expected progress cells:\n%s", strings.Join(lines, "\n"))
+	}
+	if got := strings.Fields(lines[2]); strings.Join(got[len(got)-3:], " ") != "- - -" {
+		t.Errorf("expected unknown progress as -:\n%s", strings.Join(lines, "\n"))
+	}
+	if out := string(renderList(envs, nil, listStyle{})); strings.Contains(out, "AHEAD") {
+		t.Errorf("unexpected progress columns without --verbose:\n%s", out)
+	}
+}
@@ -0,0 +1,35 @@
+package env
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/Quidge/choir/internal/config"
+	"github.com/Quidge/choir/internal/hooks"
+	"github.com/Quidge/choir/internal/state"
+)
+
+// notify fires the hooks configured for event. Hook failures are printed as
+// warnings and never fail the operation that triggered them.
+func notify(ctx context.Context, event hooks.Event, env *state.Environment) {
+	global, err := config.LoadGlobalConfig()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "warning: hooks not run: %v\n", err)
+		return
+	}
+	if len(global.Hooks) == 0 {
+		return
+	}
+	hks, err := hooks.FromConfig(global.Hooks)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "warning: hooks not run: %v\n", err)
+		return
+	}
+
+	n := &hooks.Notifier{Hooks: hks}
+	if err := n.Notify(ctx, hooks.NewPayload(event, env, time.Now())); err != nil {
+		fmt.Fprintf(os.Stderr, "warning: %v\n", err)
+	}
+}
@@ -0,0 +1,74 @@
+package env
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/Quidge/choir/internal/prompt"
+	"github.com/Quidge/choir/internal/resolve"
+	"github.com/Quidge/choir/internal/state"
+	"github.com/spf13/cobra"
+)
+
+// canPick reports whether an omitted environment ID can be picked
+// interactively: choir is at a terminal and not in non-interactive mode.
+func canPick() bool {
+	return prompt.IsTerminal(os.Stdin) && prompt.IsTerminal(os.Stdout) && !prompt.NonInteractive()
+}
+
+// OptionalIDArg is a cobra.PositionalArgs that accepts one environment ID,
+// or none when one can be picked interactively (see pickEnvironment);
+// otherwise a missing ID is a usage error.
+func OptionalIDArg(cmd *cobra.Command, args []string) error {
+	if len(args) == 0 && !canPick() {
+		return errors.New("requires an environment ID")
+	}
+	return cobra.MaximumNArgs(1)(cmd, args)
+}
+
+// resolveEnvironmentArg resolves the environment ID in args, as
+// resolve.Environment does, or has the user pick an environment if it was
+// omitted.
+func resolveEnvironmentArg(db *state.DB, args []string) (*state.Environment, error) {
+	if len(args) > 0 {
+		return resolve.Environment(db, args[0])
+	}
+	return pickEnvironment(db)
+}
+
+// pickEnvironment asks the user to choose one of the visible environments,
+// most recently used first.
+func pickEnvironment(db *state.DB) (*state.Environment, error) {
+	envs, err := db.ListEnvironments(state.ListOptions{Statuses: resolve.VisibleStatuses, Pooled: state.PoolExclude, Sort: state.SortLastUsed})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list environments: %w", err)
+	}
+	if len(envs) == 0 {
+		return nil, errors.New("no environments; create one with \"choir env create\"")
+	}
+
+	var idWidth, statusWidth, branchWidth, repoWidth int
+	for _, env := range envs {
+		idWidth = max(idWidth, len(state.ShortID(env.ID)))
+		statusWidth = max(statusWidth, len(env.Status))
+		branchWidth = max(branchWidth, len(env.BranchName))
+		repoWidth = max(repoWidth, len(filepath.Base(env.RepoPath)))
+	}
+	items := make([]string, len(envs))
+	for i, env := range envs {
+		items[i] = fmt.Sprintf("%-*s  %-*s  %-*s  %-*s  %s", idWidth, state.ShortID(env.ID),
+			statusWidth, env.Status, branchWidth, env.BranchName,
+			repoWidth, filepath.Base(env.RepoPath), formatTimeAgo(env.CreatedAt))
+	}
+
+	i, err := prompt.Choose("Environments:", items, "pass an environment ID")
+	if errors.Is(err, prompt.ErrCanceled) {
+		return nil, errors.New("no environment selected")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return envs[i], nil
+}
@@ -0,0 +1,55 @@
+package env
+
+import (
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Quidge/choir/internal/prompt"
+	"github.com/Quidge/choir/internal/state"
+)
+
+func TestPickEnvironment(t *testing.T) {
+	db := openReconcileDB(t)
+	t.Setenv(prompt.EnvNonInteractive, "")
+
+	for i, tt := range []struct {
+		id     string
+		branch string
+		status state.EnvironmentStatus
+	}{
+		{"aaaa0000000000000000000000000000", "feature/login", state.StatusReady},
+		{"bbbb0000000000000000000000000000", "feature/logout", state.StatusStopped},
+		{"cccc0000000000000000000000000000", "feature/lost", state.StatusRemoved},
+	} {
+		env := newTestEnv(tt.id)
+		env.BranchName = tt.branch
+		env.Status = tt.status
+		env.CreatedAt = time.Now().Add(time.Duration(i) * time.Minute)
+		if err := db.CreateEnvironment(env); err != nil {
+			t.Fatalf("CreateEnvironment() failed: %v", err)
+		}
+	}
+
+	pick := func(input string) (*state.Environment, error) {
+		oldIn, oldOut := prompt.In, prompt.Out
+		prompt.In, prompt.Out = strings.NewReader(input), io.Discard
+		defer func() { prompt.In, prompt.Out = oldIn, oldOut }()
+		return pickEnvironment(db)
+	}
+
+	// Newest first, removed environments left out
+	if env, err := pick("1\n"); err != nil || env.BranchName != "feature/logout" {
+		t.Errorf("pick 1 = %v, %v; want feature/logout", env, err)
+	}
+	if env, err := pick("login\n"); err != nil || env.BranchName != "feature/login" {
+		t.Errorf("pick login = %v, %v; want feature/login", env, err)
+	}
+	if _, err := pick("lost\n"); err == nil {
+		t.Error("picked a removed environment")
+	}
+	if _, err := pick("\n"); err == nil {
+		t.Error("canceled pick succeeded")
+	}
+}
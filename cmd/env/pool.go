@@ -0,0 +1,331 @@
+package env
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/Quidge/choir/internal/backend"
+	"github.com/Quidge/choir/internal/config"
+	"github.com/Quidge/choir/internal/gitutil"
+	"github.com/Quidge/choir/internal/hooks"
+	"github.com/Quidge/choir/internal/msg"
+	"github.com/Quidge/choir/internal/state"
+	"github.com/Quidge/choir/internal/table"
+	"github.com/spf13/cobra"
+)
+
+var poolCmd = &cobra.Command{
+	Use:   "pool",
+	Short: "Manage warm pools of pre-provisioned environments",
+	Long: `Manage warm pools: environments provisioned ahead of time so env create can
+take one instead of waiting for setup.
+
+Set pool: N in a repository's .choir.yaml to keep N environments ready for
+it. env create takes the oldest ready one, rebases its branch onto the base
+branch asked for, and starts a background process that provisions a
+replacement. Creates that change how the environment is set up (--profile,
+--template, --from-branch, --no-setup, --task-md, env clone) don't use the
+pool. Pooled environments are hidden from env list unless --all is given.
+
+After changing the setup in .choir.yaml, drain the pool so later creates
+don't take environments set up the old way.
+
+Subcommands:
+  list   List pooled environments
+  fill   Provision pooled environments until the pool is full
+  drain  Remove a repository's pooled environments`,
+}
+
+var poolListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List pooled environments",
+	Args:  cobra.NoArgs,
+	RunE:  runPoolList,
+}
+
+var poolFillCmd = &cobra.Command{
+	Use:   "fill",
+	Short: "Provision pooled environments until the pool is full",
+	Long: `Provision pooled environments for a repository until as many as its pool:
+setting asks for are ready or provisioning. env create runs this in the
+background after using a pool; run it by hand to fill a pool ahead of the
+first create. If another process is already filling the pool, fill does
+nothing.`,
+	Args: cobra.NoArgs,
+	RunE: runPoolFill,
+}
+
+var poolDrainCmd = &cobra.Command{
+	Use:   "drain",
+	Short: "Remove a repository's pooled environments",
+	Args:  cobra.NoArgs,
+	RunE:  runPoolDrain,
+}
+
+var poolRepoFlag string
+
+func init() {
+	poolCmd.AddCommand(poolListCmd)
+	poolCmd.AddCommand(poolFillCmd)
+	poolCmd.AddCommand(poolDrainCmd)
+
+	for _, c := range []*cobra.Command{poolFillCmd, poolDrainCmd} {
+		c.Flags().StringVar(&poolRepoFlag, "repo", "", "repository path or remote URL (default: current repository)")
+	}
+}
+
+// poolable reports whether an environment created with opts can be taken
+// from its repository's pool. Pooled environments are set up from the
+// project config alone, on a new branch.
+func poolable(opts CreateOptions) bool {
+	return opts.CloneFrom == nil && opts.FromBranch == "" && opts.Profile == "" && opts.Template == "" &&
+		!opts.NoSetup && !opts.TaskMD && !opts.Pooled
+}
+
+// takePooled takes a ready environment from the pool of repoRoot's
+// environments on backendName and remote, and rebases its branch onto
+// base. Pooled environments that can't be rebased are removed and the
+// next one is tried. It returns nil if the pool has none ready.
+func takePooled(ctx context.Context, db *state.DB, be backend.Backend, repoRoot, backendName, remote, base string) (*state.Environment, error) {
+	for {
+		env, err := db.TakePooledEnvironment(repoRoot, backendName, remote, time.Now())
+		if errors.Is(err, state.ErrEnvironmentNotFound) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		err = rebaseWorkspace(ctx, be, env.BackendID, base)
+		if err == nil {
+			env.BaseBranch = base
+			return env, nil
+		}
+		fmt.Fprintf(os.Stderr, "warning: failed to rebase pooled environment %s onto %s, removing it: %v\n", state.ShortID(env.ID), base, err)
+		if err := RemoveEnvironment(ctx, db, env, RemoveOptions{Force: true, NoBackup: true}); err != nil {
+			fmt.Fprintf(os.Stderr, "warning: %v\n", err)
+		}
+	}
+}
+
+// rebaseWorkspace rebases the branch checked out in workspace backendID
+// onto base, stashing any changes setup made to tracked files meanwhile.
+func rebaseWorkspace(ctx context.Context, be backend.Backend, backendID, base string) error {
+	output, exitCode, err := be.Exec(ctx, backendID, "git rebase --quiet --autostash "+shellQuote(base))
+	if err != nil {
+		return err
+	}
+	if exitCode != 0 {
+		return fmt.Errorf("git rebase exited with code %d: %s", exitCode, strings.TrimSpace(output))
+	}
+	return nil
+}
+
+// shellQuote quotes s for a POSIX shell.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// useTaken prepares env, just taken from the pool, for the create that
+// took it: it records opts.Task and an expiry ttl from now, and fires the
+// ready hooks withheld while it was pooled.
+func useTaken(ctx context.Context, db *state.DB, env *state.Environment, opts CreateOptions, ttl time.Duration) error {
+	env.Task = opts.Task
+	if ttl > 0 {
+		env.ExpiresAt = env.CreatedAt.Add(ttl)
+	}
+	if err := db.UpdateEnvironment(env); err != nil {
+		return fmt.Errorf("failed to update environment: %w", err)
+	}
+	msg.Fprintf(os.Stderr, "Took %s from the pool\n", state.ShortID(env.ID))
+	notify(ctx, hooks.EventReady, env)
+	return nil
+}
+
+// startPoolFill starts a background choir process, in its own session so
+// it outlives the terminal, to refill repoRoot's pool (see fillPool). Its
+// output is appended to pool.log next to the setup logs.
+func startPoolFill(repoRoot string) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to find the choir executable: %w", err)
+	}
+	dbPath, err := state.DefaultDBPath()
+	if err != nil {
+		return err
+	}
+	logPath := filepath.Join(filepath.Dir(dbPath), "logs", "pool.log")
+	if err := os.MkdirAll(filepath.Dir(logPath), 0700); err != nil {
+		return fmt.Errorf("failed to create log directory: %w", err)
+	}
+	log, err := os.OpenFile(logPath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open pool log: %w", err)
+	}
+	defer log.Close()
+
+	cmd := exec.Command(exe, "env", "pool", "fill", "--repo", repoRoot)
+	cmd.Env = append(os.Environ(), msg.EnvQuiet+"=1")
+	cmd.Stdout = log
+	cmd.Stderr = log
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start %s: %w", exe, err)
+	}
+	return cmd.Process.Release()
+}
+
+// fillPool provisions pooled environments for repoRoot, one at a time,
+// until as many as its pool setting asks for are ready or provisioning,
+// and returns how many it created. It stops at the first that fails. If
+// another process is filling the pool already, it returns at once.
+func fillPool(ctx context.Context, repoRoot string) (int, error) {
+	unlock, locked, err := lockPool(repoRoot)
+	if err != nil || !locked {
+		return 0, err
+	}
+	defer unlock()
+
+	merged, err := config.Load(repoRoot, config.FlagOverrides{})
+	if err != nil {
+		return 0, fmt.Errorf("failed to load config: %w", err)
+	}
+	db, err := state.Open("")
+	if err != nil {
+		return 0, fmt.Errorf("failed to open state database: %w", err)
+	}
+	defer db.Close()
+
+	created := 0
+	for {
+		n, err := db.CountEnvironments(state.ListOptions{
+			RepoPath: repoRoot,
+			Backend:  merged.Backend,
+			Statuses: []state.EnvironmentStatus{state.StatusProvisioning, state.StatusReady},
+			Pooled:   state.PoolOnly,
+		})
+		if err != nil {
+			return created, err
+		}
+		if n >= merged.Pool {
+			return created, nil
+		}
+		if _, err := CreateEnvironment(ctx, CreateOptions{Repo: repoRoot, Pooled: true}); err != nil {
+			return created, err
+		}
+		created++
+	}
+}
+
+// lockPool takes an exclusive lock on filling repoRoot's pool, so
+// concurrent creates don't overfill it. locked is false if another
+// process holds it.
+func lockPool(repoRoot string) (unlock func(), locked bool, err error) {
+	dbPath, err := state.DefaultDBPath()
+	if err != nil {
+		return nil, false, err
+	}
+	sum := sha256.Sum256([]byte(repoRoot))
+	path := filepath.Join(filepath.Dir(dbPath), "pool", hex.EncodeToString(sum[:8])+".lock")
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, false, fmt.Errorf("failed to create lock directory: %w", err)
+	}
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to open pool lock: %w", err)
+	}
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		f.Close()
+		if errors.Is(err, syscall.EWOULDBLOCK) {
+			return nil, false, nil
+		}
+		return nil, false, fmt.Errorf("failed to lock pool: %w", err)
+	}
+	return func() { f.Close() }, true, nil
+}
+
+// poolRepo returns the repository --repo names for pool fill and drain.
+func poolRepo() (string, error) {
+	repos, closeRepos := openRepoCache()
+	defer closeRepos()
+	repoRoot, _, err := resolveRepo(repos, poolRepoFlag, gitutil.CloneOptions{})
+	return repoRoot, err
+}
+
+func runPoolList(cmd *cobra.Command, args []string) error {
+	db, err := state.OpenReadOnly("")
+	if err != nil {
+		return fmt.Errorf("failed to open state database: %w", err)
+	}
+	defer db.Close()
+
+	envs, err := db.ListEnvironments(state.ListOptions{Pooled: state.PoolOnly})
+	if err != nil {
+		return fmt.Errorf("failed to list environments: %w", err)
+	}
+	if len(envs) == 0 {
+		fmt.Println("No pooled environments.")
+		return nil
+	}
+
+	t := table.New(
+		table.Column{Header: "ID"},
+		table.Column{Header: "STATUS"},
+		table.Column{Header: "BASE"},
+		table.Column{Header: "CREATED"},
+		table.Column{Header: "REPOSITORY", Min: 16},
+	)
+	for _, env := range envs {
+		t.Row(state.ShortID(env.ID), string(env.Status), env.BaseBranch, formatTimeAgo(env.CreatedAt), env.RepoPath)
+	}
+	return t.Render(os.Stdout, table.TerminalWidth(os.Stdout))
+}
+
+func runPoolFill(cmd *cobra.Command, args []string) error {
+	repoRoot, err := poolRepo()
+	if err != nil {
+		return err
+	}
+	created, err := fillPool(cmd.Context(), repoRoot)
+	if created > 0 {
+		msg.Printf("Added %d %s to the pool for %s\n", created, plural(created, "environment", "environments"), repoRoot)
+	}
+	return err
+}
+
+func runPoolDrain(cmd *cobra.Command, args []string) error {
+	repoRoot, err := poolRepo()
+	if err != nil {
+		return err
+	}
+	db, err := state.Open("")
+	if err != nil {
+		return fmt.Errorf("failed to open state database: %w", err)
+	}
+	defer db.Close()
+
+	envs, err := db.ListEnvironments(state.ListOptions{RepoPath: repoRoot, Pooled: state.PoolOnly})
+	if err != nil {
+		return fmt.Errorf("failed to list environments: %w", err)
+	}
+	removed := 0
+	var errs []error
+	for _, env := range envs {
+		if err := RemoveEnvironment(cmd.Context(), db, env, RemoveOptions{Force: true, NoBackup: true}); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", state.ShortID(env.ID), err))
+			continue
+		}
+		removed++
+	}
+	msg.Printf("Removed %d pooled %s for %s\n", removed, plural(removed, "environment", "environments"), repoRoot)
+	return errors.Join(errs...)
+}
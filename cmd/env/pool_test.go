@@ -0,0 +1,78 @@
+package env
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Quidge/choir/internal/backend/fake"
+	"github.com/Quidge/choir/internal/config"
+	"github.com/Quidge/choir/internal/state"
+)
+
+func TestTakePooled(t *testing.T) {
+	db := openReconcileDB(t)
+	ctx := context.Background()
+	be := fake.New()
+
+	var pooled []*state.Environment
+	for i, id := range []string{"aaaa1111000000000000000000000000", "bbbb1111000000000000000000000000"} {
+		env := newTestEnv(id)
+		env.Pooled = true
+		env.CreatedAt = time.Now().Add(time.Duration(i-2) * time.Minute)
+		if _, err := Provision(ctx, db, env, ProvisionSpec{Backend: be, Config: &config.CreateConfig{}}); err != nil {
+			t.Fatalf("Provision() failed: %v", err)
+		}
+		pooled = append(pooled, env)
+	}
+
+	// The oldest can't be rebased, so it is removed and the next taken
+	var commands []string
+	be.ExecFunc = func(backendID, command string) (string, int) {
+		commands = append(commands, command)
+		if backendID == pooled[0].BackendID {
+			return "error: cannot rebase", 1
+		}
+		return "", 0
+	}
+	env, err := takePooled(ctx, db, be, "/test", "local", "", "feature/x")
+	if err != nil {
+		t.Fatalf("takePooled() failed: %v", err)
+	}
+	if env == nil || env.ID != pooled[1].ID || env.Pooled || env.BaseBranch != "feature/x" {
+		t.Fatalf("takePooled() = %+v, want %s no longer pooled and based on feature/x", env, pooled[1].ID)
+	}
+	if want := "git rebase --quiet --autostash 'feature/x'"; len(commands) != 2 || commands[1] != want {
+		t.Errorf("commands = %q, want two ending with %q", commands, want)
+	}
+	if _, err := db.GetEnvironment(pooled[0].ID); !errors.Is(err, state.ErrEnvironmentNotFound) {
+		t.Errorf("unrebasable pooled environment still recorded: %v", err)
+	}
+
+	if env, err := takePooled(ctx, db, be, "/test", "local", "", "main"); err != nil || env != nil {
+		t.Errorf("takePooled() from an empty pool = %v, %v; want nil", env, err)
+	}
+}
+
+func TestPoolable(t *testing.T) {
+	tests := []struct {
+		name string
+		opts CreateOptions
+		want bool
+	}{
+		{"plain", CreateOptions{Task: "fix it", TTL: "2h", Base: "main"}, true},
+		{"profile", CreateOptions{Profile: "gpu"}, false},
+		{"template", CreateOptions{Template: "node"}, false},
+		{"from branch", CreateOptions{FromBranch: "wip"}, false},
+		{"no setup", CreateOptions{NoSetup: true}, false},
+		{"task file", CreateOptions{Task: "fix it", TaskMD: true}, false},
+		{"clone", CreateOptions{CloneFrom: newTestEnv("cccc1111000000000000000000000000")}, false},
+		{"filling the pool", CreateOptions{Pooled: true}, false},
+	}
+	for _, tt := range tests {
+		if got := poolable(tt.opts); got != tt.want {
+			t.Errorf("%s: poolable() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
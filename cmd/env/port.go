@@ -0,0 +1,227 @@
+package env
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/Quidge/choir/internal/backend"
+	"github.com/Quidge/choir/internal/config"
+	"github.com/Quidge/choir/internal/msg"
+	"github.com/Quidge/choir/internal/resolve"
+	"github.com/Quidge/choir/internal/state"
+	"github.com/Quidge/choir/internal/table"
+	"github.com/spf13/cobra"
+)
+
+var portCmd = &cobra.Command{
+	Use:   "port ID [PORT...]",
+	Short: "Forward ports from an environment to the host",
+	Long: `Forward ports from an environment's workspace to the host, so a server
+started in a VM or container environment can be reached at localhost.
+
+Each PORT is a port in the workspace, forwarded to the same port on the
+host ("3000"), or HOST:PORT to use a different host port ("8080:3000").
+Without ports, the environment's active forwards are listed. With --stop,
+the given forwards are stopped, or all of them if no ports are given.
+
+Ports listed under ports: in .choir.yaml are forwarded when an environment
+is created. Forwards are stopped when the environment is removed.
+
+Worktree environments share the host's network, so their ports are
+reachable without forwarding; for them this command only warns.
+
+The ID can be a prefix if it uniquely identifies an environment.`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: runPort,
+}
+
+var portStopFlag bool
+
+func init() {
+	portCmd.Flags().BoolVar(&portStopFlag, "stop", false, "stop forwarding the given ports (all if none are given)")
+}
+
+func runPort(cmd *cobra.Command, args []string) error {
+	ctx := context.Background()
+
+	mappings := make([]config.PortMapping, 0, len(args)-1)
+	for _, arg := range args[1:] {
+		m, err := config.ParsePortMapping(arg)
+		if err != nil {
+			return err
+		}
+		mappings = append(mappings, m)
+	}
+
+	db, err := state.Open("")
+	if err != nil {
+		return fmt.Errorf("failed to open state database: %w", err)
+	}
+	defer db.Close()
+
+	env, err := resolve.Environment(db, args[0])
+	if err != nil {
+		return err
+	}
+	shortID := state.ShortID(env.ID)
+
+	be, err := getBackend(env.Backend, "")
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case portStopFlag:
+		stopped, err := stopPortForwards(ctx, db, be, env, mappings)
+		for _, f := range stopped {
+			msg.Printf("Stopped forwarding localhost:%d to %d in %s\n", f.HostPort, f.GuestPort, shortID)
+		}
+		if err != nil {
+			return err
+		}
+		if len(stopped) == 0 && len(mappings) == 0 {
+			msg.Printf("No ports are forwarded for %s\n", shortID)
+		} else if len(stopped) == 0 {
+			msg.Printf("No matching ports are forwarded for %s\n", shortID)
+		}
+		return nil
+	case len(mappings) == 0:
+		return printPortForwards(db, env)
+	}
+
+	if env.Status != state.StatusReady {
+		return fmt.Errorf("environment %s is %s, not ready", shortID, env.Status)
+	}
+	if _, ok := be.(backend.PortForwarder); !ok {
+		for _, m := range mappings {
+			fmt.Fprintf(os.Stderr, "warning: the %s backend doesn't forward ports; its workspaces share the host's network, so port %d is reachable at localhost:%d\n",
+				env.Backend, m.Guest, m.Guest)
+		}
+		return nil
+	}
+	for _, m := range mappings {
+		f, err := forwardPort(ctx, db, be, env, m)
+		if err != nil {
+			return err
+		}
+		msg.Printf("Forwarding localhost:%d to %d in %s\n", f.HostPort, f.GuestPort, shortID)
+	}
+	return nil
+}
+
+// printPortForwards lists env's active port forwards.
+func printPortForwards(db *state.DB, env *state.Environment) error {
+	forwards, err := db.ListPortForwards(env.ID)
+	if err != nil {
+		return err
+	}
+	if len(forwards) == 0 {
+		fmt.Printf("No ports are forwarded for %s\n", state.ShortID(env.ID))
+		return nil
+	}
+	t := table.New(
+		table.Column{Header: "HOST"},
+		table.Column{Header: "PORT"},
+		table.Column{Header: "SINCE"},
+	)
+	for _, f := range forwards {
+		t.Row("localhost:"+strconv.Itoa(f.HostPort), strconv.Itoa(f.GuestPort), formatTimeAgo(f.CreatedAt))
+	}
+	return t.Render(os.Stdout, table.TerminalWidth(os.Stdout))
+}
+
+// forwardPort forwards m from env's workspace with be, which must be a
+// backend.PortForwarder, and records the forward. A port already forwarded
+// to the same host port is left as it is.
+func forwardPort(ctx context.Context, db *state.DB, be backend.Backend, env *state.Environment, m config.PortMapping) (*state.PortForward, error) {
+	forwards, err := db.ListPortForwards(env.ID)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range forwards {
+		if f.HostPort == m.HostPort() {
+			if f.GuestPort == m.Guest {
+				return f, nil
+			}
+			return nil, fmt.Errorf("localhost:%d is already forwarded to %d; stop that forward first", f.HostPort, f.GuestPort)
+		}
+	}
+
+	forwardID, err := be.(backend.PortForwarder).ForwardPort(ctx, env.BackendID, m.Guest, m.HostPort())
+	if err != nil {
+		return nil, fmt.Errorf("failed to forward port %s: %w", m, err)
+	}
+	f := &state.PortForward{
+		EnvironmentID: env.ID,
+		GuestPort:     m.Guest,
+		HostPort:      m.HostPort(),
+		ForwardID:     forwardID,
+		CreatedAt:     time.Now(),
+	}
+	if err := db.AddPortForward(f); err != nil {
+		_ = be.(backend.PortForwarder).StopForward(ctx, env.BackendID, forwardID)
+		return nil, err
+	}
+	return f, nil
+}
+
+// forwardConfiguredPorts forwards the ports in env's project config, if its
+// backend forwards ports. Failures are warnings: the environment is usable
+// without them, and they can be retried with env port.
+func forwardConfiguredPorts(ctx context.Context, db *state.DB, be backend.Backend, env *state.Environment, ports []config.PortMapping) {
+	if _, ok := be.(backend.PortForwarder); !ok {
+		return
+	}
+	for _, m := range ports {
+		if _, err := forwardPort(ctx, db, be, env, m); err != nil {
+			fmt.Fprintf(os.Stderr, "warning: %v\n", err)
+		}
+	}
+}
+
+// stopPortForwards stops env's port forwards that match one of mappings,
+// or all of them if mappings is empty, and deletes their records. A
+// mapping matches forwards of its workspace port, and only to its host
+// port if it names one. It returns the forwards stopped, which may be some
+// of them even if it fails.
+func stopPortForwards(ctx context.Context, db *state.DB, be backend.Backend, env *state.Environment, mappings []config.PortMapping) ([]*state.PortForward, error) {
+	forwards, err := db.ListPortForwards(env.ID)
+	if err != nil {
+		return nil, err
+	}
+	forwarder, _ := be.(backend.PortForwarder)
+
+	var stopped []*state.PortForward
+	for _, f := range forwards {
+		if !matchesPortForward(f, mappings) {
+			continue
+		}
+		if forwarder != nil {
+			if err := forwarder.StopForward(ctx, env.BackendID, f.ForwardID); err != nil {
+				return stopped, fmt.Errorf("failed to stop forwarding localhost:%d: %w", f.HostPort, err)
+			}
+		}
+		if err := db.DeletePortForward(f.ID); err != nil {
+			return stopped, err
+		}
+		stopped = append(stopped, f)
+	}
+	return stopped, nil
+}
+
+// matchesPortForward reports whether f matches one of mappings, as
+// described for stopPortForwards.
+func matchesPortForward(f *state.PortForward, mappings []config.PortMapping) bool {
+	if len(mappings) == 0 {
+		return true
+	}
+	for _, m := range mappings {
+		if m.Guest == f.GuestPort && (m.Host == 0 || m.Host == f.HostPort) {
+			return true
+		}
+	}
+	return false
+}
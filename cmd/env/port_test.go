@@ -0,0 +1,84 @@
+package env
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Quidge/choir/internal/backend/fake"
+	"github.com/Quidge/choir/internal/config"
+	"github.com/Quidge/choir/internal/state"
+)
+
+func TestPortForwarding(t *testing.T) {
+	db := openReconcileDB(t)
+	ctx := context.Background()
+	be := fake.New()
+
+	env := newTestEnv("ports000000000000000000000000000")
+	ports := []config.PortMapping{{Guest: 3000}, {Host: 8080, Guest: 80}}
+	if _, err := Provision(ctx, db, env, ProvisionSpec{Backend: be, Config: &config.CreateConfig{Ports: ports}}); err != nil {
+		t.Fatalf("Provision() failed: %v", err)
+	}
+	forwards, err := db.ListPortForwards(env.ID)
+	if err != nil {
+		t.Fatalf("ListPortForwards() failed: %v", err)
+	}
+	if len(forwards) != 2 || be.Forwards(env.BackendID) != 2 {
+		t.Fatalf("after Provision: %d recorded, %d active; want the 2 configured ports", len(forwards), be.Forwards(env.BackendID))
+	}
+
+	t.Run("forwarding again is a no-op", func(t *testing.T) {
+		if _, err := forwardPort(ctx, db, be, env, config.PortMapping{Guest: 3000}); err != nil {
+			t.Fatalf("forwardPort() failed: %v", err)
+		}
+		if n := be.Forwards(env.BackendID); n != 2 {
+			t.Errorf("%d active forwards, want 2", n)
+		}
+	})
+
+	t.Run("host port in use", func(t *testing.T) {
+		if _, err := forwardPort(ctx, db, be, env, config.PortMapping{Host: 8080, Guest: 81}); err == nil {
+			t.Error("forwardPort() to a forwarded host port succeeded, want error")
+		}
+	})
+
+	t.Run("stop matching", func(t *testing.T) {
+		stopped, err := stopPortForwards(ctx, db, be, env, []config.PortMapping{{Guest: 80}})
+		if err != nil {
+			t.Fatalf("stopPortForwards() failed: %v", err)
+		}
+		if len(stopped) != 1 || stopped[0].HostPort != 8080 || be.Forwards(env.BackendID) != 1 {
+			t.Errorf("stopped %+v, %d still active; want only 8080:80 stopped", stopped, be.Forwards(env.BackendID))
+		}
+	})
+
+	t.Run("stop all", func(t *testing.T) {
+		stopped, err := stopPortForwards(ctx, db, be, env, nil)
+		if err != nil {
+			t.Fatalf("stopPortForwards() failed: %v", err)
+		}
+		remaining, _ := db.ListPortForwards(env.ID)
+		if len(stopped) != 1 || len(remaining) != 0 || be.Forwards(env.BackendID) != 0 {
+			t.Errorf("stopped %d, %d recorded and %d active after; want all stopped", len(stopped), len(remaining), be.Forwards(env.BackendID))
+		}
+	})
+}
+
+func TestMatchesPortForward(t *testing.T) {
+	f := &state.PortForward{GuestPort: 80, HostPort: 8080}
+	tests := []struct {
+		mappings []config.PortMapping
+		want     bool
+	}{
+		{nil, true},
+		{[]config.PortMapping{{Guest: 80}}, true},
+		{[]config.PortMapping{{Host: 8080, Guest: 80}}, true},
+		{[]config.PortMapping{{Host: 9090, Guest: 80}}, false},
+		{[]config.PortMapping{{Guest: 8080}}, false},
+	}
+	for _, tt := range tests {
+		if got := matchesPortForward(f, tt.mappings); got != tt.want {
+			t.Errorf("matchesPortForward(%v) = %v, want %v", tt.mappings, got, tt.want)
+		}
+	}
+}
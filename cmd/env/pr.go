@@ -0,0 +1,166 @@
+package env
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/Quidge/choir/internal/config"
+	"github.com/Quidge/choir/internal/gitutil"
+	"github.com/Quidge/choir/internal/msg"
+	"github.com/Quidge/choir/internal/pathutil"
+	"github.com/Quidge/choir/internal/resolve"
+	"github.com/Quidge/choir/internal/state"
+	"github.com/Quidge/choir/internal/table"
+	"github.com/spf13/cobra"
+)
+
+var prCmd = &cobra.Command{
+	Use:   "pr ID",
+	Short: "Push an environment's branch and open a pull request",
+	Long: `Push an environment's branch and open a pull request against its base branch.
+
+The ID can be a prefix if it uniquely identifies an environment.
+Requires the GitHub CLI (gh). The gh config directory is taken from
+credentials.github_cli in the global config.
+
+The branch is pushed to the remote the environment was created with (see
+"env create --remote"), or to --remote.
+
+The title and body default to the environment's task (see "env create
+--prompt"): the title is its first line and the body all of it. Without a
+task or --title, the title and body are filled from the branch's first
+commit. --body applies either way.`,
+	Args: cobra.ExactArgs(1),
+	RunE: runPR,
+}
+
+var (
+	prTitleFlag  string
+	prBodyFlag   string
+	prDraftFlag  bool
+	prRemoteFlag string
+)
+
+func init() {
+	prCmd.Flags().StringVar(&prTitleFlag, "title", "", "pull request title (default: the task's first line, else the first commit's subject)")
+	prCmd.Flags().StringVar(&prBodyFlag, "body", "", "pull request body (default: the task, else the first commit's body)")
+	prCmd.Flags().BoolVar(&prDraftFlag, "draft", false, "open the pull request as a draft")
+	prCmd.Flags().StringVar(&prRemoteFlag, "remote", "", "remote to push the branch to (default: the environment's remote, else origin)")
+}
+
+func runPR(cmd *cobra.Command, args []string) error {
+	idPrefix := args[0]
+
+	// Open state database
+	db, err := state.Open("")
+	if err != nil {
+		return fmt.Errorf("failed to open state database: %w", err)
+	}
+	defer db.Close()
+
+	// Resolve environment by ID prefix
+	env, err := resolve.Environment(db, idPrefix)
+	if err != nil {
+		return err
+	}
+
+	if env.Status != state.StatusReady {
+		return fmt.Errorf("environment %q is %s, not ready", idPrefix, env.Status)
+	}
+
+	return openPullRequest(env, pullRequest{
+		remote: prRemoteFlag,
+		title:  prTitleFlag,
+		body:   prBodyFlag,
+		draft:  prDraftFlag,
+	})
+}
+
+// pullRequest is what openPullRequest opens. An empty title or body
+// defaults to the environment's task, else the branch's first commit.
+type pullRequest struct {
+	remote string // Default: the environment's remote, else origin
+	title  string
+	body   string
+	draft  bool
+}
+
+// openPullRequest pushes env's branch from its workspace and opens a pull
+// request for it against its base branch with the GitHub CLI.
+func openPullRequest(env *state.Environment, pr pullRequest) error {
+	ghPath, err := exec.LookPath("gh")
+	if err != nil {
+		return fmt.Errorf("GitHub CLI (gh) not found in PATH: install it from https://cli.github.com")
+	}
+
+	// Push the environment branch from its workspace
+	remote := pr.remote
+	if remote == "" {
+		remote = env.Remote
+	}
+	if remote == "" {
+		remote = "origin"
+	}
+	msg.Fprintf(os.Stderr, "Pushing %s to %s...\n", env.BranchName, remote)
+	if err := gitutil.Push(env.BackendID, remote, env.BranchName); err != nil {
+		return err
+	}
+
+	ghArgs := []string{"pr", "create", "--base", env.BaseBranch, "--head", env.BranchName}
+	ghArgs = append(ghArgs, prTextArgs(env, pr)...)
+	if pr.draft {
+		ghArgs = append(ghArgs, "--draft")
+	}
+
+	ghCmd := exec.Command(ghPath, ghArgs...)
+	ghCmd.Dir = env.BackendID
+	ghCmd.Stdin = os.Stdin
+	ghCmd.Stdout = os.Stdout
+	ghCmd.Stderr = os.Stderr
+	ghCmd.Env = os.Environ()
+
+	// Point gh at the configured credentials directory
+	if global, err := config.LoadGlobalConfig(); err == nil {
+		ghConfigDir, err := config.ExpandPath(global.Credentials.GitHubCLI)
+		if err == nil && pathutil.ExistsAndIsDir(ghConfigDir) {
+			ghCmd.Env = append(ghCmd.Env, "GH_CONFIG_DIR="+ghConfigDir)
+		}
+	}
+
+	if err := ghCmd.Run(); err != nil {
+		return fmt.Errorf("gh pr create failed: %w", err)
+	}
+
+	return nil
+}
+
+// prTitleWidth is the longest title taken from a task; longer first lines
+// are cut short.
+const prTitleWidth = 72
+
+// prTextArgs returns the gh pr create flags that set pr's title and body,
+// defaulting them to env's task. Without a title, gh fills it, and the
+// body unless one is given, from the branch's first commit.
+func prTextArgs(env *state.Environment, pr pullRequest) []string {
+	task := strings.TrimSpace(env.Task)
+	title, body := pr.title, pr.body
+	if title == "" && task != "" {
+		firstLine, _, _ := strings.Cut(task, "\n")
+		title = table.Truncate(strings.TrimSpace(firstLine), prTitleWidth)
+	}
+	if body == "" {
+		body = task
+	}
+
+	if title == "" {
+		args := []string{"--fill-first"}
+		if body != "" {
+			args = append(args, "--body", body)
+		}
+		return args
+	}
+	// An empty --body still keeps gh from asking for one
+	return []string{"--title", title, "--body", body}
+}
@@ -0,0 +1,39 @@
+package env
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/Quidge/choir/internal/state"
+)
+
+func TestPRTextArgs(t *testing.T) {
+	longTask := strings.Repeat("word ", 20)
+	tests := []struct {
+		name string
+		task string
+		pr   pullRequest
+		want []string
+	}{
+		{"from commits", "", pullRequest{}, []string{"--fill-first"}},
+		{"body without title", "", pullRequest{body: "Closes #12"}, []string{"--fill-first", "--body", "Closes #12"}},
+		{"title without body", "", pullRequest{title: "Fix"}, []string{"--title", "Fix", "--body", ""}},
+		{"from task", "Add retry logic\n\nBack off on 503s.", pullRequest{},
+			[]string{"--title", "Add retry logic", "--body", "Add retry logic\n\nBack off on 503s."}},
+		{"flags override task", "Add retry logic", pullRequest{title: "Retry", body: "Closes #12"},
+			[]string{"--title", "Retry", "--body", "Closes #12"}},
+		{"body flag with task title", "Add retry logic", pullRequest{body: "Closes #12"},
+			[]string{"--title", "Add retry logic", "--body", "Closes #12"}},
+		{"long task", longTask, pullRequest{},
+			[]string{"--title", strings.TrimSpace(longTask)[:prTitleWidth-1] + "…", "--body", strings.TrimSpace(longTask)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := prTextArgs(&state.Environment{Task: tt.task}, tt.pr)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("prTextArgs() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
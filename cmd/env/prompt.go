@@ -0,0 +1,87 @@
+package env
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var promptCmd = &cobra.Command{
+	Use:   "prompt [bash|zsh|fish|starship]",
+	Short: "Print a snippet showing the current environment in the shell prompt",
+	Long: `Print a snippet that adds the current environment's branch to the shell
+prompt, for your shell's startup file or starship.toml. The shell defaults
+to the one in $SHELL.
+
+Shells opened by "choir env attach" have CHOIR_ENV_ID and CHOIR_BRANCH set,
+so the snippet shows the environment without running choir. In other shells
+it falls back to "choir env current --porcelain", which reads only the
+workspace's marker file.
+
+Examples:
+  choir env prompt bash >> ~/.bashrc
+  choir env prompt fish >> ~/.config/fish/config.fish
+  choir env prompt starship >> ~/.config/starship.toml`,
+	Args:      cobra.MatchAll(cobra.MaximumNArgs(1), cobra.OnlyValidArgs),
+	ValidArgs: []string{"bash", "zsh", "fish", "starship"},
+	RunE:      runPrompt,
+}
+
+// posixPromptFunc prints the environment's branch for bash and zsh prompts.
+const posixPromptFunc = `# choir: show the current environment in the prompt
+__choir_prompt() {
+  local branch=$CHOIR_BRANCH
+  if [ -z "$CHOIR_ENV_ID" ]; then
+    branch=$(choir env current --porcelain 2>/dev/null | cut -f2) || return 0
+  fi
+  [ -n "$branch" ] && printf '(choir:%s) ' "$branch"
+}
+`
+
+// promptSnippets are the snippets printed by "choir env prompt", by shell.
+var promptSnippets = map[string]string{
+	"bash": posixPromptFunc + `PS1='$(__choir_prompt)'"$PS1"
+`,
+	"zsh": posixPromptFunc + `setopt PROMPT_SUBST
+PROMPT='$(__choir_prompt)'"$PROMPT"
+`,
+	"fish": `# choir: show the current environment in the prompt
+function __choir_prompt
+    set -l branch $CHOIR_BRANCH
+    if test -z "$CHOIR_ENV_ID"
+        set branch (choir env current --porcelain 2>/dev/null | cut -f2)
+    end
+    test -n "$branch"; and printf '(choir:%s) ' $branch
+end
+
+functions -q __choir_fish_prompt; or functions -c fish_prompt __choir_fish_prompt
+function fish_prompt
+    __choir_prompt
+    __choir_fish_prompt
+end
+`,
+	"starship": `# choir: show the current environment in the prompt
+[custom.choir]
+when = 'test -n "$CHOIR_ENV_ID" || choir env current --porcelain'
+command = 'if [ -n "$CHOIR_ENV_ID" ]; then printf %s "$CHOIR_BRANCH"; else choir env current --porcelain | cut -f2; fi'
+format = '[\(choir:$output\)]($style) '
+style = 'bold purple'
+shell = ['sh']
+`,
+}
+
+func runPrompt(cmd *cobra.Command, args []string) error {
+	shell := filepath.Base(os.Getenv("SHELL"))
+	if len(args) > 0 {
+		shell = args[0]
+	}
+	snippet, ok := promptSnippets[shell]
+	if !ok {
+		return fmt.Errorf("no prompt snippet for shell %q; pass one of %s", shell, strings.Join(cmd.ValidArgs, ", "))
+	}
+	fmt.Print(snippet)
+	return nil
+}
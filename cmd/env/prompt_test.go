@@ -0,0 +1,25 @@
+package env
+
+import (
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+func TestPromptSnippets(t *testing.T) {
+	for _, shell := range promptCmd.ValidArgs {
+		if _, ok := promptSnippets[shell]; !ok {
+			t.Errorf("no prompt snippet for %s", shell)
+		}
+	}
+
+	// The POSIX snippet must at least parse
+	if _, err := exec.LookPath("bash"); err != nil {
+		t.Skip("bash not installed")
+	}
+	cmd := exec.Command("bash", "-n")
+	cmd.Stdin = strings.NewReader(promptSnippets["bash"])
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Errorf("bash snippet doesn't parse: %v\n%s", err, out)
+	}
+}
@@ -0,0 +1,129 @@
+package env
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+	"time"
+
+	"github.com/Quidge/choir/internal/clierr"
+	"github.com/Quidge/choir/internal/config"
+	"github.com/Quidge/choir/internal/msg"
+	"github.com/Quidge/choir/internal/state"
+)
+
+// provisionQueuePollInterval is how often an environment waiting in the
+// provision queue checks for a free slot.
+const provisionQueuePollInterval = time.Second
+
+// waitForProvisionSlot queues environment id to be provisioned by this
+// process and waits until it is first in line and fewer than
+// max_parallel_provisions environments are being provisioned. The caller
+// provisions it and then calls release to free the slot. If waiting ends
+// early, the environment leaves the queue and the error is returned.
+func waitForProvisionSlot(ctx context.Context, db *state.DB, id string) (release func(), err error) {
+	limit, err := provisionLimit()
+	if err != nil {
+		return nil, err
+	}
+	if err := db.EnqueueProvision(id, os.Getpid()); err != nil {
+		return nil, err
+	}
+	release = func() {
+		if err := db.FinishProvision(id); err != nil {
+			fmt.Fprintf(os.Stderr, "warning: %v\n", err)
+		}
+	}
+
+	ticker := time.NewTicker(provisionQueuePollInterval)
+	defer ticker.Stop()
+	waiting := false
+	for {
+		running, err := pruneProvisionQueue(db)
+		if err == nil {
+			var started bool
+			started, err = db.StartProvision(id, limit)
+			if started {
+				return release, nil
+			}
+		}
+		if err != nil {
+			release()
+			return nil, err
+		}
+		if !waiting {
+			msg.Fprintf(os.Stderr, "Waiting to provision %s: %d of %d provisioning slots in use (max_parallel_provisions)\n",
+				state.ShortID(id), running, limit)
+			waiting = true
+		}
+
+		select {
+		case <-ctx.Done():
+			release()
+			return nil, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// provisionLimit returns how many environments may be provisioned at once.
+func provisionLimit() (int, error) {
+	global, err := config.LoadGlobalConfig()
+	if err != nil {
+		return 0, fmt.Errorf("failed to load config: %w", err)
+	}
+	if global.MaxParallelProvisions < 0 {
+		return 0, clierr.Validation(fmt.Errorf("max_parallel_provisions: must not be negative, got %d", global.MaxParallelProvisions))
+	}
+	return global.ProvisionLimit(), nil
+}
+
+// pruneProvisionQueue removes environments from the provision queue whose
+// process has died, so a crashed create doesn't hold a slot or its place
+// in line forever, and returns how many still hold a slot.
+func pruneProvisionQueue(db *state.DB) (running int, err error) {
+	queue, err := db.ListProvisionQueue()
+	if err != nil {
+		return 0, err
+	}
+	for _, q := range queue {
+		if !processAlive(q.PID) {
+			if err := db.FinishProvision(q.EnvironmentID); err != nil {
+				return 0, err
+			}
+			continue
+		}
+		if q.Running() {
+			running++
+		}
+	}
+	return running, nil
+}
+
+// waitingToProvision reports whether environment id is waiting in the
+// provision queue for a slot, with the process that will provision it
+// still alive.
+func waitingToProvision(db *state.DB, id string) bool {
+	queue, err := db.ListProvisionQueue()
+	if err != nil {
+		return false
+	}
+	for _, q := range queue {
+		if q.EnvironmentID == id {
+			return !q.Running() && processAlive(q.PID)
+		}
+	}
+	return false
+}
+
+// processAlive reports whether a process with the given PID exists on
+// this host. PIDs are reused, so the answer is a hint.
+func processAlive(pid int) bool {
+	if pid == os.Getpid() {
+		return true
+	}
+	err := syscall.Kill(pid, 0)
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
@@ -0,0 +1,61 @@
+package env
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWaitForProvisionSlot(t *testing.T) {
+	db := openReconcileDB(t)
+	configDir := filepath.Join(os.Getenv("XDG_CONFIG_HOME"), "choir")
+	if err := os.MkdirAll(configDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(configDir, "config.yaml"), []byte("max_parallel_provisions: 1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// A process that has exited holds the only slot until it's pruned
+	dead := exec.Command("true")
+	if err := dead.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.EnqueueProvision("crashed", dead.Process.Pid); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.StartProvision("crashed", 1); err != nil {
+		t.Fatal(err)
+	}
+	release, err := waitForProvisionSlot(context.Background(), db, "first")
+	if err != nil {
+		t.Fatalf("waitForProvisionSlot() with a dead holder failed: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := waitForProvisionSlot(ctx, db, "second"); err == nil {
+		t.Fatal("waitForProvisionSlot() got a second slot with a limit of 1")
+	}
+	if waitingToProvision(db, "second") {
+		t.Error("second is still queued after giving up")
+	}
+
+	release()
+	release, err = waitForProvisionSlot(context.Background(), db, "second")
+	if err != nil {
+		t.Fatalf("waitForProvisionSlot() after release failed: %v", err)
+	}
+	release()
+
+	queue, err := db.ListProvisionQueue()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(queue) != 0 {
+		t.Errorf("queue = %+v, want empty", queue)
+	}
+}
@@ -0,0 +1,675 @@
+package env
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/Quidge/choir/internal/backend"
+	"github.com/Quidge/choir/internal/clierr"
+	"github.com/Quidge/choir/internal/config"
+	"github.com/Quidge/choir/internal/fault"
+	"github.com/Quidge/choir/internal/hooks"
+	"github.com/Quidge/choir/internal/metrics"
+	"github.com/Quidge/choir/internal/msg"
+	"github.com/Quidge/choir/internal/state"
+)
+
+// This file holds the environment lifecycle operations shared by env create,
+// env rm, gc, and the daemon. Each one compares an environment's record with
+// its actual workspace and does only the work needed to converge them, so it
+// is safe to call repeatedly, including after a crash midway through.
+
+// StaleProvisioningAfter is how long an environment may stay provisioning
+// before Reconcile assumes the process creating it died and marks it failed.
+const StaleProvisioningAfter = time.Hour
+
+// Provisioning stages reported in ProvisionError and failure metrics.
+const (
+	StageImage  = "image"
+	StageCreate = "create"
+	StageSetup  = "setup"
+)
+
+// ProvisionError reports which stage of Provision failed.
+type ProvisionError struct {
+	Stage string
+	Err   error
+}
+
+func (e *ProvisionError) Error() string {
+	switch e.Stage {
+	case StageSetup:
+		return fmt.Sprintf("setup failed: %v", e.Err)
+	case StageImage:
+		return fmt.Sprintf("failed to bake base image: %v", e.Err)
+	}
+	return fmt.Sprintf("failed to create worktree: %v", e.Err)
+}
+
+func (e *ProvisionError) Unwrap() error {
+	return e.Err
+}
+
+// ProvisionSpec is what Provision needs to bring a workspace up.
+type ProvisionSpec struct {
+	Backend   backend.Backend
+	Config    *config.CreateConfig
+	SkipSetup bool // Don't run setup (env create --no-setup)
+
+	// CloneFrom, if set, is the backend ID of a workspace whose setup is
+	// copied into the new one instead of run again (env clone). Only
+	// backends implementing backend.SetupCopier copy it; others run setup.
+	CloneFrom string
+}
+
+// ProvisionResult reports what Provision did.
+type ProvisionResult struct {
+	Created       bool                 // A workspace was created by this call
+	SetupDuration time.Duration        // Time spent in setup (zero if skipped)
+	Setup         *backend.SetupResult // What setup ran (nil if skipped)
+}
+
+// Provision converges env to ready. It records env if it has no record yet,
+// creates its workspace unless one already exists (from a base image baked
+// first, for backends that clone from one), runs setup, marks it ready,
+// forwards its configured ports, and fires the ready hooks. For an
+// environment that is already ready with its workspace in place it does
+// nothing.
+//
+// On failure env is marked failed, the failed hooks fire, and the returned
+// *ProvisionError names the stage that failed; it is marked as a backend
+// failure for clierr. The workspace is kept so it can be inspected.
+func Provision(ctx context.Context, db *state.DB, env *state.Environment, spec ProvisionSpec) (ProvisionResult, error) {
+	var res ProvisionResult
+	provisionStarted := time.Now()
+
+	exists, err := workspaceExists(ctx, spec.Backend, env)
+	if err != nil {
+		return res, err
+	}
+	if env.Status == state.StatusReady && exists {
+		return res, nil
+	}
+
+	if _, err := db.GetEnvironment(env.ID); errors.Is(err, state.ErrEnvironmentNotFound) {
+		env.Status = state.StatusProvisioning
+		if err := db.CreateEnvironment(env); err != nil {
+			return res, fmt.Errorf("failed to create environment record: %w", err)
+		}
+	} else if err != nil {
+		return res, fmt.Errorf("failed to get environment: %w", err)
+	}
+
+	fail := func(stage string, err error) (ProvisionResult, error) {
+		perr := &ProvisionError{Stage: stage, Err: err}
+		env.Status = state.StatusFailed
+		_ = db.UpdateEnvironment(env)
+		_ = metrics.IncCounter(db, metrics.EnvironmentFailures, "backend", env.Backend, "stage", stage)
+		captureDiagnostics(ctx, db, env, perr.Error())
+		notify(ctx, hooks.EventFailed, env)
+		return res, clierr.Backend(perr)
+	}
+
+	if !exists {
+		if baker, ok := spec.Backend.(backend.ImageBaker); ok && needsImage(spec.Config) {
+			imageID, err := ensureImage(ctx, db, env.Backend, baker, spec.Config)
+			if err != nil {
+				return fail(StageImage, err)
+			}
+			spec.Config.Image = imageID
+		}
+
+		backendID, err := spec.Backend.Create(ctx, spec.Config)
+		if err != nil {
+			return fail(StageCreate, err)
+		}
+		res.Created = true
+
+		env.BackendID = backendID
+		if err := db.UpdateEnvironment(env); err != nil {
+			// The record can't point at the workspace, so remove both
+			_ = spec.Backend.Destroy(ctx, backendID)
+			_ = db.DeleteEnvironment(env.ID)
+			return res, fmt.Errorf("failed to update environment record: %w", err)
+		}
+		if err := fault.AfterCreate(); err != nil {
+			return fail(StageCreate, err)
+		}
+	}
+
+	cfg := spec.Config
+	if spec.CloneFrom != "" && !spec.SkipSetup {
+		if c, ok := spec.Backend.(backend.SetupCopier); ok {
+			if err := c.CopySetup(ctx, spec.CloneFrom, env.BackendID, cfg.Files); err != nil {
+				return fail(StageSetup, fmt.Errorf("failed to copy setup from %s: %w", spec.CloneFrom, err))
+			}
+			cfg = withoutCopiedSetup(cfg)
+		}
+	}
+
+	if !spec.SkipSetup && hasSetupWork(cfg) {
+		setupEnv, err := withCacheEnv(cfg.Cache, cfg.Environment)
+		if err != nil {
+			return fail(StageSetup, err)
+		}
+
+		runner := spec.Backend.NewSetupRunner(env.BackendID)
+		setupCfg := &backend.SetupConfig{
+			Environment:   setupEnv,
+			Files:         cfg.Files,
+			GitIdentity:   cfg.GitIdentity,
+			Ignore:        cfg.Ignore,
+			TaskFile:      cfg.TaskFile,
+			Tools:         cfg.Tools,
+			SetupCommands: cfg.SetupCommands,
+			SetupWrapper:  cfg.SetupWrapper,
+			PreDestroy:    cfg.PreDestroy,
+			Journal:       &dbJournal{db: db, envID: env.ID},
+			Quiet:         msg.Quiet(),
+		}
+		if cfg.CommitTrailer {
+			setupCfg.CommitTrailer = env.ID
+		}
+		// Journal this attempt from a clean slate
+		if err := db.DeleteSetupSteps(env.ID); err != nil {
+			fmt.Fprintf(os.Stderr, "warning: %v\n", err)
+		}
+		// Log setup output so env attach --wait can follow it
+		if log, err := createSetupLog(env.ID); err != nil {
+			fmt.Fprintf(os.Stderr, "warning: failed to create setup log: %v\n", err)
+		} else {
+			defer log.Close()
+			setupCfg.Log = log
+		}
+		started := time.Now()
+		res.Setup, err = runner.Run(ctx, setupCfg)
+		res.SetupDuration = time.Since(started)
+		_ = metrics.ObserveDuration(db, metrics.SetupDuration, res.SetupDuration, "backend", env.Backend)
+		recordSetupCommands(db, env, res.Setup)
+		if err != nil {
+			return fail(StageSetup, err)
+		}
+	} else if spec.SkipSetup && spec.Config.TaskFile != "" {
+		// The task file is written even without setup, since it's what
+		// an agent works from
+		runner := spec.Backend.NewSetupRunner(env.BackendID)
+		if _, err := runner.Run(ctx, &backend.SetupConfig{TaskFile: spec.Config.TaskFile}); err != nil {
+			return fail(StageSetup, err)
+		}
+	}
+
+	env.Status = state.StatusReady
+	if err := db.UpdateEnvironment(env); err != nil {
+		return res, fmt.Errorf("failed to update environment status: %w", err)
+	}
+	forwardConfiguredPorts(ctx, db, spec.Backend, env, spec.Config.Ports)
+	_ = metrics.IncCounter(db, metrics.EnvironmentsCreated, "backend", env.Backend)
+	_ = metrics.ObserveDuration(db, metrics.ProvisionDuration, time.Since(provisionStarted), "backend", env.Backend)
+	// A pooled environment is ready for use once env create takes it
+	if !env.Pooled {
+		notify(ctx, hooks.EventReady, env)
+	}
+	return res, nil
+}
+
+// recordSetupCommands adds the setup commands in result to env's command
+// history, so env history can show their exit codes and output.
+func recordSetupCommands(db *state.DB, env *state.Environment, result *backend.SetupResult) {
+	if result == nil {
+		return
+	}
+	for _, c := range result.Commands {
+		rec := &state.CommandRecord{
+			EnvironmentID: env.ID,
+			Source:        state.SourceSetup,
+			Command:       c.Command,
+			ExitCode:      c.ExitCode,
+			StartedAt:     c.StartedAt,
+			Duration:      c.Duration,
+			Output:        c.Output,
+		}
+		if err := db.RecordCommand(rec); err != nil {
+			fmt.Fprintf(os.Stderr, "warning: failed to record command history: %v\n", err)
+			return
+		}
+	}
+}
+
+// withoutCopiedSetup returns a copy of cfg without the setup that
+// backend.SetupCopier copies from the workspace being cloned: environment
+// variables (and the cache variables among them), file mounts, the task
+// file, tools, and setup commands. What remains configures git in the new
+// workspace and records its teardown.
+func withoutCopiedSetup(cfg *config.CreateConfig) *config.CreateConfig {
+	c := *cfg
+	c.Environment = nil
+	c.Files = nil
+	c.Cache = nil
+	c.TaskFile = ""
+	c.Tools = config.ToolsConfig{}
+	c.SetupCommands = nil
+	return &c
+}
+
+// hasSetupWork reports whether cfg has anything for a setup runner to do:
+// environment variables, file mounts, caches, a git identity, commit
+// trailer, or ignore patterns, a task file, tools, or setup commands.
+func hasSetupWork(cfg *config.CreateConfig) bool {
+	return len(cfg.SetupCommands) > 0 ||
+		len(cfg.PreDestroy) > 0 ||
+		cfg.TaskFile != "" ||
+		cfg.CommitTrailer ||
+		len(cfg.Ignore) > 0 ||
+		!cfg.GitIdentity.IsZero() ||
+		cfg.Tools.Provisioner != "" ||
+		len(cfg.Files) > 0 ||
+		len(cfg.Environment) > 0 ||
+		len(cfg.Cache) > 0
+}
+
+// RemoveOptions control RemoveEnvironment.
+type RemoveOptions struct {
+	// Force removes the environment even if its workspace has unpushed
+	// commits. Set it only once the user has confirmed or asked for that.
+	Force bool
+
+	// NoBackup skips saving the workspace's uncommitted and unpushed work
+	// to the trash before destroying it.
+	NoBackup bool
+}
+
+// RemoveEnvironment converges env to absent: it stops its agent and port
+// forwards and destroys its workspace if one still exists, deletes its
+// record, command history, setup journal, diagnostics, agent runs, port
+// forwards, and setup log, releases its name, and fires the removed hooks.
+// Failures to destroy the workspace or release the name are reported as
+// warnings so a broken workspace never leaves an undeletable record behind,
+// with one exception: unless opts.Force is set, a workspace with unpushed
+// commits fails the removal (see backend.SafeDestroyer) and env is kept.
+// Removing an environment that is already gone succeeds.
+func RemoveEnvironment(ctx context.Context, db *state.DB, env *state.Environment, opts RemoveOptions) error {
+	// If environment has a backendID, destroy the worktree
+	if env.BackendID != "" {
+		be, err := getBackend(env.Backend, "")
+		if err != nil {
+			return err
+		}
+
+		exists, err := workspaceExists(ctx, be, env)
+		if err == nil && exists {
+			stopActivity(ctx, db, be, env)
+			err = destroyWorkspace(ctx, be, env.BackendID, opts)
+		}
+		if errors.Is(err, backend.ErrUnpushedWork) {
+			return fmt.Errorf("%w; push them, or remove it anyway with \"choir env rm --force\"", err)
+		}
+		if err != nil {
+			// Log the error but continue to delete the environment record
+			fmt.Fprintf(os.Stderr, "warning: failed to destroy worktree: %v\n", err)
+		}
+	}
+
+	// Delete the setup log, then the environment's record along with its
+	// command history, setup journal, diagnostics, agent runs, and port
+	// forwards
+	if err := removeSetupLog(env.ID); err != nil {
+		fmt.Fprintf(os.Stderr, "warning: failed to remove setup log: %v\n", err)
+	}
+	if err := db.PurgeEnvironment(env.ID); err != nil && !errors.Is(err, state.ErrEnvironmentNotFound) {
+		return fmt.Errorf("failed to delete environment record: %w", err)
+	}
+
+	// Free the name for allocators that track reservations
+	if err := releaseName(ctx, env); err != nil {
+		fmt.Fprintf(os.Stderr, "warning: failed to release environment name: %v\n", err)
+	}
+	notify(ctx, hooks.EventRemoved, env)
+	return nil
+}
+
+// stopActivity stops env's agent and port forwards, so nothing keeps
+// running in a workspace that is going away. Failures are warnings.
+func stopActivity(ctx context.Context, db *state.DB, be backend.Backend, env *state.Environment) {
+	if _, err := stopAgent(ctx, db, be, env); err != nil {
+		fmt.Fprintf(os.Stderr, "warning: %v\n", err)
+	}
+	if _, err := stopPortForwards(ctx, db, be, env, nil); err != nil {
+		fmt.Fprintf(os.Stderr, "warning: %v\n", err)
+	}
+}
+
+// TrashEnvironment removes env restorably: it stops its agent and port
+// forwards, moves its workspace to the trash (see backend.Trasher), and
+// marks it removed, keeping its record and history until PurgeTrash
+// destroys it or RestoreEnvironment brings it back. It reports whether env
+// was trashed. Environments already removed, without a workspace, on a
+// backend that can't trash workspaces, or removed while trash_retention is
+// 0 are removed for good with RemoveEnvironment and opts instead.
+func TrashEnvironment(ctx context.Context, db *state.DB, env *state.Environment, opts RemoveOptions) (bool, error) {
+	retention, err := trashRetention()
+	if err != nil {
+		return false, err
+	}
+	if env.Status == state.StatusRemoved || env.BackendID == "" || retention == 0 {
+		return false, RemoveEnvironment(ctx, db, env, opts)
+	}
+	be, err := getBackend(env.Backend, "")
+	if err != nil {
+		return false, err
+	}
+	trasher, ok := be.(backend.Trasher)
+	if exists, err := workspaceExists(ctx, be, env); !ok || err != nil || !exists {
+		return false, RemoveEnvironment(ctx, db, env, opts)
+	}
+
+	stopActivity(ctx, db, be, env)
+	backendID, err := trasher.Trash(ctx, env.BackendID)
+	if err != nil {
+		return false, clierr.Backend(fmt.Errorf("failed to move workspace to the trash: %w", err))
+	}
+	env.BackendID = backendID
+	env.Status = state.StatusRemoved
+	env.RemovedAt = time.Now()
+	if err := db.UpdateEnvironment(env); err != nil {
+		return false, fmt.Errorf("failed to update status (workspace moved to %s): %w", backendID, err)
+	}
+	notify(ctx, hooks.EventRemoved, env)
+	return true, nil
+}
+
+// RestoreEnvironment moves the workspace of env, removed by
+// TrashEnvironment, back out of the trash. env's status is then what its
+// backend reports: ready if the workspace is running, else stopped, or
+// failed if it is in neither state.
+func RestoreEnvironment(ctx context.Context, db *state.DB, env *state.Environment) error {
+	shortID := state.ShortID(env.ID)
+	if env.Status != state.StatusRemoved {
+		return clierr.Validation(fmt.Errorf("environment %s is %s, not removed", shortID, env.Status))
+	}
+	be, err := getBackend(env.Backend, "")
+	if err != nil {
+		return err
+	}
+	trasher, ok := be.(backend.Trasher)
+	if !ok {
+		return clierr.Validation(fmt.Errorf("environment %s can't be restored: the %s backend has no trash", shortID, env.Backend))
+	}
+	exists, err := workspaceExists(ctx, be, env)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return clierr.NotFound(fmt.Errorf("environment %s can't be restored: its workspace is gone", shortID))
+	}
+
+	backendID, err := trasher.Untrash(ctx, env.BackendID)
+	if err != nil {
+		return clierr.Backend(fmt.Errorf("failed to restore workspace: %w", err))
+	}
+	env.BackendID = backendID
+	env.RemovedAt = time.Time{}
+	env.Status = state.StatusFailed
+	if status, err := be.Status(ctx, backendID); err == nil {
+		switch status.State {
+		case backend.StateRunning:
+			env.Status = state.StatusReady
+		case backend.StateStopped:
+			env.Status = state.StatusStopped
+		}
+	}
+	if err := db.UpdateEnvironment(env); err != nil {
+		return fmt.Errorf("failed to update status (workspace restored to %s): %w", backendID, err)
+	}
+	return nil
+}
+
+// trashRetention returns how long removed environments stay in the trash.
+func trashRetention() (time.Duration, error) {
+	global, err := config.LoadGlobalConfig()
+	if err != nil {
+		return 0, fmt.Errorf("failed to load config: %w", err)
+	}
+	retention, err := config.ParseTrashRetention(global.TrashRetention)
+	if err != nil {
+		return 0, clierr.Validation(fmt.Errorf("trash_retention: %w", err))
+	}
+	return retention, nil
+}
+
+// TrashedBefore returns the environments in the trash that were removed
+// longer than trash_retention before now, oldest first.
+func TrashedBefore(db *state.DB, now time.Time) ([]*state.Environment, error) {
+	retention, err := trashRetention()
+	if err != nil {
+		return nil, err
+	}
+	envs, err := db.ListEnvironments(state.ListOptions{
+		Statuses:      []state.EnvironmentStatus{state.StatusRemoved},
+		RemovedBefore: now.Add(-retention),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list environments: %w", err)
+	}
+	slices.Reverse(envs)
+	return envs, nil
+}
+
+// PurgeTrash removes for good every environment TrashedBefore returns,
+// backing up any pending work in their workspaces to the trash. Environments
+// that fail to be purged are skipped and reported in the returned error. It
+// returns the environments it purged.
+func PurgeTrash(ctx context.Context, db *state.DB, now time.Time) ([]*state.Environment, error) {
+	due, err := TrashedBefore(db, now)
+	if err != nil {
+		return nil, err
+	}
+
+	var purged []*state.Environment
+	var errs []error
+	for _, env := range due {
+		// Removing the environment was confirmed when it was trashed
+		if err := RemoveEnvironment(ctx, db, env, RemoveOptions{Force: true}); err != nil {
+			errs = append(errs, fmt.Errorf("failed to purge %s: %w", state.ShortID(env.ID), err))
+			continue
+		}
+		purged = append(purged, env)
+	}
+	return purged, errors.Join(errs...)
+}
+
+// destroyWorkspace destroys the workspace backendID with be, checking for
+// unpushed work and backing it up as opts ask if be supports that.
+func destroyWorkspace(ctx context.Context, be backend.Backend, backendID string, opts RemoveOptions) error {
+	safe, ok := be.(backend.SafeDestroyer)
+	if !ok {
+		return be.Destroy(ctx, backendID)
+	}
+	return safe.DestroyWithOptions(ctx, backendID, backend.DestroyOptions{Force: opts.Force, Backup: !opts.NoBackup})
+}
+
+// workspaceExists reports whether env's workspace exists according to be.
+func workspaceExists(ctx context.Context, be backend.Backend, env *state.Environment) (bool, error) {
+	if env.BackendID == "" {
+		return false, nil
+	}
+	status, err := be.Status(ctx, env.BackendID)
+	if err != nil {
+		return false, fmt.Errorf("failed to get workspace status: %w", err)
+	}
+	return status.State != backend.StateNotFound, nil
+}
+
+// Action is what Reconcile did to an environment.
+type Action string
+
+const (
+	ActionNone         Action = ""
+	ActionRemoved      Action = "removed"
+	ActionMarkedFailed Action = "marked failed"
+	ActionAgentCrashed Action = "agent crashed"
+)
+
+// Reconcile converges one existing environment toward the state its record
+// implies:
+//   - expired environments are removed (see RemoveEnvironment), unless
+//     their workspace has unpushed commits or they are in the trash already
+//   - ready or stopped environments whose workspace has disappeared are
+//     marked failed
+//   - environments provisioning for longer than StaleProvisioningAfter,
+//     whose creator presumably crashed, are marked failed, unless they
+//     are still waiting in the provision queue
+//   - ready environments whose agent is recorded as running but whose
+//     process is gone have the agent's crash recorded
+//
+// Anything else is left alone.
+func Reconcile(ctx context.Context, db *state.DB, env *state.Environment, now time.Time) (Action, error) {
+	action, reason, err := reconcileCheck(ctx, db, env, now)
+	if err != nil || action != ActionMarkedFailed {
+		return action, err
+	}
+	if err := markFailed(ctx, db, []*state.Environment{env}, map[string]string{env.ID: reason})[env.ID]; err != nil {
+		return ActionNone, err
+	}
+	return ActionMarkedFailed, nil
+}
+
+// reconcileCheck does what Reconcile does, except that an environment to be
+// marked failed is left as it is, with ActionMarkedFailed and the reason
+// returned for the caller to mark it with others.
+func reconcileCheck(ctx context.Context, db *state.DB, env *state.Environment, now time.Time) (Action, string, error) {
+	if env.Expired(now) && env.Status != state.StatusRemoved {
+		if err := RemoveEnvironment(ctx, db, env, RemoveOptions{}); err != nil {
+			return ActionNone, "", err
+		}
+		return ActionRemoved, "", nil
+	}
+
+	var reason string
+	switch env.Status {
+	case state.StatusReady, state.StatusStopped:
+		be, err := getBackend(env.Backend, "")
+		if err != nil {
+			return ActionNone, "", err
+		}
+		exists, err := workspaceExists(ctx, be, env)
+		if err != nil || env.BackendID == "" {
+			return ActionNone, "", err
+		}
+		if exists {
+			action, err := reconcileAgent(ctx, db, be, env, now)
+			return action, "", err
+		}
+		reason = "workspace missing"
+	case state.StatusProvisioning:
+		if now.Sub(env.CreatedAt) < StaleProvisioningAfter || waitingToProvision(db, env.ID) {
+			return ActionNone, "", nil
+		}
+		reason = "provisioning never finished"
+	default:
+		return ActionNone, "", nil
+	}
+	return ActionMarkedFailed, reason, nil
+}
+
+// markFailed marks envs failed together (see transitionEnvironments), then
+// captures diagnostics for each with its reason in reasons and fires the
+// failed hooks. Environments that couldn't be marked are returned by ID with
+// the reason.
+func markFailed(ctx context.Context, db *state.DB, envs []*state.Environment, reasons map[string]string) map[string]error {
+	failed := transitionEnvironments(db, envs, state.StatusFailed)
+	for _, env := range envs {
+		if _, ok := failed[env.ID]; ok {
+			continue
+		}
+		captureDiagnostics(ctx, db, env, reasons[env.ID])
+		notify(ctx, hooks.EventFailed, env)
+	}
+	return failed
+}
+
+// reconcileAgent records the crash of env's agent if it is recorded as
+// running in a ready environment but its process is gone.
+func reconcileAgent(ctx context.Context, db *state.DB, be backend.Backend, env *state.Environment, now time.Time) (Action, error) {
+	if env.Status != state.StatusReady {
+		return ActionNone, nil
+	}
+	run, err := latestAgentRun(ctx, db, be, env)
+	if err != nil || run == nil || run.Status != state.AgentCrashed || run.Finished() {
+		return ActionNone, err
+	}
+	if err := db.FinishAgentRun(run.ID, now, -1); err != nil {
+		return ActionNone, err
+	}
+	return ActionAgentCrashed, nil
+}
+
+// ReconcileAll reconciles every environment, as Reconcile does, marking
+// those found failed together rather than one at a time. Environments that
+// fail to reconcile are skipped and reported in the returned error. The
+// callback, if non-nil, is called for each environment it changed.
+func ReconcileAll(ctx context.Context, db *state.DB, now time.Time, changed func(*state.Environment, Action)) error {
+	envs, err := db.ListEnvironments(state.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to list environments: %w", err)
+	}
+
+	var errs []error
+	var failing []*state.Environment
+	reasons := make(map[string]string)
+	for _, env := range envs {
+		action, reason, err := reconcileCheck(ctx, db, env, now)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", state.ShortID(env.ID), err))
+			continue
+		}
+		if action == ActionMarkedFailed {
+			failing = append(failing, env)
+			reasons[env.ID] = reason
+			continue
+		}
+		if action != ActionNone && changed != nil {
+			changed(env, action)
+		}
+	}
+
+	failed := markFailed(ctx, db, failing, reasons)
+	for _, env := range failing {
+		if err, ok := failed[env.ID]; ok {
+			errs = append(errs, fmt.Errorf("%s: %w", state.ShortID(env.ID), err))
+			continue
+		}
+		if changed != nil {
+			changed(env, ActionMarkedFailed)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// RemoveExpired removes every environment whose TTL expired at or before
+// now, with opts. Environments that fail to be removed, including ones with
+// unpushed commits unless opts.Force is set, are skipped and reported in the
+// returned error. It returns the environments it removed.
+func RemoveExpired(ctx context.Context, db *state.DB, now time.Time, opts RemoveOptions) ([]*state.Environment, error) {
+	expired, err := db.ListEnvironments(state.ListOptions{ExpiredBefore: now})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list environments: %w", err)
+	}
+
+	var removed []*state.Environment
+	var errs []error
+	for _, env := range expired {
+		if env.Status == state.StatusRemoved {
+			continue // Purged by PurgeTrash instead
+		}
+		if err := RemoveEnvironment(ctx, db, env, opts); err != nil {
+			errs = append(errs, fmt.Errorf("failed to remove %s: %w", state.ShortID(env.ID), err))
+			continue
+		}
+		removed = append(removed, env)
+	}
+	return removed, errors.Join(errs...)
+}
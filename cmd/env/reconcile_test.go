@@ -0,0 +1,360 @@
+package env
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Quidge/choir/internal/backend"
+	"github.com/Quidge/choir/internal/backend/fake"
+	"github.com/Quidge/choir/internal/config"
+	"github.com/Quidge/choir/internal/fault"
+	"github.com/Quidge/choir/internal/state"
+)
+
+func openReconcileDB(t *testing.T) *state.DB {
+	t.Helper()
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	db, err := state.Open(":memory:")
+	if err != nil {
+		t.Fatalf("failed to open test database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func newTestEnv(id string) *state.Environment {
+	return &state.Environment{
+		ID:         id,
+		Backend:    "local",
+		RepoPath:   "/test",
+		BranchName: "env/" + state.ShortID(id),
+		BaseBranch: "main",
+		CreatedAt:  time.Now(),
+	}
+}
+
+func TestProvision(t *testing.T) {
+	db := openReconcileDB(t)
+	ctx := context.Background()
+	be := fake.New()
+	spec := ProvisionSpec{
+		Backend: be,
+		Config:  &config.CreateConfig{SetupCommands: []string{"true"}},
+	}
+
+	env := newTestEnv("aaaa0000000000000000000000000000")
+	res, err := Provision(ctx, db, env, spec)
+	if err != nil {
+		t.Fatalf("Provision() failed: %v", err)
+	}
+	if !res.Created || env.Status != state.StatusReady || env.BackendID == "" {
+		t.Fatalf("Provision() = %+v, env %+v; want created and ready", res, env)
+	}
+
+	// Calling again for a ready environment is a no-op
+	backendID := env.BackendID
+	res, err = Provision(ctx, db, env, spec)
+	if err != nil || res.Created || env.BackendID != backendID {
+		t.Errorf("second Provision() = %+v, %v; want no-op", res, err)
+	}
+	if ids, _ := be.List(ctx); len(ids) != 1 {
+		t.Errorf("backend has %d workspaces, want 1", len(ids))
+	}
+
+	// After a crash during setup, provisioning reuses the workspace
+	env.Status = state.StatusProvisioning
+	if err := db.UpdateEnvironment(env); err != nil {
+		t.Fatal(err)
+	}
+	res, err = Provision(ctx, db, env, spec)
+	if err != nil || res.Created || env.Status != state.StatusReady {
+		t.Errorf("recovering Provision() = %+v, %v; want setup rerun on existing workspace", res, err)
+	}
+
+	// Failures mark the environment failed and name the stage
+	be.Fault = func(op fake.Op, _ string) error {
+		if op == fake.OpSetup {
+			return fake.ErrInjected
+		}
+		return nil
+	}
+	failing := newTestEnv("bbbb0000000000000000000000000000")
+	_, err = Provision(ctx, db, failing, spec)
+	var perr *ProvisionError
+	if !errors.As(err, &perr) || perr.Stage != StageSetup || !errors.Is(err, fake.ErrInjected) {
+		t.Fatalf("Provision() error = %v, want setup ProvisionError", err)
+	}
+	got, err := db.GetEnvironment(failing.ID)
+	if err != nil || got.Status != state.StatusFailed || got.BackendID == "" {
+		t.Errorf("failed environment = %+v, %v; want failed with workspace kept", got, err)
+	}
+	d, err := db.GetDiagnostics(failing.ID)
+	if err != nil || !strings.Contains(d.Bundle, "setup failed") {
+		t.Errorf("GetDiagnostics() = %+v, %v; want a bundle naming the setup failure", d, err)
+	}
+}
+
+func TestProvision_AfterCreateFault(t *testing.T) {
+	db := openReconcileDB(t)
+	ctx := context.Background()
+	if err := fault.Configure("after-create"); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = fault.Configure("") })
+
+	env := newTestEnv("cccc0000000000000000000000000000")
+	_, err := Provision(ctx, db, env, ProvisionSpec{Backend: fake.New(), Config: &config.CreateConfig{}})
+	var perr *ProvisionError
+	if !errors.As(err, &perr) || perr.Stage != StageCreate || !errors.Is(err, fault.ErrInjected) {
+		t.Fatalf("Provision() error = %v, want injected create ProvisionError", err)
+	}
+	got, err := db.GetEnvironment(env.ID)
+	if err != nil || got.Status != state.StatusFailed || got.BackendID == "" {
+		t.Errorf("environment = %+v, %v; want failed with workspace recorded", got, err)
+	}
+}
+
+func TestProvision_BakesImageOnce(t *testing.T) {
+	db := openReconcileDB(t)
+	ctx := context.Background()
+	be := fake.New()
+	provision := func(id string, packages ...string) *state.Environment {
+		t.Helper()
+		env := newTestEnv(id)
+		cfg := &config.CreateConfig{BaseImage: "ubuntu:24.04", Packages: packages}
+		if _, err := Provision(ctx, db, env, ProvisionSpec{Backend: be, Config: cfg}); err != nil {
+			t.Fatalf("Provision() failed: %v", err)
+		}
+		return env
+	}
+
+	first := provision("dddd0000000000000000000000000000", "git", "jq")
+	second := provision("eeee0000000000000000000000000000", "jq", "git")
+	if be.Images() != 1 {
+		t.Fatalf("backend has %d images, want 1 shared by both environments", be.Images())
+	}
+	image := be.ClonedFrom(first.BackendID)
+	if image == "" || be.ClonedFrom(second.BackendID) != image {
+		t.Errorf("workspaces cloned from %q and %q, want the same image", image, be.ClonedFrom(second.BackendID))
+	}
+
+	provision("ffff0000000000000000000000000000", "git")
+	if be.Images() != 2 {
+		t.Errorf("backend has %d images, want another for different packages", be.Images())
+	}
+	images, err := db.ListImages()
+	if err != nil || len(images) != 2 {
+		t.Errorf("ListImages() = %v, %v; want 2 recorded", images, err)
+	}
+
+	// Bake failures fail the environment at the image stage
+	be.Fault = func(op fake.Op, _ string) error {
+		if op == fake.OpBake {
+			return fake.ErrInjected
+		}
+		return nil
+	}
+	env := newTestEnv("abcd0000000000000000000000000000")
+	_, err = Provision(ctx, db, env, ProvisionSpec{Backend: be, Config: &config.CreateConfig{Packages: []string{"make"}}})
+	var perr *ProvisionError
+	if !errors.As(err, &perr) || perr.Stage != StageImage {
+		t.Errorf("Provision() error = %v, want image ProvisionError", err)
+	}
+}
+
+func TestReconcile(t *testing.T) {
+	db := openReconcileDB(t)
+	ctx := context.Background()
+	now := time.Now()
+	live := t.TempDir()
+
+	mk := func(id string, status state.EnvironmentStatus, backendID string) *state.Environment {
+		env := newTestEnv(id)
+		env.Status = status
+		env.BackendID = backendID
+		return env
+	}
+	envs := map[string]*state.Environment{
+		"live":    mk("aaaa0000000000000000000000000000", state.StatusReady, live),
+		"missing": mk("bbbb0000000000000000000000000000", state.StatusReady, filepath.Join(live, "gone")),
+		"expired": mk("cccc0000000000000000000000000000", state.StatusReady, ""),
+		"fresh":   mk("dddd0000000000000000000000000000", state.StatusProvisioning, ""),
+		"stale":   mk("eeee0000000000000000000000000000", state.StatusProvisioning, ""),
+		"crashed": mk("ffff0000000000000000000000000000", state.StatusReady, live),
+	}
+	envs["expired"].ExpiresAt = now.Add(-time.Minute)
+	envs["stale"].CreatedAt = now.Add(-2 * StaleProvisioningAfter)
+	want := map[string]Action{
+		"live":    ActionNone,
+		"missing": ActionMarkedFailed,
+		"expired": ActionRemoved,
+		"fresh":   ActionNone,
+		"stale":   ActionMarkedFailed,
+		"crashed": ActionAgentCrashed,
+	}
+	for _, env := range envs {
+		if err := db.CreateEnvironment(env); err != nil {
+			t.Fatalf("failed to create environment: %v", err)
+		}
+	}
+
+	// The live environment's agent is this process; the crashed one's has
+	// exited without its run being finished
+	dead := exec.Command("true")
+	if err := dead.Run(); err != nil {
+		t.Fatal(err)
+	}
+	for name, pid := range map[string]int{"live": os.Getpid(), "crashed": dead.Process.Pid} {
+		run := &state.AgentRun{EnvironmentID: envs[name].ID, Command: "agent", ProcessID: strconv.Itoa(pid), StartedAt: now}
+		if err := db.StartAgentRun(run); err != nil {
+			t.Fatalf("StartAgentRun() failed: %v", err)
+		}
+	}
+
+	got := make(map[string]Action)
+	err := ReconcileAll(ctx, db, now, func(env *state.Environment, action Action) {
+		for name, e := range envs {
+			if e.ID == env.ID {
+				got[name] = action
+			}
+		}
+	})
+	if err != nil {
+		t.Fatalf("ReconcileAll() failed: %v", err)
+	}
+	for name, action := range want {
+		if got[name] != action {
+			t.Errorf("%s: action = %q, want %q", name, got[name], action)
+		}
+	}
+	for _, name := range []string{"missing", "stale"} {
+		if env, err := db.GetEnvironment(envs[name].ID); err != nil || env.Status != state.StatusFailed {
+			t.Errorf("%s: recorded as %+v, %v; want failed", name, env, err)
+		}
+	}
+	if _, err := db.GetEnvironment(envs["expired"].ID); !errors.Is(err, state.ErrEnvironmentNotFound) {
+		t.Errorf("expired environment still recorded: %v", err)
+	}
+	if run, err := db.LatestAgentRun(envs["crashed"].ID); err != nil || run.Status != state.AgentCrashed || !run.Finished() {
+		t.Errorf("crashed agent run = %+v, %v; want finished as crashed", run, err)
+	}
+
+	// A second pass has nothing left to do
+	err = ReconcileAll(ctx, db, now, func(env *state.Environment, action Action) {
+		t.Errorf("second pass changed %s: %s", state.ShortID(env.ID), action)
+	})
+	if err != nil {
+		t.Fatalf("second ReconcileAll() failed: %v", err)
+	}
+}
+
+func TestRecordSetupCommands(t *testing.T) {
+	db := openReconcileDB(t)
+	env := newTestEnv("aaaa0000000000000000000000000000")
+
+	recordSetupCommands(db, env, &backend.SetupResult{Commands: []backend.CommandResult{
+		{Command: "npm ci", ExitCode: 0, StartedAt: time.Now(), Duration: time.Second, Output: "added 12 packages\n"},
+		{Command: "npm test", ExitCode: 1, StartedAt: time.Now(), Output: "1 failing\n"},
+	}})
+
+	cmds, err := db.ListCommands(state.CommandListOptions{
+		EnvironmentID: env.ID,
+		Sources:       []state.CommandSource{state.SourceSetup},
+	})
+	if err != nil {
+		t.Fatalf("ListCommands() failed: %v", err)
+	}
+	if len(cmds) != 2 || cmds[1].Command != "npm test" || cmds[1].ExitCode != 1 || cmds[1].Output != "1 failing\n" {
+		t.Errorf("setup history = %+v, want both commands with exit codes and output", cmds)
+	}
+}
+
+func TestTrashEnvironment(t *testing.T) {
+	db := openReconcileDB(t)
+	ctx := context.Background()
+	now := time.Now()
+
+	repo := t.TempDir()
+	for _, args := range [][]string{
+		{"init", "-q"},
+		{"-c", "user.name=Test", "-c", "user.email=test@example.com", "commit", "-q", "--allow-empty", "-m", "init"},
+	} {
+		if out, err := exec.Command("git", append([]string{"-C", repo}, args...)...).CombinedOutput(); err != nil {
+			t.Fatalf("git %v failed: %v\n%s", args, err, out)
+		}
+	}
+	be, err := getBackend("local", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	env := newTestEnv("abab0000000000000000000000000000")
+	env.RepoPath = repo
+	env.Status = state.StatusReady
+	env.BackendID, err = be.Create(ctx, &config.CreateConfig{
+		ID:         env.ID,
+		Repository: config.RepositoryInfo{Path: repo, BaseBranch: "HEAD"},
+	})
+	if err != nil {
+		t.Fatalf("Create() failed: %v", err)
+	}
+	if err := db.CreateEnvironment(env); err != nil {
+		t.Fatal(err)
+	}
+	workspace := env.BackendID
+	if err := os.WriteFile(filepath.Join(workspace, "work.txt"), []byte("agent output"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	trashed, err := TrashEnvironment(ctx, db, env, RemoveOptions{})
+	if err != nil || !trashed {
+		t.Fatalf("TrashEnvironment() = %v, %v; want trashed", trashed, err)
+	}
+	got, err := db.GetEnvironment(env.ID)
+	if err != nil || got.Status != state.StatusRemoved || got.RemovedAt.IsZero() || got.BackendID == workspace {
+		t.Fatalf("trashed environment = %+v, %v; want removed with its workspace moved", got, err)
+	}
+	if _, err := os.Stat(workspace); !os.IsNotExist(err) {
+		t.Errorf("workspace still at %s", workspace)
+	}
+
+	// Not due for purging yet
+	if purged, err := PurgeTrash(ctx, db, now); err != nil || len(purged) != 0 {
+		t.Errorf("PurgeTrash() = %v, %v; want nothing purged", purged, err)
+	}
+
+	if err := RestoreEnvironment(ctx, db, got); err != nil {
+		t.Fatalf("RestoreEnvironment() failed: %v", err)
+	}
+	got, err = db.GetEnvironment(env.ID)
+	if err != nil || got.Status != state.StatusReady || !got.RemovedAt.IsZero() || got.BackendID != workspace {
+		t.Fatalf("restored environment = %+v, %v; want ready at %s", got, err, workspace)
+	}
+	if data, err := os.ReadFile(filepath.Join(workspace, "work.txt")); err != nil || string(data) != "agent output" {
+		t.Errorf("restored work.txt = %q, %v", data, err)
+	}
+	if err := RestoreEnvironment(ctx, db, got); err == nil {
+		t.Error("RestoreEnvironment() succeeded for an environment that isn't removed")
+	}
+
+	if _, err := TrashEnvironment(ctx, db, got, RemoveOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	purged, err := PurgeTrash(ctx, db, now.Add(config.DefaultTrashRetention+time.Hour))
+	if err != nil || len(purged) != 1 {
+		t.Fatalf("PurgeTrash() after retention = %v, %v; want one purged", purged, err)
+	}
+	if _, err := db.GetEnvironment(env.ID); !errors.Is(err, state.ErrEnvironmentNotFound) {
+		t.Errorf("purged environment still recorded: %v", err)
+	}
+	if _, err := os.Stat(got.BackendID); !os.IsNotExist(err) {
+		t.Errorf("purged workspace still at %s", got.BackendID)
+	}
+}
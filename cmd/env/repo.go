@@ -0,0 +1,186 @@
+package env
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/Quidge/choir/internal/config"
+	"github.com/Quidge/choir/internal/gitutil"
+	"github.com/Quidge/choir/internal/msg"
+	"github.com/Quidge/choir/internal/pathutil"
+	"github.com/Quidge/choir/internal/repocache"
+	"github.com/Quidge/choir/internal/state"
+)
+
+// unsafeRepoPathChars matches characters not allowed in managed clone paths.
+var unsafeRepoPathChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// openRepoCache returns the repo metadata cache (see package repocache) and
+// a function that closes it. The state database is opened read-only, so
+// commands that only read it never migrate it; lookups still hit the cache
+// but misses aren't stored. Commands that already hold a read-write
+// database should use repocache.New with it instead. If caching is disabled
+// or the database can't be opened, lookups run git directly.
+func openRepoCache() (*repocache.Cache, func()) {
+	if repocache.Disabled() {
+		return repocache.New(nil), func() {}
+	}
+	db, err := state.OpenReadOnly("")
+	if err != nil {
+		return repocache.New(nil), func() {}
+	}
+	return repocache.New(db), func() { db.Close() }
+}
+
+// resolveRepo returns the repository root to create an environment from.
+//
+// spec is the --repo flag: empty means the repository containing the current
+// directory, a remote URL is cloned into (or updated in) a managed location,
+// and anything else is treated as a local path. managed reports whether the
+// repository is a managed clone. A new managed clone is made with clone.
+func resolveRepo(repos *repocache.Cache, spec string, clone gitutil.CloneOptions) (repoRoot string, managed bool, err error) {
+	if spec == "" {
+		repoRoot, err = repos.RepoRoot("")
+		if err != nil {
+			return "", false, fmt.Errorf("not in a git repository (use --repo to choose one): %w", err)
+		}
+		return repoRoot, false, nil
+	}
+
+	if gitutil.IsRemoteURL(spec) {
+		repoRoot, err = ensureManagedClone(spec, clone)
+		return repoRoot, true, err
+	}
+
+	path, err := config.ExpandPath(spec)
+	if err != nil {
+		return "", false, err
+	}
+	path, err = filepath.Abs(path)
+	if err != nil {
+		return "", false, fmt.Errorf("failed to resolve %s: %w", spec, err)
+	}
+	if !pathutil.ExistsAndIsDir(path) {
+		return "", false, fmt.Errorf("repository %s does not exist", spec)
+	}
+	repoRoot, err = repos.RepoRoot(path)
+	if err != nil {
+		return "", false, fmt.Errorf("%s is not a git repository: %w", spec, err)
+	}
+	return repoRoot, false, nil
+}
+
+// ensureManagedClone clones remoteURL into the managed repos directory with
+// opts, or fast-forwards an existing clone, and returns the clone's path.
+func ensureManagedClone(remoteURL string, opts gitutil.CloneOptions) (string, error) {
+	base, err := reposBasePath()
+	if err != nil {
+		return "", err
+	}
+	rel, err := managedClonePath(remoteURL)
+	if err != nil {
+		return "", err
+	}
+	dir := filepath.Join(base, rel)
+
+	if pathutil.ExistsAndIsDir(dir) {
+		origin, err := gitutil.RemoteURL(dir, "origin")
+		if err != nil {
+			return "", fmt.Errorf("managed clone %s is broken (remove it to re-clone): %w", dir, err)
+		}
+		if origin != remoteURL {
+			return "", fmt.Errorf("managed clone %s has origin %s, not %s", dir, origin, remoteURL)
+		}
+		if err := gitutil.WaitIdle(context.Background(), dir, gitutil.DefaultLockTimeout); err != nil {
+			return "", err
+		}
+		msg.Fprintf(os.Stderr, "Updating %s...\n", dir)
+		if err := gitutil.PullFastForward(dir); err != nil {
+			return "", err
+		}
+		return dir, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dir), 0755); err != nil {
+		return "", fmt.Errorf("failed to create repos directory: %w", err)
+	}
+	msg.Fprintf(os.Stderr, "Cloning %s into %s...\n", remoteURL, dir)
+	if err := gitutil.Clone(remoteURL, dir, opts); err != nil {
+		return "", err
+	}
+	return dir, nil
+}
+
+// cloneOptions returns how to clone a --repo URL: as the global config's
+// clone: section says, with depth and filter, if set, taking precedence.
+func cloneOptions(depth int, filter string) (gitutil.CloneOptions, error) {
+	global, err := config.LoadGlobalConfig()
+	if err != nil {
+		return gitutil.CloneOptions{}, fmt.Errorf("failed to load global config: %w", err)
+	}
+	clone := global.Clone
+	if depth != 0 {
+		clone.Depth = depth
+	}
+	if filter != "" {
+		clone.Filter = filter
+	}
+	if err := clone.Validate(); err != nil {
+		return gitutil.CloneOptions{}, err
+	}
+	return gitutil.CloneOptions{Depth: clone.Depth, Filter: clone.Filter}, nil
+}
+
+// managedClonePath maps a remote URL to a relative path such as
+// "github.com/user/repo", so each remote gets a stable clone location.
+func managedClonePath(remoteURL string) (string, error) {
+	var host, path string
+	if u, err := url.Parse(remoteURL); err == nil && u.Scheme != "" {
+		host, path = u.Hostname(), u.Path
+		if host == "" {
+			host = "local"
+		}
+	} else {
+		// scp-like syntax: [user@]host:path
+		hostPart, p, _ := strings.Cut(remoteURL, ":")
+		if at := strings.LastIndex(hostPart, "@"); at >= 0 {
+			hostPart = hostPart[at+1:]
+		}
+		host, path = hostPart, p
+	}
+
+	path = strings.TrimSuffix(strings.Trim(path, "/"), ".git")
+	parts := []string{unsafeRepoPathChars.ReplaceAllString(host, "_")}
+	for _, seg := range strings.Split(path, "/") {
+		seg = unsafeRepoPathChars.ReplaceAllString(seg, "_")
+		if seg == "" || seg == "." || seg == ".." {
+			continue
+		}
+		parts = append(parts, seg)
+	}
+	if len(parts) < 2 {
+		return "", fmt.Errorf("cannot determine repository name from %s", remoteURL)
+	}
+	return filepath.Join(parts...), nil
+}
+
+// reposBasePath returns the base directory for managed clones.
+// This follows the XDG Base Directory specification:
+// - Uses $XDG_DATA_HOME/choir/repos/ if XDG_DATA_HOME is set
+// - Falls back to ~/.local/share/choir/repos/
+func reposBasePath() (string, error) {
+	dataDir := os.Getenv("XDG_DATA_HOME")
+	if dataDir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("failed to get home directory: %w", err)
+		}
+		dataDir = filepath.Join(home, ".local", "share")
+	}
+	return filepath.Join(dataDir, "choir", "repos"), nil
+}
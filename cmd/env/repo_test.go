@@ -0,0 +1,133 @@
+package env
+
+import (
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/Quidge/choir/internal/repocache"
+	"github.com/Quidge/choir/internal/state"
+)
+
+func TestManagedClonePath(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{"https://github.com/user/repo.git", "github.com/user/repo", false},
+		{"ssh://git@github.com:22/user/repo", "github.com/user/repo", false},
+		{"git@github.com:user/repo.git", "github.com/user/repo", false},
+		{"file:///srv/git/repo.git", "local/srv/git/repo", false},
+		{"https://example.com/../../etc/passwd", "example.com/etc/passwd", false},
+		{"https://example.com/", "", true},
+	}
+	for _, tt := range tests {
+		got, err := managedClonePath(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("managedClonePath(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if got != filepath.FromSlash(tt.want) {
+			t.Errorf("managedClonePath(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestSelectRemote(t *testing.T) {
+	repo := t.TempDir()
+	for _, args := range [][]string{
+		{"init", "-q"},
+		{"remote", "add", "upstream", "https://example.com/upstream.git"},
+	} {
+		if out, err := exec.Command("git", append([]string{"-C", repo}, args...)...).CombinedOutput(); err != nil {
+			t.Fatalf("git %v failed: %v\n%s", args, err, out)
+		}
+	}
+	repos := repocache.New(nil)
+
+	// No origin: no remote, unless one is asked for
+	if name, url, err := selectRemote(repos, repo, ""); err != nil || name != "" || url != "" {
+		t.Errorf("selectRemote(\"\") = %q, %q, %v; want no remote", name, url, err)
+	}
+	if name, url, err := selectRemote(repos, repo, "upstream"); err != nil || name != "upstream" || url != "https://example.com/upstream.git" {
+		t.Errorf("selectRemote(upstream) = %q, %q, %v", name, url, err)
+	}
+	if _, _, err := selectRemote(repos, repo, "fork"); err == nil {
+		t.Error("selectRemote(fork) succeeded for a missing remote")
+	}
+
+	if out, err := exec.Command("git", "-C", repo, "remote", "add", "origin", "https://example.com/origin.git").CombinedOutput(); err != nil {
+		t.Fatalf("git remote add failed: %v\n%s", err, out)
+	}
+	if name, url, err := selectRemote(repos, repo, ""); err != nil || name != "origin" || url != "https://example.com/origin.git" {
+		t.Errorf("selectRemote(\"\") = %q, %q, %v; want origin", name, url, err)
+	}
+}
+
+func TestCheckFromBranch(t *testing.T) {
+	repo := t.TempDir()
+	for _, args := range [][]string{
+		{"init", "-q", "-b", "main"},
+		{"-c", "user.name=t", "-c", "user.email=t@example.com", "commit", "-q", "--allow-empty", "-m", "Initial"},
+		{"branch", "feature/x"},
+		{"remote", "add", "origin", "https://example.com/origin.git"},
+		{"update-ref", "refs/remotes/origin/feature/y", "HEAD"},
+	} {
+		if out, err := exec.Command("git", append([]string{"-C", repo}, args...)...).CombinedOutput(); err != nil {
+			t.Fatalf("git %v failed: %v\n%s", args, err, out)
+		}
+	}
+
+	if err := checkFromBranch(repo, "", "feature/x"); err != nil {
+		t.Errorf("checkFromBranch(feature/x) failed: %v", err)
+	}
+	// Only on the remote: tracked locally
+	if err := checkFromBranch(repo, "", "feature/y"); err != nil {
+		t.Errorf("checkFromBranch(feature/y) failed: %v", err)
+	}
+	if err := exec.Command("git", "-C", repo, "rev-parse", "--verify", "refs/heads/feature/y").Run(); err != nil {
+		t.Errorf("feature/y not tracked locally: %v", err)
+	}
+	if err := checkFromBranch(repo, "", "missing"); err == nil {
+		t.Error("checkFromBranch(missing) succeeded")
+	}
+	// Checked out in the repository itself
+	if err := checkFromBranch(repo, "", "main"); err == nil {
+		t.Error("checkFromBranch(main) succeeded for a checked-out branch")
+	}
+}
+
+func TestOpenRepoCacheReadOnly(t *testing.T) {
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	db, err := state.Open("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	repo := t.TempDir()
+	if out, err := exec.Command("git", "-C", repo, "init", "-q").CombinedOutput(); err != nil {
+		t.Fatalf("git init failed: %v\n%s", err, out)
+	}
+
+	// Lookups work, but read commands don't write the cache
+	repos, closeRepos := openRepoCache()
+	root, err := repos.RepoRoot(repo)
+	closeRepos()
+	if err != nil {
+		t.Fatalf("RepoRoot() failed: %v", err)
+	}
+	if want, _ := filepath.EvalSymlinks(repo); root != want {
+		t.Errorf("RepoRoot() = %q, want %q", root, want)
+	}
+
+	db, err = state.Open("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err := db.GetCacheEntry("root:" + repo); err == nil {
+		t.Error("openRepoCache() wrote a cache entry through a read-only database")
+	}
+}
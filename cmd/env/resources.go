@@ -0,0 +1,42 @@
+package env
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/Quidge/choir/internal/clierr"
+	"github.com/Quidge/choir/internal/config"
+	"github.com/Quidge/choir/internal/preflight"
+	"github.com/Quidge/choir/internal/state"
+)
+
+// heldStatuses are the statuses of environments whose workspaces hold
+// their CPUs and memory. Stopped environments give theirs back.
+var heldStatuses = []state.EnvironmentStatus{state.StatusProvisioning, state.StatusReady}
+
+// checkHostResources refuses an environment asking for res if it doesn't
+// fit on the host alongside the running environments recorded in db, and
+// prints a warning if it fits only by oversubscribing the host.
+func checkHostResources(ctx context.Context, db *state.DB, res config.ResourceLimits) error {
+	envs, err := db.ListEnvironments(state.ListOptions{Statuses: heldStatuses})
+	if err != nil {
+		return fmt.Errorf("failed to list environments: %w", err)
+	}
+	var inUse preflight.Allocation
+	for _, env := range envs {
+		inUse.CPUs += env.CPUs
+		inUse.Memory += env.Memory
+	}
+
+	want := preflight.Allocation{CPUs: res.CPUs, Memory: uint64(res.Memory)}
+	warnings, err := preflight.CheckHostResources(ctx, want, inUse)
+	if err != nil {
+		return clierr.Validation(fmt.Errorf("%w\nstop or remove other environments, lower resources: in %s, or use --ignore-resource-check",
+			err, config.ProjectConfigFilename))
+	}
+	for _, w := range warnings {
+		fmt.Fprintf(os.Stderr, "warning: %s\n", w)
+	}
+	return nil
+}
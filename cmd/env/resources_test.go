@@ -0,0 +1,45 @@
+package env
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/Quidge/choir/internal/config"
+	"github.com/Quidge/choir/internal/preflight"
+	"github.com/Quidge/choir/internal/state"
+)
+
+func TestCheckHostResources(t *testing.T) {
+	db := openReconcileDB(t)
+	ctx := context.Background()
+	total, _, err := preflight.Memory(ctx)
+	if err != nil {
+		t.Fatalf("Memory() failed: %v", err)
+	}
+	half := config.ByteSize(total / 2)
+
+	if err := checkHostResources(ctx, db, config.ResourceLimits{CPUs: 1, Memory: half}); err != nil {
+		t.Fatalf("checkHostResources() with nothing running failed: %v", err)
+	}
+
+	running := newTestEnv("aaa111def456abc123def456abc12345")
+	running.Status = state.StatusReady
+	running.Memory = uint64(half) + 1
+	stopped := newTestEnv("bbb222def456abc123def456abc12345")
+	stopped.Status = state.StatusStopped
+	stopped.Memory = total
+	for _, env := range []*state.Environment{running, stopped} {
+		if err := db.CreateEnvironment(env); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err = checkHostResources(ctx, db, config.ResourceLimits{CPUs: 1, Memory: half})
+	if !errors.Is(err, preflight.ErrInsufficientResources) {
+		t.Errorf("checkHostResources() error = %v, want ErrInsufficientResources", err)
+	}
+	if err := checkHostResources(ctx, db, config.ResourceLimits{CPUs: 1, Memory: half - 1}); err != nil {
+		t.Errorf("checkHostResources() counted the stopped environment: %v", err)
+	}
+}
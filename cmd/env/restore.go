@@ -0,0 +1,33 @@
+package env
+
+import (
+	"github.com/Quidge/choir/internal/msg"
+	"github.com/Quidge/choir/internal/state"
+	"github.com/spf13/cobra"
+)
+
+var restoreCmd = &cobra.Command{
+	Use:   "restore ID",
+	Short: "Bring back an environment removed with env rm",
+	Long: `Bring back an environment that "choir env rm" moved to the trash: its
+workspace is moved back where it was, with everything in it, and its record
+and history are kept.
+
+Removed environments stay in the trash for trash_retention (7 days unless
+set in the global config), after which "choir gc" purges them. List them with
+"choir env list --all".
+
+The ID can be a prefix if it uniquely identifies an environment.`,
+	Args: cobra.ExactArgs(1),
+	RunE: runRestore,
+}
+
+func runRestore(cmd *cobra.Command, args []string) error {
+	return withEnvironment(args[0], func(db *state.DB, env *state.Environment) error {
+		if err := RestoreEnvironment(cmd.Context(), db, env); err != nil {
+			return err
+		}
+		msg.Printf("Restored %s (%s)\n", state.ShortID(env.ID), env.Status)
+		return nil
+	})
+}
@@ -0,0 +1,181 @@
+package env
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/Quidge/choir/internal/clierr"
+	"github.com/Quidge/choir/internal/gitutil"
+	"github.com/Quidge/choir/internal/msg"
+	"github.com/Quidge/choir/internal/prompt"
+	"github.com/Quidge/choir/internal/state"
+	"github.com/spf13/cobra"
+)
+
+var reviewCmd = &cobra.Command{
+	Use:   "review [ID]",
+	Short: "Review an environment's work and decide what to do with it",
+	Long: `Review the work done in an environment when its task is finished, then
+choose what to do with it.
+
+Review shows the diff of the environment's branch against its base branch,
+since it branched, in git's pager, then lists the branch's commits and asks
+what to do:
+
+  merge   Merge the branch into the base branch in the repository
+  pr      Push the branch and open a pull request, as "env pr" does
+  drop    Move the environment to the trash, as "env rm" does
+  attach  Enter the environment's shell to keep working
+
+Merging fast-forwards a base branch that isn't checked out. A base branch
+checked out in the repository is merged there, with a merge commit if
+needed, so it must have no uncommitted changes; a merge with conflicts is
+aborted, to be done by hand. Review doesn't merge while the repository is
+in the middle of a rebase or merge, or the base branch is being rebased.
+After merging, review offers to remove the environment.
+
+Uncommitted changes in the workspace aren't part of the diff or the
+merge; review warns about them. Attach and commit them first.
+
+The ID can be a prefix if it uniquely identifies an environment.
+Without an ID, choir lists the environments to choose from when run at a
+terminal. Review needs a terminal to ask; without one, use env pr, env rm,
+or env attach directly.`,
+	Args: OptionalIDArg,
+	RunE: runReview,
+}
+
+// reviewAction is a choice review offers once the work has been shown.
+type reviewAction struct {
+	label string
+	run   func(ctx context.Context, db *state.DB, env *state.Environment) error
+}
+
+func runReview(cmd *cobra.Command, args []string) error {
+	ctx := context.Background()
+
+	if err := prompt.RequireInteractive("review an environment (use env pr, env rm, or env attach directly)"); err != nil {
+		return err
+	}
+
+	db, err := state.Open("")
+	if err != nil {
+		return fmt.Errorf("failed to open state database: %w", err)
+	}
+	defer db.Close()
+
+	env, err := resolveEnvironmentArg(db, args)
+	if err != nil {
+		return err
+	}
+	if env.Status != state.StatusReady {
+		return clierr.Validation(fmt.Errorf("environment %s is %s, not ready", state.ShortID(env.ID), env.Status))
+	}
+
+	commits, err := gitutil.Commits(env.BackendID, env.BaseBranch, env.BranchName)
+	if err != nil {
+		return err
+	}
+	if len(commits) > 0 {
+		if err := gitutil.PageDiff(env.BackendID, env.BaseBranch, env.BranchName); err != nil {
+			return err
+		}
+		fmt.Printf("\n%d %s on %s not on %s:\n", len(commits), plural(len(commits), "commit", "commits"), env.BranchName, env.BaseBranch)
+		for _, c := range commits {
+			fmt.Printf("  %s %s\n", c.Hash, c.Subject)
+		}
+		fmt.Println()
+	} else {
+		fmt.Printf("No commits on %s since it branched from %s.\n", env.BranchName, env.BaseBranch)
+	}
+	if dirty, err := gitutil.HasUncommittedChanges(env.BackendID); err != nil {
+		fmt.Fprintf(os.Stderr, "warning: %v\n", err)
+	} else if dirty {
+		fmt.Fprintf(os.Stderr, "warning: %s has uncommitted changes, which are left out; attach and commit them to include them\n", state.ShortID(env.ID))
+	}
+
+	actions := reviewActions(env, len(commits) > 0)
+	labels := make([]string, len(actions))
+	for i, a := range actions {
+		labels[i] = a.label
+	}
+	i, err := prompt.Choose("What now?", labels, "use env pr, env rm, or env attach directly")
+	if errors.Is(err, prompt.ErrCanceled) {
+		fmt.Println("Cancelled.")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return actions[i].run(ctx, db, env)
+}
+
+// reviewActions returns the choices review offers for env. Merging and
+// opening a pull request are only offered if the branch has commits.
+func reviewActions(env *state.Environment, hasCommits bool) []reviewAction {
+	var actions []reviewAction
+	if hasCommits {
+		actions = append(actions,
+			reviewAction{"merge   Merge " + env.BranchName + " into " + env.BaseBranch, reviewMerge},
+			reviewAction{"pr      Push " + env.BranchName + " and open a pull request", reviewPR},
+		)
+	}
+	return append(actions,
+		reviewAction{"drop    Move the environment to the trash", reviewDrop},
+		reviewAction{"attach  Enter the environment's shell", reviewAttach},
+	)
+}
+
+// reviewMerge merges env's branch into its base branch in its repository,
+// then offers to remove env.
+func reviewMerge(ctx context.Context, db *state.DB, env *state.Environment) error {
+	if err := gitutil.Merge(env.RepoPath, env.BaseBranch, env.BranchName); err != nil {
+		return err
+	}
+	msg.Printf("Merged %s into %s\n", env.BranchName, env.BaseBranch)
+
+	ok, err := prompt.Confirm(fmt.Sprintf("Remove environment %s now?", state.ShortID(env.ID)), false)
+	if err != nil || !ok {
+		return err
+	}
+	return trashReviewed(ctx, db, env)
+}
+
+func reviewPR(_ context.Context, _ *state.DB, env *state.Environment) error {
+	return openPullRequest(env, pullRequest{})
+}
+
+func reviewDrop(ctx context.Context, db *state.DB, env *state.Environment) error {
+	ok, err := prompt.ConfirmRequired(fmt.Sprintf("Move environment %s and its unmerged work to the trash?", state.ShortID(env.ID)), "use env rm instead")
+	if err != nil {
+		return err
+	}
+	if !ok {
+		fmt.Println("Cancelled.")
+		return nil
+	}
+	return trashReviewed(ctx, db, env)
+}
+
+func reviewAttach(ctx context.Context, _ *state.DB, env *state.Environment) error {
+	be, err := getBackend(env.Backend, "")
+	if err != nil {
+		return err
+	}
+	if err := be.Shell(ctx, env.BackendID); err != nil {
+		return fmt.Errorf("shell exited with error: %w", err)
+	}
+	return nil
+}
+
+// trashReviewed moves env to the trash, as env rm does.
+func trashReviewed(ctx context.Context, db *state.DB, env *state.Environment) error {
+	trashed, err := TrashEnvironment(ctx, db, env, RemoveOptions{Force: true})
+	if err != nil {
+		return err
+	}
+	printRemoved(state.ShortID(env.ID), trashed)
+	return nil
+}
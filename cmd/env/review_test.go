@@ -0,0 +1,28 @@
+package env
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Quidge/choir/internal/state"
+)
+
+func TestReviewActions(t *testing.T) {
+	env := &state.Environment{BranchName: "env/aaaa1111", BaseBranch: "main"}
+
+	var labels []string
+	for _, a := range reviewActions(env, true) {
+		labels = append(labels, strings.Fields(a.label)[0])
+	}
+	if got := strings.Join(labels, " "); got != "merge pr drop attach" {
+		t.Errorf("actions with commits = %s, want merge pr drop attach", got)
+	}
+
+	labels = nil
+	for _, a := range reviewActions(env, false) {
+		labels = append(labels, strings.Fields(a.label)[0])
+	}
+	if got := strings.Join(labels, " "); got != "drop attach" {
+		t.Errorf("actions without commits = %s, want drop attach", got)
+	}
+}
@@ -1,41 +1,68 @@
 package env
 
 import (
-	"bufio"
 	"context"
-	"errors"
 	"fmt"
 	"os"
 	"strings"
 
 	"github.com/Quidge/choir/internal/backend"
-	_ "github.com/Quidge/choir/internal/backend/worktree" // Register worktree backend
+	"github.com/Quidge/choir/internal/config"
+	"github.com/Quidge/choir/internal/msg"
+	"github.com/Quidge/choir/internal/naming"
+	"github.com/Quidge/choir/internal/prompt"
 	"github.com/Quidge/choir/internal/state"
 	"github.com/spf13/cobra"
 )
 
 var rmCmd = &cobra.Command{
-	Use:   "rm ID",
-	Short: "Remove an environment",
-	Long: `Remove an environment and destroy its worktree.
+	Use:   "rm [ID]",
+	Short: "Remove environments",
+	Long: `Remove an environment, moving its worktree to the trash.
 
 The ID can be a prefix if it uniquely identifies an environment.
-This removes the worktree directory and deletes the environment from the database.
-
-For ready environments, confirmation is required unless -f is used.`,
-	Args: cobra.ExactArgs(1),
+Without an ID, choir lists the environments to choose from when run at a
+terminal.
+The environment is marked removed and its worktree is moved to the trash,
+from which "choir env restore" brings it back, until "choir gc" purges it
+after trash_retention (7 days unless set in the global config). --purge, or
+removing an environment that is already in the trash, destroys the worktree
+and deletes the environment from the database at once, as do backends
+without a trash.
+
+For ready environments, confirmation is required unless -f is used. If the
+workspace has uncommitted changes or commits that aren't on any remote or
+other branch, the prompt says so; -f removes it anyway. When the worktree
+is destroyed, that work is first backed up to the trash, from which "choir
+trash restore" brings it back; --no-backup skips the backup.
+
+With --all-failed or --older-than, remove every environment that matches
+instead, after one confirmation listing them; --repo limits them to the
+current repository's. --older-than matches ready, stopped, and failed
+environments, never ones still provisioning.`,
+	Args: rmSelection.args(OptionalIDArg),
 	RunE: runRm,
 }
 
-var rmForceFlag bool
+var (
+	rmForceFlag    bool
+	rmPurgeFlag    bool
+	rmNoBackupFlag bool
+	rmSelection    bulkSelection
+)
+
+// rmBulkStatuses are the statuses rm --older-than removes.
+var rmBulkStatuses = []state.EnvironmentStatus{state.StatusReady, state.StatusStopped, state.StatusFailed}
 
 func init() {
-	rmCmd.Flags().BoolVarP(&rmForceFlag, "force", "f", false, "skip confirmation for ready environments")
+	rmCmd.Flags().BoolVarP(&rmForceFlag, "force", "f", false, "skip confirmation, even if the environment has uncommitted or unpushed work")
+	rmCmd.Flags().BoolVar(&rmPurgeFlag, "purge", false, "destroy the worktree now instead of moving it to the trash")
+	rmCmd.Flags().BoolVar(&rmNoBackupFlag, "no-backup", false, "don't back up uncommitted and unpushed work to the trash")
+	rmSelection.addFlags(rmCmd, "remove", "", true)
 }
 
 func runRm(cmd *cobra.Command, args []string) error {
 	ctx := context.Background()
-	idPrefix := args[0]
 
 	// Open state database
 	db, err := state.Open("")
@@ -44,61 +71,169 @@ func runRm(cmd *cobra.Command, args []string) error {
 	}
 	defer db.Close()
 
-	// Get environment from database by prefix
-	env, err := db.GetEnvironmentByPrefix(idPrefix)
+	if rmSelection.active() {
+		return runRmBulk(ctx, db)
+	}
+
+	// Resolve environment by ID prefix, or pick one
+	env, err := resolveEnvironmentArg(db, args)
 	if err != nil {
-		if errors.Is(err, state.ErrEnvironmentNotFound) {
-			return fmt.Errorf("environment %q not found", idPrefix)
-		}
-		var ambiguousErr *state.AmbiguousPrefixError
-		if errors.As(err, &ambiguousErr) {
-			return FormatAmbiguousPrefixError(ambiguousErr)
-		}
-		if errors.Is(err, state.ErrInvalidPrefix) {
-			return fmt.Errorf("invalid environment ID %q: must contain only hexadecimal characters", idPrefix)
-		}
-		return fmt.Errorf("failed to get environment: %w", err)
+		return err
 	}
 
 	shortID := state.ShortID(env.ID)
 
-	// Confirm for ready environments unless -f is used
-	if env.Status == state.StatusReady && !rmForceFlag {
-		fmt.Printf("Environment %s is ready. Remove it? [y/N] ", shortID)
-		reader := bufio.NewReader(os.Stdin)
-		response, err := reader.ReadString('\n')
+	// Confirm for ready or stopped environments, or any with work that
+	// removal would lose, unless -f is used
+	var pending backend.PendingWork
+	if !rmForceFlag {
+		pending = pendingWork(ctx, env)
+	}
+	if !rmForceFlag && (!pending.IsZero() || env.Status == state.StatusReady || env.Status == state.StatusStopped) {
+		question := fmt.Sprintf("Environment %s is %s. Remove it?", shortID, env.Status)
+		if !pending.IsZero() {
+			question = fmt.Sprintf("Environment %s has %s. Remove anyway?", shortID, describePendingWork(pending))
+		}
+		ok, err := prompt.ConfirmRequired(question, "use --force to remove without confirmation")
 		if err != nil {
-			return fmt.Errorf("failed to read response: %w", err)
+			return err
 		}
-		response = strings.TrimSpace(strings.ToLower(response))
-		if response != "y" && response != "yes" {
+		if !ok {
 			fmt.Println("Cancelled.")
 			return nil
 		}
 	}
 
-	// If environment has a backendID, destroy the worktree
-	if env.BackendID != "" {
-		// Get backend - for MVP, always use worktree
-		be, err := backend.Get(backend.BackendConfig{
-			Name: env.Backend,
-			Type: "worktree",
-		})
-		if err != nil {
-			return fmt.Errorf("failed to get backend: %w", err)
+	trashed, err := removeEnvironment(ctx, db, env)
+	if err != nil {
+		return err
+	}
+
+	printRemoved(shortID, trashed)
+	return nil
+}
+
+// printRemoved reports that the environment shortID was removed, and how
+// to bring it back if it went to the trash.
+func printRemoved(shortID string, trashed bool) {
+	if trashed {
+		msg.Printf("Removed %s; \"choir env restore %s\" brings it back until gc purges it\n", shortID, shortID)
+	} else {
+		msg.Printf("Removed %s\n", shortID)
+	}
+}
+
+// removeEnvironment removes env as the rm flags ask, and reports whether
+// it went to the trash. Removal was confirmed or forced by then, so
+// unpushed commits don't stop it.
+func removeEnvironment(ctx context.Context, db *state.DB, env *state.Environment) (bool, error) {
+	opts := RemoveOptions{Force: true, NoBackup: rmNoBackupFlag}
+	if rmPurgeFlag {
+		return false, RemoveEnvironment(ctx, db, env, opts)
+	}
+	return TrashEnvironment(ctx, db, env, opts)
+}
+
+// runRmBulk removes the environments rmSelection matches.
+func runRmBulk(ctx context.Context, db *state.DB) error {
+	envs, err := rmSelection.environments(db, rmBulkStatuses)
+	if err != nil {
+		return err
+	}
+	if len(envs) == 0 {
+		msg.Println("No matching environments.")
+		return nil
+	}
+
+	pending := make(map[string]backend.PendingWork)
+	if !rmForceFlag {
+		for _, env := range envs {
+			if p := pendingWork(ctx, env); !p.IsZero() {
+				pending[env.ID] = p
+			}
 		}
+	}
+	printBulkList(envs, func(env *state.Environment) string {
+		if p, ok := pending[env.ID]; ok {
+			return describePendingWork(p)
+		}
+		return ""
+	})
 
-		if err := be.Destroy(ctx, env.BackendID); err != nil {
-			// Log the error but continue to delete the environment record
-			fmt.Fprintf(os.Stderr, "warning: failed to destroy worktree: %v\n", err)
+	if !rmForceFlag {
+		question := fmt.Sprintf("Remove %s?", countEnvironments(len(envs)))
+		if len(pending) > 0 {
+			question = fmt.Sprintf("Remove %s, %d with uncommitted or unpushed work?", countEnvironments(len(envs)), len(pending))
+		}
+		ok, err := prompt.ConfirmRequired(question, "use --force to remove without confirmation")
+		if err != nil {
+			return err
+		}
+		if !ok {
+			fmt.Println("Cancelled.")
+			return nil
 		}
 	}
 
-	// Delete environment from database
-	if err := db.DeleteEnvironment(env.ID); err != nil {
-		return fmt.Errorf("failed to delete environment record: %w", err)
+	return runBulk(envs, "Removed", func(env *state.Environment) error {
+		_, err := removeEnvironment(ctx, db, env)
+		return err
+	})
+}
+
+// pendingWork returns env's uncommitted and unpushed work. Failures to
+// check are warned about and treated as no pending work, so they don't
+// block removing a broken environment.
+func pendingWork(ctx context.Context, env *state.Environment) backend.PendingWork {
+	if env.BackendID == "" {
+		return backend.PendingWork{}
+	}
+	be, err := getBackend(env.Backend, "")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "warning: %v\n", err)
+		return backend.PendingWork{}
+	}
+	if status, err := be.Status(ctx, env.BackendID); err != nil || status.State == backend.StateNotFound {
+		return backend.PendingWork{}
+	}
+	pending, err := be.PendingWork(ctx, env.BackendID)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "warning: failed to check for uncommitted work: %v\n", err)
+		return backend.PendingWork{}
 	}
+	return pending
+}
 
-	fmt.Printf("Removed %s\n", shortID)
-	return nil
+// describePendingWork describes p for a prompt, e.g., "uncommitted changes
+// (3 files) and 2 unpushed commits".
+func describePendingWork(p backend.PendingWork) string {
+	var parts []string
+	if p.UncommittedFiles > 0 {
+		parts = append(parts, fmt.Sprintf("uncommitted changes (%d %s)", p.UncommittedFiles, plural(p.UncommittedFiles, "file", "files")))
+	}
+	if p.UnpushedCommits > 0 {
+		parts = append(parts, fmt.Sprintf("%d unpushed %s", p.UnpushedCommits, plural(p.UnpushedCommits, "commit", "commits")))
+	}
+	return strings.Join(parts, " and ")
+}
+
+// releaseName releases env's ID and branch with the configured allocator.
+func releaseName(ctx context.Context, env *state.Environment) error {
+	global, err := config.LoadGlobalConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	allocator, err := naming.FromConfig(global.Naming)
+	if err != nil {
+		return err
+	}
+	return allocator.Release(ctx, naming.Reservation{ID: env.ID, Branch: env.BranchName})
+}
+
+// plural returns one if n is 1 and many otherwise.
+func plural(n int, one, many string) string {
+	if n == 1 {
+		return one
+	}
+	return many
 }
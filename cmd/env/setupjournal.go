@@ -0,0 +1,85 @@
+package env
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/Quidge/choir/internal/state"
+)
+
+// dbJournal records an environment's setup steps in the state database, so
+// that if choir dies during setup, status and doctor can name the step that
+// was interrupted.
+type dbJournal struct {
+	db    *state.DB
+	envID string
+}
+
+func (j *dbJournal) StepStarted(step int, name string) {
+	if err := j.db.StartSetupStep(j.envID, step, name, time.Now()); err != nil {
+		fmt.Fprintf(os.Stderr, "warning: %v\n", err)
+	}
+}
+
+func (j *dbJournal) StepFinished(step int, err error) {
+	var msg string
+	if err != nil {
+		msg = err.Error()
+	}
+	if err := j.db.FinishSetupStep(j.envID, step, time.Now(), msg); err != nil {
+		fmt.Fprintf(os.Stderr, "warning: %v\n", err)
+	}
+}
+
+// describeSetup summarizes env's setup journal for env status: the step
+// running, interrupted, or failed. It returns "" if there is nothing worth
+// reporting (setup succeeded or was never journaled).
+func describeSetup(db *state.DB, env *state.Environment) (string, error) {
+	steps, err := db.ListSetupSteps(env.ID)
+	if err != nil {
+		return "", err
+	}
+	for i := len(steps) - 1; i >= 0; i-- {
+		s := steps[i]
+		switch {
+		case !s.Finished() && env.Status == state.StatusProvisioning:
+			return fmt.Sprintf("running step %d (%s), started %s", s.Step, s.Name, formatTimeAgo(s.StartedAt)), nil
+		case !s.Finished():
+			return fmt.Sprintf("died during step %d (%s)", s.Step, s.Name), nil
+		case s.Error != "":
+			return fmt.Sprintf("step %d (%s) failed", s.Step, s.Name), nil
+		}
+	}
+	return "", nil
+}
+
+// InterruptedSetups describes each environment whose setup was cut short by
+// a crash: failed environments, and environments provisioning for longer
+// than StaleProvisioningAfter, with a journaled step that never finished.
+func InterruptedSetups(db *state.DB, now time.Time) ([]string, error) {
+	envs, err := db.ListEnvironments(state.ListOptions{
+		Statuses: []state.EnvironmentStatus{state.StatusFailed, state.StatusProvisioning},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list environments: %w", err)
+	}
+
+	var out []string
+	for _, env := range envs {
+		if env.Status == state.StatusProvisioning && now.Sub(env.CreatedAt) < StaleProvisioningAfter {
+			continue // Probably still running
+		}
+		step, err := db.InterruptedSetupStep(env.ID)
+		if errors.Is(err, state.ErrNoInterruptedStep) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, fmt.Sprintf("environment %s died during step %d: %s",
+			state.ShortID(env.ID), step.Step, step.Name))
+	}
+	return out, nil
+}
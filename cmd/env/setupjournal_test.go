@@ -0,0 +1,57 @@
+package env
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Quidge/choir/internal/state"
+)
+
+func TestInterruptedSetups(t *testing.T) {
+	db := openReconcileDB(t)
+	now := time.Now()
+
+	mk := func(id string, status state.EnvironmentStatus, created time.Time, finished bool) {
+		env := newTestEnv(id)
+		env.Status = status
+		env.CreatedAt = created
+		if err := db.CreateEnvironment(env); err != nil {
+			t.Fatal(err)
+		}
+		j := &dbJournal{db: db, envID: id}
+		j.StepStarted(1, "write environment")
+		j.StepFinished(1, nil)
+		j.StepStarted(2, "npm install")
+		if finished {
+			j.StepFinished(2, errors.New("exit status 1"))
+		}
+	}
+	stale := now.Add(-2 * StaleProvisioningAfter)
+	mk("aaaa0000000000000000000000000000", state.StatusFailed, stale, false)       // Died
+	mk("bbbb0000000000000000000000000000", state.StatusProvisioning, stale, false) // Died, not yet reconciled
+	mk("cccc0000000000000000000000000000", state.StatusProvisioning, now, false)   // Still running
+	mk("dddd0000000000000000000000000000", state.StatusFailed, stale, true)        // Command failed
+
+	got, err := InterruptedSetups(db, now)
+	if err != nil {
+		t.Fatalf("InterruptedSetups() failed: %v", err)
+	}
+	want := map[string]bool{
+		"environment aaaa00000000 died during step 2: npm install": true,
+		"environment bbbb00000000 died during step 2: npm install": true,
+	}
+	if len(got) != len(want) {
+		t.Fatalf("InterruptedSetups() = %q, want %d entries", got, len(want))
+	}
+	for _, line := range got {
+		if !want[line] {
+			t.Errorf("unexpected entry %q", line)
+		}
+	}
+
+	env, _ := db.GetEnvironment("dddd0000000000000000000000000000")
+	if desc, err := describeSetup(db, env); err != nil || desc != "step 2 (npm install) failed" {
+		t.Errorf("describeSetup() = %q, %v; want failed step 2", desc, err)
+	}
+}
@@ -0,0 +1,102 @@
+package env
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/Quidge/choir/internal/state"
+)
+
+// followPollInterval is how often followSetup checks for new output and
+// status changes.
+const followPollInterval = 250 * time.Millisecond
+
+// setupLogPath returns where setup output for environment id is logged:
+// a logs directory next to the state database.
+func setupLogPath(id string) (string, error) {
+	dbPath, err := state.DefaultDBPath()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(filepath.Dir(dbPath), "logs", id+".setup.log"), nil
+}
+
+// createSetupLog creates (or truncates) the setup log for environment id.
+func createSetupLog(id string) (*os.File, error) {
+	path, err := setupLogPath(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create log directory: %w", err)
+	}
+	return os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+}
+
+// removeSetupLog deletes the setup log for environment id, if any.
+func removeSetupLog(id string) error {
+	path, err := setupLogPath(id)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// followSetup copies env's setup log to w as it grows until env stops
+// provisioning, then returns its latest record.
+func followSetup(ctx context.Context, db *state.DB, env *state.Environment, w io.Writer) (*state.Environment, error) {
+	path, err := setupLogPath(env.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	var log *os.File
+	defer func() {
+		if log != nil {
+			log.Close()
+		}
+	}()
+	drain := func() {
+		if log == nil {
+			// Setup may not have started yet
+			f, err := os.Open(path)
+			if err != nil {
+				return
+			}
+			log = f
+		}
+		_, _ = io.Copy(w, log)
+	}
+
+	ticker := time.NewTicker(followPollInterval)
+	defer ticker.Stop()
+	for {
+		drain()
+
+		current, err := db.GetEnvironment(env.ID)
+		if errors.Is(err, state.ErrEnvironmentNotFound) {
+			return nil, fmt.Errorf("environment %s was removed while provisioning", state.ShortID(env.ID))
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to get environment: %w", err)
+		}
+		if current.Status != state.StatusProvisioning {
+			drain()
+			return current, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package env
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Quidge/choir/internal/state"
+)
+
+// syncBuffer is a bytes.Buffer safe to read while followSetup writes.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestFollowSetup(t *testing.T) {
+	db := openReconcileDB(t)
+	env := newTestEnv("cccc0000000000000000000000000000")
+	env.Status = state.StatusProvisioning
+	if err := db.CreateEnvironment(env); err != nil {
+		t.Fatalf("CreateEnvironment() failed: %v", err)
+	}
+
+	var out syncBuffer
+	done := make(chan error, 1)
+	var final *state.Environment
+	go func() {
+		var err error
+		final, err = followSetup(context.Background(), db, env, &out)
+		done <- err
+	}()
+
+	// Setup starts after the follower, writes output, then finishes
+	time.Sleep(2 * followPollInterval)
+	log, err := createSetupLog(env.ID)
+	if err != nil {
+		t.Fatalf("createSetupLog() failed: %v", err)
+	}
+	log.WriteString("installing\n")
+	time.Sleep(2 * followPollInterval)
+	if got := out.String(); got != "installing\n" {
+		t.Errorf("output while provisioning = %q, want %q", got, "installing\n")
+	}
+	log.WriteString("done\n")
+	log.Close()
+	env.Status = state.StatusReady
+	if err := db.UpdateEnvironment(env); err != nil {
+		t.Fatalf("UpdateEnvironment() failed: %v", err)
+	}
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("followSetup() failed: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("followSetup() did not return after the environment became ready")
+	}
+	if final.Status != state.StatusReady {
+		t.Errorf("final status = %s, want ready", final.Status)
+	}
+	if got := out.String(); got != "installing\ndone\n" {
+		t.Errorf("output = %q, want the whole log", got)
+	}
+
+	// Removing the environment removes its log
+	if err := removeSetupLog(env.ID); err != nil {
+		t.Fatalf("removeSetupLog() failed: %v", err)
+	}
+	path, _ := setupLogPath(env.ID)
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("setup log still exists: %v", err)
+	}
+}
@@ -0,0 +1,228 @@
+package env
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/Quidge/choir/internal/clierr"
+	"github.com/Quidge/choir/internal/msg"
+	"github.com/Quidge/choir/internal/prompt"
+	"github.com/Quidge/choir/internal/resolve"
+	"github.com/Quidge/choir/internal/state"
+	"github.com/spf13/cobra"
+)
+
+var stopCmd = &cobra.Command{
+	Use:   "stop ID",
+	Short: "Stop running environments",
+	Long: `Stop an environment's workspace (for example, shut down its VM) without
+removing it. Start it again with "choir env start".
+
+An agent started with "choir env run-agent" is stopped first: it is sent
+SIGTERM, and killed if it hasn't exited after 10 seconds. With --agent, only
+the agent is stopped and the workspace keeps running.
+
+The ID can be a prefix if it uniquely identifies an environment. With --all
+or --older-than, stop every ready environment that matches instead, after
+one confirmation; --repo limits them to the current repository's.`,
+	Args: stopSelection.args(cobra.ExactArgs(1)),
+	RunE: runStop,
+}
+
+var (
+	stopAgentFlag bool
+	stopSelection bulkSelection
+)
+
+func init() {
+	stopCmd.Flags().BoolVar(&stopAgentFlag, "agent", false, "stop only the environment's agent")
+	stopSelection.addFlags(stopCmd, "stop", state.StatusReady, false)
+	startSelection.addFlags(startCmd, "start", state.StatusStopped, false)
+}
+
+var startCmd = &cobra.Command{
+	Use:   "start ID",
+	Short: "Start stopped environments",
+	Long: `Start a stopped environment's workspace so it can be attached to and
+run commands again.
+
+The ID can be a prefix if it uniquely identifies an environment. With --all
+or --older-than, start every stopped environment that matches instead, after
+one confirmation; --repo limits them to the current repository's.`,
+	Args: startSelection.args(cobra.ExactArgs(1)),
+	RunE: runStart,
+}
+
+var startSelection bulkSelection
+
+func runStop(cmd *cobra.Command, args []string) error {
+	if stopSelection.active() {
+		if stopAgentFlag {
+			return clierr.Validation(errors.New("--agent can't be used with --all or --older-than"))
+		}
+		return runBulkStartStop(&stopSelection, state.StatusReady, state.StatusStopped, "Stop", "Stopped", func(db *state.DB, env *state.Environment) error {
+			return stopWorkspace(cmd.Context(), db, env)
+		})
+	}
+	return withEnvironment(args[0], func(db *state.DB, env *state.Environment) error {
+		shortID := state.ShortID(env.ID)
+		if stopAgentFlag {
+			return runStopAgent(cmd.Context(), db, env)
+		}
+		if env.Status == state.StatusStopped {
+			msg.Printf("%s is already stopped\n", shortID)
+			return nil
+		}
+		if err := StopEnvironment(cmd.Context(), db, env); err != nil {
+			return err
+		}
+		msg.Printf("Stopped %s\n", shortID)
+		return nil
+	})
+}
+
+// runStopAgent stops the agent running in env, leaving its workspace up.
+func runStopAgent(ctx context.Context, db *state.DB, env *state.Environment) error {
+	be, err := getBackend(env.Backend, "")
+	if err != nil {
+		return err
+	}
+	stopped, err := stopAgent(ctx, db, be, env)
+	if err != nil {
+		return err
+	}
+	if !stopped {
+		msg.Printf("No agent is running in %s\n", state.ShortID(env.ID))
+		return nil
+	}
+	msg.Printf("Stopped the agent in %s\n", state.ShortID(env.ID))
+	return nil
+}
+
+func runStart(cmd *cobra.Command, args []string) error {
+	if startSelection.active() {
+		return runBulkStartStop(&startSelection, state.StatusStopped, state.StatusReady, "Start", "Started", func(db *state.DB, env *state.Environment) error {
+			return startWorkspace(cmd.Context(), env)
+		})
+	}
+	return withEnvironment(args[0], func(db *state.DB, env *state.Environment) error {
+		shortID := state.ShortID(env.ID)
+		if env.Status == state.StatusReady {
+			msg.Printf("%s is already running\n", shortID)
+			return nil
+		}
+		if err := StartEnvironment(cmd.Context(), db, env); err != nil {
+			return err
+		}
+		msg.Printf("Started %s\n", shortID)
+		return nil
+	})
+}
+
+// runBulkStartStop applies fn to the environments in status that sel
+// matches, after confirming with a question starting with action, and marks
+// those it succeeded on with status to. Stopping and starting lose nothing,
+// so the confirmation defaults to yes.
+func runBulkStartStop(sel *bulkSelection, status, to state.EnvironmentStatus, action, done string, fn func(*state.DB, *state.Environment) error) error {
+	db, err := state.Open("")
+	if err != nil {
+		return fmt.Errorf("failed to open state database: %w", err)
+	}
+	defer db.Close()
+
+	envs, err := sel.environments(db, []state.EnvironmentStatus{status})
+	if err != nil {
+		return err
+	}
+	if len(envs) == 0 {
+		msg.Printf("No matching %s environments.\n", status)
+		return nil
+	}
+	printBulkList(envs, nil)
+	ok, err := prompt.Confirm(fmt.Sprintf("%s %s?", action, countEnvironments(len(envs))), true)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		fmt.Println("Cancelled.")
+		return nil
+	}
+	return runBulkTransition(db, envs, done, to, func(env *state.Environment) error {
+		return fn(db, env)
+	})
+}
+
+// withEnvironment opens the state database, resolves idPrefix, and calls fn.
+func withEnvironment(idPrefix string, fn func(*state.DB, *state.Environment) error) error {
+	db, err := state.Open("")
+	if err != nil {
+		return fmt.Errorf("failed to open state database: %w", err)
+	}
+	defer db.Close()
+
+	env, err := resolve.Environment(db, idPrefix)
+	if err != nil {
+		return err
+	}
+	return fn(db, env)
+}
+
+// StopEnvironment stops a ready environment's agent, if one is running, and
+// its workspace, and marks it stopped.
+func StopEnvironment(ctx context.Context, db *state.DB, env *state.Environment) error {
+	if err := stopWorkspace(ctx, db, env); err != nil {
+		return err
+	}
+	return setStatus(db, env, state.StatusStopped)
+}
+
+// stopWorkspace stops a ready environment's agent, if one is running, and
+// its workspace, leaving its status for the caller to update.
+func stopWorkspace(ctx context.Context, db *state.DB, env *state.Environment) error {
+	if env.Status != state.StatusReady {
+		return clierr.Validation(fmt.Errorf("environment %s is %s; only ready environments can be stopped", state.ShortID(env.ID), env.Status))
+	}
+	be, err := getBackend(env.Backend, "")
+	if err != nil {
+		return err
+	}
+	if _, err := stopAgent(ctx, db, be, env); err != nil {
+		return err
+	}
+	if err := be.Stop(ctx, env.BackendID); err != nil {
+		return clierr.Backend(fmt.Errorf("failed to stop workspace: %w", err))
+	}
+	return nil
+}
+
+// StartEnvironment starts a stopped environment's workspace and marks it
+// ready.
+func StartEnvironment(ctx context.Context, db *state.DB, env *state.Environment) error {
+	if err := startWorkspace(ctx, env); err != nil {
+		return err
+	}
+	return setStatus(db, env, state.StatusReady)
+}
+
+// startWorkspace starts a stopped environment's workspace, leaving its
+// status for the caller to update.
+func startWorkspace(ctx context.Context, env *state.Environment) error {
+	if env.Status != state.StatusStopped {
+		return clierr.Validation(fmt.Errorf("environment %s is %s; only stopped environments can be started", state.ShortID(env.ID), env.Status))
+	}
+	be, err := getBackend(env.Backend, "")
+	if err != nil {
+		return err
+	}
+	if err := be.Start(ctx, env.BackendID); err != nil {
+		return clierr.Backend(fmt.Errorf("failed to start workspace: %w", err))
+	}
+	return nil
+}
+
+// setStatus moves env from its current status to status, failing if it
+// has changed since env was read.
+func setStatus(db *state.DB, env *state.Environment, status state.EnvironmentStatus) error {
+	return transitionEnvironments(db, []*state.Environment{env}, status)[env.ID]
+}
@@ -0,0 +1,42 @@
+package env
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Quidge/choir/internal/state"
+)
+
+func TestStopStart(t *testing.T) {
+	db := openReconcileDB(t)
+	ctx := context.Background()
+
+	env := newTestEnv("dddd0000000000000000000000000000")
+	env.Status = state.StatusReady
+	env.BackendID = t.TempDir()
+	if err := db.CreateEnvironment(env); err != nil {
+		t.Fatalf("CreateEnvironment() failed: %v", err)
+	}
+
+	if err := StartEnvironment(ctx, db, env); err == nil {
+		t.Error("StartEnvironment() of a ready environment succeeded, want error")
+	}
+	if err := StopEnvironment(ctx, db, env); err != nil {
+		t.Fatalf("StopEnvironment() failed: %v", err)
+	}
+	got, err := db.GetEnvironment(env.ID)
+	if err != nil || got.Status != state.StatusStopped {
+		t.Fatalf("after stop: %+v, %v; want stopped", got, err)
+	}
+	if _, err := ExecCommand(ctx, db, got, "true", ""); err == nil {
+		t.Error("ExecCommand() in a stopped environment succeeded, want error")
+	}
+
+	if err := StartEnvironment(ctx, db, got); err != nil {
+		t.Fatalf("StartEnvironment() failed: %v", err)
+	}
+	got, err = db.GetEnvironment(env.ID)
+	if err != nil || got.Status != state.StatusReady {
+		t.Errorf("after start: %+v, %v; want ready", got, err)
+	}
+}
@@ -1,47 +1,44 @@
 package env
 
 import (
-	"errors"
 	"fmt"
+	"os"
+	"strings"
+	"time"
 
+	"github.com/Quidge/choir/internal/gitutil"
+	"github.com/Quidge/choir/internal/pathutil"
 	"github.com/Quidge/choir/internal/state"
 	"github.com/spf13/cobra"
 )
 
 var statusCmd = &cobra.Command{
-	Use:   "status ID",
+	Use:   "status [ID]",
 	Short: "Show detailed environment info",
 	Long: `Show detailed information about an environment.
 
-The ID can be a prefix if it uniquely identifies an environment.`,
-	Args: cobra.ExactArgs(1),
-	RunE: runStatus,
+The ID can be a prefix if it uniquely identifies an environment.
+Without an ID, choir lists the environments to choose from when run at a
+terminal.`,
+	Args: OptionalIDArg,
+	RunE: RunStatus,
 }
 
-func runStatus(cmd *cobra.Command, args []string) error {
-	idPrefix := args[0]
-
+// RunStatus prints detailed information about the environment identified by
+// args[0], or picked if args is empty. It is shared with the top-level
+// `choir status` command.
+func RunStatus(cmd *cobra.Command, args []string) error {
 	// Open state database
-	db, err := state.Open("")
+	db, err := state.OpenReadOnly("")
 	if err != nil {
 		return fmt.Errorf("failed to open state database: %w", err)
 	}
 	defer db.Close()
 
-	// Get environment from database by prefix
-	env, err := db.GetEnvironmentByPrefix(idPrefix)
+	// Resolve environment by ID prefix, or pick one
+	env, err := resolveEnvironmentArg(db, args)
 	if err != nil {
-		if errors.Is(err, state.ErrEnvironmentNotFound) {
-			return fmt.Errorf("environment %q not found", idPrefix)
-		}
-		var ambiguousErr *state.AmbiguousPrefixError
-		if errors.As(err, &ambiguousErr) {
-			return FormatAmbiguousPrefixError(ambiguousErr)
-		}
-		if errors.Is(err, state.ErrInvalidPrefix) {
-			return fmt.Errorf("invalid environment ID %q: must contain only hexadecimal characters", idPrefix)
-		}
-		return fmt.Errorf("failed to get environment: %w", err)
+		return err
 	}
 
 	// Print detailed info
@@ -55,10 +52,116 @@ func runStatus(cmd *cobra.Command, args []string) error {
 	fmt.Printf("Branch:      %s\n", env.BranchName)
 	fmt.Printf("Base Branch: %s\n", env.BaseBranch)
 	fmt.Printf("Repository:  %s\n", env.RepoPath)
-	if env.RemoteURL != "" {
+	if env.RemoteURL != "" && env.Remote != "" {
+		fmt.Printf("Remote:      %s (%s)\n", env.Remote, env.RemoteURL)
+	} else if env.RemoteURL != "" {
 		fmt.Printf("Remote:      %s\n", env.RemoteURL)
 	}
+	if env.Profile != "" {
+		fmt.Printf("Profile:     %s\n", env.Profile)
+	}
+	if env.Task != "" {
+		fmt.Printf("Task:        %s\n", summarizeTask(env.Task))
+	}
 	fmt.Printf("Created:     %s\n", env.CreatedAt.Format("2006-01-02 15:04:05"))
+	if !env.ExpiresAt.IsZero() {
+		expiry := env.ExpiresAt.Local().Format("2006-01-02 15:04:05")
+		if env.Expired(time.Now()) {
+			expiry += " (expired)"
+		}
+		fmt.Printf("Expires:     %s\n", expiry)
+	}
+
+	// Summarize the work done in the workspace
+	if env.BackendID != "" && pathutil.ExistsAndIsDir(env.BackendID) {
+		progress, err := describeGitProgress(env)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "warning: %v\n", err)
+		} else {
+			fmt.Printf("Git:         %s\n", progress)
+		}
+	}
+
+	// Report where setup stopped, if it didn't succeed
+	setup, err := describeSetup(db, env)
+	if err != nil {
+		return err
+	}
+	if setup != "" {
+		fmt.Printf("Setup:       %s\n", setup)
+	}
+
+	// Show whether the agent is still running
+	if env.BackendID != "" {
+		be, err := getBackend(env.Backend, "")
+		if err != nil {
+			return err
+		}
+		run, err := latestAgentRun(cmd.Context(), db, be, env)
+		if err != nil {
+			return err
+		}
+		if run != nil {
+			fmt.Printf("Agent:       %s\n", describeAgentRun(run))
+		}
+	}
+
+	// Summarize command history
+	cmds, err := db.ListCommands(state.CommandListOptions{EnvironmentID: env.ID})
+	if err != nil {
+		return fmt.Errorf("failed to list commands: %w", err)
+	}
+	if len(cmds) > 0 {
+		last := cmds[len(cmds)-1]
+		fmt.Printf("Commands:    %d run (last: %q exited %d, %s)\n",
+			len(cmds), last.Command, last.ExitCode, formatTimeAgo(last.StartedAt))
+	}
 
 	return nil
 }
+
+// describeGitProgress summarizes the work in env's workspace against its
+// base branch, e.g., "2 commits ahead of main, 1 behind; 3 files changed,
+// 10 insertions(+); uncommitted changes". The diff includes uncommitted
+// changes to tracked files.
+func describeGitProgress(env *state.Environment) (string, error) {
+	ahead, behind, err := gitutil.CommitsAheadBehind(env.BackendID, env.BaseBranch, "HEAD")
+	if err != nil {
+		return "", err
+	}
+	parts := []string{fmt.Sprintf("%d %s ahead of %s, %d behind", ahead, plural(ahead, "commit", "commits"), env.BaseBranch, behind)}
+
+	stat, err := gitutil.DiffStat(env.BackendID, env.BaseBranch, "")
+	if err != nil {
+		return "", err
+	}
+	if !stat.IsZero() {
+		parts = append(parts, stat.String())
+	}
+
+	dirty, err := gitutil.HasUncommittedChanges(env.BackendID)
+	if err != nil {
+		return "", err
+	}
+	if dirty {
+		parts = append(parts, "uncommitted changes")
+	}
+	return strings.Join(parts, "; "), nil
+}
+
+// maxTaskSummary is the longest task summary status prints.
+const maxTaskSummary = 72
+
+// summarizeTask returns the first line of task, cut to maxTaskSummary
+// characters, with "..." if anything was left out.
+func summarizeTask(task string) string {
+	line, rest, _ := strings.Cut(task, "\n")
+	runes := []rune(line)
+	if len(runes) > maxTaskSummary {
+		return string(runes[:maxTaskSummary-3]) + "..."
+	}
+	if strings.TrimSpace(rest) != "" {
+		return line + " ..."
+	}
+	return line
+}
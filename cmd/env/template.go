@@ -0,0 +1,134 @@
+package env
+
+import (
+	"fmt"
+
+	"github.com/Quidge/choir/internal/config"
+	"github.com/Quidge/choir/internal/msg"
+	"github.com/Quidge/choir/internal/resolve"
+	"github.com/Quidge/choir/internal/state"
+	"github.com/spf13/cobra"
+)
+
+var templateCmd = &cobra.Command{
+	Use:   "template",
+	Short: "Manage environment templates",
+	Long: `Manage environment templates: named setups (environment variables, file
+mounts, setup commands, caches, and backend) captured from an existing
+environment and reused with "choir env create --template NAME".
+
+Templates are stored in ~/.config/choir/templates/.
+
+Subcommands:
+  create  Save an environment's setup as a template
+  list    List templates
+  rm      Remove a template`,
+}
+
+var templateCreateCmd = &cobra.Command{
+	Use:   "create NAME --from ID",
+	Short: "Save an environment's setup as a template",
+	Long: `Save the setup of an existing environment as a template named NAME.
+
+The setup is read from the .choir.yaml in the environment's workspace, so
+edits made while iterating on an environment are captured, falling back to
+the repository's .choir.yaml. Relative file mount sources are saved as
+absolute paths so the template can be used with any repository.`,
+	Args: cobra.ExactArgs(1),
+	RunE: runTemplateCreate,
+}
+
+var templateListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List templates",
+	Args:  cobra.NoArgs,
+	RunE:  runTemplateList,
+}
+
+var templateRmCmd = &cobra.Command{
+	Use:   "rm NAME",
+	Short: "Remove a template",
+	Args:  cobra.ExactArgs(1),
+	RunE:  runTemplateRm,
+}
+
+var (
+	templateFromFlag  string
+	templateForceFlag bool
+)
+
+func init() {
+	templateCmd.AddCommand(templateCreateCmd)
+	templateCmd.AddCommand(templateListCmd)
+	templateCmd.AddCommand(templateRmCmd)
+
+	templateCreateCmd.Flags().StringVar(&templateFromFlag, "from", "", "environment to capture (required)")
+	templateCreateCmd.Flags().BoolVarP(&templateForceFlag, "force", "f", false, "replace an existing template")
+	_ = templateCreateCmd.MarkFlagRequired("from")
+}
+
+func runTemplateCreate(cmd *cobra.Command, args []string) error {
+	name := args[0]
+	if config.TemplateExists(name) && !templateForceFlag {
+		return fmt.Errorf("template %q already exists (use --force to replace it)", name)
+	}
+
+	db, err := state.OpenReadOnly("")
+	if err != nil {
+		return fmt.Errorf("failed to open state database: %w", err)
+	}
+	defer db.Close()
+
+	env, err := resolve.Environment(db, templateFromFlag)
+	if err != nil {
+		return err
+	}
+
+	tmpl, err := captureTemplate(env)
+	if err != nil {
+		return err
+	}
+	if err := config.WriteTemplate(name, tmpl); err != nil {
+		return err
+	}
+
+	msg.Printf("Saved template %s from environment %s\n", name, state.ShortID(env.ID))
+	return nil
+}
+
+// captureTemplate builds a template from env's project config, preferring
+// the copy in its workspace over the one in its repository.
+func captureTemplate(env *state.Environment) (config.Template, error) {
+	dir := env.RepoPath
+	if env.BackendID != "" && config.ProjectConfigExists(env.BackendID) {
+		dir = env.BackendID
+	}
+	project, err := config.LoadProjectConfigFromDir(dir)
+	if err != nil {
+		return config.Template{}, fmt.Errorf("failed to load project config: %w", err)
+	}
+	return config.TemplateFromProject(project, dir, env.Backend)
+}
+
+func runTemplateList(cmd *cobra.Command, args []string) error {
+	names, err := config.ListTemplates()
+	if err != nil {
+		return err
+	}
+	if len(names) == 0 {
+		fmt.Println("No templates found.")
+		return nil
+	}
+	for _, name := range names {
+		fmt.Println(name)
+	}
+	return nil
+}
+
+func runTemplateRm(cmd *cobra.Command, args []string) error {
+	if err := config.DeleteTemplate(args[0]); err != nil {
+		return err
+	}
+	msg.Printf("Removed template %s\n", args[0])
+	return nil
+}
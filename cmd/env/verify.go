@@ -0,0 +1,110 @@
+package env
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"os"
+
+	"github.com/Quidge/choir/internal/backend"
+	"github.com/Quidge/choir/internal/state"
+)
+
+// Drift is how an environment's workspace disagrees with its recorded
+// status, as found by verifyEnvironments.
+type Drift struct {
+	// Problem describes the disagreement, e.g., "workspace missing".
+	Problem string
+
+	// Status is the status the record should have to match the workspace.
+	Status state.EnvironmentStatus
+}
+
+// verifyEnvironment asks env's backend for the state of its workspace and
+// reports drift from env's status. Only ready and stopped environments are
+// checked; the others have no workspace state to agree with yet, or none at
+// all. A nil Drift means the record and workspace agree.
+func verifyEnvironment(ctx context.Context, be backend.Backend, env *state.Environment) (*Drift, error) {
+	if env.Status != state.StatusReady && env.Status != state.StatusStopped {
+		return nil, nil
+	}
+	if env.BackendID == "" {
+		return &Drift{Problem: "no workspace recorded", Status: state.StatusFailed}, nil
+	}
+
+	status, err := be.Status(ctx, env.BackendID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get workspace status: %w", err)
+	}
+	switch status.State {
+	case backend.StateNotFound:
+		return &Drift{Problem: "workspace missing", Status: state.StatusFailed}, nil
+	case backend.StateError:
+		return &Drift{Problem: "workspace error: " + status.Message, Status: state.StatusFailed}, nil
+	case backend.StateStopped:
+		if env.Status == state.StatusReady {
+			return &Drift{Problem: "workspace stopped", Status: state.StatusStopped}, nil
+		}
+	}
+	return nil, nil
+}
+
+// verifyEnvironments checks every environment in envs with its backend and
+// returns the drift found, by environment ID. Environments that can't be
+// checked are warned about and left out.
+func verifyEnvironments(ctx context.Context, envs []*state.Environment) map[string]*Drift {
+	drifts := make(map[string]*Drift)
+	backends := make(map[string]backend.Backend)
+	for _, env := range envs {
+		be, ok := backends[env.Backend]
+		if !ok {
+			var err error
+			be, err = getBackend(env.Backend, "")
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "warning: %s: %v\n", state.ShortID(env.ID), err)
+				continue
+			}
+			backends[env.Backend] = be
+		}
+		drift, err := verifyEnvironment(ctx, be, env)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "warning: %s: %v\n", state.ShortID(env.ID), err)
+			continue
+		}
+		if drift != nil {
+			drifts[env.ID] = drift
+		}
+	}
+	return drifts
+}
+
+// fixDrifts updates the stored status of each of envs to match its
+// workspace, as drifts has it, moving the environments headed for the same
+// status together (see transitionEnvironments), and captures diagnostics
+// and fires the failed hooks for those that become failed. Environments
+// that couldn't be updated are returned by ID with the reason.
+func fixDrifts(ctx context.Context, db *state.DB, envs []*state.Environment, drifts map[string]*Drift) map[string]error {
+	var tos []state.EnvironmentStatus
+	groups := make(map[state.EnvironmentStatus][]*state.Environment)
+	reasons := make(map[string]string)
+	for _, env := range envs {
+		drift := drifts[env.ID]
+		if _, ok := groups[drift.Status]; !ok {
+			tos = append(tos, drift.Status)
+		}
+		groups[drift.Status] = append(groups[drift.Status], env)
+		reasons[env.ID] = drift.Problem
+	}
+
+	failed := make(map[string]error)
+	for _, to := range tos {
+		var errs map[string]error
+		if to == state.StatusFailed {
+			errs = markFailed(ctx, db, groups[to], reasons)
+		} else {
+			errs = transitionEnvironments(db, groups[to], to)
+		}
+		maps.Copy(failed, errs)
+	}
+	return failed
+}
@@ -0,0 +1,87 @@
+package env
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/Quidge/choir/internal/backend/fake"
+	"github.com/Quidge/choir/internal/config"
+	"github.com/Quidge/choir/internal/state"
+)
+
+func TestVerifyEnvironment(t *testing.T) {
+	db := openReconcileDB(t)
+	ctx := context.Background()
+	be := fake.New()
+
+	running, _ := be.Create(ctx, &config.CreateConfig{})
+	stopped, _ := be.Create(ctx, &config.CreateConfig{})
+	if err := be.Stop(ctx, stopped); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		status     state.EnvironmentStatus
+		backendID  string
+		wantStatus state.EnvironmentStatus // Empty for no drift
+	}{
+		{"ready and running", state.StatusReady, running, ""},
+		{"ready but missing", state.StatusReady, "/gone", state.StatusFailed},
+		{"ready but stopped", state.StatusReady, stopped, state.StatusStopped},
+		{"stopped and stopped", state.StatusStopped, stopped, ""},
+		{"stopped but missing", state.StatusStopped, "/gone", state.StatusFailed},
+		{"no workspace recorded", state.StatusReady, "", state.StatusFailed},
+		{"failed is not checked", state.StatusFailed, "/gone", ""},
+		{"provisioning is not checked", state.StatusProvisioning, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newTestEnv("dddd0000000000000000000000000000")
+			env.Status = tt.status
+			env.BackendID = tt.backendID
+			drift, err := verifyEnvironment(ctx, be, env)
+			if err != nil {
+				t.Fatalf("verifyEnvironment() failed: %v", err)
+			}
+			switch {
+			case tt.wantStatus == "" && drift != nil:
+				t.Errorf("verifyEnvironment() = %+v, want no drift", drift)
+			case tt.wantStatus != "" && (drift == nil || drift.Status != tt.wantStatus):
+				t.Errorf("verifyEnvironment() = %+v, want drift to %s", drift, tt.wantStatus)
+			}
+		})
+	}
+
+	// Fixing drift updates the records, skipping one changed meanwhile
+	var envs []*state.Environment
+	drifts := make(map[string]*Drift)
+	for i, backendID := range []string{"/gone", "/gone", stopped, "/gone"} {
+		env := newTestEnv(fmt.Sprintf("eeee%028d", i))
+		env.Status = state.StatusReady
+		env.BackendID = backendID
+		if err := db.CreateEnvironment(env); err != nil {
+			t.Fatal(err)
+		}
+		drift, _ := verifyEnvironment(ctx, be, env)
+		envs = append(envs, env)
+		drifts[env.ID] = drift
+	}
+	changed := *envs[3]
+	changed.Status = state.StatusRemoved
+	if err := db.UpdateEnvironment(&changed); err != nil {
+		t.Fatal(err)
+	}
+
+	failed := fixDrifts(ctx, db, envs, drifts)
+	if len(failed) != 1 || failed[envs[3].ID] == nil {
+		t.Errorf("fixDrifts() failed = %v, want only %s", failed, envs[3].ID)
+	}
+	for i, want := range []state.EnvironmentStatus{state.StatusFailed, state.StatusFailed, state.StatusStopped, state.StatusRemoved} {
+		got, err := db.GetEnvironment(envs[i].ID)
+		if err != nil || got.Status != want {
+			t.Errorf("environment %d after fixDrifts() = %+v, %v; want %s", i, got, err, want)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package env
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/Quidge/choir/internal/clierr"
+	"github.com/Quidge/choir/internal/msg"
+	"github.com/Quidge/choir/internal/resolve"
+	"github.com/Quidge/choir/internal/state"
+	"github.com/spf13/cobra"
+)
+
+var waitCmd = &cobra.Command{
+	Use:   "wait ID",
+	Short: "Wait for an environment to reach a status",
+	Long: `Block until an environment reaches a status, ready by default, so scripts
+can create an environment in the background and run commands in it once it
+is set up:
+
+  id=$(choir env create --detach) && choir env wait "$id" && choir env exec "$id" -- make test
+
+Use --for to wait for another status: provisioning, ready, stopped, failed,
+or removed. If the environment is already in it, wait returns at once.
+
+Waiting stops with an error if the environment fails or is removed first
+(exit status 5 or 3), or, with --timeout, if it hasn't reached the status in
+time (exit status 6).
+
+The ID can be a prefix if it uniquely identifies an environment.`,
+	Args: cobra.ExactArgs(1),
+	RunE: runWait,
+}
+
+var (
+	waitForFlag     string
+	waitTimeoutFlag time.Duration
+)
+
+// waitPollInterval is how often waitForStatus checks the environment.
+const waitPollInterval = 500 * time.Millisecond
+
+func init() {
+	waitCmd.Flags().StringVar(&waitForFlag, "for", string(state.StatusReady), "status to wait for")
+	waitCmd.Flags().DurationVar(&waitTimeoutFlag, "timeout", 0, "give up after this long (e.g., 90s, 10m; 0 to wait indefinitely)")
+}
+
+func runWait(cmd *cobra.Command, args []string) error {
+	want := state.EnvironmentStatus(waitForFlag)
+	if !state.IsValidStatus(want) {
+		valid := make([]string, len(state.ValidStatuses))
+		for i, s := range state.ValidStatuses {
+			valid[i] = string(s)
+		}
+		return clierr.Validation(fmt.Errorf("invalid --for status %q (valid: %s)", waitForFlag, strings.Join(valid, ", ")))
+	}
+	if waitTimeoutFlag < 0 {
+		return clierr.Validation(errors.New("--timeout must not be negative"))
+	}
+
+	db, err := state.OpenReadOnly("")
+	if err != nil {
+		return fmt.Errorf("failed to open state database: %w", err)
+	}
+	defer db.Close()
+
+	env, err := resolve.Environment(db, args[0])
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	if waitTimeoutFlag > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, waitTimeoutFlag)
+		defer cancel()
+	}
+
+	if _, err := waitForStatus(ctx, db, env.ID, want, waitPollInterval); err != nil {
+		return err
+	}
+	msg.Printf("%s is %s\n", state.ShortID(env.ID), want)
+	return nil
+}
+
+// waitForStatus polls environment id every interval until it has status
+// want, and returns its record. It gives up if the environment fails or is
+// removed first, since it won't leave those statuses on its own, or if ctx
+// ends; a deadline passing is reported as a timeout.
+func waitForStatus(ctx context.Context, db *state.DB, id string, want state.EnvironmentStatus, interval time.Duration) (*state.Environment, error) {
+	shortID := state.ShortID(id)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		env, err := db.GetEnvironment(id)
+		if errors.Is(err, state.ErrEnvironmentNotFound) {
+			return nil, fmt.Errorf("environment %s was deleted while waiting for it to be %s: %w", shortID, want, err)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to get environment: %w", err)
+		}
+		switch env.Status {
+		case want:
+			return env, nil
+		case state.StatusFailed:
+			return nil, clierr.Backend(fmt.Errorf("environment %s failed while waiting for it to be %s (inspect with: choir env status %s)", shortID, want, shortID))
+		case state.StatusRemoved:
+			return nil, clierr.NotFound(fmt.Errorf("environment %s was removed while waiting for it to be %s", shortID, want))
+		}
+
+		select {
+		case <-ctx.Done():
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				return nil, clierr.Timeout(fmt.Errorf("timed out waiting for environment %s to be %s; it is %s", shortID, want, env.Status))
+			}
+			return nil, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package env
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Quidge/choir/internal/clierr"
+	"github.com/Quidge/choir/internal/state"
+)
+
+func TestWaitForStatus(t *testing.T) {
+	db := openReconcileDB(t)
+	env := newTestEnv("abc123def456abc123def456abc12345")
+	env.Status = state.StatusProvisioning
+	if err := db.CreateEnvironment(env); err != nil {
+		t.Fatal(err)
+	}
+	setStatus := func(status state.EnvironmentStatus) {
+		t.Helper()
+		env.Status = status
+		if err := db.UpdateEnvironment(env); err != nil {
+			t.Fatal(err)
+		}
+	}
+	wait := func(want state.EnvironmentStatus, timeout time.Duration) (*state.Environment, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		return waitForStatus(ctx, db, env.ID, want, time.Millisecond)
+	}
+
+	_, err := wait(state.StatusReady, 20*time.Millisecond)
+	if clierr.KindOf(err) != clierr.KindTimeout {
+		t.Errorf("waiting on a provisioning environment: error = %v, want a timeout", err)
+	}
+
+	ready := *env
+	ready.Status = state.StatusReady
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		if err := db.UpdateEnvironment(&ready); err != nil {
+			t.Error(err)
+		}
+	}()
+	got, err := wait(state.StatusReady, 5*time.Second)
+	if err != nil {
+		t.Fatalf("waitForStatus() failed: %v", err)
+	}
+	if got.Status != state.StatusReady {
+		t.Errorf("Status = %s, want ready", got.Status)
+	}
+
+	setStatus(state.StatusFailed)
+	if _, err := wait(state.StatusReady, 5*time.Second); clierr.KindOf(err) != clierr.KindBackend {
+		t.Errorf("waiting on a failed environment: error = %v, want a backend failure", err)
+	}
+	if _, err := wait(state.StatusFailed, 5*time.Second); err != nil {
+		t.Errorf("waiting for failed: %v", err)
+	}
+}
@@ -0,0 +1,113 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Quidge/choir/cmd/env"
+	"github.com/Quidge/choir/internal/msg"
+	"github.com/Quidge/choir/internal/state"
+	"github.com/spf13/cobra"
+)
+
+var (
+	gcDryRunFlag bool
+	gcForceFlag  bool
+)
+
+var gcCmd = &cobra.Command{
+	Use:   "gc",
+	Short: "Remove expired environments and empty the trash",
+	Long: `Remove environments whose TTL has expired, and purge environments that
+have been in the trash for longer than trash_retention.
+
+Environments get an expiry time from "choir env create --ttl" or from the
+default_ttl (global) and ttl (project) config settings. gc destroys each
+expired environment's workspace and deletes its record, like "choir env rm
+--force", except that a workspace with unpushed commits is kept (and
+reported) unless --force is given. Pending work is backed up to the trash
+first, as by "choir env rm".
+
+"choir env rm" moves environments to the trash rather than destroying them,
+so "choir env restore" can bring them back. gc destroys the ones removed
+longer ago than trash_retention (7 days unless set in the global config),
+backing up any uncommitted or unpushed work in them first.
+
+Run it from cron or a login hook to keep workspaces from piling up.
+
+Use --dry-run to list what would be removed.`,
+	Args: cobra.NoArgs,
+	RunE: runGC,
+}
+
+func init() {
+	rootCmd.AddCommand(gcCmd)
+
+	gcCmd.Flags().BoolVar(&gcDryRunFlag, "dry-run", false, "list expired environments without removing them")
+	gcCmd.Flags().BoolVar(&gcForceFlag, "force", false, "remove expired environments even if they have unpushed commits")
+}
+
+func runGC(cmd *cobra.Command, args []string) error {
+	ctx := context.Background()
+
+	db, err := state.Open("")
+	if err != nil {
+		return fmt.Errorf("failed to open state database: %w", err)
+	}
+	defer db.Close()
+
+	now := time.Now()
+
+	if gcDryRunFlag {
+		return runGCDryRun(db, now)
+	}
+
+	removed, err := env.RemoveExpired(ctx, db, now, env.RemoveOptions{Force: gcForceFlag})
+	for _, e := range removed {
+		msg.Printf("Removed %s\n", state.ShortID(e.ID))
+	}
+	purged, purgeErr := env.PurgeTrash(ctx, db, now)
+	for _, e := range purged {
+		msg.Printf("Purged %s from the trash\n", state.ShortID(e.ID))
+	}
+	if err := errors.Join(err, purgeErr); err != nil {
+		return err
+	}
+	if len(removed)+len(purged) == 0 {
+		msg.Println("No expired environments.")
+	}
+	return nil
+}
+
+// runGCDryRun lists what gc would remove and purge at now.
+func runGCDryRun(db *state.DB, now time.Time) error {
+	expired, err := db.ListEnvironments(state.ListOptions{ExpiredBefore: now})
+	if err != nil {
+		return fmt.Errorf("failed to list environments: %w", err)
+	}
+	trashed, err := env.TrashedBefore(db, now)
+	if err != nil {
+		return err
+	}
+
+	n := 0
+	for _, e := range expired {
+		if e.Status == state.StatusRemoved {
+			continue
+		}
+		fmt.Printf("Would remove %s (expired %s)\n",
+			state.ShortID(e.ID), e.ExpiresAt.Local().Format("2006-01-02 15:04:05"))
+		n++
+	}
+	for _, e := range trashed {
+		fmt.Printf("Would purge %s (removed %s)\n",
+			state.ShortID(e.ID), e.RemovedAt.Local().Format("2006-01-02 15:04:05"))
+		n++
+	}
+	if n == 0 {
+		msg.Println("No expired environments.")
+	}
+	return nil
+}
@@ -6,6 +6,7 @@ import (
 	"path/filepath"
 
 	"github.com/Quidge/choir/internal/config"
+	"github.com/Quidge/choir/internal/msg"
 	"github.com/spf13/cobra"
 )
 
@@ -47,6 +48,6 @@ func runInit(cmd *cobra.Command, _ []string) error {
 		return fmt.Errorf("failed to write %s: %w", config.ProjectConfigFilename, err)
 	}
 
-	fmt.Printf("Created %s\n", config.ProjectConfigFilename)
+	msg.Printf("Created %s\n", config.ProjectConfigFilename)
 	return nil
 }
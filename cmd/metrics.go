@@ -0,0 +1,82 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/Quidge/choir/internal/metrics"
+	"github.com/Quidge/choir/internal/msg"
+	"github.com/Quidge/choir/internal/state"
+	"github.com/spf13/cobra"
+)
+
+var metricsListenFlag string
+
+var metricsCmd = &cobra.Command{
+	Use:   "metrics",
+	Short: "Show or serve operation metrics",
+	Long: `Show operation metrics in the Prometheus text format.
+
+Metrics cover environment creations and failures, setup durations, env exec
+counts and durations, and current environments by status. Counters
+accumulate in the state database across choir invocations.
+
+With --listen, serve them at /metrics until interrupted so Prometheus can
+scrape them. "choir daemon" and "choir serve" serve them at /metrics too.`,
+	Args: cobra.NoArgs,
+	RunE: runMetrics,
+}
+
+func init() {
+	rootCmd.AddCommand(metricsCmd)
+
+	metricsCmd.Flags().StringVar(&metricsListenFlag, "listen", "", "serve /metrics on this address (e.g., 127.0.0.1:9464)")
+}
+
+func runMetrics(cmd *cobra.Command, args []string) error {
+	db, err := state.OpenReadOnly("")
+	if err != nil {
+		return fmt.Errorf("failed to open state database: %w", err)
+	}
+	defer db.Close()
+
+	if metricsListenFlag == "" {
+		return metrics.Write(os.Stdout, db)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Handler(db))
+	srv := &http.Server{
+		Addr:              metricsListenFlag,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- srv.ListenAndServe()
+	}()
+	msg.Fprintf(os.Stderr, "Serving metrics at http://%s/metrics\n", metricsListenFlag)
+
+	select {
+	case err := <-errCh:
+		return fmt.Errorf("metrics server failed: %w", err)
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("failed to shut down metrics server: %w", err)
+	}
+	return nil
+}
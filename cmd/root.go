@@ -5,6 +5,13 @@ import (
 	"os"
 
 	"github.com/Quidge/choir/cmd/env"
+	"github.com/Quidge/choir/internal/clierr"
+	"github.com/Quidge/choir/internal/config"
+	"github.com/Quidge/choir/internal/fault"
+	"github.com/Quidge/choir/internal/msg"
+	"github.com/Quidge/choir/internal/prompt"
+	"github.com/Quidge/choir/internal/repocache"
+	"github.com/Quidge/choir/internal/state"
 	"github.com/spf13/cobra"
 )
 
@@ -13,7 +20,14 @@ var (
 	Version = "dev"
 
 	// Global flags
-	verbose bool
+	verbose        bool
+	quiet          bool
+	nonInteractive bool
+	assumeYes      bool
+	faultSpec      string
+	noCache        bool
+	noStrictConfig bool
+	outputFormat   string
 )
 
 var rootCmd = &cobra.Command{
@@ -24,16 +38,95 @@ AI coding assistants in parallel. Each environment operates in its own
 workspace with full isolation, enabling multiple concurrent workstreams
 on the same codebase without conflicts.`,
 	Version: Version,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		if format := errorFormat(); format != "text" && format != "json" {
+			return clierr.Validation(fmt.Errorf("invalid output format %q: must be text or json", format))
+		}
+		spec := faultSpec
+		if spec == "" {
+			spec = os.Getenv(fault.EnvVar)
+		}
+		return fault.Configure(spec)
+	},
 }
 
+// Execute runs the command line, records it for choir stats if enabled,
+// and exits with the status clierr assigns to the error it fails with, if
+// any.
 func Execute() {
-	if err := rootCmd.Execute(); err != nil {
-		fmt.Fprintln(os.Stderr, err)
-		os.Exit(1)
+	silenceForJSON()
+	cmd, err := rootCmd.ExecuteC()
+	recordUsage(cmd, err)
+	if err != nil {
+		clierr.Report(os.Stderr, err, errorFormat() == "json")
+		os.Exit(clierr.ExitCode(err))
+	}
+}
+
+// errorFormat returns the format errors are reported in: --output if
+// given, else CHOIR_OUTPUT, else text.
+func errorFormat() string {
+	format := outputFormat
+	if format == "" {
+		format = os.Getenv(clierr.EnvOutput)
+	}
+	if format == "" {
+		return "text"
+	}
+	return format
+}
+
+// silenceForJSON stops cobra from printing errors and usage when errors
+// are reported as JSON, so stderr holds only the JSON object. It runs
+// before parsing for CHOIR_OUTPUT and again once --output is parsed.
+func silenceForJSON() {
+	if errorFormat() == "json" {
+		rootCmd.SilenceErrors = true
+		rootCmd.SilenceUsage = true
 	}
 }
 
 func init() {
 	rootCmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "enable verbose output")
+	rootCmd.PersistentFlags().BoolVarP(&quiet, "quiet", "q", false,
+		"print only results, warnings, and errors (also "+msg.EnvQuiet+"=1)")
+	rootCmd.PersistentFlags().BoolVar(&nonInteractive, "non-interactive", false,
+		"never prompt; use defaults or fail (also "+prompt.EnvNonInteractive+"=1)")
+	rootCmd.PersistentFlags().BoolVarP(&assumeYes, "yes", "y", false,
+		"answer yes to confirmations (also "+prompt.EnvAssumeYes+"=1)")
+	rootCmd.PersistentFlags().BoolVar(&noCache, "no-cache", false,
+		"look up repository details with git instead of the cache")
+	rootCmd.PersistentFlags().BoolVar(&noStrictConfig, "no-strict-config", false,
+		"warn about unknown keys in config files instead of failing")
+	rootCmd.PersistentFlags().StringVar(&outputFormat, "output", "",
+		"report errors as text or json (also "+clierr.EnvOutput+"=json)")
+	rootCmd.SetFlagErrorFunc(func(cmd *cobra.Command, err error) error {
+		silenceForJSON()
+		return clierr.Validation(err)
+	})
+	if fault.DebugBuild {
+		rootCmd.PersistentFlags().StringVar(&faultSpec, "choir-fault", "", "inject faults for testing (see package fault)")
+		_ = rootCmd.PersistentFlags().MarkHidden("choir-fault")
+	}
+	cobra.OnInitialize(func() {
+		msg.SetQuiet(quiet)
+		prompt.SetNonInteractive(nonInteractive)
+		prompt.SetAssumeYes(assumeYes)
+		config.SetStrict(!noStrictConfig)
+		repocache.SetDisabled(noCache)
+		applyShortIDLength()
+		silenceForJSON()
+	})
 	rootCmd.AddCommand(env.Cmd)
 }
+
+// applyShortIDLength sets the display length of IDs from
+// naming.short_id_length. A global config that fails to load is left for
+// the commands that use it to report.
+func applyShortIDLength() {
+	global, err := config.LoadGlobalConfig()
+	if err != nil || global.Naming.ShortIDLength == 0 {
+		return
+	}
+	state.SetShortIDLength(global.Naming.ShortIDLength)
+}
@@ -0,0 +1,85 @@
+package cmd
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/Quidge/choir/internal/backend"
+	"github.com/Quidge/choir/internal/backend/conformance"
+	_ "github.com/Quidge/choir/internal/backend/worktree" // Register worktree backend
+	"github.com/Quidge/choir/internal/clierr"
+	"github.com/spf13/cobra"
+)
+
+var selftestCmd = &cobra.Command{
+	Use:   "selftest",
+	Short: "Verify a backend works on this machine",
+	Long: `Verify a backend works on this machine by running the backend conformance
+suite against it: creating and destroying workspaces, mounting files, setting
+environment variables, and running setup commands.
+
+The tests run against a temporary git repository, with workspaces created
+under a temporary data directory, so your repositories and environments are
+never touched. Everything is removed afterwards.
+
+Use --run to run only some tests, matched by name as "go test -run" does
+(e.g., --run FileMounts), and --short to skip the slowest ones. With
+--verbose every test is reported, not only failures.
+
+Examples:
+  choir selftest
+  choir selftest --backend worktree --run Lifecycle -v`,
+	Args: cobra.NoArgs,
+	RunE: runSelftest,
+}
+
+var (
+	selftestBackend string
+	selftestRun     string
+	selftestShort   bool
+)
+
+func init() {
+	selftestCmd.Flags().StringVar(&selftestBackend, "backend", "worktree", "backend type to test")
+	selftestCmd.Flags().StringVar(&selftestRun, "run", "", "run only the tests matching this regular expression")
+	selftestCmd.Flags().BoolVar(&selftestShort, "short", false, "skip the slowest tests")
+	_ = selftestCmd.RegisterFlagCompletionFunc("backend", func(*cobra.Command, []string, string) ([]string, cobra.ShellCompDirective) {
+		return backend.RegisteredTypes(), cobra.ShellCompDirectiveNoFileComp
+	})
+	rootCmd.AddCommand(selftestCmd)
+}
+
+func runSelftest(cmd *cobra.Command, _ []string) error {
+	types := backend.RegisteredTypes()
+	if !slices.Contains(types, selftestBackend) {
+		return clierr.Validation(fmt.Errorf("unknown backend type %q; choose from %s", selftestBackend, strings.Join(types, ", ")))
+	}
+	be, err := backend.Get(backend.BackendConfig{Name: "selftest", Type: selftestBackend})
+	if err != nil {
+		return fmt.Errorf("failed to get backend: %w", err)
+	}
+
+	suite := &conformance.ConformanceSuite{
+		Backend:     be,
+		BackendType: selftestBackend,
+		RepoSetup:   conformance.SetupGitRepo,
+		Short:       selftestShort,
+	}
+	if selftestBackend == "worktree" {
+		suite.HostBacked = true
+		suite.MarkerFile = ".choir-env-marker"
+	}
+	ok, err := conformance.SelfTest(cmd.Context(), suite, conformance.SelfTestOptions{
+		Run:     selftestRun,
+		Verbose: verbose,
+	})
+	if err != nil {
+		return clierr.Validation(err)
+	}
+	if !ok {
+		return clierr.Backend(fmt.Errorf("the %s backend failed its self-test", selftestBackend))
+	}
+	fmt.Printf("ok: the %s backend passed its self-test\n", selftestBackend)
+	return nil
+}
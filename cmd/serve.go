@@ -0,0 +1,173 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/Quidge/choir/cmd/env"
+	"github.com/Quidge/choir/internal/daemon"
+	"github.com/Quidge/choir/internal/msg"
+	"github.com/Quidge/choir/internal/state"
+	"github.com/spf13/cobra"
+)
+
+// EnvServeToken is the environment variable holding the API token for
+// choir serve when --token-file is not given.
+const EnvServeToken = "CHOIR_SERVE_TOKEN"
+
+var (
+	serveListenFlag    string
+	serveTokenFileFlag string
+	serveTLSCertFlag   string
+	serveTLSKeyFlag    string
+)
+
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Serve an authenticated HTTP API for managing environments",
+	Long: `Serve an HTTP API for creating, inspecting, running commands in, and
+removing environments, so an orchestration service or web UI can drive
+choir on this machine remotely.
+
+Every request must carry "Authorization: Bearer <token>". The token is read
+from --token-file, or from ` + EnvServeToken + `; serve refuses to start
+without one. Use --tls-cert and --tls-key to serve HTTPS, which you should do
+whenever the API is reachable from other machines.
+
+Endpoints (JSON in and out):
+  GET    /v1/health                  liveness
+  GET    /v1/environments            list (?backend=, ?repo=, ?status=)
+  POST   /v1/environments            create {"repo", "base", "from_branch", "backend",
+                                     "profile", "template", "ttl", "no_setup"}
+  GET    /v1/environments/{id}       get by ID or unique prefix
+  DELETE /v1/environments/{id}       remove
+  POST   /v1/environments/{id}/exec  run {"command"}; returns output and exit code
+  GET    /metrics                    operation metrics for Prometheus (see "choir metrics")`,
+	Args: cobra.NoArgs,
+	RunE: runServe,
+}
+
+func init() {
+	rootCmd.AddCommand(serveCmd)
+
+	serveCmd.Flags().StringVar(&serveListenFlag, "listen", "127.0.0.1:7420", "address to listen on")
+	serveCmd.Flags().StringVar(&serveTokenFileFlag, "token-file", "", "file containing the API token (default: $"+EnvServeToken+")")
+	serveCmd.Flags().StringVar(&serveTLSCertFlag, "tls-cert", "", "TLS certificate file")
+	serveCmd.Flags().StringVar(&serveTLSKeyFlag, "tls-key", "", "TLS private key file")
+}
+
+func runServe(cmd *cobra.Command, args []string) error {
+	if (serveTLSCertFlag == "") != (serveTLSKeyFlag == "") {
+		return fmt.Errorf("--tls-cert and --tls-key must be given together")
+	}
+
+	token, err := serveToken()
+	if err != nil {
+		return err
+	}
+
+	db, err := state.Open("")
+	if err != nil {
+		return fmt.Errorf("failed to open state database: %w", err)
+	}
+	defer db.Close()
+
+	api := &daemon.Server{DB: db, Ops: serveOps{db: db}}
+	srv := &http.Server{
+		Addr:              serveListenFlag,
+		Handler:           daemon.RequireToken(token, api.Handler()),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	errCh := make(chan error, 1)
+	scheme := "http"
+	if serveTLSCertFlag != "" {
+		scheme = "https"
+		go func() {
+			errCh <- srv.ListenAndServeTLS(serveTLSCertFlag, serveTLSKeyFlag)
+		}()
+	} else {
+		go func() {
+			errCh <- srv.ListenAndServe()
+		}()
+	}
+	msg.Fprintf(os.Stderr, "Serving API at %s://%s/v1/\n", scheme, serveListenFlag)
+
+	select {
+	case err := <-errCh:
+		return fmt.Errorf("API server failed: %w", err)
+	case <-ctx.Done():
+	}
+
+	// Creating an environment can take minutes; give in-flight requests
+	// longer to finish than the metrics server does
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("failed to shut down API server: %w", err)
+	}
+	return nil
+}
+
+// serveToken reads the API token from --token-file or EnvServeToken.
+func serveToken() (string, error) {
+	token := os.Getenv(EnvServeToken)
+	if serveTokenFileFlag != "" {
+		data, err := os.ReadFile(serveTokenFileFlag)
+		if err != nil {
+			return "", fmt.Errorf("failed to read token file: %w", err)
+		}
+		token = string(data)
+	}
+	token = strings.TrimSpace(token)
+	if token == "" {
+		return "", fmt.Errorf("an API token is required: use --token-file or set %s", EnvServeToken)
+	}
+	return token, nil
+}
+
+// serveOps implements the API's environment changes with the same code
+// paths as the env commands.
+type serveOps struct {
+	db *state.DB
+}
+
+func (o serveOps) Create(ctx context.Context, req daemon.CreateRequest) (*state.Environment, error) {
+	return env.CreateEnvironment(ctx, env.CreateOptions{
+		Repo:       req.Repo,
+		Base:       req.Base,
+		FromBranch: req.FromBranch,
+		Backend:    req.Backend,
+		Profile:    req.Profile,
+		Template:   req.Template,
+		TTL:        req.TTL,
+		NoSetup:    req.NoSetup,
+	})
+}
+
+func (o serveOps) Remove(ctx context.Context, e *state.Environment, force bool) error {
+	_, err := env.TrashEnvironment(ctx, o.db, e, env.RemoveOptions{Force: force})
+	return err
+}
+
+func (o serveOps) Exec(ctx context.Context, e *state.Environment, command string) (daemon.ExecResponse, error) {
+	res, err := env.ExecCommand(ctx, o.db, e, command, "")
+	if err != nil {
+		return daemon.ExecResponse{}, err
+	}
+	return daemon.ExecResponse{
+		Output:     res.Output,
+		ExitCode:   res.ExitCode,
+		DurationMS: res.Duration.Milliseconds(),
+	}, nil
+}
@@ -0,0 +1,259 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+
+	"github.com/Quidge/choir/internal/msg"
+	"github.com/Quidge/choir/internal/prompt"
+	"github.com/Quidge/choir/internal/state"
+	"github.com/Quidge/choir/internal/table"
+	"github.com/spf13/cobra"
+)
+
+var stateCmd = &cobra.Command{
+	Use:   "state",
+	Short: "Manage the choir state database",
+	Long: `Manage the choir state database.
+
+Subcommands:
+  export    Write all environment records to JSON
+  import    Load environment records from JSON
+  migrate   Update the database schema
+  rollback  Restore the backup taken before the last migration`,
+}
+
+var stateRollbackCmd = &cobra.Command{
+	Use:   "rollback",
+	Short: "Restore the state database from a pre-migration backup",
+	Long: `Restore the state database from the backup taken before it was last
+migrated.
+
+Before applying new migrations to an existing database, choir copies it to
+state.db.bak-v<N>, where N is the schema version being migrated from. This
+command replaces the database with the newest such backup, or the one for
+--version, and keeps the replaced database as state.db.pre-rollback.
+
+Stop the daemon and any other choir commands first. Records created since
+the backup was taken are lost. The next command run by this version of
+choir migrates the restored database again, so install the earlier version
+of choir before using it if a migration is the problem.`,
+	Args: cobra.NoArgs,
+	RunE: runStateRollback,
+}
+
+var stateMigrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "Update the state database schema",
+	Long: `Apply any pending schema migrations to the state database.
+
+Commands that write to the database migrate it automatically, and read-only
+commands such as "env list" migrate it if its schema is out of date, so
+running this is never required. Use it to migrate ahead of time, for example
+after upgrading choir.
+
+With --status, list every migration and when it was applied instead,
+without changing the database.`,
+	Args: cobra.NoArgs,
+	RunE: runStateMigrate,
+}
+
+var stateExportCmd = &cobra.Command{
+	Use:   "export [FILE]",
+	Short: "Export environment records as JSON",
+	Long: `Export all environment records, command history, and agent runs as
+JSON.
+
+Writes to FILE, or to stdout if FILE is omitted. Use this to back up the
+state database or move records to another machine.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: runStateExport,
+}
+
+var stateImportCmd = &cobra.Command{
+	Use:   "import FILE",
+	Short: "Import environment records from JSON",
+	Long: `Import environment records, command history, and agent runs from a
+JSON export.
+
+Use "-" as FILE to read from stdin. The import runs in a single transaction:
+if it fails, nothing is imported.
+
+Environments whose ID already exists are handled by --on-conflict:
+  fail       abort the import (default)
+  skip       keep the existing record
+  overwrite  replace the existing record and everything recorded for it
+             (command history, setup journal, diagnostics, agent runs,
+             and port forwards)
+
+Imported records keep their original workspace paths, which may not exist
+on this machine.`,
+	Args: cobra.ExactArgs(1),
+	RunE: runStateImport,
+}
+
+func init() {
+	rootCmd.AddCommand(stateCmd)
+	stateCmd.AddCommand(stateExportCmd)
+	stateCmd.AddCommand(stateImportCmd)
+	stateCmd.AddCommand(stateMigrateCmd)
+	stateCmd.AddCommand(stateRollbackCmd)
+
+	stateMigrateCmd.Flags().Bool("status", false, "show applied and pending migrations without migrating")
+	stateRollbackCmd.Flags().Int("version", 0, "schema version of the backup to restore (default: newest)")
+	stateRollbackCmd.Flags().BoolP("force", "f", false, "restore without confirmation")
+	stateImportCmd.Flags().String("on-conflict", string(state.ConflictFail), "how to handle duplicate IDs: fail, skip, or overwrite")
+}
+
+func runStateExport(_ *cobra.Command, args []string) error {
+	db, err := state.OpenReadOnly("")
+	if err != nil {
+		return fmt.Errorf("failed to open state database: %w", err)
+	}
+	defer db.Close()
+
+	snap, err := db.Export()
+	if err != nil {
+		return fmt.Errorf("failed to export state: %w", err)
+	}
+
+	data, err := json.MarshalIndent(snap, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal export: %w", err)
+	}
+	data = append(data, '\n')
+
+	if len(args) == 0 {
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+
+	if err := os.WriteFile(args[0], data, 0600); err != nil {
+		return fmt.Errorf("failed to write %s: %w", args[0], err)
+	}
+	msg.Fprintf(os.Stderr, "Exported %d environments to %s\n", len(snap.Environments), args[0])
+	return nil
+}
+
+func runStateImport(cmd *cobra.Command, args []string) error {
+	onConflict, _ := cmd.Flags().GetString("on-conflict")
+
+	var data []byte
+	var err error
+	if args[0] == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(args[0])
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read import: %w", err)
+	}
+
+	var snap state.Snapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return fmt.Errorf("invalid export file: %w", err)
+	}
+
+	db, err := state.Open("")
+	if err != nil {
+		return fmt.Errorf("failed to open state database: %w", err)
+	}
+	defer db.Close()
+
+	result, err := db.Import(&snap, state.ConflictMode(onConflict))
+	if err != nil {
+		return fmt.Errorf("import failed: %w", err)
+	}
+
+	msg.Printf("Imported %d environments (%d overwritten, %d skipped), %d commands, %d agent runs\n",
+		result.Imported+result.Overwritten, result.Overwritten, result.Skipped, result.Commands, result.AgentRuns)
+	return nil
+}
+
+func runStateMigrate(cmd *cobra.Command, _ []string) error {
+	if status, _ := cmd.Flags().GetBool("status"); status {
+		return runStateMigrateStatus()
+	}
+
+	from, to, err := state.Migrate("")
+	if err != nil {
+		return err
+	}
+	if from == to {
+		msg.Printf("Schema is up to date (version %d)\n", to)
+		return nil
+	}
+	msg.Printf("Migrated schema from version %d to %d\n", from, to)
+	return nil
+}
+
+func runStateRollback(cmd *cobra.Command, _ []string) error {
+	version, _ := cmd.Flags().GetInt("version")
+	force, _ := cmd.Flags().GetBool("force")
+
+	backups, err := state.Backups("")
+	if err != nil {
+		return err
+	}
+	i := 0
+	if version != 0 {
+		i = slices.IndexFunc(backups, func(b state.Backup) bool { return b.Version == version })
+	}
+	if i < 0 || len(backups) == 0 {
+		return fmt.Errorf("%w (backups are taken when choir migrates an existing database)", state.ErrNoBackup)
+	}
+	b := backups[i]
+
+	if !force {
+		question := fmt.Sprintf("Replace the state database with the schema version %d backup from %s?",
+			b.Version, b.CreatedAt.Local().Format("2006-01-02 15:04:05"))
+		ok, err := prompt.ConfirmRequired(question, "use --force to roll back without confirmation")
+		if err != nil {
+			return err
+		}
+		if !ok {
+			fmt.Println("Cancelled.")
+			return nil
+		}
+	}
+
+	if _, err := state.Rollback("", b.Version); err != nil {
+		return err
+	}
+	msg.Printf("Restored %s (schema version %d)\n", b.Path, b.Version)
+	return nil
+}
+
+func runStateMigrateStatus() error {
+	statuses, err := state.MigrationStatuses("")
+	if err != nil {
+		return fmt.Errorf("failed to read migrations: %w", err)
+	}
+
+	t := table.New(
+		table.Column{Header: "VERSION"},
+		table.Column{Header: "NAME", Min: 16},
+		table.Column{Header: "APPLIED"},
+	)
+	pending := 0
+	for _, s := range statuses {
+		applied := "pending"
+		if s.Applied {
+			applied = s.AppliedAt.Local().Format("2006-01-02 15:04:05")
+		} else {
+			pending++
+		}
+		t.Row(strconv.Itoa(s.Version), s.Name, applied)
+	}
+	if err := t.Render(os.Stdout, table.TerminalWidth(os.Stdout)); err != nil {
+		return err
+	}
+	if pending > 0 {
+		fmt.Printf("\n%d pending; run \"choir state migrate\" to apply\n", pending)
+	}
+	return nil
+}
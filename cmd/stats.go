@@ -0,0 +1,163 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Quidge/choir/internal/config"
+	"github.com/Quidge/choir/internal/metrics"
+	"github.com/Quidge/choir/internal/state"
+	"github.com/spf13/cobra"
+)
+
+var statsCmd = &cobra.Command{
+	Use:   "stats",
+	Short: "Summarize how environments and commands have been doing",
+	Long: `Summarize the metrics choir keeps in its state database: current
+environments, how long creating them takes, how often setup fails, and, if
+usage_stats is enabled in the global config, which commands you run most.
+
+Use it to tune setup commands: a high setup failure rate or a slow average
+provision time points at the setup worth fixing. "choir metrics" has the
+same data in the Prometheus format. Nothing is ever sent over the network.`,
+	Args: cobra.NoArgs,
+	RunE: runStats,
+}
+
+func init() {
+	rootCmd.AddCommand(statsCmd)
+}
+
+func runStats(cmd *cobra.Command, args []string) error {
+	db, err := state.OpenReadOnly("")
+	if err != nil {
+		return fmt.Errorf("failed to open state database: %w", err)
+	}
+	defer db.Close()
+
+	summary, err := metrics.Summarize(db)
+	if err != nil {
+		return err
+	}
+	global, err := config.LoadGlobalConfig()
+	if err != nil {
+		return err
+	}
+	printStats(os.Stdout, summary, global.UsageStats)
+	return nil
+}
+
+// printStats writes summary for people to read. usageStats says whether
+// command usage is being recorded.
+func printStats(w io.Writer, s metrics.Summary, usageStats bool) {
+	fmt.Fprintln(w, "Environments:")
+	total := 0
+	for _, status := range state.ValidStatuses {
+		if n := s.Environments[status]; n > 0 {
+			fmt.Fprintf(w, "  %-14s %d\n", status, n)
+			total += n
+		}
+	}
+	if total == 0 {
+		fmt.Fprintln(w, "  none")
+	}
+
+	fmt.Fprintln(w, "\nProvisioning:")
+	fmt.Fprintf(w, "  Created:              %d\n", s.Created)
+	fmt.Fprintf(w, "  Failed:               %d in create, %d in setup\n", s.Failures["create"], s.Failures["setup"])
+	if s.AvgProvision > 0 {
+		fmt.Fprintf(w, "  Avg provision time:   %s\n", formatStatDuration(s.AvgProvision))
+	}
+	if s.SetupRuns > 0 {
+		fmt.Fprintf(w, "  Avg setup time:       %s\n", formatStatDuration(s.AvgSetup))
+		fmt.Fprintf(w, "  Setup failure rate:   %.0f%% (%d of %d)\n", 100*s.SetupFailureRate(), s.Failures["setup"], s.SetupRuns)
+	}
+	if s.ExecRuns > 0 {
+		fmt.Fprintf(w, "  env exec failures:    %d of %d\n", s.ExecFailures, s.ExecRuns)
+	}
+
+	fmt.Fprintln(w, "\nCommands:")
+	if len(s.Commands) == 0 {
+		if usageStats {
+			fmt.Fprintln(w, "  none recorded yet")
+		} else {
+			fmt.Fprintln(w, "  not recorded; enable with \"choir config set usage_stats true\"")
+		}
+		return
+	}
+	width := 0
+	for _, c := range s.Commands {
+		width = max(width, len(c.Command))
+	}
+	for _, c := range s.Commands {
+		line := fmt.Sprintf("  %-*s  %d", width, c.Command, c.Runs)
+		if c.Failures > 0 {
+			line += fmt.Sprintf(" (%d failed)", c.Failures)
+		}
+		fmt.Fprintln(w, line)
+	}
+	if !usageStats {
+		fmt.Fprintln(w, "  (no longer recording; usage_stats is off)")
+	}
+}
+
+// formatStatDuration rounds d for display: to tenths of a second under a
+// minute, else to seconds.
+func formatStatDuration(d time.Duration) string {
+	if d < time.Minute {
+		return fmt.Sprintf("%.1fs", d.Seconds())
+	}
+	return d.Round(time.Second).String()
+}
+
+// unrecordedCommands are the commands, and command groups, that shells run
+// on their own from prompts and completion scripts rather than ones people
+// run. Recording them would write to the database on every prompt.
+var unrecordedCommands = []string{"env current", "env prompt", "completion"}
+
+// recordsUsage reports whether runs of cmd are counted by recordUsage.
+func recordsUsage(cmd *cobra.Command) bool {
+	if cmd == nil || cmd == rootCmd || !cmd.Runnable() || strings.HasPrefix(cmd.Name(), "__") {
+		return false
+	}
+	name := usageName(cmd)
+	for _, skip := range unrecordedCommands {
+		if name == skip || strings.HasPrefix(name, skip+" ") {
+			return false
+		}
+	}
+	return true
+}
+
+// usageName returns cmd's path without the leading "choir".
+func usageName(cmd *cobra.Command) string {
+	return strings.TrimPrefix(cmd.CommandPath(), rootCmd.Name()+" ")
+}
+
+// recordUsage counts a run of cmd in the state database if usage_stats is
+// enabled. Stats must never get in the way of a command, so failures to
+// record them are ignored, and they are dropped rather than creating or
+// migrating the database.
+func recordUsage(cmd *cobra.Command, runErr error) {
+	if !recordsUsage(cmd) {
+		return
+	}
+	global, err := config.LoadGlobalConfig()
+	if err != nil || !global.UsageStats {
+		return
+	}
+	db, err := state.OpenCurrent("")
+	if err != nil {
+		return
+	}
+	defer db.Close()
+
+	result := "success"
+	if runErr != nil {
+		result = "failure"
+	}
+	_ = metrics.IncCounter(db, metrics.CommandsTotal, "command", usageName(cmd), "result", result)
+}
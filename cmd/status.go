@@ -1,23 +1,20 @@
 package cmd
 
 import (
-	"fmt"
-
+	"github.com/Quidge/choir/cmd/env"
 	"github.com/spf13/cobra"
 )
 
 var statusCmd = &cobra.Command{
-	Use:   "status TASK_ID",
-	Short: "Show detailed agent status",
-	Long: `Show detailed status information for an agent.
+	Use:   "status [ID]",
+	Short: "Show detailed environment status",
+	Long: `Show detailed status information for an environment.
 
-Displays task ID, backend, status, branch, base branch, repository,
-remote URL, creation time, and resource allocation.`,
-	Args: cobra.ExactArgs(1),
-	RunE: func(cmd *cobra.Command, args []string) error {
-		taskID := args[0]
-		return fmt.Errorf("status not implemented: %s", taskID)
-	},
+This is equivalent to 'choir env status'. The ID can be a prefix if it
+uniquely identifies an environment. Without an ID, choir lists the
+environments to choose from when run at a terminal.`,
+	Args: env.OptionalIDArg,
+	RunE: env.RunStatus,
 }
 
 func init() {
@@ -0,0 +1,132 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/Quidge/choir/internal/clierr"
+	"github.com/Quidge/choir/internal/msg"
+	"github.com/Quidge/choir/internal/state"
+	"github.com/Quidge/choir/internal/table"
+	"github.com/Quidge/choir/internal/trash"
+	"github.com/spf13/cobra"
+)
+
+var trashCmd = &cobra.Command{
+	Use:   "trash",
+	Short: "List and restore work saved from removed environments",
+	Long: `List and restore work saved from removed environments.
+
+When "choir env rm" or "choir gc" destroys a worktree with uncommitted
+changes or unpushed commits, it first saves them to the trash
+(~/.local/share/choir/trash/) as a git bundle, unless --no-backup is given.
+
+Subcommands:
+  list      List saved work
+  restore   Bring saved work back as a branch`,
+}
+
+var trashListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List work saved from removed environments",
+	Args:  cobra.NoArgs,
+	RunE:  runTrashList,
+}
+
+var trashRestoreCmd = &cobra.Command{
+	Use:   "restore ID",
+	Short: "Restore saved work as a branch",
+	Long: `Fetch work saved from a removed environment back into its repository.
+
+The ID can be a prefix of the environment's ID. The work is restored to the
+environment's branch, or to --branch. A branch that already exists is only
+updated if that fast-forwards it, so restoring never discards commits; use
+--branch to restore alongside it instead. Uncommitted changes come back as
+a commit on top of the branch, which "git reset HEAD~" turns back into
+uncommitted changes once it is checked out.
+
+The entry is deleted from the trash once restored.`,
+	Args: cobra.ExactArgs(1),
+	RunE: runTrashRestore,
+}
+
+var trashRestoreBranchFlag string
+
+func init() {
+	rootCmd.AddCommand(trashCmd)
+	trashCmd.AddCommand(trashListCmd)
+	trashCmd.AddCommand(trashRestoreCmd)
+
+	trashRestoreCmd.Flags().StringVar(&trashRestoreBranchFlag, "branch", "", "branch to restore to (default: the environment's branch)")
+}
+
+func runTrashList(cmd *cobra.Command, args []string) error {
+	entries, err := trash.List()
+	if err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		fmt.Println("The trash is empty.")
+		return nil
+	}
+
+	t := table.New(
+		table.Column{Header: "ID"},
+		table.Column{Header: "BRANCH", Min: 12},
+		table.Column{Header: "REMOVED"},
+		table.Column{Header: "SAVED"},
+		table.Column{Header: "REPO", Min: 16, ElideStart: true},
+	)
+	for _, e := range entries {
+		t.Row(state.ShortID(e.ID), e.Branch, e.RemovedAt.Local().Format("2006-01-02 15:04"), describeSaved(e), e.Repo)
+	}
+	return t.Render(os.Stdout, table.TerminalWidth(os.Stdout))
+}
+
+// describeSaved summarizes the work saved in e, e.g., "2 commits, 3 files".
+func describeSaved(e *trash.Entry) string {
+	var parts []string
+	if e.UnpushedCommits > 0 {
+		parts = append(parts, fmt.Sprintf("%d %s", e.UnpushedCommits, pluralize(e.UnpushedCommits, "commit", "commits")))
+	}
+	if e.UncommittedFiles > 0 {
+		parts = append(parts, fmt.Sprintf("%d uncommitted %s", e.UncommittedFiles, pluralize(e.UncommittedFiles, "file", "files")))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// pluralize returns one if n is 1 and many otherwise.
+func pluralize(n int, one, many string) string {
+	if n == 1 {
+		return one
+	}
+	return many
+}
+
+func runTrashRestore(cmd *cobra.Command, args []string) error {
+	entry, err := trash.Find(args[0])
+	switch {
+	case errors.Is(err, trash.ErrNotFound):
+		return clierr.NotFound(err)
+	case errors.Is(err, trash.ErrAmbiguous):
+		return clierr.Ambiguous(err)
+	case err != nil:
+		return err
+	}
+
+	branch, err := entry.Restore(context.Background(), trashRestoreBranchFlag)
+	if err != nil {
+		return err
+	}
+	if err := entry.Delete(); err != nil {
+		fmt.Fprintf(os.Stderr, "warning: %v\n", err)
+	}
+	msg.Printf("Restored %s to branch %s in %s\n", state.ShortID(entry.ID), branch, entry.Repo)
+	if entry.UncommittedFiles > 0 {
+		msg.Println("Its uncommitted changes are the branch's last commit; \"git reset HEAD~\" after checking it out uncommits them.")
+	}
+	return nil
+}
@@ -26,6 +26,8 @@ import (
 //	| Exec            | Run in directory      | SSH + run         |
 //	| Status          | Check dir exists      | Query VM state    |
 //	| List            | git worktree list     | List VMs          |
+//	| DiskUsage       | Size of worktree dir  | Size of VM disk   |
+//	| PendingWork     | git status, rev-list  | SSH + git status  |
 type Backend interface {
 	// Create provisions a new workspace (worktree, VM, etc.)
 	Create(ctx context.Context, cfg *config.CreateConfig) (backendID string, err error)
@@ -53,6 +55,31 @@ type Backend interface {
 
 	// List returns all choir-managed workspaces.
 	List(ctx context.Context) ([]string, error)
+
+	// DiskUsage returns the number of bytes the workspace occupies on the
+	// host. Data shared with other workspaces (such as a worktree's git
+	// objects) is not counted.
+	DiskUsage(ctx context.Context, backendID string) (uint64, error)
+
+	// PendingWork reports work in the workspace that destroying it would
+	// lose or strand: uncommitted changes and unpushed commits.
+	PendingWork(ctx context.Context, backendID string) (PendingWork, error)
+}
+
+// PendingWork describes uncommitted and unpushed work in a workspace.
+type PendingWork struct {
+	// UncommittedFiles is the number of files with uncommitted changes,
+	// including untracked files. Files choir itself writes are not counted.
+	UncommittedFiles int
+
+	// UnpushedCommits is the number of commits on the workspace's branch
+	// that are on no remote-tracking branch and no other local branch.
+	UnpushedCommits int
+}
+
+// IsZero reports whether there is no pending work.
+func (p PendingWork) IsZero() bool {
+	return p == PendingWork{}
 }
 
 // BackendStatus represents the current state of a backend workspace.
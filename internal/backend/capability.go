@@ -0,0 +1,119 @@
+package backend
+
+import (
+	"fmt"
+
+	"github.com/Quidge/choir/internal/config"
+	"github.com/Quidge/choir/internal/gitutil"
+	"github.com/Quidge/choir/internal/pathutil"
+)
+
+// Capabilities lists the optional features a backend supports that are
+// requested through CreateConfig rather than an optional interface, so
+// callers can refuse config a backend would otherwise silently ignore.
+type Capabilities struct {
+	// NetworkPolicy means the backend enforces CreateConfig.Network.
+	NetworkPolicy bool
+
+	// OutsideMounts means file mounts may target paths outside the
+	// workspace when they set allow_outside_workspace.
+	OutsideMounts bool
+
+	// Resources means the backend allocates CreateConfig.Resources to each
+	// workspace from the host, so env create checks them against the host's
+	// capacity. Backends without it ignore them.
+	Resources bool
+
+	// Paths are the conventions of paths inside workspaces, which file
+	// mount targets are normalized to: the host's for backends whose
+	// workspaces are host directories, Unix (the zero value) for Linux
+	// guests.
+	Paths pathutil.Style
+
+	// SetupWrapper means the backend runs tool installs and setup commands
+	// through CreateConfig.SetupWrapper.
+	SetupWrapper bool
+}
+
+// CapabilityReporter is an optional interface for backends that support
+// any of the features in Capabilities. Backends that don't implement it
+// support none of them.
+//
+// Callers should use CapabilitiesOf rather than a type assertion.
+type CapabilityReporter interface {
+	Capabilities() Capabilities
+}
+
+// CapabilitiesOf returns the capabilities b reports.
+func CapabilitiesOf(b Backend) Capabilities {
+	if r, ok := b.(CapabilityReporter); ok {
+		return r.Capabilities()
+	}
+	return Capabilities{}
+}
+
+// Validate returns an error if cfg can't be created by a backend of type
+// backendType with capabilities caps: it asks for a feature the backend
+// doesn't support, names an invalid branch, has a file mount without a
+// target or escaping the workspace without allowing it, or, for a backend
+// that allocates resources, asks for fewer than one CPU. env create calls
+// it before recording anything, and backends call it again in Create.
+//
+// Checks that depend on the host rather than cfg, such as whether a mount
+// target resolves outside the workspace through a symlink, are left to the
+// backend.
+func Validate(backendType string, caps Capabilities, cfg *config.CreateConfig) error {
+	if !cfg.Network.IsZero() && !caps.NetworkPolicy {
+		return fmt.Errorf("the %s backend doesn't support network policies: its workspaces share the host's network; "+
+			"remove network: from %s or use a VM or container backend", backendType, config.ProjectConfigFilename)
+	}
+	if cfg.BranchName != "" {
+		if err := gitutil.ValidateBranchName(cfg.BranchName); err != nil {
+			return fmt.Errorf("invalid branch: %w", err)
+		}
+	}
+	for _, f := range cfg.Files {
+		if err := validateMount(backendType, caps, f); err != nil {
+			return fmt.Errorf("invalid file mounts: %w", err)
+		}
+	}
+	if cfg.SetupWrapper != "" && !caps.SetupWrapper {
+		return fmt.Errorf("the %s backend doesn't support setup_wrapper: remove it from %s", backendType, config.ProjectConfigFilename)
+	}
+	if caps.Resources && cfg.Resources.CPUs < 1 {
+		return fmt.Errorf("resources.cpus: the %s backend needs at least 1 CPU, got %d", backendType, cfg.Resources.CPUs)
+	}
+	return nil
+}
+
+// validateMount checks the parts of f that Validate covers.
+func validateMount(backendType string, caps Capabilities, f config.FileMount) error {
+	if f.Target == "" {
+		return fmt.Errorf("%s: target is required", f.Source)
+	}
+	if f.AllowOutsideWorkspace {
+		if !caps.OutsideMounts {
+			return fmt.Errorf("%s: the %s backend can't mount files outside the workspace (remove allow_outside_workspace)", f.Target, backendType)
+		}
+		return nil
+	}
+	if caps.Paths.Escapes(f.Target) || caps.Paths.Normalize(f.Target) == "." {
+		return fmt.Errorf("%w: %s (set allow_outside_workspace to permit it)", ErrTargetOutsideWorkspace, f.Target)
+	}
+	return nil
+}
+
+// NormalizeMounts returns files with their targets normalized to the path
+// conventions of workspaces of a backend with capabilities caps, so
+// targets written with either separator work with any backend.
+func NormalizeMounts(caps Capabilities, files []config.FileMount) []config.FileMount {
+	if files == nil {
+		return nil
+	}
+	normalized := make([]config.FileMount, len(files))
+	for i, f := range files {
+		f.Target = caps.Paths.Normalize(f.Target)
+		normalized[i] = f
+	}
+	return normalized
+}
@@ -0,0 +1,80 @@
+package backend
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/Quidge/choir/internal/config"
+	"github.com/Quidge/choir/internal/pathutil"
+)
+
+func TestValidate(t *testing.T) {
+	offline := &config.CreateConfig{Network: config.NetworkPolicy{Offline: true}}
+
+	if err := Validate("worktree", Capabilities{}, &config.CreateConfig{}); err != nil {
+		t.Errorf("Validate() without a policy = %v, want nil", err)
+	}
+	if err := Validate("worktree", Capabilities{}, offline); err == nil {
+		t.Error("Validate() with an unsupported policy succeeded, want error")
+	}
+	if err := Validate("lima", Capabilities{NetworkPolicy: true}, offline); err != nil {
+		t.Errorf("Validate() with a supported policy = %v, want nil", err)
+	}
+}
+
+func TestValidateMountsBranchesResources(t *testing.T) {
+	mounts := func(files ...config.FileMount) *config.CreateConfig {
+		return &config.CreateConfig{Files: files}
+	}
+	outside := config.FileMount{Source: "/tmp/a", Target: "/etc/a", AllowOutsideWorkspace: true}
+
+	tests := []struct {
+		name    string
+		caps    Capabilities
+		cfg     *config.CreateConfig
+		wantErr bool
+	}{
+		{"relative and absolute targets", Capabilities{}, mounts(
+			config.FileMount{Source: "/tmp/a", Target: "a/b"},
+			config.FileMount{Source: "/tmp/a", Target: "/home/ubuntu/.aws"},
+		), false},
+		{"missing target", Capabilities{}, mounts(config.FileMount{Source: "/tmp/a"}), true},
+		{"target escapes", Capabilities{}, mounts(config.FileMount{Source: "/tmp/a", Target: "../a"}), true},
+		{"target is the workspace", Capabilities{}, mounts(config.FileMount{Source: "/tmp/a", Target: "./"}), true},
+		{"target escapes with backslashes", Capabilities{}, mounts(config.FileMount{Source: "/tmp/a", Target: `a\..\..\b`}), true},
+		{"Windows target escapes", Capabilities{Paths: pathutil.Windows}, mounts(config.FileMount{Source: "/tmp/a", Target: "a/../../b"}), true},
+		{"Windows absolute target", Capabilities{Paths: pathutil.Windows}, mounts(config.FileMount{Source: "/tmp/a", Target: `C:\Users\me\.aws`}), false},
+		{"outside mount supported", Capabilities{OutsideMounts: true}, mounts(outside), false},
+		{"outside mount unsupported", Capabilities{}, mounts(outside), true},
+		{"valid branch", Capabilities{}, &config.CreateConfig{BranchName: "env/a1b2"}, false},
+		{"invalid branch", Capabilities{}, &config.CreateConfig{BranchName: "env/a b"}, true},
+		{"resources ignored", Capabilities{}, &config.CreateConfig{}, false},
+		{"resources allocated", Capabilities{Resources: true}, &config.CreateConfig{Resources: config.ResourceLimits{CPUs: 2}}, false},
+		{"no CPUs", Capabilities{Resources: true}, &config.CreateConfig{}, true},
+		{"setup wrapper supported", Capabilities{SetupWrapper: true}, &config.CreateConfig{SetupWrapper: "nix develop -c"}, false},
+		{"setup wrapper unsupported", Capabilities{}, &config.CreateConfig{SetupWrapper: "nix develop -c"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Validate("test", tt.caps, tt.cfg)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	for _, tt := range []struct {
+		paths pathutil.Style
+		want  string
+	}{{pathutil.Unix, "config/app.yaml"}, {pathutil.Windows, `config\app.yaml`}} {
+		got := NormalizeMounts(Capabilities{Paths: tt.paths}, []config.FileMount{{Source: "/tmp/a", Target: `config\./app.yaml`}})
+		if got[0].Target != tt.want {
+			t.Errorf("NormalizeMounts() for %s target = %q, want %q", tt.paths, got[0].Target, tt.want)
+		}
+	}
+
+	err := Validate("test", Capabilities{}, mounts(config.FileMount{Source: "/tmp/a", Target: "../a"}))
+	if !errors.Is(err, ErrTargetOutsideWorkspace) {
+		t.Errorf("Validate() error = %v, want ErrTargetOutsideWorkspace", err)
+	}
+}
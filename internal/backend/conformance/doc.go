@@ -7,6 +7,8 @@
 // # Running Conformance Tests
 //
 // Conformance tests are gated behind build tags and do not run with regular `go test`.
+// The suite itself is not: "choir selftest" runs it against an installed
+// backend (see SelfTest), which is why tests take a T rather than a *testing.T.
 //
 // Run worktree backend conformance tests:
 //
@@ -28,15 +30,17 @@
 //
 //     func TestLimaConformance(t *testing.T) {
 //     be, _ := backend.Get(backend.BackendConfig{Type: "lima"})
-//     suite := &ConformanceSuite{Backend: be, RepoSetup: SetupGitRepo}
-//     suite.Run(t)
+//     suite := &ConformanceSuite{Backend: be, RepoSetup: SetupGitRepo, Short: testing.Short()}
+//     suite.Run(Wrap(t))
 //     }
 //
 // # Test Categories
 //
 // The conformance suite tests:
 //   - Lifecycle: Create, Destroy, Status, Exec operations
-//   - FileMounts: Relative/absolute paths, readonly/writable, directories
+//   - FileMounts: Relative/absolute paths, readonly/writable, directories, unicode and
+//     shell-unfriendly names, deep trees, symlinked sources, large files
 //   - Environment: Environment variable handling and escaping
 //   - SetupCommands: Command execution order, working directory, failure handling
+//   - Isolation: No files leaked into the source repo, marker identity, stable workspace paths
 package conformance
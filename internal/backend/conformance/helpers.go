@@ -1,5 +1,3 @@
-//go:build conformance
-
 // Package conformance provides backend-agnostic conformance tests that verify
 // backends correctly implement the Backend interface contract.
 package conformance
@@ -11,7 +9,6 @@ import (
 	"os/exec"
 	"path/filepath"
 	"strings"
-	"testing"
 	"time"
 
 	"github.com/Quidge/choir/internal/backend"
@@ -33,8 +30,9 @@ type TestEnvConfig struct {
 // TestEnv encapsulates a complete test environment with assertion helpers.
 // It provides a convenient API for conformance tests to verify backend behavior.
 type TestEnv struct {
-	T         *testing.T
+	T         T
 	Backend   backend.Backend
+	ID        string // Environment ID the workspace was created with
 	BackendID string
 	RepoPath  string
 	Ctx       context.Context
@@ -43,7 +41,7 @@ type TestEnv struct {
 
 // NewTestEnv creates a fully provisioned test environment.
 // The environment is automatically cleaned up when the test completes.
-func NewTestEnv(t *testing.T, be backend.Backend, repoPath string, cfg TestEnvConfig) *TestEnv {
+func NewTestEnv(t T, be backend.Backend, repoPath string, cfg TestEnvConfig) *TestEnv {
 	t.Helper()
 
 	timeout := cfg.Timeout
@@ -84,6 +82,7 @@ func NewTestEnv(t *testing.T, be backend.Backend, repoPath string, cfg TestEnvCo
 	return &TestEnv{
 		T:         t,
 		Backend:   be,
+		ID:        envID,
 		BackendID: backendID,
 		RepoPath:  repoPath,
 		Ctx:       ctx,
@@ -93,6 +92,12 @@ func NewTestEnv(t *testing.T, be backend.Backend, repoPath string, cfg TestEnvCo
 
 // RunSetup executes setup with the given config.
 func (e *TestEnv) RunSetup(cfg *backend.SetupConfig) error {
+	_, err := e.RunSetupResult(cfg)
+	return err
+}
+
+// RunSetupResult executes setup with the given config and returns its result.
+func (e *TestEnv) RunSetupResult(cfg *backend.SetupConfig) (*backend.SetupResult, error) {
 	runner := e.Backend.NewSetupRunner(e.BackendID)
 	return runner.Run(e.Ctx, cfg)
 }
@@ -118,7 +123,7 @@ func (e *TestEnv) MustExec(command string) string {
 // AssertFileExists fails if the file doesn't exist in the workspace.
 func (e *TestEnv) AssertFileExists(path string) {
 	e.T.Helper()
-	output, exitCode, _ := e.Exec(fmt.Sprintf("test -e %q && echo OK", path))
+	output, exitCode, _ := e.Exec(fmt.Sprintf("test -e %s && echo OK", shellQuote(path)))
 	if exitCode != 0 || !strings.Contains(output, "OK") {
 		e.T.Errorf("file %q does not exist", path)
 	}
@@ -127,7 +132,7 @@ func (e *TestEnv) AssertFileExists(path string) {
 // AssertFileNotExists fails if the file exists in the workspace.
 func (e *TestEnv) AssertFileNotExists(path string) {
 	e.T.Helper()
-	_, exitCode, _ := e.Exec(fmt.Sprintf("test -e %q", path))
+	_, exitCode, _ := e.Exec(fmt.Sprintf("test -e %s", shellQuote(path)))
 	if exitCode == 0 {
 		e.T.Errorf("file %q should not exist", path)
 	}
@@ -136,7 +141,7 @@ func (e *TestEnv) AssertFileNotExists(path string) {
 // AssertFileContent fails if file content doesn't match expected.
 func (e *TestEnv) AssertFileContent(path, expected string) {
 	e.T.Helper()
-	output := e.MustExec(fmt.Sprintf("cat %q", path))
+	output := e.MustExec(fmt.Sprintf("cat %s", shellQuote(path)))
 	if strings.TrimSpace(output) != expected {
 		e.T.Errorf("file %q: got %q, want %q", path, strings.TrimSpace(output), expected)
 	}
@@ -155,7 +160,7 @@ func (e *TestEnv) AssertEnvVar(name, expected string) {
 // AssertSymlink fails if path is not a symlink.
 func (e *TestEnv) AssertSymlink(path string) {
 	e.T.Helper()
-	_, exitCode, _ := e.Exec(fmt.Sprintf("test -L %q", path))
+	_, exitCode, _ := e.Exec(fmt.Sprintf("test -L %s", shellQuote(path)))
 	if exitCode != 0 {
 		e.T.Errorf("%q is not a symlink", path)
 	}
@@ -164,7 +169,7 @@ func (e *TestEnv) AssertSymlink(path string) {
 // AssertNotSymlink fails if path is a symlink.
 func (e *TestEnv) AssertNotSymlink(path string) {
 	e.T.Helper()
-	_, exitCode, _ := e.Exec(fmt.Sprintf("test -L %q", path))
+	_, exitCode, _ := e.Exec(fmt.Sprintf("test -L %s", shellQuote(path)))
 	if exitCode == 0 {
 		e.T.Errorf("%q should not be a symlink", path)
 	}
@@ -173,7 +178,7 @@ func (e *TestEnv) AssertNotSymlink(path string) {
 // AssertDirectory fails if path is not a directory.
 func (e *TestEnv) AssertDirectory(path string) {
 	e.T.Helper()
-	_, exitCode, _ := e.Exec(fmt.Sprintf("test -d %q", path))
+	_, exitCode, _ := e.Exec(fmt.Sprintf("test -d %s", shellQuote(path)))
 	if exitCode != 0 {
 		e.T.Errorf("%q is not a directory", path)
 	}
@@ -182,7 +187,7 @@ func (e *TestEnv) AssertDirectory(path string) {
 // SetupGitRepo creates a temporary git repository for testing.
 // Uses t.Cleanup() for automatic cleanup.
 // Returns the absolute path to the repo.
-func SetupGitRepo(t *testing.T) string {
+func SetupGitRepo(t T) string {
 	t.Helper()
 
 	tmpDir := t.TempDir()
@@ -216,9 +221,33 @@ func SetupGitRepo(t *testing.T) string {
 	return repoDir
 }
 
+// ListFiles returns the paths of the files and directories under dir on
+// the host, relative to it, skipping the .git directory.
+func ListFiles(t T, dir string) []string {
+	t.Helper()
+	var files []string
+	err := filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() && d.Name() == ".git" {
+			return filepath.SkipDir
+		}
+		if path != dir {
+			rel, _ := filepath.Rel(dir, path)
+			files = append(files, rel)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("failed to list %s: %v", dir, err)
+	}
+	return files
+}
+
 // CreateTestFixtures creates standard test fixtures in the given directory.
 // Returns a map of fixture name to absolute path.
-func CreateTestFixtures(t *testing.T, dir string) map[string]string {
+func CreateTestFixtures(t T, dir string) map[string]string {
 	t.Helper()
 	fixtures := make(map[string]string)
 
@@ -252,6 +281,80 @@ func CreateTestFixtures(t *testing.T, dir string) map[string]string {
 	return fixtures
 }
 
+// CreateTrickyFixtures creates fixtures whose names and shapes are hard to
+// handle: unicode names, spaces and shell metacharacters, a deeply nested
+// tree, and symlinks as sources. Returns a map of fixture name to absolute
+// path. Their contents are listed in TrickyFixtureFiles.
+func CreateTrickyFixtures(t T, dir string) map[string]string {
+	t.Helper()
+	fixtures := make(map[string]string)
+	write := func(path, content string) {
+		t.Helper()
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("failed to create fixture dir: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("failed to create fixture: %v", err)
+		}
+	}
+
+	fixtures["unicode"] = filepath.Join(dir, "naïve café 日本語.txt")
+	write(fixtures["unicode"], "unicode content ✓")
+
+	fixtures["spaces-dir"] = filepath.Join(dir, "dir with spaces")
+	for rel, content := range TrickyFixtureFiles {
+		write(filepath.Join(fixtures["spaces-dir"], rel), content)
+	}
+
+	fixtures["deep-dir"] = filepath.Join(dir, "deep")
+	write(filepath.Join(fixtures["deep-dir"], DeepFixturePath), "bottom")
+
+	fixtures["symlink-file"] = filepath.Join(dir, "link-to-file")
+	if err := os.Symlink(fixtures["unicode"], fixtures["symlink-file"]); err != nil {
+		t.Fatalf("failed to create symlink fixture: %v", err)
+	}
+	fixtures["symlink-dir"] = filepath.Join(dir, "link-to-dir")
+	if err := os.Symlink(fixtures["spaces-dir"], fixtures["symlink-dir"]); err != nil {
+		t.Fatalf("failed to create symlink fixture: %v", err)
+	}
+
+	return fixtures
+}
+
+// TrickyFixtureFiles are the files in the "spaces-dir" fixture, by path
+// relative to it.
+var TrickyFixtureFiles = map[string]string{
+	"plain.txt":                           "plain",
+	"sub dir/file with spaces.txt":        "spaces",
+	"sub dir/it's a \"$QUOTED\" name.txt": "quotes and dollars",
+	"ünïcødé/日本語/ファイル.txt":                "nested unicode",
+}
+
+// DeepFixturePath is the path of the file at the bottom of the "deep-dir"
+// fixture, 32 directories down.
+var DeepFixturePath = strings.Repeat("level/", 32) + "bottom.txt"
+
+// CreateLargeFixture creates a file of size bytes in dir, ending with the
+// line "end", and returns its path. The rest of the file is zeros.
+func CreateLargeFixture(t T, dir string, size int64) string {
+	t.Helper()
+	path := filepath.Join(dir, "large.bin")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("failed to create large fixture: %v", err)
+	}
+	defer f.Close()
+	if _, err := f.WriteAt([]byte("end\n"), size-4); err != nil {
+		t.Fatalf("failed to write large fixture: %v", err)
+	}
+	return path
+}
+
+// shellQuote quotes s for a POSIX shell command line.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
 // cleanGitEnv returns environment variables with GIT_* variables removed
 // to avoid interference from the test environment.
 func cleanGitEnv() []string {
@@ -265,7 +368,7 @@ func cleanGitEnv() []string {
 }
 
 // generateTestID generates a 32-character hex ID for testing.
-func generateTestID(t *testing.T) string {
+func generateTestID(t T) string {
 	t.Helper()
 	// Use a deterministic but unique ID based on test name
 	// This avoids needing crypto/rand in tests
@@ -283,7 +386,7 @@ func generateTestID(t *testing.T) string {
 // SetupXDGDataHome sets XDG_DATA_HOME to a temp directory for testing.
 // This prevents tests from polluting the user's real config directory.
 // Uses t.TempDir() for automatic cleanup and returns the path.
-func SetupXDGDataHome(t *testing.T) string {
+func SetupXDGDataHome(t T) string {
 	t.Helper()
 	xdgDir := t.TempDir()
 	t.Setenv("XDG_DATA_HOME", xdgDir)
@@ -0,0 +1,229 @@
+package conformance
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// SelfTestOptions configure SelfTest.
+type SelfTestOptions struct {
+	// Run, if set, runs only the tests matching it, as go test -run does
+	// (e.g., "FileMounts" or "Lifecycle/CreateAndDestroy").
+	Run string
+
+	// Verbose reports every test, not only failures, as go test -v does.
+	Verbose bool
+
+	// Output receives the results. Defaults to os.Stdout.
+	Output io.Writer
+}
+
+// SelfTest runs the suite outside of go test, so an installed choir can
+// verify a backend on the machine it runs on. Results are written in go
+// test's format. Workspaces are created under a temporary XDG_DATA_HOME,
+// away from the user's environments, and removed afterwards. It reports
+// whether every test that ran passed.
+func SelfTest(ctx context.Context, s *ConformanceSuite, opts SelfTestOptions) (bool, error) {
+	patterns, err := compilePatterns(opts.Run)
+	if err != nil {
+		return false, err
+	}
+	out := opts.Output
+	if out == nil {
+		out = os.Stdout
+	}
+
+	root := &runner{
+		name:     "Conformance",
+		out:      out,
+		verbose:  opts.Verbose,
+		patterns: patterns,
+	}
+	root.ctx, root.cancel = context.WithCancel(ctx)
+	ok := root.run(func(t T) {
+		SetupXDGDataHome(t)
+		s.Run(t)
+	})
+	return ok, nil
+}
+
+// compilePatterns splits run into the patterns for each level of
+// subtests, as go test -run does.
+func compilePatterns(run string) ([]*regexp.Regexp, error) {
+	if run == "" {
+		return nil, nil
+	}
+	var patterns []*regexp.Regexp
+	for _, p := range strings.Split(run, "/") {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid test pattern: %w", err)
+		}
+		patterns = append(patterns, re)
+	}
+	return patterns, nil
+}
+
+// runner is the T SelfTest runs the suite with. Each test runs in its own
+// goroutine, so Fatal and Skip can end it with runtime.Goexit, as in the
+// testing package. Tests run one at a time.
+type runner struct {
+	name     string
+	depth    int
+	out      io.Writer
+	verbose  bool
+	patterns []*regexp.Regexp // Per level below the root, as in go test -run
+
+	ctx      context.Context
+	cancel   context.CancelFunc
+	logs     []string
+	cleanups []func()
+	failed   bool
+	skipped  bool
+}
+
+// run runs f as r's test, then reports the result.
+func (r *runner) run(f func(T)) bool {
+	if r.verbose {
+		fmt.Fprintf(r.out, "=== RUN   %s\n", r.name)
+	}
+	start := time.Now()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		defer r.runCleanups()
+		defer func() {
+			if p := recover(); p != nil {
+				r.Errorf("panic: %v", p)
+			}
+		}()
+		f(r)
+	}()
+	<-done
+
+	result := "PASS"
+	switch {
+	case r.failed:
+		result = "FAIL"
+	case r.skipped:
+		result = "SKIP"
+	}
+	if r.failed || r.verbose {
+		fmt.Fprintf(r.out, "%s--- %s: %s (%.2fs)\n", r.indent(), result, r.name, time.Since(start).Seconds())
+		for _, line := range r.logs {
+			fmt.Fprintf(r.out, "%s    %s\n", r.indent(), strings.ReplaceAll(line, "\n", "\n"+r.indent()+"        "))
+		}
+	}
+	return !r.failed
+}
+
+// runCleanups cancels r's context, then calls its cleanup functions, last
+// registered first.
+func (r *runner) runCleanups() {
+	r.cancel()
+	for i := len(r.cleanups) - 1; i >= 0; i-- {
+		func() {
+			defer func() {
+				if p := recover(); p != nil {
+					r.Errorf("panic in cleanup: %v", p)
+				}
+			}()
+			r.cleanups[i]()
+		}()
+	}
+}
+
+// indent returns the indentation of r's results.
+func (r *runner) indent() string {
+	return strings.Repeat("    ", r.depth)
+}
+
+func (r *runner) Run(name string, f func(T)) bool {
+	if r.depth < len(r.patterns) && !r.patterns[r.depth].MatchString(name) {
+		return true
+	}
+	child := &runner{
+		name:     r.name + "/" + name,
+		depth:    r.depth + 1,
+		out:      r.out,
+		verbose:  r.verbose,
+		patterns: r.patterns,
+	}
+	child.ctx, child.cancel = context.WithCancel(r.ctx)
+	ok := child.run(f)
+	if !ok {
+		r.failed = true
+	}
+	return ok
+}
+
+func (r *runner) Helper() {}
+
+func (r *runner) Logf(format string, args ...any) {
+	r.logs = append(r.logs, fmt.Sprintf(format, args...))
+}
+
+func (r *runner) Error(args ...any) {
+	r.logs = append(r.logs, strings.TrimSuffix(fmt.Sprintln(args...), "\n"))
+	r.failed = true
+}
+
+func (r *runner) Errorf(format string, args ...any) {
+	r.Logf(format, args...)
+	r.failed = true
+}
+
+func (r *runner) Fatal(args ...any) {
+	r.Error(args...)
+	runtime.Goexit()
+}
+
+func (r *runner) Fatalf(format string, args ...any) {
+	r.Errorf(format, args...)
+	runtime.Goexit()
+}
+
+func (r *runner) Skip(args ...any) {
+	if len(args) > 0 {
+		r.logs = append(r.logs, strings.TrimSuffix(fmt.Sprintln(args...), "\n"))
+	}
+	r.skipped = true
+	runtime.Goexit()
+}
+
+func (r *runner) Cleanup(f func()) {
+	r.cleanups = append(r.cleanups, f)
+}
+
+func (r *runner) TempDir() string {
+	dir, err := os.MkdirTemp("", "choir-selftest-")
+	if err != nil {
+		r.Fatalf("TempDir: %v", err)
+	}
+	r.Cleanup(func() { _ = os.RemoveAll(dir) })
+	return dir
+}
+
+func (r *runner) Setenv(key, value string) {
+	prev, had := os.LookupEnv(key)
+	if err := os.Setenv(key, value); err != nil {
+		r.Fatalf("Setenv: %v", err)
+	}
+	r.Cleanup(func() {
+		if had {
+			_ = os.Setenv(key, prev)
+		} else {
+			_ = os.Unsetenv(key)
+		}
+	})
+}
+
+func (r *runner) Context() context.Context {
+	return r.ctx
+}
@@ -0,0 +1,75 @@
+package conformance
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRunner(t *testing.T) {
+	var out strings.Builder
+	var ran, cleaned []string
+	root := &runner{name: "Root", out: &out, ctx: t.Context(), cancel: func() {}}
+	ok := root.run(func(t T) {
+		t.Cleanup(func() { cleaned = append(cleaned, "root") })
+		t.Run("Pass", func(t T) {
+			ran = append(ran, "Pass")
+		})
+		t.Run("Fail", func(t T) {
+			t.Cleanup(func() { cleaned = append(cleaned, "Fail") })
+			t.Fatalf("broken: %d", 42)
+			ran = append(ran, "after Fatalf")
+		})
+		t.Run("Skip", func(t T) {
+			t.Skip("not here")
+			ran = append(ran, "after Skip")
+		})
+		t.Run("Panic", func(t T) {
+			panic("boom")
+		})
+	})
+
+	if ok {
+		t.Error("run() = true, want false after failures")
+	}
+	if strings.Join(ran, ",") != "Pass" {
+		t.Errorf("ran %q, want only Pass", ran)
+	}
+	if strings.Join(cleaned, ",") != "Fail,root" {
+		t.Errorf("cleaned up %q, want Fail then root", cleaned)
+	}
+	for _, want := range []string{"--- FAIL: Root/Fail", "broken: 42", "--- FAIL: Root/Panic", "panic: boom", "--- FAIL: Root ("} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("output missing %q:\n%s", want, out.String())
+		}
+	}
+	if strings.Contains(out.String(), "Root/Pass") {
+		t.Errorf("output reports a passing test without verbose:\n%s", out.String())
+	}
+}
+
+func TestSelfTestPattern(t *testing.T) {
+	suite := &ConformanceSuite{}
+	if _, err := SelfTest(t.Context(), suite, SelfTestOptions{Run: "["}); err == nil {
+		t.Error("SelfTest() with an invalid pattern succeeded, want error")
+	}
+
+	var ran []string
+	root := &runner{name: "Root", out: &strings.Builder{}, ctx: t.Context(), cancel: func() {}}
+	patterns, err := compilePatterns("File/Uni")
+	if err != nil {
+		t.Fatalf("compilePatterns() failed: %v", err)
+	}
+	root.patterns = patterns
+	root.run(func(t T) {
+		for _, name := range []string{"Lifecycle", "FileMounts"} {
+			t.Run(name, func(t T) {
+				for _, sub := range []string{"Relative", "UnicodeAndSpaces"} {
+					t.Run(sub, func(t T) { ran = append(ran, name+"/"+sub) })
+				}
+			})
+		}
+	})
+	if strings.Join(ran, ",") != "FileMounts/UnicodeAndSpaces" {
+		t.Errorf("ran %q, want only FileMounts/UnicodeAndSpaces", ran)
+	}
+}
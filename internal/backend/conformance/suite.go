@@ -1,11 +1,13 @@
-//go:build conformance
-
 package conformance
 
 import (
+	"errors"
 	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
-	"testing"
 	"time"
 
 	"github.com/Quidge/choir/internal/backend"
@@ -26,7 +28,21 @@ type ConformanceSuite struct {
 
 	// RepoSetup is called to create a git repo for each test.
 	// Should use t.Cleanup() for automatic cleanup.
-	RepoSetup func(t *testing.T) string
+	RepoSetup func(t T) string
+
+	// HostBacked is set for backends whose workspaces live on the host
+	// filesystem, where absolute mount targets outside the workspace must
+	// also be rejected.
+	HostBacked bool
+
+	// MarkerFile is the workspace-relative path of the file the backend
+	// records the environment's identity in, if it keeps one. The marker
+	// contract tests are skipped if it is empty.
+	MarkerFile string
+
+	// Short skips the slowest tests, such as copying a large file, as
+	// go test -short does.
+	Short bool
 }
 
 // envConfig returns the TestEnvConfig for this suite.
@@ -38,16 +54,17 @@ func (s *ConformanceSuite) envConfig() TestEnvConfig {
 }
 
 // Run executes all conformance tests.
-func (s *ConformanceSuite) Run(t *testing.T) {
+func (s *ConformanceSuite) Run(t T) {
 	t.Run("Lifecycle", s.testLifecycle)
 	t.Run("FileMounts", s.testFileMounts)
 	t.Run("Environment", s.testEnvironment)
 	t.Run("SetupCommands", s.testSetupCommands)
+	t.Run("Isolation", s.testIsolation)
 }
 
 // testLifecycle tests basic backend lifecycle operations.
-func (s *ConformanceSuite) testLifecycle(t *testing.T) {
-	t.Run("CreateAndDestroy", func(t *testing.T) {
+func (s *ConformanceSuite) testLifecycle(t T) {
+	t.Run("CreateAndDestroy", func(t T) {
 		repoPath := s.RepoSetup(t)
 		env := NewTestEnv(t, s.Backend, repoPath, s.envConfig())
 
@@ -73,7 +90,7 @@ func (s *ConformanceSuite) testLifecycle(t *testing.T) {
 		}
 	})
 
-	t.Run("StatusNotFound", func(t *testing.T) {
+	t.Run("StatusNotFound", func(t T) {
 		status, err := s.Backend.Status(t.Context(), "/nonexistent/conformance-test-path")
 		if err != nil {
 			t.Fatalf("Status() should not error for missing workspace: %v", err)
@@ -83,18 +100,80 @@ func (s *ConformanceSuite) testLifecycle(t *testing.T) {
 		}
 	})
 
-	t.Run("ExecOnNonexistent", func(t *testing.T) {
+	t.Run("ExecOnNonexistent", func(t T) {
 		_, _, err := s.Backend.Exec(t.Context(), "/nonexistent/conformance-test-path", "echo test")
 		if err == nil {
 			t.Error("expected error for exec on nonexistent workspace")
 		}
 	})
+
+	t.Run("DiskUsageGrows", func(t T) {
+		repoPath := s.RepoSetup(t)
+		env := NewTestEnv(t, s.Backend, repoPath, s.envConfig())
+
+		before, err := s.Backend.DiskUsage(env.Ctx, env.BackendID)
+		if err != nil {
+			t.Fatalf("DiskUsage() returned error: %v", err)
+		}
+		env.MustExec("head -c 1048576 /dev/zero > big.bin")
+		after, err := s.Backend.DiskUsage(env.Ctx, env.BackendID)
+		if err != nil {
+			t.Fatalf("DiskUsage() returned error: %v", err)
+		}
+		if after < before+1<<20 {
+			t.Errorf("DiskUsage() = %d after writing 1 MiB, want at least %d", after, before+1<<20)
+		}
+	})
+
+	t.Run("DiskUsageNonexistent", func(t T) {
+		if _, err := s.Backend.DiskUsage(t.Context(), "/nonexistent/conformance-test-path"); err == nil {
+			t.Error("expected error for disk usage of nonexistent workspace")
+		}
+	})
+
+	t.Run("PendingWork", func(t T) {
+		repoPath := s.RepoSetup(t)
+		env := NewTestEnv(t, s.Backend, repoPath, s.envConfig())
+		if err := env.RunSetup(&backend.SetupConfig{Environment: map[string]string{"FOO": "bar"}}); err != nil {
+			t.Fatalf("setup failed: %v", err)
+		}
+
+		pending := func() backend.PendingWork {
+			t.Helper()
+			p, err := s.Backend.PendingWork(env.Ctx, env.BackendID)
+			if err != nil {
+				t.Fatalf("PendingWork() returned error: %v", err)
+			}
+			return p
+		}
+
+		// A fresh workspace, including files setup wrote, has nothing pending
+		if p := pending(); !p.IsZero() {
+			t.Errorf("PendingWork() on fresh workspace = %+v, want none", p)
+		}
+
+		env.MustExec("echo work > notes.txt")
+		if p := pending(); p.UncommittedFiles != 1 || p.UnpushedCommits != 0 {
+			t.Errorf("PendingWork() after writing a file = %+v, want 1 uncommitted file", p)
+		}
+
+		env.MustExec("git add notes.txt && git -c user.name=Test -c user.email=test@example.com commit -q -m notes")
+		if p := pending(); p.UncommittedFiles != 0 || p.UnpushedCommits != 1 {
+			t.Errorf("PendingWork() after committing = %+v, want 1 unpushed commit", p)
+		}
+	})
+
+	t.Run("PendingWorkNonexistent", func(t T) {
+		if _, err := s.Backend.PendingWork(t.Context(), "/nonexistent/conformance-test-path"); err == nil {
+			t.Error("expected error for pending work of nonexistent workspace")
+		}
+	})
 }
 
 // testFileMounts tests file mounting behavior.
 // THIS IS THE CRITICAL TEST SUITE - it would have caught the relative path bug.
-func (s *ConformanceSuite) testFileMounts(t *testing.T) {
-	t.Run("RelativeTargetPath", func(t *testing.T) {
+func (s *ConformanceSuite) testFileMounts(t T) {
+	t.Run("RelativeTargetPath", func(t T) {
 		// THIS TEST WOULD HAVE CAUGHT THE BUG in issue #46
 		// Relative target paths should work - the backend handles them
 		repoPath := s.RepoSetup(t)
@@ -115,7 +194,7 @@ func (s *ConformanceSuite) testFileMounts(t *testing.T) {
 		env.AssertFileContent("config/app.txt", "hello world")
 	})
 
-	t.Run("AbsoluteTargetPath", func(t *testing.T) {
+	t.Run("AbsoluteTargetPath", func(t T) {
 		repoPath := s.RepoSetup(t)
 		env := NewTestEnv(t, s.Backend, repoPath, s.envConfig())
 
@@ -136,7 +215,7 @@ func (s *ConformanceSuite) testFileMounts(t *testing.T) {
 		env.AssertFileContent(absTarget, "hello world")
 	})
 
-	t.Run("ReadOnlyMount", func(t *testing.T) {
+	t.Run("ReadOnlyMount", func(t T) {
 		repoPath := s.RepoSetup(t)
 		env := NewTestEnv(t, s.Backend, repoPath, s.envConfig())
 
@@ -155,7 +234,7 @@ func (s *ConformanceSuite) testFileMounts(t *testing.T) {
 		env.AssertFileContent("readonly.txt", "hello world")
 	})
 
-	t.Run("WritableMount", func(t *testing.T) {
+	t.Run("WritableMount", func(t T) {
 		repoPath := s.RepoSetup(t)
 		env := NewTestEnv(t, s.Backend, repoPath, s.envConfig())
 
@@ -181,7 +260,7 @@ func (s *ConformanceSuite) testFileMounts(t *testing.T) {
 		}
 	})
 
-	t.Run("DirectoryMount", func(t *testing.T) {
+	t.Run("DirectoryMount", func(t T) {
 		repoPath := s.RepoSetup(t)
 		env := NewTestEnv(t, s.Backend, repoPath, s.envConfig())
 
@@ -202,7 +281,7 @@ func (s *ConformanceSuite) testFileMounts(t *testing.T) {
 		env.AssertFileContent("imported-config/nested/deep.txt", "deep content")
 	})
 
-	t.Run("NestedTargetPath", func(t *testing.T) {
+	t.Run("NestedTargetPath", func(t T) {
 		// Target in non-existent directory should create parent dirs
 		repoPath := s.RepoSetup(t)
 		env := NewTestEnv(t, s.Backend, repoPath, s.envConfig())
@@ -221,7 +300,174 @@ func (s *ConformanceSuite) testFileMounts(t *testing.T) {
 		env.AssertFileContent("deep/nested/path/file.txt", "hello world")
 	})
 
-	t.Run("SourceNotFound", func(t *testing.T) {
+	t.Run("TraversalTargetRejected", func(t T) {
+		repoPath := s.RepoSetup(t)
+		env := NewTestEnv(t, s.Backend, repoPath, s.envConfig())
+
+		fixtures := CreateTestFixtures(t, t.TempDir())
+		for _, target := range []string{"../escape.txt", "sub/../../escape.txt", ".", "sub/.."} {
+			err := env.RunSetup(&backend.SetupConfig{
+				Files: []config.FileMount{
+					{Source: fixtures["simple"], Target: target, ReadOnly: false},
+				},
+			})
+			if !errors.Is(err, backend.ErrTargetOutsideWorkspace) {
+				t.Errorf("target %q: error = %v, want ErrTargetOutsideWorkspace", target, err)
+			}
+		}
+		env.AssertFileNotExists("../escape.txt")
+	})
+
+	t.Run("SymlinkTargetRejected", func(t T) {
+		repoPath := s.RepoSetup(t)
+		env := NewTestEnv(t, s.Backend, repoPath, s.envConfig())
+
+		// A directory inside the workspace that links outside it
+		outside := t.TempDir()
+		env.MustExec(fmt.Sprintf("mkdir -p %q && ln -s %q out", outside, outside))
+
+		fixtures := CreateTestFixtures(t, t.TempDir())
+		err := env.RunSetup(&backend.SetupConfig{
+			Files: []config.FileMount{
+				{Source: fixtures["simple"], Target: "out/escape.txt", ReadOnly: false},
+			},
+		})
+		if !errors.Is(err, backend.ErrTargetOutsideWorkspace) {
+			t.Errorf("error = %v, want ErrTargetOutsideWorkspace", err)
+		}
+		env.AssertFileNotExists(outside + "/escape.txt")
+	})
+
+	t.Run("AbsoluteTargetOutsideRejected", func(t T) {
+		if !s.HostBacked {
+			t.Skip("absolute targets are inside the guest for this backend")
+		}
+		repoPath := s.RepoSetup(t)
+		env := NewTestEnv(t, s.Backend, repoPath, s.envConfig())
+
+		fixtures := CreateTestFixtures(t, t.TempDir())
+		target := t.TempDir() + "/escape.txt"
+		err := env.RunSetup(&backend.SetupConfig{
+			Files: []config.FileMount{
+				{Source: fixtures["simple"], Target: target, ReadOnly: false},
+			},
+		})
+		if !errors.Is(err, backend.ErrTargetOutsideWorkspace) {
+			t.Errorf("error = %v, want ErrTargetOutsideWorkspace", err)
+		}
+		env.AssertFileNotExists(target)
+	})
+
+	t.Run("AllowOutsideWorkspace", func(t T) {
+		repoPath := s.RepoSetup(t)
+		env := NewTestEnv(t, s.Backend, repoPath, s.envConfig())
+
+		fixtures := CreateTestFixtures(t, t.TempDir())
+		target := t.TempDir() + "/allowed.txt"
+		err := env.RunSetup(&backend.SetupConfig{
+			Files: []config.FileMount{
+				{Source: fixtures["simple"], Target: target, ReadOnly: false, AllowOutsideWorkspace: true},
+			},
+		})
+		if err != nil {
+			t.Fatalf("setup failed: %v", err)
+		}
+		env.AssertFileContent(target, "hello world")
+	})
+
+	t.Run("UnicodeAndSpaces", func(t T) {
+		repoPath := s.RepoSetup(t)
+		env := NewTestEnv(t, s.Backend, repoPath, s.envConfig())
+
+		fixtures := CreateTrickyFixtures(t, t.TempDir())
+		err := env.RunSetup(&backend.SetupConfig{
+			Files: []config.FileMount{
+				{Source: fixtures["unicode"], Target: "ünï/日本語 linked.txt", ReadOnly: true},
+				{Source: fixtures["unicode"], Target: "ünï/日本語 copied.txt", ReadOnly: false},
+				{Source: fixtures["spaces-dir"], Target: "copied dir", ReadOnly: false},
+			},
+		})
+		if err != nil {
+			t.Fatalf("setup failed: %v", err)
+		}
+
+		env.AssertFileContent("ünï/日本語 linked.txt", "unicode content ✓")
+		env.AssertFileContent("ünï/日本語 copied.txt", "unicode content ✓")
+		for rel, content := range TrickyFixtureFiles {
+			env.AssertFileContent("copied dir/"+rel, content)
+		}
+	})
+
+	t.Run("DeeplyNestedSource", func(t T) {
+		repoPath := s.RepoSetup(t)
+		env := NewTestEnv(t, s.Backend, repoPath, s.envConfig())
+
+		fixtures := CreateTrickyFixtures(t, t.TempDir())
+		err := env.RunSetup(&backend.SetupConfig{
+			Files: []config.FileMount{
+				{Source: fixtures["deep-dir"], Target: "deep", ReadOnly: false},
+			},
+		})
+		if err != nil {
+			t.Fatalf("setup failed: %v", err)
+		}
+
+		env.AssertFileContent("deep/"+DeepFixturePath, "bottom")
+	})
+
+	t.Run("SymlinkedSource", func(t T) {
+		repoPath := s.RepoSetup(t)
+		env := NewTestEnv(t, s.Backend, repoPath, s.envConfig())
+
+		fixtures := CreateTrickyFixtures(t, t.TempDir())
+		err := env.RunSetup(&backend.SetupConfig{
+			Files: []config.FileMount{
+				{Source: fixtures["symlink-file"], Target: "linked.txt", ReadOnly: true},
+				{Source: fixtures["symlink-file"], Target: "copied.txt", ReadOnly: false},
+				{Source: fixtures["symlink-dir"], Target: "copied-dir", ReadOnly: false},
+			},
+		})
+		if err != nil {
+			t.Fatalf("setup failed: %v", err)
+		}
+
+		env.AssertFileContent("linked.txt", "unicode content ✓")
+		// A writable copy holds what the link points at, not the link
+		env.AssertNotSymlink("copied.txt")
+		env.AssertFileContent("copied.txt", "unicode content ✓")
+		env.AssertNotSymlink("copied-dir")
+		env.AssertFileContent("copied-dir/plain.txt", "plain")
+	})
+
+	t.Run("LargeFile", func(t T) {
+		if s.Short {
+			t.Skip("copies a large file")
+		}
+		repoPath := s.RepoSetup(t)
+		env := NewTestEnv(t, s.Backend, repoPath, s.envConfig())
+
+		const size = 300 << 20 // 300 MiB
+		source := CreateLargeFixture(t, t.TempDir(), size)
+		start := time.Now()
+		err := env.RunSetup(&backend.SetupConfig{
+			Files: []config.FileMount{
+				{Source: source, Target: "large.bin", ReadOnly: false},
+			},
+		})
+		if err != nil {
+			t.Fatalf("setup failed: %v", err)
+		}
+		t.Logf("copied %d MiB in %s", size>>20, time.Since(start).Round(time.Millisecond))
+
+		if got := strings.TrimSpace(env.MustExec("wc -c < large.bin")); got != strconv.Itoa(size) {
+			t.Errorf("copy is %s bytes, want %d", got, size)
+		}
+		if got := env.MustExec("tail -c 4 large.bin"); got != "end\n" {
+			t.Errorf("copy ends with %q, want \"end\\n\"", got)
+		}
+	})
+
+	t.Run("SourceNotFound", func(t T) {
 		repoPath := s.RepoSetup(t)
 		env := NewTestEnv(t, s.Backend, repoPath, s.envConfig())
 
@@ -237,8 +483,8 @@ func (s *ConformanceSuite) testFileMounts(t *testing.T) {
 }
 
 // testEnvironment tests environment variable handling.
-func (s *ConformanceSuite) testEnvironment(t *testing.T) {
-	t.Run("BasicEnvVar", func(t *testing.T) {
+func (s *ConformanceSuite) testEnvironment(t T) {
+	t.Run("BasicEnvVar", func(t T) {
 		repoPath := s.RepoSetup(t)
 		env := NewTestEnv(t, s.Backend, repoPath, s.envConfig())
 
@@ -254,7 +500,7 @@ func (s *ConformanceSuite) testEnvironment(t *testing.T) {
 		env.AssertEnvVar("MY_VAR", "my_value")
 	})
 
-	t.Run("SpecialCharacters", func(t *testing.T) {
+	t.Run("SpecialCharacters", func(t T) {
 		repoPath := s.RepoSetup(t)
 		env := NewTestEnv(t, s.Backend, repoPath, s.envConfig())
 
@@ -274,7 +520,7 @@ func (s *ConformanceSuite) testEnvironment(t *testing.T) {
 		env.AssertEnvVar("SPACES", "value with spaces")
 	})
 
-	t.Run("EnvVarPersistence", func(t *testing.T) {
+	t.Run("EnvVarPersistence", func(t T) {
 		// Env vars should persist across Exec calls
 		repoPath := s.RepoSetup(t)
 		env := NewTestEnv(t, s.Backend, repoPath, s.envConfig())
@@ -294,7 +540,7 @@ func (s *ConformanceSuite) testEnvironment(t *testing.T) {
 		}
 	})
 
-	t.Run("EmptyValue", func(t *testing.T) {
+	t.Run("EmptyValue", func(t T) {
 		repoPath := s.RepoSetup(t)
 		env := NewTestEnv(t, s.Backend, repoPath, s.envConfig())
 
@@ -315,7 +561,7 @@ func (s *ConformanceSuite) testEnvironment(t *testing.T) {
 		env.AssertEnvVar("EMPTY", "")
 	})
 
-	t.Run("EmptyEnvironment", func(t *testing.T) {
+	t.Run("EmptyEnvironment", func(t T) {
 		// No environment variables should not create .choir-env file
 		repoPath := s.RepoSetup(t)
 		env := NewTestEnv(t, s.Backend, repoPath, s.envConfig())
@@ -333,8 +579,8 @@ func (s *ConformanceSuite) testEnvironment(t *testing.T) {
 }
 
 // testSetupCommands tests setup command execution.
-func (s *ConformanceSuite) testSetupCommands(t *testing.T) {
-	t.Run("ExecutionOrder", func(t *testing.T) {
+func (s *ConformanceSuite) testSetupCommands(t T) {
+	t.Run("ExecutionOrder", func(t T) {
 		repoPath := s.RepoSetup(t)
 		env := NewTestEnv(t, s.Backend, repoPath, s.envConfig())
 
@@ -356,7 +602,7 @@ func (s *ConformanceSuite) testSetupCommands(t *testing.T) {
 		}
 	})
 
-	t.Run("WorkingDirectory", func(t *testing.T) {
+	t.Run("WorkingDirectory", func(t T) {
 		repoPath := s.RepoSetup(t)
 		env := NewTestEnv(t, s.Backend, repoPath, s.envConfig())
 
@@ -375,7 +621,7 @@ func (s *ConformanceSuite) testSetupCommands(t *testing.T) {
 		}
 	})
 
-	t.Run("EnvVarsAvailable", func(t *testing.T) {
+	t.Run("EnvVarsAvailable", func(t T) {
 		repoPath := s.RepoSetup(t)
 		env := NewTestEnv(t, s.Backend, repoPath, s.envConfig())
 
@@ -397,7 +643,7 @@ func (s *ConformanceSuite) testSetupCommands(t *testing.T) {
 		}
 	})
 
-	t.Run("FailureStopsExecution", func(t *testing.T) {
+	t.Run("FailureStopsExecution", func(t T) {
 		repoPath := s.RepoSetup(t)
 		env := NewTestEnv(t, s.Backend, repoPath, s.envConfig())
 
@@ -418,7 +664,33 @@ func (s *ConformanceSuite) testSetupCommands(t *testing.T) {
 		}
 	})
 
-	t.Run("EmptyCommands", func(t *testing.T) {
+	t.Run("Result", func(t T) {
+		repoPath := s.RepoSetup(t)
+		env := NewTestEnv(t, s.Backend, repoPath, s.envConfig())
+
+		result, err := env.RunSetupResult(&backend.SetupConfig{
+			SetupCommands: []string{
+				"echo out; echo err >&2",
+				"exit 3",
+				"echo never",
+			},
+		})
+		if err == nil {
+			t.Fatal("expected error for failing command")
+		}
+		if result == nil || len(result.Commands) != 2 {
+			t.Fatalf("result = %+v, want the two commands that ran", result)
+		}
+		first := result.Commands[0]
+		if first.ExitCode != 0 || first.Output != "out\nerr\n" {
+			t.Errorf("first command = exit %d, output %q; want exit 0 with both streams", first.ExitCode, first.Output)
+		}
+		if failed := result.Failed(); failed == nil || failed.Command != "exit 3" || failed.ExitCode != 3 {
+			t.Errorf("Failed() = %+v, want \"exit 3\" with exit code 3", failed)
+		}
+	})
+
+	t.Run("EmptyCommands", func(t T) {
 		// No setup commands should succeed
 		repoPath := s.RepoSetup(t)
 		env := NewTestEnv(t, s.Backend, repoPath, s.envConfig())
@@ -431,3 +703,76 @@ func (s *ConformanceSuite) testSetupCommands(t *testing.T) {
 		}
 	})
 }
+
+// testIsolation tests that workspaces keep to themselves: nothing is
+// written into the source repository, the marker identifies the
+// environment, and the workspace stays where Create put it.
+func (s *ConformanceSuite) testIsolation(t T) {
+	t.Run("SourceRepoUntouched", func(t T) {
+		repoPath := s.RepoSetup(t)
+		before := ListFiles(t, repoPath)
+		env := NewTestEnv(t, s.Backend, repoPath, s.envConfig())
+
+		fixtures := CreateTestFixtures(t, t.TempDir())
+		err := env.RunSetup(&backend.SetupConfig{
+			Environment: map[string]string{"ISOLATED": "yes"},
+			Files: []config.FileMount{
+				{Source: fixtures["simple"], Target: "linked.txt", ReadOnly: true},
+				{Source: fixtures["config-dir"], Target: "copied", ReadOnly: false},
+			},
+			SetupCommands: []string{"echo built > build.log"},
+		})
+		if err != nil {
+			t.Fatalf("setup failed: %v", err)
+		}
+
+		// Choir's own files belong in the workspace...
+		env.AssertFileExists(".choir-env")
+		env.AssertFileExists("build.log")
+		// ...and nothing of the workspace belongs in the source repo
+		if after := ListFiles(t, repoPath); !slices.Equal(before, after) {
+			t.Errorf("source repo files changed:\nbefore: %q\nafter:  %q", before, after)
+		}
+	})
+
+	t.Run("MarkerRecordsID", func(t T) {
+		if s.MarkerFile == "" {
+			t.Skip("backend keeps no marker file")
+		}
+		repoPath := s.RepoSetup(t)
+		env := NewTestEnv(t, s.Backend, repoPath, s.envConfig())
+
+		output := env.MustExec(fmt.Sprintf("cat %q", s.MarkerFile))
+		if !strings.Contains(output, env.ID) {
+			t.Errorf("marker %s doesn't record ID %s:\n%s", s.MarkerFile, env.ID, output)
+		}
+		if _, err := os.Stat(filepath.Join(repoPath, s.MarkerFile)); err == nil {
+			t.Errorf("marker %s was written to the source repo", s.MarkerFile)
+		}
+	})
+
+	t.Run("WorkspacePathStable", func(t T) {
+		repoPath := s.RepoSetup(t)
+		env := NewTestEnv(t, s.Backend, repoPath, s.envConfig())
+
+		if s.HostBacked && !filepath.IsAbs(env.BackendID) {
+			t.Errorf("Create() returned %q, want an absolute path", env.BackendID)
+		}
+		first := strings.TrimSpace(env.MustExec("pwd"))
+		for i := 0; i < 3; i++ {
+			status, err := s.Backend.Status(env.Ctx, env.BackendID)
+			if err != nil {
+				t.Fatalf("Status() returned error: %v", err)
+			}
+			if status.State != backend.StateRunning {
+				t.Errorf("Status() call %d: state %v, want Running", i+1, status.State)
+			}
+			if pwd := strings.TrimSpace(env.MustExec("pwd")); pwd != first {
+				t.Errorf("Exec() call %d ran in %q, first ran in %q", i+1, pwd, first)
+			}
+		}
+		if s.HostBacked && first != env.BackendID {
+			t.Errorf("Exec() ran in %q, want the workspace %q", first, env.BackendID)
+		}
+	})
+}
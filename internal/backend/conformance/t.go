@@ -0,0 +1,25 @@
+package conformance
+
+import "context"
+
+// T is the part of *testing.T the suite uses. Under go test the suite runs
+// with a *testing.T adapted by Wrap; "choir selftest" runs it with a T of
+// its own (see SelfTest), as the testing package can't run tests outside
+// of go test.
+type T interface {
+	Helper()
+	Error(args ...any)
+	Errorf(format string, args ...any)
+	Fatal(args ...any)
+	Fatalf(format string, args ...any)
+	Logf(format string, args ...any)
+	Skip(args ...any)
+	Cleanup(f func())
+	TempDir() string
+	Setenv(key, value string)
+	Context() context.Context
+
+	// Run runs f as a subtest of t called name, and reports whether it
+	// succeeded.
+	Run(name string, f func(t T)) bool
+}
@@ -15,7 +15,9 @@ import (
 // followed by worktree-specific tests.
 //
 // Run with: go test -tags=conformance,worktree ./internal/backend/conformance
-func TestWorktreeConformance(t *testing.T) {
+func TestWorktreeConformance(tt *testing.T) {
+	t := Wrap(tt)
+
 	// Set up XDG_DATA_HOME to a temp directory to avoid polluting user's config
 	SetupXDGDataHome(t)
 
@@ -31,13 +33,16 @@ func TestWorktreeConformance(t *testing.T) {
 		Backend:     be,
 		BackendType: "worktree",
 		RepoSetup:   SetupGitRepo,
+		HostBacked:  true,
+		MarkerFile:  ".choir-env-marker",
+		Short:       testing.Short(),
 	}
 
 	// Run generic Backend interface conformance tests
 	suite.Run(t)
 
 	// Run worktree-specific tests (not part of generic Backend interface)
-	t.Run("WorktreeSpecific", func(t *testing.T) {
+	t.Run("WorktreeSpecific", func(t T) {
 		testConfigIsolation(t, be)
 	})
 }
@@ -45,11 +50,11 @@ func TestWorktreeConformance(t *testing.T) {
 // testConfigIsolation verifies that the worktree backend enables
 // extensions.worktreeConfig, allowing per-worktree git configuration that
 // doesn't pollute the main repository's .git/config.
-func testConfigIsolation(t *testing.T, be backend.Backend) {
+func testConfigIsolation(t T, be backend.Backend) {
 	repoPath := SetupGitRepo(t)
 	env := NewTestEnv(t, be, repoPath, TestEnvConfig{BackendType: "worktree"})
 
-	t.Run("ExtensionEnabled", func(t *testing.T) {
+	t.Run("ExtensionEnabled", func(t T) {
 		// Verify extensions.worktreeConfig is enabled on the main repo
 		cmd := exec.Command("git", "config", "--get", "extensions.worktreeConfig")
 		cmd.Dir = repoPath
@@ -63,7 +68,7 @@ func testConfigIsolation(t *testing.T, be backend.Backend) {
 		}
 	})
 
-	t.Run("ConfigIsolation", func(t *testing.T) {
+	t.Run("ConfigIsolation", func(t T) {
 		// Get original user.name from main repo
 		cmd := exec.Command("git", "config", "--get", "user.name")
 		cmd.Dir = repoPath
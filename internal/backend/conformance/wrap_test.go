@@ -0,0 +1,21 @@
+//go:build conformance
+
+package conformance
+
+import "testing"
+
+// testingT adapts a *testing.T to T.
+type testingT struct {
+	*testing.T
+}
+
+// Wrap adapts t to T, for running the suite under go test.
+func Wrap(t *testing.T) T {
+	return testingT{t}
+}
+
+func (t testingT) Run(name string, f func(t T)) bool {
+	return t.T.Run(name, func(t *testing.T) {
+		f(testingT{t})
+	})
+}
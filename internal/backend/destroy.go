@@ -0,0 +1,51 @@
+package backend
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrUnpushedWork is returned by SafeDestroyer.DestroyWithOptions, wrapped
+// with details, when the workspace has unpushed commits and Force isn't set.
+var ErrUnpushedWork = errors.New("workspace has unpushed commits")
+
+// DestroyOptions control SafeDestroyer.DestroyWithOptions.
+type DestroyOptions struct {
+	// Force destroys the workspace even if it has unpushed commits.
+	Force bool
+
+	// Backup saves the workspace's pending work (see PendingWork) to the
+	// trash before destroying it, so "choir trash restore" can bring it
+	// back. A workspace without pending work saves nothing.
+	Backup bool
+}
+
+// SafeDestroyer is an optional interface for backends that can refuse to
+// destroy a workspace holding work that isn't anywhere else, and back that
+// work up first when told to go ahead. Destroy on such backends behaves as
+// DestroyWithOptions with Force set and Backup unset.
+//
+// Callers should check for it with a type assertion. Removals nobody
+// confirmed, such as TTL expiry, leave Force unset so they fail with
+// ErrUnpushedWork rather than silently losing commits.
+type SafeDestroyer interface {
+	// DestroyWithOptions destroys the workspace as Destroy does, after the
+	// checks and backup opts ask for.
+	DestroyWithOptions(ctx context.Context, backendID string, opts DestroyOptions) error
+}
+
+// Trasher is an optional interface for backends that can set a workspace
+// aside instead of destroying it, so "choir env rm" can keep removed
+// environments restorable. A trashed workspace keeps its content, and
+// Destroy still destroys it for good.
+//
+// Callers should check for it with a type assertion; environments on other
+// backends are destroyed when removed.
+type Trasher interface {
+	// Trash moves the workspace out of use and returns its new backend ID.
+	Trash(ctx context.Context, backendID string) (string, error)
+
+	// Untrash moves a trashed workspace back into use and returns its new
+	// backend ID.
+	Untrash(ctx context.Context, backendID string) (string, error)
+}
@@ -0,0 +1,322 @@
+// Package fake provides an in-memory Backend for tests and simulations.
+// Workspaces are plain records; no files or processes are created.
+//
+// The fake backend is not registered with the backend registry, so it is
+// never selectable from user configuration. Construct it with New.
+package fake
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/Quidge/choir/internal/backend"
+	"github.com/Quidge/choir/internal/config"
+)
+
+// Op identifies a backend operation for fault injection.
+type Op string
+
+const (
+	OpCreate  Op = "create"
+	OpSetup   Op = "setup"
+	OpStart   Op = "start"
+	OpStop    Op = "stop"
+	OpDestroy Op = "destroy"
+	OpExec    Op = "exec"
+	OpForward Op = "forward"
+	OpBake    Op = "bake"
+)
+
+// ErrNotFound is returned for operations on unknown workspaces.
+var ErrNotFound = errors.New("workspace not found")
+
+// ErrInjected is the default error returned by injected faults.
+var ErrInjected = errors.New("injected fault")
+
+// Backend is an in-memory backend.Backend implementation.
+type Backend struct {
+	// Fault, if set, is called before each operation. A non-nil return
+	// makes the operation fail with that error and leaves state unchanged.
+	Fault func(op Op, backendID string) error
+
+	// ExecFunc, if set, computes the output and exit code of Exec.
+	// By default Exec succeeds with empty output.
+	ExecFunc func(backendID, command string) (string, int)
+
+	// PendingWorkFunc, if set, computes the result of PendingWork.
+	// By default workspaces have no pending work.
+	PendingWorkFunc func(backendID string) backend.PendingWork
+
+	// Caps is what Capabilities reports. The fake enforces none of them.
+	Caps backend.Capabilities
+
+	mu         sync.Mutex
+	workspaces map[string]backend.WorkspaceState
+	forwards   map[string]string // Workspace ID by forward ID
+	images     map[string]backend.ImageSpec
+	clonedFrom map[string]string // Image ID by workspace ID
+	nextID     int
+}
+
+// New returns an empty fake backend.
+func New() *Backend {
+	return &Backend{
+		workspaces: make(map[string]backend.WorkspaceState),
+		forwards:   make(map[string]string),
+		images:     make(map[string]backend.ImageSpec),
+		clonedFrom: make(map[string]string),
+	}
+}
+
+var (
+	_ backend.Backend            = (*Backend)(nil)
+	_ backend.PortForwarder      = (*Backend)(nil)
+	_ backend.CapabilityReporter = (*Backend)(nil)
+	_ backend.ImageBaker         = (*Backend)(nil)
+)
+
+// Capabilities returns Caps.
+func (b *Backend) Capabilities() backend.Capabilities {
+	return b.Caps
+}
+
+func (b *Backend) fault(op Op, backendID string) error {
+	if b.Fault == nil {
+		return nil
+	}
+	return b.Fault(op, backendID)
+}
+
+// Create adds a running workspace.
+func (b *Backend) Create(ctx context.Context, cfg *config.CreateConfig) (string, error) {
+	if err := b.fault(OpCreate, ""); err != nil {
+		return "", err
+	}
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate workspace ID: %w", err)
+	}
+	id := "fake-" + hex.EncodeToString(buf)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if cfg.Image != "" {
+		if _, ok := b.images[cfg.Image]; !ok {
+			return "", fmt.Errorf("image %s not found", cfg.Image)
+		}
+		b.clonedFrom[id] = cfg.Image
+	}
+	b.workspaces[id] = backend.StateRunning
+	return id, nil
+}
+
+// NewSetupRunner returns a runner that only consults the fault hook.
+func (b *Backend) NewSetupRunner(backendID string) backend.SetupRunner {
+	return &setupRunner{b: b, backendID: backendID}
+}
+
+// Start marks a workspace running.
+func (b *Backend) Start(ctx context.Context, backendID string) error {
+	return b.transition(OpStart, backendID, backend.StateRunning)
+}
+
+// Stop marks a workspace stopped.
+func (b *Backend) Stop(ctx context.Context, backendID string) error {
+	return b.transition(OpStop, backendID, backend.StateStopped)
+}
+
+// Destroy deletes a workspace.
+func (b *Backend) Destroy(ctx context.Context, backendID string) error {
+	if err := b.fault(OpDestroy, backendID); err != nil {
+		return err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.workspaces[backendID]; !ok {
+		return fmt.Errorf("%w: %s", ErrNotFound, backendID)
+	}
+	delete(b.workspaces, backendID)
+	delete(b.clonedFrom, backendID)
+	return nil
+}
+
+// Shell is a no-op.
+func (b *Backend) Shell(ctx context.Context, backendID string) error {
+	return nil
+}
+
+// Exec runs a command in a running workspace using ExecFunc.
+func (b *Backend) Exec(ctx context.Context, backendID string, command string) (string, int, error) {
+	if err := b.fault(OpExec, backendID); err != nil {
+		return "", -1, err
+	}
+	b.mu.Lock()
+	st, ok := b.workspaces[backendID]
+	b.mu.Unlock()
+	if !ok {
+		return "", -1, fmt.Errorf("%w: %s", ErrNotFound, backendID)
+	}
+	if st != backend.StateRunning {
+		return "", -1, fmt.Errorf("workspace %s is %s", backendID, st)
+	}
+	if b.ExecFunc == nil {
+		return "", 0, nil
+	}
+	output, exitCode := b.ExecFunc(backendID, command)
+	return output, exitCode, nil
+}
+
+// DiskUsage returns zero for existing workspaces; fake workspaces have no
+// files.
+func (b *Backend) DiskUsage(ctx context.Context, backendID string) (uint64, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.workspaces[backendID]; !ok {
+		return 0, fmt.Errorf("%w: %s", ErrNotFound, backendID)
+	}
+	return 0, nil
+}
+
+// PendingWork returns PendingWorkFunc's result for existing workspaces.
+func (b *Backend) PendingWork(ctx context.Context, backendID string) (backend.PendingWork, error) {
+	b.mu.Lock()
+	_, ok := b.workspaces[backendID]
+	b.mu.Unlock()
+	if !ok {
+		return backend.PendingWork{}, fmt.Errorf("%w: %s", ErrNotFound, backendID)
+	}
+	if b.PendingWorkFunc == nil {
+		return backend.PendingWork{}, nil
+	}
+	return b.PendingWorkFunc(backendID), nil
+}
+
+// Status reports a workspace's state, or StateNotFound.
+func (b *Backend) Status(ctx context.Context, backendID string) (backend.BackendStatus, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	st, ok := b.workspaces[backendID]
+	if !ok {
+		return backend.BackendStatus{State: backend.StateNotFound}, nil
+	}
+	return backend.BackendStatus{State: st}, nil
+}
+
+// List returns all workspace IDs in sorted order.
+func (b *Backend) List(ctx context.Context) ([]string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	ids := make([]string, 0, len(b.workspaces))
+	for id := range b.workspaces {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// ForwardPort records a forward from a running workspace; nothing listens.
+func (b *Backend) ForwardPort(ctx context.Context, backendID string, guestPort, hostPort int) (string, error) {
+	if err := b.fault(OpForward, backendID); err != nil {
+		return "", err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if st, ok := b.workspaces[backendID]; !ok {
+		return "", fmt.Errorf("%w: %s", ErrNotFound, backendID)
+	} else if st != backend.StateRunning {
+		return "", fmt.Errorf("workspace %s is %s", backendID, st)
+	}
+	b.nextID++
+	id := fmt.Sprintf("forward-%d", b.nextID)
+	b.forwards[id] = backendID
+	return id, nil
+}
+
+// StopForward deletes a forward.
+func (b *Backend) StopForward(ctx context.Context, backendID, forwardID string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.forwards, forwardID)
+	return nil
+}
+
+// Forwards returns the number of active forwards from a workspace.
+func (b *Backend) Forwards(backendID string) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	n := 0
+	for _, id := range b.forwards {
+		if id == backendID {
+			n++
+		}
+	}
+	return n
+}
+
+// BakeImage records an image for spec.
+func (b *Backend) BakeImage(ctx context.Context, spec backend.ImageSpec) (string, error) {
+	if err := b.fault(OpBake, ""); err != nil {
+		return "", err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.nextID++
+	id := fmt.Sprintf("image-%d", b.nextID)
+	b.images[id] = spec
+	return id, nil
+}
+
+// DeleteImage deletes an image. Workspaces cloned from it are unaffected.
+func (b *Backend) DeleteImage(ctx context.Context, imageID string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.images[imageID]; !ok {
+		return fmt.Errorf("image %s not found", imageID)
+	}
+	delete(b.images, imageID)
+	return nil
+}
+
+// Images returns the number of images baked and not deleted.
+func (b *Backend) Images() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.images)
+}
+
+// ClonedFrom returns the image a workspace was created from, or "".
+func (b *Backend) ClonedFrom(backendID string) string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.clonedFrom[backendID]
+}
+
+func (b *Backend) transition(op Op, backendID string, to backend.WorkspaceState) error {
+	if err := b.fault(op, backendID); err != nil {
+		return err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.workspaces[backendID]; !ok {
+		return fmt.Errorf("%w: %s", ErrNotFound, backendID)
+	}
+	b.workspaces[backendID] = to
+	return nil
+}
+
+type setupRunner struct {
+	b         *Backend
+	backendID string
+}
+
+func (r *setupRunner) Run(ctx context.Context, cfg *backend.SetupConfig) (*backend.SetupResult, error) {
+	if err := ctx.Err(); err != nil {
+		return &backend.SetupResult{}, err
+	}
+	return &backend.SetupResult{}, r.b.fault(OpSetup, r.backendID)
+}
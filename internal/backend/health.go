@@ -0,0 +1,17 @@
+package backend
+
+import "context"
+
+// HealthChecker is an optional interface for backends that can check the
+// host prerequisites they need for any workspace at all: tools installed,
+// daemons reachable, directories writable. Unlike Preflight, it doesn't
+// depend on what is being created.
+//
+// Callers should check for it with a type assertion. "choir doctor" reports
+// its result, and env create runs it before anything else backend-specific,
+// so a missing tool is reported as such rather than as a failed Create.
+type HealthChecker interface {
+	// HealthCheck returns an error describing every unmet prerequisite, or
+	// nil if the backend is usable.
+	HealthCheck(ctx context.Context) error
+}
@@ -0,0 +1,53 @@
+package backend
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"slices"
+
+	"github.com/Quidge/choir/internal/config"
+)
+
+// ImageSpec is what goes into a base image baked by an ImageBaker.
+type ImageSpec struct {
+	BaseImage   string                   // Image to start from (e.g., "ubuntu:24.04")
+	Packages    []string                 // Packages to install
+	Credentials config.CredentialsConfig // Credentials to copy in
+}
+
+// Key identifies the image spec describes by its base image and packages,
+// in any order, so environments asking for the same ones share it.
+// Credentials aren't part of the key.
+func (s ImageSpec) Key() string {
+	packages := slices.Clone(s.Packages)
+	slices.Sort(packages)
+	packages = slices.Compact(packages)
+
+	h := sha256.New()
+	h.Write([]byte(s.BaseImage))
+	for _, p := range packages {
+		h.Write([]byte{0})
+		h.Write([]byte(p))
+	}
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+// ImageBaker is an optional interface for backends that start workspaces
+// from a disk image, such as VM backends, so that installing packages and
+// credentials is done once rather than in every workspace. Before creating
+// a workspace whose config names a base image or packages, env create bakes
+// an image for them unless one was baked already, records it in the state
+// database, and passes its ID to Create in CreateConfig.Image; Create
+// clones the workspace from it.
+//
+// A workspace must not depend on the image it was cloned from once Create
+// returns, so removing an image never affects existing workspaces.
+type ImageBaker interface {
+	// BakeImage builds an image from spec and returns the backend's ID for
+	// it.
+	BakeImage(ctx context.Context, spec ImageSpec) (string, error)
+
+	// DeleteImage removes an image BakeImage returned.
+	DeleteImage(ctx context.Context, imageID string) error
+}
@@ -0,0 +1,27 @@
+package backend
+
+import "testing"
+
+func TestImageSpecKey(t *testing.T) {
+	key := ImageSpec{BaseImage: "ubuntu:24.04", Packages: []string{"git", "jq"}}.Key()
+
+	same := []ImageSpec{
+		{BaseImage: "ubuntu:24.04", Packages: []string{"jq", "git"}},
+		{BaseImage: "ubuntu:24.04", Packages: []string{"git", "jq", "git"}},
+	}
+	for _, spec := range same {
+		if got := spec.Key(); got != key {
+			t.Errorf("Key(%+v) = %s, want %s", spec, got, key)
+		}
+	}
+	different := []ImageSpec{
+		{BaseImage: "ubuntu:22.04", Packages: []string{"git", "jq"}},
+		{BaseImage: "ubuntu:24.04", Packages: []string{"git"}},
+		{BaseImage: "ubuntu:24.04", Packages: []string{"gitjq"}},
+	}
+	for _, spec := range different {
+		if got := spec.Key(); got == key {
+			t.Errorf("Key(%+v) = %s, same as for git and jq on ubuntu:24.04", spec, got)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package backend
+
+import (
+	"context"
+	"io"
+	"os"
+)
+
+// LaunchSpec describes a long-running process to start in a workspace.
+type LaunchSpec struct {
+	// Command is the shell command line to run.
+	Command string
+
+	// Env holds variables added to the workspace's environment for the
+	// process.
+	Env map[string]string
+
+	// Stdin, Stdout, and Stderr are the process's standard streams. Nil
+	// streams are connected to the null device.
+	Stdin          io.Reader
+	Stdout, Stderr io.Writer
+}
+
+// Launcher is an optional interface for backends that can start a process
+// in a workspace and hand it back running, for processes that outlive a
+// single Exec, such as coding agents. Unlike Exec, the process's output is
+// streamed rather than collected.
+//
+// Callers should check for it with a type assertion.
+type Launcher interface {
+	// Launch starts spec.Command in the workspace with the workspace's
+	// environment variables plus spec.Env. The returned Process is
+	// running; the caller must Wait for it.
+	Launch(ctx context.Context, backendID string, spec LaunchSpec) (Process, error)
+}
+
+// Process is a process started by a Launcher.
+type Process interface {
+	// ID identifies the process to its backend, e.g., a host PID.
+	ID() string
+
+	// Wait waits for the process to exit and returns its exit code. An
+	// error means the exit status couldn't be determined.
+	Wait() (exitCode int, err error)
+}
+
+// Supervisor is an optional interface for Launchers whose processes can be
+// looked in on by ID after the Process that launched them is gone, e.g.,
+// from another choir invocation.
+//
+// Callers should check for it with a type assertion.
+type Supervisor interface {
+	// ProcessAlive reports whether the process with the given ID is still
+	// running in the workspace.
+	ProcessAlive(ctx context.Context, backendID, processID string) (bool, error)
+
+	// SignalProcess sends sig to the process and the processes it started.
+	// Signaling a process that has already exited is not an error.
+	SignalProcess(ctx context.Context, backendID, processID string, sig os.Signal) error
+}
@@ -0,0 +1,11 @@
+package backend
+
+import "github.com/Quidge/choir/internal/config"
+
+// WorkspacePlanner is an optional interface for backends that can tell
+// where a workspace would be created without creating it, for
+// "env create --plan".
+type WorkspacePlanner interface {
+	// WorkspacePath returns the backend ID Create would return for cfg.
+	WorkspacePath(cfg *config.CreateConfig) (string, error)
+}
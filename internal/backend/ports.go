@@ -0,0 +1,21 @@
+package backend
+
+import "context"
+
+// PortForwarder is an optional interface for backends whose workspaces have
+// their own network, such as VMs and containers, so that a server started
+// in one is reachable from the host only through a forwarded port.
+// Backends whose workspaces share the host's network, like worktree, don't
+// implement it.
+//
+// Callers should check for it with a type assertion.
+type PortForwarder interface {
+	// ForwardPort forwards hostPort on the host to guestPort in the
+	// workspace until StopForward is called or the workspace is destroyed.
+	// It returns an ID for the forward to pass to StopForward.
+	ForwardPort(ctx context.Context, backendID string, guestPort, hostPort int) (string, error)
+
+	// StopForward stops a forward started by ForwardPort. Stopping a
+	// forward that is already gone is not an error.
+	StopForward(ctx context.Context, backendID, forwardID string) error
+}
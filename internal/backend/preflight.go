@@ -0,0 +1,19 @@
+package backend
+
+import (
+	"context"
+
+	"github.com/Quidge/choir/internal/config"
+)
+
+// Preflighter is an optional interface for backends that can verify
+// prerequisites (required tools, disk space, etc.) before Create.
+//
+// Callers should check for it with a type assertion and run Preflight before
+// recording or provisioning anything, so problems surface as a clear error
+// instead of a half-created workspace.
+type Preflighter interface {
+	// Preflight returns an error describing every unmet prerequisite for
+	// creating a workspace with cfg, or nil if creation can proceed.
+	Preflight(ctx context.Context, cfg *config.CreateConfig) error
+}
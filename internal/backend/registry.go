@@ -27,6 +27,10 @@ type BackendConfig struct {
 
 	// VMType is the VM type for Lima (e.g., "vz", "qemu").
 	VMType string
+
+	// Shell is the absolute path of the shell used for attach, exec, and
+	// setup commands. If empty, backends fall back to $SHELL.
+	Shell string
 }
 
 // BackendFactory is a function that creates a new backend instance.
@@ -2,10 +2,26 @@ package backend
 
 import (
 	"context"
+	"errors"
+	"io"
+	"time"
 
 	"github.com/Quidge/choir/internal/config"
 )
 
+// ErrTargetOutsideWorkspace is returned by setup runners when a file mount
+// target resolves outside the workspace (for example through ".." or a
+// symlinked directory) and the mount doesn't set AllowOutsideWorkspace.
+var ErrTargetOutsideWorkspace = errors.New("file mount target is outside the workspace")
+
+// TaskFileName is the file in the workspace that SetupConfig.TaskFile is
+// written to.
+const TaskFileName = "TASK.md"
+
+// CommitTrailerKey is the git trailer that records which environment a
+// commit was made in (see SetupConfig.CommitTrailer).
+const CommitTrailerKey = "Choir-Env"
+
 // SetupRunner abstracts workspace setup steps. Each backend provides its own
 // implementation that knows how to execute in that environment.
 //
@@ -26,7 +42,38 @@ type SetupRunner interface {
 	//   - Check ctx.Done() between setup steps
 	//   - Return ctx.Err() promptly when cancelled
 	//   - Clean up any partial state before returning on cancellation
-	Run(ctx context.Context, cfg *SetupConfig) error
+	//
+	// The result is returned even when Run fails, covering the commands
+	// that ran before the failure.
+	Run(ctx context.Context, cfg *SetupConfig) (*SetupResult, error)
+}
+
+// SetupResult reports what a setup run did.
+type SetupResult struct {
+	// Commands holds one entry per setup command that was started, in order.
+	Commands []CommandResult
+}
+
+// CommandResult is the outcome of one setup command.
+type CommandResult struct {
+	Command   string        // Command line as passed to the shell
+	ExitCode  int           // Process exit code (-1 if it failed to start or was killed)
+	StartedAt time.Time     // When the command started
+	Duration  time.Duration // How long the command ran
+	Output    string        // Combined stdout and stderr
+}
+
+// Failed returns the first command that exited non-zero, or nil.
+func (r *SetupResult) Failed() *CommandResult {
+	if r == nil {
+		return nil
+	}
+	for i := range r.Commands {
+		if r.Commands[i].ExitCode != 0 {
+			return &r.Commands[i]
+		}
+	}
+	return nil
 }
 
 // SetupConfig contains the configuration for setting up a workspace.
@@ -37,6 +84,68 @@ type SetupConfig struct {
 	// Files contains files to copy or link into the workspace.
 	Files []config.FileMount
 
+	// GitIdentity is the git author identity to configure in the workspace.
+	GitIdentity config.GitIdentity
+
+	// CommitTrailer, if set, is added to commits made in the workspace as
+	// the value of a CommitTrailerKey trailer (normally the environment ID).
+	CommitTrailer string
+
+	// Ignore lists gitignore patterns to add to the workspace's git
+	// excludes. Patterns already present are not added again.
+	Ignore []string
+
+	// TaskFile, if set, is written to TaskFileName in the workspace, which
+	// is also added to the git excludes so the task isn't committed.
+	TaskFile string
+
+	// Tools are language-level tools to install before SetupCommands run.
+	Tools config.ToolsConfig
+
 	// SetupCommands contains commands to run after environment setup.
 	SetupCommands []string
+
+	// SetupWrapper, if set, is a command prefix that Tools installs and
+	// SetupCommands are run through (see config.CreateConfig.SetupWrapper).
+	SetupWrapper string
+
+	// PreDestroy are commands for Destroy to run in the workspace before
+	// removing it. Runners record them, along with anything setup did
+	// that removing the workspace wouldn't undo (such as files mounted
+	// outside it), in a teardown manifest that Destroy carries out.
+	PreDestroy []string
+
+	// Log, if set, receives a copy of setup command output (stdout and
+	// stderr interleaved) in addition to the terminal.
+	Log io.Writer
+
+	// Quiet keeps setup command output off the terminal; it is still
+	// captured in the result and copied to Log. Runners that show it send
+	// it to stderr, so a caller's stdout carries only what it prints.
+	Quiet bool
+
+	// Journal, if set, is told when each setup step starts and finishes.
+	Journal SetupJournal
+}
+
+// SetupJournal records setup progress durably, so that if the process
+// running setup dies, choir can tell which step was interrupted. Runners
+// number steps from 1 in the order they run them and call StepStarted
+// before and StepFinished after each one.
+type SetupJournal interface {
+	StepStarted(step int, name string)
+	StepFinished(step int, err error)
+}
+
+// SetupCopier is an optional interface for backends that can copy what
+// setup wrote into one workspace into another, so "choir env clone" can fork
+// an environment without running its setup again.
+//
+// Callers should check for it with a type assertion; clones on other
+// backends run setup as env create does.
+type SetupCopier interface {
+	// CopySetup copies the environment files, the task file, and the file
+	// mounts in files from the workspace from to the workspace to. Mounts
+	// outside the workspace are shared already and left alone.
+	CopySetup(ctx context.Context, from, to string, files []config.FileMount) error
 }
@@ -0,0 +1,161 @@
+package worktree
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/Quidge/choir/internal/backend"
+	"github.com/Quidge/choir/internal/gitutil"
+	"github.com/Quidge/choir/internal/msg"
+	"github.com/Quidge/choir/internal/trash"
+)
+
+// snapshotIdentity is who snapshot commits of uncommitted changes are by:
+// choir made them, and the user may have no identity configured.
+var snapshotIdentity = []string{
+	"GIT_AUTHOR_NAME=choir", "GIT_AUTHOR_EMAIL=choir@localhost",
+	"GIT_COMMITTER_NAME=choir", "GIT_COMMITTER_EMAIL=choir@localhost",
+}
+
+// Ensure Backend implements SafeDestroyer.
+var _ backend.SafeDestroyer = (*Backend)(nil)
+
+// DestroyWithOptions destroys the worktree as Destroy does, unless it has
+// unpushed commits and opts.Force isn't set. With opts.Backup, unpushed
+// commits and uncommitted changes are first saved to the trash. Failing to
+// check for pending work is warned about and treated as none, so it doesn't
+// block removing a broken worktree; failing to back it up is an error.
+func (b *Backend) DestroyWithOptions(ctx context.Context, backendID string, opts backend.DestroyOptions) error {
+	if _, err := os.Stat(backendID); err != nil || (opts.Force && !opts.Backup) {
+		return b.Destroy(ctx, backendID)
+	}
+
+	pending, err := b.PendingWork(ctx, backendID)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "warning: failed to check for unpushed work: %v\n", err)
+		return b.Destroy(ctx, backendID)
+	}
+	if pending.UnpushedCommits > 0 && !opts.Force {
+		return fmt.Errorf("%w: %d found on no remote or other branch", backend.ErrUnpushedWork, pending.UnpushedCommits)
+	}
+	if opts.Backup && !pending.IsZero() {
+		entry, err := backUp(ctx, backendID, pending)
+		if err != nil {
+			return fmt.Errorf("failed to back up pending work: %w", err)
+		}
+		msg.Fprintf(os.Stderr, "Backed up pending work to the trash; restore it with \"choir trash restore %s\"\n", worktreeShortID(entry.ID))
+	}
+	return b.Destroy(ctx, backendID)
+}
+
+// backUp saves pending, the unpushed commits and uncommitted changes in
+// the worktree at dir, to a new trash entry as a git bundle. Uncommitted
+// changes, including untracked files, become a snapshot commit on top of
+// HEAD, so restoring the bundle's ref brings back both.
+func backUp(ctx context.Context, dir string, pending backend.PendingWork) (*trash.Entry, error) {
+	repoRoot, err := findMainRepo(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find main repository: %w", err)
+	}
+	id := filepath.Base(dir)
+	if m, err := readMarker(dir); err == nil {
+		id = m.ID
+	}
+	branch, err := gitutil.CurrentBranch(dir)
+	if err != nil && !errors.Is(err, gitutil.ErrDetachedHead) {
+		return nil, err
+	}
+
+	out, err := git(ctx, dir, "rev-parse", "HEAD")
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve HEAD: %w", err)
+	}
+	tip := strings.TrimSpace(string(out))
+	if pending.UncommittedFiles > 0 {
+		if tip, err = snapshot(ctx, dir, tip, id); err != nil {
+			return nil, err
+		}
+	}
+
+	entry, err := trash.New(id)
+	if err != nil {
+		return nil, err
+	}
+	entry.Branch = branch
+	entry.Repo = repoRoot
+	entry.Ref = "refs/choir/trash/" + worktreeShortID(id)
+	entry.UnpushedCommits = pending.UnpushedCommits
+	entry.UncommittedFiles = pending.UncommittedFiles
+
+	// Bundles are made from refs, so point a temporary one at the tip
+	if _, err := git(ctx, dir, "update-ref", entry.Ref, tip); err != nil {
+		_ = entry.Delete()
+		return nil, fmt.Errorf("failed to create ref: %w", err)
+	}
+	defer git(context.WithoutCancel(ctx), dir, "update-ref", "-d", entry.Ref)
+
+	// Leave out what other branches and remotes already have, as
+	// PendingWork does
+	args := []string{"bundle", "create", "--quiet", entry.BundlePath(), entry.Ref, "--not"}
+	if branch != "" {
+		args = append(args, "--exclude="+branch)
+	}
+	args = append(args, "--branches", "--remotes")
+	if _, err := git(ctx, dir, args...); err != nil {
+		_ = entry.Delete()
+		return nil, fmt.Errorf("failed to create bundle: %w", err)
+	}
+	if err := entry.Save(); err != nil {
+		_ = entry.Delete()
+		return nil, err
+	}
+	return entry, nil
+}
+
+// snapshot commits the working tree of the worktree at dir, untracked files
+// included, on top of head without touching its index or branch, and
+// returns the commit.
+func snapshot(ctx context.Context, dir, head, id string) (string, error) {
+	index, err := os.CreateTemp("", "choir-snapshot-index-")
+	if err != nil {
+		return "", err
+	}
+	index.Close()
+	os.Remove(index.Name()) // git creates the index itself
+	defer os.Remove(index.Name())
+
+	env := append(cleanGitEnv(), "GIT_INDEX_FILE="+index.Name())
+	run := func(args ...string) (string, error) {
+		cmd := exec.CommandContext(ctx, "git", args...)
+		cmd.Dir = dir
+		cmd.Env = append(env, snapshotIdentity...)
+		out, err := cmd.Output()
+		if err != nil {
+			var exitErr *exec.ExitError
+			if errors.As(err, &exitErr) {
+				return "", fmt.Errorf("git %s: %w: %s", args[0], err, strings.TrimSpace(string(exitErr.Stderr)))
+			}
+			return "", err
+		}
+		return strings.TrimSpace(string(out)), nil
+	}
+
+	if _, err := run("add", "--all", "."); err != nil {
+		return "", fmt.Errorf("failed to snapshot uncommitted changes: %w", err)
+	}
+	tree, err := run("write-tree")
+	if err != nil {
+		return "", fmt.Errorf("failed to snapshot uncommitted changes: %w", err)
+	}
+	msg := fmt.Sprintf("choir: uncommitted changes in %s when it was removed", worktreeShortID(id))
+	commit, err := run("commit-tree", tree, "-p", head, "-m", msg)
+	if err != nil {
+		return "", fmt.Errorf("failed to snapshot uncommitted changes: %w", err)
+	}
+	return commit, nil
+}
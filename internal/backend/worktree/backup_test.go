@@ -0,0 +1,125 @@
+package worktree
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Quidge/choir/internal/backend"
+	"github.com/Quidge/choir/internal/config"
+	"github.com/Quidge/choir/internal/trash"
+)
+
+// runGit runs a git command in dir and returns its trimmed output.
+func runGit(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Env = cleanGitEnv()
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %v failed: %v\n%s", args, err, out)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+func TestDestroyWithOptionsBacksUp(t *testing.T) {
+	setupXDGDataHome(t)
+	repoDir := setupTestRepo(t)
+
+	b, _ := New(backend.BackendConfig{})
+	safe := b.(backend.SafeDestroyer)
+	ctx := context.Background()
+	backendID, err := b.Create(ctx, &config.CreateConfig{
+		ID:           "back12def456abc123def456abc12345",
+		Repository:   config.RepositoryInfo{Path: repoDir, BaseBranch: "HEAD"},
+		BranchPrefix: "env/",
+	})
+	if err != nil {
+		t.Fatalf("Create() failed: %v", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(backendID, "committed.txt"), []byte("committed\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	runGit(t, backendID, "add", "committed.txt")
+	runGit(t, backendID, "commit", "-m", "Add committed.txt")
+	if err := os.WriteFile(filepath.Join(backendID, "untracked.txt"), []byte("untracked\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	err = safe.DestroyWithOptions(ctx, backendID, backend.DestroyOptions{Backup: true})
+	if !errors.Is(err, backend.ErrUnpushedWork) {
+		t.Fatalf("DestroyWithOptions() without Force = %v, want ErrUnpushedWork", err)
+	}
+	if _, err := os.Stat(backendID); err != nil {
+		t.Fatalf("refused destroy removed the worktree: %v", err)
+	}
+	if entries, _ := trash.List(); len(entries) != 0 {
+		t.Errorf("refused destroy saved %d trash entries, want 0", len(entries))
+	}
+
+	if err := safe.DestroyWithOptions(ctx, backendID, backend.DestroyOptions{Force: true, Backup: true}); err != nil {
+		t.Fatalf("DestroyWithOptions() with Force failed: %v", err)
+	}
+	if _, err := os.Stat(backendID); !os.IsNotExist(err) {
+		t.Error("worktree was not destroyed")
+	}
+	if refs := runGit(t, repoDir, "for-each-ref", "refs/choir/"); refs != "" {
+		t.Errorf("temporary refs left behind: %s", refs)
+	}
+
+	entries, err := trash.List()
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("trash.List() = %v, %v; want one entry", entries, err)
+	}
+	entry := entries[0]
+	if entry.Branch != "env/back12def456" || entry.UnpushedCommits != 1 || entry.UncommittedFiles != 1 {
+		t.Errorf("entry = %+v, want env/back12def456 with 1 commit and 1 file", entry)
+	}
+
+	// Restoring somewhere new brings back both the commit and the snapshot
+	// of uncommitted changes on top of it
+	branch, err := entry.Restore(ctx, "restored")
+	if err != nil {
+		t.Fatalf("Restore() failed: %v", err)
+	}
+	if got := runGit(t, repoDir, "show", branch+":untracked.txt"); got != "untracked" {
+		t.Errorf("restored untracked.txt = %q", got)
+	}
+	if got := runGit(t, repoDir, "log", "-1", "--format=%s", branch+"~1"); got != "Add committed.txt" {
+		t.Errorf("restored branch's parent commit = %q, want the unpushed commit", got)
+	}
+	if files := runGit(t, repoDir, "ls-tree", "--name-only", branch); strings.Contains(files, envFile) {
+		t.Errorf("snapshot includes choir's own files:\n%s", files)
+	}
+}
+
+func TestDestroyWithOptionsNothingPending(t *testing.T) {
+	setupXDGDataHome(t)
+	repoDir := setupTestRepo(t)
+
+	b, _ := New(backend.BackendConfig{})
+	ctx := context.Background()
+	backendID, err := b.Create(ctx, &config.CreateConfig{
+		ID:         "idle12def456abc123def456abc12345",
+		Repository: config.RepositoryInfo{Path: repoDir, BaseBranch: "HEAD"},
+	})
+	if err != nil {
+		t.Fatalf("Create() failed: %v", err)
+	}
+
+	if err := b.(backend.SafeDestroyer).DestroyWithOptions(ctx, backendID, backend.DestroyOptions{Backup: true}); err != nil {
+		t.Fatalf("DestroyWithOptions() failed: %v", err)
+	}
+	if _, err := os.Stat(backendID); !os.IsNotExist(err) {
+		t.Error("worktree was not destroyed")
+	}
+	if entries, _ := trash.List(); len(entries) != 0 {
+		t.Errorf("saved %d trash entries for a clean worktree, want 0", len(entries))
+	}
+}
@@ -0,0 +1,82 @@
+package worktree
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/Quidge/choir/internal/backend"
+	"github.com/Quidge/choir/internal/config"
+	"github.com/Quidge/choir/internal/pathutil"
+)
+
+// Ensure Backend implements SetupCopier.
+var _ backend.SetupCopier = (*Backend)(nil)
+
+// CopySetup copies the env files, the task file, and the file mounts setup
+// wrote into the worktree from into the worktree to. Read-only mounts are
+// symlinks and are copied as such. Mounts missing from from, such as ones
+// added to the config since it was set up, are skipped.
+func (b *Backend) CopySetup(ctx context.Context, from, to string, files []config.FileMount) error {
+	for _, name := range []string{envFile, envFile + ".fish", backend.TaskFileName} {
+		if err := copyPath(filepath.Join(from, name), filepath.Join(to, name)); err != nil {
+			return fmt.Errorf("failed to copy %s: %w", name, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(to, backend.TaskFileName)); err == nil {
+		if err := addExcludes(ctx, to, []string{"/" + backend.TaskFileName}); err != nil {
+			return fmt.Errorf("failed to update git excludes: %w", err)
+		}
+	}
+
+	src := &HostSetupRunner{WorkDir: from}
+	for _, fm := range files {
+		if pathutil.HostStyle().IsAbs(fm.Target) {
+			continue
+		}
+		target, err := src.resolveTarget(fm)
+		if err != nil || !src.inWorkDir(target) {
+			continue
+		}
+		rel, err := filepath.Rel(from, target)
+		if err != nil {
+			continue
+		}
+		if err := copyPath(target, filepath.Join(to, rel)); err != nil {
+			return fmt.Errorf("failed to copy file %s: %w", fm.Target, err)
+		}
+	}
+	return nil
+}
+
+// copyPath copies the file, directory, or symlink at src to dst, replacing
+// whatever is there. A missing src copies nothing.
+func copyPath(src, dst string) error {
+	info, err := os.Lstat(src)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	if err := os.RemoveAll(dst); err != nil {
+		return err
+	}
+
+	switch {
+	case info.Mode()&os.ModeSymlink != 0:
+		link, err := os.Readlink(src)
+		if err != nil {
+			return err
+		}
+		return os.Symlink(link, dst)
+	case info.IsDir():
+		return copyDir(src, dst)
+	default:
+		return copyFile(src, dst)
+	}
+}
@@ -0,0 +1,89 @@
+package worktree
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Quidge/choir/internal/backend"
+	"github.com/Quidge/choir/internal/config"
+)
+
+func TestCopySetup(t *testing.T) {
+	setupXDGDataHome(t)
+	repoDir := setupTestRepo(t)
+
+	be, _ := New(backend.BackendConfig{Shell: "/bin/sh"})
+	b := be.(*Backend)
+	ctx := context.Background()
+	create := func(id string) string {
+		t.Helper()
+		backendID, err := b.Create(ctx, &config.CreateConfig{
+			ID:         id,
+			Repository: config.RepositoryInfo{Path: repoDir, BaseBranch: "HEAD"},
+		})
+		if err != nil {
+			t.Fatalf("Create() failed: %v", err)
+		}
+		return backendID
+	}
+	from := create("clonesrc456abc123def456abc12345")
+	to := create("clonedst456abc123def456abc12345")
+
+	source := filepath.Join(t.TempDir(), "secret")
+	if err := os.WriteFile(source, []byte("s3cret"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	outside := filepath.Join(t.TempDir(), "outside")
+	files := []config.FileMount{
+		{Source: source, Target: "config/copied"},
+		{Source: source, Target: "linked", ReadOnly: true},
+		{Source: source, Target: outside, AllowOutsideWorkspace: true},
+		{Source: source, Target: "added-later"},
+	}
+	if _, err := b.NewSetupRunner(from).Run(ctx, &backend.SetupConfig{
+		Environment: map[string]string{"GREETING": "hi"},
+		Files:       files[:3],
+		TaskFile:    "fix the bug",
+	}); err != nil {
+		t.Fatalf("setup failed: %v", err)
+	}
+	// Edits since setup carry over
+	if err := os.WriteFile(filepath.Join(from, "config", "copied"), []byte("edited"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := b.CopySetup(ctx, from, to, files); err != nil {
+		t.Fatalf("CopySetup() failed: %v", err)
+	}
+
+	env, err := os.ReadFile(filepath.Join(from, envFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]string{
+		envFile:                           string(env),
+		backend.TaskFileName:              "fix the bug\n",
+		filepath.Join("config", "copied"): "edited",
+	} {
+		got, err := os.ReadFile(filepath.Join(to, name))
+		if err != nil {
+			t.Errorf("%s not copied: %v", name, err)
+			continue
+		}
+		if string(got) != want {
+			t.Errorf("%s = %q, want %q", name, got, want)
+		}
+	}
+	if link, err := os.Readlink(filepath.Join(to, "linked")); err != nil || link != source {
+		t.Errorf("linked = %q, %v; want a symlink to %s", link, err, source)
+	}
+	if _, err := os.Lstat(filepath.Join(to, "added-later")); !os.IsNotExist(err) {
+		t.Errorf("mount missing from the source was created: %v", err)
+	}
+	if out := runGit(t, to, "status", "--porcelain"); strings.Contains(out, envFile) || strings.Contains(out, backend.TaskFileName) {
+		t.Errorf("git status shows the env or task file:\n%s", out)
+	}
+}
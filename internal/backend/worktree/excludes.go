@@ -0,0 +1,70 @@
+package worktree
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// choirExcludes are the patterns for the files choir writes into every
+// worktree (the marker and env files).
+var choirExcludes = []string{"/" + envFile + "*"}
+
+// addExcludes appends the patterns not already listed to the git excludes
+// file (info/exclude) of the worktree at dir. Worktrees read info/exclude
+// from the main repository's git directory, so the patterns apply to every
+// worktree of the repository, and to the repository itself.
+func addExcludes(ctx context.Context, dir string, patterns []string) error {
+	for _, p := range patterns {
+		if strings.TrimSpace(p) == "" || strings.ContainsAny(p, "\r\n") {
+			return fmt.Errorf("invalid ignore pattern %q", p)
+		}
+	}
+
+	out, err := git(ctx, dir, "rev-parse", "--path-format=absolute", "--git-path", "info/exclude")
+	if err != nil {
+		return fmt.Errorf("failed to find excludes file: %w", err)
+	}
+	path := strings.TrimSpace(string(out))
+
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	existing := make(map[string]bool)
+	for _, line := range strings.Split(string(data), "\n") {
+		existing[line] = true
+	}
+
+	var add strings.Builder
+	if len(data) > 0 && data[len(data)-1] != '\n' {
+		add.WriteString("\n")
+	}
+	added := false
+	for _, p := range patterns {
+		if !existing[p] {
+			add.WriteString(p + "\n")
+			existing[p] = true
+			added = true
+		}
+	}
+	if !added {
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.WriteString(add.String()); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return f.Close()
+}
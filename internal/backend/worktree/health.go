@@ -0,0 +1,92 @@
+package worktree
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/Quidge/choir/internal/backend"
+	"github.com/Quidge/choir/internal/preflight"
+)
+
+// minGitVersion is the oldest git the backend works with: worktrees use
+// per-worktree config (2.20) and rev-parse --path-format (2.31).
+var minGitVersion = [2]int{2, 31}
+
+// Ensure Backend implements HealthChecker.
+var _ backend.HealthChecker = (*Backend)(nil)
+
+// HealthCheck verifies git is installed and recent enough, and that the
+// worktrees directory can be written.
+func (b *Backend) HealthCheck(ctx context.Context) error {
+	basePath, err := worktreesBasePath()
+	if err != nil {
+		return fmt.Errorf("failed to determine worktrees path: %w", err)
+	}
+
+	results := preflight.Run(ctx, []preflight.Check{preflight.RequireCommand("git")})
+	if err := preflight.Failed(results); err != nil {
+		return err
+	}
+	return preflight.Failed(preflight.Run(ctx, []preflight.Check{
+		{
+			Name: "git version",
+			Run:  checkGitVersion,
+		},
+		{
+			Name: "worktrees directory writable",
+			Run: func(ctx context.Context) error {
+				return checkWritable(basePath)
+			},
+		},
+	}))
+}
+
+// checkGitVersion fails if the installed git is older than minGitVersion.
+func checkGitVersion(ctx context.Context) error {
+	out, err := git(ctx, "", "version")
+	if err != nil {
+		return fmt.Errorf("failed to run git: %w", err)
+	}
+	version, err := parseGitVersion(string(out))
+	if err != nil {
+		return err
+	}
+	if version[0] < minGitVersion[0] || version[0] == minGitVersion[0] && version[1] < minGitVersion[1] {
+		return fmt.Errorf("git %d.%d is too old; the worktree backend needs %d.%d or newer",
+			version[0], version[1], minGitVersion[0], minGitVersion[1])
+	}
+	return nil
+}
+
+// parseGitVersion returns the major and minor version in the output of
+// "git version", e.g., "git version 2.39.5 (Apple Git-154)".
+func parseGitVersion(out string) ([2]int, error) {
+	var version [2]int
+	if _, err := fmt.Sscanf(strings.TrimSpace(out), "git version %d.%d", &version[0], &version[1]); err != nil {
+		return version, fmt.Errorf("unrecognized git version %q", strings.TrimSpace(out))
+	}
+	return version, nil
+}
+
+// checkWritable fails if dir, or the nearest ancestor that exists if it
+// doesn't yet, can't be written.
+func checkWritable(dir string) error {
+	for {
+		err := syscall.Access(dir, 2) // W_OK
+		if err == nil {
+			return nil
+		}
+		if !errors.Is(err, syscall.ENOENT) {
+			return fmt.Errorf("%s is not writable: %w", dir, err)
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return fmt.Errorf("no existing ancestor of %s", dir)
+		}
+		dir = parent
+	}
+}
@@ -0,0 +1,57 @@
+package worktree
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseGitVersion(t *testing.T) {
+	tests := []struct {
+		out  string
+		want [2]int
+	}{
+		{"git version 2.39.5\n", [2]int{2, 39}},
+		{"git version 2.39.5 (Apple Git-154)", [2]int{2, 39}},
+		{"git version 2.45.2.windows.1", [2]int{2, 45}},
+	}
+	for _, tt := range tests {
+		got, err := parseGitVersion(tt.out)
+		if err != nil || got != tt.want {
+			t.Errorf("parseGitVersion(%q) = %v, %v; want %v", tt.out, got, err, tt.want)
+		}
+	}
+	if _, err := parseGitVersion("hub version 2.14"); err == nil {
+		t.Error("parseGitVersion() accepted output that isn't git's")
+	}
+}
+
+func TestHealthCheck(t *testing.T) {
+	t.Setenv("XDG_DATA_HOME", filepath.Join(t.TempDir(), "not", "created", "yet"))
+	b := &Backend{}
+	if err := b.HealthCheck(t.Context()); err != nil {
+		t.Fatalf("HealthCheck() failed: %v", err)
+	}
+
+	t.Setenv("PATH", t.TempDir())
+	if err := b.HealthCheck(t.Context()); err == nil {
+		t.Error("HealthCheck() succeeded without git in PATH")
+	}
+}
+
+func TestCheckWritable(t *testing.T) {
+	dir := t.TempDir()
+	if err := checkWritable(filepath.Join(dir, "a", "b")); err != nil {
+		t.Errorf("checkWritable() of a path under a writable directory failed: %v", err)
+	}
+	if os.Geteuid() == 0 {
+		t.Skip("root can write anywhere")
+	}
+	if err := os.Chmod(dir, 0555); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = os.Chmod(dir, 0755) })
+	if err := checkWritable(filepath.Join(dir, "a")); err == nil {
+		t.Error("checkWritable() succeeded under a read-only directory")
+	}
+}
@@ -0,0 +1,99 @@
+package worktree
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/Quidge/choir/internal/backend"
+	"github.com/Quidge/choir/internal/gitutil"
+)
+
+// hooksDirName is the directory, inside a worktree's private git dir, that
+// holds the hooks choir installs for it.
+const hooksDirName = "choir-hooks"
+
+// clientHooks are the git hooks that run in a working tree. Each gets a
+// wrapper in the choir hooks directory that runs the repository's own hook,
+// since pointing core.hooksPath at that directory hides the originals.
+var clientHooks = []string{
+	"applypatch-msg",
+	"pre-applypatch",
+	"post-applypatch",
+	"pre-commit",
+	"pre-merge-commit",
+	"prepare-commit-msg",
+	"commit-msg",
+	"post-commit",
+	"pre-rebase",
+	"post-checkout",
+	"post-merge",
+	"pre-push",
+	"reference-transaction",
+	"pre-auto-gc",
+	"post-rewrite",
+	"post-index-change",
+	"fsmonitor-watchman",
+}
+
+// installTrailerHook makes commits in the worktree at workDir carry a
+// backend.CommitTrailerKey trailer with value envID. It installs a
+// prepare-commit-msg hook in a directory private to the worktree and points
+// the worktree's core.hooksPath at it, so the main repository and other
+// environments are unaffected. Hooks the repository already uses keep
+// running.
+func installTrailerHook(ctx context.Context, workDir, envID string) error {
+	gitDir, _, err := gitutil.GitDirs(workDir)
+	if err != nil {
+		return err
+	}
+	git := func(args ...string) (string, error) {
+		cmd := exec.CommandContext(ctx, "git", args...)
+		cmd.Dir = workDir
+		cmd.Env = cleanGitEnv()
+		out, err := cmd.Output()
+		return strings.TrimSpace(string(out)), err
+	}
+
+	// Find the hooks the repository would otherwise run, ignoring any
+	// earlier installation of ours
+	_, _ = git("config", "--worktree", "--unset", "core.hooksPath")
+	original, _ := git("config", "--type=path", "--get", "core.hooksPath")
+	if original == "" {
+		if original, err = git("rev-parse", "--git-path", "hooks"); err != nil {
+			return fmt.Errorf("failed to find hooks directory: %w", err)
+		}
+		if !filepath.IsAbs(original) {
+			original = filepath.Join(workDir, original)
+		}
+	}
+	// A relative core.hooksPath is relative to the working tree, where
+	// hooks run, so it can be used as is
+
+	dir := filepath.Join(gitDir, hooksDirName)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create hooks directory: %w", err)
+	}
+	for _, name := range clientHooks {
+		script := "#!/bin/sh\n# Installed by choir; runs the repository's own hook.\n"
+		if name == "prepare-commit-msg" {
+			trailer := backend.CommitTrailerKey + ": " + envID
+			script += "git interpret-trailers --in-place --if-exists doNothing --trailer " +
+				posixQuote(trailer) + ` "$1" || exit 1` + "\n"
+		}
+		script += "hook=" + posixQuote(filepath.Join(original, name)) + "\n" +
+			`[ -x "$hook" ] || exit 0` + "\n" +
+			`exec "$hook" "$@"` + "\n"
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(script), 0755); err != nil {
+			return fmt.Errorf("failed to write %s hook: %w", name, err)
+		}
+	}
+
+	if _, err := git("config", "--worktree", "core.hooksPath", dir); err != nil {
+		return fmt.Errorf("failed to set core.hooksPath: %w", err)
+	}
+	return nil
+}
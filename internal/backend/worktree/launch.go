@@ -0,0 +1,158 @@
+package worktree
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/Quidge/choir/internal/backend"
+)
+
+// Ensure Backend implements Launcher and Supervisor.
+var (
+	_ backend.Launcher   = (*Backend)(nil)
+	_ backend.Supervisor = (*Backend)(nil)
+)
+
+// Launch starts spec.Command in the worktree at backendID, with the
+// worktree's env file sourced first, as Exec does.
+func (b *Backend) Launch(ctx context.Context, backendID string, spec backend.LaunchSpec) (backend.Process, error) {
+	if _, err := os.Stat(backendID); os.IsNotExist(err) {
+		return nil, fmt.Errorf("%w: %s", ErrWorktreeNotFound, backendID)
+	}
+
+	shell, err := validShell(b.shell)
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := exec.CommandContext(ctx, shell, "-c", withEnvFile(shell, backendID, spec.Command))
+	cmd.Dir = backendID
+	cmd.Env = os.Environ()
+	for k, v := range spec.Env {
+		cmd.Env = append(cmd.Env, k+"="+v)
+	}
+	cmd.Stdin = spec.Stdin
+	cmd.Stdout = spec.Stdout
+	cmd.Stderr = spec.Stderr
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start %q: %w", spec.Command, err)
+	}
+	return &hostProcess{cmd: cmd}, nil
+}
+
+// hostProcess is a process launched on the host.
+type hostProcess struct {
+	cmd *exec.Cmd
+}
+
+// ID returns the host PID.
+func (p *hostProcess) ID() string {
+	return strconv.Itoa(p.cmd.Process.Pid)
+}
+
+// Wait waits for the process and returns its exit code, or -1 if it was
+// killed by a signal.
+func (p *hostProcess) Wait() (int, error) {
+	err := p.cmd.Wait()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode(), nil
+	}
+	if err != nil {
+		return -1, err
+	}
+	return 0, nil
+}
+
+// ProcessAlive reports whether the host process with PID processID exists.
+// PIDs are reused, so a process that exited long ago may be mistaken for a
+// live one; callers should treat the answer as a hint.
+func (b *Backend) ProcessAlive(ctx context.Context, backendID, processID string) (bool, error) {
+	pid, err := parsePID(processID)
+	if err != nil {
+		return false, err
+	}
+	err = syscall.Kill(pid, 0)
+	if errors.Is(err, syscall.ESRCH) {
+		return false, nil
+	}
+	if err != nil && !errors.Is(err, syscall.EPERM) {
+		return false, fmt.Errorf("failed to check process %d: %w", pid, err)
+	}
+	// A zombie has exited but still answers signals until it's reaped,
+	// which an orphan may never be in a container without an init process
+	out, err := exec.CommandContext(ctx, "ps", "-o", "stat=", "-p", processID).Output()
+	if err != nil {
+		// ps exits non-zero if the process is gone by now
+		return false, nil
+	}
+	return !strings.HasPrefix(strings.TrimSpace(string(out)), "Z"), nil
+}
+
+// SignalProcess sends sig to the host process with PID processID and its
+// descendants. The agent usually runs under the shell that launched it,
+// which doesn't pass signals on, so signaling only the shell would leave
+// the agent running.
+func (b *Backend) SignalProcess(ctx context.Context, backendID, processID string, sig os.Signal) error {
+	pid, err := parsePID(processID)
+	if err != nil {
+		return err
+	}
+	pids, err := processTree(ctx, pid)
+	if err != nil {
+		return err
+	}
+	// Descendants may exit before they're signaled, so only failing to
+	// signal pid itself is an error
+	for _, p := range pids {
+		proc, _ := os.FindProcess(p) // Always succeeds on Unix
+		err := proc.Signal(sig)
+		if err != nil && p == pid && !errors.Is(err, os.ErrProcessDone) {
+			return fmt.Errorf("failed to signal process %d: %w", pid, err)
+		}
+	}
+	return nil
+}
+
+// parsePID parses a process ID returned by Launch.
+func parsePID(processID string) (int, error) {
+	pid, err := strconv.Atoi(processID)
+	if err != nil || pid <= 0 {
+		return 0, fmt.Errorf("invalid process ID %q", processID)
+	}
+	return pid, nil
+}
+
+// processTree returns pid followed by its descendants, from ps. A pid that
+// doesn't exist is returned alone.
+func processTree(ctx context.Context, pid int) ([]int, error) {
+	out, err := exec.CommandContext(ctx, "ps", "-A", "-o", "pid=,ppid=").Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list processes: %w", err)
+	}
+	children := make(map[int][]int)
+	for _, line := range strings.Split(string(out), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		child, err1 := strconv.Atoi(fields[0])
+		parent, err2 := strconv.Atoi(fields[1])
+		if err1 != nil || err2 != nil {
+			continue
+		}
+		children[parent] = append(children[parent], child)
+	}
+
+	tree := []int{pid}
+	for i := 0; i < len(tree); i++ {
+		tree = append(tree, children[tree[i]]...)
+	}
+	return tree, nil
+}
@@ -0,0 +1,93 @@
+package worktree
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrNotInEnvironment is returned by FindMarker when no directory from the
+// starting directory up to the root contains a marker file.
+var ErrNotInEnvironment = errors.New("not inside a choir environment")
+
+// Marker is the identity recorded in a worktree's marker file.
+type Marker struct {
+	ID     string // Full environment ID
+	Branch string // Environment branch; empty in worktrees from older choir versions
+	Dir    string // Worktree root holding the marker file
+}
+
+// writeMarker records id and branch in the marker file of the worktree at dir.
+func writeMarker(dir, id, branch string) error {
+	content := fmt.Sprintf("id: %s\nbranch: %s\ncreated_by: choir\n", id, branch)
+	return os.WriteFile(filepath.Join(dir, markerFile), []byte(content), 0644)
+}
+
+// FindMarker finds the marker file of the choir worktree containing dir by
+// checking dir and each of its parents. It reads only the marker file, so it
+// is cheap enough to run on every shell prompt.
+func FindMarker(dir string) (Marker, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return Marker{}, err
+	}
+	for {
+		m, err := readMarker(dir)
+		if err == nil {
+			return m, nil
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			return Marker{}, err
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return Marker{}, ErrNotInEnvironment
+		}
+		dir = parent
+	}
+}
+
+// readMarker parses the marker file in dir.
+func readMarker(dir string) (Marker, error) {
+	f, err := os.Open(filepath.Join(dir, markerFile))
+	if err != nil {
+		return Marker{}, err
+	}
+	defer f.Close()
+
+	m := Marker{Dir: dir}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), ":")
+		if !ok {
+			continue
+		}
+		switch strings.TrimSpace(key) {
+		case "id":
+			m.ID = strings.TrimSpace(value)
+		case "branch":
+			m.Branch = strings.TrimSpace(value)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return Marker{}, fmt.Errorf("failed to read marker file: %w", err)
+	}
+	if m.ID == "" {
+		return Marker{}, fmt.Errorf("marker file in %s has no id", dir)
+	}
+	return m, nil
+}
+
+// identityEnv returns the variables identifying the environment whose
+// worktree is dir, read from its marker file, for shells opened in it:
+// CHOIR_ENV_ID and CHOIR_BRANCH. It returns nil if dir has no marker.
+func identityEnv(dir string) []string {
+	m, err := readMarker(dir)
+	if err != nil {
+		return nil
+	}
+	return []string{"CHOIR_ENV_ID=" + m.ID, "CHOIR_BRANCH=" + m.Branch}
+}
@@ -0,0 +1,93 @@
+package worktree
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/Quidge/choir/internal/backend"
+	"github.com/Quidge/choir/internal/gitutil"
+)
+
+// PendingWork reports uncommitted files and unpushed commits in the
+// worktree. Choir's own files (.choir-env and friends) are not counted as
+// uncommitted. Commits are unpushed if no remote-tracking branch or other
+// local branch contains them, so the commits the environment was created
+// from don't count.
+func (b *Backend) PendingWork(ctx context.Context, backendID string) (backend.PendingWork, error) {
+	if _, err := os.Stat(backendID); os.IsNotExist(err) {
+		return backend.PendingWork{}, fmt.Errorf("%w: %s", ErrWorktreeNotFound, backendID)
+	}
+
+	var pending backend.PendingWork
+	status, err := git(ctx, backendID, "status", "--porcelain", "-z")
+	if err != nil {
+		return pending, fmt.Errorf("failed to get worktree status: %w", err)
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(status))
+	scanner.Split(splitNUL)
+	for scanner.Scan() {
+		entry := scanner.Text()
+		if len(entry) < 4 {
+			continue
+		}
+		if entry[0] == 'R' || entry[0] == 'C' {
+			scanner.Scan() // Skip the rename or copy source
+		}
+		if !strings.HasPrefix(entry[3:], envFile) {
+			pending.UncommittedFiles++
+		}
+	}
+
+	// Exclude this branch's own ref; every other branch and remote counts
+	// as somewhere the commits are kept
+	args := []string{"rev-list", "--count", "HEAD", "--not"}
+	if branch, err := gitutil.CurrentBranch(backendID); err == nil {
+		args = append(args, "--exclude="+branch) // Relative to refs/heads for --branches
+	} else if !errors.Is(err, gitutil.ErrDetachedHead) {
+		return pending, err
+	}
+	args = append(args, "--branches", "--remotes")
+	out, err := git(ctx, backendID, args...)
+	if err != nil {
+		return pending, fmt.Errorf("failed to count unpushed commits: %w", err)
+	}
+	pending.UnpushedCommits, err = strconv.Atoi(strings.TrimSpace(string(out)))
+	if err != nil {
+		return pending, fmt.Errorf("failed to count unpushed commits: %w", err)
+	}
+	return pending, nil
+}
+
+// git runs a git command in dir and returns its standard output.
+func git(ctx context.Context, dir string, args ...string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	cmd.Env = cleanGitEnv()
+	out, err := cmd.Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return nil, fmt.Errorf("%w: %s", err, strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return nil, err
+	}
+	return out, nil
+}
+
+// splitNUL is a bufio.SplitFunc for NUL-terminated records.
+func splitNUL(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	if i := bytes.IndexByte(data, 0); i >= 0 {
+		return i + 1, data[:i], nil
+	}
+	if atEOF && len(data) > 0 {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
@@ -1,6 +1,7 @@
 package worktree
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"io"
@@ -9,9 +10,13 @@ import (
 	"path/filepath"
 	"sort"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/Quidge/choir/internal/backend"
 	"github.com/Quidge/choir/internal/config"
+	"github.com/Quidge/choir/internal/fault"
+	"github.com/Quidge/choir/internal/pathutil"
 )
 
 // HostSetupRunner implements backend.SetupRunner for the worktree backend.
@@ -19,6 +24,9 @@ import (
 type HostSetupRunner struct {
 	// WorkDir is the worktree directory where setup runs.
 	WorkDir string
+
+	// Shell is the shell used to run setup commands. If empty, $SHELL is used.
+	Shell string
 }
 
 // Ensure HostSetupRunner implements SetupRunner.
@@ -27,54 +35,165 @@ var _ backend.SetupRunner = (*HostSetupRunner)(nil)
 // Run executes all setup steps for the worktree.
 //
 // Setup order:
-// 1. Write environment variables to .choir-env file
-// 2. Create symlinks or copy files
-// 3. Run setup commands
-func (r *HostSetupRunner) Run(ctx context.Context, cfg *backend.SetupConfig) error {
+// 1. Write environment variables to .choir-env files (POSIX and fish)
+// 2. Create symlinks or copy files, and write the task file
+// 3. Configure the git identity, commit trailer hook, and git excludes
+// 4. Install tools with the configured provisioner (see ToolsConfig)
+// 5. Run setup commands
+func (r *HostSetupRunner) Run(ctx context.Context, cfg *backend.SetupConfig) (*backend.SetupResult, error) {
+	result := &backend.SetupResult{}
 	if r.WorkDir == "" {
-		return fmt.Errorf("work directory not set")
+		return result, fmt.Errorf("work directory not set")
+	}
+
+	tools, err := toolCommands(cfg.Tools)
+	if err != nil {
+		return result, fmt.Errorf("invalid tools config: %w", err)
 	}
 
 	// Check context before each step
 	if err := ctx.Err(); err != nil {
-		return err
+		return result, err
 	}
 
+	// Record the teardown first, so it runs even if setup fails after
+	// starting what it stops
+	if len(cfg.PreDestroy) > 0 {
+		if err := updateTeardown(r.WorkDir, func(t *teardown) {
+			t.PreDestroy = cfg.PreDestroy
+		}); err != nil {
+			return result, fmt.Errorf("failed to write teardown manifest: %w", err)
+		}
+	}
+
+	steps := &stepJournal{journal: cfg.Journal}
+
 	// Step 1: Write environment to .choir-env file
-	if err := r.writeEnvironment(cfg.Environment); err != nil {
-		return fmt.Errorf("failed to write environment: %w", err)
+	if len(cfg.Environment) > 0 {
+		if err := steps.run("write environment", func() error {
+			return r.writeEnvironment(cfg.Environment)
+		}); err != nil {
+			return result, fmt.Errorf("failed to write environment: %w", err)
+		}
 	}
 
 	if err := ctx.Err(); err != nil {
-		return err
+		return result, err
 	}
 
 	// Step 2: Handle file mounts (symlinks or copies)
-	if err := r.handleFiles(cfg.Files); err != nil {
-		return fmt.Errorf("failed to handle files: %w", err)
+	if len(cfg.Files) > 0 {
+		if err := steps.run("copy files", func() error {
+			return r.handleFiles(cfg.Files)
+		}); err != nil {
+			return result, fmt.Errorf("failed to handle files: %w", err)
+		}
+	}
+	if cfg.TaskFile != "" {
+		if err := steps.run("write task file", func() error {
+			return r.writeTaskFile(ctx, cfg.TaskFile)
+		}); err != nil {
+			return result, fmt.Errorf("failed to write task file: %w", err)
+		}
 	}
 
 	if err := ctx.Err(); err != nil {
-		return err
+		return result, err
 	}
 
-	// Step 3: Run setup commands
-	if err := r.runCommands(ctx, cfg.SetupCommands); err != nil {
-		return fmt.Errorf("failed to run setup commands: %w", err)
+	// Step 3: Configure git identity
+	if !cfg.GitIdentity.IsZero() {
+		if err := steps.run("configure git identity", func() error {
+			return r.configureGitIdentity(ctx, cfg.GitIdentity)
+		}); err != nil {
+			return result, fmt.Errorf("failed to configure git identity: %w", err)
+		}
+	}
+	if cfg.CommitTrailer != "" {
+		if err := steps.run("install commit trailer hook", func() error {
+			return installTrailerHook(ctx, r.WorkDir, cfg.CommitTrailer)
+		}); err != nil {
+			return result, fmt.Errorf("failed to install commit trailer hook: %w", err)
+		}
+	}
+	if len(cfg.Ignore) > 0 {
+		if err := steps.run("update git excludes", func() error {
+			return addExcludes(ctx, r.WorkDir, cfg.Ignore)
+		}); err != nil {
+			return result, fmt.Errorf("failed to update git excludes: %w", err)
+		}
 	}
 
-	return nil
+	if err := ctx.Err(); err != nil {
+		return result, err
+	}
+
+	// Steps 4 and 5: Install tools, then run setup commands, which may
+	// need them, all through the setup wrapper if there is one
+	commands := append(tools, cfg.SetupCommands...)
+	if err := r.runCommands(ctx, commands, cfg.SetupWrapper, cfg.Log, cfg.Quiet, steps, result); err != nil {
+		return result, fmt.Errorf("failed to run setup commands: %w", err)
+	}
+
+	return result, nil
 }
 
-// writeEnvironment writes environment variables to the .choir-env file.
-// The file is written in a format that can be sourced by shell.
+// stepJournal numbers setup steps and reports them to a SetupJournal.
+type stepJournal struct {
+	journal backend.SetupJournal // May be nil
+	n       int
+}
+
+// run runs fn as the next step, unless a setup-step fault names it.
+func (s *stepJournal) run(name string, fn func() error) error {
+	s.n++
+	if s.journal != nil {
+		s.journal.StepStarted(s.n, name)
+	}
+	err := fault.SetupStep(s.n)
+	if err == nil {
+		err = fn()
+	}
+	if s.journal != nil {
+		s.journal.StepFinished(s.n, err)
+	}
+	return err
+}
+
+// writeTaskFile writes task to the task file at the workspace root and
+// excludes it from git.
+func (r *HostSetupRunner) writeTaskFile(ctx context.Context, task string) error {
+	if !strings.HasSuffix(task, "\n") {
+		task += "\n"
+	}
+	if err := os.WriteFile(filepath.Join(r.WorkDir, backend.TaskFileName), []byte(task), 0644); err != nil {
+		return err
+	}
+	return addExcludes(ctx, r.WorkDir, []string{"/" + backend.TaskFileName})
+}
+
+// writeEnvironment writes environment variables to the .choir-env file
+// (POSIX syntax) and the .choir-env.fish file (fish syntax), so the
+// environment can be sourced whichever shell is configured.
 func (r *HostSetupRunner) writeEnvironment(env map[string]string) error {
 	if len(env) == 0 {
 		return nil
 	}
 
-	envPath := filepath.Join(r.WorkDir, envFile)
-	f, err := os.Create(envPath)
+	if err := writeEnvFile(filepath.Join(r.WorkDir, envFile), env, func(key, value string) string {
+		return fmt.Sprintf("export %s=%s\n", key, posixQuote(value))
+	}); err != nil {
+		return err
+	}
+
+	return writeEnvFile(filepath.Join(r.WorkDir, fishEnvFile), env, func(key, value string) string {
+		return fmt.Sprintf("set -gx %s %s\n", key, fishQuote(value))
+	})
+}
+
+// writeEnvFile writes env to path, formatting each variable with line.
+func writeEnvFile(path string, env map[string]string, line func(key, value string) string) error {
+	f, err := os.Create(path)
 	if err != nil {
 		return err
 	}
@@ -95,13 +214,9 @@ func (r *HostSetupRunner) writeEnvironment(env map[string]string) error {
 	}
 	sort.Strings(keys)
 
-	// Write each variable as export statement
+	// Write each variable, quoted for shell safety
 	for _, key := range keys {
-		value := env[key]
-		// Escape single quotes in value for shell safety
-		escapedValue := strings.ReplaceAll(value, "'", "'\\''")
-		line := fmt.Sprintf("export %s='%s'\n", key, escapedValue)
-		if _, err := f.WriteString(line); err != nil {
+		if _, err := f.WriteString(line(key, env[key])); err != nil {
 			return err
 		}
 	}
@@ -109,6 +224,34 @@ func (r *HostSetupRunner) writeEnvironment(env map[string]string) error {
 	return nil
 }
 
+// configureGitIdentity sets id in the worktree's own git config, which
+// Create enables with extensions.worktreeConfig, so the main repository and
+// other environments keep their identity.
+func (r *HostSetupRunner) configureGitIdentity(ctx context.Context, id config.GitIdentity) error {
+	var settings [][2]string
+	if id.Name != "" {
+		settings = append(settings, [2]string{"user.name", id.Name})
+	}
+	if id.Email != "" {
+		settings = append(settings, [2]string{"user.email", id.Email})
+	}
+	if id.SigningKey != "" {
+		settings = append(settings,
+			[2]string{"user.signingkey", id.SigningKey},
+			[2]string{"commit.gpgsign", "true"})
+	}
+
+	for _, kv := range settings {
+		cmd := exec.CommandContext(ctx, "git", "config", "--worktree", kv[0], kv[1])
+		cmd.Dir = r.WorkDir
+		cmd.Env = cleanGitEnv()
+		if output, err := cmd.CombinedOutput(); err != nil {
+			return fmt.Errorf("failed to set %s: %s: %w", kv[0], strings.TrimSpace(string(output)), err)
+		}
+	}
+	return nil
+}
+
 // handleFiles processes file mounts by creating symlinks or copying files.
 func (r *HostSetupRunner) handleFiles(files []config.FileMount) error {
 	for _, fm := range files {
@@ -123,11 +266,9 @@ func (r *HostSetupRunner) handleFiles(files []config.FileMount) error {
 // Uses symlinks when possible (preferred), copies when necessary.
 func (r *HostSetupRunner) handleFile(fm config.FileMount) error {
 	source := fm.Source
-	target := fm.Target
-
-	// If target is relative, make it relative to worktree
-	if !filepath.IsAbs(target) {
-		target = filepath.Join(r.WorkDir, target)
+	target, err := r.resolveTarget(fm)
+	if err != nil {
+		return err
 	}
 
 	// Check if source exists
@@ -149,6 +290,20 @@ func (r *HostSetupRunner) handleFile(fm config.FileMount) error {
 		}
 	}
 
+	// Removing the worktree won't remove a target outside it, so record it
+	// for Destroy before creating it
+	if !r.inWorkDir(target) {
+		outside := outsideFile{Path: target}
+		if fm.ReadOnly {
+			outside.LinksTo = source
+		}
+		if err := updateTeardown(r.WorkDir, func(t *teardown) {
+			t.Outside = append(t.Outside, outside)
+		}); err != nil {
+			return fmt.Errorf("failed to write teardown manifest: %w", err)
+		}
+	}
+
 	// Determine whether to symlink or copy
 	// Prefer symlink for readonly mounts (saves disk space)
 	// Copy for non-readonly mounts or if source is outside the main repo
@@ -173,38 +328,102 @@ func (r *HostSetupRunner) handleFile(fm config.FileMount) error {
 	return nil
 }
 
-// runCommands executes setup commands in the worktree directory.
-func (r *HostSetupRunner) runCommands(ctx context.Context, commands []string) error {
+// resolveTarget returns the absolute path of fm's target, normalized to the
+// host's separators. Relative targets are relative to the worktree. Unless fm
+// allows it, a target that resolves outside the worktree, or to the worktree
+// itself, is rejected with backend.ErrTargetOutsideWorkspace; symlinked
+// directories along the path are followed so they can't be used to escape.
+func (r *HostSetupRunner) resolveTarget(fm config.FileMount) (string, error) {
+	target := pathutil.HostStyle().Join(r.WorkDir, fm.Target)
+	if fm.AllowOutsideWorkspace {
+		return target, nil
+	}
+
+	if !r.inWorkDir(target) {
+		return "", fmt.Errorf("%w: %s (set allow_outside_workspace to permit it)",
+			backend.ErrTargetOutsideWorkspace, fm.Target)
+	}
+	return target, nil
+}
+
+// inWorkDir reports whether path, with symlinked directories along it
+// resolved, is inside the worktree.
+func (r *HostSetupRunner) inWorkDir(path string) bool {
+	root := resolveExisting(filepath.Clean(r.WorkDir))
+	resolved := filepath.Join(resolveExisting(filepath.Dir(path)), filepath.Base(path))
+	return strings.HasPrefix(resolved, root+string(filepath.Separator))
+}
+
+// resolveExisting resolves symlinks in the longest existing prefix of path
+// and appends the rest unchanged.
+func resolveExisting(path string) string {
+	dir, rest := path, ""
+	for {
+		if real, err := filepath.EvalSymlinks(dir); err == nil {
+			return filepath.Join(real, rest)
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return path
+		}
+		rest = filepath.Join(filepath.Base(dir), rest)
+		dir = parent
+	}
+}
+
+// runCommands executes setup commands in the worktree directory, each as a
+// step of steps and through wrapper if it is non-empty, appending their
+// outcomes to result and copying their output to log if it is non-nil.
+// Their output goes to stderr unless quiet is set.
+func (r *HostSetupRunner) runCommands(ctx context.Context, commands []string, wrapper string, log io.Writer, quiet bool, steps *stepJournal, result *backend.SetupResult) error {
 	if len(commands) == 0 {
 		return nil
 	}
 
-	shell, err := validShell()
+	shell, err := validShell(r.Shell)
 	if err != nil {
 		return err
 	}
 
-	envPath := filepath.Join(r.WorkDir, envFile)
+	// Both streams go to stderr, so the caller's stdout stays its own
+	var terminal io.Writer = os.Stderr
+	if quiet {
+		terminal = io.Discard
+	}
+	stdout, stderr := terminal, terminal
+	if log != nil {
+		// exec copies stdout and stderr concurrently
+		log = &lockedWriter{w: log}
+		stdout = io.MultiWriter(terminal, log)
+		stderr = io.MultiWriter(terminal, log)
+	}
 
 	for i, command := range commands {
 		if err := ctx.Err(); err != nil {
 			return err
 		}
 
-		// Build command that sources env file first
-		var fullCmd string
-		if _, err := os.Stat(envPath); err == nil {
-			fullCmd = fmt.Sprintf("source %q && %s", envPath, command)
-		} else {
-			fullCmd = command
-		}
-
-		cmd := exec.CommandContext(ctx, shell, "-c", fullCmd)
+		// Build command that sources env file first, inside the wrapper so
+		// the wrapper's environment doesn't override it
+		line := wrapCommand(shell, wrapper, withEnvFile(shell, r.WorkDir, command))
+		cmd := exec.CommandContext(ctx, shell, "-c", line)
 		cmd.Dir = r.WorkDir
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
-
-		if err := cmd.Run(); err != nil {
+		// Capture combined output; exec copies stdout and stderr concurrently
+		var output bytes.Buffer
+		capture := &lockedWriter{w: &output}
+		cmd.Stdout = io.MultiWriter(stdout, capture)
+		cmd.Stderr = io.MultiWriter(stderr, capture)
+
+		started := time.Now()
+		err := steps.run(command, cmd.Run)
+		result.Commands = append(result.Commands, backend.CommandResult{
+			Command:   command,
+			ExitCode:  cmd.ProcessState.ExitCode(),
+			StartedAt: started,
+			Duration:  time.Since(started),
+			Output:    output.String(),
+		})
+		if err != nil {
 			return fmt.Errorf("command %d failed: %s: %w", i+1, command, err)
 		}
 	}
@@ -212,6 +431,18 @@ func (r *HostSetupRunner) runCommands(ctx context.Context, commands []string) er
 	return nil
 }
 
+// lockedWriter serializes writes to w.
+type lockedWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (l *lockedWriter) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.w.Write(p)
+}
+
 // copyFile copies a single file from src to dst using streaming to handle large files.
 func copyFile(src, dst string) error {
 	in, err := os.Open(src)
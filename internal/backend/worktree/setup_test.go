@@ -1,8 +1,12 @@
 package worktree
 
 import (
+	"bytes"
 	"context"
+	"errors"
+	"fmt"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"strings"
 	"testing"
@@ -28,7 +32,7 @@ func TestHostSetupRunner_Run(t *testing.T) {
 		},
 	}
 
-	if err := runner.Run(ctx, cfg); err != nil {
+	if _, err := runner.Run(ctx, cfg); err != nil {
 		t.Fatalf("Run() failed: %v", err)
 	}
 
@@ -204,6 +208,31 @@ func TestHostSetupRunner_HandleFilesCopy(t *testing.T) {
 	}
 }
 
+func TestHostSetupRunner_HandleFilesMixedSeparators(t *testing.T) {
+	tmpDir := t.TempDir()
+	srcFile := filepath.Join(tmpDir, "test.txt")
+	if err := os.WriteFile(srcFile, []byte("test content"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	workDir := filepath.Join(tmpDir, "work")
+	if err := os.Mkdir(workDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	runner := &HostSetupRunner{WorkDir: workDir}
+	if err := runner.handleFiles([]config.FileMount{{Source: srcFile, Target: `config\nested/./copied.txt`}}); err != nil {
+		t.Fatalf("handleFiles() failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(workDir, "config", "nested", "copied.txt")); err != nil {
+		t.Errorf("target with mixed separators not copied into config/nested: %v", err)
+	}
+
+	err := runner.handleFiles([]config.FileMount{{Source: srcFile, Target: `config\..\..\escaped.txt`}})
+	if !errors.Is(err, backend.ErrTargetOutsideWorkspace) {
+		t.Errorf("handleFiles() escaping with backslashes error = %v, want ErrTargetOutsideWorkspace", err)
+	}
+}
+
 func TestHostSetupRunner_HandleFilesDirectory(t *testing.T) {
 	tmpDir, err := os.MkdirTemp("", "files-dir-test-*")
 	if err != nil {
@@ -261,7 +290,7 @@ func TestHostSetupRunner_RunCommands(t *testing.T) {
 		},
 	}
 
-	if err := runner.Run(ctx, cfg); err != nil {
+	if _, err := runner.Run(ctx, cfg); err != nil {
 		t.Fatalf("Run() failed: %v", err)
 	}
 
@@ -299,7 +328,7 @@ func TestHostSetupRunner_RunCommandsWithEnv(t *testing.T) {
 		},
 	}
 
-	if err := runner.Run(ctx, cfg); err != nil {
+	if _, err := runner.Run(ctx, cfg); err != nil {
 		t.Fatalf("Run() failed: %v", err)
 	}
 
@@ -312,6 +341,96 @@ func TestHostSetupRunner_RunCommandsWithEnv(t *testing.T) {
 	}
 }
 
+func TestHostSetupRunner_RunCommandsWrapped(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	// A stand-in for nix develop -c: sets up the sandbox, then runs the
+	// command it's given
+	wrapper := filepath.Join(tmpDir, "sandbox")
+	script := "#!/bin/sh\nexport SANDBOX=yes\nexec \"$@\"\n"
+	if err := os.WriteFile(wrapper, []byte(script), 0755); err != nil {
+		t.Fatalf("failed to write wrapper: %v", err)
+	}
+
+	runner := &HostSetupRunner{WorkDir: tmpDir, Shell: "/bin/sh"}
+	cfg := &backend.SetupConfig{
+		Environment: map[string]string{"MY_VAR": "my_value"},
+		// Quotes and chaining stay inside the wrapped command
+		SetupCommands: []string{`echo "$SANDBOX $MY_VAR" > out.txt && echo 'it''s' >> out.txt`},
+		SetupWrapper:  wrapper,
+	}
+
+	result, err := runner.Run(context.Background(), cfg)
+	if err != nil {
+		t.Fatalf("Run() failed: %v", err)
+	}
+
+	content, err := os.ReadFile(filepath.Join(tmpDir, "out.txt"))
+	if err != nil {
+		t.Fatalf("failed to read out.txt: %v", err)
+	}
+	if want := "yes my_value\nits\n"; string(content) != want {
+		t.Errorf("wrapped output = %q, want %q", content, want)
+	}
+	if got := result.Commands[0].Command; got != cfg.SetupCommands[0] {
+		t.Errorf("recorded command = %q, want it unwrapped", got)
+	}
+}
+
+func TestHostSetupRunner_RunCommandsLog(t *testing.T) {
+	tmpDir := t.TempDir()
+	runner := &HostSetupRunner{WorkDir: tmpDir, Shell: "/bin/sh"}
+
+	var log bytes.Buffer
+	cfg := &backend.SetupConfig{
+		SetupCommands: []string{"echo out", "echo err >&2"},
+		Log:           &log,
+	}
+	if _, err := runner.Run(context.Background(), cfg); err != nil {
+		t.Fatalf("Run() failed: %v", err)
+	}
+	if got := log.String(); got != "out\nerr\n" {
+		t.Errorf("log = %q, want both commands' output", got)
+	}
+}
+
+// recordingJournal records setup journal calls as strings.
+type recordingJournal struct {
+	calls []string
+}
+
+func (j *recordingJournal) StepStarted(step int, name string) {
+	j.calls = append(j.calls, fmt.Sprintf("start %d %s", step, name))
+}
+
+func (j *recordingJournal) StepFinished(step int, err error) {
+	j.calls = append(j.calls, fmt.Sprintf("finish %d %v", step, err != nil))
+}
+
+func TestHostSetupRunner_Journal(t *testing.T) {
+	tmpDir := t.TempDir()
+	runner := &HostSetupRunner{WorkDir: tmpDir, Shell: "/bin/sh"}
+
+	journal := &recordingJournal{}
+	cfg := &backend.SetupConfig{
+		Environment:   map[string]string{"A": "1"},
+		SetupCommands: []string{"true", "exit 1", "never run"},
+		Journal:       journal,
+	}
+	if _, err := runner.Run(context.Background(), cfg); err == nil {
+		t.Fatal("Run() succeeded, want error from failing command")
+	}
+
+	want := []string{
+		"start 1 write environment", "finish 1 false",
+		"start 2 true", "finish 2 false",
+		"start 3 exit 1", "finish 3 true",
+	}
+	if strings.Join(journal.calls, "\n") != strings.Join(want, "\n") {
+		t.Errorf("journal calls = %q, want %q", journal.calls, want)
+	}
+}
+
 func TestHostSetupRunner_RunCommandFails(t *testing.T) {
 	tmpDir, err := os.MkdirTemp("", "cmd-fail-test-*")
 	if err != nil {
@@ -328,7 +447,7 @@ func TestHostSetupRunner_RunCommandFails(t *testing.T) {
 		},
 	}
 
-	err = runner.Run(ctx, cfg)
+	_, err = runner.Run(ctx, cfg)
 	if err == nil {
 		t.Fatal("expected error for failing command")
 	}
@@ -354,7 +473,7 @@ func TestHostSetupRunner_ContextCancellation(t *testing.T) {
 		},
 	}
 
-	err = runner.Run(ctx, cfg)
+	_, err = runner.Run(ctx, cfg)
 	if err == nil {
 		t.Fatal("expected error for cancelled context")
 	}
@@ -366,7 +485,7 @@ func TestHostSetupRunner_MissingWorkDir(t *testing.T) {
 
 	cfg := &backend.SetupConfig{}
 
-	err := runner.Run(ctx, cfg)
+	_, err := runner.Run(ctx, cfg)
 	if err == nil {
 		t.Fatal("expected error for missing work directory")
 	}
@@ -447,3 +566,93 @@ func TestCopyDir(t *testing.T) {
 		t.Errorf("expected 'b', got %q", content)
 	}
 }
+
+func TestHostSetupRunner_WriteEnvironmentFish(t *testing.T) {
+	tmpDir := t.TempDir()
+	runner := &HostSetupRunner{WorkDir: tmpDir}
+
+	env := map[string]string{
+		"WITH_QUOTES":    "it's got quotes",
+		"WITH_BACKSLASH": `a\b`,
+	}
+
+	if err := runner.writeEnvironment(env); err != nil {
+		t.Fatalf("writeEnvironment() failed: %v", err)
+	}
+
+	content, err := os.ReadFile(filepath.Join(tmpDir, fishEnvFile))
+	if err != nil {
+		t.Fatalf("failed to read fish env file: %v", err)
+	}
+
+	if !strings.Contains(string(content), `set -gx WITH_QUOTES 'it\'s got quotes'`) {
+		t.Errorf("single quote not properly escaped for fish in: %s", content)
+	}
+	if !strings.Contains(string(content), `set -gx WITH_BACKSLASH 'a\\b'`) {
+		t.Errorf("backslash not properly escaped for fish in: %s", content)
+	}
+}
+
+func TestHostSetupRunner_ConfiguredShell(t *testing.T) {
+	tmpDir := t.TempDir()
+	runner := &HostSetupRunner{WorkDir: tmpDir, Shell: "/bin/sh"}
+
+	_, err := runner.Run(context.Background(), &backend.SetupConfig{
+		Environment:   map[string]string{"GREETING": "hi"},
+		SetupCommands: []string{`echo "$GREETING" > out.txt`},
+	})
+	if err != nil {
+		t.Fatalf("Run() failed: %v", err)
+	}
+
+	content, err := os.ReadFile(filepath.Join(tmpDir, "out.txt"))
+	if err != nil {
+		t.Fatalf("failed to read output: %v", err)
+	}
+	if strings.TrimSpace(string(content)) != "hi" {
+		t.Errorf("output = %q, want %q", content, "hi")
+	}
+
+	runner.Shell = "relative/sh"
+	_, err = runner.Run(context.Background(), &backend.SetupConfig{SetupCommands: []string{"true"}})
+	if !errors.Is(err, ErrInvalidShell) {
+		t.Errorf("Run() with relative shell error = %v, want ErrInvalidShell", err)
+	}
+}
+
+func TestWithEnvFile(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	if got := withEnvFile("/bin/sh", tmpDir, "make"); got != "make" {
+		t.Errorf("withEnvFile() without env file = %q, want %q", got, "make")
+	}
+
+	for _, name := range []string{envFile, fishEnvFile} {
+		if err := os.WriteFile(filepath.Join(tmpDir, name), nil, 0644); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+	}
+
+	posix := withEnvFile("/bin/bash", tmpDir, "make")
+	if !strings.HasPrefix(posix, ". ") || !strings.HasSuffix(posix, envFile+"' && make") {
+		t.Errorf("withEnvFile(bash) = %q", posix)
+	}
+
+	// Paths the shell would otherwise expand or split are sourced as is
+	odd := filepath.Join(tmpDir, `it's $HOME \ "here"`)
+	if err := os.MkdirAll(odd, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(odd, envFile), []byte("export GREETING=hi\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	out, err := exec.Command("/bin/sh", "-c", withEnvFile("/bin/sh", odd, `echo "$GREETING"`)).CombinedOutput()
+	if err != nil || strings.TrimSpace(string(out)) != "hi" {
+		t.Errorf("sourcing the env file from %s = %q, %v; want hi", odd, out, err)
+	}
+
+	fish := withEnvFile("/usr/bin/fish", tmpDir, "make")
+	if !strings.HasSuffix(fish, fishEnvFile+"'; and make") {
+		t.Errorf("withEnvFile(fish) = %q", fish)
+	}
+}
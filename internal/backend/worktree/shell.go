@@ -0,0 +1,120 @@
+package worktree
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// fishEnvFile is the fish-syntax variant of envFile.
+	fishEnvFile = envFile + ".fish"
+)
+
+// validShell returns a validated shell path.
+// If configured is non-empty it is used; otherwise the SHELL env var is used.
+// The shell must be a valid absolute path to an executable.
+// Falls back to /bin/sh if neither is set.
+func validShell(configured string) (string, error) {
+	shell := configured
+	if shell == "" {
+		shell = os.Getenv("SHELL")
+	}
+	if shell == "" {
+		return "/bin/sh", nil
+	}
+
+	// Shell must be an absolute path
+	if !filepath.IsAbs(shell) {
+		return "", fmt.Errorf("%w: must be absolute path: %s", ErrInvalidShell, shell)
+	}
+
+	// Shell path must not contain suspicious characters that could enable injection
+	// Valid shell paths should only contain alphanumeric, slash, dash, underscore, dot
+	for _, c := range shell {
+		if !((c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') ||
+			c == '/' || c == '-' || c == '_' || c == '.') {
+			return "", fmt.Errorf("%w: contains invalid character: %s", ErrInvalidShell, shell)
+		}
+	}
+
+	// Verify it exists and is executable
+	info, err := os.Stat(shell)
+	if err != nil {
+		return "", fmt.Errorf("%w: %s: %v", ErrInvalidShell, shell, err)
+	}
+	if info.IsDir() {
+		return "", fmt.Errorf("%w: is a directory: %s", ErrInvalidShell, shell)
+	}
+
+	return shell, nil
+}
+
+// isFish reports whether shell is the fish shell, which uses its own
+// syntax for variables and command chaining.
+func isFish(shell string) bool {
+	return filepath.Base(shell) == "fish"
+}
+
+// envFileFor returns the env file name whose syntax matches shell.
+func envFileFor(shell string) string {
+	if isFish(shell) {
+		return fishEnvFile
+	}
+	return envFile
+}
+
+// withEnvFile wraps command so that it runs after sourcing the env file in
+// workDir, if one exists for the given shell.
+func withEnvFile(shell, workDir, command string) string {
+	envPath := filepath.Join(workDir, envFileFor(shell))
+	if _, err := os.Stat(envPath); err != nil {
+		return command
+	}
+	if isFish(shell) {
+		return fmt.Sprintf("source %s; and %s", fishQuote(envPath), command)
+	}
+	// Use "." rather than "source" so plain POSIX shells like dash work too
+	return fmt.Sprintf(". %s && %s", posixQuote(envPath), command)
+}
+
+// wrapCommand returns a command line that runs command in shell through
+// wrapper, a command prefix such as "nix develop -c" that runs the command
+// it's given inside a sandboxed environment. The returned line is itself
+// run by shell, so wrapper may use its quoting; command is quoted whole, so
+// its own chaining and redirections stay inside the sandbox. If wrapper is
+// empty, command is returned as it is.
+func wrapCommand(shell, wrapper, command string) string {
+	if wrapper == "" {
+		return command
+	}
+	quoted := posixQuote(command)
+	if isFish(shell) {
+		quoted = fishQuote(command)
+	}
+	return fmt.Sprintf("%s %s -c %s", wrapper, shell, quoted)
+}
+
+// posixQuote quotes s for POSIX shells using single quotes.
+func posixQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// fishQuote quotes s for fish, where backslash and single quote are the
+// only characters that need escaping inside single quotes.
+func fishQuote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, "'", `\'`)
+	return "'" + s + "'"
+}
+
+// checkShellSetting validates a shell configured for a worktree backend in
+// the global config. Only the form is checked; whether the shell exists is
+// checked when it is used.
+func checkShellSetting(shell string) error {
+	if !filepath.IsAbs(shell) {
+		return fmt.Errorf("%w: must be absolute path: %s", ErrInvalidShell, shell)
+	}
+	return nil
+}
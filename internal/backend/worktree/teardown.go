@@ -0,0 +1,119 @@
+package worktree
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+// teardownFile is the manifest of what Destroy must do besides removing the
+// worktree. It is written by setup and starts with envFile, so it is
+// excluded from git like the other files choir writes.
+const teardownFile = envFile + "-teardown"
+
+// teardown is the content of the teardown manifest.
+type teardown struct {
+	// PreDestroy are commands to run in the worktree before removing it.
+	PreDestroy []string `json:"pre_destroy,omitempty"`
+
+	// Outside are files setup mounted outside the worktree, which removing
+	// it would leave behind.
+	Outside []outsideFile `json:"outside,omitempty"`
+}
+
+// outsideFile is a file or directory setup mounted outside the worktree.
+type outsideFile struct {
+	Path string `json:"path"`
+
+	// LinksTo is the source Path is a symlink to, or empty if Path is a
+	// copy. A symlink is only removed if it still points there.
+	LinksTo string `json:"links_to,omitempty"`
+}
+
+// readTeardown reads the teardown manifest of the worktree at dir. A
+// worktree without one has nothing to tear down.
+func readTeardown(dir string) (teardown, error) {
+	var t teardown
+	data, err := os.ReadFile(filepath.Join(dir, teardownFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return t, nil
+	}
+	if err != nil {
+		return t, err
+	}
+	if err := json.Unmarshal(data, &t); err != nil {
+		return t, fmt.Errorf("invalid teardown manifest: %w", err)
+	}
+	return t, nil
+}
+
+// updateTeardown applies fn to the teardown manifest of the worktree at
+// dir and writes it back. The manifest is rewritten after each change, so
+// a setup that dies midway still leaves what it did recorded.
+func updateTeardown(dir string, fn func(*teardown)) error {
+	t, err := readTeardown(dir)
+	if err != nil {
+		return err
+	}
+	fn(&t)
+	data, err := json.MarshalIndent(t, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, teardownFile), append(data, '\n'), 0644)
+}
+
+// tearDown carries out the teardown manifest of the worktree at dir: it
+// runs the pre_destroy commands, then removes the files mounted outside the
+// worktree. It keeps going past failures, since the worktree is going away
+// regardless, and warns about them on stderr.
+func (b *Backend) tearDown(ctx context.Context, dir string) {
+	t, err := readTeardown(dir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "warning: skipping teardown of %s: %v\n", dir, err)
+		return
+	}
+
+	if err := b.runPreDestroy(ctx, dir, t.PreDestroy); err != nil {
+		fmt.Fprintf(os.Stderr, "warning: skipping pre_destroy commands: %v\n", err)
+	}
+	for _, f := range t.Outside {
+		if f.LinksTo != "" {
+			if target, err := os.Readlink(f.Path); err != nil || target != f.LinksTo {
+				continue // Gone, or replaced by something setup didn't make
+			}
+		}
+		if err := os.RemoveAll(f.Path); err != nil {
+			fmt.Fprintf(os.Stderr, "warning: failed to remove %s: %v\n", f.Path, err)
+		}
+	}
+}
+
+// runPreDestroy runs commands in the worktree at dir, as setup commands
+// run, warning about those that fail. It fails only if there is no shell
+// to run them with.
+func (b *Backend) runPreDestroy(ctx context.Context, dir string, commands []string) error {
+	if len(commands) == 0 {
+		return nil
+	}
+	shell, err := validShell(b.shell)
+	if err != nil {
+		return err
+	}
+	for i, command := range commands {
+		cmd := exec.CommandContext(ctx, shell, "-c", withEnvFile(shell, dir, command))
+		cmd.Dir = dir
+		cmd.Env = append(os.Environ(), identityEnv(dir)...)
+		// Leave stdout to the command removing the environment
+		cmd.Stdout = os.Stderr
+		cmd.Stderr = os.Stderr
+		if err := cmd.Run(); err != nil {
+			fmt.Fprintf(os.Stderr, "warning: pre_destroy command %d failed: %s: %v\n", i+1, command, err)
+		}
+	}
+	return nil
+}
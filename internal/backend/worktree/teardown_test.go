@@ -0,0 +1,111 @@
+package worktree
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Quidge/choir/internal/backend"
+	"github.com/Quidge/choir/internal/config"
+)
+
+func TestDestroyTearsDown(t *testing.T) {
+	setupXDGDataHome(t)
+	repoDir := setupTestRepo(t)
+
+	b, _ := New(backend.BackendConfig{Shell: "/bin/sh"})
+	ctx := context.Background()
+	backendID, err := b.Create(ctx, &config.CreateConfig{
+		ID:         "tear12def456abc123def456abc12345",
+		Repository: config.RepositoryInfo{Path: repoDir, BaseBranch: "HEAD"},
+	})
+	if err != nil {
+		t.Fatalf("Create() failed: %v", err)
+	}
+
+	source := filepath.Join(t.TempDir(), "secret")
+	if err := os.WriteFile(source, []byte("s3cret"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	outside := t.TempDir()
+	log := filepath.Join(outside, "pre_destroy.log")
+	linked := filepath.Join(outside, "linked")
+	copied := filepath.Join(outside, "copied")
+	replaced := filepath.Join(outside, "replaced")
+
+	runner := b.NewSetupRunner(backendID)
+	_, err = runner.Run(ctx, &backend.SetupConfig{
+		Environment: map[string]string{"GREETING": "bye"},
+		Files: []config.FileMount{
+			{Source: source, Target: linked, ReadOnly: true, AllowOutsideWorkspace: true},
+			{Source: source, Target: copied, AllowOutsideWorkspace: true},
+			{Source: source, Target: replaced, ReadOnly: true, AllowOutsideWorkspace: true},
+			{Source: source, Target: "inside"},
+		},
+		PreDestroy: []string{
+			`echo "$GREETING $CHOIR_ENV_ID" >> ` + log,
+			"exit 1", // Reported, but doesn't stop the rest
+			"echo done >> " + log,
+		},
+	})
+	if err != nil {
+		t.Fatalf("setup failed: %v", err)
+	}
+
+	// A symlink the user has since replaced isn't setup's to remove
+	if err := os.Remove(replaced); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(replaced, []byte("mine"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := b.Destroy(ctx, backendID); err != nil {
+		t.Fatalf("Destroy() failed: %v", err)
+	}
+
+	data, err := os.ReadFile(log)
+	if err != nil {
+		t.Fatalf("pre_destroy commands didn't run: %v", err)
+	}
+	if got, want := string(data), "bye tear12def456abc123def456abc12345\ndone\n"; got != want {
+		t.Errorf("pre_destroy log = %q, want %q", got, want)
+	}
+	for _, path := range []string{linked, copied} {
+		if _, err := os.Lstat(path); !os.IsNotExist(err) {
+			t.Errorf("%s was left behind", path)
+		}
+	}
+	if data, err := os.ReadFile(replaced); err != nil || string(data) != "mine" {
+		t.Errorf("replaced file = %q, %v; want it kept", data, err)
+	}
+	if _, err := os.Stat(source); err != nil {
+		t.Errorf("mount source was removed: %v", err)
+	}
+}
+
+func TestTeardownManifest(t *testing.T) {
+	dir := t.TempDir()
+	if td, err := readTeardown(dir); err != nil || len(td.PreDestroy)+len(td.Outside) != 0 {
+		t.Fatalf("readTeardown() without a manifest = %+v, %v; want empty", td, err)
+	}
+
+	if err := updateTeardown(dir, func(td *teardown) { td.PreDestroy = []string{"docker compose down"} }); err != nil {
+		t.Fatal(err)
+	}
+	if err := updateTeardown(dir, func(td *teardown) { td.Outside = append(td.Outside, outsideFile{Path: "/tmp/x"}) }); err != nil {
+		t.Fatal(err)
+	}
+	td, err := readTeardown(dir)
+	if err != nil {
+		t.Fatalf("readTeardown() failed: %v", err)
+	}
+	if len(td.PreDestroy) != 1 || len(td.Outside) != 1 || td.Outside[0].Path != "/tmp/x" {
+		t.Errorf("readTeardown() = %+v, want both updates", td)
+	}
+	if !strings.HasPrefix(teardownFile, envFile) {
+		t.Errorf("teardown manifest %s isn't covered by the %s* excludes", teardownFile, envFile)
+	}
+}
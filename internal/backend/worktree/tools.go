@@ -0,0 +1,104 @@
+package worktree
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/Quidge/choir/internal/config"
+)
+
+// ErrUnknownProvisioner is returned when tools.provisioner names a version
+// manager the worktree backend doesn't support.
+var ErrUnknownProvisioner = errors.New("unknown tools provisioner")
+
+// toolProvisioner installs language-level tools on the host with a version
+// manager.
+type toolProvisioner struct {
+	// command is the executable the provisioner needs.
+	command string
+
+	// commands returns the shell commands that install tools, given as
+	// name@version. With no tools, they install whatever the repository's
+	// own tool file lists.
+	commands func(tools []string) []string
+}
+
+// toolProvisioners are the supported tools.provisioner values.
+var toolProvisioners = map[string]toolProvisioner{
+	"mise": {
+		command: "mise",
+		commands: func(tools []string) []string {
+			// A new worktree's .mise.toml is untrusted until marked otherwise
+			return []string{`MISE_TRUSTED_CONFIG_PATHS="$PWD" ` + joinCommand("mise install", tools)}
+		},
+	},
+	"asdf": {
+		command: "asdf",
+		commands: func(tools []string) []string {
+			if len(tools) == 0 {
+				return []string{"asdf install"}
+			}
+			cmds := make([]string, len(tools))
+			for i, tool := range tools {
+				// asdf takes the version as a separate argument
+				cmds[i] = joinCommand("asdf install", strings.Fields(strings.Replace(tool, "@", " ", 1)))
+			}
+			return cmds
+		},
+	},
+	"brew": {
+		command: "brew",
+		commands: func(tools []string) []string {
+			if len(tools) == 0 {
+				return []string{"brew bundle install"}
+			}
+			return []string{joinCommand("brew install", tools)}
+		},
+	},
+}
+
+// lookupProvisioner returns the provisioner named by cfg.
+func lookupProvisioner(cfg config.ToolsConfig) (toolProvisioner, error) {
+	p, ok := toolProvisioners[cfg.Provisioner]
+	if !ok {
+		names := make([]string, 0, len(toolProvisioners))
+		for name := range toolProvisioners {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return toolProvisioner{}, fmt.Errorf("%w %q (supported: %s)", ErrUnknownProvisioner, cfg.Provisioner, strings.Join(names, ", "))
+	}
+	return p, nil
+}
+
+// toolCommands returns the commands that install the tools in cfg, or nil
+// if no provisioner is configured.
+func toolCommands(cfg config.ToolsConfig) ([]string, error) {
+	if cfg.Provisioner == "" {
+		if len(cfg.Install) > 0 {
+			return nil, fmt.Errorf("tools.install requires tools.provisioner")
+		}
+		return nil, nil
+	}
+	p, err := lookupProvisioner(cfg)
+	if err != nil {
+		return nil, err
+	}
+	for _, tool := range cfg.Install {
+		name, _, _ := strings.Cut(tool, "@")
+		if name == "" || strings.ContainsAny(tool, " \t\n'\"$`;&|<>()\\") {
+			return nil, fmt.Errorf("invalid tool %q: use name or name@version", tool)
+		}
+	}
+	return p.commands(cfg.Install), nil
+}
+
+// joinCommand appends args to command, space separated.
+func joinCommand(command string, args []string) string {
+	if len(args) == 0 {
+		return command
+	}
+	return command + " " + strings.Join(args, " ")
+}
@@ -0,0 +1,104 @@
+package worktree
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/Quidge/choir/internal/backend"
+	"github.com/Quidge/choir/internal/config"
+)
+
+func TestToolCommands(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     config.ToolsConfig
+		want    []string
+		wantErr bool
+	}{
+		{name: "none", cfg: config.ToolsConfig{}, want: nil},
+		{
+			name: "mise from tool file",
+			cfg:  config.ToolsConfig{Provisioner: "mise"},
+			want: []string{`MISE_TRUSTED_CONFIG_PATHS="$PWD" mise install`},
+		},
+		{
+			name: "mise tools",
+			cfg:  config.ToolsConfig{Provisioner: "mise", Install: []string{"node@20", "go"}},
+			want: []string{`MISE_TRUSTED_CONFIG_PATHS="$PWD" mise install node@20 go`},
+		},
+		{
+			name: "asdf tools",
+			cfg:  config.ToolsConfig{Provisioner: "asdf", Install: []string{"nodejs@20.11.0", "python"}},
+			want: []string{"asdf install nodejs 20.11.0", "asdf install python"},
+		},
+		{
+			name: "brew bundle",
+			cfg:  config.ToolsConfig{Provisioner: "brew"},
+			want: []string{"brew bundle install"},
+		},
+		{
+			name:    "unknown provisioner",
+			cfg:     config.ToolsConfig{Provisioner: "nix"},
+			wantErr: true,
+		},
+		{
+			name:    "install without provisioner",
+			cfg:     config.ToolsConfig{Install: []string{"node"}},
+			wantErr: true,
+		},
+		{
+			name:    "shell metacharacters",
+			cfg:     config.ToolsConfig{Provisioner: "mise", Install: []string{"node; rm -rf /"}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := toolCommands(tt.cfg)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("toolCommands() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("toolCommands() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := toolCommands(config.ToolsConfig{Provisioner: "nix"}); !errors.Is(err, ErrUnknownProvisioner) {
+		t.Errorf("unknown provisioner error = %v, want ErrUnknownProvisioner", err)
+	}
+}
+
+func TestHostSetupRunner_ToolsBeforeSetup(t *testing.T) {
+	toolProvisioners["test"] = toolProvisioner{
+		command:  "sh",
+		commands: func(tools []string) []string { return []string{joinCommand("echo", tools) + " > tools.log"} },
+	}
+	t.Cleanup(func() { delete(toolProvisioners, "test") })
+
+	tmpDir := t.TempDir()
+	runner := &HostSetupRunner{WorkDir: tmpDir, Shell: "/bin/sh"}
+	result, err := runner.Run(context.Background(), &backend.SetupConfig{
+		Tools:         config.ToolsConfig{Provisioner: "test", Install: []string{"node@20"}},
+		SetupCommands: []string{"cp tools.log setup.log"},
+	})
+	if err != nil {
+		t.Fatalf("Run() failed: %v", err)
+	}
+	if len(result.Commands) != 2 {
+		t.Errorf("result has %d commands, want tools install and setup", len(result.Commands))
+	}
+
+	data, err := os.ReadFile(filepath.Join(tmpDir, "setup.log"))
+	if err != nil {
+		t.Fatalf("setup command didn't see installed tools: %v", err)
+	}
+	if string(data) != "node@20\n" {
+		t.Errorf("tools.log = %q, want %q", data, "node@20\n")
+	}
+}
@@ -0,0 +1,88 @@
+package worktree
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/Quidge/choir/internal/backend"
+	"github.com/Quidge/choir/internal/gitutil"
+	"github.com/Quidge/choir/internal/trash"
+)
+
+// Ensure Backend implements Trasher.
+var _ backend.Trasher = (*Backend)(nil)
+
+// Trash moves the worktree into its environment's trash entry, keeping its
+// directory name so it is still recognized as choir-managed. Its branch
+// stays checked out there, so git won't let another worktree take it.
+func (b *Backend) Trash(ctx context.Context, backendID string) (string, error) {
+	m, err := readMarker(backendID)
+	if err != nil {
+		return "", fmt.Errorf("failed to read marker file: %w", err)
+	}
+	entryDir, err := trash.EntryDir(m.ID)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(entryDir, 0700); err != nil {
+		return "", fmt.Errorf("failed to create trash entry: %w", err)
+	}
+	dest := filepath.Join(entryDir, filepath.Base(backendID))
+	if err := moveWorktree(ctx, backendID, dest); err != nil {
+		return "", err
+	}
+	return dest, nil
+}
+
+// Untrash moves a trashed worktree back to where Create put it and removes
+// its trash entry's directory if nothing else is saved there.
+func (b *Backend) Untrash(ctx context.Context, backendID string) (string, error) {
+	basePath, err := worktreesBasePath()
+	if err != nil {
+		return "", fmt.Errorf("failed to determine worktrees path: %w", err)
+	}
+	dest := filepath.Join(basePath, filepath.Base(backendID))
+	if _, err := os.Lstat(dest); err == nil {
+		return "", fmt.Errorf("%s already exists", dest)
+	}
+	if err := moveWorktree(ctx, backendID, dest); err != nil {
+		return "", err
+	}
+	_ = os.Remove(filepath.Dir(backendID)) // Only if empty
+	return dest, nil
+}
+
+// moveWorktree moves the worktree at from to to with git worktree move,
+// which refuses worktrees with submodules; those are renamed and repaired
+// instead.
+func moveWorktree(ctx context.Context, from, to string) error {
+	repoRoot, err := findMainRepo(from)
+	if err != nil {
+		return fmt.Errorf("failed to find main repository: %w", err)
+	}
+	if err := gitutil.WaitForLocks(ctx, repoRoot, lockWaitTimeout); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(to), 0755); err != nil {
+		return fmt.Errorf("failed to create %s: %w", filepath.Dir(to), err)
+	}
+
+	cmd := exec.CommandContext(ctx, "git", "worktree", "move", from, to)
+	cmd.Dir = repoRoot
+	cmd.Env = cleanGitEnv()
+	out, err := cmd.CombinedOutput()
+	if err == nil {
+		return nil
+	}
+	if rnErr := os.Rename(from, to); rnErr != nil {
+		return fmt.Errorf("failed to move worktree: %w\ngit output: %s", rnErr, strings.TrimSpace(string(out)))
+	}
+	if _, err := git(ctx, repoRoot, "worktree", "repair", to); err != nil {
+		return fmt.Errorf("failed to repair moved worktree: %w", err)
+	}
+	return nil
+}
@@ -12,6 +12,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io/fs"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -19,6 +20,11 @@ import (
 
 	"github.com/Quidge/choir/internal/backend"
 	"github.com/Quidge/choir/internal/config"
+	"github.com/Quidge/choir/internal/gitutil"
+	"github.com/Quidge/choir/internal/msg"
+	"github.com/Quidge/choir/internal/pathutil"
+	"github.com/Quidge/choir/internal/preflight"
+	"github.com/Quidge/choir/internal/trash"
 )
 
 var (
@@ -39,42 +45,15 @@ var (
 
 	// ErrInvalidShell is returned when the SHELL environment variable contains an invalid path.
 	ErrInvalidShell = errors.New("invalid shell path")
-)
-
-// validShell returns a validated shell path.
-// It checks that the SHELL env var (if set) is a valid absolute path to an executable.
-// Falls back to /bin/sh if SHELL is unset or invalid.
-func validShell() (string, error) {
-	shell := os.Getenv("SHELL")
-	if shell == "" {
-		return "/bin/sh", nil
-	}
-
-	// Shell must be an absolute path
-	if !filepath.IsAbs(shell) {
-		return "", fmt.Errorf("%w: must be absolute path: %s", ErrInvalidShell, shell)
-	}
-
-	// Shell path must not contain suspicious characters that could enable injection
-	// Valid shell paths should only contain alphanumeric, slash, dash, underscore, dot
-	for _, c := range shell {
-		if !((c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') ||
-			c == '/' || c == '-' || c == '_' || c == '.') {
-			return "", fmt.Errorf("%w: contains invalid character: %s", ErrInvalidShell, shell)
-		}
-	}
 
-	// Verify it exists and is executable
-	info, err := os.Stat(shell)
-	if err != nil {
-		return "", fmt.Errorf("%w: %s: %v", ErrInvalidShell, shell, err)
-	}
-	if info.IsDir() {
-		return "", fmt.Errorf("%w: is a directory: %s", ErrInvalidShell, shell)
-	}
+	// ErrSubmoduleInit is returned when submodules fail to initialize.
+	ErrSubmoduleInit = errors.New("failed to initialize submodules")
+)
 
-	return shell, nil
-}
+// lockWaitTimeout is how long to wait for git processes the user is running
+// in the main repository to release their locks. A variable so tests can
+// shorten it.
+var lockWaitTimeout = gitutil.DefaultLockTimeout
 
 // cleanGitEnv returns a clean environment without git-specific variables
 // that might interfere with git operations (e.g., when running inside git hooks).
@@ -123,15 +102,46 @@ type Backend struct {
 	// repoRoot is the root of the main git repository.
 	// This is determined dynamically based on the CreateConfig.
 	repoRoot string
+
+	// shell is the configured shell path. If empty, $SHELL is used.
+	shell string
 }
 
 // New creates a new worktree backend.
 func New(cfg backend.BackendConfig) (backend.Backend, error) {
-	return &Backend{}, nil
+	return &Backend{shell: cfg.Shell}, nil
 }
 
 func init() {
 	backend.Register(BackendType, New)
+	config.RegisterBackendSchema(BackendType, config.BackendSchema{
+		Settings: map[string]func(string) error{
+			"shell": checkShellSetting,
+		},
+	})
+}
+
+// worktreeShortID returns the short form of id used for directory and
+// branch names: its first 12 characters. Word IDs (e.g., brave-otter-3f9c)
+// are short already and used whole.
+func worktreeShortID(id string) string {
+	if len(id) > 12 && !strings.Contains(id, "-") {
+		return id[:12]
+	}
+	return id
+}
+
+// Ensure Backend implements WorkspacePlanner.
+var _ backend.WorkspacePlanner = (*Backend)(nil)
+
+// WorkspacePath returns the worktree Create would make for cfg:
+// ~/.local/share/choir/worktrees/choir-<short-id>/.
+func (b *Backend) WorkspacePath(cfg *config.CreateConfig) (string, error) {
+	basePath, err := worktreesBasePath()
+	if err != nil {
+		return "", fmt.Errorf("failed to determine worktrees path: %w", err)
+	}
+	return filepath.Join(basePath, worktreePrefix+worktreeShortID(cfg.ID)), nil
 }
 
 // Create provisions a new workspace using git worktree.
@@ -147,40 +157,41 @@ func (b *Backend) Create(ctx context.Context, cfg *config.CreateConfig) (string,
 
 	// Warn if packages are specified (worktree backend can't install them)
 	if len(cfg.Packages) > 0 {
-		fmt.Fprintf(os.Stderr, "warning: worktree backend ignores packages configuration\n")
+		fmt.Fprintf(os.Stderr, "warning: worktree backend ignores packages configuration (use tools to install language tools)\n")
+	}
+	if err := backend.Validate(BackendType, b.Capabilities(), cfg); err != nil {
+		return "", err
+	}
+	if len(cfg.Ports) > 0 {
+		fmt.Fprintf(os.Stderr, "warning: worktree backend ignores ports configuration (worktrees share the host's network)\n")
 	}
 
 	repoRoot := cfg.Repository.Path
 	b.repoRoot = repoRoot
 
-	// Use short ID (first 12 chars) for directory and branch names
-	shortID := cfg.ID
-	if len(shortID) > 12 {
-		shortID = shortID[:12]
-	}
-
-	// Determine worktree location: ~/.local/share/choir/worktrees/choir-<short-id>/
-	basePath, err := worktreesBasePath()
+	shortID := worktreeShortID(cfg.ID)
+	worktreePath, err := b.WorkspacePath(cfg)
 	if err != nil {
-		return "", fmt.Errorf("failed to determine worktrees path: %w", err)
+		return "", err
 	}
 
 	// Ensure base directory exists
-	if err := os.MkdirAll(basePath, 0755); err != nil {
+	if err := os.MkdirAll(filepath.Dir(worktreePath), 0755); err != nil {
 		return "", fmt.Errorf("failed to create worktrees directory: %w", err)
 	}
 
-	worktreePath := filepath.Join(basePath, worktreePrefix+shortID)
-
 	// Check if worktree already exists
 	if _, err := os.Stat(worktreePath); err == nil {
 		return "", fmt.Errorf("%w: %s", ErrWorktreeExists, worktreePath)
 	}
 
-	// Determine branch name: <prefix><short-id>
-	branchName := cfg.BranchPrefix + shortID
-	if cfg.BranchPrefix == "" {
-		branchName = "env/" + shortID
+	// Determine branch name: explicit, or <prefix><short-id>
+	branchName := cfg.BranchName
+	if branchName == "" {
+		branchName = cfg.BranchPrefix + shortID
+		if cfg.BranchPrefix == "" {
+			branchName = "env/" + shortID
+		}
 	}
 
 	// Determine base branch
@@ -189,9 +200,27 @@ func (b *Backend) Create(ctx context.Context, cfg *config.CreateConfig) (string,
 		baseBranch = "HEAD"
 	}
 
-	// Create the worktree with a new branch
+	// Don't race with git commands the user is running in the main repo,
+	// or branch from the middle of their rebase or merge
+	if err := gitutil.WaitIdle(ctx, repoRoot, lockWaitTimeout); err != nil {
+		return "", err
+	}
+
+	// Create the worktree with a new branch, or on an existing one
 	// git worktree add -b <branch> <path> <base>
-	cmd := exec.CommandContext(ctx, "git", "worktree", "add", "-b", branchName, worktreePath, baseBranch)
+	// git worktree add <path> <branch>
+	// A sparse worktree is checked out once its sparse paths are set, so
+	// the rest of the tree is never written.
+	args := []string{"worktree", "add"}
+	if len(cfg.Sparse) > 0 {
+		args = append(args, "--no-checkout")
+	}
+	if cfg.ExistingBranch {
+		args = append(args, worktreePath, branchName)
+	} else {
+		args = append(args, "-b", branchName, worktreePath, baseBranch)
+	}
+	cmd := exec.CommandContext(ctx, "git", args...)
 	cmd.Dir = repoRoot
 	cmd.Env = cleanGitEnv()
 	output, err := cmd.CombinedOutput()
@@ -208,22 +237,167 @@ func (b *Backend) Create(ctx context.Context, cfg *config.CreateConfig) (string,
 	configCmd.Env = cleanGitEnv()
 	_ = configCmd.Run() // Ignore errors - older git versions will refuse but that's ok
 
+	if len(cfg.Sparse) > 0 {
+		if err := sparseCheckout(ctx, worktreePath, cfg.Sparse); err != nil {
+			_ = b.Destroy(ctx, worktreePath)
+			return "", err
+		}
+	}
+
 	// Create the marker file to identify this as a choir-managed worktree
-	markerPath := filepath.Join(worktreePath, markerFile)
-	markerContent := fmt.Sprintf("id: %s\ncreated_by: choir\n", cfg.ID)
-	if err := os.WriteFile(markerPath, []byte(markerContent), 0644); err != nil {
+	if err := writeMarker(worktreePath, cfg.ID, branchName); err != nil {
 		// Try to clean up the worktree on failure
 		_ = b.Destroy(ctx, worktreePath)
 		return "", fmt.Errorf("failed to create marker file: %w", err)
 	}
 
+	// Keep the marker and env files out of git status, so agents don't
+	// commit them
+	if err := addExcludes(ctx, worktreePath, choirExcludes); err != nil {
+		_ = b.Destroy(ctx, worktreePath)
+		return "", fmt.Errorf("failed to update git excludes: %w", err)
+	}
+
+	if cfg.Submodules {
+		if err := initSubmodules(ctx, worktreePath); err != nil {
+			_ = b.Destroy(ctx, worktreePath)
+			return "", err
+		}
+	}
+
 	return worktreePath, nil
 }
 
+// sparseCheckout checks out only paths (and the files at the root) in a
+// worktree created with --no-checkout. The sparse-checkout settings are
+// stored in the worktree's own config, so the main checkout and other
+// worktrees are unaffected.
+func sparseCheckout(ctx context.Context, worktreePath string, paths []string) error {
+	// The index is empty after --no-checkout; read-tree fills it and
+	// writes only the files within the sparse paths
+	for _, args := range [][]string{
+		append([]string{"sparse-checkout", "set", "--cone", "--"}, paths...),
+		{"read-tree", "-mu", "HEAD"},
+	} {
+		cmd := exec.CommandContext(ctx, "git", args...)
+		cmd.Dir = worktreePath
+		cmd.Env = cleanGitEnv()
+		if output, err := cmd.CombinedOutput(); err != nil {
+			return fmt.Errorf("failed to set up sparse checkout: %w\noutput: %s", err, output)
+		}
+	}
+	return nil
+}
+
+// initSubmodules checks out all submodules (recursively) in a new worktree.
+// Git's progress output is streamed to stderr since large submodules can
+// take a while to fetch; in quiet mode it is kept only to report a failure.
+func initSubmodules(ctx context.Context, worktreePath string) error {
+	if _, err := os.Stat(filepath.Join(worktreePath, ".gitmodules")); os.IsNotExist(err) {
+		return nil
+	}
+
+	msg.Fprintf(os.Stderr, "Initializing submodules...\n")
+	args := []string{"submodule", "update", "--init", "--recursive"}
+	if msg.Quiet() {
+		cmd := exec.CommandContext(ctx, "git", args...)
+		cmd.Dir = worktreePath
+		cmd.Env = cleanGitEnv()
+		if output, err := cmd.CombinedOutput(); err != nil {
+			return fmt.Errorf("%w: %v\noutput: %s", ErrSubmoduleInit, err, output)
+		}
+		return nil
+	}
+
+	cmd := exec.CommandContext(ctx, "git", append(args, "--progress")...)
+	cmd.Dir = worktreePath
+	cmd.Env = cleanGitEnv()
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%w: %v", ErrSubmoduleInit, err)
+	}
+	return nil
+}
+
+// freeSpaceMargin is extra space required beyond the estimated checkout size,
+// covering git metadata, build artifacts from setup, and filesystem overhead.
+const freeSpaceMargin = 256 << 20 // 256 MiB
+
+// Ensure Backend implements CapabilityReporter.
+var _ backend.CapabilityReporter = (*Backend)(nil)
+
+// Capabilities reports that worktrees can mount files anywhere on the host,
+// but share its network and resources, so network policies and resource
+// allocations can't be enforced. Their paths are the host's, and setup can
+// run through a setup wrapper such as nix develop, which runs on the host.
+func (b *Backend) Capabilities() backend.Capabilities {
+	return backend.Capabilities{OutsideMounts: true, Paths: pathutil.HostStyle(), SetupWrapper: true}
+}
+
+// Ensure Backend implements Preflighter.
+var _ backend.Preflighter = (*Backend)(nil)
+
+// Preflight verifies git (and the tools provisioner and setup wrapper, if
+// any) is installed and that the worktrees directory has room for a
+// checkout of the base branch, or of the existing branch being checked out.
+// The space check is skipped for partial clones.
+func (b *Backend) Preflight(ctx context.Context, cfg *config.CreateConfig) error {
+	basePath, err := worktreesBasePath()
+	if err != nil {
+		return fmt.Errorf("failed to determine worktrees path: %w", err)
+	}
+
+	baseBranch := cfg.Repository.BaseBranch
+	if cfg.ExistingBranch {
+		baseBranch = cfg.BranchName
+	}
+	if baseBranch == "" {
+		baseBranch = "HEAD"
+	}
+
+	spaceCheck := preflight.Check{
+		Name: "free space for worktree",
+		Run: func(ctx context.Context) error {
+			// Files at the root of a sparse checkout aren't counted, but
+			// they're usually small next to the margin
+			size, err := gitutil.TreeSize(cfg.Repository.Path, baseBranch, cfg.Sparse...)
+			if err != nil {
+				return fmt.Errorf("failed to estimate worktree size: %w", err)
+			}
+			needed := uint64(size) + uint64(size)/10 + freeSpaceMargin
+			return preflight.RequireFreeSpace(basePath, needed).Run(ctx)
+		},
+	}
+
+	checks := []preflight.Check{preflight.RequireCommand("git")}
+	if _, err := toolCommands(cfg.Tools); err != nil {
+		return fmt.Errorf("invalid tools config: %w", err)
+	}
+	if cfg.Tools.Provisioner != "" {
+		p, _ := lookupProvisioner(cfg.Tools)
+		checks = append(checks, preflight.RequireCommand(p.command))
+	}
+	if fields := strings.Fields(cfg.SetupWrapper); len(fields) > 0 {
+		checks = append(checks, preflight.RequireCommand(fields[0]))
+	}
+
+	results := preflight.Run(ctx, checks)
+	if err := preflight.Failed(results); err != nil {
+		return err
+	}
+	// Sizing a partial clone's tree would fetch every blob it left out
+	if gitutil.IsPartialClone(cfg.Repository.Path) {
+		return nil
+	}
+	return preflight.Failed(preflight.Run(ctx, []preflight.Check{spaceCheck}))
+}
+
 // NewSetupRunner returns a HostSetupRunner for this worktree.
 func (b *Backend) NewSetupRunner(backendID string) backend.SetupRunner {
 	return &HostSetupRunner{
 		WorkDir: backendID,
+		Shell:   b.shell,
 	}
 }
 
@@ -245,8 +419,17 @@ func (b *Backend) Stop(ctx context.Context, backendID string) error {
 	return nil
 }
 
-// Destroy removes a worktree using git worktree remove.
+// Destroy carries out the worktree's teardown manifest (see
+// backend.SetupConfig.PreDestroy), then removes it using git worktree remove,
+// whatever work it holds. DestroyWithOptions checks for unpushed commits first.
 func (b *Backend) Destroy(ctx context.Context, backendID string) error {
+	b.tearDown(ctx, backendID)
+
+	// A trashed worktree's entry goes too, unless a backup was saved there
+	if base, err := trash.Dir(); err == nil && strings.HasPrefix(backendID, base+string(filepath.Separator)) {
+		defer os.Remove(filepath.Dir(backendID)) // Only if empty
+	}
+
 	// Find the main repo root by checking git config
 	repoRoot, err := findMainRepo(backendID)
 	if err != nil {
@@ -254,6 +437,12 @@ func (b *Backend) Destroy(ctx context.Context, backendID string) error {
 		return os.RemoveAll(backendID)
 	}
 
+	// Removing a worktree updates the main repo's metadata, so wait for the
+	// user's git commands to finish rather than failing midway
+	if err := gitutil.WaitForLocks(ctx, repoRoot, lockWaitTimeout); err != nil {
+		return err
+	}
+
 	// Use git worktree remove --force
 	cmd := exec.CommandContext(ctx, "git", "worktree", "remove", "--force", backendID)
 	cmd.Dir = repoRoot
@@ -270,28 +459,30 @@ func (b *Backend) Destroy(ctx context.Context, backendID string) error {
 }
 
 // Shell opens an interactive shell in the worktree directory.
-// It sources the .choir-env file if present.
+// It sources the env file matching the shell (.choir-env or .choir-env.fish)
+// if present, and exports CHOIR_ENV_ID and CHOIR_BRANCH so prompts and
+// scripts in the shell can tell which environment they're in.
 func (b *Backend) Shell(ctx context.Context, backendID string) error {
 	if _, err := os.Stat(backendID); os.IsNotExist(err) {
 		return fmt.Errorf("%w: %s", ErrWorktreeNotFound, backendID)
 	}
 
-	shell, err := validShell()
+	shell, err := validShell(b.shell)
 	if err != nil {
 		return err
 	}
 
 	// Build the command to source env file if it exists, then exec shell
-	envPath := filepath.Join(backendID, envFile)
 	var cmd *exec.Cmd
-	if _, err := os.Stat(envPath); err == nil {
+	if shellCmd := withEnvFile(shell, backendID, "exec "+shell); shellCmd != "exec "+shell {
 		// Source the env file before starting the shell
-		cmd = exec.CommandContext(ctx, shell, "-c", fmt.Sprintf("source %q && exec %s", envPath, shell))
+		cmd = exec.CommandContext(ctx, shell, "-c", shellCmd)
 	} else {
 		cmd = exec.CommandContext(ctx, shell)
 	}
 
 	cmd.Dir = backendID
+	cmd.Env = append(os.Environ(), identityEnv(backendID)...)
 	cmd.Stdin = os.Stdin
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
@@ -305,21 +496,13 @@ func (b *Backend) Exec(ctx context.Context, backendID string, command string) (s
 		return "", -1, fmt.Errorf("%w: %s", ErrWorktreeNotFound, backendID)
 	}
 
-	shell, err := validShell()
+	shell, err := validShell(b.shell)
 	if err != nil {
 		return "", -1, err
 	}
 
 	// Build the shell command, sourcing env file if present
-	envPath := filepath.Join(backendID, envFile)
-	var shellCmd string
-	if _, err := os.Stat(envPath); err == nil {
-		shellCmd = fmt.Sprintf("source %q && %s", envPath, command)
-	} else {
-		shellCmd = command
-	}
-
-	cmd := exec.CommandContext(ctx, shell, "-c", shellCmd)
+	cmd := exec.CommandContext(ctx, shell, "-c", withEnvFile(shell, backendID, command))
 	cmd.Dir = backendID
 
 	output, err := cmd.CombinedOutput()
@@ -410,6 +593,44 @@ func (b *Backend) List(ctx context.Context) ([]string, error) {
 	return choirWorktrees, nil
 }
 
+// DiskUsage returns the total size of the files in the worktree. Git objects
+// live in the main repository and are shared, so they are not counted.
+// Symlinks are not followed.
+func (b *Backend) DiskUsage(ctx context.Context, backendID string) (uint64, error) {
+	if _, err := os.Stat(backendID); os.IsNotExist(err) {
+		return 0, fmt.Errorf("%w: %s", ErrWorktreeNotFound, backendID)
+	}
+
+	var total uint64
+	err := filepath.WalkDir(backendID, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil // Removed while walking
+			}
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		total += uint64(info.Size())
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to measure worktree: %w", err)
+	}
+	return total, nil
+}
+
 // isChoirManaged checks if a worktree directory is managed by choir.
 // A worktree is choir-managed if:
 // 1. Its directory name starts with "choir-"
@@ -1,16 +1,22 @@
 package worktree
 
 import (
+	"bytes"
 	"context"
 	"errors"
+	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"slices"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/Quidge/choir/internal/backend"
 	"github.com/Quidge/choir/internal/config"
+	"github.com/Quidge/choir/internal/gitutil"
+	"github.com/Quidge/choir/internal/msg"
 )
 
 // setupXDGDataHome sets XDG_DATA_HOME to a temp directory for testing.
@@ -124,10 +130,29 @@ func TestCreate(t *testing.T) {
 		t.Error("worktree directory was not created")
 	}
 
-	// Verify marker file exists
-	markerPath := filepath.Join(backendID, markerFile)
-	if _, err := os.Stat(markerPath); os.IsNotExist(err) {
-		t.Error("marker file was not created")
+	// Verify the marker identifies the environment from any subdirectory
+	subdir := filepath.Join(backendID, "a", "b")
+	if err := os.MkdirAll(subdir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	m, err := FindMarker(subdir)
+	if err != nil {
+		t.Fatalf("FindMarker() failed: %v", err)
+	}
+	if m.ID != cfg.ID || m.Branch != "env/abc123def456" || m.Dir != backendID {
+		t.Errorf("FindMarker() = %+v", m)
+	}
+	if _, err := FindMarker(repoDir); !errors.Is(err, ErrNotInEnvironment) {
+		t.Errorf("FindMarker(repo) error = %v, want ErrNotInEnvironment", err)
+	}
+
+	// Markers rewritten with Windows line endings still parse
+	crlf := "id: " + cfg.ID + "\r\nbranch: env/abc123def456\r\ncreated_by: choir\r\n"
+	if err := os.WriteFile(filepath.Join(backendID, markerFile), []byte(crlf), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if m, err := readMarker(backendID); err != nil || m.ID != cfg.ID || m.Branch != "env/abc123def456" {
+		t.Errorf("readMarker() with CRLF = %+v, %v", m, err)
 	}
 
 	// Verify worktree is in correct location (uses short ID - first 12 chars)
@@ -157,6 +182,24 @@ func TestCreateMissingID(t *testing.T) {
 	}
 }
 
+func TestCreateNetworkPolicyUnsupported(t *testing.T) {
+	setupXDGDataHome(t)
+	repoDir := setupTestRepo(t)
+
+	b, _ := New(backend.BackendConfig{})
+	cfg := &config.CreateConfig{
+		ID:         "netpol12def456abc123def456abc123",
+		Repository: config.RepositoryInfo{Path: repoDir, BaseBranch: "HEAD"},
+		Network:    config.NetworkPolicy{Deny: []string{"example.com"}},
+	}
+	if _, err := b.Create(context.Background(), cfg); err == nil || !strings.Contains(err.Error(), "network policies") {
+		t.Fatalf("Create() with a network policy = %v, want unsupported error", err)
+	}
+	if entries, _ := b.List(context.Background()); len(entries) != 0 {
+		t.Errorf("Create() left workspaces behind: %v", entries)
+	}
+}
+
 func TestCreateMissingRepoPath(t *testing.T) {
 	b, _ := New(backend.BackendConfig{})
 	ctx := context.Background()
@@ -376,7 +419,7 @@ func TestExecWithEnv(t *testing.T) {
 
 	// Set up environment using setup runner
 	runner := b.NewSetupRunner(backendID)
-	err = runner.Run(ctx, &backend.SetupConfig{
+	_, err = runner.Run(ctx, &backend.SetupConfig{
 		Environment: map[string]string{
 			"TEST_VAR": "test_value",
 		},
@@ -398,6 +441,95 @@ func TestExecWithEnv(t *testing.T) {
 	}
 }
 
+func TestShellExportsIdentity(t *testing.T) {
+	setupXDGDataHome(t)
+	repoDir := setupTestRepo(t)
+
+	// A "shell" that records its environment and exits
+	shell := filepath.Join(t.TempDir(), "recordenv")
+	envOut := filepath.Join(t.TempDir(), "env")
+	script := fmt.Sprintf("#!/bin/sh\nenv > %s\n", envOut)
+	if err := os.WriteFile(shell, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	b, _ := New(backend.BackendConfig{Shell: shell})
+	ctx := context.Background()
+
+	cfg := &config.CreateConfig{
+		ID: "shell2def456abc123def456abc12345",
+		Repository: config.RepositoryInfo{
+			Path:       repoDir,
+			BaseBranch: "HEAD",
+		},
+		BranchPrefix: "env/",
+	}
+
+	backendID, err := b.Create(ctx, cfg)
+	if err != nil {
+		t.Fatalf("Create() failed: %v", err)
+	}
+	defer b.Destroy(ctx, backendID)
+
+	if err := b.Shell(ctx, backendID); err != nil {
+		t.Fatalf("Shell() failed: %v", err)
+	}
+	data, err := os.ReadFile(envOut)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"CHOIR_ENV_ID=" + cfg.ID, "CHOIR_BRANCH=env/shell2def456"} {
+		if !slices.Contains(strings.Split(string(data), "\n"), want) {
+			t.Errorf("shell environment missing %s", want)
+		}
+	}
+}
+
+func TestLaunch(t *testing.T) {
+	setupXDGDataHome(t)
+	repoDir := setupTestRepo(t)
+
+	b, _ := New(backend.BackendConfig{})
+	ctx := context.Background()
+
+	cfg := &config.CreateConfig{
+		ID: "launch12def456abc123def456abc123",
+		Repository: config.RepositoryInfo{
+			Path:       repoDir,
+			BaseBranch: "HEAD",
+		},
+	}
+	backendID, err := b.Create(ctx, cfg)
+	if err != nil {
+		t.Fatalf("Create() failed: %v", err)
+	}
+	defer b.Destroy(ctx, backendID)
+
+	var stdout bytes.Buffer
+	proc, err := b.(backend.Launcher).Launch(ctx, backendID, backend.LaunchSpec{
+		Command: `echo "$GREETING"; pwd; exit 3`,
+		Env:     map[string]string{"GREETING": "hello"},
+		Stdout:  &stdout,
+	})
+	if err != nil {
+		t.Fatalf("Launch() failed: %v", err)
+	}
+	if proc.ID() == "" {
+		t.Error("Launch() returned a process without an ID")
+	}
+	exitCode, err := proc.Wait()
+	if err != nil {
+		t.Fatalf("Wait() failed: %v", err)
+	}
+	if exitCode != 3 {
+		t.Errorf("Wait() exit code = %d, want 3", exitCode)
+	}
+	lines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
+	if len(lines) != 2 || lines[0] != "hello" || lines[1] != backendID {
+		t.Errorf("output = %q, want greeting and workspace path", stdout.String())
+	}
+}
+
 func TestExecNotFound(t *testing.T) {
 	b, _ := New(backend.BackendConfig{})
 	ctx := context.Background()
@@ -747,3 +879,521 @@ func TestWorktreeConfigIsolation(t *testing.T) {
 		t.Errorf("main repo user.name changed from %q to %q - isolation failed!", originalName, mainName)
 	}
 }
+
+func TestSetupGitIdentity(t *testing.T) {
+	setupXDGDataHome(t)
+	repoDir := setupTestRepo(t)
+
+	b, _ := New(backend.BackendConfig{})
+	ctx := context.Background()
+
+	backendID, err := b.Create(ctx, &config.CreateConfig{
+		ID: "ident2def456abc123def456abc12345",
+		Repository: config.RepositoryInfo{
+			Path:       repoDir,
+			BaseBranch: "HEAD",
+		},
+	})
+	if err != nil {
+		t.Fatalf("Create() failed: %v", err)
+	}
+	defer b.Destroy(ctx, backendID)
+
+	gitConfig := func(dir, key string) string {
+		cmd := exec.Command("git", "config", "--get", key)
+		cmd.Dir = dir
+		cmd.Env = cleanGitEnv()
+		out, _ := cmd.Output()
+		return strings.TrimSpace(string(out))
+	}
+	originalEmail := gitConfig(repoDir, "user.email")
+
+	_, err = b.NewSetupRunner(backendID).Run(ctx, &backend.SetupConfig{
+		GitIdentity: config.GitIdentity{Name: "Agent", Email: "agent@example.com", SigningKey: "ABCD1234"},
+	})
+	if err != nil {
+		t.Fatalf("SetupRunner.Run() failed: %v", err)
+	}
+
+	want := map[string]string{
+		"user.name":       "Agent",
+		"user.email":      "agent@example.com",
+		"user.signingkey": "ABCD1234",
+		"commit.gpgsign":  "true",
+	}
+	for key, value := range want {
+		if got := gitConfig(backendID, key); got != value {
+			t.Errorf("worktree %s = %q, want %q", key, got, value)
+		}
+	}
+	if got := gitConfig(repoDir, "user.email"); got != originalEmail {
+		t.Errorf("main repo user.email changed from %q to %q", originalEmail, got)
+	}
+}
+
+func TestSetupCommitTrailer(t *testing.T) {
+	setupXDGDataHome(t)
+	repoDir := setupTestRepo(t)
+
+	// A hook the repository already uses must keep running
+	hookLog := filepath.Join(t.TempDir(), "pre-commit.log")
+	hook := "#!/bin/sh\necho ran >> " + posixQuote(hookLog) + "\n"
+	if err := os.WriteFile(filepath.Join(repoDir, ".git", "hooks", "pre-commit"), []byte(hook), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	b, _ := New(backend.BackendConfig{})
+	ctx := context.Background()
+
+	envID := "trail2def456abc123def456abc12345"
+	backendID, err := b.Create(ctx, &config.CreateConfig{
+		ID: envID,
+		Repository: config.RepositoryInfo{
+			Path:       repoDir,
+			BaseBranch: "HEAD",
+		},
+	})
+	if err != nil {
+		t.Fatalf("Create() failed: %v", err)
+	}
+	defer b.Destroy(ctx, backendID)
+
+	// Running setup twice must not stack hooks
+	for range 2 {
+		if _, err := b.NewSetupRunner(backendID).Run(ctx, &backend.SetupConfig{CommitTrailer: envID}); err != nil {
+			t.Fatalf("SetupRunner.Run() failed: %v", err)
+		}
+	}
+
+	cmd := exec.Command("git", "commit", "--allow-empty", "-m", "Agent change")
+	cmd.Dir = backendID
+	cmd.Env = cleanGitEnv()
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("commit failed: %v\n%s", err, out)
+	}
+
+	got, err := gitutil.Trailer(backendID, "HEAD", backend.CommitTrailerKey)
+	if err != nil || got != envID {
+		t.Errorf("Trailer() = %q, %v; want %q", got, err, envID)
+	}
+	if data, _ := os.ReadFile(hookLog); string(data) != "ran\n" {
+		t.Errorf("repository pre-commit hook log = %q, want one run", data)
+	}
+
+	// Commits in the main repository are not stamped
+	cmd = exec.Command("git", "commit", "--allow-empty", "-m", "Own change")
+	cmd.Dir = repoDir
+	cmd.Env = cleanGitEnv()
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("commit failed: %v\n%s", err, out)
+	}
+	if got, _ := gitutil.Trailer(repoDir, "HEAD", backend.CommitTrailerKey); got != "" {
+		t.Errorf("main repository commit has trailer %q", got)
+	}
+}
+
+func TestSetupIgnore(t *testing.T) {
+	setupXDGDataHome(t)
+	repoDir := setupTestRepo(t)
+
+	b, _ := New(backend.BackendConfig{})
+	ctx := context.Background()
+
+	backendID, err := b.Create(ctx, &config.CreateConfig{
+		ID: "ign12def456abc123def456abc123456",
+		Repository: config.RepositoryInfo{
+			Path:       repoDir,
+			BaseBranch: "HEAD",
+		},
+	})
+	if err != nil {
+		t.Fatalf("Create() failed: %v", err)
+	}
+	defer b.Destroy(ctx, backendID)
+
+	status := func() string {
+		t.Helper()
+		out, err := git(ctx, backendID, "status", "--porcelain")
+		if err != nil {
+			t.Fatalf("git status failed: %v", err)
+		}
+		return string(out)
+	}
+
+	// The marker file is excluded from the start
+	if got := status(); got != "" {
+		t.Errorf("fresh worktree status = %q, want clean", got)
+	}
+
+	for range 2 {
+		if _, err := b.NewSetupRunner(backendID).Run(ctx, &backend.SetupConfig{
+			Environment: map[string]string{"FOO": "bar"},
+			Ignore:      []string{"build/", "/scratch.txt"},
+		}); err != nil {
+			t.Fatalf("SetupRunner.Run() failed: %v", err)
+		}
+	}
+	os.MkdirAll(filepath.Join(backendID, "build"), 0755)
+	os.WriteFile(filepath.Join(backendID, "build", "out.o"), nil, 0644)
+	os.WriteFile(filepath.Join(backendID, "scratch.txt"), nil, 0644)
+	os.WriteFile(filepath.Join(backendID, "kept.txt"), nil, 0644)
+	if got := status(); got != "?? kept.txt\n" {
+		t.Errorf("status = %q, want only kept.txt untracked", got)
+	}
+
+	// Patterns are listed once, however often setup runs
+	data, err := os.ReadFile(filepath.Join(repoDir, ".git", "info", "exclude"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(string(data), "build/\n"); n != 1 {
+		t.Errorf("exclude file lists build/ %d times, want 1:\n%s", n, data)
+	}
+
+	if _, err := b.NewSetupRunner(backendID).Run(ctx, &backend.SetupConfig{Ignore: []string{"a\nb"}}); err == nil {
+		t.Error("SetupRunner.Run() with a multi-line pattern succeeded, want error")
+	}
+}
+
+func TestSetupTaskFile(t *testing.T) {
+	setupXDGDataHome(t)
+	repoDir := setupTestRepo(t)
+
+	b, _ := New(backend.BackendConfig{})
+	ctx := context.Background()
+
+	backendID, err := b.Create(ctx, &config.CreateConfig{
+		ID: "task2def456abc123def456abc123456",
+		Repository: config.RepositoryInfo{
+			Path:       repoDir,
+			BaseBranch: "HEAD",
+		},
+	})
+	if err != nil {
+		t.Fatalf("Create() failed: %v", err)
+	}
+	defer b.Destroy(ctx, backendID)
+
+	if _, err := b.NewSetupRunner(backendID).Run(ctx, &backend.SetupConfig{
+		TaskFile: "Fix the flaky login test",
+	}); err != nil {
+		t.Fatalf("SetupRunner.Run() failed: %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(backendID, backend.TaskFileName))
+	if err != nil || string(data) != "Fix the flaky login test\n" {
+		t.Errorf("task file = %q, %v; want the task", data, err)
+	}
+	out, err := git(ctx, backendID, "status", "--porcelain")
+	if err != nil {
+		t.Fatalf("git status failed: %v", err)
+	}
+	if len(out) != 0 {
+		t.Errorf("status = %q, want the task file excluded", out)
+	}
+}
+
+func TestPreflight(t *testing.T) {
+	setupXDGDataHome(t)
+	repoDir := setupTestRepo(t)
+
+	b := &Backend{}
+	ctx := context.Background()
+
+	t.Run("passes for valid repo", func(t *testing.T) {
+		err := b.Preflight(ctx, &config.CreateConfig{
+			ID:         "preflight123456789012345678901234",
+			Repository: config.RepositoryInfo{Path: repoDir},
+		})
+		if err != nil {
+			t.Errorf("Preflight() failed: %v", err)
+		}
+	})
+
+	t.Run("fails for unknown base branch", func(t *testing.T) {
+		err := b.Preflight(ctx, &config.CreateConfig{
+			ID:         "preflight123456789012345678901234",
+			Repository: config.RepositoryInfo{Path: repoDir, BaseBranch: "no-such-branch"},
+		})
+		if err == nil {
+			t.Error("Preflight() with unknown base branch should fail")
+		}
+	})
+}
+
+func TestCreateSubmodules(t *testing.T) {
+	setupXDGDataHome(t)
+
+	// Newer git refuses file:// submodule clones unless allowed
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	gitconfig := "[protocol \"file\"]\n\tallow = always\n"
+	if err := os.WriteFile(filepath.Join(home, ".gitconfig"), []byte(gitconfig), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	libDir := setupTestRepo(t)
+	repoDir := setupTestRepo(t)
+
+	run := func(args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", args...)
+		cmd.Dir = repoDir
+		cmd.Env = cleanGitEnv()
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v failed: %v\n%s", args, err, out)
+		}
+	}
+	run("submodule", "add", libDir, "lib")
+	run("commit", "-m", "Add submodule")
+
+	b, _ := New(backend.BackendConfig{})
+	ctx := context.Background()
+	cfg := &config.CreateConfig{
+		ID: "5b5b5b5b5b5b5b5b5b5b5b5b5b5b5b5b",
+		Repository: config.RepositoryInfo{
+			Path:       repoDir,
+			BaseBranch: "HEAD",
+		},
+		Submodules: true,
+	}
+
+	backendID, err := b.Create(ctx, cfg)
+	if err != nil {
+		t.Fatalf("Create() failed: %v", err)
+	}
+	defer b.Destroy(ctx, backendID)
+
+	if _, err := os.Stat(filepath.Join(backendID, "lib", "README.md")); err != nil {
+		t.Errorf("submodule not checked out: %v", err)
+	}
+
+	t.Run("failure cleans up worktree", func(t *testing.T) {
+		if err := os.RemoveAll(libDir); err != nil {
+			t.Fatal(err)
+		}
+		// Drop the superproject's cached submodule clone so it must refetch
+		if err := os.RemoveAll(filepath.Join(repoDir, ".git", "modules")); err != nil {
+			t.Fatal(err)
+		}
+
+		cfg.ID = "6c6c6c6c6c6c6c6c6c6c6c6c6c6c6c6c"
+		_, err := b.Create(ctx, cfg)
+		if !errors.Is(err, ErrSubmoduleInit) {
+			t.Fatalf("Create() error = %v, want ErrSubmoduleInit", err)
+		}
+		path := filepath.Join(os.Getenv("XDG_DATA_HOME"), "choir", "worktrees", "choir-6c6c6c6c6c6c")
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("worktree %s not cleaned up after failure", path)
+		}
+	})
+
+	t.Run("quiet failure reports git output", func(t *testing.T) {
+		msg.SetQuiet(true)
+		t.Cleanup(func() { msg.SetQuiet(false) })
+
+		cfg.ID = "7d7d7d7d7d7d7d7d7d7d7d7d7d7d7d7d"
+		_, err := b.Create(ctx, cfg)
+		if !errors.Is(err, ErrSubmoduleInit) {
+			t.Fatalf("Create() error = %v, want ErrSubmoduleInit", err)
+		}
+		if !strings.Contains(err.Error(), "output:") {
+			t.Errorf("Create() error = %v, want git's output", err)
+		}
+	})
+}
+
+func TestCreateSparse(t *testing.T) {
+	setupXDGDataHome(t)
+	repoDir := setupTestRepo(t)
+
+	for _, f := range []string{"services/api/main.go", "services/web/index.js", "docs/guide.md"} {
+		path := filepath.Join(repoDir, f)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(f+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, args := range [][]string{{"add", "."}, {"commit", "-m", "Add services"}} {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = repoDir
+		cmd.Env = cleanGitEnv()
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v failed: %v\n%s", args, err, out)
+		}
+	}
+
+	b, _ := New(backend.BackendConfig{})
+	ctx := context.Background()
+	cfg := &config.CreateConfig{
+		ID: "7d7d7d7d7d7d7d7d7d7d7d7d7d7d7d7d",
+		Repository: config.RepositoryInfo{
+			Path:       repoDir,
+			BaseBranch: "HEAD",
+		},
+		Sparse: []string{"services/api"},
+	}
+
+	backendID, err := b.Create(ctx, cfg)
+	if err != nil {
+		t.Fatalf("Create() failed: %v", err)
+	}
+	defer b.Destroy(ctx, backendID)
+
+	for _, f := range []string{"README.md", "services/api/main.go"} {
+		if _, err := os.Stat(filepath.Join(backendID, f)); err != nil {
+			t.Errorf("%s not checked out: %v", f, err)
+		}
+	}
+	for _, f := range []string{"services/web", "docs"} {
+		if _, err := os.Stat(filepath.Join(backendID, f)); !os.IsNotExist(err) {
+			t.Errorf("%s checked out, want it left out", f)
+		}
+	}
+
+	status := exec.Command("git", "status", "--porcelain")
+	status.Dir = backendID
+	status.Env = cleanGitEnv()
+	out, err := status.Output()
+	if err != nil {
+		t.Fatalf("git status failed: %v", err)
+	}
+	if len(out) != 0 {
+		t.Errorf("sparse worktree has changes:\n%s", out)
+	}
+
+	// The main checkout stays complete
+	if _, err := os.Stat(filepath.Join(repoDir, "docs", "guide.md")); err != nil {
+		t.Errorf("main checkout affected: %v", err)
+	}
+	sparse := exec.Command("git", "config", "core.sparseCheckout")
+	sparse.Dir = repoDir
+	sparse.Env = cleanGitEnv()
+	if out, _ := sparse.Output(); strings.TrimSpace(string(out)) == "true" {
+		t.Error("core.sparseCheckout set in the main repository")
+	}
+}
+
+func TestCreateExistingBranch(t *testing.T) {
+	setupXDGDataHome(t)
+	repoDir := setupTestRepo(t)
+
+	for _, args := range [][]string{
+		{"checkout", "-q", "-b", "feature/x"},
+		{"commit", "--allow-empty", "-q", "-m", "Work in progress"},
+		{"checkout", "-q", "-"},
+	} {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = repoDir
+		cmd.Env = cleanGitEnv()
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v failed: %v\n%s", args, err, out)
+		}
+	}
+
+	b, _ := New(backend.BackendConfig{})
+	ctx := context.Background()
+	cfg := &config.CreateConfig{
+		ID: "8e8e8e8e8e8e8e8e8e8e8e8e8e8e8e8e",
+		Repository: config.RepositoryInfo{
+			Path:       repoDir,
+			BaseBranch: "HEAD",
+		},
+		BranchName:     "feature/x",
+		ExistingBranch: true,
+	}
+	if err := b.(backend.Preflighter).Preflight(ctx, cfg); err != nil {
+		t.Fatalf("Preflight() failed: %v", err)
+	}
+	backendID, err := b.Create(ctx, cfg)
+	if err != nil {
+		t.Fatalf("Create() failed: %v", err)
+	}
+	defer b.Destroy(ctx, backendID)
+
+	for _, tt := range []struct{ args, want string }{
+		{"symbolic-ref --short HEAD", "feature/x"},
+		{"log -1 --format=%s", "Work in progress"},
+	} {
+		cmd := exec.Command("git", strings.Fields(tt.args)...)
+		cmd.Dir = backendID
+		cmd.Env = cleanGitEnv()
+		out, err := cmd.Output()
+		if err != nil {
+			t.Fatalf("git %s failed: %v", tt.args, err)
+		}
+		if got := strings.TrimSpace(string(out)); got != tt.want {
+			t.Errorf("git %s = %q, want %q", tt.args, got, tt.want)
+		}
+	}
+
+	// A branch can only be checked out in one worktree
+	cfg.ID = "9f9f9f9f9f9f9f9f9f9f9f9f9f9f9f9f"
+	if id, err := b.Create(ctx, cfg); err == nil {
+		b.Destroy(ctx, id)
+		t.Error("Create() succeeded for a branch checked out in another worktree")
+	}
+}
+
+func TestCreateWaitsForIndexLock(t *testing.T) {
+	setupXDGDataHome(t)
+	repoDir := setupTestRepo(t)
+
+	orig := lockWaitTimeout
+	lockWaitTimeout = 300 * time.Millisecond
+	defer func() { lockWaitTimeout = orig }()
+
+	b, _ := New(backend.BackendConfig{})
+	ctx := context.Background()
+	cfg := &config.CreateConfig{
+		ID: "lock12def456abc123def456abc12345",
+		Repository: config.RepositoryInfo{
+			Path:       repoDir,
+			BaseBranch: "HEAD",
+		},
+	}
+
+	// Simulate a human's git command holding the index lock
+	lock := filepath.Join(repoDir, ".git", "index.lock")
+	if err := os.WriteFile(lock, nil, 0644); err != nil {
+		t.Fatalf("failed to create index.lock: %v", err)
+	}
+
+	_, err := b.Create(ctx, cfg)
+	if !errors.Is(err, gitutil.ErrRepoLocked) {
+		t.Fatalf("Create() with held lock error = %v, want ErrRepoLocked", err)
+	}
+	if _, err := os.Stat(lock); err != nil {
+		t.Error("Create() removed the user's index.lock")
+	}
+
+	// Released within the timeout, the create proceeds
+	lockWaitTimeout = 5 * time.Second
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		os.Remove(lock)
+	}()
+	backendID, err := b.Create(ctx, cfg)
+	if err != nil {
+		t.Fatalf("Create() after lock release failed: %v", err)
+	}
+
+	// Destroy refuses to race with a held lock and leaves the worktree intact
+	lockWaitTimeout = 300 * time.Millisecond
+	if err := os.WriteFile(lock, nil, 0644); err != nil {
+		t.Fatalf("failed to create index.lock: %v", err)
+	}
+	if err := b.Destroy(ctx, backendID); !errors.Is(err, gitutil.ErrRepoLocked) {
+		t.Errorf("Destroy() with held lock error = %v, want ErrRepoLocked", err)
+	}
+	if _, err := os.Stat(backendID); err != nil {
+		t.Error("Destroy() removed the worktree despite the lock")
+	}
+
+	os.Remove(lock)
+	if err := b.Destroy(ctx, backendID); err != nil {
+		t.Errorf("Destroy() after release failed: %v", err)
+	}
+}
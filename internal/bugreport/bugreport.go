@@ -0,0 +1,128 @@
+// Package bugreport builds the support archive written by "choir
+// bugreport": a gzipped tarball of version info, redacted configuration, a
+// summary of the state database, recent setup logs, and doctor output.
+package bugreport
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Redacted replaces the values Redact removes.
+const Redacted = "[REDACTED]"
+
+// secretKeys are config keys whose values are always redacted. Values
+// under env are redacted too, since environment variables often carry
+// tokens.
+var secretKeys = map[string]bool{
+	"url":         true,
+	"email":       true,
+	"signing_key": true,
+}
+
+// secretKeyPattern matches other keys that look like they hold a secret.
+var secretKeyPattern = regexp.MustCompile(`(?i)(token|secret|password|passwd|api_?key|credential)`)
+
+// Redact returns the config YAML in data with secret values replaced by
+// Redacted and the user's home directory shown as "~". Comments are
+// dropped, since they can hold anything. Data that doesn't parse as YAML
+// is withheld entirely, as there's no telling what in it is secret.
+func Redact(data []byte) []byte {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return []byte("# withheld: not valid YAML (" + err.Error() + ")\n")
+	}
+	redactNode(&doc, false)
+	out, err := yaml.Marshal(&doc)
+	if err != nil {
+		return []byte("# withheld: " + err.Error() + "\n")
+	}
+	return []byte(shortenHome(string(out)))
+}
+
+// redactNode redacts n in place. If secret is true, every scalar under n
+// is redacted.
+func redactNode(n *yaml.Node, secret bool) {
+	n.HeadComment, n.LineComment, n.FootComment = "", "", ""
+	switch n.Kind {
+	case yaml.ScalarNode:
+		if secret && n.Value != "" {
+			n.Value = Redacted
+			n.Style = 0
+			n.Tag = "!!str"
+		}
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			key := n.Content[i].Value
+			n.Content[i].HeadComment, n.Content[i].LineComment, n.Content[i].FootComment = "", "", ""
+			redactNode(n.Content[i+1], secret || key == "env" || secretKeys[key] || secretKeyPattern.MatchString(key))
+		}
+	default:
+		for _, c := range n.Content {
+			redactNode(c, secret)
+		}
+	}
+}
+
+// shortenHome replaces the user's home directory in s with "~", so paths
+// in a report don't give away the user name.
+func shortenHome(s string) string {
+	home, err := os.UserHomeDir()
+	if err != nil || home == "" || home == "/" {
+		return s
+	}
+	return strings.ReplaceAll(s, home, "~")
+}
+
+// Archive writes files into a gzipped tarball under a single top-level
+// directory, so that extracting it doesn't scatter files into the
+// current directory.
+type Archive struct {
+	dir string
+	now time.Time
+	gz  *gzip.Writer
+	tw  *tar.Writer
+}
+
+// NewArchive returns an Archive writing to w with its files under dir.
+func NewArchive(w io.Writer, dir string) *Archive {
+	gz := gzip.NewWriter(w)
+	return &Archive{dir: dir, now: time.Now().Truncate(time.Second), gz: gz, tw: tar.NewWriter(gz)}
+}
+
+// Add writes a file named name (a slash-separated path within the
+// archive's directory) with the given contents. Home directory paths in
+// data are shown as "~".
+func (a *Archive) Add(name string, data []byte) error {
+	data = []byte(shortenHome(string(data)))
+	hdr := &tar.Header{
+		Name:    filepath.ToSlash(filepath.Join(a.dir, name)),
+		Mode:    0600,
+		Size:    int64(len(data)),
+		ModTime: a.now,
+	}
+	if err := a.tw.WriteHeader(hdr); err != nil {
+		return fmt.Errorf("failed to add %s: %w", name, err)
+	}
+	if _, err := a.tw.Write(data); err != nil {
+		return fmt.Errorf("failed to add %s: %w", name, err)
+	}
+	return nil
+}
+
+// Close finishes the archive. It doesn't close the underlying writer.
+func (a *Archive) Close() error {
+	if err := a.tw.Close(); err != nil {
+		return err
+	}
+	return a.gz.Close()
+}
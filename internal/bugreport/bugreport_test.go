@@ -0,0 +1,97 @@
+package bugreport
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestRedact(t *testing.T) {
+	t.Setenv("HOME", "/home/pat")
+	in := `# my settings
+default_backend: local
+hooks:
+  - command: notify-send choir # desktop popup
+    url: https://hooks.example.com/T000?token=abc
+git_identity:
+  name: Pat
+  email: pat@example.com
+  signing_key: ABCDEF12
+credentials:
+  github_token: ghp_secret
+env:
+  API_KEY: sk-live
+  CONFIG:
+    from_file: /home/pat/.config/app.env
+files:
+  - source: /home/pat/.npmrc
+`
+	out := string(Redact([]byte(in)))
+
+	for _, secret := range []string{"abc", "pat@example.com", "ABCDEF12", "ghp_secret", "sk-live", "app.env", "my settings", "desktop popup"} {
+		if strings.Contains(out, secret) {
+			t.Errorf("Redact() output contains %q:\n%s", secret, out)
+		}
+	}
+	for _, kept := range []string{"default_backend: local", "command: notify-send choir", "name: Pat", "API_KEY:", "source: ~/.npmrc"} {
+		if !strings.Contains(out, kept) {
+			t.Errorf("Redact() output is missing %q:\n%s", kept, out)
+		}
+	}
+
+	if out := string(Redact([]byte("key: [unclosed"))); !strings.HasPrefix(out, "# withheld") {
+		t.Errorf("Redact(invalid YAML) = %q, want it withheld", out)
+	}
+}
+
+func TestArchive(t *testing.T) {
+	t.Setenv("HOME", "/home/pat")
+	var buf bytes.Buffer
+	a := NewArchive(&buf, "report")
+	if err := a.Add("version.txt", []byte("choir: dev\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Add("logs/abc.setup.log", []byte("cd /home/pat/src\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	gz, err := gzip.NewReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := tar.NewReader(gz)
+	got := make(map[string]string)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got[hdr.Name] = string(data)
+	}
+
+	want := map[string]string{
+		"report/version.txt":        "choir: dev\n",
+		"report/logs/abc.setup.log": "cd ~/src\n",
+	}
+	if len(got) != len(want) {
+		t.Errorf("archive has %v, want %v", got, want)
+	}
+	for name, data := range want {
+		if got[name] != data {
+			t.Errorf("%s = %q, want %q", name, got[name], data)
+		}
+	}
+}
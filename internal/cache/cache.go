@@ -0,0 +1,107 @@
+// Package cache shares package manager caches between environments.
+//
+// Each cache is a directory under Dir() (e.g., ~/.cache/choir/npm). An
+// environment uses it by having the package manager's cache variable (such
+// as npm_config_cache) point there, so repeated installs across
+// environments reuse downloads instead of starting cold.
+package cache
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+
+	"github.com/Quidge/choir/internal/config"
+)
+
+// presets maps preset names to the environment variables they set, each
+// with the subdirectory of the cache it points to ("" for the cache root).
+var presets = map[string]map[string]string{
+	"npm":  {"npm_config_cache": ""},
+	"yarn": {"YARN_CACHE_FOLDER": ""},
+	"pnpm": {"npm_config_store_dir": ""},
+	"pip":  {"PIP_CACHE_DIR": ""},
+	"uv":   {"UV_CACHE_DIR": ""},
+	"go":   {"GOMODCACHE": "mod", "GOCACHE": "build"},
+}
+
+var (
+	validName   = regexp.MustCompile(`^[a-z0-9][a-z0-9_.-]*$`)
+	validEnvVar = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+)
+
+// Presets returns the names of the built-in cache presets, sorted.
+func Presets() []string {
+	names := make([]string, 0, len(presets))
+	for name := range presets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Dir returns the base directory for shared caches.
+// This follows the XDG Base Directory specification:
+// - Uses $XDG_CACHE_HOME/choir/ if XDG_CACHE_HOME is set
+// - Falls back to ~/.cache/choir/
+func Dir() (string, error) {
+	cacheDir := os.Getenv("XDG_CACHE_HOME")
+	if cacheDir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("failed to get home directory: %w", err)
+		}
+		cacheDir = filepath.Join(home, ".cache")
+	}
+	return filepath.Join(cacheDir, "choir"), nil
+}
+
+// Validate checks that every entry is a known preset or a custom cache with
+// a valid environment variable.
+func Validate(entries []config.CacheEntry) error {
+	seen := make(map[string]bool, len(entries))
+	for i, e := range entries {
+		if !validName.MatchString(e.Name) {
+			return fmt.Errorf("cache %d: invalid name %q (use lowercase letters, digits, '.', '_', or '-')", i, e.Name)
+		}
+		if seen[e.Name] {
+			return fmt.Errorf("cache %d: duplicate cache %q", i, e.Name)
+		}
+		seen[e.Name] = true
+
+		if e.Env == "" {
+			if _, ok := presets[e.Name]; !ok {
+				return fmt.Errorf("cache %d: unknown preset %q (known presets: %v); set env for a custom cache", i, e.Name, Presets())
+			}
+		} else if !validEnvVar.MatchString(e.Env) {
+			return fmt.Errorf("cache %d: invalid environment variable name %q", i, e.Env)
+		}
+	}
+	return nil
+}
+
+// Env creates the cache directories for entries under base and returns the
+// environment variables that point package managers at them.
+func Env(base string, entries []config.CacheEntry) (map[string]string, error) {
+	if err := Validate(entries); err != nil {
+		return nil, err
+	}
+
+	env := make(map[string]string)
+	for _, e := range entries {
+		vars := presets[e.Name]
+		if e.Env != "" {
+			vars = map[string]string{e.Env: ""}
+		}
+		for name, sub := range vars {
+			dir := filepath.Join(base, e.Name, sub)
+			if err := os.MkdirAll(dir, 0755); err != nil {
+				return nil, fmt.Errorf("failed to create cache directory: %w", err)
+			}
+			env[name] = dir
+		}
+	}
+	return env, nil
+}
@@ -0,0 +1,88 @@
+package cache
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Quidge/choir/internal/config"
+	"gopkg.in/yaml.v3"
+)
+
+func TestEnv(t *testing.T) {
+	base := t.TempDir()
+
+	env, err := Env(base, []config.CacheEntry{
+		{Name: "npm"},
+		{Name: "go"},
+		{Name: "gradle", Env: "GRADLE_USER_HOME"},
+	})
+	if err != nil {
+		t.Fatalf("Env() failed: %v", err)
+	}
+
+	want := map[string]string{
+		"npm_config_cache": filepath.Join(base, "npm"),
+		"GOMODCACHE":       filepath.Join(base, "go", "mod"),
+		"GOCACHE":          filepath.Join(base, "go", "build"),
+		"GRADLE_USER_HOME": filepath.Join(base, "gradle"),
+	}
+	if len(env) != len(want) {
+		t.Errorf("Env() returned %d variables, want %d: %v", len(env), len(want), env)
+	}
+	for k, v := range want {
+		if env[k] != v {
+			t.Errorf("env[%s] = %q, want %q", k, env[k], v)
+		}
+		if info, err := os.Stat(v); err != nil || !info.IsDir() {
+			t.Errorf("cache directory %s not created", v)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []config.CacheEntry
+		wantErr string
+	}{
+		{"presets", []config.CacheEntry{{Name: "pip"}, {Name: "uv"}}, ""},
+		{"custom", []config.CacheEntry{{Name: "maven", Env: "MAVEN_REPO"}}, ""},
+		{"unknown preset", []config.CacheEntry{{Name: "maven"}}, "unknown preset"},
+		{"duplicate", []config.CacheEntry{{Name: "npm"}, {Name: "npm"}}, "duplicate"},
+		{"path traversal", []config.CacheEntry{{Name: "../x", Env: "X"}}, "invalid name"},
+		{"bad env var", []config.CacheEntry{{Name: "x", Env: "1BAD"}}, "invalid environment variable"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Validate(tt.entries)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Validate() = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Validate() = %v, want error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCacheEntryYAML(t *testing.T) {
+	var cfg config.ProjectConfig
+	input := `
+cache:
+  - npm
+  - name: gradle
+    env: GRADLE_USER_HOME
+`
+	if err := yaml.Unmarshal([]byte(input), &cfg); err != nil {
+		t.Fatalf("Unmarshal() failed: %v", err)
+	}
+	want := []config.CacheEntry{{Name: "npm"}, {Name: "gradle", Env: "GRADLE_USER_HOME"}}
+	if len(cfg.Cache) != len(want) || cfg.Cache[0] != want[0] || cfg.Cache[1] != want[1] {
+		t.Errorf("Cache = %+v, want %+v", cfg.Cache, want)
+	}
+}
@@ -0,0 +1,162 @@
+// Package clierr classifies the errors choir commands fail with, so wrappers
+// can branch on what went wrong: each kind of failure exits with its own
+// status, and with --output json (or CHOIR_OUTPUT=json) the error is also
+// reported on stderr as a JSON object.
+//
+// Commands mark errors with NotFound, Ambiguous, Validation, Backend, or
+// Timeout where they know the kind. Errors from the state and resolve
+// packages are classified without marking, by the sentinel errors they
+// wrap. Anything else is a general failure.
+package clierr
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/Quidge/choir/internal/backend"
+	"github.com/Quidge/choir/internal/config"
+	"github.com/Quidge/choir/internal/prompt"
+	"github.com/Quidge/choir/internal/resolve"
+	"github.com/Quidge/choir/internal/state"
+)
+
+// EnvOutput is the environment variable that selects the error output
+// format, like the global --output flag.
+const EnvOutput = "CHOIR_OUTPUT"
+
+// Kind is a class of failure, as reported in JSON error output.
+type Kind string
+
+// Kinds of failure.
+const (
+	KindFailure    Kind = "failure"         // Anything not classified below
+	KindValidation Kind = "validation"      // Invalid flags, arguments, or configuration
+	KindNotFound   Kind = "not_found"       // An environment or other named thing doesn't exist
+	KindAmbiguous  Kind = "ambiguous"       // An argument matches more than one environment
+	KindBackend    Kind = "backend_failure" // A backend failed to create, run, or change a workspace
+	KindTimeout    Kind = "timeout"         // Something waited for didn't happen in time
+)
+
+// Exit statuses, by kind. They are stable; new kinds get new statuses.
+const (
+	ExitFailure    = 1
+	ExitValidation = 2
+	ExitNotFound   = 3
+	ExitAmbiguous  = 4
+	ExitBackend    = 5
+	ExitTimeout    = 6
+)
+
+var exitCodes = map[Kind]int{
+	KindFailure:    ExitFailure,
+	KindValidation: ExitValidation,
+	KindNotFound:   ExitNotFound,
+	KindAmbiguous:  ExitAmbiguous,
+	KindBackend:    ExitBackend,
+	KindTimeout:    ExitTimeout,
+}
+
+// sentinels classifies errors from packages that don't mark their own.
+// The first match wins.
+var sentinels = []struct {
+	err  error
+	kind Kind
+}{
+	{state.ErrAmbiguousPrefix, KindAmbiguous},
+	{state.ErrEnvironmentNotFound, KindNotFound},
+	{config.ErrTemplateNotFound, KindNotFound},
+	{state.ErrImageNotFound, KindNotFound},
+	{state.ErrInvalidPrefix, KindValidation},
+	{resolve.ErrInvalid, KindValidation},
+	{config.ErrMountDenied, KindValidation},
+	{prompt.ErrNonInteractive, KindValidation},
+	{backend.ErrUnpushedWork, KindValidation},
+}
+
+// Error is an error marked with its kind.
+type Error struct {
+	Kind Kind
+	Err  error
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// mark returns err marked as kind, or nil if err is nil.
+func mark(kind Kind, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &Error{Kind: kind, Err: err}
+}
+
+// NotFound marks err as a failure to find what the user named.
+func NotFound(err error) error { return mark(KindNotFound, err) }
+
+// Ambiguous marks err as an argument matching more than one thing.
+func Ambiguous(err error) error { return mark(KindAmbiguous, err) }
+
+// Validation marks err as invalid input: flags, arguments, or configuration.
+func Validation(err error) error { return mark(KindValidation, err) }
+
+// Backend marks err as a backend failing to create, run, or change a
+// workspace.
+func Backend(err error) error { return mark(KindBackend, err) }
+
+// Timeout marks err as giving up waiting for something that didn't happen
+// in time.
+func Timeout(err error) error { return mark(KindTimeout, err) }
+
+// KindOf returns the kind of err: the kind it was marked with, if any
+// (the outermost mark wins), or else the kind of the sentinel it wraps.
+func KindOf(err error) Kind {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Kind
+	}
+	for _, s := range sentinels {
+		if errors.Is(err, s.err) {
+			return s.kind
+		}
+	}
+	return KindFailure
+}
+
+// ExitCode returns the process exit status for err, or 0 if err is nil.
+func ExitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	return exitCodes[KindOf(err)]
+}
+
+// jsonError is the JSON form of an error written by Report.
+type jsonError struct {
+	Error struct {
+		Kind     Kind   `json:"kind"`
+		Message  string `json:"message"`
+		ExitCode int    `json:"exit_code"`
+	} `json:"error"`
+}
+
+// Report writes err to w: as a JSON object on one line if asJSON is set,
+// else as its message.
+func Report(w io.Writer, err error, asJSON bool) {
+	if !asJSON {
+		fmt.Fprintln(w, err)
+		return
+	}
+	var out jsonError
+	out.Error.Kind = KindOf(err)
+	out.Error.Message = err.Error()
+	out.Error.ExitCode = ExitCode(err)
+	data, _ := json.Marshal(out) // Strings and ints always marshal
+	fmt.Fprintln(w, string(data))
+}
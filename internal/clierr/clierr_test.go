@@ -0,0 +1,68 @@
+package clierr
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/Quidge/choir/internal/resolve"
+	"github.com/Quidge/choir/internal/state"
+)
+
+func TestKindOf(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want Kind
+		code int
+	}{
+		{"plain", errors.New("boom"), KindFailure, ExitFailure},
+		{"marked", Validation(errors.New("bad flag")), KindValidation, ExitValidation},
+		{"timeout", Timeout(errors.New("gave up")), KindTimeout, ExitTimeout},
+		{"wrapped mark", fmt.Errorf("context: %w", Backend(errors.New("boom"))), KindBackend, ExitBackend},
+		{"outer mark wins", Backend(NotFound(errors.New("gone"))), KindBackend, ExitBackend},
+		{"resolve not found", &resolve.NotFoundError{Arg: "a1b2"}, KindNotFound, ExitNotFound},
+		{"resolve ambiguous", &resolve.AmbiguousError{Arg: "a1"}, KindAmbiguous, ExitAmbiguous},
+		{"state sentinel", fmt.Errorf("failed to get environment: %w", state.ErrEnvironmentNotFound), KindNotFound, ExitNotFound},
+		{"invalid argument", fmt.Errorf("invalid environment: %w", resolve.ErrInvalid), KindValidation, ExitValidation},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := KindOf(tt.err); got != tt.want {
+				t.Errorf("KindOf() = %s, want %s", got, tt.want)
+			}
+			if got := ExitCode(tt.err); got != tt.code {
+				t.Errorf("ExitCode() = %d, want %d", got, tt.code)
+			}
+		})
+	}
+
+	if ExitCode(nil) != 0 {
+		t.Error("ExitCode(nil) != 0")
+	}
+	if NotFound(nil) != nil {
+		t.Error("NotFound(nil) != nil")
+	}
+}
+
+func TestReport(t *testing.T) {
+	err := NotFound(errors.New(`environment "zz" not found`))
+
+	var text bytes.Buffer
+	Report(&text, err, false)
+	if got := text.String(); got != "environment \"zz\" not found\n" {
+		t.Errorf("text report = %q", got)
+	}
+
+	var out bytes.Buffer
+	Report(&out, err, true)
+	var got jsonError
+	if err := json.Unmarshal(out.Bytes(), &got); err != nil {
+		t.Fatalf("JSON report %q: %v", out.String(), err)
+	}
+	if got.Error.Kind != KindNotFound || got.Error.Message != `environment "zz" not found` || got.Error.ExitCode != ExitNotFound {
+		t.Errorf("JSON report = %+v", got.Error)
+	}
+}
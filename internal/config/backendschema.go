@@ -0,0 +1,99 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+// BackendSchema describes the settings a backend type accepts in its
+// backends.<name> block of the global config. Backends register one
+// alongside backend.Register so that misplaced settings (e.g., vm_type on a
+// worktree backend) are reported when the config is loaded rather than at
+// provision time.
+type BackendSchema struct {
+	// Settings maps each accepted key, other than type, to a validator for
+	// its value. A nil validator accepts any value.
+	Settings map[string]func(value string) error
+}
+
+var (
+	// backendSchemas holds the registered schemas by backend type.
+	backendSchemas = make(map[string]BackendSchema)
+
+	// backendSchemasMu protects concurrent access to backendSchemas.
+	backendSchemasMu sync.RWMutex
+)
+
+// RegisterBackendSchema registers the settings schema for a backend type.
+// This should be called during package init.
+// Panics if the same backend type is registered twice.
+func RegisterBackendSchema(backendType string, schema BackendSchema) {
+	backendSchemasMu.Lock()
+	defer backendSchemasMu.Unlock()
+
+	if _, exists := backendSchemas[backendType]; exists {
+		panic(fmt.Sprintf("backend schema %q already registered", backendType))
+	}
+	backendSchemas[backendType] = schema
+}
+
+// resetBackendSchemas clears all registered schemas. Only for testing.
+func resetBackendSchemas() {
+	backendSchemasMu.Lock()
+	defer backendSchemasMu.Unlock()
+	backendSchemas = make(map[string]BackendSchema)
+}
+
+// validateBackendSettings checks each backends.<name> block in the global
+// config YAML against the schema registered for its type. Backends whose
+// type has no registered schema are not checked; an unknown type is
+// reported when the backend is used. YAML that doesn't parse is left for the
+// full config decode to report.
+func validateBackendSettings(data []byte) error {
+	var raw struct {
+		Backends map[string]map[string]yaml.Node `yaml:"backends"`
+	}
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil
+	}
+
+	backendSchemasMu.RLock()
+	defer backendSchemasMu.RUnlock()
+
+	var errs []error
+	for _, name := range slices.Sorted(maps.Keys(raw.Backends)) {
+		settings := raw.Backends[name]
+		backendType := settings["type"].Value
+		schema, ok := backendSchemas[backendType]
+		if !ok {
+			continue
+		}
+		for _, key := range slices.Sorted(maps.Keys(settings)) {
+			if key == "type" {
+				continue
+			}
+			validate, ok := schema.Settings[key]
+			if !ok {
+				errs = append(errs, fmt.Errorf("backend %q: %s is not a %s backend setting", name, key, backendType))
+				continue
+			}
+			if validate == nil {
+				continue
+			}
+			node := settings[key]
+			if node.Kind != yaml.ScalarNode {
+				errs = append(errs, fmt.Errorf("backend %q: %s must be a single value", name, key))
+				continue
+			}
+			if err := validate(node.Value); err != nil {
+				errs = append(errs, fmt.Errorf("backend %q: invalid %s: %w", name, key, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -1,9 +1,13 @@
 package config
 
 import (
+	"errors"
 	"os"
 	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestExpandPath(t *testing.T) {
@@ -128,6 +132,9 @@ resources:
   memory: 8GB
   cpus: 8
 branch_prefix: feature/
+ports:
+  - 3000
+  - "8080:80"
 `
 		if err := os.WriteFile(configPath, []byte(content), 0644); err != nil {
 			t.Fatal(err)
@@ -162,6 +169,10 @@ branch_prefix: feature/
 		if cfg.BranchPrefix != "feature/" {
 			t.Errorf("expected branch_prefix 'feature/', got %q", cfg.BranchPrefix)
 		}
+		wantPorts := []PortMapping{{Guest: 3000}, {Host: 8080, Guest: 80}}
+		if !reflect.DeepEqual(cfg.Ports, wantPorts) {
+			t.Errorf("expected ports %v, got %v", wantPorts, cfg.Ports)
+		}
 	})
 
 	t.Run("invalid yaml returns error", func(t *testing.T) {
@@ -218,6 +229,22 @@ func TestMerge(t *testing.T) {
 		}
 	})
 
+	t.Run("project overrides git identity field by field", func(t *testing.T) {
+		g := global
+		g.GitIdentity = GitIdentity{Name: "Agent", Email: "agent@example.com"}
+		project := DefaultProjectConfig()
+		project.GitIdentity.Email = "bot@example.com"
+
+		merged, err := Merge(g, project, FlagOverrides{}, "")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		want := GitIdentity{Name: "Agent", Email: "bot@example.com"}
+		if merged.GitIdentity != want {
+			t.Errorf("GitIdentity = %+v, want %+v", merged.GitIdentity, want)
+		}
+	})
+
 	t.Run("project overrides backend", func(t *testing.T) {
 		project := DefaultProjectConfig()
 		project.Resources.Memory = "8GB"
@@ -258,6 +285,44 @@ func TestMerge(t *testing.T) {
 		}
 	})
 
+	t.Run("invalid size flag", func(t *testing.T) {
+		_, err := Merge(global, DefaultProjectConfig(), FlagOverrides{Memory: "lots"}, "")
+		if err == nil || !strings.Contains(err.Error(), "resources.memory") {
+			t.Errorf("Merge() error = %v, want one naming resources.memory", err)
+		}
+	})
+
+	t.Run("remote precedence", func(t *testing.T) {
+		g := global
+		g.Remote = "upstream"
+		project := DefaultProjectConfig()
+
+		merged, err := Merge(g, project, FlagOverrides{}, "")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if merged.Remote != "upstream" {
+			t.Errorf("expected global remote upstream, got %q", merged.Remote)
+		}
+
+		project.Remote = "fork"
+		merged, err = Merge(g, project, FlagOverrides{}, "")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if merged.Remote != "fork" {
+			t.Errorf("expected project remote fork, got %q", merged.Remote)
+		}
+
+		merged, err = Merge(g, project, FlagOverrides{Remote: "mine"}, "")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if merged.Remote != "mine" {
+			t.Errorf("expected flag remote mine, got %q", merged.Remote)
+		}
+	})
+
 	t.Run("unknown backend returns error", func(t *testing.T) {
 		project := DefaultProjectConfig()
 		flags := FlagOverrides{Backend: "nonexistent"}
@@ -267,6 +332,31 @@ func TestMerge(t *testing.T) {
 			t.Error("expected error for unknown backend")
 		}
 	})
+
+	t.Run("shell precedence", func(t *testing.T) {
+		g := global
+		g.Shell = "/bin/bash"
+		g.Backends = map[string]Backend{
+			"local": {Type: "worktree"},
+			"fishy": {Type: "worktree", Shell: "/usr/bin/fish"},
+		}
+
+		merged, err := Merge(g, DefaultProjectConfig(), FlagOverrides{}, "")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if merged.Shell != "/bin/bash" {
+			t.Errorf("expected global shell /bin/bash, got %q", merged.Shell)
+		}
+
+		merged, err = Merge(g, DefaultProjectConfig(), FlagOverrides{Backend: "fishy"}, "")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if merged.Shell != "/usr/bin/fish" {
+			t.Errorf("expected backend shell /usr/bin/fish, got %q", merged.Shell)
+		}
+	})
 }
 
 func TestExpandEnvMap(t *testing.T) {
@@ -374,3 +464,220 @@ func TestGlobalConfigPath(t *testing.T) {
 		t.Errorf("expected path to be in choir directory, got %s", path)
 	}
 }
+
+func TestLoadGlobalConfig_BackendSettings(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Cleanup(resetBackendSchemas)
+	resetBackendSchemas()
+	RegisterBackendSchema("host", BackendSchema{
+		Settings: map[string]func(string) error{
+			"shell": func(v string) error {
+				if !filepath.IsAbs(v) {
+					return errors.New("must be absolute path")
+				}
+				return nil
+			},
+			"cpus": nil,
+		},
+	})
+
+	write := func(t *testing.T, content string) {
+		t.Helper()
+		path, err := GlobalConfigPath()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		content string
+		wantErr []string
+	}{
+		{
+			name: "accepted settings",
+			content: `backends:
+  dev:
+    type: host
+    shell: /bin/sh
+    cpus: 2
+`,
+		},
+		{
+			name: "unregistered type is not checked",
+			content: `backends:
+  vm:
+    type: lima
+    vm_type: vz
+    region: us-west-2
+`,
+		},
+		{
+			name: "setting of another backend",
+			content: `backends:
+  dev:
+    type: host
+    vm_type: vz
+`,
+			wantErr: []string{`backend "dev": vm_type is not a host backend setting`},
+		},
+		{
+			name: "invalid value",
+			content: `backends:
+  dev:
+    type: host
+    shell: zsh
+`,
+			wantErr: []string{`backend "dev": invalid shell: must be absolute path`},
+		},
+		{
+			name: "all problems reported",
+			content: `backends:
+  a:
+    type: host
+    region: us-west-2
+  b:
+    type: host
+    shell: [bash]
+`,
+			wantErr: []string{
+				`backend "a": region is not a host backend setting`,
+				`backend "b": shell must be a single value`,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			write(t, tt.content)
+			_, err := LoadGlobalConfig()
+			if len(tt.wantErr) == 0 {
+				if err != nil {
+					t.Fatalf("LoadGlobalConfig() failed: %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("LoadGlobalConfig() succeeded, want error")
+			}
+			for _, want := range tt.wantErr {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("error %q does not contain %q", err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestParseTTL(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    time.Duration
+		wantErr bool
+	}{
+		{"", 0, false},
+		{"0", 0, false},
+		{"8h", 8 * time.Hour, false},
+		{"90m", 90 * time.Minute, false},
+		{"2d", 48 * time.Hour, false},
+		{"-1h", 0, true},
+		{"1.5d", 0, true},
+		{"soon", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseTTL(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseTTL(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseTTL(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestParsePortMapping(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    PortMapping
+		wantErr bool
+	}{
+		{in: "3000", want: PortMapping{Guest: 3000}},
+		{in: "8080:3000", want: PortMapping{Host: 8080, Guest: 3000}},
+		{in: "0", wantErr: true},
+		{in: "70000", wantErr: true},
+		{in: "http", wantErr: true},
+		{in: "8080:", wantErr: true},
+		{in: ":3000", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParsePortMapping(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParsePortMapping(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParsePortMapping(%q) = %+v, want %+v", tt.in, got, tt.want)
+			}
+			if !tt.wantErr && got.String() != tt.in {
+				t.Errorf("String() = %q, want %q", got.String(), tt.in)
+			}
+		})
+	}
+}
+
+func TestNetworkPolicyValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  NetworkPolicy
+		wantErr bool
+	}{
+		{name: "none", policy: NetworkPolicy{}},
+		{name: "offline", policy: NetworkPolicy{Offline: true}},
+		{name: "allow", policy: NetworkPolicy{Allow: []string{"github.com", "*.npmjs.org"}}},
+		{name: "deny", policy: NetworkPolicy{Deny: []string{"pastebin.com"}}},
+		{name: "offline and allow", policy: NetworkPolicy{Offline: true, Allow: []string{"github.com"}}, wantErr: true},
+		{name: "allow and deny", policy: NetworkPolicy{Allow: []string{"a.com"}, Deny: []string{"b.com"}}, wantErr: true},
+		{name: "URL", policy: NetworkPolicy{Allow: []string{"https://github.com"}}, wantErr: true},
+		{name: "empty label", policy: NetworkPolicy{Deny: []string{"a..com"}}, wantErr: true},
+		{name: "bare wildcard", policy: NetworkPolicy{Deny: []string{"*."}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.policy.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCloneConfigValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		clone   CloneConfig
+		wantErr bool
+	}{
+		{name: "none", clone: CloneConfig{}},
+		{name: "shallow", clone: CloneConfig{Depth: 1}},
+		{name: "blobless", clone: CloneConfig{Filter: "blob:none"}},
+		{name: "blob limit", clone: CloneConfig{Depth: 50, Filter: "blob:limit=1m"}},
+		{name: "treeless", clone: CloneConfig{Filter: "tree:0"}},
+		{name: "negative depth", clone: CloneConfig{Depth: -1}, wantErr: true},
+		{name: "unknown filter", clone: CloneConfig{Filter: "sparse:oid=abc"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.clone.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
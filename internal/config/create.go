@@ -2,49 +2,128 @@ package config
 
 import (
 	"fmt"
+	"path"
+	"regexp"
+	"strings"
 )
 
-// ValidateFileMounts validates file mounts.
-// Source paths are expected to be already expanded by ExpandFileMounts.
-// Target paths can be absolute or relative (relative paths are resolved
-// by backends relative to the workspace root).
-func ValidateFileMounts(files []FileMount) error {
+// ValidateFileMounts checks file mount sources, which are expected to be
+// already expanded by ExpandFileMounts, against policy (see
+// MountPolicy.CheckSource). Targets depend on the backend and are checked
+// by backend.Validate.
+func ValidateFileMounts(files []FileMount, policy MountPolicy) error {
 	for i, f := range files {
-		if f.Target == "" {
-			return fmt.Errorf("file mount %d: target path is required", i)
+		if err := policy.CheckSource(f.Source); err != nil {
+			return fmt.Errorf("file mount %d: %w", i, err)
 		}
 	}
 	return nil
 }
 
-// NewCreateConfig builds a CreateConfig from a MergedConfig, repository info, and environment ID.
-// It performs final validation including target path checks.
-func NewCreateConfig(merged MergedConfig, repo RepositoryInfo, id string) (CreateConfig, error) {
+// ValidateSparse checks sparse checkout paths: each must be a directory
+// path relative to the repository root, without wildcards, as git
+// sparse-checkout's cone mode requires.
+func ValidateSparse(paths []string) error {
+	for _, p := range paths {
+		clean := path.Clean(strings.TrimSuffix(p, "/"))
+		switch {
+		case strings.TrimSpace(p) == "" || clean == ".":
+			return fmt.Errorf("sparse: empty path (omit sparse to check out everything)")
+		case path.IsAbs(p):
+			return fmt.Errorf("sparse: %s: paths are relative to the repository root", p)
+		case clean == ".." || strings.HasPrefix(clean, "../"):
+			return fmt.Errorf("sparse: %s is outside the repository", p)
+		case strings.ContainsAny(p, "*?[\\!"):
+			return fmt.Errorf("sparse: %s: list directories, not patterns", p)
+		}
+	}
+	return nil
+}
+
+// secretEnvPattern matches environment variable names that look like they
+// hold a secret.
+var secretEnvPattern = regexp.MustCompile(`(?i)(token|secret|password|passwd|api_?key|credential|private_?key)`)
+
+// CreatePlan is what creating an environment will do, worked out without
+// doing any of it. "env create --plan" prints it.
+type CreatePlan struct {
+	// Config is the configuration the environment will be created with.
+	Config CreateConfig
+
+	// secretEnv are the keys of Config.Environment read from_file.
+	secretEnv map[string]bool
+}
+
+// IsSecret reports whether the environment variable name may hold a
+// secret, and so must not be shown: its value was read from_file, or its
+// name looks like a token, password, or key.
+func (p CreatePlan) IsSecret(name string) bool {
+	return p.secretEnv[name] || secretEnvPattern.MatchString(name)
+}
+
+// PlanCreate validates a MergedConfig for creating the environment id in
+// repo and plans its creation. It has no side effects.
+func PlanCreate(merged MergedConfig, repo RepositoryInfo, id string) (CreatePlan, error) {
 	if id == "" {
-		return CreateConfig{}, fmt.Errorf("environment ID is required")
+		return CreatePlan{}, fmt.Errorf("environment ID is required")
 	}
 
 	if repo.Path == "" {
-		return CreateConfig{}, fmt.Errorf("repository path is required")
+		return CreatePlan{}, fmt.Errorf("repository path is required")
 	}
 
-	// Validate file mount target paths
-	if err := ValidateFileMounts(merged.Files); err != nil {
-		return CreateConfig{}, fmt.Errorf("invalid file mounts: %w", err)
+	if err := merged.Network.Validate(); err != nil {
+		return CreatePlan{}, err
 	}
 
-	return CreateConfig{
+	// Validate file mount sources
+	if err := ValidateFileMounts(merged.Files, merged.MountPolicy); err != nil {
+		return CreatePlan{}, fmt.Errorf("invalid file mounts: %w", err)
+	}
+
+	if err := ValidateSparse(merged.Sparse); err != nil {
+		return CreatePlan{}, err
+	}
+
+	resources, err := merged.Resources.Parse()
+	if err != nil {
+		return CreatePlan{}, err
+	}
+
+	cfg := CreateConfig{
 		ID:            id,
 		Backend:       merged.Backend,
 		BackendType:   merged.BackendType,
-		Resources:     merged.Resources,
+		Resources:     resources,
 		Credentials:   merged.Credentials,
 		Repository:    repo,
 		BaseImage:     merged.BaseImage,
 		Packages:      merged.Packages,
+		Tools:         merged.Tools,
 		Environment:   merged.Env,
 		Files:         merged.Files,
 		SetupCommands: merged.Setup,
+		PreDestroy:    merged.PreDestroy,
+		Cache:         merged.Cache,
+		Submodules:    merged.Submodules,
+		Sparse:        merged.Sparse,
+		Ignore:        merged.Ignore,
+		Ports:         merged.Ports,
+		Network:       merged.Network,
 		BranchPrefix:  merged.BranchPrefix,
-	}, nil
+		GitIdentity:   merged.GitIdentity,
+		CommitTrailer: merged.CommitTrailer,
+		SetupWrapper:  merged.SetupWrapper,
+	}
+	return CreatePlan{Config: cfg, secretEnv: merged.SecretEnv}, nil
+}
+
+// NewCreateConfig builds a CreateConfig from a MergedConfig, repository info, and environment ID.
+// It performs final validation including target path checks (see PlanCreate).
+func NewCreateConfig(merged MergedConfig, repo RepositoryInfo, id string) (CreateConfig, error) {
+	plan, err := PlanCreate(merged, repo, id)
+	if err != nil {
+		return CreateConfig{}, err
+	}
+	return plan.Config, nil
 }
@@ -1,6 +1,9 @@
 package config
 
 import (
+	"errors"
+	"os"
+	"path/filepath"
 	"testing"
 )
 
@@ -30,13 +33,6 @@ func TestValidateFileMounts(t *testing.T) {
 			},
 			wantErr: false,
 		},
-		{
-			name: "empty target path",
-			files: []FileMount{
-				{Source: "/home/user/.aws", Target: ""},
-			},
-			wantErr: true,
-		},
 		{
 			name: "mixed absolute and relative targets",
 			files: []FileMount{
@@ -49,7 +45,7 @@ func TestValidateFileMounts(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			err := ValidateFileMounts(tt.files)
+			err := ValidateFileMounts(tt.files, MountPolicy{})
 			if (err != nil) != tt.wantErr {
 				t.Errorf("ValidateFileMounts() error = %v, wantErr %v", err, tt.wantErr)
 			}
@@ -57,6 +53,19 @@ func TestValidateFileMounts(t *testing.T) {
 	}
 }
 
+func TestValidateSparse(t *testing.T) {
+	for _, paths := range [][]string{nil, {"services/api"}, {"web/", "libs/shared"}} {
+		if err := ValidateSparse(paths); err != nil {
+			t.Errorf("ValidateSparse(%q) = %v, want nil", paths, err)
+		}
+	}
+	for _, paths := range [][]string{{""}, {"."}, {"/abs"}, {"../up"}, {"a/../../up"}, {"src/*.go"}, {"!docs"}} {
+		if err := ValidateSparse(paths); err == nil {
+			t.Errorf("ValidateSparse(%q) succeeded, want error", paths)
+		}
+	}
+}
+
 func TestNewCreateConfig(t *testing.T) {
 	baseMerged := MergedConfig{
 		Backend:     "local",
@@ -156,17 +165,6 @@ func TestNewCreateConfig(t *testing.T) {
 		}
 	})
 
-	t.Run("empty file mount target", func(t *testing.T) {
-		invalidMerged := baseMerged
-		invalidMerged.Files = []FileMount{
-			{Source: "/home/user/.aws", Target: ""},
-		}
-		_, err := NewCreateConfig(invalidMerged, baseRepo, "abc123def456abc123def456abc12345")
-		if err == nil {
-			t.Error("expected error for empty file mount target")
-		}
-	})
-
 	t.Run("empty remote URL is allowed", func(t *testing.T) {
 		repoNoRemote := RepositoryInfo{
 			Path:       "/home/user/projects/myapp",
@@ -208,3 +206,122 @@ func TestNewCreateConfig(t *testing.T) {
 		}
 	})
 }
+
+func TestMountPolicy(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	sshDir := filepath.Join(home, ".ssh")
+	if err := os.MkdirAll(sshDir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	project := filepath.Join(home, "project")
+	if err := os.MkdirAll(project, 0755); err != nil {
+		t.Fatal(err)
+	}
+	link := filepath.Join(project, "keys")
+	if err := os.Symlink(sshDir, link); err != nil {
+		t.Fatal(err)
+	}
+
+	policy, err := ExpandMountPolicy(MountPolicy{
+		Allow: []string{"~/.ssh/config"},
+		Deny:  []string{"~/secrets"},
+	})
+	if err != nil {
+		t.Fatalf("ExpandMountPolicy() failed: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		source string
+		denied bool
+	}{
+		{"project file", filepath.Join(project, "config.json"), false},
+		{"default denied dir", sshDir, true},
+		{"inside default denied dir", filepath.Join(sshDir, "id_ed25519"), true},
+		{"ancestor of denied dir", home, true},
+		{"symlink to denied dir", link, true},
+		{"explicitly allowed", filepath.Join(sshDir, "config"), false},
+		{"configured deny", filepath.Join(home, "secrets", "token"), true},
+		{"sibling with shared prefix", filepath.Join(home, ".sshx"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := policy.CheckSource(tt.source)
+			if tt.denied && !errors.Is(err, ErrMountDenied) {
+				t.Errorf("CheckSource(%s) = %v, want ErrMountDenied", tt.source, err)
+			}
+			if !tt.denied && err != nil {
+				t.Errorf("CheckSource(%s) = %v, want nil", tt.source, err)
+			}
+		})
+	}
+
+	// Policy paths written through a link, as /tmp is on macOS, match the
+	// resolved source
+	secrets := filepath.Join(home, "real-secrets")
+	if err := os.MkdirAll(secrets, 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(secrets, filepath.Join(home, "secrets-link")); err != nil {
+		t.Fatal(err)
+	}
+	homeLink := filepath.Join(t.TempDir(), "home")
+	if err := os.Symlink(home, homeLink); err != nil {
+		t.Fatal(err)
+	}
+	linked := MountPolicy{
+		Allow: []string{filepath.Join(homeLink, ".ssh", "config")},
+		Deny:  []string{filepath.Join(home, "secrets-link"), filepath.Join(homeLink, "not-yet", "keys")},
+	}
+	for _, tt := range []struct {
+		source string
+		denied bool
+	}{
+		{filepath.Join(secrets, "token"), true},
+		{filepath.Join(home, "not-yet", "keys"), true},
+		{filepath.Join(sshDir, "config"), false},
+		{filepath.Join(sshDir, "id_ed25519"), true},
+	} {
+		err := linked.CheckSource(tt.source)
+		if tt.denied != errors.Is(err, ErrMountDenied) || (!tt.denied && err != nil) {
+			t.Errorf("CheckSource(%s) with symlinked policy = %v, want denied %v", tt.source, err, tt.denied)
+		}
+	}
+
+	if _, err := ExpandMountPolicy(MountPolicy{Deny: []string{"relative/path"}}); err == nil {
+		t.Error("ExpandMountPolicy() should reject relative paths")
+	}
+
+	err = ValidateFileMounts([]FileMount{{Source: sshDir, Target: ".ssh"}}, MountPolicy{})
+	if !errors.Is(err, ErrMountDenied) {
+		t.Errorf("ValidateFileMounts() error = %v, want ErrMountDenied", err)
+	}
+}
+
+func TestPlanCreateSecrets(t *testing.T) {
+	merged := MergedConfig{
+		Env: map[string]string{
+			"NODE_ENV":     "development",
+			"GITHUB_TOKEN": "ghp_x",
+			"DB_URL":       "postgres://u:p@db",
+		},
+		SecretEnv: map[string]bool{"DB_URL": true},
+	}
+	plan, err := PlanCreate(merged, RepositoryInfo{Path: "/repo"}, "abc123def456")
+	if err != nil {
+		t.Fatalf("PlanCreate() failed: %v", err)
+	}
+	for name, want := range map[string]bool{
+		"NODE_ENV":     false,
+		"GITHUB_TOKEN": true,
+		"DB_URL":       true,
+		"api_key":      true,
+		"DB_PASSWORD":  true,
+	} {
+		if got := plan.IsSecret(name); got != want {
+			t.Errorf("IsSecret(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
@@ -140,11 +140,40 @@ func ExpandFileMounts(files []FileMount, baseDir string) ([]FileMount, error) {
 		if baseDir != "" && !filepath.IsAbs(expandedSource) {
 			expandedSource = filepath.Clean(filepath.Join(baseDir, expandedSource))
 		}
-		result[i] = FileMount{
-			Source:   expandedSource,
-			Target:   f.Target,
-			ReadOnly: f.ReadOnly,
-		}
+		result[i] = f
+		result[i].Source = expandedSource
 	}
 	return result, nil
 }
+
+// ExpandMountPolicy expands ~ in mount policy paths.
+// Relative paths are rejected since there is no sensible base directory.
+func ExpandMountPolicy(policy MountPolicy) (MountPolicy, error) {
+	expand := func(field string, paths []string) ([]string, error) {
+		if paths == nil {
+			return nil, nil
+		}
+		result := make([]string, len(paths))
+		for i, p := range paths {
+			expanded, err := ExpandPath(p)
+			if err != nil {
+				return nil, fmt.Errorf("%s %d: %w", field, i, err)
+			}
+			if !filepath.IsAbs(expanded) {
+				return nil, fmt.Errorf("%s %d: path must be absolute or start with ~: %s", field, i, p)
+			}
+			result[i] = filepath.Clean(expanded)
+		}
+		return result, nil
+	}
+
+	var expanded MountPolicy
+	var err error
+	if expanded.Allow, err = expand("allow", policy.Allow); err != nil {
+		return MountPolicy{}, err
+	}
+	if expanded.Deny, err = expand("deny", policy.Deny); err != nil {
+		return MountPolicy{}, err
+	}
+	return expanded, nil
+}
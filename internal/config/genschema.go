@@ -0,0 +1,32 @@
+//go:build ignore
+
+// genschema writes the JSON Schemas for the project and global config to
+// docs/schema. Run it with go generate in internal/config.
+package main
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/Quidge/choir/internal/config"
+)
+
+func main() {
+	dir := filepath.Join("..", "..", "docs", "schema")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		log.Fatal(err)
+	}
+	for name, generate := range map[string]func() ([]byte, error){
+		config.ProjectSchemaFilename: config.ProjectSchema,
+		config.GlobalSchemaFilename:  config.GlobalSchema,
+	} {
+		data, err := generate()
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0644); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
@@ -20,7 +20,9 @@ func GlobalConfigPath() (string, error) {
 
 // LoadGlobalConfig loads the global configuration from ~/.config/choir/config.yaml.
 // If the file doesn't exist, returns default configuration (not an error).
-// If the file exists but is invalid YAML, returns an error.
+// If the file exists but is invalid YAML, has unknown keys while parsing is
+// strict (see SetStrict), or a backend has settings its type doesn't accept
+// (see RegisterBackendSchema), returns an error.
 func LoadGlobalConfig() (GlobalConfig, error) {
 	configPath, err := GlobalConfigPath()
 	if err != nil {
@@ -35,9 +37,18 @@ func LoadGlobalConfig() (GlobalConfig, error) {
 		return GlobalConfig{}, fmt.Errorf("failed to read global config: %w", err)
 	}
 
+	return ParseGlobalConfig(data, configPath)
+}
+
+// ParseGlobalConfig parses and validates global config YAML read from
+// configPath, applying defaults for missing fields.
+func ParseGlobalConfig(data []byte, configPath string) (GlobalConfig, error) {
+	if err := validateBackendSettings(data); err != nil {
+		return GlobalConfig{}, fmt.Errorf("invalid backend settings in %s: %w", configPath, err)
+	}
 	var cfg GlobalConfig
-	if err := yaml.Unmarshal(data, &cfg); err != nil {
-		return GlobalConfig{}, fmt.Errorf("invalid YAML in %s: %w", configPath, err)
+	if err := unmarshalConfig(data, configPath, &cfg); err != nil {
+		return GlobalConfig{}, err
 	}
 
 	// Apply defaults for missing fields
@@ -100,6 +111,16 @@ func applyGlobalDefaults(cfg GlobalConfig) GlobalConfig {
 	return cfg
 }
 
+// ShellFor returns the shell configured for the named backend.
+// A backend-level shell overrides the global shell. Returns an empty string
+// if neither is set, meaning backends should fall back to $SHELL.
+func (g GlobalConfig) ShellFor(backendName string) string {
+	if b, ok := g.Backends[backendName]; ok && b.Shell != "" {
+		return b.Shell
+	}
+	return g.Shell
+}
+
 // EnsureGlobalConfigDir creates the global config directory if it doesn't exist.
 func EnsureGlobalConfigDir() error {
 	configPath, err := GlobalConfigPath()
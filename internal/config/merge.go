@@ -11,17 +11,39 @@ type FlagOverrides struct {
 	CPUs    int
 	Memory  string
 	Disk    string
+	Remote  string
+
+	// Profile, if set, names the project config profile to merge on top
+	// of the project config (see Profile).
+	Profile string
+
+	// Template, if set, replaces the project's setup (see Template).
+	Template *Template
 }
 
 // Merge combines global config, project config, and CLI flag overrides
-// following the precedence order: backend defaults → global → project → flags.
+// following the precedence order: backend defaults → global → project →
+// profile → template → flags.
 // projectDir is used to resolve relative paths in file mounts.
 // Returns the merged configuration ready for use.
 func Merge(global GlobalConfig, project ProjectConfig, flags FlagOverrides, projectDir string) (MergedConfig, error) {
 	merged := MergedConfig{}
 
+	if flags.Profile != "" {
+		var err error
+		if project, err = project.WithProfile(flags.Profile); err != nil {
+			return MergedConfig{}, err
+		}
+	}
+	if flags.Template != nil {
+		project = flags.Template.apply(project)
+	}
+
 	// Determine which backend to use
 	merged.Backend = global.DefaultBackend
+	if flags.Template != nil && flags.Template.Backend != "" {
+		merged.Backend = flags.Template.Backend
+	}
 	if flags.Backend != "" {
 		merged.Backend = flags.Backend
 	}
@@ -33,6 +55,8 @@ func Merge(global GlobalConfig, project ProjectConfig, flags FlagOverrides, proj
 	}
 	merged.BackendType = backend.Type
 
+	merged.Shell = global.ShellFor(merged.Backend)
+
 	// Merge resources: backend defaults → project config → flags
 	merged.Resources = Resources{
 		CPUs:   backend.CPUs,
@@ -61,6 +85,9 @@ func Merge(global GlobalConfig, project ProjectConfig, flags FlagOverrides, proj
 	if flags.Disk != "" {
 		merged.Resources.Disk = flags.Disk
 	}
+	if _, err := merged.Resources.Parse(); err != nil {
+		return MergedConfig{}, err
+	}
 
 	// Expand credentials from global config
 	expandedCreds, err := ExpandCredentials(global.Credentials)
@@ -69,11 +96,67 @@ func Merge(global GlobalConfig, project ProjectConfig, flags FlagOverrides, proj
 	}
 	merged.Credentials = expandedCreds
 
+	// Expand mount policy from global config
+	mountPolicy, err := ExpandMountPolicy(global.MountPolicy)
+	if err != nil {
+		return MergedConfig{}, fmt.Errorf("failed to expand mount_policy: %w", err)
+	}
+	merged.MountPolicy = mountPolicy
+	merged.Naming = global.Naming
+
+	// TTL: global default → project
+	ttl := global.DefaultTTL
+	if project.TTL != "" {
+		ttl = project.TTL
+	}
+	merged.TTL, err = ParseTTL(ttl)
+	if err != nil {
+		return MergedConfig{}, fmt.Errorf("invalid ttl: %w", err)
+	}
+
+	if project.Pool < 0 {
+		return MergedConfig{}, fmt.Errorf("invalid pool: must not be negative, got %d", project.Pool)
+	}
+	merged.Pool = project.Pool
+
+	// Remote: global → project → flags
+	merged.Remote = global.Remote
+	if project.Remote != "" {
+		merged.Remote = project.Remote
+	}
+	if flags.Remote != "" {
+		merged.Remote = flags.Remote
+	}
+
 	// Copy project-specific settings
 	merged.BaseImage = project.BaseImage
 	merged.Packages = project.Packages
+	merged.Tools = project.Tools
 	merged.Setup = project.Setup
+	merged.SetupWrapper = project.SetupWrapper
+	merged.PreDestroy = project.PreDestroy
+	merged.Cache = project.Cache
+	merged.Submodules = project.Submodules
+	merged.Sparse = project.Sparse
+	merged.Ignore = project.Ignore
 	merged.BranchPrefix = project.BranchPrefix
+	merged.Ports = project.Ports
+	merged.Network = project.Network
+
+	merged.CommitTrailer = global.CommitTrailer || project.CommitTrailer
+	merged.FetchBeforeCreate = global.FetchBeforeCreate || project.FetchBeforeCreate
+
+	// Git identity: global → project, field by field
+	merged.GitIdentity = global.GitIdentity
+	if project.GitIdentity.Name != "" {
+		merged.GitIdentity.Name = project.GitIdentity.Name
+	}
+	if project.GitIdentity.Email != "" {
+		merged.GitIdentity.Email = project.GitIdentity.Email
+	}
+	if project.GitIdentity.SigningKey != "" {
+		merged.GitIdentity.SigningKey = project.GitIdentity.SigningKey
+	}
 
 	// Expand environment variables
 	if project.Env != nil {
@@ -82,6 +165,14 @@ func Merge(global GlobalConfig, project ProjectConfig, flags FlagOverrides, proj
 			return MergedConfig{}, fmt.Errorf("failed to expand environment variables: %w", err)
 		}
 		merged.Env = expandedEnv
+		for key, envVar := range project.Env {
+			if envVar.FromFile != "" {
+				if merged.SecretEnv == nil {
+					merged.SecretEnv = make(map[string]bool)
+				}
+				merged.SecretEnv[key] = true
+			}
+		}
 	}
 
 	// Expand file mount source paths (relative to project directory)
@@ -0,0 +1,99 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DefaultDeniedMountSources are host paths that may never be used as file
+// mount sources unless explicitly allowed in mount_policy.allow.
+// Credentials needed inside environments (e.g., SSH keys) are configured
+// through the global credentials section instead.
+var DefaultDeniedMountSources = []string{
+	"~/.ssh",
+	"~/.gnupg",
+	"~/.netrc",
+	"~/.config/choir",
+}
+
+// ErrMountDenied is returned when a file mount source is denied by the
+// mount policy.
+var ErrMountDenied = errors.New("mount source denied by policy")
+
+// CheckSource returns an error wrapping ErrMountDenied if source is not
+// permitted as a file mount source.
+//
+// A source is denied if it is, is inside, or contains a denied path (so
+// mounting ~ is denied because it contains ~/.ssh). A source equal to or
+// inside an allowed path is always permitted. Symlinks in source and in the
+// policy's paths are resolved first, so a link inside the project cannot
+// smuggle in a denied path, and a policy path written through a link (such
+// as /tmp on macOS, or a symlinked home directory) still matches.
+//
+// Policy paths are expected to be already expanded by ExpandMountPolicy.
+func (p MountPolicy) CheckSource(source string) error {
+	resolved := resolvePath(source)
+
+	for _, allowed := range p.Allow {
+		if pathWithin(resolved, resolvePath(allowed)) {
+			return nil
+		}
+	}
+
+	for _, denied := range p.deniedPaths() {
+		if pathWithin(resolved, denied) || pathWithin(denied, resolved) {
+			msg := source
+			if resolved != filepath.Clean(source) {
+				msg = fmt.Sprintf("%s (resolves to %s)", source, resolved)
+			}
+			return fmt.Errorf("%w: %s overlaps protected path %s; add it to mount_policy.allow in the global config to permit it",
+				ErrMountDenied, msg, denied)
+		}
+	}
+	return nil
+}
+
+// deniedPaths returns the expanded default and configured denied paths,
+// with symlinks resolved (see resolvePath). Defaults that cannot be
+// expanded (no home directory) are skipped.
+func (p MountPolicy) deniedPaths() []string {
+	paths := make([]string, 0, len(DefaultDeniedMountSources)+len(p.Deny))
+	for _, d := range DefaultDeniedMountSources {
+		expanded, err := ExpandPath(d)
+		if err != nil {
+			continue
+		}
+		paths = append(paths, resolvePath(expanded))
+	}
+	for _, d := range p.Deny {
+		paths = append(paths, resolvePath(d))
+	}
+	return paths
+}
+
+// resolvePath returns path, cleaned, with its symlinks resolved as far as
+// it exists: if it doesn't, its nearest existing ancestor is resolved and
+// the rest appended, so a path that doesn't exist yet still compares equal
+// to the same path reached through a link.
+func resolvePath(path string) string {
+	path = filepath.Clean(path)
+	if real, err := filepath.EvalSymlinks(path); err == nil {
+		return real
+	}
+	parent := filepath.Dir(path)
+	if parent == path {
+		return path
+	}
+	return filepath.Join(resolvePath(parent), filepath.Base(path))
+}
+
+// pathWithin reports whether path is base or inside base.
+func pathWithin(path, base string) bool {
+	if path == base {
+		return true
+	}
+	return strings.HasPrefix(path, strings.TrimSuffix(base, string(os.PathSeparator))+string(os.PathSeparator))
+}
@@ -0,0 +1,121 @@
+package config
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// Profile is a named variant of the project config under profiles: in
+// .choir.yaml, selected with "choir env create --profile", so one
+// repository can define several kinds of environment, e.g., a gpu profile
+// with more memory and CUDA packages.
+//
+// A profile is merged on top of the rest of the project config: settings it
+// sets replace the project's, except that lists (packages, files, setup,
+// pre_destroy, cache, sparse, ignore, and ports) are appended to and env is
+// merged by variable.
+// Tools, agent, and network, if set, replace the project's as a whole;
+// resources are merged field by field.
+type Profile struct {
+	BaseImage    string            `yaml:"base_image,omitempty"`
+	Packages     []string          `yaml:"packages,omitempty"`
+	Tools        *ToolsConfig      `yaml:"tools,omitempty"`
+	Env          map[string]EnvVar `yaml:"env,omitempty"`
+	Files        []FileMount       `yaml:"files,omitempty"`
+	Setup        []string          `yaml:"setup,omitempty"`
+	SetupWrapper string            `yaml:"setup_wrapper,omitempty"`
+	PreDestroy   []string          `yaml:"pre_destroy,omitempty"`
+	Cache        []CacheEntry      `yaml:"cache,omitempty"`
+	Submodules   bool              `yaml:"submodules,omitempty"`
+	Sparse       []string          `yaml:"sparse,omitempty"`
+	Ignore       []string          `yaml:"ignore,omitempty"`
+	Resources    Resources         `yaml:"resources,omitempty"`
+	BranchPrefix string            `yaml:"branch_prefix,omitempty"`
+	TTL          string            `yaml:"ttl,omitempty"`
+	Remote       string            `yaml:"remote,omitempty"`
+	Agent        *AgentConfig      `yaml:"agent,omitempty"`
+	Ports        []PortMapping     `yaml:"ports,omitempty"`
+	Network      *NetworkPolicy    `yaml:"network,omitempty"`
+}
+
+// ProfileNames returns the names of the project's profiles, sorted.
+func (p ProjectConfig) ProfileNames() []string {
+	return slices.Sorted(maps.Keys(p.Profiles))
+}
+
+// WithProfile returns the project config with the named profile merged on
+// top of it, as described for Profile. The result has no profiles.
+func (p ProjectConfig) WithProfile(name string) (ProjectConfig, error) {
+	profile, ok := p.Profiles[name]
+	if !ok {
+		if len(p.Profiles) == 0 {
+			return ProjectConfig{}, fmt.Errorf("unknown profile %q: %s defines no profiles", name, ProjectConfigFilename)
+		}
+		return ProjectConfig{}, fmt.Errorf("unknown profile %q (available: %s)", name, strings.Join(p.ProfileNames(), ", "))
+	}
+	return profile.apply(p), nil
+}
+
+// apply returns project with the profile merged on top of it.
+func (pr Profile) apply(project ProjectConfig) ProjectConfig {
+	project.Profiles = nil
+
+	if pr.BaseImage != "" {
+		project.BaseImage = pr.BaseImage
+	}
+	if pr.BranchPrefix != "" {
+		project.BranchPrefix = pr.BranchPrefix
+	}
+	if pr.TTL != "" {
+		project.TTL = pr.TTL
+	}
+	if pr.Remote != "" {
+		project.Remote = pr.Remote
+	}
+	if pr.SetupWrapper != "" {
+		project.SetupWrapper = pr.SetupWrapper
+	}
+	if pr.Submodules {
+		project.Submodules = true
+	}
+	if pr.Tools != nil {
+		project.Tools = *pr.Tools
+	}
+	if pr.Agent != nil {
+		project.Agent = *pr.Agent
+	}
+	if pr.Network != nil {
+		project.Network = *pr.Network
+	}
+
+	if pr.Resources.CPUs != 0 {
+		project.Resources.CPUs = pr.Resources.CPUs
+	}
+	if pr.Resources.Memory != "" {
+		project.Resources.Memory = pr.Resources.Memory
+	}
+	if pr.Resources.Disk != "" {
+		project.Resources.Disk = pr.Resources.Disk
+	}
+
+	// Copy before appending so the project's slices and map aren't shared
+	project.Packages = slices.Concat(project.Packages, pr.Packages)
+	project.Files = slices.Concat(project.Files, pr.Files)
+	project.Setup = slices.Concat(project.Setup, pr.Setup)
+	project.PreDestroy = slices.Concat(project.PreDestroy, pr.PreDestroy)
+	project.Cache = slices.Concat(project.Cache, pr.Cache)
+	project.Sparse = slices.Concat(project.Sparse, pr.Sparse)
+	project.Ignore = slices.Concat(project.Ignore, pr.Ignore)
+	project.Ports = slices.Concat(project.Ports, pr.Ports)
+	if len(pr.Env) > 0 {
+		env := maps.Clone(project.Env)
+		if env == nil {
+			env = make(map[string]EnvVar, len(pr.Env))
+		}
+		maps.Copy(env, pr.Env)
+		project.Env = env
+	}
+	return project
+}
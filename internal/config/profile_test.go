@@ -0,0 +1,115 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestWithProfile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ProjectConfigFilename)
+	content := `version: 1
+packages: [python3]
+setup:
+  - make deps
+env:
+  MODE: dev
+  LOG: info
+resources:
+  memory: 8GB
+  cpus: 4
+network:
+  deny: [pastebin.com]
+profiles:
+  gpu:
+    packages: [nvidia-cuda-toolkit]
+    setup:
+      - pip install torch
+    env:
+      MODE: gpu
+    resources:
+      memory: 32GB
+    ttl: 4h
+    network:
+      offline: true
+`
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	project, err := LoadProjectConfig(path)
+	if err != nil {
+		t.Fatalf("LoadProjectConfig() failed: %v", err)
+	}
+
+	got, err := project.WithProfile("gpu")
+	if err != nil {
+		t.Fatalf("WithProfile() failed: %v", err)
+	}
+	if want := []string{"python3", "nvidia-cuda-toolkit"}; !reflect.DeepEqual(got.Packages, want) {
+		t.Errorf("Packages = %v, want %v", got.Packages, want)
+	}
+	if want := []string{"make deps", "pip install torch"}; !reflect.DeepEqual(got.Setup, want) {
+		t.Errorf("Setup = %v, want %v", got.Setup, want)
+	}
+	if got.Env["MODE"].Value != "gpu" || got.Env["LOG"].Value != "info" {
+		t.Errorf("Env = %v, want MODE from the profile and LOG from the project", got.Env)
+	}
+	if want := (Resources{Memory: "32GB", CPUs: 4}); got.Resources != want {
+		t.Errorf("Resources = %+v, want %+v", got.Resources, want)
+	}
+	if got.TTL != "4h" || got.BranchPrefix != "env/" {
+		t.Errorf("TTL = %q, BranchPrefix = %q; want 4h and the default", got.TTL, got.BranchPrefix)
+	}
+	if !got.Network.Offline || len(got.Network.Deny) != 0 {
+		t.Errorf("Network = %+v, want the profile's", got.Network)
+	}
+	if got.Profiles != nil {
+		t.Errorf("Profiles = %v, want none", got.Profiles)
+	}
+
+	// The project's own settings are untouched
+	if len(project.Packages) != 1 || project.Env["MODE"].Value != "dev" {
+		t.Errorf("WithProfile() changed the project config: %+v", project)
+	}
+
+	_, err = project.WithProfile("cpu")
+	if err == nil || !strings.Contains(err.Error(), "available: gpu") {
+		t.Errorf("WithProfile(unknown) error = %v, want one listing the profiles", err)
+	}
+}
+
+func TestMergeProfile(t *testing.T) {
+	global := DefaultGlobalConfig()
+	project := DefaultProjectConfig()
+	project.Setup = []string{"make"}
+	project.Profiles = map[string]Profile{
+		"docs": {Setup: []string{"npm ci --prefix docs"}, BranchPrefix: "docs/"},
+	}
+
+	merged, err := Merge(global, project, FlagOverrides{Profile: "docs"}, "")
+	if err != nil {
+		t.Fatalf("Merge() failed: %v", err)
+	}
+	if want := []string{"make", "npm ci --prefix docs"}; !reflect.DeepEqual(merged.Setup, want) {
+		t.Errorf("Setup = %v, want %v", merged.Setup, want)
+	}
+	if merged.BranchPrefix != "docs/" {
+		t.Errorf("BranchPrefix = %q, want the profile's", merged.BranchPrefix)
+	}
+
+	// A template still replaces the setup the profile produced
+	tmpl := &Template{Setup: []string{"npm ci"}}
+	merged, err = Merge(global, project, FlagOverrides{Profile: "docs", Template: tmpl}, "")
+	if err != nil {
+		t.Fatalf("Merge() failed: %v", err)
+	}
+	if !reflect.DeepEqual(merged.Setup, []string{"npm ci"}) {
+		t.Errorf("Setup = %v, want the template's", merged.Setup)
+	}
+
+	if _, err := Merge(global, DefaultProjectConfig(), FlagOverrides{Profile: "docs"}, ""); err == nil {
+		t.Error("Merge() with a profile the project doesn't define succeeded, want error")
+	}
+}
@@ -35,7 +35,8 @@ func FindProjectConfig(startDir string) (string, error) {
 // LoadProjectConfig loads the project configuration from .choir.yaml.
 // If configPath is empty, searches from the current directory.
 // If the file doesn't exist, returns default configuration (not an error).
-// If the file exists but is invalid YAML, returns an error.
+// If the file exists but is invalid YAML, or has unknown keys while parsing
+// is strict (see SetStrict), returns an error.
 func LoadProjectConfig(configPath string) (ProjectConfig, error) {
 	if configPath == "" {
 		cwd, err := os.Getwd()
@@ -60,8 +61,8 @@ func LoadProjectConfig(configPath string) (ProjectConfig, error) {
 	}
 
 	var cfg ProjectConfig
-	if err := yaml.Unmarshal(data, &cfg); err != nil {
-		return ProjectConfig{}, fmt.Errorf("invalid YAML in %s: %w", configPath, err)
+	if err := unmarshalConfig(data, configPath, &cfg); err != nil {
+		return ProjectConfig{}, err
 	}
 
 	// Apply defaults for missing fields
@@ -0,0 +1,105 @@
+package config
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ByteSize is a memory or disk size in bytes.
+type ByteSize uint64
+
+// Binary size units. Sizes are parsed with binary units whichever way they
+// are written, as VM tools do: "4GB" and "4GiB" are both 4 GiB.
+const (
+	KiB ByteSize = 1 << (10 * (iota + 1))
+	MiB
+	GiB
+	TiB
+)
+
+// sizePattern matches the sizes ParseByteSize accepts, e.g., "512MB",
+// "8GB", "4096MiB", or "1.5T".
+var sizePattern = regexp.MustCompile(`^([0-9]+(\.[0-9]+)?) ?([KMGTkmgt]i?[Bb]?|[Bb])$`)
+
+// ParseByteSize parses a memory or disk size: a number and a unit of B, K,
+// M, G, or T, optionally followed by B or iB, in either case. The units are
+// binary, so "4GB", "4GiB", and "4096MiB" are the same size. The size must
+// be at least one byte.
+func ParseByteSize(s string) (ByteSize, error) {
+	m := sizePattern.FindStringSubmatch(strings.TrimSpace(s))
+	if m == nil {
+		return 0, fmt.Errorf("invalid size %q (use a number and a unit, e.g., 8GB or 512MiB)", s)
+	}
+	n, err := strconv.ParseFloat(m[1], 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size %q: %w", s, err)
+	}
+
+	unit := ByteSize(1)
+	switch strings.ToUpper(m[3])[0] {
+	case 'K':
+		unit = KiB
+	case 'M':
+		unit = MiB
+	case 'G':
+		unit = GiB
+	case 'T':
+		unit = TiB
+	}
+	bytes := n * float64(unit)
+	if bytes < 1 {
+		return 0, fmt.Errorf("invalid size %q: must be at least 1 byte", s)
+	}
+	if bytes >= math.MaxUint64 {
+		return 0, fmt.Errorf("invalid size %q: too large", s)
+	}
+	return ByteSize(bytes), nil
+}
+
+// String returns the size in the largest binary unit that represents it
+// exactly, e.g., "4GiB" or "1536MiB", which VM tools accept as written.
+func (b ByteSize) String() string {
+	for _, u := range []struct {
+		size ByteSize
+		name string
+	}{{TiB, "TiB"}, {GiB, "GiB"}, {MiB, "MiB"}, {KiB, "KiB"}} {
+		if b >= u.size && b%u.size == 0 {
+			return strconv.FormatUint(uint64(b/u.size), 10) + u.name
+		}
+	}
+	return strconv.FormatUint(uint64(b), 10) + "B"
+}
+
+// ResourceLimits are Resources parsed into the values backends that
+// allocate resources give each workspace. Zero means the backend's default.
+type ResourceLimits struct {
+	CPUs   int
+	Memory ByteSize
+	Disk   ByteSize
+}
+
+// Parse parses r's sizes. Empty sizes are left zero.
+func (r Resources) Parse() (ResourceLimits, error) {
+	limits := ResourceLimits{CPUs: r.CPUs}
+	if r.CPUs < 0 {
+		return limits, fmt.Errorf("resources.cpus: must not be negative, got %d", r.CPUs)
+	}
+	for _, f := range []struct {
+		key  string
+		from string
+		to   *ByteSize
+	}{{"resources.memory", r.Memory, &limits.Memory}, {"resources.disk", r.Disk, &limits.Disk}} {
+		if f.from == "" {
+			continue
+		}
+		size, err := ParseByteSize(f.from)
+		if err != nil {
+			return limits, fmt.Errorf("%s: %w", f.key, err)
+		}
+		*f.to = size
+	}
+	return limits, nil
+}
@@ -0,0 +1,74 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseByteSize(t *testing.T) {
+	tests := []struct {
+		in   string
+		want ByteSize
+	}{
+		{"4GB", 4 * GiB},
+		{"4GiB", 4 * GiB},
+		{"4096MiB", 4 * GiB},
+		{"4g", 4 * GiB},
+		{"512 MB", 512 * MiB},
+		{"1.5T", 1536 * GiB},
+		{"100B", 100},
+		{"2kb", 2 * KiB},
+	}
+	for _, tt := range tests {
+		got, err := ParseByteSize(tt.in)
+		if err != nil {
+			t.Errorf("ParseByteSize(%q) failed: %v", tt.in, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseByteSize(%q) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+
+	for _, in := range []string{"", "4", "GB", "4XB", "-1GB", "0GB", "4 gigs", "99999999999T"} {
+		if got, err := ParseByteSize(in); err == nil {
+			t.Errorf("ParseByteSize(%q) = %d, want error", in, got)
+		}
+	}
+}
+
+func TestByteSizeString(t *testing.T) {
+	tests := []struct {
+		in   ByteSize
+		want string
+	}{
+		{4 * GiB, "4GiB"},
+		{1536 * MiB, "1536MiB"},
+		{2 * TiB, "2TiB"},
+		{3 * KiB, "3KiB"},
+		{1000, "1000B"},
+	}
+	for _, tt := range tests {
+		if got := tt.in.String(); got != tt.want {
+			t.Errorf("ByteSize(%d).String() = %q, want %q", uint64(tt.in), got, tt.want)
+		}
+	}
+}
+
+func TestResourcesParse(t *testing.T) {
+	got, err := Resources{CPUs: 2, Memory: "8GB"}.Parse()
+	if err != nil {
+		t.Fatalf("Parse() failed: %v", err)
+	}
+	if want := (ResourceLimits{CPUs: 2, Memory: 8 * GiB}); got != want {
+		t.Errorf("Parse() = %+v, want %+v", got, want)
+	}
+
+	_, err = Resources{Disk: "lots"}.Parse()
+	if err == nil || !strings.HasPrefix(err.Error(), "resources.disk: ") {
+		t.Errorf("Parse() error = %v, want one naming resources.disk", err)
+	}
+	if _, err := (Resources{CPUs: -1}).Parse(); err == nil {
+		t.Error("Parse() with negative CPUs succeeded, want error")
+	}
+}
@@ -0,0 +1,189 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"reflect"
+)
+
+//go:generate go run genschema.go
+
+// File names of the generated schemas, which go generate writes to
+// docs/schema.
+const (
+	ProjectSchemaFilename = "choir.schema.json"
+	GlobalSchemaFilename  = "config.schema.json"
+)
+
+// schemaDialect is the JSON Schema version the generated schemas use.
+const schemaDialect = "https://json-schema.org/draft/2020-12/schema"
+
+// ProjectSchema returns a JSON Schema for .choir.yaml, generated from
+// ProjectConfig, for editor completion and validation in CI. It describes
+// the file's shape; config validate checks more, such as that from_file
+// paths exist.
+func ProjectSchema() ([]byte, error) {
+	return generateSchema(reflect.TypeOf(ProjectConfig{}), "choir project configuration (.choir.yaml)")
+}
+
+// GlobalSchema returns a JSON Schema for the global config, generated from
+// GlobalConfig like ProjectSchema.
+func GlobalSchema() ([]byte, error) {
+	return generateSchema(reflect.TypeOf(GlobalConfig{}), "choir global configuration (~/.config/choir/config.yaml)")
+}
+
+func generateSchema(t reflect.Type, title string) ([]byte, error) {
+	schema := typeSchema(t, "")
+	schema["$schema"] = schemaDialect
+	schema["title"] = title
+	data, err := json.MarshalIndent(schema, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate schema: %w", err)
+	}
+	return append(data, '\n'), nil
+}
+
+// Schemas for values that are strings in Go but have a fixed form.
+var (
+	sizeSchema = map[string]any{
+		"type":        "string",
+		"pattern":     sizePattern.String(),
+		"description": "A size with a binary unit, e.g., 8GB or 512MiB",
+	}
+	durationSchema = map[string]any{
+		"type":        "string",
+		"pattern":     `^([0-9]+d|([0-9]+(\.[0-9]+)?(ns|us|µs|ms|s|m|h))+|0)$`,
+		"description": `A duration such as "8h", "90m", or "2d"; "0" for none`,
+	}
+)
+
+// schemaTypes gives the schemas of config types whose YAML form doesn't
+// follow their fields.
+var schemaTypes = map[reflect.Type]map[string]any{
+	reflect.TypeOf(EnvVar{}): {
+		"oneOf": []any{
+			map[string]any{"type": "string"},
+			map[string]any{
+				"type":                 "object",
+				"properties":           map[string]any{"from_file": map[string]any{"type": "string", "description": "File the value is read from"}},
+				"required":             []string{"from_file"},
+				"additionalProperties": false,
+			},
+		},
+	},
+	reflect.TypeOf(CacheEntry{}): {
+		"oneOf": []any{
+			map[string]any{"type": "string", "description": "A preset cache name, e.g., npm"},
+			map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"name": map[string]any{"type": "string"},
+					"env":  map[string]any{"type": "string", "description": "Environment variable pointing to the cache"},
+				},
+				"required":             []string{"name", "env"},
+				"additionalProperties": false,
+			},
+		},
+	},
+	reflect.TypeOf(PortMapping{}): {
+		"oneOf": []any{
+			map[string]any{"type": "integer", "minimum": 1, "maximum": 65535},
+			map[string]any{"type": "string", "pattern": `^[0-9]+(:[0-9]+)?$`, "description": `A port, or "HOST:PORT"`},
+		},
+	},
+}
+
+// schemaKeys refines the schemas of keys, by dotted path, whose values are
+// constrained beyond their Go type or worth describing to editors. Paths
+// within maps and lists use "*" for the key or index.
+var schemaKeys = map[string]map[string]any{
+	"version":                         {"description": "Config format version (1)"},
+	"ttl":                             durationSchema,
+	"default_ttl":                     durationSchema,
+	"trash_retention":                 durationSchema,
+	"max_parallel_provisions":         {"description": "How many environments may be provisioned at once (default: 4)", "minimum": 0},
+	"profiles":                        {"description": `Named variants of this config, selected with "choir env create --profile"`},
+	"profiles.*.ttl":                  durationSchema,
+	"profiles.*.resources.memory":     sizeSchema,
+	"profiles.*.resources.disk":       sizeSchema,
+	"profiles.*.agent.prompt":         {"enum": []string{AgentPromptArg, AgentPromptStdin, AgentPromptNone}},
+	"profiles.*.tools.provisioner":    {"enum": []string{"mise", "asdf", "brew"}},
+	"resources.memory":                sizeSchema,
+	"resources.disk":                  sizeSchema,
+	"backends.*.memory":               sizeSchema,
+	"backends.*.disk":                 sizeSchema,
+	"backends.*.vm_type":              {"enum": []string{"vz", "qemu"}},
+	"agent.prompt":                    {"enum": []string{AgentPromptArg, AgentPromptStdin, AgentPromptNone}},
+	"tools.provisioner":               {"enum": []string{"mise", "asdf", "brew"}},
+	"naming.id_format":                {"enum": []string{"hex", "words"}},
+	"theme.mode":                      {"enum": []string{"color", "high-contrast", "symbols", "plain"}},
+	"hooks.*.events.*":                {"enum": []string{"ready", "failed", "removed"}},
+	"base_image":                      {"description": "Image VM and container backends start from"},
+	"packages":                        {"description": "System packages installed in the environment"},
+	"env":                             {"description": "Environment variables, as values or {from_file: path}"},
+	"files":                           {"description": "Files and directories copied into the workspace"},
+	"setup":                           {"description": "Commands run in the workspace after it's created"},
+	"setup_wrapper":                   {"description": `Command prefix setup runs through, e.g., "nix develop -c" (worktree backend)`},
+	"pre_destroy":                     {"description": "Commands run in the workspace before it's removed, to stop what setup started"},
+	"cache":                           {"description": "Package caches shared between environments"},
+	"ignore":                          {"description": "Patterns added to the workspace's git excludes"},
+	"sparse":                          {"description": "Directories worktrees check out, for monorepos (git sparse-checkout)"},
+	"branch_prefix":                   {"description": "Prefix of environment branch names, e.g., env/"},
+	"pool":                            {"description": "Environments kept provisioned for env create to take (default: 0)", "minimum": 0},
+	"agent":                           {"description": `Coding agent started by "choir env run-agent"`},
+	"ports":                           {"description": "Ports forwarded from VM and container workspaces"},
+	"network":                         {"description": "Network policy enforced by VM and container backends"},
+	"default_backend":                 {"description": "Backend used when --backend isn't given"},
+	"backends":                        {"description": "Backends by name"},
+	"mount_policy":                    {"description": "Host paths file mounts may or may not use"},
+	"hooks":                           {"description": "Commands or webhooks run when environments change state"},
+	"commit_trailer":                  {"description": "Add a Choir-Env trailer to commits in environments"},
+	"fetch_before_create":             {"description": "Fetch the remote and fast-forward the base branch before env create"},
+	"remote":                          {"description": "Git remote environments push to (default: origin)"},
+	"clone":                           {"description": "How repositories given to env create --repo as URLs are cloned"},
+	"clone.depth":                     {"description": "Commits of history to fetch per branch (default: all)", "minimum": 0},
+	"clone.filter":                    {"description": "Partial clone filter", "pattern": cloneFilterPattern.String()},
+	"usage_stats":                     {"description": `Record which commands run in the state database, for "choir stats"; nothing is sent anywhere`},
+	"files.*.allow_outside_workspace": {"description": "Permit a target outside the workspace"},
+}
+
+// typeSchema returns the schema for values of type t at path.
+func typeSchema(t reflect.Type, path string) map[string]any {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	var schema map[string]any
+	if s, ok := schemaTypes[t]; ok {
+		schema = maps.Clone(s)
+	} else {
+		switch t.Kind() {
+		case reflect.Struct:
+			props := make(map[string]any)
+			_, fields := yamlFields(t)
+			for name, ft := range fields {
+				props[name] = typeSchema(ft, joinKeyPath(path, name))
+			}
+			schema = map[string]any{"type": "object", "properties": props, "additionalProperties": openTypes[t]}
+		case reflect.Map:
+			schema = map[string]any{"type": "object", "additionalProperties": typeSchema(t.Elem(), joinKeyPath(path, "*"))}
+		case reflect.Slice:
+			schema = map[string]any{"type": "array", "items": typeSchema(t.Elem(), joinKeyPath(path, "*"))}
+		case reflect.Bool:
+			schema = map[string]any{"type": "boolean"}
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			schema = map[string]any{"type": "integer"}
+		case reflect.Float32, reflect.Float64:
+			schema = map[string]any{"type": "number"}
+		default:
+			schema = map[string]any{"type": "string"}
+		}
+	}
+
+	for k, v := range schemaKeys[path] {
+		schema[k] = v
+	}
+	return schema
+}
@@ -0,0 +1,77 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSchemas(t *testing.T) {
+	schemas := make(map[string]map[string]any)
+	for name, generate := range map[string]func() ([]byte, error){
+		ProjectSchemaFilename: ProjectSchema,
+		GlobalSchemaFilename:  GlobalSchema,
+	} {
+		data, err := generate()
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+
+		committed, err := os.ReadFile(filepath.Join("..", "..", "docs", "schema", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(data, committed) {
+			t.Errorf("docs/schema/%s is out of date; run go generate ./internal/config", name)
+		}
+
+		var schema map[string]any
+		if err := json.Unmarshal(data, &schema); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		schemas[name] = schema
+	}
+
+	project := schemas[ProjectSchemaFilename]
+	if got := schemaAt(project, "resources.memory")["pattern"]; got != sizePattern.String() {
+		t.Errorf("resources.memory pattern = %v, want %q", got, sizePattern.String())
+	}
+	if got := schemaAt(project, "env.*"); got["oneOf"] == nil {
+		t.Errorf("env values = %v, want string or from_file", got)
+	}
+	if schemaAt(schemas[GlobalSchemaFilename], "backends.*.vm_type")["enum"] == nil {
+		t.Error("backends.*.vm_type has no enum")
+	}
+
+	// Every refinement must still match a key, or a renamed field has
+	// silently lost it.
+	for path := range schemaKeys {
+		if schemaAt(project, path) == nil && schemaAt(schemas[GlobalSchemaFilename], path) == nil {
+			t.Errorf("schemaKeys path %q matches no key in either config", path)
+		}
+	}
+}
+
+// schemaAt returns the schema at a schemaKeys path in schema, or nil.
+func schemaAt(schema map[string]any, path string) map[string]any {
+	for _, key := range strings.Split(path, ".") {
+		var next any
+		switch {
+		case schema["items"] != nil && key == "*":
+			next = schema["items"]
+		case key == "*":
+			next = schema["additionalProperties"]
+		default:
+			props, _ := schema["properties"].(map[string]any)
+			next = props[key]
+		}
+		var ok bool
+		if schema, ok = next.(map[string]any); !ok {
+			return nil
+		}
+	}
+	return schema
+}
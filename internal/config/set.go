@@ -0,0 +1,218 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// SetKey sets key, in dot notation (e.g., backends.local.memory), to value in
+// global config YAML data and returns the updated YAML. Comments and the
+// order of existing keys are preserved; blank lines are not. value is
+// converted to the type of the setting: integers and booleans are checked,
+// and lists are given as comma-separated values. Missing sections are
+// created. Settings that are lists of sections, such as hooks, can't be set
+// this way.
+func SetKey(data []byte, key, value string) ([]byte, error) {
+	path := strings.Split(key, ".")
+	if slices.Contains(path, "") {
+		return nil, fmt.Errorf("invalid key %q", key)
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("invalid YAML: %w", err)
+	}
+	if doc.Kind == 0 {
+		doc.Kind = yaml.DocumentNode
+	}
+	if len(doc.Content) == 0 {
+		doc.Content = []*yaml.Node{{Kind: yaml.MappingNode}}
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("config is not a mapping of settings")
+	}
+
+	if err := setPath(root, reflect.TypeFor[GlobalConfig](), path, 1, value); err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(&doc); err != nil {
+		return nil, fmt.Errorf("failed to encode config: %w", err)
+	}
+	if err := enc.Close(); err != nil {
+		return nil, fmt.Errorf("failed to encode config: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// setPath sets path[n-1:] below node, a mapping whose values have the
+// Go type t. n counts the path elements consumed so far, for messages.
+func setPath(node *yaml.Node, t reflect.Type, path []string, n int, value string) error {
+	name := strings.Join(path[:n], ".")
+	key := path[n-1]
+
+	var child reflect.Type
+	switch t.Kind() {
+	case reflect.Struct:
+		field, ok := yamlField(t, key)
+		if !ok {
+			return fmt.Errorf("unknown key %q", name)
+		}
+		child = field.Type
+	case reflect.Map:
+		child = t.Elem()
+	default:
+		return fmt.Errorf("%s is not a section", strings.Join(path[:n-1], "."))
+	}
+
+	valueNode := mappingValue(node, key)
+	if n == len(path) {
+		leaf, err := valueNodeFor(child, name, value)
+		if err != nil {
+			return err
+		}
+		if valueNode == nil {
+			node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}, leaf)
+			return nil
+		}
+		leaf.HeadComment = valueNode.HeadComment
+		leaf.LineComment = valueNode.LineComment
+		leaf.FootComment = valueNode.FootComment
+		*valueNode = *leaf
+		return nil
+	}
+
+	if child.Kind() != reflect.Struct && child.Kind() != reflect.Map {
+		return fmt.Errorf("%s is a single value, not a section", name)
+	}
+	if valueNode == nil {
+		valueNode = &yaml.Node{Kind: yaml.MappingNode}
+		node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}, valueNode)
+	} else if valueNode.Kind == yaml.ScalarNode && valueNode.Tag == "!!null" {
+		// An empty section, e.g. "backends:" with nothing under it
+		valueNode.Kind, valueNode.Tag, valueNode.Value = yaml.MappingNode, "", ""
+	} else if valueNode.Kind != yaml.MappingNode {
+		return fmt.Errorf("%s in the config file is not a section", name)
+	}
+	return setPath(valueNode, child, path, n+1, value)
+}
+
+// valueNodeFor converts value to a YAML node for a setting of type t.
+func valueNodeFor(t reflect.Type, name, value string) (*yaml.Node, error) {
+	switch t.Kind() {
+	case reflect.String:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: value}, nil
+	case reflect.Int:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, fmt.Errorf("%s must be an integer, not %q", name, value)
+		}
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!int", Value: strconv.Itoa(n)}, nil
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("%s must be true or false, not %q", name, value)
+		}
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!bool", Value: strconv.FormatBool(b)}, nil
+	case reflect.Slice:
+		if t.Elem().Kind() != reflect.String {
+			return nil, fmt.Errorf("%s can't be set with config set; use config edit", name)
+		}
+		seq := &yaml.Node{Kind: yaml.SequenceNode, Style: yaml.FlowStyle}
+		for item := range strings.SplitSeq(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				seq.Content = append(seq.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: item})
+			}
+		}
+		return seq, nil
+	case reflect.Struct, reflect.Map:
+		return nil, fmt.Errorf("%s is a section; set one of its keys (e.g., %s.KEY)", name, name)
+	}
+	return nil, fmt.Errorf("%s can't be set with config set; use config edit", name)
+}
+
+// mappingValue returns the value node for key in a mapping node, or nil.
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// yamlField returns the field of struct type t with YAML name key.
+func yamlField(t reflect.Type, key string) (reflect.StructField, bool) {
+	for i := range t.NumField() {
+		if field := t.Field(i); yamlName(field) == key {
+			return field, true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+// yamlName returns the YAML key of a struct field, or "" if it has none.
+func yamlName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+	if name == "-" || !field.IsExported() {
+		return ""
+	}
+	if name == "" {
+		return strings.ToLower(field.Name)
+	}
+	return name
+}
+
+// SettableKeys returns the keys SetKey accepts for cfg, in dot notation, for
+// shell completion. Sections keyed by name (such as backends) contribute
+// the keys of the entries cfg already has.
+func SettableKeys(cfg GlobalConfig) []string {
+	var keys []string
+	collectKeys(reflect.ValueOf(cfg), "", &keys)
+	return keys
+}
+
+func collectKeys(v reflect.Value, prefix string, keys *[]string) {
+	switch v.Kind() {
+	case reflect.Struct:
+		for i := range v.NumField() {
+			if name := yamlName(v.Type().Field(i)); name != "" {
+				collectKeys(v.Field(i), joinKey(prefix, name), keys)
+			}
+		}
+		return
+	case reflect.Map:
+		names := make([]string, 0, v.Len())
+		for _, k := range v.MapKeys() {
+			names = append(names, k.String())
+		}
+		slices.Sort(names)
+		for _, name := range names {
+			collectKeys(v.MapIndex(reflect.ValueOf(name)), joinKey(prefix, name), keys)
+		}
+		return
+	case reflect.Slice:
+		if v.Type().Elem().Kind() != reflect.String {
+			return
+		}
+	}
+	*keys = append(*keys, prefix)
+}
+
+// joinKey appends name to a dot-notation key prefix.
+func joinKey(prefix, name string) string {
+	if prefix == "" {
+		return name
+	}
+	return prefix + "." + name
+}
@@ -0,0 +1,143 @@
+package config
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestSetKey(t *testing.T) {
+	const existing = `# choir config
+default_backend: local # the usual one
+
+backends:
+  local:
+    type: worktree
+    cpus: 4 # cores
+`
+
+	tests := []struct {
+		name  string
+		data  string
+		key   string
+		value string
+		want  string
+	}{
+		{
+			name:  "replace keeps comments",
+			data:  existing,
+			key:   "backends.local.cpus",
+			value: "8",
+			want: `# choir config
+default_backend: local # the usual one
+backends:
+  local:
+    type: worktree
+    cpus: 8 # cores
+`,
+		},
+		{
+			name:  "add to existing section",
+			data:  existing,
+			key:   "backends.local.memory",
+			value: "8GB",
+			want: `# choir config
+default_backend: local # the usual one
+backends:
+  local:
+    type: worktree
+    cpus: 4 # cores
+    memory: 8GB
+`,
+		},
+		{
+			name:  "create sections in empty file",
+			data:  "",
+			key:   "credentials.ssh_keys",
+			value: "~/.ssh/choir",
+			want: `credentials:
+  ssh_keys: ~/.ssh/choir
+`,
+		},
+		{
+			name:  "bool",
+			data:  "",
+			key:   "commit_trailer",
+			value: "1",
+			want:  "commit_trailer: true\n",
+		},
+		{
+			name:  "string that looks like a bool is quoted",
+			data:  "",
+			key:   "theme.symbols.ready",
+			value: "true",
+			want: `theme:
+  symbols:
+    ready: "true"
+`,
+		},
+		{
+			name:  "list",
+			data:  "",
+			key:   "mount_policy.deny",
+			value: "~/.aws, ~/.kube",
+			want: `mount_policy:
+  deny: [~/.aws, ~/.kube]
+`,
+		},
+		{
+			name:  "empty section",
+			data:  "backends:\n",
+			key:   "backends.dev.type",
+			value: "worktree",
+			want: `backends:
+  dev:
+    type: worktree
+`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := SetKey([]byte(tt.data), tt.key, tt.value)
+			if err != nil {
+				t.Fatalf("SetKey() failed: %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("SetKey() =\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetKeyErrors(t *testing.T) {
+	tests := []struct {
+		key, value, want string
+	}{
+		{"nope", "x", `unknown key "nope"`},
+		{"backends.local.ram", "8GB", `unknown key "backends.local.ram"`},
+		{"backends.local.cpus", "many", "must be an integer"},
+		{"commit_trailer", "maybe", "must be true or false"},
+		{"backends", "x", "is a section"},
+		{"shell.path", "x", "is a single value"},
+		{"hooks", "x", "use config edit"},
+		{"backends..type", "x", "invalid key"},
+	}
+	for _, tt := range tests {
+		_, err := SetKey(nil, tt.key, tt.value)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("SetKey(%q, %q) error = %v, want %q", tt.key, tt.value, err, tt.want)
+		}
+	}
+}
+
+func TestSettableKeys(t *testing.T) {
+	keys := SettableKeys(DefaultGlobalConfig())
+	for _, want := range []string{"default_backend", "credentials.ssh_keys", "backends.local.memory", "naming.id_format", "mount_policy.deny"} {
+		if !slices.Contains(keys, want) {
+			t.Errorf("SettableKeys() is missing %q", want)
+		}
+	}
+	if slices.Contains(keys, "hooks") {
+		t.Error("SettableKeys() includes hooks, which can't be set")
+	}
+}
@@ -0,0 +1,110 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"sync/atomic"
+
+	"gopkg.in/yaml.v3"
+)
+
+// lenient is set by SetStrict(false).
+var lenient atomic.Bool
+
+// SetStrict turns strict config parsing on or off for the rest of the
+// process, for the --no-strict-config flag. Strict parsing, the default,
+// rejects global and project config files with unknown keys, so a typo
+// like packges: isn't silently dropped. Otherwise unknown keys are
+// reported as warnings and ignored.
+func SetStrict(v bool) {
+	lenient.Store(!v)
+}
+
+// Strict reports whether config parsing is strict (see SetStrict).
+func Strict() bool {
+	return !lenient.Load()
+}
+
+// unmarshalConfig decodes config YAML read from path into out, a pointer to
+// a config struct, then checks it for unknown keys as SetStrict describes.
+// It does the job of yaml.v3's KnownFields, but finds every unknown key,
+// including those under types with custom unmarshaling, and suggests the
+// key that was probably meant.
+func unmarshalConfig(data []byte, path string, out any) error {
+	if err := yaml.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("invalid YAML in %s: %w", path, err)
+	}
+
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil || len(root.Content) == 0 {
+		return nil
+	}
+	var problems []Problem
+	checkKeys(root.Content[0], reflect.TypeOf(out).Elem(), "", &problems)
+	if len(problems) == 0 {
+		return nil
+	}
+
+	if !Strict() {
+		for _, p := range problems {
+			fmt.Fprintf(os.Stderr, "warning: %s (ignored)\n", p.Format(path))
+		}
+		return nil
+	}
+	if len(problems) == 1 {
+		return fmt.Errorf("%s (use --no-strict-config to ignore it)", problems[0].Format(path))
+	}
+	lines := make([]string, len(problems))
+	for i, p := range problems {
+		lines[i] = "  " + p.Format(path)
+	}
+	return fmt.Errorf("unknown keys in %s (use --no-strict-config to ignore them):\n%s", path, strings.Join(lines, "\n"))
+}
+
+// suggestKey returns the key in known that key is most likely a typo of,
+// or "" if none is close enough.
+func suggestKey(key string, known []string) string {
+	normalized := strings.ReplaceAll(strings.ToLower(key), "-", "_")
+	best, bestDist := "", 0
+	for _, k := range known {
+		if k == normalized {
+			return k
+		}
+		// Allow one edit in short keys, and one more per four characters
+		limit := 1 + len(k)/4
+		if d := editDistance(normalized, k); d <= limit && (best == "" || d < bestDist) {
+			best, bestDist = k, d
+		}
+	}
+	return best
+}
+
+// editDistance returns the Damerau-Levenshtein (optimal string alignment)
+// distance between a and b, counting a transposition of adjacent
+// characters as one edit.
+func editDistance(a, b string) int {
+	s, t := []rune(a), []rune(b)
+	prev2 := make([]int, len(t)+1)
+	prev := make([]int, len(t)+1)
+	cur := make([]int, len(t)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(s); i++ {
+		cur[0] = i
+		for j := 1; j <= len(t); j++ {
+			cost := 1
+			if s[i-1] == t[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+			if i > 1 && j > 1 && s[i-1] == t[j-2] && s[i-2] == t[j-1] {
+				cur[j] = min(cur[j], prev2[j-2]+1)
+			}
+		}
+		prev2, prev, cur = prev, cur, prev2
+	}
+	return prev[len(t)]
+}
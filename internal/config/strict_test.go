@@ -0,0 +1,68 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadProjectConfig_Strict(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ProjectConfigFilename)
+	content := `version: 1
+packges:
+  - python3
+env:
+  TOKEN:
+    from_fil: ~/.token
+`
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := LoadProjectConfig(path)
+	if err == nil {
+		t.Fatal("LoadProjectConfig() succeeded, want error for unknown keys")
+	}
+	for _, want := range []string{
+		path + ":2: unknown key packges (did you mean packages?)",
+		path + ":6: unknown key env.TOKEN.from_fil (did you mean from_file?)",
+		"--no-strict-config",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not contain %q", err, want)
+		}
+	}
+
+	SetStrict(false)
+	t.Cleanup(func() { SetStrict(true) })
+	cfg, err := LoadProjectConfig(path)
+	if err != nil {
+		t.Fatalf("LoadProjectConfig() with strict parsing off failed: %v", err)
+	}
+	if cfg.Version != 1 {
+		t.Errorf("Version = %d, want 1", cfg.Version)
+	}
+}
+
+func TestSuggestKey(t *testing.T) {
+	known := []string{"packages", "env", "files", "setup", "branch_prefix", "ttl", "from_file"}
+	tests := []struct {
+		key  string
+		want string
+	}{
+		{"packges", "packages"},
+		{"pakcages", "packages"},
+		{"branch-prefix", "branch_prefix"},
+		{"Setup", "setup"},
+		{"ttk", "ttl"},
+		{"from_fil", "from_file"},
+		{"enviroment", ""},
+		{"resources", ""},
+	}
+	for _, tt := range tests {
+		if got := suggestKey(tt.key, known); got != tt.want {
+			t.Errorf("suggestKey(%q) = %q, want %q", tt.key, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,206 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ErrTemplateNotFound is returned by LoadTemplate when no template has the
+// given name.
+var ErrTemplateNotFound = errors.New("template not found")
+
+// templateNameRe matches valid template names, which are used as file names.
+var templateNameRe = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// Template is a named, reusable environment setup captured from an existing
+// environment with `choir env template create`. When an environment is
+// created with --template, each setting the template sets replaces the
+// project config's, and its backend is used unless --backend is given.
+type Template struct {
+	Backend    string            `yaml:"backend,omitempty"`
+	Tools      *ToolsConfig      `yaml:"tools,omitempty"`
+	Env        map[string]EnvVar `yaml:"env,omitempty"`
+	Files      []FileMount       `yaml:"files,omitempty"` // Sources are absolute
+	Setup      []string          `yaml:"setup,omitempty"`
+	PreDestroy []string          `yaml:"pre_destroy,omitempty"`
+	Cache      []CacheEntry      `yaml:"cache,omitempty"`
+	Submodules bool              `yaml:"submodules,omitempty"`
+	Ignore     []string          `yaml:"ignore,omitempty"`
+}
+
+// TemplateFromProject captures project's setup as a template for backend.
+// Relative file mount sources are resolved against projectDir so the
+// template works from any repository.
+func TemplateFromProject(project ProjectConfig, projectDir, backend string) (Template, error) {
+	t := Template{
+		Backend:    backend,
+		Env:        project.Env,
+		Setup:      project.Setup,
+		PreDestroy: project.PreDestroy,
+		Cache:      project.Cache,
+		Submodules: project.Submodules,
+		Ignore:     project.Ignore,
+	}
+	if project.Tools.Provisioner != "" {
+		t.Tools = &project.Tools
+	}
+	if project.Files != nil {
+		files, err := ExpandFileMounts(project.Files, projectDir)
+		if err != nil {
+			return Template{}, fmt.Errorf("failed to expand file mounts: %w", err)
+		}
+		t.Files = files
+	}
+	return t, nil
+}
+
+// apply returns project with the template's settings in place of its own.
+func (t Template) apply(project ProjectConfig) ProjectConfig {
+	if t.Tools != nil {
+		project.Tools = *t.Tools
+	}
+	if t.Env != nil {
+		project.Env = t.Env
+	}
+	if t.Files != nil {
+		project.Files = t.Files
+	}
+	if t.Setup != nil {
+		project.Setup = t.Setup
+	}
+	// The project's teardown undoes the project's setup, not the template's
+	if t.Setup != nil || t.PreDestroy != nil {
+		project.PreDestroy = t.PreDestroy
+	}
+	if t.Cache != nil {
+		project.Cache = t.Cache
+	}
+	if t.Submodules {
+		project.Submodules = true
+	}
+	if t.Ignore != nil {
+		project.Ignore = t.Ignore
+	}
+	return project
+}
+
+// TemplatesDir returns the directory templates are stored in:
+// ~/.config/choir/templates.
+func TemplatesDir() (string, error) {
+	configPath, err := GlobalConfigPath()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(filepath.Dir(configPath), "templates"), nil
+}
+
+// templatePath returns the file the named template is stored in.
+func templatePath(name string) (string, error) {
+	if !templateNameRe.MatchString(name) {
+		return "", fmt.Errorf("invalid template name %q: use letters, digits, '.', '_', and '-'", name)
+	}
+	dir, err := TemplatesDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, name+".yaml"), nil
+}
+
+// LoadTemplate loads the named template. Returns an error wrapping
+// ErrTemplateNotFound if it doesn't exist.
+func LoadTemplate(name string) (Template, error) {
+	path, err := templatePath(name)
+	if err != nil {
+		return Template{}, err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return Template{}, fmt.Errorf("%w: %s", ErrTemplateNotFound, name)
+	}
+	if err != nil {
+		return Template{}, fmt.Errorf("failed to read template: %w", err)
+	}
+
+	var t Template
+	if err := yaml.Unmarshal(data, &t); err != nil {
+		return Template{}, fmt.Errorf("invalid YAML in %s: %w", path, err)
+	}
+	return t, nil
+}
+
+// WriteTemplate saves t under name, replacing any template of that name.
+func WriteTemplate(name string, t Template) error {
+	path, err := templatePath(name)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create templates directory: %w", err)
+	}
+
+	data, err := yaml.Marshal(t)
+	if err != nil {
+		return fmt.Errorf("failed to marshal template: %w", err)
+	}
+	// Env values may be secrets, as in the global config
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return fmt.Errorf("failed to write template: %w", err)
+	}
+	return nil
+}
+
+// TemplateExists reports whether a template named name exists.
+func TemplateExists(name string) bool {
+	path, err := templatePath(name)
+	if err != nil {
+		return false
+	}
+	_, err = os.Stat(path)
+	return err == nil
+}
+
+// DeleteTemplate removes the named template. Returns an error wrapping
+// ErrTemplateNotFound if it doesn't exist.
+func DeleteTemplate(name string) error {
+	path, err := templatePath(name)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("%w: %s", ErrTemplateNotFound, name)
+	} else if err != nil {
+		return fmt.Errorf("failed to delete template: %w", err)
+	}
+	return nil
+}
+
+// ListTemplates returns the names of all templates, sorted.
+func ListTemplates() ([]string, error) {
+	dir, err := TemplatesDir()
+	if err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to list templates: %w", err)
+	}
+
+	var names []string
+	for _, e := range entries {
+		if name, ok := strings.CutSuffix(e.Name(), ".yaml"); ok && !e.IsDir() && templateNameRe.MatchString(name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
@@ -0,0 +1,82 @@
+package config
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestTemplateRoundTrip(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+
+	project := DefaultProjectConfig()
+	project.Env = map[string]EnvVar{
+		"NODE_ENV": {Value: "development"},
+		"TOKEN":    {FromFile: "~/.token"},
+	}
+	project.Files = []FileMount{{Source: ".env.local", Target: ".env"}}
+	project.Setup = []string{"npm ci"}
+	project.Cache = []CacheEntry{{Name: "npm"}}
+
+	tmpl, err := TemplateFromProject(project, "/src/app", "local")
+	if err != nil {
+		t.Fatalf("TemplateFromProject() failed: %v", err)
+	}
+	if got := tmpl.Files[0].Source; got != filepath.FromSlash("/src/app/.env.local") {
+		t.Errorf("file source = %q, want it resolved against the project dir", got)
+	}
+
+	if err := WriteTemplate("node", tmpl); err != nil {
+		t.Fatalf("WriteTemplate() failed: %v", err)
+	}
+	got, err := LoadTemplate("node")
+	if err != nil {
+		t.Fatalf("LoadTemplate() failed: %v", err)
+	}
+	if !reflect.DeepEqual(got, tmpl) {
+		t.Errorf("LoadTemplate() = %+v, want %+v", got, tmpl)
+	}
+
+	names, err := ListTemplates()
+	if err != nil || !reflect.DeepEqual(names, []string{"node"}) {
+		t.Errorf("ListTemplates() = %v, %v; want [node]", names, err)
+	}
+
+	if err := DeleteTemplate("node"); err != nil {
+		t.Fatalf("DeleteTemplate() failed: %v", err)
+	}
+	if _, err := LoadTemplate("node"); !errors.Is(err, ErrTemplateNotFound) {
+		t.Errorf("LoadTemplate() after delete = %v, want ErrTemplateNotFound", err)
+	}
+	if err := WriteTemplate("../escape", tmpl); err == nil {
+		t.Error("WriteTemplate() accepted a name with a path separator")
+	}
+}
+
+func TestMergeTemplate(t *testing.T) {
+	global := DefaultGlobalConfig()
+	global.Backends["remote"] = Backend{Type: "worktree"}
+
+	project := DefaultProjectConfig()
+	project.Setup = []string{"make"}
+	project.BranchPrefix = "feature/"
+	tmpl := &Template{Backend: "remote", Setup: []string{"npm ci"}}
+
+	merged, err := Merge(global, project, FlagOverrides{Template: tmpl}, "")
+	if err != nil {
+		t.Fatalf("Merge() failed: %v", err)
+	}
+	if merged.Backend != "remote" || !reflect.DeepEqual(merged.Setup, []string{"npm ci"}) {
+		t.Errorf("merged backend %q, setup %v; want the template's", merged.Backend, merged.Setup)
+	}
+	if merged.BranchPrefix != "feature/" {
+		t.Errorf("BranchPrefix = %q, want the project's", merged.BranchPrefix)
+	}
+
+	// --backend still wins over the template
+	merged, err = Merge(global, project, FlagOverrides{Backend: "local", Template: tmpl}, "")
+	if err != nil || merged.Backend != "local" {
+		t.Errorf("Merge() with --backend = %q, %v; want local", merged.Backend, err)
+	}
+}
@@ -11,6 +11,88 @@ version: 1
 # Default backend when --backend flag not specified
 default_backend: local
 
+# Shell used for attach, exec, and setup commands (default: $SHELL)
+# Must be an absolute path. Can also be set per backend.
+# shell: /bin/bash
+
+# Restrict which host paths .choir.yaml may copy into environments.
+# ~/.ssh, ~/.gnupg, ~/.netrc, and ~/.config/choir are always denied
+# unless allowed here. Only the global config can change this policy.
+# mount_policy:
+#   allow:
+#     - ~/.ssh/known_hosts
+#   deny:
+#     - ~/.aws
+
+# External command that allocates environment IDs and branch names,
+# e.g. to reserve them in an internal registry (default: random IDs).
+# naming:
+#   command: ~/bin/choir-naming
+#
+# Or change the format of generated IDs: hex (default) or words (e.g.,
+# brave-otter-3f9c), and how much of a hex ID is shown (default: 12).
+# naming:
+#   id_format: words
+#   short_id_length: 8
+
+# Default lifetime of new environments; "choir gc" removes expired ones.
+# Accepts durations like 8h or 2d (default: never expire).
+# default_ttl: 7d
+
+# How long "choir env rm" keeps removed environments in the trash, where
+# "choir env restore" can bring them back, before "choir gc" purges them.
+# 0 destroys them at once (default: 7d).
+# trash_retention: 14d
+
+# How many environments are provisioned at once, across terminals and
+# "env create --detach"; more wait their turn (default: 4).
+# max_parallel_provisions: 8
+
+# Fetch the remote and fast-forward the base branch before each env create,
+# as --fetch does, so environments don't start from stale code.
+# fetch_before_create: true
+
+# Hooks run when an environment becomes ready, fails, or is removed.
+# Commands get the event as JSON on stdin and CHOIR_EVENT, CHOIR_ENV_ID,
+# CHOIR_BRANCH, CHOIR_REPO, and CHOIR_STATUS in their environment; webhooks
+# receive the JSON in a POST (its "text" field suits Slack incoming webhooks).
+# hooks:
+#   - events: [ready, failed]
+#     url: https://hooks.slack.com/services/...
+#   - command: notify-send "choir" "$CHOIR_ENV_ID is $CHOIR_EVENT"
+
+# Git identity set in each new environment, so commits made there are
+# attributable separately from your own. Projects can override it.
+# git_identity:
+#   name: Choir Agent
+#   email: agent@example.com
+#   signing_key: ABCD1234   # also enables commit signing
+
+# How "choir env create --repo URL" clones heavy repositories: fetch only
+# recent history, and file contents only as they're checked out.
+# clone:
+#   depth: 1
+#   filter: blob:none
+
+# Stamp commits made in environments with a "Choir-Env: <id>" trailer so
+# "choir env find-commit SHA" can map them back to their environment.
+# commit_trailer: true
+
+# Count the choir commands you run, for "choir stats". The counts stay in
+# the local state database; choir never sends them anywhere.
+# usage_stats: true
+
+# Status colors and symbols in "choir env list". Modes: color (default),
+# high-contrast (bold colors that don't rely on red/green, plus symbols),
+# symbols (no color), or plain. Colors are only used on a terminal and are
+# disabled by NO_COLOR.
+# theme:
+#   mode: high-contrast
+#   colors:
+#     ready: bold cyan
+#   symbols:
+#     failed: "x"
+
 # Credential paths (defaults shown)
 credentials:
   claude_config: ~/.claude
@@ -56,6 +138,17 @@ version: 1
 #   - python3-pip
 #   - redis-tools
 
+# Language-level tools installed on the host by a version manager,
+# for backends that can't install packages (worktree)
+# Provisioners: mise, asdf, brew (brew bundle)
+# Without install, the repository's own tool file is used
+# (.mise.toml, .tool-versions, or Brewfile)
+# tools:
+#   provisioner: mise
+#   install:
+#     - node@20
+#     - python@3.12
+
 # Environment variables
 # env:
 #   # Literal value
@@ -76,6 +169,11 @@ version: 1
 #
 #   - source: .env.local
 #     target: /home/ubuntu/workspace/.env.local
+#
+#   # Targets outside the workspace are rejected unless allowed
+#   - source: ~/.config/tool/defaults.json
+#     target: /home/ubuntu/.config/tool/defaults.json
+#     allow_outside_workspace: true
 
 # Commands to run after clone, before agent is ready
 # Working directory: repository root
@@ -84,6 +182,58 @@ version: 1
 #   - docker compose up -d
 #   - npm install
 
+# Run tool installs and setup commands through a sandboxed shell, such as a
+# nix flake's dev shell or devbox. Each command runs as
+# "<wrapper> $SHELL -c '<command>'". Worktree backend only.
+# setup_wrapper: nix develop -c
+
+# Commands to run in the workspace before it is removed, to stop what setup
+# started. Failures are reported but don't stop the removal.
+# pre_destroy:
+#   - docker compose down
+
+# Initialize git submodules (recursively) in new environments
+# submodules: true
+
+# In a monorepo, check out only these directories (plus the files at the
+# root) with git sparse-checkout, for smaller, faster worktrees
+# sparse:
+#   - services/api
+#   - libs/shared
+
+# Patterns added to the git excludes (.git/info/exclude) of new environments,
+# so build output and agent scratch files don't show up as untracked changes
+# ignore:
+#   - build/
+#   - .agent-scratch/
+
+# Package caches shared between environments (~/.cache/choir/<name>)
+# Presets: npm, yarn, pnpm, pip, uv, go
+# cache:
+#   - npm
+#   - pip
+#
+#   # Custom cache: env names the variable that points to the directory
+#   - name: gradle
+#     env: GRADLE_USER_HOME
+
+# Git identity for commits made in environments, overriding the global
+# git_identity field by field
+# git_identity:
+#   name: Project Bot
+#   email: bot@example.com
+
+# Environment lifetime, overriding the global default_ttl (e.g., 8h, 2d, 0)
+# ttl: 2d
+
+# Environments kept provisioned so env create can take one instead of
+# waiting for setup; refilled in the background
+# pool: 2
+
+# Fetch and fast-forward the base branch before each env create, even if
+# the global config doesn't
+# fetch_before_create: true
+
 # Resource overrides (optional)
 # resources:
 #   memory: 8GB
@@ -0,0 +1,52 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ParseTTL parses an environment lifetime. It accepts Go durations
+// (e.g., "8h", "90m") plus a "d" suffix for whole days (e.g., "2d").
+// An empty string or "0" means no expiry and returns zero.
+func ParseTTL(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	if s == "" || s == "0" {
+		return 0, nil
+	}
+
+	var d time.Duration
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %q", s)
+		}
+		d = time.Duration(n) * 24 * time.Hour
+	} else {
+		var err error
+		d, err = time.ParseDuration(s)
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %q", s)
+		}
+	}
+
+	if d < 0 {
+		return 0, fmt.Errorf("duration %q must not be negative", s)
+	}
+	return d, nil
+}
+
+// DefaultTrashRetention is how long "choir env rm" keeps removed
+// environments in the trash when trash_retention isn't set.
+const DefaultTrashRetention = 7 * 24 * time.Hour
+
+// ParseTrashRetention parses the trash_retention setting, a duration as
+// for ParseTTL. An empty string means DefaultTrashRetention, and "0" turns
+// the trash off, so removed environments are destroyed at once.
+func ParseTrashRetention(s string) (time.Duration, error) {
+	if strings.TrimSpace(s) == "" {
+		return DefaultTrashRetention, nil
+	}
+	return ParseTTL(s)
+}
@@ -1,16 +1,130 @@
 package config
 
 import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
 	"gopkg.in/yaml.v3"
 )
 
 // GlobalConfig represents the global configuration loaded from
 // ~/.config/choir/config.yaml
 type GlobalConfig struct {
-	Version        int                `yaml:"version"`
-	DefaultBackend string             `yaml:"default_backend"`
-	Credentials    CredentialsConfig  `yaml:"credentials"`
-	Backends       map[string]Backend `yaml:"backends"`
+	Version               int                `yaml:"version"`
+	DefaultBackend        string             `yaml:"default_backend"`
+	Credentials           CredentialsConfig  `yaml:"credentials"`
+	Backends              map[string]Backend `yaml:"backends"`
+	Shell                 string             `yaml:"shell"` // Default shell for all backends (default: $SHELL)
+	MountPolicy           MountPolicy        `yaml:"mount_policy"`
+	Naming                NamingConfig       `yaml:"naming"`
+	DefaultTTL            string             `yaml:"default_ttl"` // Default environment lifetime (e.g., "8h", "2d")
+	Hooks                 []HookConfig       `yaml:"hooks,omitempty"`
+	GitIdentity           GitIdentity        `yaml:"git_identity,omitempty"`
+	CommitTrailer         bool               `yaml:"commit_trailer,omitempty"` // Add a Choir-Env trailer to commits in environments
+	Theme                 ThemeConfig        `yaml:"theme,omitempty"`
+	Remote                string             `yaml:"remote,omitempty"`                  // Git remote environments push to and record (default: origin)
+	Clone                 CloneConfig        `yaml:"clone,omitempty"`                   // How repositories given as --repo URLs are cloned
+	UsageStats            bool               `yaml:"usage_stats,omitempty"`             // Record which commands run, for "choir stats"
+	TrashRetention        string             `yaml:"trash_retention,omitempty"`         // How long "env rm" keeps environments restorable (default: 7d; 0 disables)
+	MaxParallelProvisions int                `yaml:"max_parallel_provisions,omitempty"` // How many environments are provisioned at once (default: 4)
+	FetchBeforeCreate     bool               `yaml:"fetch_before_create,omitempty"`     // Fetch and fast-forward the base branch before env create
+}
+
+// DefaultMaxParallelProvisions is how many environments are provisioned at
+// once when max_parallel_provisions isn't set.
+const DefaultMaxParallelProvisions = 4
+
+// ProvisionLimit returns how many environments may be provisioned at once.
+func (c GlobalConfig) ProvisionLimit() int {
+	if c.MaxParallelProvisions > 0 {
+		return c.MaxParallelProvisions
+	}
+	return DefaultMaxParallelProvisions
+}
+
+// CloneConfig makes heavy repositories fast to set up by fetching less when
+// choir clones a repository given to env create --repo as a URL. Existing
+// clones are left as they are. Worktrees of a partial clone fetch the
+// objects they need on demand.
+type CloneConfig struct {
+	Depth  int    `yaml:"depth,omitempty"`  // Commits of history to fetch per branch (default: all)
+	Filter string `yaml:"filter,omitempty"` // Partial clone filter: blob:none, blob:limit=<size>, or tree:<depth>
+}
+
+// cloneFilterPattern matches the partial clone filters git accepts that
+// make sense for a working repository.
+var cloneFilterPattern = regexp.MustCompile(`^(blob:none|blob:limit=[0-9]+[kmg]?|tree:[0-9]+)$`)
+
+// Validate checks that the depth isn't negative and the filter is one git
+// accepts.
+func (c CloneConfig) Validate() error {
+	if c.Depth < 0 {
+		return fmt.Errorf("clone: depth must not be negative")
+	}
+	if c.Filter != "" && !cloneFilterPattern.MatchString(c.Filter) {
+		return fmt.Errorf("clone: unknown filter %q (want blob:none, blob:limit=<size>, or tree:<depth>)", c.Filter)
+	}
+	return nil
+}
+
+// ThemeConfig controls how environment statuses are drawn in list output
+// (see package theme). Colors and Symbols override the mode's defaults per
+// status, e.g., colors: {ready: "bold cyan"}, symbols: {failed: "x"}.
+type ThemeConfig struct {
+	Mode    string            `yaml:"mode,omitempty"` // color (default), high-contrast, symbols, or plain
+	Colors  map[string]string `yaml:"colors,omitempty"`
+	Symbols map[string]string `yaml:"symbols,omitempty"`
+}
+
+// GitIdentity is the git author identity set in new environments, so
+// commits made there (e.g., by agents) are distinguishable from the user's
+// own. Empty fields leave the user's configuration in effect.
+type GitIdentity struct {
+	Name       string `yaml:"name,omitempty"`        // user.name
+	Email      string `yaml:"email,omitempty"`       // user.email
+	SigningKey string `yaml:"signing_key,omitempty"` // user.signingkey; also turns on commit.gpgsign
+}
+
+// IsZero reports whether no identity fields are set.
+func (g GitIdentity) IsZero() bool {
+	return g == GitIdentity{}
+}
+
+// HookConfig runs a command or posts to a webhook when an environment
+// changes state (see package hooks). Exactly one of Command and URL is set.
+type HookConfig struct {
+	Events  []string `yaml:"events,omitempty"`  // ready, failed, removed (default: all)
+	Command string   `yaml:"command,omitempty"` // Shell command given the event as JSON on stdin
+	URL     string   `yaml:"url,omitempty"`     // Webhook the event is POSTed to as JSON
+}
+
+// NamingConfig selects how environment IDs and branch names are allocated.
+type NamingConfig struct {
+	// Command is an executable that reserves and releases names
+	// (see package naming). If empty, random IDs are generated.
+	Command string `yaml:"command"`
+
+	// IDFormat is the format of generated IDs: hex (the default) or words
+	// (e.g., brave-otter-3f9c). Ignored when Command is set.
+	IDFormat string `yaml:"id_format,omitempty"`
+
+	// IDLength is the length of generated hex IDs (default 32).
+	IDLength int `yaml:"id_length,omitempty"`
+
+	// ShortIDLength is how many characters of a hex ID are displayed and
+	// used in default branch names (default 12).
+	ShortIDLength int `yaml:"short_id_length,omitempty"`
+}
+
+// MountPolicy restricts which host paths project configs may use as file
+// mount sources. It is read only from the global config, so a project config
+// cannot loosen it.
+type MountPolicy struct {
+	Allow []string `yaml:"allow"` // Paths permitted even if denied
+	Deny  []string `yaml:"deny"`  // Paths denied in addition to DefaultDeniedMountSources
 }
 
 // CredentialsConfig defines paths to credential files/directories.
@@ -28,19 +142,207 @@ type Backend struct {
 	Memory string `yaml:"memory"`
 	Disk   string `yaml:"disk"`
 	VMType string `yaml:"vm_type"` // Lima-specific: vz or qemu
+	Shell  string `yaml:"shell"`   // Overrides the global shell for this backend
 }
 
 // ProjectConfig represents the project configuration loaded from
 // .choir.yaml in the repository root.
 type ProjectConfig struct {
-	Version      int               `yaml:"version"`
-	BaseImage    string            `yaml:"base_image"`
-	Packages     []string          `yaml:"packages"`
-	Env          map[string]EnvVar `yaml:"env"`
-	Files        []FileMount       `yaml:"files"`
-	Setup        []string          `yaml:"setup"`
-	Resources    Resources         `yaml:"resources"`
-	BranchPrefix string            `yaml:"branch_prefix"`
+	Version       int                `yaml:"version"`
+	BaseImage     string             `yaml:"base_image"`
+	Packages      []string           `yaml:"packages"`
+	Tools         ToolsConfig        `yaml:"tools"`
+	Env           map[string]EnvVar  `yaml:"env"`
+	Files         []FileMount        `yaml:"files"`
+	Setup         []string           `yaml:"setup"`
+	SetupWrapper  string             `yaml:"setup_wrapper,omitempty"` // Runs setup commands in a sandbox, e.g., "nix develop -c"
+	PreDestroy    []string           `yaml:"pre_destroy,omitempty"`   // Run in the workspace before it is removed
+	Cache         []CacheEntry       `yaml:"cache"`
+	Submodules    bool               `yaml:"submodules"`
+	Sparse        []string           `yaml:"sparse,omitempty"` // Directories worktrees check out (git sparse-checkout)
+	Ignore        []string           `yaml:"ignore,omitempty"` // Patterns added to the workspace's git excludes
+	Resources     Resources          `yaml:"resources"`
+	BranchPrefix  string             `yaml:"branch_prefix"`
+	TTL           string             `yaml:"ttl"`                      // Overrides the global default_ttl
+	GitIdentity   GitIdentity        `yaml:"git_identity,omitempty"`   // Overrides the global git_identity field by field
+	CommitTrailer bool               `yaml:"commit_trailer,omitempty"` // Enables the trailer even if the global config doesn't
+	Remote        string             `yaml:"remote,omitempty"`         // Overrides the global remote
+	Agent         AgentConfig        `yaml:"agent,omitempty"`          // Started by "choir env run-agent"
+	Ports         []PortMapping      `yaml:"ports,omitempty"`          // Forwarded from VM and container workspaces
+	Network       NetworkPolicy      `yaml:"network,omitempty"`        // Enforced by VM and container backends
+	Profiles      map[string]Profile `yaml:"profiles,omitempty"`       // Selected with "choir env create --profile"
+	Pool          int                `yaml:"pool,omitempty"`           // Environments kept ready for env create to take
+
+	FetchBeforeCreate bool `yaml:"fetch_before_create,omitempty"` // Enables fetching even if the global config doesn't
+}
+
+// NetworkPolicy restricts what a workspace can reach on the network, to
+// keep an agent from exfiltrating code or fetching what it shouldn't. Only
+// backends that isolate workspaces can enforce it; the others refuse to
+// create an environment with a policy rather than ignore it.
+//
+// Domains match themselves and their subdomains; "*.example.com" matches
+// only the subdomains.
+type NetworkPolicy struct {
+	Offline bool     `yaml:"offline,omitempty"` // No network access at all
+	Allow   []string `yaml:"allow,omitempty"`   // Only these domains are reachable
+	Deny    []string `yaml:"deny,omitempty"`    // These domains are unreachable
+}
+
+// IsZero reports whether the policy leaves the network unrestricted.
+func (n NetworkPolicy) IsZero() bool {
+	return !n.Offline && len(n.Allow) == 0 && len(n.Deny) == 0
+}
+
+// Validate checks that the policy is consistent and its domains are well
+// formed.
+func (n NetworkPolicy) Validate() error {
+	if n.Offline && (len(n.Allow) > 0 || len(n.Deny) > 0) {
+		return fmt.Errorf("network: offline can't be combined with allow or deny")
+	}
+	if len(n.Allow) > 0 && len(n.Deny) > 0 {
+		return fmt.Errorf("network: use either allow (deny everything else) or deny (allow everything else), not both")
+	}
+	for _, list := range []struct {
+		key     string
+		domains []string
+	}{{"allow", n.Allow}, {"deny", n.Deny}} {
+		for _, d := range list.domains {
+			if !validDomain(d) {
+				return fmt.Errorf("network: %s: invalid domain %q", list.key, d)
+			}
+		}
+	}
+	return nil
+}
+
+// validDomain reports whether d is a domain name, optionally starting with
+// a "*." wildcard.
+func validDomain(d string) bool {
+	d = strings.TrimPrefix(d, "*.")
+	if d == "" || len(d) > 253 {
+		return false
+	}
+	for _, label := range strings.Split(d, ".") {
+		if label == "" || len(label) > 63 || strings.HasPrefix(label, "-") || strings.HasSuffix(label, "-") {
+			return false
+		}
+		for _, r := range label {
+			if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-') {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// PortMapping is a port in a workspace forwarded to a port on the host,
+// written as "3000" (the same port on both) or "8080:3000" (host:workspace).
+type PortMapping struct {
+	Host  int // Port on the host; the same as Guest if zero
+	Guest int // Port in the workspace
+}
+
+// ParsePortMapping parses a port mapping written as "GUEST" or
+// "HOST:GUEST".
+func ParsePortMapping(s string) (PortMapping, error) {
+	hostStr, guestStr, hasHost := strings.Cut(strings.TrimSpace(s), ":")
+	if !hasHost {
+		hostStr, guestStr = "", hostStr
+	}
+	var p PortMapping
+	var err error
+	if p.Guest, err = parsePort(guestStr); err != nil {
+		return PortMapping{}, fmt.Errorf("invalid port %q: %w", s, err)
+	}
+	if hasHost {
+		if p.Host, err = parsePort(hostStr); err != nil {
+			return PortMapping{}, fmt.Errorf("invalid port %q: %w", s, err)
+		}
+	}
+	return p, nil
+}
+
+func parsePort(s string) (int, error) {
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 1 || n > 65535 {
+		return 0, fmt.Errorf("ports are numbers from 1 to 65535")
+	}
+	return n, nil
+}
+
+// HostPort returns the port on the host.
+func (p PortMapping) HostPort() int {
+	if p.Host == 0 {
+		return p.Guest
+	}
+	return p.Host
+}
+
+// String returns the mapping as ParsePortMapping accepts it.
+func (p PortMapping) String() string {
+	if p.Host == 0 || p.Host == p.Guest {
+		return strconv.Itoa(p.Guest)
+	}
+	return fmt.Sprintf("%d:%d", p.Host, p.Guest)
+}
+
+// UnmarshalYAML implements custom unmarshaling for PortMapping to handle
+// both plain port numbers and "HOST:GUEST" strings.
+func (p *PortMapping) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind != yaml.ScalarNode {
+		return fmt.Errorf("line %d: port must be a number or \"HOST:GUEST\"", value.Line)
+	}
+	mapping, err := ParsePortMapping(value.Value)
+	if err != nil {
+		return fmt.Errorf("line %d: %w", value.Line, err)
+	}
+	*p = mapping
+	return nil
+}
+
+// MarshalYAML implements custom marshaling for PortMapping, writing the
+// form ParsePortMapping accepts.
+func (p PortMapping) MarshalYAML() (any, error) {
+	if p.Host == 0 || p.Host == p.Guest {
+		return p.Guest, nil
+	}
+	return p.String(), nil
+}
+
+// Ways AgentConfig.Prompt passes an environment's task to the agent.
+const (
+	AgentPromptArg   = "arg"   // As the last argument (the default)
+	AgentPromptStdin = "stdin" // On standard input
+	AgentPromptNone  = "none"  // Only in $CHOIR_TASK
+)
+
+// AgentConfig is the coding agent "choir env run-agent" starts in an
+// environment, e.g., command: "claude" or command: "aider --yes".
+type AgentConfig struct {
+	Command string            `yaml:"command,omitempty"` // Shell command line
+	Prompt  string            `yaml:"prompt,omitempty"`  // arg (default), stdin, or none
+	Env     map[string]string `yaml:"env,omitempty"`     // Added to the environment's variables
+}
+
+// Validate checks that the agent config is usable.
+func (a AgentConfig) Validate() error {
+	if strings.TrimSpace(a.Command) == "" {
+		return fmt.Errorf("agent: command is required")
+	}
+	switch a.Prompt {
+	case "", AgentPromptArg, AgentPromptStdin, AgentPromptNone:
+		return nil
+	}
+	return fmt.Errorf("agent: unknown prompt %q (want %s, %s, or %s)", a.Prompt, AgentPromptArg, AgentPromptStdin, AgentPromptNone)
+}
+
+// ToolsConfig installs language-level tools (node, python, go, ...) with a
+// version manager on the host, for backends such as worktree that can't
+// install system packages.
+type ToolsConfig struct {
+	Provisioner string   `yaml:"provisioner,omitempty"` // mise, asdf, or brew
+	Install     []string `yaml:"install,omitempty"`     // Tools as name@version; default: the repo's tool file
 }
 
 // EnvVar represents an environment variable value.
@@ -71,11 +373,45 @@ func (e *EnvVar) UnmarshalYAML(value *yaml.Node) error {
 	return nil
 }
 
+// MarshalYAML implements custom marshaling for EnvVar, writing literal
+// values as plain strings and file references as {from_file: path}.
+func (e EnvVar) MarshalYAML() (any, error) {
+	if e.FromFile != "" {
+		return map[string]string{"from_file": e.FromFile}, nil
+	}
+	return e.Value, nil
+}
+
+// CacheEntry selects a package cache to share between environments.
+// It can be either a preset name (e.g., "npm") or a {name, env} object
+// naming a custom cache and the environment variable that points to it.
+type CacheEntry struct {
+	Name string `yaml:"name"`
+	Env  string `yaml:"env"` // Custom caches only; presets know their variables
+}
+
+// UnmarshalYAML implements custom unmarshaling for CacheEntry to handle
+// both preset names and {name, env} objects.
+func (c *CacheEntry) UnmarshalYAML(value *yaml.Node) error {
+	var name string
+	if err := value.Decode(&name); err == nil {
+		c.Name = name
+		return nil
+	}
+
+	type plain CacheEntry
+	return value.Decode((*plain)(c))
+}
+
 // FileMount represents a file or directory to copy into the VM.
 type FileMount struct {
 	Source   string `yaml:"source"`
 	Target   string `yaml:"target"`
 	ReadOnly bool   `yaml:"readonly"`
+
+	// AllowOutsideWorkspace permits a target that resolves outside the
+	// workspace. Setup runners reject such targets otherwise.
+	AllowOutsideWorkspace bool `yaml:"allow_outside_workspace,omitempty"`
 }
 
 // Resources represents resource allocation overrides.
@@ -92,19 +428,59 @@ type MergedConfig struct {
 	Backend     string
 	BackendType string
 
+	// Shell (backend setting → global setting)
+	Shell string
+
 	// Credentials (from global config)
 	Credentials CredentialsConfig
 
+	// MountPolicy (from global config, paths expanded)
+	MountPolicy MountPolicy
+
+	// Naming (from global config)
+	Naming NamingConfig
+
 	// Resources (merged from all sources)
 	Resources Resources
 
+	// TTL is how long new environments live before gc removes them
+	// (global default_ttl → project ttl). Zero means no expiry.
+	TTL time.Duration
+
+	// Remote is the git remote environments push to and record the URL
+	// of (global remote → project remote → --remote). Empty means origin.
+	Remote string
+
 	// Project-specific settings
 	BaseImage    string
 	Packages     []string
+	Tools        ToolsConfig
 	Env          map[string]string // Expanded environment variables
+	SecretEnv    map[string]bool   // Env keys whose values were read from_file
 	Files        []FileMount
 	Setup        []string
+	SetupWrapper string
+	PreDestroy   []string
+	Cache        []CacheEntry
+	Submodules   bool
+	Sparse       []string
+	Ignore       []string
 	BranchPrefix string
+	Ports        []PortMapping
+	Network      NetworkPolicy
+
+	// GitIdentity (global → project, field by field)
+	GitIdentity GitIdentity
+
+	// CommitTrailer (enabled by either global or project)
+	CommitTrailer bool
+
+	// FetchBeforeCreate (enabled by either global or project)
+	FetchBeforeCreate bool
+
+	// Pool is how many environments to keep provisioned in the
+	// repository's warm pool (project pool). Zero means none.
+	Pool int
 }
 
 // RepositoryInfo contains information about the git repository.
@@ -112,7 +488,11 @@ type RepositoryInfo struct {
 	// Path is the absolute path to the repository root.
 	Path string
 
-	// RemoteURL is the URL of the origin remote.
+	// Remote is the name of the git remote RemoteURL is from, e.g.,
+	// "origin". May be empty if no remote is configured.
+	Remote string
+
+	// RemoteURL is the URL of Remote.
 	// May be empty if no remote is configured.
 	RemoteURL string
 
@@ -135,9 +515,18 @@ type RepositoryInfo struct {
 //	| Environment      | ✓ Used (export)  | ✓ Used           |
 //	| Files            | ✓ Used (symlink) | ✓ Used           |
 //	| Packages         | Warn if present  | ✓ Used           |
+//	| Tools            | ✓ Used (on host) | ✓ Used           |
 //	| SetupCommands    | ✓ Used (on host) | ✓ Used           |
+//	| Cache            | ✓ Used (env var) | ✓ Used (mount)   |
+//	| Submodules       | ✓ Used           | ✓ Used           |
+//	| Sparse           | ✓ Used           | ✓ Used           |
+//	| Ignore           | ✓ Used           | ✓ Used           |
+//	| GitIdentity      | ✓ Used           | ✓ Used           |
+//	| CommitTrailer    | ✓ Used           | ✓ Used           |
+//	| SetupWrapper     | ✓ Used           | Refused          |
+//	| TaskFile         | ✓ Used           | ✓ Used           |
 type CreateConfig struct {
-	// ID is the unique identifier for this environment (32 hex chars).
+	// ID is the unique identifier for this environment (see state.ValidID).
 	ID string
 
 	// Backend is the name of the backend to use (e.g., "local").
@@ -146,9 +535,9 @@ type CreateConfig struct {
 	// BackendType is the type of backend (e.g., "lima", "worktree").
 	BackendType string
 
-	// Resources contains resource allocation settings.
+	// Resources contains resource allocation settings, parsed.
 	// Worktree backend ignores these (no VM).
-	Resources Resources
+	Resources ResourceLimits
 
 	// Credentials contains paths to credential files/directories.
 	// Worktree backend ignores these (uses host credentials).
@@ -165,6 +554,14 @@ type CreateConfig struct {
 	// Worktree backend warns if present.
 	Packages []string
 
+	// Image is the ID of a base image with BaseImage and Packages baked in
+	// (see backend.ImageBaker), for backends that clone workspaces from
+	// one. Empty for other backends.
+	Image string
+
+	// Tools are language-level tools installed by a version manager.
+	Tools ToolsConfig
+
 	// Environment contains expanded environment variables to set.
 	Environment map[string]string
 
@@ -174,8 +571,62 @@ type CreateConfig struct {
 	// SetupCommands are commands to run after environment setup.
 	SetupCommands []string
 
+	// PreDestroy are commands to run in the workspace before it is
+	// destroyed, to stop what setup started (e.g., docker compose down).
+	PreDestroy []string
+
+	// Cache lists package caches shared between environments.
+	Cache []CacheEntry
+
+	// Submodules initializes git submodules (recursively) in the workspace.
+	Submodules bool
+
+	// Sparse, if set, limits the workspace's checkout to these directories
+	// (and the files at the repository root) with git sparse-checkout in
+	// cone mode. Paths are relative to the repository root.
+	Sparse []string
+
+	// Ignore lists gitignore patterns added to the workspace's git excludes,
+	// so generated files don't show up as untracked changes.
+	Ignore []string
+
+	// GitIdentity is the git author identity configured in the workspace.
+	GitIdentity GitIdentity
+
+	// CommitTrailer stamps commits made in the workspace with a Choir-Env
+	// trailer naming the environment.
+	CommitTrailer bool
+
+	// SetupWrapper, if set, is a command prefix, such as "nix develop -c"
+	// or "devbox run --", that tool installs and setup commands are run
+	// through, so they get the sandboxed shell's dependencies. Only
+	// backends that report the SetupWrapper capability honor it.
+	SetupWrapper string
+
+	// Ports are workspace ports forwarded to the host once the workspace is
+	// ready. Worktree backend warns if present (worktrees share the host's
+	// network).
+	Ports []PortMapping
+
+	// Network restricts the workspace's network access. Only backends that
+	// report the NetworkPolicy capability enforce it; the others refuse it.
+	Network NetworkPolicy
+
+	// TaskFile, if set, is written to TASK.md in the workspace: the task
+	// the environment was created for (env create --task-md).
+	TaskFile string
+
 	// BranchPrefix is the prefix for environment branch names (default: "env/").
 	BranchPrefix string
+
+	// BranchName is the full branch name for the environment. If empty,
+	// backends use BranchPrefix followed by the short ID.
+	BranchName string
+
+	// ExistingBranch means BranchName already exists and is checked out
+	// as it is, rather than created from the base branch (env create
+	// --from-branch).
+	ExistingBranch bool
 }
 
 // DefaultGlobalConfig returns a GlobalConfig with sensible defaults.
@@ -0,0 +1,424 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/Quidge/choir/internal/pathutil"
+	"gopkg.in/yaml.v3"
+)
+
+// Problem is a mistake in a config file, found by ValidateProjectConfig or
+// ValidateGlobalConfig.
+type Problem struct {
+	Line    int    // 1-based line in the file; zero if not tied to a line
+	Message string // What is wrong, e.g., "unknown key packges"
+}
+
+// Format formats the problem for a config file at path, as path:line:
+// message.
+func (p Problem) Format(path string) string {
+	if p.Line == 0 {
+		return fmt.Sprintf("%s: %s", path, p.Message)
+	}
+	return fmt.Sprintf("%s:%d: %s", path, p.Line, p.Message)
+}
+
+// ValidateProjectConfig checks project config YAML more thoroughly than
+// LoadProjectConfig does, reporting every problem rather than the first:
+// syntax errors, unknown keys, values of the wrong type, and settings that
+// would only fail once an environment is created, such as from_file paths
+// and mount sources that don't exist. Problems are sorted by line.
+func ValidateProjectConfig(data []byte) []Problem {
+	var cfg ProjectConfig
+	root, problems := decodeForValidation(data, &cfg)
+	if root == nil {
+		return problems
+	}
+
+	add := func(err error, path ...string) {
+		if err != nil {
+			problems = append(problems, Problem{Line: lineOf(root, path...), Message: err.Error()})
+		}
+	}
+
+	if _, err := ParseTTL(cfg.TTL); err != nil {
+		add(fmt.Errorf("ttl: %w", err), "ttl")
+	}
+	if cfg.BranchPrefix != "" {
+		add(checkBranchPrefix(cfg.BranchPrefix), "branch_prefix")
+	}
+	if cfg.Pool < 0 {
+		add(fmt.Errorf("pool: must not be negative, got %d", cfg.Pool), "pool")
+	}
+	for _, name := range slices.Sorted(maps.Keys(cfg.Env)) {
+		v := cfg.Env[name]
+		if v.FromFile == "" {
+			continue
+		}
+		path, err := ExpandPath(v.FromFile)
+		if err == nil {
+			_, err = os.Stat(path)
+		}
+		if err != nil {
+			add(fmt.Errorf("env %s: from_file %s: %w", name, v.FromFile, unwrapPathError(err)), "env", name)
+		}
+	}
+	for i, f := range cfg.Files {
+		add(checkFileMount(f), "files", strconv.Itoa(i))
+	}
+	add(checkSize("resources.memory", cfg.Resources.Memory), "resources", "memory")
+	add(checkSize("resources.disk", cfg.Resources.Disk), "resources", "disk")
+	if cfg.Agent.Command != "" || cfg.Agent.Prompt != "" || len(cfg.Agent.Env) > 0 {
+		add(cfg.Agent.Validate(), "agent")
+	}
+	add(cfg.Network.Validate(), "network")
+	add(ValidateSparse(cfg.Sparse), "sparse")
+
+	for _, name := range cfg.ProfileNames() {
+		pr := cfg.Profiles[name]
+		addProfile := func(err error, path ...string) {
+			if err != nil {
+				add(fmt.Errorf("profiles.%s: %w", name, err), append([]string{"profiles", name}, path...)...)
+			}
+		}
+		if _, err := ParseTTL(pr.TTL); err != nil {
+			addProfile(fmt.Errorf("ttl: %w", err), "ttl")
+		}
+		if pr.BranchPrefix != "" {
+			addProfile(checkBranchPrefix(pr.BranchPrefix), "branch_prefix")
+		}
+		for i, f := range pr.Files {
+			addProfile(checkFileMount(f), "files", strconv.Itoa(i))
+		}
+		addProfile(checkSize("resources.memory", pr.Resources.Memory), "resources", "memory")
+		addProfile(checkSize("resources.disk", pr.Resources.Disk), "resources", "disk")
+		if pr.Agent != nil {
+			addProfile(pr.Agent.Validate(), "agent")
+		}
+		if pr.Network != nil {
+			addProfile(pr.Network.Validate(), "network")
+		}
+		addProfile(ValidateSparse(pr.Sparse), "sparse")
+	}
+
+	sortProblems(problems)
+	return problems
+}
+
+// ValidateGlobalConfig checks global config YAML as ValidateProjectConfig
+// checks project config, including the backend settings LoadGlobalConfig
+// checks. Settings interpreted by other packages, such as naming and hooks,
+// are left to them.
+func ValidateGlobalConfig(data []byte) []Problem {
+	var cfg GlobalConfig
+	root, problems := decodeForValidation(data, &cfg)
+	if root == nil {
+		return problems
+	}
+
+	add := func(err error, path ...string) {
+		if err != nil {
+			problems = append(problems, Problem{Line: lineOf(root, path...), Message: err.Error()})
+		}
+	}
+
+	if err := validateBackendSettings(data); err != nil {
+		for _, e := range unjoin(err) {
+			add(e, "backends")
+		}
+	}
+	for _, name := range slices.Sorted(maps.Keys(cfg.Backends)) {
+		b := cfg.Backends[name]
+		add(checkSize("backends."+name+".memory", b.Memory), "backends", name, "memory")
+		add(checkSize("backends."+name+".disk", b.Disk), "backends", name, "disk")
+	}
+	if _, err := ParseTTL(cfg.DefaultTTL); err != nil {
+		add(fmt.Errorf("default_ttl: %w", err), "default_ttl")
+	}
+	if _, err := ParseTrashRetention(cfg.TrashRetention); err != nil {
+		add(fmt.Errorf("trash_retention: %w", err), "trash_retention")
+	}
+	if cfg.MaxParallelProvisions < 0 {
+		add(fmt.Errorf("max_parallel_provisions: must not be negative, got %d", cfg.MaxParallelProvisions), "max_parallel_provisions")
+	}
+	add(cfg.Clone.Validate(), "clone")
+
+	sortProblems(problems)
+	return problems
+}
+
+// decodeForValidation parses data into a node tree and decodes it into
+// out, returning the tree and problems with the YAML itself: syntax errors,
+// unknown keys, and values of the wrong type. The tree is nil if the YAML
+// doesn't parse, in which case there's nothing more to check.
+func decodeForValidation(data []byte, out any) (*yaml.Node, []Problem) {
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return nil, yamlProblems(err)
+	}
+	if len(root.Content) == 0 {
+		return &root, nil // Empty file
+	}
+
+	var problems []Problem
+	checkKeys(root.Content[0], reflect.TypeOf(out).Elem(), "", &problems)
+	if err := root.Decode(out); err != nil {
+		problems = append(problems, yamlProblems(err)...)
+	}
+	return &root, problems
+}
+
+// yamlLinePattern matches the line number yaml.v3 puts in error messages.
+var yamlLinePattern = regexp.MustCompile(`^(?:yaml: )?line (\d+): (.*)$`)
+
+// yamlProblems converts a yaml.v3 error, which may list several problems,
+// into Problems.
+func yamlProblems(err error) []Problem {
+	var msgs []string
+	var typeErr *yaml.TypeError
+	if errors.As(err, &typeErr) {
+		msgs = typeErr.Errors
+	} else {
+		msgs = []string{err.Error()}
+	}
+
+	problems := make([]Problem, 0, len(msgs))
+	for _, msg := range msgs {
+		p := Problem{Message: strings.TrimPrefix(msg, "yaml: ")}
+		if m := yamlLinePattern.FindStringSubmatch(msg); m != nil {
+			p.Line, _ = strconv.Atoi(m[1])
+			p.Message = m[2]
+		}
+		problems = append(problems, p)
+	}
+	return problems
+}
+
+// objectKeys lists the keys accepted by the mapping form of config types
+// whose YAML form doesn't follow their fields.
+var objectKeys = map[reflect.Type][]string{
+	reflect.TypeOf(EnvVar{}): {"from_file"},
+}
+
+// openTypes are config types whose keys checkKeys leaves to other checks.
+// A backend's settings depend on its type, and are checked against the
+// schema it registers (see validateBackendSettings).
+var openTypes = map[reflect.Type]bool{
+	reflect.TypeOf(Backend{}): true,
+}
+
+// checkKeys reports keys in node that type t doesn't have, recursing into
+// nested structs, maps, and lists. path is the dotted path to node, for
+// messages.
+func checkKeys(node *yaml.Node, t reflect.Type, path string, problems *[]Problem) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if openTypes[t] {
+		return
+	}
+	if node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		if node.Kind != yaml.MappingNode {
+			return
+		}
+		known, fields := yamlFields(t)
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			if !slices.Contains(known, key.Value) {
+				*problems = append(*problems, Problem{Line: key.Line, Message: unknownKeyMessage(path, key.Value, known)})
+				continue
+			}
+			if ft, ok := fields[key.Value]; ok {
+				checkKeys(value, ft, joinKeyPath(path, key.Value), problems)
+			}
+		}
+	case reflect.Map:
+		if node.Kind != yaml.MappingNode {
+			return
+		}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			checkKeys(node.Content[i+1], t.Elem(), joinKeyPath(path, node.Content[i].Value), problems)
+		}
+	case reflect.Slice:
+		if node.Kind != yaml.SequenceNode {
+			return
+		}
+		for i, item := range node.Content {
+			checkKeys(item, t.Elem(), fmt.Sprintf("%s[%d]", path, i), problems)
+		}
+	}
+}
+
+// yamlFields returns the YAML keys struct type t accepts, and the types of
+// those to recurse into.
+func yamlFields(t reflect.Type) ([]string, map[string]reflect.Type) {
+	if keys, ok := objectKeys[t]; ok {
+		return keys, nil
+	}
+	var known []string
+	fields := make(map[string]reflect.Type)
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(f.Tag.Get("yaml"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(f.Name)
+		}
+		known = append(known, name)
+		fields[name] = f.Type
+	}
+	return known, fields
+}
+
+// unknownKeyMessage describes an unknown key found at path, where known
+// are the keys accepted, suggesting the one probably meant.
+func unknownKeyMessage(path, key string, known []string) string {
+	msg := fmt.Sprintf("unknown key %s", joinKeyPath(path, key))
+	if suggestion := suggestKey(key, known); suggestion != "" {
+		msg += fmt.Sprintf(" (did you mean %s?)", suggestion)
+	}
+	return msg
+}
+
+func joinKeyPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// lineOf returns the line of the node at path in root, following mapping
+// keys and sequence indexes, or of the deepest node found along the way.
+// It returns zero for an empty document.
+func lineOf(root *yaml.Node, path ...string) int {
+	if len(root.Content) == 0 {
+		return 0
+	}
+	node := root.Content[0]
+	line := 0
+	for _, key := range path {
+		var next *yaml.Node
+		switch node.Kind {
+		case yaml.MappingNode:
+			for i := 0; i+1 < len(node.Content); i += 2 {
+				if node.Content[i].Value == key {
+					line = node.Content[i].Line
+					next = node.Content[i+1]
+					break
+				}
+			}
+		case yaml.SequenceNode:
+			if i, err := strconv.Atoi(key); err == nil && i < len(node.Content) {
+				next = node.Content[i]
+				line = next.Line
+			}
+		}
+		if next == nil {
+			break
+		}
+		node = next
+	}
+	return line
+}
+
+// checkBranchPrefix reports a branch prefix that can't start a valid git
+// branch name (see git-check-ref-format).
+func checkBranchPrefix(prefix string) error {
+	bad := func(why string) error {
+		return fmt.Errorf("branch_prefix %q: %s", prefix, why)
+	}
+	switch {
+	case strings.HasPrefix(prefix, "/") || strings.HasPrefix(prefix, "-"):
+		return bad("must not start with / or -")
+	case strings.Contains(prefix, ".."), strings.Contains(prefix, "//"), strings.Contains(prefix, "@{"):
+		return bad("must not contain .., //, or @{")
+	case strings.ContainsAny(prefix, " ~^:?*[\\"):
+		return bad(`must not contain spaces or any of ~^:?*[\`)
+	}
+	for _, r := range prefix {
+		if r < 0x20 || r == 0x7f {
+			return bad("must not contain control characters")
+		}
+	}
+	for _, part := range strings.Split(prefix, "/") {
+		if strings.HasPrefix(part, ".") || strings.HasSuffix(part, ".lock") {
+			return bad("path components must not start with . or end with .lock")
+		}
+	}
+	return nil
+}
+
+// checkSize reports a memory or disk size ParseByteSize doesn't accept. An
+// empty size means the default and is fine.
+func checkSize(key, size string) error {
+	if size == "" {
+		return nil
+	}
+	if _, err := ParseByteSize(size); err != nil {
+		return fmt.Errorf("%s: %w", key, err)
+	}
+	return nil
+}
+
+// checkFileMount reports a file mount whose source doesn't exist or whose
+// target is missing or escapes the workspace without allowing it.
+func checkFileMount(f FileMount) error {
+	if f.Target == "" {
+		return fmt.Errorf("files: %s: target is required", f.Source)
+	}
+	// Checked in the host's style here; backend.Validate checks it again
+	// in the workspace's
+	if !f.AllowOutsideWorkspace && pathutil.HostStyle().Escapes(f.Target) {
+		return fmt.Errorf("files: target %s is outside the workspace (set allow_outside_workspace to permit it)", f.Target)
+	}
+	source, err := ExpandPath(f.Source)
+	if err == nil {
+		_, err = os.Stat(source)
+	}
+	if err != nil {
+		return fmt.Errorf("files: source %s: %w", f.Source, unwrapPathError(err))
+	}
+	return nil
+}
+
+// unwrapPathError drops the path from an *fs.PathError, which the caller
+// already names.
+func unwrapPathError(err error) error {
+	var pathErr *os.PathError
+	if errors.As(err, &pathErr) {
+		return pathErr.Err
+	}
+	return err
+}
+
+// unjoin returns the errors joined in err, or err alone.
+func unjoin(err error) []error {
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		return joined.Unwrap()
+	}
+	return []error{err}
+}
+
+func sortProblems(problems []Problem) {
+	slices.SortStableFunc(problems, func(a, b Problem) int {
+		return a.Line - b.Line
+	})
+}
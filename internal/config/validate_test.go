@@ -0,0 +1,154 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestValidateProjectConfig(t *testing.T) {
+	dir := t.TempDir()
+	secret := filepath.Join(dir, "secret")
+	if err := os.WriteFile(secret, []byte("s3cret"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("valid", func(t *testing.T) {
+		data := `version: 1
+env:
+  NODE_ENV: development
+  API_KEY:
+    from_file: ` + secret + `
+files:
+  - source: ` + dir + `
+    target: config
+resources:
+  memory: 8GB
+branch_prefix: agent/
+ttl: 2d
+ports: [3000]
+`
+		if problems := ValidateProjectConfig([]byte(data)); len(problems) != 0 {
+			t.Errorf("ValidateProjectConfig() = %v, want no problems", problems)
+		}
+	})
+
+	t.Run("empty", func(t *testing.T) {
+		if problems := ValidateProjectConfig(nil); len(problems) != 0 {
+			t.Errorf("ValidateProjectConfig() = %v, want no problems", problems)
+		}
+	})
+
+	t.Run("syntax error", func(t *testing.T) {
+		problems := ValidateProjectConfig([]byte("version: 1\nsetup: [npm install\n"))
+		if len(problems) != 1 || problems[0].Line == 0 {
+			t.Errorf("ValidateProjectConfig() = %v, want one problem with a line", problems)
+		}
+	})
+
+	t.Run("profiles", func(t *testing.T) {
+		data := `version: 1
+profiles:
+  gpu:
+    resources:
+      memory: 32 gigs
+    pakages: [cuda]
+`
+		want := []Problem{
+			{Line: 5, Message: `profiles.gpu: resources.memory: invalid size "32 gigs" (use a number and a unit, e.g., 8GB or 512MiB)`},
+			{Line: 6, Message: "unknown key profiles.gpu.pakages (did you mean packages?)"},
+		}
+		if problems := ValidateProjectConfig([]byte(data)); !reflect.DeepEqual(problems, want) {
+			t.Errorf("ValidateProjectConfig() = %v, want %v", problems, want)
+		}
+	})
+
+	t.Run("every problem reported", func(t *testing.T) {
+		data := `version: 1
+packges:
+  - python3
+env:
+  API_KEY:
+    from_file: ` + filepath.Join(dir, "missing") + `
+    from_fle: x
+files:
+  - source: ` + dir + `
+    target: ../outside
+resources:
+  memory: lots
+  cpus: many
+branch_prefix: "agent..x/"
+ttl: 3x
+pool: -1
+`
+		want := map[int]string{
+			2:  "unknown key packges",
+			5:  "from_file",
+			7:  "unknown key env.API_KEY.from_fle",
+			9:  "outside the workspace",
+			12: `invalid size "lots"`,
+			13: "cannot unmarshal",
+			14: "branch_prefix",
+			15: "ttl",
+			16: "pool: must not be negative",
+		}
+		problems := ValidateProjectConfig([]byte(data))
+		got := make(map[int]string)
+		for _, p := range problems {
+			got[p.Line] = p.Message
+		}
+		for line, substr := range want {
+			if !strings.Contains(got[line], substr) {
+				t.Errorf("line %d: problem %q, want one mentioning %q", line, got[line], substr)
+			}
+		}
+		if len(problems) != len(want) {
+			t.Errorf("ValidateProjectConfig() returned %d problems, want %d: %v", len(problems), len(want), problems)
+		}
+	})
+}
+
+func TestValidateGlobalConfig(t *testing.T) {
+	data := `version: 1
+backends:
+  local:
+    type: lima
+    memory: lots
+    disk: 50GB
+theme:
+  mode: color
+  colours: {}
+default_ttl: soon
+max_parallel_provisions: -1
+`
+	problems := ValidateGlobalConfig([]byte(data))
+	want := []Problem{
+		{Line: 5, Message: `backends.local.memory: invalid size "lots" (use a number and a unit, e.g., 8GB or 512MiB)`},
+		{Line: 9, Message: "unknown key theme.colours (did you mean colors?)"},
+		{Line: 10, Message: `default_ttl: invalid duration "soon"`},
+		{Line: 11, Message: "max_parallel_provisions: must not be negative, got -1"},
+	}
+	if len(problems) != len(want) {
+		t.Fatalf("ValidateGlobalConfig() = %v, want %v", problems, want)
+	}
+	for i := range want {
+		if problems[i] != want[i] {
+			t.Errorf("problem %d = %+v, want %+v", i, problems[i], want[i])
+		}
+	}
+}
+
+func TestCheckBranchPrefix(t *testing.T) {
+	for _, prefix := range []string{"env/", "agent/", "team/bot-", "x"} {
+		if err := checkBranchPrefix(prefix); err != nil {
+			t.Errorf("checkBranchPrefix(%q) = %v, want nil", prefix, err)
+		}
+	}
+	for _, prefix := range []string{"/env", "-env/", "a..b/", "a b/", "a:b/", "a//b", ".hidden/", "x.lock/", "a@{b"} {
+		if err := checkBranchPrefix(prefix); err == nil {
+			t.Errorf("checkBranchPrefix(%q) succeeded, want error", prefix)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package daemon
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/Quidge/choir/internal/state"
+)
+
+// Client talks to a running daemon over its unix socket.
+type Client struct {
+	http *http.Client
+}
+
+// Dial connects to the daemon at socket path and verifies it is answering.
+// Returns an error wrapping ErrNotRunning if it is not.
+func Dial(path string) (*Client, error) {
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", path)
+		},
+	}
+	c := &Client{http: &http.Client{Transport: transport, Timeout: 30 * time.Second}}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := c.do(ctx, http.MethodGet, "/v1/health", nil); err != nil {
+		c.Close()
+		return nil, fmt.Errorf("%w: %v", ErrNotRunning, err)
+	}
+	return c, nil
+}
+
+// Close releases the client's idle connections.
+func (c *Client) Close() {
+	c.http.CloseIdleConnections()
+}
+
+// ListEnvironments lists environments matching opts, like
+// state.DB.ListEnvironments.
+func (c *Client) ListEnvironments(ctx context.Context, opts state.ListOptions) ([]*state.Environment, error) {
+	q := url.Values{}
+	if opts.Backend != "" {
+		q.Set("backend", opts.Backend)
+	}
+	if opts.RepoPath != "" {
+		q.Set("repo", opts.RepoPath)
+	}
+	for _, st := range opts.Statuses {
+		q.Add("status", string(st))
+	}
+	if opts.Sort != "" {
+		q.Set("sort", string(opts.Sort))
+	}
+	if opts.Limit > 0 {
+		q.Set("limit", strconv.Itoa(opts.Limit))
+	}
+	if opts.Offset > 0 {
+		q.Set("offset", strconv.Itoa(opts.Offset))
+	}
+
+	var out []state.SnapshotEnvironment
+	if err := c.do(ctx, http.MethodGet, "/v1/environments?"+q.Encode(), &out); err != nil {
+		return nil, err
+	}
+	envs := make([]*state.Environment, 0, len(out))
+	for _, se := range out {
+		envs = append(envs, se.Environment())
+	}
+	return envs, nil
+}
+
+// Reconcile asks the daemon to run its reconciliation tasks now.
+func (c *Client) Reconcile(ctx context.Context) error {
+	return c.do(ctx, http.MethodPost, "/v1/reconcile", nil)
+}
+
+// do sends a request to the daemon and decodes a JSON response into out
+// (if non-nil).
+func (c *Client) do(ctx context.Context, method, path string, out any) error {
+	// The host is ignored; requests always go to the socket
+	req, err := http.NewRequestWithContext(ctx, method, "http://choir"+path, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		return readError(resp)
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("daemon: invalid response: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,310 @@
+// Package daemon implements choir's optional background process. The daemon
+// runs reconciliation tasks (backend status polling, TTL cleanup) on an
+// interval and serves a small HTTP API on a unix socket, which the CLI can
+// use instead of opening the state database itself.
+//
+// API (all responses are JSON):
+//
+//	GET    /v1/health                  daemon liveness
+//	GET    /v1/environments            list environments (?backend=, ?repo=, ?status= repeated,
+//	                                   ?sort=, ?limit=, ?offset=)
+//	GET    /v1/environments/{id}       get one environment by ID or unique prefix
+//	POST   /v1/reconcile               run reconciliation tasks now
+//	GET    /metrics                    operation metrics in the Prometheus text format
+//
+// When the Server has Operations (as under "choir serve"), it also serves:
+//
+//	POST   /v1/environments            create an environment (CreateRequest)
+//	DELETE /v1/environments/{id}       remove an environment
+//	POST   /v1/environments/{id}/exec  run a command (ExecRequest → ExecResponse)
+package daemon
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Quidge/choir/internal/metrics"
+	"github.com/Quidge/choir/internal/resolve"
+	"github.com/Quidge/choir/internal/state"
+)
+
+// EnvUseDaemon is the environment variable that makes CLI commands query a
+// running daemon instead of the state database when set to a true value.
+const EnvUseDaemon = "CHOIR_DAEMON"
+
+// DefaultInterval is how often the daemon reconciles by default.
+const DefaultInterval = time.Minute
+
+var (
+	// ErrAlreadyRunning is returned by Listen when another daemon is
+	// serving on the socket.
+	ErrAlreadyRunning = errors.New("daemon already running")
+
+	// ErrNotRunning is returned by Dial when no daemon answers on the socket.
+	ErrNotRunning = errors.New("daemon not running")
+)
+
+// SocketPath returns the default daemon socket path:
+// $XDG_RUNTIME_DIR/choir/daemon.sock, or the state database directory
+// (~/.local/share/choir/daemon.sock) if XDG_RUNTIME_DIR is unset.
+func SocketPath() (string, error) {
+	if runtimeDir := os.Getenv("XDG_RUNTIME_DIR"); runtimeDir != "" {
+		return filepath.Join(runtimeDir, "choir", "daemon.sock"), nil
+	}
+	dbPath, err := state.DefaultDBPath()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(filepath.Dir(dbPath), "daemon.sock"), nil
+}
+
+// Enabled reports whether EnvUseDaemon asks the CLI to use the daemon.
+func Enabled() bool {
+	switch os.Getenv(EnvUseDaemon) {
+	case "1", "true", "yes":
+		return true
+	}
+	return false
+}
+
+// Task is a named reconciliation step run on every interval.
+type Task struct {
+	Name string
+	Run  func(ctx context.Context) error
+}
+
+// Server runs reconciliation tasks and serves the daemon API.
+type Server struct {
+	// DB is the state database the API reads from.
+	DB *state.DB
+
+	// Interval is the time between reconciliations (default DefaultInterval).
+	Interval time.Duration
+
+	// Tasks run in order on each reconciliation.
+	Tasks []Task
+
+	// Logger receives task failures. If nil, log.Default() is used.
+	Logger *log.Logger
+
+	// Ops, if set, enables the API endpoints that change environments.
+	Ops Operations
+
+	mu sync.Mutex // serializes reconciliations
+}
+
+// Reconcile runs every task once, in order. A failing task is logged and
+// does not stop later tasks; the failures are returned joined.
+func (s *Server) Reconcile(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var errs []error
+	for _, t := range s.Tasks {
+		if err := t.Run(ctx); err != nil {
+			s.logger().Printf("%s: %v", t.Name, err)
+			errs = append(errs, fmt.Errorf("%s: %w", t.Name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Serve reconciles immediately and then every Interval, and serves the API
+// on ln until ctx is cancelled.
+func (s *Server) Serve(ctx context.Context, ln net.Listener) error {
+	interval := s.Interval
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+
+	srv := &http.Server{
+		Handler:           s.Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- srv.Serve(ln)
+	}()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	_ = s.Reconcile(ctx)
+	for {
+		select {
+		case err := <-errCh:
+			return fmt.Errorf("daemon server failed: %w", err)
+		case <-ticker.C:
+			_ = s.Reconcile(ctx)
+		case <-ctx.Done():
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := srv.Shutdown(shutdownCtx); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				return fmt.Errorf("failed to shut down daemon server: %w", err)
+			}
+			return nil
+		}
+	}
+}
+
+// Handler returns the daemon API handler.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v1/health", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+	})
+	mux.Handle("GET /metrics", metrics.Handler(s.DB))
+	mux.HandleFunc("GET /v1/environments", s.handleList)
+	mux.HandleFunc("GET /v1/environments/{id}", s.handleGet)
+	mux.HandleFunc("POST /v1/reconcile", func(w http.ResponseWriter, r *http.Request) {
+		if err := s.Reconcile(r.Context()); err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+	})
+	if s.Ops != nil {
+		mux.HandleFunc("POST /v1/environments", s.handleCreate)
+		mux.HandleFunc("DELETE /v1/environments/{id}", s.handleRemove)
+		mux.HandleFunc("POST /v1/environments/{id}/exec", s.handleExec)
+	}
+	return mux
+}
+
+func (s *Server) handleList(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	opts := state.ListOptions{
+		Backend:  q.Get("backend"),
+		RepoPath: q.Get("repo"),
+		Sort:     state.SortOrder(q.Get("sort")),
+	}
+	for _, st := range q["status"] {
+		opts.Statuses = append(opts.Statuses, state.EnvironmentStatus(st))
+	}
+	for name, dst := range map[string]*int{"limit": &opts.Limit, "offset": &opts.Offset} {
+		if v := q.Get(name); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				writeError(w, http.StatusBadRequest, fmt.Errorf("invalid %s %q", name, v))
+				return
+			}
+			*dst = n
+		}
+	}
+	if opts.Sort != "" && !slices.Contains(state.SortOrders, opts.Sort) {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("unknown sort order %q", opts.Sort))
+		return
+	}
+
+	envs, err := s.DB.ListEnvironments(opts)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	out := make([]state.SnapshotEnvironment, 0, len(envs))
+	for _, env := range envs {
+		out = append(out, state.SnapshotOf(env))
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+func (s *Server) handleGet(w http.ResponseWriter, r *http.Request) {
+	env, ok := s.resolve(w, r)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, state.SnapshotOf(env))
+}
+
+// resolve looks up the environment named by the {id} path value, as the
+// CLI does (see resolve.Environment), writing an error response and
+// returning false if it can't be resolved.
+func (s *Server) resolve(w http.ResponseWriter, r *http.Request) (*state.Environment, bool) {
+	env, err := resolve.Environment(s.DB, r.PathValue("id"))
+	switch {
+	case err == nil:
+		return env, true
+	case errors.Is(err, state.ErrEnvironmentNotFound):
+		writeError(w, http.StatusNotFound, err)
+	case errors.Is(err, resolve.ErrInvalid):
+		writeError(w, http.StatusBadRequest, err)
+	case errors.Is(err, state.ErrAmbiguousPrefix):
+		writeError(w, http.StatusConflict, err)
+	default:
+		writeError(w, http.StatusInternalServerError, err)
+	}
+	return nil, false
+}
+
+func (s *Server) logger() *log.Logger {
+	if s.Logger != nil {
+		return s.Logger
+	}
+	return log.Default()
+}
+
+// Listen creates the unix socket at path, readable only by the current user.
+// A socket left behind by a daemon that exited uncleanly is replaced; if
+// another daemon is answering on it, ErrAlreadyRunning is returned.
+func Listen(path string) (net.Listener, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create socket directory: %w", err)
+	}
+
+	if _, err := os.Stat(path); err == nil {
+		if c, err := Dial(path); err == nil {
+			c.Close()
+			return nil, fmt.Errorf("%w on %s", ErrAlreadyRunning, path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, fmt.Errorf("failed to remove stale socket: %w", err)
+		}
+	}
+
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", path, err)
+	}
+	if err := os.Chmod(path, 0600); err != nil {
+		ln.Close()
+		return nil, fmt.Errorf("failed to restrict socket permissions: %w", err)
+	}
+	return ln, nil
+}
+
+// apiError is the JSON body of error responses.
+type apiError struct {
+	Error string `json:"error"`
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, code int, err error) {
+	writeJSON(w, code, apiError{Error: err.Error()})
+}
+
+// readError converts a non-2xx response into an error.
+func readError(resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	var e apiError
+	if json.Unmarshal(body, &e) == nil && e.Error != "" {
+		return fmt.Errorf("daemon: %s", e.Error)
+	}
+	return fmt.Errorf("daemon: unexpected status %s", resp.Status)
+}
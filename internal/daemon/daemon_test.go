@@ -0,0 +1,138 @@
+package daemon
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Quidge/choir/internal/state"
+)
+
+func openTestDB(t *testing.T) *state.DB {
+	t.Helper()
+	db, err := state.Open(filepath.Join(t.TempDir(), "state.db"))
+	if err != nil {
+		t.Fatalf("failed to open test database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestServeAndClient(t *testing.T) {
+	db := openTestDB(t)
+	for i, status := range []state.EnvironmentStatus{state.StatusReady, state.StatusFailed} {
+		env := &state.Environment{
+			ID:         []string{"aaaa", "bbbb"}[i] + "0000000000000000000000000000",
+			Backend:    "local",
+			RepoPath:   "/repo",
+			BranchName: "env/x",
+			BaseBranch: "main",
+			CreatedAt:  time.Now(),
+			Status:     status,
+		}
+		if err := db.CreateEnvironment(env); err != nil {
+			t.Fatalf("CreateEnvironment() failed: %v", err)
+		}
+	}
+
+	var runs atomic.Int32
+	srv := &Server{
+		DB:       db,
+		Interval: time.Hour,
+		Tasks: []Task{
+			{Name: "count", Run: func(ctx context.Context) error { runs.Add(1); return nil }},
+			{Name: "broken", Run: func(ctx context.Context) error { return errors.New("boom") }},
+		},
+	}
+
+	socket := filepath.Join(t.TempDir(), "d.sock")
+	ln, err := Listen(socket)
+	if err != nil {
+		t.Fatalf("Listen() failed: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- srv.Serve(ctx, ln) }()
+	defer func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("Serve() returned %v", err)
+		}
+	}()
+
+	client, err := Dial(socket)
+	if err != nil {
+		t.Fatalf("Dial() failed: %v", err)
+	}
+	defer client.Close()
+
+	envs, err := client.ListEnvironments(ctx, state.ListOptions{
+		Statuses: []state.EnvironmentStatus{state.StatusReady},
+	})
+	if err != nil {
+		t.Fatalf("ListEnvironments() failed: %v", err)
+	}
+	if len(envs) != 1 || envs[0].Status != state.StatusReady || envs[0].RepoPath != "/repo" {
+		t.Errorf("ListEnvironments() = %+v, want the one ready environment", envs)
+	}
+
+	// Sorting and paging pass through
+	envs, err = client.ListEnvironments(ctx, state.ListOptions{Sort: state.SortStatus, Limit: 1, Offset: 1})
+	if err != nil {
+		t.Fatalf("ListEnvironments(sort, limit, offset) failed: %v", err)
+	}
+	if len(envs) != 1 || envs[0].Status != state.StatusFailed {
+		t.Errorf("ListEnvironments(sort=status, limit=1, offset=1) = %+v, want the failed environment", envs)
+	}
+	if _, err := client.ListEnvironments(ctx, state.ListOptions{Sort: "size"}); err == nil {
+		t.Error("ListEnvironments(sort=size) succeeded, want error")
+	}
+
+	// Metrics are served for Prometheus to scrape
+	rec := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `choir_environments{status="ready"} 1`) {
+		t.Errorf("GET /metrics = %d:\n%s\nwant the ready environment counted", rec.Code, rec.Body)
+	}
+
+	// A failing task doesn't stop the others, and the failure is reported
+	before := runs.Load()
+	if err := client.Reconcile(ctx); err == nil {
+		t.Error("Reconcile() succeeded despite failing task")
+	}
+	if runs.Load() != before+1 {
+		t.Errorf("count task ran %d times on Reconcile, want 1", runs.Load()-before)
+	}
+
+	// A second daemon refuses to take over the socket
+	if _, err := Listen(socket); !errors.Is(err, ErrAlreadyRunning) {
+		t.Errorf("second Listen() error = %v, want ErrAlreadyRunning", err)
+	}
+}
+
+func TestDialNotRunning(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "d.sock")
+	if _, err := Dial(socket); !errors.Is(err, ErrNotRunning) {
+		t.Errorf("Dial() error = %v, want ErrNotRunning", err)
+	}
+
+	// A stale socket from a crashed daemon is replaced
+	ln, err := Listen(socket)
+	if err != nil {
+		t.Fatalf("Listen() failed: %v", err)
+	}
+	ln.(interface{ SetUnlinkOnClose(bool) }).SetUnlinkOnClose(false)
+	ln.Close()
+
+	ln, err = Listen(socket)
+	if err != nil {
+		t.Fatalf("Listen() over stale socket failed: %v", err)
+	}
+	ln.Close()
+}
@@ -0,0 +1,147 @@
+package daemon
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/Quidge/choir/internal/backend"
+	"github.com/Quidge/choir/internal/state"
+)
+
+// maxRequestBody bounds the size of JSON request bodies.
+const maxRequestBody = 1 << 20
+
+// Operations performs the environment changes the API exposes. The daemon
+// package only routes requests; the CLI supplies the implementation so the
+// API behaves exactly like the equivalent commands.
+type Operations interface {
+	// Create creates and provisions an environment, as "env create" does.
+	Create(ctx context.Context, req CreateRequest) (*state.Environment, error)
+
+	// Remove removes env, as "env rm" does. Unless force is set, it fails
+	// rather than destroy a workspace with unpushed commits.
+	Remove(ctx context.Context, env *state.Environment, force bool) error
+
+	// Exec runs a command in env, as "env exec" does. A command that exits
+	// nonzero is not an error; its exit code is reported in the response.
+	Exec(ctx context.Context, env *state.Environment, command string) (ExecResponse, error)
+}
+
+// CreateRequest is the body of POST /v1/environments. Empty fields take the
+// same defaults as the corresponding "env create" flags.
+type CreateRequest struct {
+	Repo       string `json:"repo"`
+	Base       string `json:"base,omitempty"`
+	FromBranch string `json:"from_branch,omitempty"`
+	Backend    string `json:"backend,omitempty"`
+	Profile    string `json:"profile,omitempty"`
+	Template   string `json:"template,omitempty"`
+	TTL        string `json:"ttl,omitempty"`
+	NoSetup    bool   `json:"no_setup,omitempty"`
+}
+
+// ExecRequest is the body of POST /v1/environments/{id}/exec.
+type ExecRequest struct {
+	Command string `json:"command"`
+}
+
+// ExecResponse is the result of POST /v1/environments/{id}/exec.
+type ExecResponse struct {
+	Output     string `json:"output"`
+	ExitCode   int    `json:"exit_code"`
+	DurationMS int64  `json:"duration_ms"`
+}
+
+func (s *Server) handleCreate(w http.ResponseWriter, r *http.Request) {
+	var req CreateRequest
+	if err := decodeBody(w, r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if req.Repo == "" {
+		writeError(w, http.StatusBadRequest, errors.New("repo is required"))
+		return
+	}
+
+	env, err := s.Ops.Create(r.Context(), req)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, state.SnapshotOf(env))
+}
+
+func (s *Server) handleRemove(w http.ResponseWriter, r *http.Request) {
+	env, ok := s.resolve(w, r)
+	if !ok {
+		return
+	}
+	force := r.URL.Query().Get("force") == "true"
+	if err := s.Ops.Remove(r.Context(), env, force); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, backend.ErrUnpushedWork) {
+			status = http.StatusConflict
+		}
+		writeError(w, status, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleExec(w http.ResponseWriter, r *http.Request) {
+	var req ExecRequest
+	if err := decodeBody(w, r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if strings.TrimSpace(req.Command) == "" {
+		writeError(w, http.StatusBadRequest, errors.New("command is required"))
+		return
+	}
+
+	env, ok := s.resolve(w, r)
+	if !ok {
+		return
+	}
+	if env.Status != state.StatusReady {
+		writeError(w, http.StatusConflict, fmt.Errorf("environment %s is %s, not ready", state.ShortID(env.ID), env.Status))
+		return
+	}
+
+	res, err := s.Ops.Exec(r.Context(), env, req.Command)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+// decodeBody decodes a JSON request body into v, rejecting unknown fields.
+func decodeBody(w http.ResponseWriter, r *http.Request, v any) error {
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestBody))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return fmt.Errorf("invalid request body: %w", err)
+	}
+	return nil
+}
+
+// RequireToken wraps h so every request must carry the header
+// "Authorization: Bearer <token>". Other requests get 401 Unauthorized.
+func RequireToken(token string, h http.Handler) http.Handler {
+	want := []byte("Bearer " + token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got := []byte(r.Header.Get("Authorization"))
+		if subtle.ConstantTimeCompare(got, want) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="choir"`)
+			writeError(w, http.StatusUnauthorized, errors.New("missing or invalid token"))
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
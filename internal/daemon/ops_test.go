@@ -0,0 +1,129 @@
+package daemon
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Quidge/choir/internal/state"
+)
+
+// stubOps records calls and creates environments directly in the database.
+type stubOps struct {
+	db      *state.DB
+	removed []string
+	forced  []bool
+	execs   []string
+}
+
+func (o *stubOps) Create(ctx context.Context, req CreateRequest) (*state.Environment, error) {
+	env := &state.Environment{
+		ID:         "cccc0000000000000000000000000000",
+		Backend:    "worktree",
+		RepoPath:   req.Repo,
+		BranchName: "env/c",
+		BaseBranch: req.Base,
+		CreatedAt:  time.Now(),
+		Status:     state.StatusReady,
+	}
+	return env, o.db.CreateEnvironment(env)
+}
+
+func (o *stubOps) Remove(ctx context.Context, env *state.Environment, force bool) error {
+	o.removed = append(o.removed, env.ID)
+	o.forced = append(o.forced, force)
+	return o.db.DeleteEnvironment(env.ID)
+}
+
+func (o *stubOps) Exec(ctx context.Context, env *state.Environment, command string) (ExecResponse, error) {
+	o.execs = append(o.execs, command)
+	return ExecResponse{Output: "hi\n", ExitCode: 3}, nil
+}
+
+func TestOperationsAPI(t *testing.T) {
+	db := openTestDB(t)
+	ops := &stubOps{db: db}
+	ts := httptest.NewServer(RequireToken("secret", (&Server{DB: db, Ops: ops}).Handler()))
+	defer ts.Close()
+
+	call := func(method, path, token, body string) *http.Response {
+		t.Helper()
+		req, err := http.NewRequest(method, ts.URL+path, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s failed: %v", method, path, err)
+		}
+		t.Cleanup(func() { resp.Body.Close() })
+		return resp
+	}
+
+	for _, token := range []string{"", "wrong"} {
+		if resp := call("GET", "/v1/health", token, ""); resp.StatusCode != http.StatusUnauthorized {
+			t.Errorf("token %q: status = %d, want 401", token, resp.StatusCode)
+		}
+	}
+
+	resp := call("POST", "/v1/environments", "secret", `{"repo":"/repo","base":"main"}`)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("create status = %d, want 201", resp.StatusCode)
+	}
+	var created state.SnapshotEnvironment
+	if err := json.NewDecoder(resp.Body).Decode(&created); err != nil {
+		t.Fatal(err)
+	}
+	if created.RepoPath != "/repo" || created.BaseBranch != "main" {
+		t.Errorf("created = %+v", created)
+	}
+
+	if resp := call("POST", "/v1/environments", "secret", `{"repo":"/repo","bogus":1}`); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("unknown field: status = %d, want 400", resp.StatusCode)
+	}
+
+	// Prefix lookup, as on the command line
+	if resp := call("GET", "/v1/environments/cccc", "secret", ""); resp.StatusCode != http.StatusOK {
+		t.Errorf("get by prefix: status = %d, want 200", resp.StatusCode)
+	}
+
+	resp = call("POST", "/v1/environments/cccc/exec", "secret", `{"command":"echo hi; exit 3"}`)
+	var res ExecResponse
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK || res.ExitCode != 3 || res.Output != "hi\n" {
+		t.Errorf("exec = %d %+v, want 200 with exit code 3", resp.StatusCode, res)
+	}
+
+	if resp := call("DELETE", "/v1/environments/cccc?force=true", "secret", ""); resp.StatusCode != http.StatusNoContent {
+		t.Errorf("delete status = %d, want 204", resp.StatusCode)
+	}
+	if resp := call("DELETE", "/v1/environments/cccc", "secret", ""); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("second delete status = %d, want 404", resp.StatusCode)
+	}
+	if len(ops.removed) != 1 || !ops.forced[0] || len(ops.execs) != 1 {
+		t.Errorf("removed = %v (forced %v), execs = %v", ops.removed, ops.forced, ops.execs)
+	}
+}
+
+func TestOperationsDisabled(t *testing.T) {
+	ts := httptest.NewServer((&Server{DB: openTestDB(t)}).Handler())
+	defer ts.Close()
+
+	resp, err := http.Post(ts.URL+"/v1/environments", "application/json", strings.NewReader(`{"repo":"/repo"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("status = %d, want 405 without Ops", resp.StatusCode)
+	}
+}
@@ -0,0 +1,124 @@
+// Package diag captures a lightweight diagnostic bundle when an environment
+// fails: the host's free disk, memory, and load, the end of the setup log,
+// and git status in the workspace. Bundles are stored with the environment
+// (see state.SaveDiagnostics) so that `choir env diag` can show what the
+// machine looked like at the time, long after the fact.
+package diag
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/Quidge/choir/internal/preflight"
+)
+
+// SetupLogLines is how many lines from the end of the setup log a bundle
+// keeps.
+const SetupLogLines = 100
+
+// gitStatusTimeout bounds git status, which can be slow in a large or
+// damaged workspace.
+const gitStatusTimeout = 5 * time.Second
+
+// Bundle is a snapshot taken when an environment failed. Fields that
+// couldn't be collected are left zero, with the reason in Errors.
+type Bundle struct {
+	CapturedAt time.Time `json:"captured_at"`
+	Reason     string    `json:"reason"` // Why the environment failed
+
+	DiskPath string `json:"disk_path,omitempty"` // Where DiskFree was measured
+	DiskFree uint64 `json:"disk_free,omitempty"` // Bytes available
+
+	MemTotal     uint64 `json:"mem_total,omitempty"`     // Bytes
+	MemAvailable uint64 `json:"mem_available,omitempty"` // Bytes; Linux only
+	Load         string `json:"load,omitempty"`          // 1, 5, and 15 minute load averages
+
+	SetupLog  string `json:"setup_log,omitempty"`  // Last SetupLogLines lines
+	GitStatus string `json:"git_status,omitempty"` // git status --short --branch
+
+	Errors []string `json:"errors,omitempty"`
+}
+
+// Options says what to capture.
+type Options struct {
+	Reason       string
+	Workspace    string // Workspace directory, if the backend has one on this host
+	SetupLogPath string // Path of the environment's setup log
+	DataDir      string // Where to measure free disk without a workspace
+}
+
+// Capture collects a bundle. It never fails; whatever can't be collected
+// is noted in the bundle's Errors.
+func Capture(ctx context.Context, opts Options) *Bundle {
+	b := &Bundle{CapturedAt: time.Now(), Reason: opts.Reason}
+	note := func(what string, err error) {
+		b.Errors = append(b.Errors, what+": "+err.Error())
+	}
+
+	workspace := ""
+	if info, err := os.Stat(opts.Workspace); opts.Workspace != "" && err == nil && info.IsDir() {
+		workspace = opts.Workspace
+	}
+
+	b.DiskPath = workspace
+	if b.DiskPath == "" {
+		b.DiskPath = opts.DataDir
+	}
+	if b.DiskPath != "" {
+		free, err := preflight.FreeSpace(b.DiskPath)
+		if err != nil {
+			note("disk", err)
+		} else {
+			b.DiskFree = free
+		}
+	}
+
+	if err := readHost(ctx, b); err != nil {
+		note("host", err)
+	}
+
+	if opts.SetupLogPath != "" {
+		tail, err := tailFile(opts.SetupLogPath, SetupLogLines)
+		if err != nil && !os.IsNotExist(err) {
+			note("setup log", err)
+		}
+		b.SetupLog = tail
+	}
+
+	if workspace != "" {
+		ctx, cancel := context.WithTimeout(ctx, gitStatusTimeout)
+		defer cancel()
+		out, err := exec.CommandContext(ctx, "git", "-C", workspace, "status", "--short", "--branch").CombinedOutput()
+		if err != nil {
+			note("git status", err)
+		}
+		b.GitStatus = string(out)
+	}
+	return b
+}
+
+// tailFile returns the last n lines of the file at path.
+func tailFile(path string, n int) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	var lines []string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+		if len(lines) > n {
+			lines = lines[1:]
+		}
+	}
+	if len(lines) == 0 {
+		return "", scanner.Err()
+	}
+	return strings.Join(lines, "\n") + "\n", scanner.Err()
+}
@@ -0,0 +1,68 @@
+package diag
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCapture(t *testing.T) {
+	workspace := t.TempDir()
+	if out, err := exec.Command("git", "init", "-q", "-b", "main", workspace).CombinedOutput(); err != nil {
+		t.Fatalf("git init failed: %v\n%s", err, out)
+	}
+	if err := os.WriteFile(filepath.Join(workspace, "new.txt"), []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	logPath := filepath.Join(t.TempDir(), "setup.log")
+	var log strings.Builder
+	for i := 1; i <= 150; i++ {
+		fmt.Fprintf(&log, "line %d\n", i)
+	}
+	if err := os.WriteFile(logPath, []byte(log.String()), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	b := Capture(context.Background(), Options{
+		Reason:       "setup failed: exit status 1",
+		Workspace:    workspace,
+		SetupLogPath: logPath,
+	})
+
+	if b.Reason != "setup failed: exit status 1" || b.CapturedAt.IsZero() {
+		t.Errorf("Capture() = %+v", b)
+	}
+	if b.DiskPath != workspace || b.DiskFree == 0 {
+		t.Errorf("disk = %d free at %q, want measured at the workspace", b.DiskFree, b.DiskPath)
+	}
+	if lines := strings.Split(strings.TrimSuffix(b.SetupLog, "\n"), "\n"); len(lines) != SetupLogLines ||
+		lines[0] != "line 51" || lines[len(lines)-1] != "line 150" {
+		t.Errorf("setup log has %d lines from %q, want the last %d", len(lines), lines[0], SetupLogLines)
+	}
+	if !strings.Contains(b.GitStatus, "?? new.txt") {
+		t.Errorf("GitStatus = %q, want the untracked file", b.GitStatus)
+	}
+}
+
+func TestCaptureWithoutWorkspace(t *testing.T) {
+	dataDir := t.TempDir()
+	b := Capture(context.Background(), Options{
+		Reason:       "workspace missing",
+		Workspace:    filepath.Join(dataDir, "gone"),
+		SetupLogPath: filepath.Join(dataDir, "missing.log"),
+		DataDir:      dataDir,
+	})
+	if b.DiskPath != dataDir || b.GitStatus != "" || b.SetupLog != "" {
+		t.Errorf("Capture() = %+v, want disk measured at the data directory and nothing else", b)
+	}
+	for _, e := range b.Errors {
+		if strings.HasPrefix(e, "setup log") {
+			t.Errorf("missing setup log reported as an error: %s", e)
+		}
+	}
+}
@@ -0,0 +1,26 @@
+package diag
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+
+	"github.com/Quidge/choir/internal/preflight"
+)
+
+// readHost fills in memory and load from /proc.
+func readHost(ctx context.Context, b *Bundle) error {
+	var errs []error
+	var err error
+	if b.MemTotal, b.MemAvailable, err = preflight.Memory(ctx); err != nil {
+		errs = append(errs, err)
+	}
+
+	if data, err := os.ReadFile("/proc/loadavg"); err != nil {
+		errs = append(errs, err)
+	} else if fields := strings.Fields(string(data)); len(fields) >= 3 {
+		b.Load = strings.Join(fields[:3], " ")
+	}
+	return errors.Join(errs...)
+}
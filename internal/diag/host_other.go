@@ -0,0 +1,30 @@
+//go:build !linux
+
+package diag
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"strings"
+
+	"github.com/Quidge/choir/internal/preflight"
+)
+
+// readHost fills in memory and load with sysctl, as on macOS and the BSDs.
+// Available memory isn't reported by sysctl and is left zero.
+func readHost(ctx context.Context, b *Bundle) error {
+	var errs []error
+	var err error
+	if b.MemTotal, b.MemAvailable, err = preflight.Memory(ctx); err != nil {
+		errs = append(errs, err)
+	}
+
+	// vm.loadavg prints like "{ 1.23 1.10 0.98 }"
+	if out, err := exec.CommandContext(ctx, "sysctl", "-n", "vm.loadavg").Output(); err != nil {
+		errs = append(errs, err)
+	} else {
+		b.Load = strings.Join(strings.Fields(strings.Trim(strings.TrimSpace(string(out)), "{}")), " ")
+	}
+	return errors.Join(errs...)
+}
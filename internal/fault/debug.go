@@ -0,0 +1,7 @@
+//go:build debug
+
+package fault
+
+// DebugBuild reports whether choir was built with the debug tag, which
+// enables the --choir-fault flag.
+const DebugBuild = true
@@ -0,0 +1,128 @@
+// Package fault injects failures at fixed points in choir, so integration
+// tests and wrapper scripts can check how they handle errors without
+// manufacturing real ones.
+//
+// Faults are given as a comma-separated spec:
+//
+//	after-create         fail provisioning right after the workspace is created
+//	setup-step=N         fail setup step N (1-based) instead of running it
+//	slow-exec=DURATION   delay env exec commands by DURATION (e.g., 5s)
+//
+// The spec is read from CHOIR_FAULT. Debug builds (go build -tags debug)
+// also accept it from the hidden --choir-fault flag. With neither set, every
+// injection point is a no-op.
+package fault
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// EnvVar is the environment variable holding the fault spec.
+const EnvVar = "CHOIR_FAULT"
+
+// ErrInjected is wrapped by every injected failure.
+var ErrInjected = errors.New("injected fault")
+
+// Faults is a parsed fault spec.
+type Faults struct {
+	AfterCreate bool          // Fail after the workspace is created
+	SetupStep   int           // Fail this setup step (0 means none)
+	SlowExec    time.Duration // Delay before exec commands run
+}
+
+var (
+	active   Faults
+	activeMu sync.RWMutex
+)
+
+// Parse parses a fault spec. An empty spec has no faults.
+func Parse(spec string) (Faults, error) {
+	var f Faults
+	for item := range strings.SplitSeq(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		name, value, hasValue := strings.Cut(item, "=")
+		switch name {
+		case "after-create":
+			if hasValue {
+				return Faults{}, fmt.Errorf("fault %q takes no value", name)
+			}
+			f.AfterCreate = true
+		case "setup-step":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 {
+				return Faults{}, fmt.Errorf("fault %q needs a step number of at least 1, got %q", name, value)
+			}
+			f.SetupStep = n
+		case "slow-exec":
+			d, err := time.ParseDuration(value)
+			if err != nil || d <= 0 {
+				return Faults{}, fmt.Errorf("fault %q needs a positive duration, got %q", name, value)
+			}
+			f.SlowExec = d
+		default:
+			return Faults{}, fmt.Errorf("unknown fault %q (want after-create, setup-step=N, or slow-exec=DURATION)", name)
+		}
+	}
+	return f, nil
+}
+
+// Configure parses spec and makes its faults active, replacing any
+// configured before. An empty spec clears them.
+func Configure(spec string) error {
+	f, err := Parse(spec)
+	if err != nil {
+		return fmt.Errorf("invalid fault spec: %w", err)
+	}
+	activeMu.Lock()
+	defer activeMu.Unlock()
+	active = f
+	return nil
+}
+
+func current() Faults {
+	activeMu.RLock()
+	defer activeMu.RUnlock()
+	return active
+}
+
+// AfterCreate returns an error if the after-create fault is active.
+func AfterCreate() error {
+	if current().AfterCreate {
+		return fmt.Errorf("%w: after-create", ErrInjected)
+	}
+	return nil
+}
+
+// SetupStep returns an error if the setup-step fault names step n.
+func SetupStep(n int) error {
+	if step := current().SetupStep; step != 0 && step == n {
+		return fmt.Errorf("%w: setup-step=%d", ErrInjected, n)
+	}
+	return nil
+}
+
+// SlowExec waits for the slow-exec delay, if active. It returns ctx's error
+// if ctx is done first.
+func SlowExec(ctx context.Context) error {
+	d := current().SlowExec
+	if d == 0 {
+		return nil
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,64 @@
+package fault
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    Faults
+		wantErr bool
+	}{
+		{spec: "", want: Faults{}},
+		{spec: "after-create", want: Faults{AfterCreate: true}},
+		{spec: "setup-step=2, slow-exec=1s", want: Faults{SetupStep: 2, SlowExec: time.Second}},
+		{spec: "after-create=yes", wantErr: true},
+		{spec: "setup-step=0", wantErr: true},
+		{spec: "setup-step", wantErr: true},
+		{spec: "slow-exec=fast", wantErr: true},
+		{spec: "explode", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			got, err := Parse(tt.spec)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Parse(%q) error = %v, wantErr %v", tt.spec, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Parse(%q) = %+v, want %+v", tt.spec, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInjectionPoints(t *testing.T) {
+	t.Cleanup(func() { _ = Configure("") })
+	ctx := context.Background()
+
+	if AfterCreate() != nil || SetupStep(1) != nil || SlowExec(ctx) != nil {
+		t.Fatal("injection points fired with no faults configured")
+	}
+
+	if err := Configure("after-create,setup-step=2,slow-exec=1h"); err != nil {
+		t.Fatal(err)
+	}
+	if err := AfterCreate(); !errors.Is(err, ErrInjected) {
+		t.Errorf("AfterCreate() = %v, want ErrInjected", err)
+	}
+	if err := SetupStep(1); err != nil {
+		t.Errorf("SetupStep(1) = %v, want nil", err)
+	}
+	if err := SetupStep(2); !errors.Is(err, ErrInjected) {
+		t.Errorf("SetupStep(2) = %v, want ErrInjected", err)
+	}
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if err := SlowExec(cancelled); !errors.Is(err, context.Canceled) {
+		t.Errorf("SlowExec() = %v, want context.Canceled", err)
+	}
+}
@@ -0,0 +1,137 @@
+package gitutil
+
+import (
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// CommitsAheadBehind returns how many commits rev has that base doesn't
+// (ahead) and base has that rev doesn't (behind). For an environment's
+// branch and its base branch, ahead is the work done in the environment and
+// behind is what landed on the base branch since.
+// If dir is empty, the current working directory is used.
+func CommitsAheadBehind(dir, base, rev string) (ahead, behind int, err error) {
+	out, err := output(dir, "rev-list", "--left-right", "--count", rev+"..."+base)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to compare %s with %s: %w", rev, base, err)
+	}
+	fields := strings.Fields(out)
+	if len(fields) != 2 {
+		return 0, 0, fmt.Errorf("failed to compare %s with %s: unexpected output %q", rev, base, out)
+	}
+	if ahead, err = strconv.Atoi(fields[0]); err == nil {
+		behind, err = strconv.Atoi(fields[1])
+	}
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to compare %s with %s: %w", rev, base, err)
+	}
+	return ahead, behind, nil
+}
+
+// DiffSummary summarizes the size of a diff, as git diff --shortstat does.
+// Binary files count as changed files with no lines inserted or deleted.
+type DiffSummary struct {
+	Files      int
+	Insertions int
+	Deletions  int
+}
+
+// IsZero reports whether the diff is empty.
+func (d DiffSummary) IsZero() bool {
+	return d == DiffSummary{}
+}
+
+// String returns the stat as git diff --shortstat words it, e.g.,
+// "3 files changed, 10 insertions(+), 2 deletions(-)".
+func (d DiffSummary) String() string {
+	s := fmt.Sprintf("%d %s changed", d.Files, pluralize(d.Files, "file", "files"))
+	if d.Insertions > 0 || d.Deletions == 0 {
+		s += fmt.Sprintf(", %d %s(+)", d.Insertions, pluralize(d.Insertions, "insertion", "insertions"))
+	}
+	if d.Deletions > 0 {
+		s += fmt.Sprintf(", %d %s(-)", d.Deletions, pluralize(d.Deletions, "deletion", "deletions"))
+	}
+	return s
+}
+
+func pluralize(n int, one, many string) string {
+	if n == 1 {
+		return one
+	}
+	return many
+}
+
+// DiffStat returns the size of the changes made on rev since it branched
+// from base, ignoring what landed on base meanwhile (git diff base...rev).
+// If rev is empty, the changes are those in the worktree at dir since HEAD
+// branched from base, committed or not. Untracked files aren't counted.
+// If dir is empty, the current working directory is used.
+func DiffStat(dir, base, rev string) (DiffSummary, error) {
+	args := []string{"diff", "--numstat", base + "..." + rev}
+	if rev == "" {
+		mergeBase, err := output(dir, "merge-base", base, "HEAD")
+		if err != nil {
+			return DiffSummary{}, fmt.Errorf("failed to find where HEAD branched from %s: %w", base, err)
+		}
+		args = []string{"diff", "--numstat", mergeBase}
+	}
+	out, err := output(dir, args...)
+	if err != nil {
+		return DiffSummary{}, fmt.Errorf("failed to diff against %s: %w", base, err)
+	}
+
+	var stat DiffSummary
+	for _, line := range strings.Split(out, "\n") {
+		added, rest, ok := strings.Cut(line, "\t")
+		if !ok {
+			continue
+		}
+		deleted, _, _ := strings.Cut(rest, "\t")
+		stat.Files++
+		// Binary files show "-" for both
+		if n, err := strconv.Atoi(added); err == nil {
+			stat.Insertions += n
+		}
+		if n, err := strconv.Atoi(deleted); err == nil {
+			stat.Deletions += n
+		}
+	}
+	return stat, nil
+}
+
+// HasUncommittedChanges reports whether the worktree at dir has changes
+// that aren't committed: staged, unstaged, or untracked files that aren't
+// ignored.
+// If dir is empty, the current working directory is used.
+func HasUncommittedChanges(dir string) (bool, error) {
+	return hasChanges(dir, true)
+}
+
+// hasChanges reports whether git status in dir shows any changes,
+// counting untracked files if untracked is set.
+func hasChanges(dir string, untracked bool) (bool, error) {
+	mode := "no"
+	if untracked {
+		mode = "normal"
+	}
+	out, err := output(dir, "status", "--porcelain", "--untracked-files="+mode)
+	if err != nil {
+		return false, fmt.Errorf("failed to check %s for changes: %w", dir, err)
+	}
+	return out != "", nil
+}
+
+// output runs git in dir and returns its standard output, trimmed.
+func output(dir string, args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	if dir != "" {
+		cmd.Dir = dir
+	}
+	out, err := cmd.Output()
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
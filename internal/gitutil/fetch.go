@@ -0,0 +1,132 @@
+package gitutil
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+var (
+	// ErrNotFastForward is returned by FastForward when the branch has
+	// commits its target doesn't.
+	ErrNotFastForward = errors.New("branch has diverged")
+
+	// ErrUncommittedChanges is returned by FastForward when the branch is
+	// checked out in a worktree with uncommitted changes to tracked files.
+	ErrUncommittedChanges = errors.New("worktree has uncommitted changes")
+)
+
+// Fetch fetches from remoteName, updating its remote-tracking branches.
+// If remoteName is empty, "origin" is used.
+// If dir is empty, the current working directory is used.
+func Fetch(dir, remoteName string) error {
+	if remoteName == "" {
+		remoteName = "origin"
+	}
+
+	cmd := exec.Command("git", "fetch", "--quiet", remoteName)
+	if dir != "" {
+		cmd.Dir = dir
+	}
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("failed to fetch %s: %w\noutput: %s", remoteName, err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// Upstream returns the remote branch tracks and the ref of its
+// remote-tracking branch there, such as "origin" and
+// "refs/remotes/origin/main". Both are empty if branch tracks nothing.
+// If dir is empty, the current working directory is used.
+func Upstream(dir, branch string) (remote, ref string, err error) {
+	cmd := exec.Command("git", "for-each-ref", "--format=%(upstream:remotename) %(upstream)", "refs/heads/"+branch)
+	if dir != "" {
+		cmd.Dir = dir
+	}
+	out, err := cmd.Output()
+	if err != nil {
+		return "", "", fmt.Errorf("failed to read upstream of %s: %w", branch, err)
+	}
+	remote, ref, _ = strings.Cut(strings.TrimSpace(string(out)), " ")
+	return remote, ref, nil
+}
+
+// FastForward moves branch forward to rev, and returns how many commits
+// branch was behind it. If err is non-nil, branch was left where it was,
+// still that many commits behind. It fails with ErrNotFastForward if
+// branch has commits rev doesn't.
+//
+// A branch checked out in a worktree (the main checkout or a linked one)
+// is fast-forwarded there with git merge --ff-only, updating its files, so
+// it fails with ErrUncommittedChanges if the worktree has uncommitted
+// changes to tracked files. Like WaitIdle, it waits for git's locks and
+// fails with ErrOperationInProgress during a rebase, merge, or similar in
+// the repository, or while branch is being rebased in any worktree.
+// If dir is empty, the current working directory is used.
+func FastForward(dir, branch, rev string) (int, error) {
+	local := "refs/heads/" + branch
+	ahead, behind, err := CommitsAheadBehind(dir, rev, local)
+	if err != nil || behind == 0 {
+		return 0, err
+	}
+	if ahead > 0 {
+		return behind, fmt.Errorf("%w: %s has commits %s doesn't", ErrNotFastForward, branch, rev)
+	}
+
+	worktree, err := WorktreeForBranch(dir, branch)
+	if err != nil {
+		return behind, err
+	}
+	if err := waitToMove(dir, worktree, branch); err != nil {
+		return behind, err
+	}
+	var cmd *exec.Cmd
+	if worktree == "" {
+		cmd = exec.Command("git", "update-ref", "-m", "choir: fast-forward", local, rev)
+		if dir != "" {
+			cmd.Dir = dir
+		}
+	} else {
+		dirty, err := hasChanges(worktree, false)
+		if err != nil {
+			return behind, err
+		}
+		if dirty {
+			return behind, fmt.Errorf("%w: %s has %s checked out", ErrUncommittedChanges, worktree, branch)
+		}
+		cmd = exec.Command("git", "merge", "--quiet", "--ff-only", rev)
+		cmd.Dir = worktree
+	}
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return behind, fmt.Errorf("failed to fast-forward %s: %w\noutput: %s", branch, err, strings.TrimSpace(string(out)))
+	}
+	return behind, nil
+}
+
+// waitToMove waits until branch can be moved safely: see WaitIdle, which it
+// runs in the repository at dir and in worktree, where branch is checked
+// out, if it is. It fails with ErrOperationInProgress if
+// branch is being rebased.
+func waitToMove(dir, worktree, branch string) error {
+	ctx := context.Background()
+	if err := WaitIdle(ctx, dir, DefaultLockTimeout); err != nil {
+		return err
+	}
+	if worktree != "" {
+		if err := WaitIdle(ctx, worktree, DefaultLockTimeout); err != nil {
+			return err
+		}
+	}
+	rebasing, err := BranchRebasing(dir, branch)
+	if err != nil {
+		return err
+	}
+	if rebasing {
+		return fmt.Errorf("%w: %s is being rebased; finish or abort the rebase and retry", ErrOperationInProgress, branch)
+	}
+	return nil
+}
@@ -6,6 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"os/exec"
+	"strconv"
 	"strings"
 )
 
@@ -160,6 +161,96 @@ func ValidateBranchName(name string) error {
 	return nil
 }
 
+// Push pushes branch to the given remote and sets it as the upstream.
+// If remoteName is empty, "origin" is used.
+// If dir is empty, the current working directory is used.
+func Push(dir, remoteName, branch string) error {
+	if remoteName == "" {
+		remoteName = "origin"
+	}
+
+	cmd := exec.Command("git", "push", "--set-upstream", remoteName, branch)
+	if dir != "" {
+		cmd.Dir = dir
+	}
+
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("failed to push %s to %s: %w\noutput: %s", branch, remoteName, err, strings.TrimSpace(string(out)))
+	}
+
+	return nil
+}
+
+// TreeSize returns the total size in bytes of all files in the tree at rev,
+// or of those under paths if any are given, which approximates the disk
+// space a checkout of rev needs.
+// If rev is empty, HEAD is used. If dir is empty, the current working directory is used.
+func TreeSize(dir, rev string, paths ...string) (int64, error) {
+	if rev == "" {
+		rev = "HEAD"
+	}
+
+	args := []string{"ls-tree", "-r", "-l", rev}
+	if len(paths) > 0 {
+		args = append(append(args, "--"), paths...)
+	}
+	cmd := exec.Command("git", args...)
+	if dir != "" {
+		cmd.Dir = dir
+	}
+
+	out, err := cmd.Output()
+	if err != nil {
+		return 0, fmt.Errorf("failed to list tree %s: %w", rev, err)
+	}
+
+	// Each line: <mode> <type> <object> <size>\t<path>
+	var total int64
+	for _, line := range strings.Split(string(out), "\n") {
+		meta, _, ok := strings.Cut(line, "\t")
+		if !ok {
+			continue
+		}
+		fields := strings.Fields(meta)
+		if len(fields) != 4 || fields[3] == "-" {
+			continue // submodules have no size
+		}
+		size, err := strconv.ParseInt(fields[3], 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("failed to parse size in %q: %w", line, err)
+		}
+		total += size
+	}
+
+	return total, nil
+}
+
+// Trailer returns the value of the last trailer named key in the message
+// of commit rev, or "" if it has none.
+// If dir is empty, the current working directory is used.
+func Trailer(dir, rev, key string) (string, error) {
+	cmd := exec.Command("git", "log", "-1", "--format=%(trailers:key="+key+",valueonly)", rev, "--")
+	if dir != "" {
+		cmd.Dir = dir
+	}
+
+	out, err := cmd.Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return "", fmt.Errorf("unknown commit %s: %s", rev, strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return "", fmt.Errorf("failed to read commit %s: %w", rev, err)
+	}
+
+	values := strings.Fields(string(out))
+	if len(values) == 0 {
+		return "", nil
+	}
+	return values[len(values)-1], nil
+}
+
 // IsInsideWorkTree returns true if dir is inside a git work tree.
 // If dir is empty, the current working directory is used.
 func IsInsideWorkTree(dir string) bool {
@@ -175,3 +266,142 @@ func IsInsideWorkTree(dir string) bool {
 
 	return strings.TrimSpace(string(out)) == "true"
 }
+
+// IsRemoteURL reports whether s looks like a git remote URL rather than a
+// local path: a URL with a scheme (https://, ssh://, git://, file://) or
+// scp-like syntax (git@github.com:user/repo.git).
+func IsRemoteURL(s string) bool {
+	if strings.Contains(s, "://") {
+		return true
+	}
+	// scp-like syntax: [user@]host:path, where host has no slash
+	host, _, ok := strings.Cut(s, ":")
+	return ok && host != "" && !strings.Contains(host, "/")
+}
+
+// CloneOptions limit what Clone fetches, to make large repositories fast
+// to clone.
+type CloneOptions struct {
+	// Depth, if positive, fetches only this many commits of each branch.
+	Depth int
+
+	// Filter, if set, is a partial clone filter such as "blob:none":
+	// objects it leaves out are fetched when first needed.
+	Filter string
+}
+
+// Clone clones url into dir, which must not exist or be empty. A shallow
+// clone still fetches every branch, so any of them can be checked out.
+func Clone(url, dir string, opts CloneOptions) error {
+	args := []string{"clone", "--quiet"}
+	if opts.Depth > 0 {
+		args = append(args, "--depth", strconv.Itoa(opts.Depth), "--no-single-branch")
+	}
+	if opts.Filter != "" {
+		args = append(args, "--filter", opts.Filter)
+	}
+	cmd := exec.Command("git", append(args, url, dir)...)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("failed to clone %s: %w\noutput: %s", url, err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// IsPartialClone reports whether the repository in dir is a partial clone,
+// which fetches missing objects on demand. Commands that read every blob,
+// such as TreeSize, are slow in one.
+// If dir is empty, the current working directory is used.
+func IsPartialClone(dir string) bool {
+	// Git records the remote objects come from as a promisor remote, and
+	// older versions also set extensions.partialClone
+	cmd := exec.Command("git", "config", "--get-regexp", `^(extensions\.partialclone|remote\..*\.promisor)$`)
+	if dir != "" {
+		cmd.Dir = dir
+	}
+	out, err := cmd.Output()
+	if err != nil {
+		return false
+	}
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		if _, value, _ := strings.Cut(line, " "); value != "" && value != "false" {
+			return true
+		}
+	}
+	return false
+}
+
+// PullFastForward fetches from the upstream of the current branch and
+// fast-forwards to it. It fails rather than creating a merge commit.
+// If dir is empty, the current working directory is used.
+func PullFastForward(dir string) error {
+	cmd := exec.Command("git", "pull", "--quiet", "--ff-only")
+	if dir != "" {
+		cmd.Dir = dir
+	}
+
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("failed to pull: %w\noutput: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// RefExists reports whether ref, such as "refs/heads/main", exists.
+// If dir is empty, the current working directory is used.
+func RefExists(dir, ref string) bool {
+	cmd := exec.Command("git", "rev-parse", "--verify", "--quiet", ref)
+	if dir != "" {
+		cmd.Dir = dir
+	}
+	return cmd.Run() == nil
+}
+
+// TrackRemoteBranch ensures a local branch exists for branch, creating it
+// to track remoteName/branch if needed. It is a no-op if the local branch
+// already exists. If remoteName is empty, "origin" is used.
+// If dir is empty, the current working directory is used.
+func TrackRemoteBranch(dir, remoteName, branch string) error {
+	if remoteName == "" {
+		remoteName = "origin"
+	}
+
+	if RefExists(dir, "refs/heads/"+branch) {
+		return nil
+	}
+
+	cmd := exec.Command("git", "branch", "--track", branch, remoteName+"/"+branch)
+	if dir != "" {
+		cmd.Dir = dir
+	}
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("failed to track %s/%s: %w\noutput: %s", remoteName, branch, err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// WorktreeForBranch returns the path of the worktree (the main checkout or a
+// linked one) that has branch checked out, or "" if none does. Git refuses
+// to check a branch out in two worktrees at once.
+// If dir is empty, the current working directory is used.
+func WorktreeForBranch(dir, branch string) (string, error) {
+	cmd := exec.Command("git", "worktree", "list", "--porcelain")
+	if dir != "" {
+		cmd.Dir = dir
+	}
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to list worktrees: %w", err)
+	}
+
+	var path string
+	for _, line := range strings.Split(string(out), "\n") {
+		if p, ok := strings.CutPrefix(line, "worktree "); ok {
+			path = p
+		} else if line == "branch refs/heads/"+branch {
+			return path, nil
+		}
+	}
+	return "", nil
+}
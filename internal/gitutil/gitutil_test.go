@@ -1,11 +1,14 @@
 package gitutil
 
 import (
+	"context"
 	"errors"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 )
 
 // setupTestRepo creates a temporary git repository for testing.
@@ -332,3 +335,553 @@ func TestIsInsideWorkTree(t *testing.T) {
 		}
 	})
 }
+
+func TestPush(t *testing.T) {
+	repoDir := setupTestRepo(t)
+
+	remoteDir := t.TempDir()
+	cmd := exec.Command("git", "init", "--bare")
+	cmd.Dir = remoteDir
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("git init --bare failed: %v", err)
+	}
+
+	cmd = exec.Command("git", "remote", "add", "origin", remoteDir)
+	cmd.Dir = repoDir
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("git remote add failed: %v", err)
+	}
+
+	branch, err := CurrentBranch(repoDir)
+	if err != nil {
+		t.Fatalf("CurrentBranch() failed: %v", err)
+	}
+
+	t.Run("pushes branch", func(t *testing.T) {
+		if err := Push(repoDir, "", branch); err != nil {
+			t.Fatalf("Push() failed: %v", err)
+		}
+
+		cmd := exec.Command("git", "rev-parse", "--verify", "refs/heads/"+branch)
+		cmd.Dir = remoteDir
+		if err := cmd.Run(); err != nil {
+			t.Errorf("branch %s not found on remote: %v", branch, err)
+		}
+	})
+
+	t.Run("unknown remote", func(t *testing.T) {
+		if err := Push(repoDir, "nonexistent", branch); err == nil {
+			t.Error("Push() to unknown remote should fail")
+		}
+	})
+}
+
+func TestTreeSize(t *testing.T) {
+	repoDir := setupTestRepo(t)
+
+	// README.md from setupTestRepo is "# Test\n" (7 bytes)
+	size, err := TreeSize(repoDir, "")
+	if err != nil {
+		t.Fatalf("TreeSize() failed: %v", err)
+	}
+	if size != 7 {
+		t.Errorf("TreeSize() = %d, want 7", size)
+	}
+
+	size, err = TreeSize(repoDir, "", "missing")
+	if err != nil {
+		t.Fatalf("TreeSize() with paths failed: %v", err)
+	}
+	if size != 0 {
+		t.Errorf("TreeSize() of a missing path = %d, want 0", size)
+	}
+
+	if _, err := TreeSize(repoDir, "nonexistent-rev"); err == nil {
+		t.Error("TreeSize() with unknown rev should fail")
+	}
+}
+
+func TestIsRemoteURL(t *testing.T) {
+	tests := []struct {
+		in   string
+		want bool
+	}{
+		{"https://github.com/user/repo.git", true},
+		{"ssh://git@github.com/user/repo", true},
+		{"file:///srv/git/repo.git", true},
+		{"git@github.com:user/repo.git", true},
+		{"/home/user/repo", false},
+		{"../repo", false},
+		{"~/src/repo", false},
+		{"dir/with:colon", false},
+	}
+	for _, tt := range tests {
+		if got := IsRemoteURL(tt.in); got != tt.want {
+			t.Errorf("IsRemoteURL(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestCloneAndTrack(t *testing.T) {
+	upstream := setupTestRepo(t)
+	branch, err := CurrentBranch(upstream)
+	if err != nil {
+		t.Fatalf("CurrentBranch() failed: %v", err)
+	}
+
+	cmd := exec.Command("git", "branch", "feature")
+	cmd.Dir = upstream
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("git branch failed: %v\n%s", err, out)
+	}
+
+	cloneDir := filepath.Join(t.TempDir(), "clone")
+	if err := Clone(upstream, cloneDir, CloneOptions{}); err != nil {
+		t.Fatalf("Clone() failed: %v", err)
+	}
+	if got, _ := CurrentBranch(cloneDir); got != branch {
+		t.Errorf("clone branch = %q, want %q", got, branch)
+	}
+
+	if err := PullFastForward(cloneDir); err != nil {
+		t.Errorf("PullFastForward() failed: %v", err)
+	}
+
+	if err := TrackRemoteBranch(cloneDir, "", "feature"); err != nil {
+		t.Fatalf("TrackRemoteBranch() failed: %v", err)
+	}
+	cmd = exec.Command("git", "rev-parse", "--verify", "refs/heads/feature")
+	cmd.Dir = cloneDir
+	if err := cmd.Run(); err != nil {
+		t.Errorf("local branch feature not created: %v", err)
+	}
+
+	// Idempotent for existing branches
+	if err := TrackRemoteBranch(cloneDir, "", branch); err != nil {
+		t.Errorf("TrackRemoteBranch() for existing branch failed: %v", err)
+	}
+	if err := TrackRemoteBranch(cloneDir, "", "missing"); err == nil {
+		t.Error("TrackRemoteBranch() for missing remote branch should fail")
+	}
+}
+
+func TestCloneShallowPartial(t *testing.T) {
+	upstream := setupTestRepo(t)
+	for _, args := range [][]string{
+		{"config", "uploadpack.allowFilter", "true"},
+		{"commit", "--allow-empty", "-m", "Second"},
+		{"branch", "feature"},
+	} {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = upstream
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v failed: %v\n%s", args, err, out)
+		}
+	}
+
+	// Local paths are cloned by copying, which ignores depth and filter
+	cloneDir := filepath.Join(t.TempDir(), "clone")
+	if err := Clone("file://"+upstream, cloneDir, CloneOptions{Depth: 1, Filter: "blob:none"}); err != nil {
+		t.Fatalf("Clone() failed: %v", err)
+	}
+
+	count := exec.Command("git", "rev-list", "--count", "HEAD")
+	count.Dir = cloneDir
+	out, err := count.Output()
+	if err != nil {
+		t.Fatalf("git rev-list failed: %v", err)
+	}
+	if got := strings.TrimSpace(string(out)); got != "1" {
+		t.Errorf("clone has %s commits, want 1", got)
+	}
+	if !IsPartialClone(cloneDir) {
+		t.Error("IsPartialClone() = false for a filtered clone")
+	}
+	if IsPartialClone(upstream) {
+		t.Error("IsPartialClone() = true for a full repository")
+	}
+
+	// Other branches are fetched too, so they can be used as bases
+	if err := TrackRemoteBranch(cloneDir, "", "feature"); err != nil {
+		t.Errorf("TrackRemoteBranch() in shallow clone failed: %v", err)
+	}
+}
+
+func TestWorktreeForBranch(t *testing.T) {
+	repo := setupTestRepo(t)
+	branch, err := CurrentBranch(repo)
+	if err != nil {
+		t.Fatalf("CurrentBranch() failed: %v", err)
+	}
+	linked, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	linked = filepath.Join(linked, "linked")
+	for _, args := range [][]string{
+		{"branch", "free"},
+		{"worktree", "add", "-q", "-b", "feature", linked},
+	} {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = repo
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v failed: %v\n%s", args, err, out)
+		}
+	}
+
+	mainPath, _ := filepath.EvalSymlinks(repo)
+	for _, tt := range []struct{ branch, want string }{
+		{branch, mainPath},
+		{"feature", linked},
+		{"free", ""},
+		{"missing", ""},
+	} {
+		got, err := WorktreeForBranch(repo, tt.branch)
+		if err != nil {
+			t.Fatalf("WorktreeForBranch(%q) failed: %v", tt.branch, err)
+		}
+		if got != tt.want {
+			t.Errorf("WorktreeForBranch(%q) = %q, want %q", tt.branch, got, tt.want)
+		}
+	}
+}
+
+func TestWaitForLocks(t *testing.T) {
+	dir := setupTestRepo(t)
+	ctx := context.Background()
+	lock := filepath.Join(dir, ".git", "index.lock")
+
+	if err := WaitForLocks(ctx, dir, time.Second); err != nil {
+		t.Fatalf("WaitForLocks() with no locks failed: %v", err)
+	}
+
+	// A lock held past the timeout fails cleanly
+	if err := os.WriteFile(lock, nil, 0644); err != nil {
+		t.Fatalf("failed to create index.lock: %v", err)
+	}
+	err := WaitForLocks(ctx, dir, 200*time.Millisecond)
+	if !errors.Is(err, ErrRepoLocked) {
+		t.Fatalf("WaitForLocks() error = %v, want ErrRepoLocked", err)
+	}
+
+	// A lock released before the timeout is waited out
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		os.Remove(lock)
+	}()
+	if err := WaitForLocks(ctx, dir, 5*time.Second); err != nil {
+		t.Errorf("WaitForLocks() after release failed: %v", err)
+	}
+
+	// Cancellation stops the wait
+	if err := os.WriteFile(lock, nil, 0644); err != nil {
+		t.Fatalf("failed to create index.lock: %v", err)
+	}
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if err := WaitForLocks(cancelled, dir, 5*time.Second); !errors.Is(err, context.Canceled) {
+		t.Errorf("WaitForLocks() with cancelled context = %v, want context.Canceled", err)
+	}
+}
+
+func TestWaitIdle(t *testing.T) {
+	dir := setupTestRepo(t)
+	ctx := context.Background()
+
+	if err := WaitIdle(ctx, dir, time.Second); err != nil {
+		t.Fatalf("WaitIdle() on idle repo failed: %v", err)
+	}
+
+	if err := os.Mkdir(filepath.Join(dir, ".git", "rebase-merge"), 0755); err != nil {
+		t.Fatalf("failed to simulate rebase: %v", err)
+	}
+	op, err := OperationInProgress(dir)
+	if err != nil || op != "rebase" {
+		t.Errorf("OperationInProgress() = %q, %v; want rebase", op, err)
+	}
+	if err := WaitIdle(ctx, dir, time.Second); !errors.Is(err, ErrOperationInProgress) {
+		t.Errorf("WaitIdle() during rebase = %v, want ErrOperationInProgress", err)
+	}
+}
+
+func TestGitDirsInWorktree(t *testing.T) {
+	dir := setupTestRepo(t)
+	wt := filepath.Join(t.TempDir(), "wt")
+
+	cmd := exec.Command("git", "worktree", "add", "-b", "other", wt)
+	cmd.Dir = dir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("git worktree add failed: %v\n%s", err, out)
+	}
+
+	gitDir, commonDir, err := GitDirs(wt)
+	if err != nil {
+		t.Fatalf("GitDirs() failed: %v", err)
+	}
+	if gitDir == commonDir {
+		t.Errorf("GitDirs() in linked worktree returned same dir %q for both", gitDir)
+	}
+	if filepath.Base(commonDir) != ".git" {
+		t.Errorf("commonDir = %q, want main repo .git", commonDir)
+	}
+
+	// A lock in the main worktree's index doesn't block the linked worktree,
+	// but a config lock in the common dir does
+	if err := os.WriteFile(filepath.Join(commonDir, "index.lock"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if lock, _ := HeldLock(wt); lock != "" {
+		t.Errorf("HeldLock() = %q, want none for another worktree's index", lock)
+	}
+	if err := os.WriteFile(filepath.Join(commonDir, "config.lock"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if lock, _ := HeldLock(wt); filepath.Base(lock) != "config.lock" {
+		t.Errorf("HeldLock() = %q, want config.lock", lock)
+	}
+}
+
+func TestFetchAndFastForward(t *testing.T) {
+	upstream := setupTestRepo(t)
+	branch, err := CurrentBranch(upstream)
+	if err != nil {
+		t.Fatalf("CurrentBranch() failed: %v", err)
+	}
+	clone := filepath.Join(t.TempDir(), "clone")
+	if err := Clone(upstream, clone, CloneOptions{}); err != nil {
+		t.Fatalf("Clone() failed: %v", err)
+	}
+	git := func(dir string, args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v failed: %v\n%s", args, err, out)
+		}
+	}
+	for _, dir := range []string{upstream, clone} {
+		git(dir, "config", "user.email", "test@example.com")
+		git(dir, "config", "user.name", "Test User")
+	}
+	git(clone, "branch", "stale")
+	git(clone, "branch", "rebasing")
+	git(clone, "checkout", "-q", "-b", "diverged")
+	git(clone, "commit", "-q", "--allow-empty", "-m", "local")
+	git(clone, "checkout", "-q", branch)
+	git(upstream, "commit", "-q", "--allow-empty", "-m", "second")
+	git(upstream, "commit", "-q", "--allow-empty", "-m", "third")
+
+	remote, ref, err := Upstream(clone, branch)
+	if err != nil {
+		t.Fatalf("Upstream() failed: %v", err)
+	}
+	if remote != "origin" || ref != "refs/remotes/origin/"+branch {
+		t.Errorf("Upstream() = %q, %q, want origin, refs/remotes/origin/%s", remote, ref, branch)
+	}
+	if remote, ref, _ := Upstream(clone, "stale"); remote != "" || ref != "" {
+		t.Errorf("Upstream() of an untracked branch = %q, %q, want empty", remote, ref)
+	}
+
+	if err := Fetch(clone, ""); err != nil {
+		t.Fatalf("Fetch() failed: %v", err)
+	}
+	if err := Fetch(clone, "nonexistent"); err == nil {
+		t.Error("Fetch() from unknown remote should fail")
+	}
+
+	// Checked out with uncommitted changes: left alone
+	readme := filepath.Join(clone, "README.md")
+	if err := os.WriteFile(readme, []byte("changed\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := FastForward(clone, branch, ref); !errors.Is(err, ErrUncommittedChanges) || n != 2 {
+		t.Errorf("FastForward() of a dirty checkout = %d, %v, want 2, ErrUncommittedChanges", n, err)
+	}
+	git(clone, "checkout", "--", "README.md")
+
+	// Being rebased in a linked worktree, where HEAD is detached: moving
+	// the branch would make the rebase fail to finish
+	wt := filepath.Join(t.TempDir(), "wt")
+	git(clone, "worktree", "add", "-q", wt, "rebasing")
+	git(wt, "-c", "sequence.editor=sed -i 1ibreak", "rebase", "-q", "-i", "HEAD")
+	if n, err := FastForward(clone, "rebasing", ref); !errors.Is(err, ErrOperationInProgress) || n != 2 {
+		t.Errorf("FastForward() of a branch being rebased = %d, %v, want 2, ErrOperationInProgress", n, err)
+	}
+	git(wt, "rebase", "--abort")
+
+	for _, tt := range []struct {
+		branch  string
+		want    int
+		wantErr error
+	}{
+		{branch, 2, nil},  // checked out
+		{branch, 0, nil},  // up to date
+		{"stale", 2, nil}, // not checked out
+		{"diverged", 2, ErrNotFastForward},
+	} {
+		n, err := FastForward(clone, tt.branch, ref)
+		if n != tt.want || !errors.Is(err, tt.wantErr) {
+			t.Errorf("FastForward(%q) = %d, %v, want %d, %v", tt.branch, n, err, tt.want, tt.wantErr)
+		}
+	}
+	for _, b := range []string{branch, "stale"} {
+		if _, n, err := CommitsAheadBehind(clone, ref, b); err != nil || n != 0 {
+			t.Errorf("%s is %d commits behind after FastForward() (%v)", b, n, err)
+		}
+	}
+	if _, n, _ := CommitsAheadBehind(clone, ref, "diverged"); n != 2 {
+		t.Errorf("diverged branch moved: %d commits behind, want 2", n)
+	}
+}
+
+func TestDiffHelpers(t *testing.T) {
+	repo := setupTestRepo(t)
+	base, err := CurrentBranch(repo)
+	if err != nil {
+		t.Fatalf("CurrentBranch() failed: %v", err)
+	}
+	git := func(args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", args...)
+		cmd.Dir = repo
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v failed: %v\n%s", args, err, out)
+		}
+	}
+	write := func(name, content string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(repo, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	git("checkout", "-q", "-b", "feature")
+	write("README.md", "# Changed\nmore\n")
+	write("new.txt", "a\nb\nc\n")
+	git("add", ".")
+	git("commit", "-q", "-m", "feature work")
+	git("commit", "-q", "--allow-empty", "-m", "more work")
+	git("checkout", "-q", base)
+	git("commit", "-q", "--allow-empty", "-m", "base moved on")
+	git("checkout", "-q", "feature")
+
+	ahead, behind, err := CommitsAheadBehind(repo, base, "feature")
+	if err != nil {
+		t.Fatalf("CommitsAheadBehind() failed: %v", err)
+	}
+	if ahead != 2 || behind != 1 {
+		t.Errorf("CommitsAheadBehind() = %d, %d, want 2, 1", ahead, behind)
+	}
+	if _, _, err := CommitsAheadBehind(repo, base, "missing"); err == nil {
+		t.Error("CommitsAheadBehind() with unknown rev should fail")
+	}
+
+	want := DiffSummary{Files: 2, Insertions: 5, Deletions: 1}
+	stat, err := DiffStat(repo, base, "feature")
+	if err != nil {
+		t.Fatalf("DiffStat() failed: %v", err)
+	}
+	if stat != want {
+		t.Errorf("DiffStat() = %+v, want %+v", stat, want)
+	}
+	if got := stat.String(); got != "2 files changed, 5 insertions(+), 1 deletion(-)" {
+		t.Errorf("String() = %q", got)
+	}
+
+	dirty, err := HasUncommittedChanges(repo)
+	if err != nil || dirty {
+		t.Errorf("HasUncommittedChanges() of a clean worktree = %v, %v, want false", dirty, err)
+	}
+	write("untracked.txt", "x\n")
+	if dirty, _ := HasUncommittedChanges(repo); !dirty {
+		t.Error("HasUncommittedChanges() = false with an untracked file")
+	}
+	write("new.txt", "a\n")
+	stat, err = DiffStat(repo, base, "")
+	if err != nil {
+		t.Fatalf("DiffStat() of the worktree failed: %v", err)
+	}
+	if want := (DiffSummary{Files: 2, Insertions: 3, Deletions: 1}); stat != want {
+		t.Errorf("DiffStat() of the worktree = %+v, want %+v", stat, want)
+	}
+}
+
+func TestCommitsAndMerge(t *testing.T) {
+	repo := setupTestRepo(t)
+	base, err := CurrentBranch(repo)
+	if err != nil {
+		t.Fatalf("CurrentBranch() failed: %v", err)
+	}
+	git := func(args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", args...)
+		cmd.Dir = repo
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v failed: %v\n%s", args, err, out)
+		}
+	}
+	commitFile := func(name, content, subject string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(repo, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		git("add", name)
+		git("commit", "-q", "-m", subject)
+	}
+
+	git("checkout", "-q", "-b", "feature")
+	commitFile("a.txt", "a\n", "Add a")
+	commitFile("b.txt", "b\n", "Add b")
+	git("checkout", "-q", "-b", "conflicting", base)
+	commitFile("a.txt", "other\n", "Add another a")
+	git("checkout", "-q", "-b", "other", base)
+
+	commits, err := Commits(repo, base, "feature")
+	if err != nil {
+		t.Fatalf("Commits() failed: %v", err)
+	}
+	if len(commits) != 2 || commits[0].Subject != "Add b" || commits[1].Subject != "Add a" || commits[0].Hash == "" {
+		t.Errorf("Commits() = %+v, want Add b, Add a", commits)
+	}
+	if commits, err := Commits(repo, "feature", base); err != nil || len(commits) != 0 {
+		t.Errorf("Commits() with nothing new = %+v, %v", commits, err)
+	}
+
+	// Not checked out: fast-forwarded only
+	if err := Merge(repo, base, "feature"); err != nil {
+		t.Fatalf("Merge() fast-forward failed: %v", err)
+	}
+	if err := Merge(repo, base, "conflicting"); !errors.Is(err, ErrNotFastForward) {
+		t.Errorf("Merge() of a diverged branch that isn't checked out = %v, want ErrNotFastForward", err)
+	}
+
+	// Being rebased, with HEAD detached: left alone
+	git("checkout", "-q", "-b", "more", base)
+	commitFile("d.txt", "d\n", "Add d")
+	git("checkout", "-q", base)
+	git("-c", "sequence.editor=sed -i 1ibreak", "rebase", "-q", "-i", "HEAD")
+	if err := Merge(repo, base, "more"); !errors.Is(err, ErrOperationInProgress) {
+		t.Errorf("Merge() into a branch being rebased = %v, want ErrOperationInProgress", err)
+	}
+	git("rebase", "--abort")
+	if commits, _ := Commits(repo, base, "more"); len(commits) != 1 {
+		t.Errorf("branch being rebased moved: %d commits to merge, want 1", len(commits))
+	}
+
+	// Checked out: merged there, and conflicts aborted
+	git("checkout", "-q", base)
+	commitFile("c.txt", "c\n", "Add c")
+	git("checkout", "-q", "other")
+	if err := Merge(repo, "other", base); err != nil {
+		t.Fatalf("Merge() into a checked-out branch failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(repo, "c.txt")); err != nil {
+		t.Errorf("merged file missing from the worktree: %v", err)
+	}
+	if err := Merge(repo, "other", "conflicting"); !errors.Is(err, ErrMergeConflict) {
+		t.Errorf("Merge() with conflicts = %v, want ErrMergeConflict", err)
+	}
+	if dirty, _ := HasUncommittedChanges(repo); dirty {
+		t.Error("conflicted merge left changes behind")
+	}
+}
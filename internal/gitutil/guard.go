@@ -0,0 +1,205 @@
+package gitutil
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrRepoLocked is returned when another git process holds a lock file
+	// in the repository for longer than the caller is willing to wait.
+	ErrRepoLocked = errors.New("repository is locked by another git process")
+
+	// ErrOperationInProgress is returned when a rebase, merge, or similar
+	// multi-step operation is in progress in the repository.
+	ErrOperationInProgress = errors.New("git operation in progress")
+)
+
+// DefaultLockTimeout is how long choir waits for another git process to
+// release the repository's lock files before giving up.
+const DefaultLockTimeout = 10 * time.Second
+
+// lockPollInterval is how often WaitForLocks checks for released locks.
+const lockPollInterval = 100 * time.Millisecond
+
+// worktreeLockFiles and commonLockFiles are the lock files git holds while
+// modifying repository state.
+// index.lock and HEAD.lock live in the per-worktree git dir; the others in
+// the common git dir shared by all worktrees.
+var (
+	worktreeLockFiles = []string{"index.lock", "HEAD.lock"}
+	commonLockFiles   = []string{"config.lock", "packed-refs.lock", "shallow.lock"}
+)
+
+// inProgressMarkers map files git leaves in the git dir during multi-step
+// operations to a description of the operation.
+var inProgressMarkers = []struct {
+	name string
+	op   string
+}{
+	{"rebase-merge", "rebase"},
+	{"rebase-apply", "rebase or am"},
+	{"MERGE_HEAD", "merge"},
+	{"CHERRY_PICK_HEAD", "cherry-pick"},
+	{"REVERT_HEAD", "revert"},
+	{"BISECT_LOG", "bisect"},
+}
+
+// GitDirs returns the git dir of the worktree containing dir and the common
+// git dir shared by all of the repository's worktrees. For the main worktree
+// they are the same. If dir is empty, the current working directory is used.
+func GitDirs(dir string) (gitDir, commonDir string, err error) {
+	cmd := exec.Command("git", "rev-parse", "--git-dir", "--git-common-dir")
+	if dir != "" {
+		cmd.Dir = dir
+	}
+
+	out, err := cmd.Output()
+	if err != nil {
+		return "", "", ErrNotGitRepo
+	}
+
+	lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+	if len(lines) != 2 {
+		return "", "", fmt.Errorf("unexpected git rev-parse output: %q", out)
+	}
+
+	// Paths may be relative to the directory git ran in
+	base := dir
+	if base == "" {
+		if base, err = os.Getwd(); err != nil {
+			return "", "", err
+		}
+	}
+	abs := func(p string) string {
+		if filepath.IsAbs(p) {
+			return p
+		}
+		return filepath.Join(base, p)
+	}
+	return abs(lines[0]), abs(lines[1]), nil
+}
+
+// HeldLock returns the path of a lock file held in the repository at dir,
+// or "" if none is held.
+func HeldLock(dir string) (string, error) {
+	gitDir, commonDir, err := GitDirs(dir)
+	if err != nil {
+		return "", err
+	}
+
+	var paths []string
+	for _, name := range worktreeLockFiles {
+		paths = append(paths, filepath.Join(gitDir, name))
+	}
+	for _, name := range commonLockFiles {
+		paths = append(paths, filepath.Join(commonDir, name))
+	}
+	for _, p := range paths {
+		if _, err := os.Stat(p); err == nil {
+			return p, nil
+		}
+	}
+	return "", nil
+}
+
+// WaitForLocks waits until no git lock files are held in the repository at
+// dir, for at most timeout. Locks are normally held only while a git command
+// runs, so a short wait lets a human's concurrent command finish instead of
+// failing or racing with it. Returns an error wrapping ErrRepoLocked if a
+// lock is still held at the deadline.
+func WaitForLocks(ctx context.Context, dir string, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		lock, err := HeldLock(dir)
+		if err != nil {
+			return err
+		}
+		if lock == "" {
+			return nil
+		}
+		if !time.Now().Before(deadline) {
+			return fmt.Errorf("%w: %s still exists after %s; if no git process is running, remove it and retry",
+				ErrRepoLocked, lock, timeout)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(lockPollInterval):
+		}
+	}
+}
+
+// OperationInProgress returns a description of the multi-step operation
+// (e.g., "rebase", "merge") in progress in the worktree containing dir,
+// or "" if there is none.
+func OperationInProgress(dir string) (string, error) {
+	gitDir, _, err := GitDirs(dir)
+	if err != nil {
+		return "", err
+	}
+
+	for _, m := range inProgressMarkers {
+		if _, err := os.Stat(filepath.Join(gitDir, m.name)); err == nil {
+			return m.op, nil
+		}
+	}
+	return "", nil
+}
+
+// WaitIdle waits for locks in the repository at dir to be released (see
+// WaitForLocks) and then fails with ErrOperationInProgress if a rebase,
+// merge, or similar operation is underway. Call it before changing branches
+// or refs in a repository a human may be working in.
+func WaitIdle(ctx context.Context, dir string, timeout time.Duration) error {
+	if err := WaitForLocks(ctx, dir, timeout); err != nil {
+		return err
+	}
+
+	op, err := OperationInProgress(dir)
+	if err != nil {
+		return err
+	}
+	if op != "" {
+		return fmt.Errorf("%w: %s in progress in %s; finish or abort it and retry", ErrOperationInProgress, op, dir)
+	}
+	return nil
+}
+
+// BranchRebasing reports whether branch is being rebased in any of the
+// repository's worktrees. HEAD is detached during a rebase, so the branch
+// doesn't show as checked out anywhere, but the rebase moves it when it
+// finishes, and fails to if it was moved meanwhile.
+// If dir is empty, the current working directory is used.
+func BranchRebasing(dir, branch string) (bool, error) {
+	_, commonDir, err := GitDirs(dir)
+	if err != nil {
+		return false, err
+	}
+	gitDirs := []string{commonDir}
+	linked, err := filepath.Glob(filepath.Join(commonDir, "worktrees", "*"))
+	if err != nil {
+		return false, err
+	}
+	gitDirs = append(gitDirs, linked...)
+
+	for _, gitDir := range gitDirs {
+		for _, state := range []string{"rebase-merge", "rebase-apply"} {
+			data, err := os.ReadFile(filepath.Join(gitDir, state, "head-name"))
+			if err != nil {
+				continue
+			}
+			if strings.TrimSpace(string(data)) == "refs/heads/"+branch {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,105 @@
+package gitutil
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// ErrMergeConflict is returned by Merge when the merge has conflicts.
+var ErrMergeConflict = errors.New("conflicts")
+
+// Commit is a commit as Commits lists it.
+type Commit struct {
+	Hash    string // Abbreviated
+	Subject string
+}
+
+// Commits returns the commits on rev that base doesn't have, newest first.
+// If dir is empty, the current working directory is used.
+func Commits(dir, base, rev string) ([]Commit, error) {
+	out, err := output(dir, "log", "--format=%h %s", base+".."+rev)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list commits on %s since %s: %w", rev, base, err)
+	}
+	var commits []Commit
+	for _, line := range strings.Split(out, "\n") {
+		if line == "" {
+			continue
+		}
+		hash, subject, _ := strings.Cut(line, " ")
+		commits = append(commits, Commit{Hash: hash, Subject: subject})
+	}
+	return commits, nil
+}
+
+// PageDiff shows the diffstat and patch of the changes made on rev since
+// it branched from base (git diff base...rev) on the terminal, through
+// git's pager if standard output is one.
+// If dir is empty, the current working directory is used.
+func PageDiff(dir, base, rev string) error {
+	cmd := exec.Command("git", "--paginate", "diff", "--stat", "--patch", base+"..."+rev)
+	if dir != "" {
+		cmd.Dir = dir
+	}
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("failed to show diff: %w", err)
+	}
+	return nil
+}
+
+// Merge merges rev into branch. A branch that isn't checked out anywhere
+// can only be fast-forwarded, so it fails with ErrNotFastForward if branch
+// has commits rev doesn't. A branch checked out in a worktree is merged
+// there with git merge, creating a merge commit if needed; the worktree
+// must have no uncommitted changes to tracked files (ErrUncommittedChanges),
+// and a merge with conflicts is aborted, leaving it as it was, and fails
+// with ErrMergeConflict. Either way, as FastForward does, it waits for git's
+// locks and fails with ErrOperationInProgress while the repository or
+// worktree is mid-operation or branch is being rebased.
+// If dir is empty, the current working directory is used.
+func Merge(dir, branch, rev string) error {
+	worktree, err := WorktreeForBranch(dir, branch)
+	if err != nil {
+		return err
+	}
+	if worktree == "" {
+		_, err := FastForward(dir, branch, rev)
+		if errors.Is(err, ErrNotFastForward) {
+			return fmt.Errorf("%w; check %s out to merge %s into it", err, branch, rev)
+		}
+		return err
+	}
+
+	if err := waitToMove(dir, worktree, branch); err != nil {
+		return err
+	}
+	dirty, err := hasChanges(worktree, false)
+	if err != nil {
+		return err
+	}
+	if dirty {
+		return fmt.Errorf("%w: %s has %s checked out", ErrUncommittedChanges, worktree, branch)
+	}
+	cmd := exec.Command("git", "merge", "--quiet", "--no-edit", rev)
+	cmd.Dir = worktree
+	out, err := cmd.CombinedOutput()
+	if err == nil {
+		return nil
+	}
+	// A merge stopped by conflicts leaves MERGE_HEAD behind
+	if _, headErr := output(worktree, "rev-parse", "--verify", "--quiet", "MERGE_HEAD"); headErr == nil {
+		abort := exec.Command("git", "merge", "--abort")
+		abort.Dir = worktree
+		if abortOut, err := abort.CombinedOutput(); err != nil {
+			return fmt.Errorf("%w, and aborting the merge failed: %w\noutput: %s", ErrMergeConflict, err, strings.TrimSpace(string(abortOut)))
+		}
+		return fmt.Errorf("%w merging %s into %s; merge it by hand in %s", ErrMergeConflict, rev, branch, worktree)
+	}
+	return fmt.Errorf("failed to merge %s into %s: %w\noutput: %s", rev, branch, err, strings.TrimSpace(string(out)))
+}
@@ -0,0 +1,202 @@
+// Package hooks notifies the user when environments change state.
+//
+// Hooks are configured in the global config. Each one either runs a shell
+// command or POSTs to a webhook URL, with a JSON Payload describing the
+// event. The payload's "text" field is a one-line summary, so it can be
+// posted to a Slack incoming webhook as is.
+package hooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Quidge/choir/internal/config"
+	"github.com/Quidge/choir/internal/state"
+)
+
+// DefaultTimeout bounds each hook invocation.
+const DefaultTimeout = 10 * time.Second
+
+// Event is an environment lifecycle transition.
+type Event string
+
+const (
+	EventReady   Event = "ready"   // Provisioning finished
+	EventFailed  Event = "failed"  // Provisioning failed or the workspace disappeared
+	EventRemoved Event = "removed" // The environment was removed
+)
+
+// Events lists every event hooks can subscribe to.
+var Events = []Event{EventReady, EventFailed, EventRemoved}
+
+// Payload is the JSON describing an event.
+type Payload struct {
+	Event   Event     `json:"event"`
+	ID      string    `json:"id"`
+	Branch  string    `json:"branch"`
+	Repo    string    `json:"repo"`
+	Backend string    `json:"backend"`
+	Status  string    `json:"status"`
+	Time    time.Time `json:"time"`
+	Text    string    `json:"text"` // Human-readable summary
+}
+
+// NewPayload describes event happening to env at t.
+func NewPayload(event Event, env *state.Environment, t time.Time) Payload {
+	return Payload{
+		Event:   event,
+		ID:      env.ID,
+		Branch:  env.BranchName,
+		Repo:    env.RepoPath,
+		Backend: env.Backend,
+		Status:  string(env.Status),
+		Time:    t.UTC(),
+		Text:    fmt.Sprintf("choir: environment %s (%s) %s", state.ShortID(env.ID), env.BranchName, event),
+	}
+}
+
+// Hook is one configured notification.
+type Hook struct {
+	Events  []Event // Events to fire on; empty means all
+	Command string  // Shell command, or
+	URL     string  // webhook URL
+}
+
+// Matches reports whether h fires on event.
+func (h Hook) Matches(event Event) bool {
+	return len(h.Events) == 0 || slices.Contains(h.Events, event)
+}
+
+// FromConfig validates hook configs and returns the hooks they describe.
+func FromConfig(cfgs []config.HookConfig) ([]Hook, error) {
+	hooks := make([]Hook, 0, len(cfgs))
+	for i, c := range cfgs {
+		if (c.Command == "") == (c.URL == "") {
+			return nil, fmt.Errorf("hooks[%d]: exactly one of command and url must be set", i)
+		}
+		if c.URL != "" {
+			u, err := url.Parse(c.URL)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				return nil, fmt.Errorf("hooks[%d]: url must be an http or https URL", i)
+			}
+		}
+
+		h := Hook{Command: c.Command, URL: c.URL}
+		for _, e := range c.Events {
+			if !slices.Contains(Events, Event(e)) {
+				return nil, fmt.Errorf("hooks[%d]: unknown event %q (want ready, failed, or removed)", i, e)
+			}
+			h.Events = append(h.Events, Event(e))
+		}
+		hooks = append(hooks, h)
+	}
+	return hooks, nil
+}
+
+// Notifier fires hooks.
+type Notifier struct {
+	Hooks   []Hook
+	Timeout time.Duration // Per hook (default DefaultTimeout)
+	Client  *http.Client  // For webhooks (default http.DefaultClient)
+}
+
+// Notify fires every hook matching p.Event, in order. A failing hook does not
+// stop later ones; the failures are returned joined.
+func (n *Notifier) Notify(ctx context.Context, p Payload) error {
+	body, err := json.Marshal(p)
+	if err != nil {
+		return fmt.Errorf("failed to encode event: %w", err)
+	}
+
+	var errs []error
+	for _, h := range n.Hooks {
+		if !h.Matches(p.Event) {
+			continue
+		}
+		if err := n.fire(ctx, h, p, body); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (n *Notifier) fire(ctx context.Context, h Hook, p Payload, body []byte) error {
+	timeout := n.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	if h.URL != "" {
+		return n.post(ctx, h.URL, body)
+	}
+	return runCommand(ctx, h.Command, p, body)
+}
+
+func (n *Notifier) post(ctx context.Context, target string, body []byte) error {
+	client := n.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("webhook %s: %w", redact(target), err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		// The URL may embed a secret token; don't repeat it in the error
+		var uerr *url.Error
+		if errors.As(err, &uerr) {
+			err = uerr.Err
+		}
+		return fmt.Errorf("webhook %s failed: %w", redact(target), err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("webhook %s returned %s", redact(target), resp.Status)
+	}
+	return nil
+}
+
+// redact returns rawURL without its path and query, which often contain
+// credentials (e.g., Slack webhook tokens).
+func redact(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "(invalid url)"
+	}
+	return u.Scheme + "://" + u.Host + "/..."
+}
+
+func runCommand(ctx context.Context, command string, p Payload, body []byte) error {
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	cmd.Stdin = bytes.NewReader(body)
+	cmd.Stderr = &stderr
+	cmd.Env = append(os.Environ(),
+		"CHOIR_EVENT="+string(p.Event),
+		"CHOIR_ENV_ID="+p.ID,
+		"CHOIR_BRANCH="+p.Branch,
+		"CHOIR_REPO="+p.Repo,
+		"CHOIR_STATUS="+p.Status,
+	)
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return fmt.Errorf("hook command %q failed: %w: %s", command, err, msg)
+		}
+		return fmt.Errorf("hook command %q failed: %w", command, err)
+	}
+	return nil
+}
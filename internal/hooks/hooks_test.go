@@ -0,0 +1,114 @@
+package hooks
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Quidge/choir/internal/config"
+	"github.com/Quidge/choir/internal/state"
+)
+
+func TestFromConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     config.HookConfig
+		wantErr string
+	}{
+		{"command", config.HookConfig{Command: "true"}, ""},
+		{"url with events", config.HookConfig{URL: "https://example.com/hook", Events: []string{"ready", "failed"}}, ""},
+		{"neither", config.HookConfig{}, "exactly one"},
+		{"both", config.HookConfig{Command: "true", URL: "https://example.com"}, "exactly one"},
+		{"bad scheme", config.HookConfig{URL: "ftp://example.com"}, "http or https"},
+		{"unknown event", config.HookConfig{Command: "true", Events: []string{"created"}}, "unknown event"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := FromConfig([]config.HookConfig{tt.cfg})
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("FromConfig() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("FromConfig() error = %v, want containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNotify(t *testing.T) {
+	var got []Payload
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var p Payload
+		if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+			t.Errorf("webhook body: %v", err)
+		}
+		got = append(got, p)
+	}))
+	defer srv.Close()
+
+	out := filepath.Join(t.TempDir(), "out")
+	n := &Notifier{Hooks: []Hook{
+		{URL: srv.URL, Events: []Event{EventReady}},
+		{Command: `echo "$CHOIR_EVENT $CHOIR_BRANCH" >> ` + out},
+	}}
+
+	env := &state.Environment{
+		ID:         "abcd0000000000000000000000000000",
+		Backend:    "worktree",
+		RepoPath:   "/repo",
+		BranchName: "env/abcd0000",
+		Status:     state.StatusReady,
+	}
+	ctx := context.Background()
+	if err := n.Notify(ctx, NewPayload(EventReady, env, time.Now())); err != nil {
+		t.Fatalf("Notify(ready) error = %v", err)
+	}
+	env.Status = state.StatusFailed
+	if err := n.Notify(ctx, NewPayload(EventFailed, env, time.Now())); err != nil {
+		t.Fatalf("Notify(failed) error = %v", err)
+	}
+
+	// The webhook only subscribed to ready
+	if len(got) != 1 || got[0].Event != EventReady || got[0].Repo != "/repo" || !strings.Contains(got[0].Text, "abcd0000") {
+		t.Errorf("webhook received %+v, want one ready event", got)
+	}
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "ready env/abcd0000\nfailed env/abcd0000\n"; string(data) != want {
+		t.Errorf("command output = %q, want %q", data, want)
+	}
+}
+
+func TestNotifyFailuresAreJoined(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer srv.Close()
+
+	n := &Notifier{Hooks: []Hook{
+		{Command: "echo oops >&2; exit 1"},
+		{URL: srv.URL + "/secret-token"},
+	}}
+	err := n.Notify(context.Background(), NewPayload(EventRemoved, &state.Environment{ID: "abcd"}, time.Now()))
+	if err == nil {
+		t.Fatal("Notify() error = nil, want failures")
+	}
+	msg := err.Error()
+	if !strings.Contains(msg, "oops") || !strings.Contains(msg, "403") {
+		t.Errorf("error = %q, want both failures", msg)
+	}
+	if strings.Contains(msg, "secret-token") {
+		t.Errorf("error %q leaks the webhook path", msg)
+	}
+}
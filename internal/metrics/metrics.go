@@ -0,0 +1,259 @@
+// Package metrics records choir operation metrics and exposes them in the
+// Prometheus text exposition format.
+//
+// Most choir invocations are short-lived processes, so samples are
+// accumulated in the state database (see state.DB.AddMetrics) rather than in
+// memory. A long-running process such as `choir metrics --listen` or the
+// daemon reads them back on every scrape.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Quidge/choir/internal/state"
+)
+
+// Metric names.
+const (
+	EnvironmentsCreated = "choir_environments_created_total"
+	EnvironmentFailures = "choir_environment_failures_total"
+	SetupDuration       = "choir_setup_duration_seconds"
+	ProvisionDuration   = "choir_provision_duration_seconds"
+	ExecTotal           = "choir_exec_total"
+	ExecDuration        = "choir_exec_duration_seconds"
+	Environments        = "choir_environments"
+	CommandsTotal       = "choir_commands_total"
+)
+
+// Metric types, as written in # TYPE lines.
+const (
+	typeCounter   = "counter"
+	typeGauge     = "gauge"
+	typeHistogram = "histogram"
+)
+
+// DefaultBuckets are histogram upper bounds in seconds, spanning quick
+// commands through long dependency installs.
+var DefaultBuckets = []float64{0.1, 0.5, 1, 5, 10, 30, 60, 120, 300, 600}
+
+type definition struct {
+	name string
+	typ  string
+	help string
+}
+
+// definitions lists every exported metric family in output order.
+var definitions = []definition{
+	{EnvironmentsCreated, typeCounter, "Environments created successfully."},
+	{EnvironmentFailures, typeCounter, "Environment creations that failed, by stage."},
+	{SetupDuration, typeHistogram, "Duration of environment setup in seconds."},
+	{ProvisionDuration, typeHistogram, "Duration of successful environment creations, including setup, in seconds."},
+	{ExecTotal, typeCounter, "Commands run via env exec, by result."},
+	{ExecDuration, typeHistogram, "Duration of commands run via env exec in seconds."},
+	{Environments, typeGauge, "Current environments by status."},
+	{CommandsTotal, typeCounter, "choir commands run, by command and result (only with usage_stats)."},
+}
+
+// Store persists metric deltas. *state.DB implements it.
+type Store interface {
+	AddMetrics(deltas []state.MetricValue) error
+}
+
+// Source provides stored samples and live environment counts.
+// *state.DB implements it.
+type Source interface {
+	ListMetrics() ([]state.MetricValue, error)
+	CountByStatus() (map[state.EnvironmentStatus]int, error)
+}
+
+// Labels renders label name/value pairs (e.g., "backend", "local") in the
+// exposition format. Values are escaped; names are written as given.
+func Labels(pairs ...string) string {
+	parts := make([]string, 0, len(pairs)/2)
+	for i := 0; i+1 < len(pairs); i += 2 {
+		parts = append(parts, pairs[i]+`="`+labelEscaper.Replace(pairs[i+1])+`"`)
+	}
+	return strings.Join(parts, ",")
+}
+
+// labelEscaper escapes label values as the exposition format requires:
+// only backslash, double quote, and newline. Anything else, including
+// non-ASCII text, is written as is.
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// IncCounter adds one to the counter with the given name and labels.
+func IncCounter(s Store, name string, labels ...string) error {
+	return s.AddMetrics([]state.MetricValue{{Name: name, Labels: Labels(labels...), Value: 1}})
+}
+
+// ObserveDuration records d in the histogram with the given name and labels,
+// using DefaultBuckets.
+func ObserveDuration(s Store, name string, d time.Duration, labels ...string) error {
+	base := Labels(labels...)
+	seconds := d.Seconds()
+
+	// Every bucket gets a row (possibly +0) so scrapes always see the
+	// complete bucket set.
+	bounds := make([]float64, 0, len(DefaultBuckets)+1)
+	bounds = append(bounds, DefaultBuckets...)
+	bounds = append(bounds, math.Inf(1))
+
+	deltas := make([]state.MetricValue, 0, len(bounds)+2)
+	for _, le := range bounds {
+		var inc float64
+		if seconds <= le {
+			inc = 1
+		}
+		deltas = append(deltas, state.MetricValue{
+			Name:   name + "_bucket",
+			Labels: joinLabels(base, Labels("le", formatValue(le))),
+			Value:  inc,
+		})
+	}
+	deltas = append(deltas,
+		state.MetricValue{Name: name + "_sum", Labels: base, Value: seconds},
+		state.MetricValue{Name: name + "_count", Labels: base, Value: 1},
+	)
+	return s.AddMetrics(deltas)
+}
+
+// Write writes all metrics from src in the Prometheus text format.
+func Write(w io.Writer, src Source) error {
+	stored, err := src.ListMetrics()
+	if err != nil {
+		return err
+	}
+	counts, err := src.CountByStatus()
+	if err != nil {
+		return err
+	}
+
+	// Live gauges are computed at scrape time rather than stored
+	for _, status := range state.ValidStatuses {
+		stored = append(stored, state.MetricValue{
+			Name:   Environments,
+			Labels: Labels("status", string(status)),
+			Value:  float64(counts[status]),
+		})
+	}
+
+	byFamily := make(map[string][]state.MetricValue)
+	for _, v := range stored {
+		family := familyOf(v.Name)
+		byFamily[family] = append(byFamily[family], v)
+	}
+
+	var b strings.Builder
+	for _, def := range definitions {
+		fmt.Fprintf(&b, "# HELP %s %s\n", def.name, def.help)
+		fmt.Fprintf(&b, "# TYPE %s %s\n", def.name, def.typ)
+
+		samples := byFamily[def.name]
+		sort.SliceStable(samples, func(i, j int) bool {
+			return sampleLess(samples[i], samples[j])
+		})
+		for _, v := range samples {
+			if v.Labels == "" {
+				fmt.Fprintf(&b, "%s %s\n", v.Name, formatValue(v.Value))
+			} else {
+				fmt.Fprintf(&b, "%s{%s} %s\n", v.Name, v.Labels, formatValue(v.Value))
+			}
+		}
+	}
+
+	_, err = io.WriteString(w, b.String())
+	return err
+}
+
+// Handler returns an HTTP handler that serves metrics from src.
+func Handler(src Source) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var b strings.Builder
+		if err := Write(&b, src); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		_, _ = io.WriteString(w, b.String())
+	})
+}
+
+// familyOf returns the metric family a sample name belongs to.
+func familyOf(name string) string {
+	for _, suffix := range []string{"_bucket", "_sum", "_count"} {
+		base, ok := strings.CutSuffix(name, suffix)
+		if !ok {
+			continue
+		}
+		for _, def := range definitions {
+			if def.name == base && def.typ == typeHistogram {
+				return base
+			}
+		}
+	}
+	return name
+}
+
+// sampleLess orders samples by label set, then sample name, with histogram
+// buckets in ascending order of their upper bound.
+func sampleLess(a, b state.MetricValue) bool {
+	aBase, aLE := splitLE(a.Labels)
+	bBase, bLE := splitLE(b.Labels)
+	if aBase != bBase {
+		return aBase < bBase
+	}
+	if a.Name != b.Name {
+		return sampleRank(a.Name) < sampleRank(b.Name)
+	}
+	return aLE < bLE
+}
+
+// sampleRank orders histogram series as bucket, sum, count.
+func sampleRank(name string) int {
+	switch {
+	case strings.HasSuffix(name, "_bucket"):
+		return 0
+	case strings.HasSuffix(name, "_sum"):
+		return 1
+	case strings.HasSuffix(name, "_count"):
+		return 2
+	}
+	return 0
+}
+
+// splitLE separates a trailing le label from a rendered label set and
+// returns its numeric value (0 if absent).
+func splitLE(labels string) (string, float64) {
+	idx := strings.LastIndex(labels, `le="`)
+	if idx < 0 || (idx > 0 && labels[idx-1] != ',') {
+		return labels, 0
+	}
+	raw := strings.TrimSuffix(labels[idx+len(`le="`):], `"`)
+	le, err := strconv.ParseFloat(raw, 64)
+	if err != nil {
+		return labels, 0
+	}
+	return strings.TrimSuffix(labels[:idx], ","), le
+}
+
+func joinLabels(a, b string) string {
+	if a == "" {
+		return b
+	}
+	return a + "," + b
+}
+
+// formatValue formats a sample value as Prometheus expects, including +Inf.
+func formatValue(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
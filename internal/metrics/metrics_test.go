@@ -0,0 +1,159 @@
+package metrics
+
+import (
+	"io"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Quidge/choir/internal/state"
+)
+
+func openTestDB(t *testing.T) *state.DB {
+	t.Helper()
+	db, err := state.Open(":memory:")
+	if err != nil {
+		t.Fatalf("failed to open test database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestWrite(t *testing.T) {
+	db := openTestDB(t)
+
+	for i := 0; i < 2; i++ {
+		if err := IncCounter(db, EnvironmentsCreated, "backend", "local"); err != nil {
+			t.Fatalf("IncCounter() failed: %v", err)
+		}
+	}
+	if err := IncCounter(db, EnvironmentFailures, "backend", "local", "stage", "setup"); err != nil {
+		t.Fatalf("IncCounter() failed: %v", err)
+	}
+	if err := ObserveDuration(db, SetupDuration, 3*time.Second, "backend", "local"); err != nil {
+		t.Fatalf("ObserveDuration() failed: %v", err)
+	}
+	if err := ObserveDuration(db, SetupDuration, 45*time.Second, "backend", "local"); err != nil {
+		t.Fatalf("ObserveDuration() failed: %v", err)
+	}
+
+	env := &state.Environment{
+		ID:         "abc123def456abc123def456abc12345",
+		Backend:    "local",
+		RepoPath:   "/test",
+		BranchName: "env/abc123de",
+		BaseBranch: "main",
+		CreatedAt:  time.Now(),
+		Status:     state.StatusReady,
+	}
+	if err := db.CreateEnvironment(env); err != nil {
+		t.Fatalf("CreateEnvironment() failed: %v", err)
+	}
+
+	var b strings.Builder
+	if err := Write(&b, db); err != nil {
+		t.Fatalf("Write() failed: %v", err)
+	}
+	out := b.String()
+
+	for _, want := range []string{
+		"# TYPE choir_environments_created_total counter\n",
+		`choir_environments_created_total{backend="local"} 2` + "\n",
+		`choir_environment_failures_total{backend="local",stage="setup"} 1` + "\n",
+		"# TYPE choir_setup_duration_seconds histogram\n",
+		`choir_setup_duration_seconds_bucket{backend="local",le="1"} 0` + "\n",
+		`choir_setup_duration_seconds_bucket{backend="local",le="5"} 1` + "\n",
+		`choir_setup_duration_seconds_bucket{backend="local",le="60"} 2` + "\n",
+		`choir_setup_duration_seconds_bucket{backend="local",le="+Inf"} 2` + "\n",
+		`choir_setup_duration_seconds_sum{backend="local"} 48` + "\n",
+		`choir_setup_duration_seconds_count{backend="local"} 2` + "\n",
+		`choir_environments{status="ready"} 1` + "\n",
+		`choir_environments{status="failed"} 0` + "\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q\n%s", want, out)
+		}
+	}
+
+	// Buckets must be in ascending order of their upper bound
+	if strings.Index(out, `le="5"`) > strings.Index(out, `le="10"`) ||
+		strings.Index(out, `le="600"`) > strings.Index(out, `le="+Inf"`) {
+		t.Errorf("histogram buckets out of order:\n%s", out)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	db := openTestDB(t)
+	if err := IncCounter(db, ExecTotal, "result", "success"); err != nil {
+		t.Fatalf("IncCounter() failed: %v", err)
+	}
+
+	rec := httptest.NewRecorder()
+	Handler(db).ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	body, _ := io.ReadAll(rec.Body)
+	if !strings.Contains(string(body), `choir_exec_total{result="success"} 1`) {
+		t.Errorf("body missing exec counter:\n%s", body)
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	db := openTestDB(t)
+
+	must := func(err error) {
+		t.Helper()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	must(IncCounter(db, EnvironmentsCreated, "backend", "local"))
+	must(IncCounter(db, EnvironmentsCreated, "backend", "lima"))
+	must(IncCounter(db, EnvironmentFailures, "backend", "local", "stage", "setup"))
+	must(ObserveDuration(db, SetupDuration, 10*time.Second, "backend", "local"))
+	must(ObserveDuration(db, SetupDuration, 20*time.Second, "backend", "local"))
+	must(ObserveDuration(db, SetupDuration, 30*time.Second, "backend", "lima"))
+	must(ObserveDuration(db, ProvisionDuration, 40*time.Second, "backend", "local"))
+	must(ObserveDuration(db, ProvisionDuration, 60*time.Second, "backend", "lima"))
+	must(IncCounter(db, CommandsTotal, "command", "env list", "result", "success"))
+	must(IncCounter(db, CommandsTotal, "command", "env create", "result", "success"))
+	must(IncCounter(db, CommandsTotal, "command", "env create", "result", "failure"))
+
+	s, err := Summarize(db)
+	if err != nil {
+		t.Fatalf("Summarize() failed: %v", err)
+	}
+	if s.Created != 2 || s.Failures["setup"] != 1 || s.SetupRuns != 3 {
+		t.Errorf("Created = %d, setup failures = %d, SetupRuns = %d", s.Created, s.Failures["setup"], s.SetupRuns)
+	}
+	if s.AvgSetup != 20*time.Second || s.AvgProvision != 50*time.Second {
+		t.Errorf("AvgSetup = %s, AvgProvision = %s", s.AvgSetup, s.AvgProvision)
+	}
+	if rate := s.SetupFailureRate(); rate < 0.33 || rate > 0.34 {
+		t.Errorf("SetupFailureRate() = %f, want 1/3", rate)
+	}
+	want := []CommandUsage{{Command: "env create", Runs: 2, Failures: 1}, {Command: "env list", Runs: 1}}
+	if !slices.Equal(s.Commands, want) {
+		t.Errorf("Commands = %+v, want %+v", s.Commands, want)
+	}
+}
+
+func TestLabels(t *testing.T) {
+	// Only backslash, quote, and newline are escaped, not as Go would
+	got := Labels("repo", "café\tß", "path", `C:\dir "x"`+"\nend")
+	want := `repo="café` + "\t" + `ß",path="C:\\dir \"x\"\nend"`
+	if got != want {
+		t.Errorf("Labels() = %s, want %s", got, want)
+	}
+}
+
+func TestParseLabels(t *testing.T) {
+	got := parseLabels(Labels("command", `env "x", y`, "result", "success", "note", "a\\b\nc"))
+	if got["command"] != `env "x", y` || got["result"] != "success" || got["note"] != "a\\b\nc" || len(got) != 3 {
+		t.Errorf("parseLabels() = %v", got)
+	}
+}
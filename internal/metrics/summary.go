@@ -0,0 +1,134 @@
+package metrics
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Quidge/choir/internal/state"
+)
+
+// Summary condenses the stored metrics into the figures "choir stats"
+// shows: how environments are doing and which commands are used.
+type Summary struct {
+	Environments map[state.EnvironmentStatus]int // Current environments by status
+
+	Created      int            // Environments created successfully
+	Failures     map[string]int // Failed creations by stage (create or setup)
+	SetupRuns    int            // Setups run, successful or not
+	AvgProvision time.Duration  // Mean duration of successful creations, including setup
+	AvgSetup     time.Duration  // Mean duration of setup
+	ExecRuns     int            // Commands run via env exec
+	ExecFailures int            // Commands run via env exec that failed
+	Commands     []CommandUsage // Commands run, most used first (only with usage_stats)
+}
+
+// CommandUsage counts the runs of one choir command.
+type CommandUsage struct {
+	Command  string // Command path without "choir", e.g., "env create"
+	Runs     int
+	Failures int
+}
+
+// SetupFailureRate returns the fraction of setups that failed, or 0 if none
+// have run.
+func (s Summary) SetupFailureRate() float64 {
+	if s.SetupRuns == 0 {
+		return 0
+	}
+	return float64(s.Failures["setup"]) / float64(s.SetupRuns)
+}
+
+// Summarize reads the metrics in src into a Summary.
+func Summarize(src Source) (Summary, error) {
+	stored, err := src.ListMetrics()
+	if err != nil {
+		return Summary{}, err
+	}
+	counts, err := src.CountByStatus()
+	if err != nil {
+		return Summary{}, err
+	}
+
+	s := Summary{Environments: counts, Failures: make(map[string]int)}
+	usage := make(map[string]*CommandUsage)
+	var provisionSum, provisionCount, setupSum float64
+	for _, m := range stored {
+		labels := parseLabels(m.Labels)
+		switch m.Name {
+		case EnvironmentsCreated:
+			s.Created += int(m.Value)
+		case EnvironmentFailures:
+			s.Failures[labels["stage"]] += int(m.Value)
+		case SetupDuration + "_count":
+			s.SetupRuns += int(m.Value)
+		case SetupDuration + "_sum":
+			setupSum += m.Value
+		case ProvisionDuration + "_count":
+			provisionCount += m.Value
+		case ProvisionDuration + "_sum":
+			provisionSum += m.Value
+		case ExecTotal:
+			s.ExecRuns += int(m.Value)
+			if labels["result"] == "failure" {
+				s.ExecFailures += int(m.Value)
+			}
+		case CommandsTotal:
+			u := usage[labels["command"]]
+			if u == nil {
+				u = &CommandUsage{Command: labels["command"]}
+				usage[u.Command] = u
+			}
+			u.Runs += int(m.Value)
+			if labels["result"] == "failure" {
+				u.Failures += int(m.Value)
+			}
+		}
+	}
+	if provisionCount > 0 {
+		s.AvgProvision = seconds(provisionSum / provisionCount)
+	}
+	if s.SetupRuns > 0 {
+		s.AvgSetup = seconds(setupSum / float64(s.SetupRuns))
+	}
+	for _, u := range usage {
+		s.Commands = append(s.Commands, *u)
+	}
+	sort.Slice(s.Commands, func(i, j int) bool {
+		if s.Commands[i].Runs != s.Commands[j].Runs {
+			return s.Commands[i].Runs > s.Commands[j].Runs
+		}
+		return s.Commands[i].Command < s.Commands[j].Command
+	})
+	return s, nil
+}
+
+// seconds converts a float number of seconds to a Duration.
+func seconds(v float64) time.Duration {
+	return time.Duration(v * float64(time.Second))
+}
+
+// parseLabels parses a label set rendered by Labels. Its escapes are a
+// subset of Go's, so values are unquoted as Go strings. Malformed input
+// yields the labels parsed before it.
+func parseLabels(s string) map[string]string {
+	labels := make(map[string]string)
+	for s != "" {
+		name, rest, ok := strings.Cut(s, "=")
+		if !ok {
+			break
+		}
+		quoted, err := strconv.QuotedPrefix(rest)
+		if err != nil {
+			break
+		}
+		value, err := strconv.Unquote(quoted)
+		if err != nil {
+			break
+		}
+		labels[name] = value
+		s = strings.TrimPrefix(rest[len(quoted):], ",")
+	}
+	return labels
+}
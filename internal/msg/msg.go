@@ -0,0 +1,56 @@
+// Package msg prints informational messages: confirmations such as
+// "Removed a1b2" and progress such as "Cloning ...". The global --quiet
+// flag, or setting CHOIR_QUIET to a true value (1, true, yes), suppresses
+// them, leaving a command's results, warnings, and errors.
+//
+// Commands whose stdout is for scripts, such as env create printing the new
+// environment's ID, send their messages to stderr with Fprintf.
+package msg
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// EnvQuiet is the environment variable that enables quiet mode.
+const EnvQuiet = "CHOIR_QUIET"
+
+var quiet bool
+
+// SetQuiet enables or disables quiet mode, in addition to CHOIR_QUIET.
+func SetQuiet(v bool) {
+	quiet = v
+}
+
+// Quiet reports whether quiet mode is enabled.
+func Quiet() bool {
+	if quiet {
+		return true
+	}
+	switch strings.ToLower(strings.TrimSpace(os.Getenv(EnvQuiet))) {
+	case "1", "true", "yes":
+		return true
+	}
+	return false
+}
+
+// Printf writes a message to stdout unless quiet mode is enabled.
+func Printf(format string, args ...any) {
+	Fprintf(os.Stdout, format, args...)
+}
+
+// Println writes a message line to stdout unless quiet mode is enabled.
+func Println(args ...any) {
+	if !Quiet() {
+		fmt.Println(args...)
+	}
+}
+
+// Fprintf writes a message to w unless quiet mode is enabled.
+func Fprintf(w io.Writer, format string, args ...any) {
+	if !Quiet() {
+		fmt.Fprintf(w, format, args...)
+	}
+}
@@ -0,0 +1,29 @@
+package msg
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestQuiet(t *testing.T) {
+	t.Setenv(EnvQuiet, "")
+	var buf bytes.Buffer
+
+	Fprintf(&buf, "Removed %s\n", "a1b2")
+	if got := buf.String(); got != "Removed a1b2\n" {
+		t.Errorf("Fprintf() wrote %q, want the message", got)
+	}
+
+	buf.Reset()
+	SetQuiet(true)
+	Fprintf(&buf, "Removed %s\n", "a1b2")
+	SetQuiet(false)
+	if buf.Len() != 0 {
+		t.Errorf("Fprintf() wrote %q in quiet mode", buf.String())
+	}
+
+	t.Setenv(EnvQuiet, "yes")
+	if !Quiet() {
+		t.Errorf("Quiet() = false with %s=yes", EnvQuiet)
+	}
+}
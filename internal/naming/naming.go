@@ -0,0 +1,198 @@
+// Package naming allocates environment IDs and branch names.
+//
+// The default Random allocator generates random hex or word IDs (see
+// naming.id_format in the global config). Organizations that
+// track workspaces in an internal registry can instead configure an external
+// command (naming.command in the global config) that reserves names and
+// releases them when environments are removed.
+package naming
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/Quidge/choir/internal/config"
+	"github.com/Quidge/choir/internal/gitutil"
+	"github.com/Quidge/choir/internal/state"
+)
+
+// DefaultCommandTimeout bounds each invocation of an external allocator.
+const DefaultCommandTimeout = 30 * time.Second
+
+// ErrInvalidReservation is returned when an allocator returns an unusable ID
+// or branch name.
+var ErrInvalidReservation = errors.New("invalid reservation")
+
+// Request describes the environment being named.
+type Request struct {
+	RepoPath     string `json:"repo_path"`
+	RemoteURL    string `json:"remote_url,omitempty"`
+	BaseBranch   string `json:"base_branch"`
+	BranchPrefix string `json:"branch_prefix"`
+}
+
+// Reservation is an allocated environment ID and branch name.
+type Reservation struct {
+	ID     string `json:"id"`
+	Branch string `json:"branch"`
+}
+
+// Allocator reserves and releases environment names.
+type Allocator interface {
+	// Reserve allocates a new ID and branch name for req.
+	Reserve(ctx context.Context, req Request) (Reservation, error)
+
+	// Release frees a reservation whose environment was removed or never
+	// created.
+	Release(ctx context.Context, res Reservation) error
+}
+
+// ID formats for the Random allocator.
+const (
+	FormatHex   = "hex"
+	FormatWords = "words"
+)
+
+// FromConfig returns the allocator configured in cfg.
+func FromConfig(cfg config.NamingConfig) (Allocator, error) {
+	if cfg.Command == "" {
+		switch cfg.IDFormat {
+		case "", FormatHex, FormatWords:
+		default:
+			return nil, fmt.Errorf("naming.id_format: unknown format %q (want %s or %s)", cfg.IDFormat, FormatHex, FormatWords)
+		}
+		if cfg.IDLength != 0 && (cfg.IDLength < state.MinIDLength || cfg.IDLength > state.MaxIDLength) {
+			return nil, fmt.Errorf("naming.id_length: must be between %d and %d", state.MinIDLength, state.MaxIDLength)
+		}
+		return Random{Format: cfg.IDFormat, Length: cfg.IDLength}, nil
+	}
+	command, err := config.ExpandPath(cfg.Command)
+	if err != nil {
+		return nil, fmt.Errorf("naming.command: %w", err)
+	}
+	return &Command{Path: command, Timeout: DefaultCommandTimeout}, nil
+}
+
+// Random allocates random IDs with branches named <prefix><short-id>.
+// Release is a no-op.
+type Random struct {
+	// Format is FormatHex (the default) or FormatWords.
+	Format string
+
+	// Length is the length of hex IDs (default state.IDLength).
+	Length int
+}
+
+// Reserve generates a new random ID.
+func (r Random) Reserve(ctx context.Context, req Request) (Reservation, error) {
+	var id string
+	var err error
+	if r.Format == FormatWords {
+		id, err = generateWordID()
+	} else {
+		id, err = state.GenerateHexID(cmp.Or(r.Length, state.IDLength))
+	}
+	if err != nil {
+		return Reservation{}, err
+	}
+	return Reservation{ID: id, Branch: DefaultBranch(req.BranchPrefix, id)}, nil
+}
+
+// Release does nothing; random IDs need no bookkeeping.
+func (Random) Release(ctx context.Context, res Reservation) error {
+	return nil
+}
+
+// DefaultBranch returns the branch name for id: prefix (default "env/")
+// followed by the short ID.
+func DefaultBranch(prefix, id string) string {
+	if prefix == "" {
+		prefix = "env/"
+	}
+	return prefix + state.ShortID(id)
+}
+
+// Command delegates allocation to an external executable.
+//
+// The executable is invoked as `PATH reserve` with a JSON Request on stdin
+// and must print a JSON Reservation on stdout. If the branch is omitted, the
+// default <prefix><short-id> is used. It is invoked as `PATH release` with
+// the JSON Reservation on stdin when the environment goes away. A nonzero
+// exit fails the operation; stderr is included in the error.
+type Command struct {
+	Path    string
+	Timeout time.Duration
+}
+
+// Reserve runs the command's reserve action.
+func (c *Command) Reserve(ctx context.Context, req Request) (Reservation, error) {
+	out, err := c.run(ctx, "reserve", req)
+	if err != nil {
+		return Reservation{}, err
+	}
+
+	var res Reservation
+	if err := json.Unmarshal(out, &res); err != nil {
+		return Reservation{}, fmt.Errorf("%w: failed to parse output of %s reserve: %v", ErrInvalidReservation, c.Path, err)
+	}
+	if res.Branch == "" {
+		res.Branch = DefaultBranch(req.BranchPrefix, res.ID)
+	}
+	if err := Validate(res); err != nil {
+		return Reservation{}, err
+	}
+	return res, nil
+}
+
+// Release runs the command's release action.
+func (c *Command) Release(ctx context.Context, res Reservation) error {
+	_, err := c.run(ctx, "release", res)
+	return err
+}
+
+func (c *Command) run(ctx context.Context, action string, input any) ([]byte, error) {
+	data, err := json.Marshal(input)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode %s request: %w", action, err)
+	}
+
+	if c.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.Timeout)
+		defer cancel()
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, c.Path, action)
+	cmd.Stdin = bytes.NewReader(data)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if msg != "" {
+			return nil, fmt.Errorf("naming command %s %s failed: %w: %s", c.Path, action, err, msg)
+		}
+		return nil, fmt.Errorf("naming command %s %s failed: %w", c.Path, action, err)
+	}
+	return stdout.Bytes(), nil
+}
+
+// Validate checks that a reservation has a canonical ID (required for
+// prefix matching; see state.ValidID) and a valid git branch name.
+func Validate(res Reservation) error {
+	if !state.ValidID(res.ID) {
+		return fmt.Errorf("%w: ID %q must be %d to %d lowercase letters, digits, and single hyphens",
+			ErrInvalidReservation, res.ID, state.MinIDLength, state.MaxIDLength)
+	}
+	if err := gitutil.ValidateBranchName(res.Branch); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidReservation, err)
+	}
+	return nil
+}
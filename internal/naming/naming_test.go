@@ -0,0 +1,152 @@
+package naming
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Quidge/choir/internal/config"
+)
+
+func writeScript(t *testing.T, body string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "allocator")
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+body), 0755); err != nil {
+		t.Fatalf("failed to write script: %v", err)
+	}
+	return path
+}
+
+func TestRandom(t *testing.T) {
+	a, err := FromConfig(config.NamingConfig{})
+	if err != nil {
+		t.Fatalf("FromConfig() failed: %v", err)
+	}
+	res, err := a.Reserve(context.Background(), Request{BranchPrefix: "agent/"})
+	if err != nil {
+		t.Fatalf("Reserve() failed: %v", err)
+	}
+	if err := Validate(res); err != nil {
+		t.Errorf("Validate() = %v", err)
+	}
+	if res.Branch != "agent/"+res.ID[:12] {
+		t.Errorf("Branch = %q, want agent/<short-id>", res.Branch)
+	}
+}
+
+func TestRandomFormats(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("hex length", func(t *testing.T) {
+		a, err := FromConfig(config.NamingConfig{IDFormat: FormatHex, IDLength: 16})
+		if err != nil {
+			t.Fatalf("FromConfig() failed: %v", err)
+		}
+		res, err := a.Reserve(ctx, Request{})
+		if err != nil {
+			t.Fatalf("Reserve() failed: %v", err)
+		}
+		if len(res.ID) != 16 || strings.Trim(res.ID, "0123456789abcdef") != "" {
+			t.Errorf("ID = %q, want 16 hex characters", res.ID)
+		}
+	})
+
+	t.Run("words", func(t *testing.T) {
+		a, err := FromConfig(config.NamingConfig{IDFormat: FormatWords})
+		if err != nil {
+			t.Fatalf("FromConfig() failed: %v", err)
+		}
+		res, err := a.Reserve(ctx, Request{})
+		if err != nil {
+			t.Fatalf("Reserve() failed: %v", err)
+		}
+		if err := Validate(res); err != nil {
+			t.Errorf("Validate() = %v", err)
+		}
+		if parts := strings.Split(res.ID, "-"); len(parts) != 3 || len(parts[2]) != wordIDSuffixLength {
+			t.Errorf("ID = %q, want adjective-animal-xxxx", res.ID)
+		}
+		if res.Branch != "env/"+res.ID {
+			t.Errorf("Branch = %q, want the whole word ID", res.Branch)
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		if _, err := FromConfig(config.NamingConfig{IDFormat: "uuid"}); err == nil {
+			t.Error("FromConfig(id_format: uuid) succeeded, want error")
+		}
+		if _, err := FromConfig(config.NamingConfig{IDLength: 4}); err == nil {
+			t.Error("FromConfig(id_length: 4) succeeded, want error")
+		}
+	})
+}
+
+func TestCommand(t *testing.T) {
+	ctx := context.Background()
+	logFile := filepath.Join(t.TempDir(), "log")
+
+	script := writeScript(t, `
+input=$(cat)
+echo "$1 $input" >> `+logFile+`
+case "$1" in
+reserve) echo '{"id":"0123456789abcdef0123456789abcdef","branch":"team/ticket-42"}' ;;
+release) ;;
+*) echo "unknown action" >&2; exit 2 ;;
+esac
+`)
+	a, err := FromConfig(config.NamingConfig{Command: script})
+	if err != nil {
+		t.Fatalf("FromConfig() failed: %v", err)
+	}
+
+	res, err := a.Reserve(ctx, Request{RepoPath: "/repo", BaseBranch: "main"})
+	if err != nil {
+		t.Fatalf("Reserve() failed: %v", err)
+	}
+	if res.ID != "0123456789abcdef0123456789abcdef" || res.Branch != "team/ticket-42" {
+		t.Errorf("Reserve() = %+v", res)
+	}
+	if err := a.Release(ctx, res); err != nil {
+		t.Fatalf("Release() failed: %v", err)
+	}
+
+	log, _ := os.ReadFile(logFile)
+	if !strings.Contains(string(log), `reserve {"repo_path":"/repo"`) ||
+		!strings.Contains(string(log), `release {"id":"0123456789abcdef0123456789abcdef"`) {
+		t.Errorf("unexpected command input log:\n%s", log)
+	}
+}
+
+func TestCommandErrors(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("nonzero exit includes stderr", func(t *testing.T) {
+		a := &Command{Path: writeScript(t, "echo 'registry unavailable' >&2; exit 1\n")}
+		_, err := a.Reserve(ctx, Request{})
+		if err == nil || !strings.Contains(err.Error(), "registry unavailable") {
+			t.Errorf("Reserve() error = %v, want stderr in message", err)
+		}
+	})
+
+	t.Run("invalid ID", func(t *testing.T) {
+		a := &Command{Path: writeScript(t, `echo '{"id":"Not_Canonical"}'`+"\n")}
+		_, err := a.Reserve(ctx, Request{})
+		if !errors.Is(err, ErrInvalidReservation) {
+			t.Errorf("Reserve() error = %v, want ErrInvalidReservation", err)
+		}
+	})
+
+	t.Run("default branch when omitted", func(t *testing.T) {
+		a := &Command{Path: writeScript(t, `echo '{"id":"0123456789abcdef0123456789abcdef"}'`+"\n")}
+		res, err := a.Reserve(ctx, Request{})
+		if err != nil {
+			t.Fatalf("Reserve() failed: %v", err)
+		}
+		if res.Branch != "env/0123456789ab" {
+			t.Errorf("Branch = %q, want env/0123456789ab", res.Branch)
+		}
+	})
+}
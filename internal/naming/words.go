@@ -0,0 +1,63 @@
+package naming
+
+import (
+	"crypto/rand"
+	"fmt"
+	"math/big"
+
+	"github.com/Quidge/choir/internal/state"
+)
+
+// adjectives and animals make up word IDs. Words are lowercase ASCII so
+// that every word ID is canonical.
+var (
+	adjectives = []string{
+		"amber", "bold", "brave", "brisk", "calm", "clever", "cosmic", "crisp",
+		"daring", "eager", "early", "fancy", "fierce", "gentle", "glad", "golden",
+		"grand", "happy", "hidden", "humble", "jolly", "keen", "kind", "lively",
+		"lucky", "merry", "mighty", "misty", "noble", "odd", "patient", "polite",
+		"proud", "quick", "quiet", "rapid", "rustic", "shiny", "silent", "silver",
+		"sleek", "smooth", "snowy", "steady", "sunny", "swift", "tidy", "tiny",
+		"upbeat", "vivid", "warm", "wild", "wise", "witty", "young", "zesty",
+	}
+	animals = []string{
+		"badger", "bat", "bear", "beaver", "bison", "cat", "crane", "crow",
+		"deer", "dingo", "dove", "eagle", "eel", "elk", "falcon", "ferret",
+		"finch", "fox", "gecko", "goat", "goose", "hare", "hawk", "heron",
+		"ibis", "koala", "lemur", "lion", "llama", "lynx", "marten", "mink",
+		"mole", "moose", "newt", "otter", "owl", "panda", "puffin", "quail",
+		"raven", "robin", "seal", "shrew", "sloth", "stoat", "swan", "tapir",
+		"tiger", "toad", "trout", "viper", "walrus", "whale", "wolf", "yak",
+	}
+)
+
+// wordIDSuffixLength is the number of hex characters after the words. The
+// suffix keeps word IDs unique once there are more than a handful of
+// environments.
+const wordIDSuffixLength = 4
+
+// generateWordID returns a random ID of the form adjective-animal-xxxx.
+func generateWordID() (string, error) {
+	adjective, err := pick(adjectives)
+	if err != nil {
+		return "", err
+	}
+	animal, err := pick(animals)
+	if err != nil {
+		return "", err
+	}
+	suffix, err := state.GenerateHexID(state.MinIDLength)
+	if err != nil {
+		return "", err
+	}
+	return adjective + "-" + animal + "-" + suffix[:wordIDSuffixLength], nil
+}
+
+// pick returns a random element of words.
+func pick(words []string) (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(int64(len(words))))
+	if err != nil {
+		return "", fmt.Errorf("failed to generate ID: %w", err)
+	}
+	return words[n.Int64()], nil
+}
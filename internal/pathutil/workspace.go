@@ -0,0 +1,143 @@
+package pathutil
+
+import (
+	"path"
+	"runtime"
+	"strings"
+)
+
+// Style is the path conventions of the OS a workspace's files live on,
+// which may not be the host's: a worktree's files follow the host's, but a
+// VM's follow its Linux guest's. Paths written in the config, such as file
+// mount targets, are normalized to a workspace's style before use, so either
+// separator works in them.
+type Style int
+
+const (
+	// Unix paths are separated by slashes and rooted at /.
+	Unix Style = iota
+
+	// Windows paths are separated by backslashes and rooted at a drive
+	// (C:\) or a network share (\\server\share).
+	Windows
+)
+
+// HostStyle returns the style of the host's paths.
+func HostStyle() Style {
+	if runtime.GOOS == "windows" {
+		return Windows
+	}
+	return Unix
+}
+
+// String returns "unix" or "windows".
+func (s Style) String() string {
+	if s == Windows {
+		return "windows"
+	}
+	return "unix"
+}
+
+// Separator returns the path separator of s.
+func (s Style) Separator() string {
+	if s == Windows {
+		return `\`
+	}
+	return "/"
+}
+
+// Normalize returns p with either separator replaced by s's, and cleaned
+// as path.Clean would: repeated separators and . elements removed and ..
+// elements resolved where possible. A Windows drive or share prefix is
+// kept as is. An empty path stays empty.
+func (s Style) Normalize(p string) string {
+	if p == "" {
+		return ""
+	}
+	slashed := strings.ReplaceAll(p, `\`, "/")
+	if s == Unix {
+		return path.Clean(slashed)
+	}
+
+	vol, rest := windowsVolume(slashed)
+	if rest == "" {
+		return strings.ReplaceAll(vol, "/", `\`)
+	}
+	cleaned := path.Clean(rest)
+	if vol != "" && cleaned == "." {
+		cleaned = ""
+	}
+	return strings.ReplaceAll(vol+cleaned, "/", `\`)
+}
+
+// windowsVolume splits a slash-separated Windows path into its drive
+// ("C:") or share ("//server/share") and the rest.
+func windowsVolume(p string) (vol, rest string) {
+	if len(p) >= 2 && p[1] == ':' && isLetter(p[0]) {
+		return p[:2], p[2:]
+	}
+	if strings.HasPrefix(p, "//") && !strings.HasPrefix(p, "///") {
+		// A share is the first two elements after the leading slashes
+		elems := strings.SplitN(p[2:], "/", 3)
+		if len(elems) >= 2 && elems[0] != "" && elems[1] != "" {
+			vol = "//" + elems[0] + "/" + elems[1]
+			return vol, p[len(vol):]
+		}
+	}
+	return "", p
+}
+
+func isLetter(c byte) bool {
+	return ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z')
+}
+
+// IsAbs reports whether p is absolute in s. Windows paths rooted at a
+// separator without a drive (\Users) count as absolute, since they don't
+// name a path under the workspace.
+func (s Style) IsAbs(p string) bool {
+	n := s.Normalize(p)
+	if s == Unix {
+		return strings.HasPrefix(n, "/")
+	}
+	vol, rest := windowsVolume(strings.ReplaceAll(n, `\`, "/"))
+	if strings.HasPrefix(vol, "//") {
+		return true
+	}
+	return strings.HasPrefix(rest, "/")
+}
+
+// Join returns target resolved against the workspace directory root:
+// target itself if it is absolute, otherwise the two joined. The result
+// is normalized.
+func (s Style) Join(root, target string) string {
+	if s.IsAbs(target) {
+		return s.Normalize(target)
+	}
+	return s.Normalize(root + s.Separator() + target)
+}
+
+// Escapes reports whether target is a relative path that leads out of the
+// directory it is relative to, such as ../x or a/../../x.
+func (s Style) Escapes(target string) bool {
+	if s.IsAbs(target) {
+		return false
+	}
+	n := s.Normalize(target)
+	return n == ".." || strings.HasPrefix(n, ".."+s.Separator())
+}
+
+// Within reports whether p is inside the directory root, not root itself.
+// Windows paths are compared case-insensitively.
+func (s Style) Within(root, p string) bool {
+	r, n := s.Normalize(root), s.Normalize(p)
+	if !strings.HasSuffix(r, s.Separator()) {
+		r += s.Separator()
+	}
+	if len(n) <= len(r) {
+		return false
+	}
+	if s == Windows {
+		return strings.EqualFold(n[:len(r)], r)
+	}
+	return n[:len(r)] == r
+}
@@ -0,0 +1,103 @@
+package pathutil
+
+import "testing"
+
+func TestStyleNormalize(t *testing.T) {
+	tests := []struct {
+		style Style
+		path  string
+		want  string
+	}{
+		{Unix, "", ""},
+		{Unix, "config/app.yaml", "config/app.yaml"},
+		{Unix, `config\app.yaml`, "config/app.yaml"},
+		{Unix, `a/b\..\c//d/.`, "a/c/d"},
+		{Unix, `\home\ubuntu\.aws`, "/home/ubuntu/.aws"},
+		{Unix, "./", "."},
+		{Windows, "config/app.yaml", `config\app.yaml`},
+		{Windows, `a/b\..\c//d/.`, `a\c\d`},
+		{Windows, "C:/Users/me/.aws", `C:\Users\me\.aws`},
+		{Windows, `C:\`, `C:\`},
+		{Windows, "C:", "C:"},
+		{Windows, `//server/share/a/../b`, `\\server\share\b`},
+		{Windows, `\\server\share`, `\\server\share`},
+	}
+	for _, tt := range tests {
+		if got := tt.style.Normalize(tt.path); got != tt.want {
+			t.Errorf("%s.Normalize(%q) = %q, want %q", tt.style, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestStyleIsAbsJoin(t *testing.T) {
+	tests := []struct {
+		style  Style
+		root   string
+		target string
+		abs    bool
+		want   string
+	}{
+		{Unix, "/work", "config/app.yaml", false, "/work/config/app.yaml"},
+		{Unix, "/work", `config\app.yaml`, false, "/work/config/app.yaml"},
+		{Unix, "/work", "/etc/app.yaml", true, "/etc/app.yaml"},
+		{Unix, "/work", `\etc\app.yaml`, true, "/etc/app.yaml"},
+		{Unix, "/work", "C:/app.yaml", false, "/work/C:/app.yaml"},
+		{Windows, `C:\work`, "config/app.yaml", false, `C:\work\config\app.yaml`},
+		{Windows, `C:\work`, `D:\app.yaml`, true, `D:\app.yaml`},
+		{Windows, `C:\work`, "d:/app.yaml", true, `d:\app.yaml`},
+		{Windows, `C:\work`, `\\server\share\app.yaml`, true, `\\server\share\app.yaml`},
+		{Windows, `C:\work`, `\app.yaml`, true, `\app.yaml`},
+		{Windows, `C:\work`, "C:app.yaml", false, `C:\work\C:app.yaml`},
+	}
+	for _, tt := range tests {
+		if got := tt.style.IsAbs(tt.target); got != tt.abs {
+			t.Errorf("%s.IsAbs(%q) = %v, want %v", tt.style, tt.target, got, tt.abs)
+		}
+		if got := tt.style.Join(tt.root, tt.target); got != tt.want {
+			t.Errorf("%s.Join(%q, %q) = %q, want %q", tt.style, tt.root, tt.target, got, tt.want)
+		}
+	}
+}
+
+func TestStyleEscapesWithin(t *testing.T) {
+	for _, style := range []Style{Unix, Windows} {
+		for target, want := range map[string]bool{
+			"config/app.yaml": false,
+			"a/../b":          false,
+			".":               false,
+			"..":              true,
+			"../secrets":      true,
+			`..\secrets`:      true,
+			`a\..\..\secrets`: true,
+			`a/..\../secrets`: true,
+			"..secrets/x":     false,
+			"/etc/../../x":    false, // Absolute, so not relative to anything
+		} {
+			if got := style.Escapes(target); got != want {
+				t.Errorf("%s.Escapes(%q) = %v, want %v", style, target, got, want)
+			}
+		}
+	}
+
+	tests := []struct {
+		style Style
+		root  string
+		path  string
+		want  bool
+	}{
+		{Unix, "/work", "/work/a", true},
+		{Unix, "/work/", `/work\a`, true},
+		{Unix, "/work", "/work", false},
+		{Unix, "/work", "/workshop/a", false},
+		{Unix, "/work", "/work/a/../../etc", false},
+		{Unix, "/", "/etc", true},
+		{Windows, `C:\work`, `c:/WORK/a`, true},
+		{Windows, `C:\work`, `C:\workshop`, false},
+		{Windows, `C:\`, `C:\work`, true},
+	}
+	for _, tt := range tests {
+		if got := tt.style.Within(tt.root, tt.path); got != tt.want {
+			t.Errorf("%s.Within(%q, %q) = %v, want %v", tt.style, tt.root, tt.path, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package preflight
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Memory returns the host's total and available memory in bytes, read from
+// /proc/meminfo.
+func Memory(_ context.Context) (total, available uint64, err error) {
+	data, err := os.ReadFile("/proc/meminfo")
+	if err != nil {
+		return 0, 0, err
+	}
+	for line := range strings.Lines(string(data)) {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		kb, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		switch fields[0] {
+		case "MemTotal:":
+			total = kb * 1024
+		case "MemAvailable:":
+			available = kb * 1024
+		}
+	}
+	return total, available, nil
+}
@@ -0,0 +1,24 @@
+//go:build !linux
+
+package preflight
+
+import (
+	"context"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// Memory returns the host's total memory in bytes with sysctl, as on macOS
+// and the BSDs. Available memory isn't reported by sysctl and is zero.
+func Memory(ctx context.Context) (total, available uint64, err error) {
+	out, err := exec.CommandContext(ctx, "sysctl", "-n", "hw.memsize").Output()
+	if err != nil {
+		return 0, 0, err
+	}
+	total, err = strconv.ParseUint(strings.TrimSpace(string(out)), 10, 64)
+	if err != nil {
+		return 0, 0, err
+	}
+	return total, 0, nil
+}
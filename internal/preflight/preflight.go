@@ -0,0 +1,206 @@
+// Package preflight provides prerequisite checks that run before choir
+// provisions anything, so missing tools or insufficient disk space fail fast
+// with a clear message instead of midway through `git worktree add` or a VM boot.
+package preflight
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"syscall"
+)
+
+// ErrInsufficientSpace is returned when a filesystem lacks the space an
+// operation is estimated to need.
+var ErrInsufficientSpace = errors.New("insufficient disk space")
+
+// ErrInsufficientResources is returned when the host has fewer CPUs or
+// less memory than a workspace asks for.
+var ErrInsufficientResources = errors.New("insufficient host resources")
+
+// Check is a single named prerequisite check.
+type Check struct {
+	// Name is a short description shown in reports (e.g., "git installed").
+	Name string
+
+	// Run performs the check and returns an error describing any problem.
+	Run func(ctx context.Context) error
+}
+
+// Result is the outcome of running a Check.
+type Result struct {
+	Name string
+	Err  error
+}
+
+// Run executes checks in order and returns one result per check.
+// All checks run even if earlier ones fail, so reports are complete.
+func Run(ctx context.Context, checks []Check) []Result {
+	results := make([]Result, 0, len(checks))
+	for _, c := range checks {
+		results = append(results, Result{Name: c.Name, Err: c.Run(ctx)})
+	}
+	return results
+}
+
+// Failed combines the failed results into a single error.
+// Returns nil if every check passed.
+func Failed(results []Result) error {
+	var errs []error
+	for _, r := range results {
+		if r.Err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", r.Name, r.Err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// RequireCommand returns a check that the named executable is in PATH.
+func RequireCommand(name string) Check {
+	return Check{
+		Name: name + " installed",
+		Run: func(ctx context.Context) error {
+			if _, err := exec.LookPath(name); err != nil {
+				return fmt.Errorf("%s not found in PATH", name)
+			}
+			return nil
+		},
+	}
+}
+
+// RequireFreeSpace returns a check that the filesystem holding path has at
+// least needed bytes available. path need not exist yet; the nearest
+// existing ancestor is checked instead.
+func RequireFreeSpace(path string, needed uint64) Check {
+	return Check{
+		Name: "free space at " + path,
+		Run: func(ctx context.Context) error {
+			free, err := FreeSpace(path)
+			if err != nil {
+				return err
+			}
+			if free < needed {
+				return fmt.Errorf("%w: need %s, have %s available",
+					ErrInsufficientSpace, FormatBytes(needed), FormatBytes(free))
+			}
+			return nil
+		},
+	}
+}
+
+// RequireCapacity returns a check that the host has at least cpus CPUs and
+// memory bytes of memory in total, so a workspace asking for more than the
+// host could ever give it fails before provisioning. Zero skips that
+// resource. What other workspaces are using isn't considered.
+func RequireCapacity(cpus int, memory uint64) Check {
+	return Check{
+		Name: "host capacity",
+		Run: func(ctx context.Context) error {
+			var errs []error
+			if have := runtime.NumCPU(); cpus > have {
+				errs = append(errs, fmt.Errorf("%w: need %d CPUs, host has %d", ErrInsufficientResources, cpus, have))
+			}
+			if memory > 0 {
+				total, _, err := Memory(ctx)
+				if err != nil {
+					return fmt.Errorf("failed to read host memory: %w", err)
+				}
+				if memory > total {
+					errs = append(errs, fmt.Errorf("%w: need %s of memory, host has %s",
+						ErrInsufficientResources, FormatBytes(memory), FormatBytes(total)))
+				}
+			}
+			return errors.Join(errs...)
+		},
+	}
+}
+
+// Allocation is CPUs and bytes of memory allocated, or asked for, from the
+// host.
+type Allocation struct {
+	CPUs   int
+	Memory uint64
+}
+
+// CheckHostResources checks whether a workspace asking for want fits on the
+// host alongside running workspaces already holding inUse. It returns an
+// error wrapping ErrInsufficientResources if want is more than the host has
+// at all, or if it and inUse together are more memory than the host has,
+// and a warning for each softer problem: more CPUs committed than the host
+// has, which slows every workspace down, or more memory than is available
+// right now.
+func CheckHostResources(ctx context.Context, want, inUse Allocation) (warnings []string, err error) {
+	if err := RequireCapacity(want.CPUs, want.Memory).Run(ctx); err != nil {
+		return nil, err
+	}
+	if want.Memory > 0 {
+		total, available, err := Memory(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read host memory: %w", err)
+		}
+		if inUse.Memory+want.Memory > total {
+			return nil, fmt.Errorf("%w: need %s of memory, but running environments hold %s of the host's %s",
+				ErrInsufficientResources, FormatBytes(want.Memory), FormatBytes(inUse.Memory), FormatBytes(total))
+		}
+		if available > 0 && want.Memory > available {
+			warnings = append(warnings, fmt.Sprintf("%s of memory requested, but only %s is available",
+				FormatBytes(want.Memory), FormatBytes(available)))
+		}
+	}
+	if have := runtime.NumCPU(); want.CPUs > 0 && inUse.CPUs+want.CPUs > have {
+		warnings = append(warnings, fmt.Sprintf("%d CPUs requested, but running environments already hold %d of the host's %d",
+			want.CPUs, inUse.CPUs, have))
+	}
+	return warnings, nil
+}
+
+// FreeSpace returns the bytes available to unprivileged users on the
+// filesystem holding path, or its nearest existing ancestor.
+func FreeSpace(path string) (uint64, error) {
+	dir, err := existingAncestor(path)
+	if err != nil {
+		return 0, err
+	}
+
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(dir, &st); err != nil {
+		return 0, fmt.Errorf("failed to stat filesystem at %s: %w", dir, err)
+	}
+	return uint64(st.Bavail) * uint64(st.Bsize), nil
+}
+
+// existingAncestor returns path or its nearest ancestor that exists.
+func existingAncestor(path string) (string, error) {
+	dir := filepath.Clean(path)
+	for {
+		if _, err := os.Stat(dir); err == nil {
+			return dir, nil
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", fmt.Errorf("no existing ancestor of %s", path)
+		}
+		dir = parent
+	}
+}
+
+// FormatBytes formats a byte count using binary units (e.g., "1.5 GiB").
+func FormatBytes(n uint64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := uint64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	value := fmt.Sprintf("%.1f", float64(n)/float64(div))
+	value = strings.TrimSuffix(value, ".0")
+	return fmt.Sprintf("%s %ciB", value, "KMGTPE"[exp])
+}
@@ -0,0 +1,136 @@
+package preflight
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestRunAndFailed(t *testing.T) {
+	checks := []Check{
+		{Name: "passes", Run: func(ctx context.Context) error { return nil }},
+		{Name: "fails", Run: func(ctx context.Context) error { return errors.New("boom") }},
+		{Name: "also runs", Run: func(ctx context.Context) error { return nil }},
+	}
+
+	results := Run(context.Background(), checks)
+	if len(results) != 3 {
+		t.Fatalf("Run() returned %d results, want 3", len(results))
+	}
+	if results[1].Err == nil {
+		t.Error("expected second check to fail")
+	}
+
+	err := Failed(results)
+	if err == nil || !strings.Contains(err.Error(), "fails: boom") {
+		t.Errorf("Failed() = %v, want error naming the failed check", err)
+	}
+
+	if err := Failed(results[:1]); err != nil {
+		t.Errorf("Failed() with all passing = %v, want nil", err)
+	}
+}
+
+func TestRequireCommand(t *testing.T) {
+	ctx := context.Background()
+
+	if err := RequireCommand("sh").Run(ctx); err != nil {
+		t.Errorf("RequireCommand(sh) failed: %v", err)
+	}
+	if err := RequireCommand("choir-definitely-missing").Run(ctx); err == nil {
+		t.Error("RequireCommand() for missing binary should fail")
+	}
+}
+
+func TestFreeSpace(t *testing.T) {
+	dir := t.TempDir()
+
+	free, err := FreeSpace(filepath.Join(dir, "does", "not", "exist"))
+	if err != nil {
+		t.Fatalf("FreeSpace() on missing path failed: %v", err)
+	}
+	if free == 0 {
+		t.Error("FreeSpace() = 0, want available bytes")
+	}
+
+	err = RequireFreeSpace(dir, free*1024).Run(context.Background())
+	if !errors.Is(err, ErrInsufficientSpace) {
+		t.Errorf("RequireFreeSpace() error = %v, want ErrInsufficientSpace", err)
+	}
+	if err := RequireFreeSpace(dir, 1).Run(context.Background()); err != nil {
+		t.Errorf("RequireFreeSpace(1 byte) failed: %v", err)
+	}
+}
+
+func TestRequireCapacity(t *testing.T) {
+	ctx := context.Background()
+	total, _, err := Memory(ctx)
+	if err != nil {
+		t.Fatalf("Memory() failed: %v", err)
+	}
+	if total == 0 {
+		t.Fatal("Memory() total = 0, want host memory")
+	}
+
+	if err := RequireCapacity(1, 1).Run(ctx); err != nil {
+		t.Errorf("RequireCapacity(1 CPU, 1 byte) failed: %v", err)
+	}
+	if err := RequireCapacity(0, 0).Run(ctx); err != nil {
+		t.Errorf("RequireCapacity(0, 0) failed: %v", err)
+	}
+	err = RequireCapacity(runtime.NumCPU()+1, total+1).Run(ctx)
+	if !errors.Is(err, ErrInsufficientResources) {
+		t.Fatalf("RequireCapacity() error = %v, want ErrInsufficientResources", err)
+	}
+	if !strings.Contains(err.Error(), "CPUs") || !strings.Contains(err.Error(), "memory") {
+		t.Errorf("RequireCapacity() error = %q, want both CPUs and memory reported", err)
+	}
+}
+
+func TestCheckHostResources(t *testing.T) {
+	ctx := context.Background()
+	total, _, err := Memory(ctx)
+	if err != nil {
+		t.Fatalf("Memory() failed: %v", err)
+	}
+	cpus := runtime.NumCPU()
+
+	warnings, err := CheckHostResources(ctx, Allocation{CPUs: 1, Memory: 1}, Allocation{})
+	if err != nil || len(warnings) != 0 {
+		t.Errorf("CheckHostResources(1 CPU, 1 byte) = %v, %v; want no problems", warnings, err)
+	}
+
+	_, err = CheckHostResources(ctx, Allocation{CPUs: 1, Memory: total / 2}, Allocation{Memory: total/2 + 1})
+	if !errors.Is(err, ErrInsufficientResources) {
+		t.Errorf("CheckHostResources() with memory held error = %v, want ErrInsufficientResources", err)
+	}
+
+	warnings, err = CheckHostResources(ctx, Allocation{CPUs: cpus}, Allocation{CPUs: 1})
+	if err != nil {
+		t.Fatalf("CheckHostResources() with CPUs held failed: %v", err)
+	}
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "CPUs") {
+		t.Errorf("CheckHostResources() warnings = %q, want one about CPUs", warnings)
+	}
+}
+
+func TestFormatBytes(t *testing.T) {
+	tests := []struct {
+		in   uint64
+		want string
+	}{
+		{0, "0 B"},
+		{1023, "1023 B"},
+		{1024, "1 KiB"},
+		{1536, "1.5 KiB"},
+		{5 << 30, "5 GiB"},
+	}
+	for _, tt := range tests {
+		if got := FormatBytes(tt.in); got != tt.want {
+			t.Errorf("FormatBytes(%d) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package prompt
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// ErrCanceled is returned by Choose when the user picks nothing.
+var ErrCanceled = errors.New("canceled")
+
+// chooseListLimit is how many items Choose lists at a time; narrowing
+// the list with a filter shows the rest.
+const chooseListLimit = 20
+
+// Choose asks the user to pick one of items, listed numbered under title, and
+// returns its index. Typing a number picks that item; typing anything else
+// narrows the list to the items that fuzzy-match it (see FuzzyMatch), and
+// picks the item if only one matches. An empty answer or end of input cancels
+// with ErrCanceled. In non-interactive mode, or when stdin isn't a terminal,
+// it fails with ErrNonInteractive; hint should say how to avoid the prompt
+// (e.g., "pass an environment ID").
+func Choose(title string, items []string, hint string) (int, error) {
+	if err := checkInteractive(hint); err != nil {
+		return 0, err
+	}
+	if len(items) == 0 {
+		return 0, ErrCanceled
+	}
+
+	shown := make([]int, len(items))
+	for i := range items {
+		shown[i] = i
+	}
+	in := bufio.NewReader(In)
+	for {
+		fmt.Fprintln(Out, title)
+		for n, i := range shown[:min(len(shown), chooseListLimit)] {
+			fmt.Fprintf(Out, "%3d) %s\n", n+1, items[i])
+		}
+		if len(shown) > chooseListLimit {
+			fmt.Fprintf(Out, "     ... and %d more; type to filter\n", len(shown)-chooseListLimit)
+		}
+		fmt.Fprintf(Out, "Number or filter (empty to cancel): ")
+
+		response, err := in.ReadString('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return 0, fmt.Errorf("failed to read response: %w", err)
+		}
+		response = strings.TrimSpace(response)
+		if response == "" {
+			return 0, ErrCanceled
+		}
+
+		if n, err := strconv.Atoi(response); err == nil {
+			if n >= 1 && n <= min(len(shown), chooseListLimit) {
+				return shown[n-1], nil
+			}
+			fmt.Fprintf(Out, "No item %d\n\n", n)
+			continue
+		}
+
+		var matches []int
+		for _, i := range shown {
+			if FuzzyMatch(items[i], response) {
+				matches = append(matches, i)
+			}
+		}
+		switch len(matches) {
+		case 0:
+			fmt.Fprintf(Out, "Nothing matches %q\n\n", response)
+		case 1:
+			return matches[0], nil
+		default:
+			shown = matches
+			fmt.Fprintln(Out)
+		}
+	}
+}
+
+// FuzzyMatch reports whether the characters of pattern, other than spaces,
+// appear in s in order, ignoring case: "a3f" matches "a13f9 ready".
+func FuzzyMatch(s, pattern string) bool {
+	rest := []rune(strings.ToLower(s))
+	for _, r := range strings.ToLower(pattern) {
+		if unicode.IsSpace(r) {
+			continue
+		}
+		i := 0
+		for i < len(rest) && rest[i] != r {
+			i++
+		}
+		if i == len(rest) {
+			return false
+		}
+		rest = rest[i+1:]
+	}
+	return true
+}
@@ -0,0 +1,159 @@
+// Package prompt asks the user questions on the terminal and honors
+// non-interactive mode, in which no prompt ever blocks on stdin.
+//
+// Non-interactive mode is enabled by the global --non-interactive flag or
+// by setting CHOIR_NONINTERACTIVE to a true value (1, true, yes). In that
+// mode, prompts with a safe default take it, and prompts guarding
+// destructive or interactive actions fail with ErrNonInteractive and a hint
+// describing the flag that answers them up front. Prompts are answered the
+// same way when stdin isn't a terminal, so piped or detached runs fail fast
+// instead of waiting for input that never comes.
+//
+// The global --yes flag, or CHOIR_ASSUME_YES, answers yes to every
+// confirmation instead.
+package prompt
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/mattn/go-isatty"
+)
+
+// EnvNonInteractive is the environment variable that enables non-interactive mode.
+const EnvNonInteractive = "CHOIR_NONINTERACTIVE"
+
+// EnvAssumeYes is the environment variable that answers yes to confirmations.
+const EnvAssumeYes = "CHOIR_ASSUME_YES"
+
+// ErrNonInteractive is returned when an action needs user input but
+// non-interactive mode is enabled.
+var ErrNonInteractive = errors.New("input required but running non-interactively")
+
+var (
+	// In and Out are the prompt's input and output. Tests may replace them.
+	In  io.Reader = os.Stdin
+	Out io.Writer = os.Stdout
+
+	nonInteractive bool
+	assumeYes      bool
+)
+
+// SetNonInteractive enables or disables non-interactive mode, in addition
+// to CHOIR_NONINTERACTIVE.
+func SetNonInteractive(v bool) {
+	nonInteractive = v
+}
+
+// NonInteractive reports whether non-interactive mode is enabled.
+func NonInteractive() bool {
+	return nonInteractive || envTrue(EnvNonInteractive)
+}
+
+// SetAssumeYes enables or disables answering yes to confirmations, in
+// addition to CHOIR_ASSUME_YES.
+func SetAssumeYes(v bool) {
+	assumeYes = v
+}
+
+// AssumeYes reports whether confirmations are answered yes.
+func AssumeYes() bool {
+	return assumeYes || envTrue(EnvAssumeYes)
+}
+
+// envTrue reports whether the environment variable name is set to a true
+// value (1, true, yes).
+func envTrue(name string) bool {
+	switch strings.ToLower(strings.TrimSpace(os.Getenv(name))) {
+	case "1", "true", "yes":
+		return true
+	}
+	return false
+}
+
+// Confirm asks a yes/no question. An empty answer selects def. With
+// AssumeYes, true is returned without prompting; in non-interactive mode,
+// or when stdin isn't a terminal, def is.
+func Confirm(question string, def bool) (bool, error) {
+	if AssumeYes() {
+		return true, nil
+	}
+	if checkInteractive("") != nil {
+		return def, nil
+	}
+	return ask(question, def)
+}
+
+// ConfirmRequired asks a yes/no question that defaults to no and must be
+// answered explicitly. With AssumeYes, true is returned without prompting.
+// In non-interactive mode, or when stdin isn't a terminal, it fails with
+// ErrNonInteractive; hint should name the flag that skips the prompt
+// (e.g., "use --force to remove without confirmation").
+func ConfirmRequired(question, hint string) (bool, error) {
+	if AssumeYes() {
+		return true, nil
+	}
+	if err := checkInteractive(hint); err != nil {
+		return false, err
+	}
+	return ask(question, false)
+}
+
+// checkInteractive returns an error matching ErrNonInteractive, ending
+// with hint, if questions can't be asked: non-interactive mode is enabled
+// or stdin isn't a terminal.
+func checkInteractive(hint string) error {
+	if NonInteractive() {
+		return fmt.Errorf("%w: %s", ErrNonInteractive, hint)
+	}
+	if f, ok := In.(*os.File); ok && !IsTerminal(f) {
+		return fmt.Errorf("%w: stdin is not a terminal; %s", ErrNonInteractive, hint)
+	}
+	return nil
+}
+
+// IsTerminal reports whether f is a terminal. Being a character device
+// isn't enough: /dev/null is one too.
+func IsTerminal(f *os.File) bool {
+	fd := f.Fd()
+	return isatty.IsTerminal(fd) || isatty.IsCygwinTerminal(fd)
+}
+
+// RequireInteractive returns ErrNonInteractive, naming action, if
+// non-interactive mode is enabled or stdin isn't a terminal. Use it before
+// opening shells or editors, or showing anything only a person can act on.
+func RequireInteractive(action string) error {
+	if NonInteractive() {
+		return fmt.Errorf("%w: cannot %s", ErrNonInteractive, action)
+	}
+	if f, ok := In.(*os.File); ok && !IsTerminal(f) {
+		return fmt.Errorf("%w: stdin is not a terminal; cannot %s", ErrNonInteractive, action)
+	}
+	return nil
+}
+
+func ask(question string, def bool) (bool, error) {
+	choices := "[y/N]"
+	if def {
+		choices = "[Y/n]"
+	}
+	fmt.Fprintf(Out, "%s %s ", question, choices)
+
+	response, err := bufio.NewReader(In).ReadString('\n')
+	if err != nil && (!errors.Is(err, io.EOF) || response == "") {
+		return false, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	switch strings.TrimSpace(strings.ToLower(response)) {
+	case "":
+		return def, nil
+	case "y", "yes":
+		return true, nil
+	default:
+		return false, nil
+	}
+}
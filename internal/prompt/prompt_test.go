@@ -0,0 +1,206 @@
+package prompt
+
+import (
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"testing"
+)
+
+func withInput(t *testing.T, input string) {
+	t.Helper()
+	oldIn, oldOut := In, Out
+	In, Out = strings.NewReader(input), io.Discard
+	t.Cleanup(func() { In, Out = oldIn, oldOut })
+}
+
+func TestConfirm(t *testing.T) {
+	t.Setenv(EnvNonInteractive, "")
+
+	tests := []struct {
+		input string
+		def   bool
+		want  bool
+	}{
+		{"y\n", false, true},
+		{"YES\n", false, true},
+		{"n\n", true, false},
+		{"\n", true, true},
+		{"\n", false, false},
+		{"y", false, true}, // no trailing newline
+	}
+	for _, tt := range tests {
+		withInput(t, tt.input)
+		got, err := Confirm("Continue?", tt.def)
+		if err != nil {
+			t.Fatalf("Confirm(%q) failed: %v", tt.input, err)
+		}
+		if got != tt.want {
+			t.Errorf("Confirm(%q, %v) = %v, want %v", tt.input, tt.def, got, tt.want)
+		}
+	}
+
+	withInput(t, "")
+	if _, err := Confirm("Continue?", false); err == nil {
+		t.Error("Confirm() on closed stdin should fail")
+	}
+}
+
+func TestNonInteractive(t *testing.T) {
+	// Input that would answer yes must never be read
+	withInput(t, "y\n")
+
+	t.Run("flag", func(t *testing.T) {
+		t.Setenv(EnvNonInteractive, "")
+		SetNonInteractive(true)
+		defer SetNonInteractive(false)
+
+		if got, err := Confirm("Continue?", false); err != nil || got {
+			t.Errorf("Confirm() = %v, %v; want default false", got, err)
+		}
+	})
+
+	t.Run("env var", func(t *testing.T) {
+		t.Setenv(EnvNonInteractive, "true")
+
+		if got, err := Confirm("Continue?", true); err != nil || !got {
+			t.Errorf("Confirm() = %v, %v; want default true", got, err)
+		}
+		_, err := ConfirmRequired("Remove?", "use --force")
+		if !errors.Is(err, ErrNonInteractive) || !strings.Contains(err.Error(), "use --force") {
+			t.Errorf("ConfirmRequired() error = %v, want ErrNonInteractive with hint", err)
+		}
+		if err := RequireInteractive("open a shell"); !errors.Is(err, ErrNonInteractive) {
+			t.Errorf("RequireInteractive() error = %v, want ErrNonInteractive", err)
+		}
+	})
+
+	t.Run("env var false", func(t *testing.T) {
+		t.Setenv(EnvNonInteractive, "0")
+		if NonInteractive() {
+			t.Error("NonInteractive() = true for CHOIR_NONINTERACTIVE=0")
+		}
+	})
+}
+
+func TestChoose(t *testing.T) {
+	t.Setenv(EnvNonInteractive, "")
+	items := []string{"a13f9  ready  env/a13f9", "b2c4e  ready  feature/login", "c9d0a  stopped  feature/logout"}
+
+	tests := []struct {
+		input   string
+		want    int
+		wantErr error
+	}{
+		{"2\n", 1, nil},
+		{"login\n", 1, nil},           // one match picks it
+		{"log\n2\n", 2, nil},          // numbers index the narrowed list
+		{"zzz\n3\n", 2, nil},          // no match keeps the list
+		{"9\n1\n", 0, nil},            // out of range asks again
+		{"\n", 0, ErrCanceled},        // empty answer
+		{"", 0, ErrCanceled},          // end of input
+		{"feature\n", 0, ErrCanceled}, // still ambiguous at end of input
+	}
+	for _, tt := range tests {
+		withInput(t, tt.input)
+		got, err := Choose("Pick:", items, "pass an ID")
+		if !errors.Is(err, tt.wantErr) {
+			t.Errorf("Choose(%q) error = %v, want %v", tt.input, err, tt.wantErr)
+			continue
+		}
+		if err == nil && got != tt.want {
+			t.Errorf("Choose(%q) = %d, want %d", tt.input, got, tt.want)
+		}
+	}
+
+	SetNonInteractive(true)
+	defer SetNonInteractive(false)
+	withInput(t, "1\n")
+	if _, err := Choose("Pick:", items, "pass an ID"); !errors.Is(err, ErrNonInteractive) {
+		t.Errorf("Choose() in non-interactive mode = %v, want ErrNonInteractive", err)
+	}
+}
+
+func TestFuzzyMatch(t *testing.T) {
+	tests := []struct {
+		s, pattern string
+		want       bool
+	}{
+		{"a13f9 ready", "a3f", true},
+		{"feature/Login", "flog", true},
+		{"feature/login", "FL", true},
+		{"env/a13f9", "env a1", true},
+		{"env/a13f9", "a31", false},
+		{"env/a13f9", "", true},
+	}
+	for _, tt := range tests {
+		if got := FuzzyMatch(tt.s, tt.pattern); got != tt.want {
+			t.Errorf("FuzzyMatch(%q, %q) = %v, want %v", tt.s, tt.pattern, got, tt.want)
+		}
+	}
+}
+
+func TestAssumeYes(t *testing.T) {
+	t.Setenv(EnvNonInteractive, "1")
+	withInput(t, "n\n")
+
+	SetAssumeYes(true)
+	defer SetAssumeYes(false)
+	if got, err := Confirm("Continue?", false); err != nil || !got {
+		t.Errorf("Confirm() = %v, %v; want true", got, err)
+	}
+	if got, err := ConfirmRequired("Remove?", "use --force"); err != nil || !got {
+		t.Errorf("ConfirmRequired() = %v, %v; want true", got, err)
+	}
+
+	SetAssumeYes(false)
+	t.Setenv(EnvAssumeYes, "yes")
+	if got, err := ConfirmRequired("Remove?", "use --force"); err != nil || !got {
+		t.Errorf("ConfirmRequired() with %s = %v, %v; want true", EnvAssumeYes, got, err)
+	}
+}
+
+func TestStdinNotTerminal(t *testing.T) {
+	t.Setenv(EnvNonInteractive, "")
+	t.Setenv(EnvAssumeYes, "")
+
+	// A pipe nobody writes to would block a read forever
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	defer w.Close()
+	oldIn, oldOut := In, Out
+	In, Out = r, io.Discard
+	defer func() { In, Out = oldIn, oldOut }()
+
+	if got, err := Confirm("Start it?", true); err != nil || !got {
+		t.Errorf("Confirm() = %v, %v; want default true", got, err)
+	}
+	_, err = ConfirmRequired("Remove?", "use --force")
+	if !errors.Is(err, ErrNonInteractive) || !strings.Contains(err.Error(), "not a terminal") {
+		t.Errorf("ConfirmRequired() error = %v, want ErrNonInteractive naming stdin", err)
+	}
+	if _, err := Choose("Pick:", []string{"a", "b"}, "pass an ID"); !errors.Is(err, ErrNonInteractive) {
+		t.Errorf("Choose() error = %v, want ErrNonInteractive", err)
+	}
+	if err := RequireInteractive("open a shell"); !errors.Is(err, ErrNonInteractive) {
+		t.Errorf("RequireInteractive() error = %v, want ErrNonInteractive", err)
+	}
+
+	// /dev/null is a character device, but not a terminal
+	null, err := os.Open(os.DevNull)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer null.Close()
+	if IsTerminal(null) {
+		t.Errorf("IsTerminal(%s) = true, want false", os.DevNull)
+	}
+	In = null
+	if _, err := ConfirmRequired("Remove?", "use --force"); !errors.Is(err, ErrNonInteractive) {
+		t.Errorf("ConfirmRequired() from %s error = %v, want ErrNonInteractive", os.DevNull, err)
+	}
+}
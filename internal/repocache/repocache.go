@@ -0,0 +1,218 @@
+// Package repocache caches git repository metadata that rarely changes (the
+// repository root containing a directory, the current branch, and remote
+// URLs) in the state database, so that commands like env list --repo and
+// env create don't spawn several git processes on every run.
+//
+// Each entry is stamped with the modification time and size of the files it
+// was read from (.git, HEAD, or the repository config), so checking out a
+// branch or changing a remote invalidates it without running git. Entries
+// are also trusted for at most TTL.
+package repocache
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/Quidge/choir/internal/gitutil"
+	"github.com/Quidge/choir/internal/state"
+)
+
+// DefaultTTL is how long an entry is trusted while its files are unchanged.
+const DefaultTTL = time.Hour
+
+// errNotCacheable is returned by stamp functions when a value can't be
+// checked cheaply and must come from git.
+var errNotCacheable = errors.New("not cacheable")
+
+// disabled is set by SetDisabled.
+var disabled atomic.Bool
+
+// SetDisabled turns caching off for the rest of the process, for the
+// --no-cache flag. Lookups then always run git.
+func SetDisabled(v bool) {
+	disabled.Store(v)
+}
+
+// Disabled reports whether caching was turned off with SetDisabled.
+func Disabled() bool {
+	return disabled.Load()
+}
+
+// Cache looks up repository metadata, reading through the state database.
+type Cache struct {
+	db  *state.DB
+	ttl time.Duration
+	now func() time.Time
+}
+
+// New returns a cache backed by db. With a nil db, or with caching
+// disabled, every lookup runs git.
+func New(db *state.DB) *Cache {
+	return &Cache{db: db, ttl: DefaultTTL, now: time.Now}
+}
+
+// RepoRoot returns the root of the repository containing dir, like
+// gitutil.RepoRoot. If dir is empty, the current working directory is used.
+func (c *Cache) RepoRoot(dir string) (string, error) {
+	if dir == "" {
+		wd, err := os.Getwd()
+		if err != nil {
+			return gitutil.RepoRoot("")
+		}
+		dir = wd
+	}
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return gitutil.RepoRoot(dir)
+	}
+	return c.lookup("root:"+dir,
+		func(root string) (string, error) { return rootStamp(dir, root) },
+		func() (string, error) { return gitutil.RepoRoot(dir) })
+}
+
+// CurrentBranch returns the branch checked out in repoRoot, like
+// gitutil.CurrentBranch.
+func (c *Cache) CurrentBranch(repoRoot string) (string, error) {
+	stamp, err := headStamp(repoRoot)
+	if err != nil {
+		return gitutil.CurrentBranch(repoRoot)
+	}
+	return c.lookup("branch:"+repoRoot,
+		func(string) (string, error) { return stamp, nil },
+		func() (string, error) { return gitutil.CurrentBranch(repoRoot) })
+}
+
+// RemoteURL returns the URL of remoteName in repoRoot, like
+// gitutil.RemoteURL.
+func (c *Cache) RemoteURL(repoRoot, remoteName string) (string, error) {
+	if remoteName == "" {
+		remoteName = "origin"
+	}
+	stamp, err := configStamp(repoRoot)
+	if err != nil {
+		return gitutil.RemoteURL(repoRoot, remoteName)
+	}
+	return c.lookup("remote:"+remoteName+":"+repoRoot,
+		func(string) (string, error) { return stamp, nil },
+		func() (string, error) { return gitutil.RemoteURL(repoRoot, remoteName) })
+}
+
+// lookup returns the cached value for key if it is within the TTL and its
+// stamp still matches; otherwise it calls load and caches the result.
+// Errors from load are returned and never cached. Failing to write the
+// cache (e.g., to a read-only database) is not an error.
+func (c *Cache) lookup(key string, stamp func(value string) (string, error), load func() (string, error)) (string, error) {
+	enabled := c.db != nil && !Disabled()
+	if enabled {
+		e, err := c.db.GetCacheEntry(key)
+		if err == nil && c.now().Sub(e.CachedAt) < c.ttl {
+			if s, err := stamp(e.Value); err == nil && s == e.Stamp {
+				return e.Value, nil
+			}
+		}
+	}
+
+	value, err := load()
+	if err != nil {
+		return "", err
+	}
+	if enabled {
+		if s, err := stamp(value); err == nil {
+			_ = c.db.PutCacheEntry(&state.CacheEntry{Key: key, Value: value, Stamp: s, CachedAt: c.now()})
+		}
+	}
+	return value, nil
+}
+
+// rootStamp stamps root as the repository root of dir: whether root/.git
+// is a directory or, for a linked worktree, the state of the .git file. The
+// .git directory's own modification time changes with nearly every git
+// command, so it isn't used. A repository nested between dir and root (or a
+// dir that isn't under root, e.g., through a symlink) makes the result not
+// cacheable.
+func rootStamp(dir, root string) (string, error) {
+	for d := dir; d != root; d = filepath.Dir(d) {
+		if d == filepath.Dir(d) {
+			return "", errNotCacheable
+		}
+		if _, err := os.Lstat(filepath.Join(d, ".git")); err == nil {
+			return "", errNotCacheable
+		}
+	}
+	dotGit := filepath.Join(root, ".git")
+	info, err := os.Stat(dotGit)
+	if err != nil {
+		return "", err
+	}
+	if info.IsDir() {
+		return "dir", nil
+	}
+	return fileStamp(dotGit)
+}
+
+// headStamp stamps repoRoot's HEAD, which changes on checkout.
+func headStamp(repoRoot string) (string, error) {
+	gitDir, _, err := gitDirs(repoRoot)
+	if err != nil {
+		return "", err
+	}
+	return fileStamp(filepath.Join(gitDir, "HEAD"))
+}
+
+// configStamp stamps the config shared by repoRoot and its worktrees,
+// which holds the remotes.
+func configStamp(repoRoot string) (string, error) {
+	_, commonDir, err := gitDirs(repoRoot)
+	if err != nil {
+		return "", err
+	}
+	return fileStamp(filepath.Join(commonDir, "config"))
+}
+
+// gitDirs returns the git directory of the worktree at repoRoot and the
+// common directory it shares with the other worktrees, reading the .git
+// file of a linked worktree rather than running git.
+func gitDirs(repoRoot string) (gitDir, commonDir string, err error) {
+	dotGit := filepath.Join(repoRoot, ".git")
+	info, err := os.Stat(dotGit)
+	if err != nil {
+		return "", "", err
+	}
+	if info.IsDir() {
+		return dotGit, dotGit, nil
+	}
+
+	data, err := os.ReadFile(dotGit)
+	if err != nil {
+		return "", "", err
+	}
+	gitDir, ok := strings.CutPrefix(strings.TrimSpace(string(data)), "gitdir: ")
+	if !ok {
+		return "", "", errNotCacheable
+	}
+	if !filepath.IsAbs(gitDir) {
+		gitDir = filepath.Join(repoRoot, gitDir)
+	}
+	commonDir = gitDir
+	if data, err := os.ReadFile(filepath.Join(gitDir, "commondir")); err == nil {
+		commonDir = strings.TrimSpace(string(data))
+		if !filepath.IsAbs(commonDir) {
+			commonDir = filepath.Join(gitDir, commonDir)
+		}
+	}
+	return gitDir, commonDir, nil
+}
+
+// fileStamp returns the modification time and size of path.
+func fileStamp(path string) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%d:%d", info.ModTime().UnixNano(), info.Size()), nil
+}
@@ -0,0 +1,147 @@
+package repocache
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Quidge/choir/internal/state"
+)
+
+// setupTestRepo creates a git repository with one commit on main and an
+// origin remote.
+func setupTestRepo(t *testing.T) string {
+	t.Helper()
+	dir, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to resolve temp dir: %v", err)
+	}
+	run(t, dir, "init", "-b", "main")
+	run(t, dir, "-c", "user.email=test@example.com", "-c", "user.name=Test",
+		"commit", "--allow-empty", "-m", "initial")
+	run(t, dir, "remote", "add", "origin", "https://example.com/a.git")
+	return dir
+}
+
+func run(t *testing.T, dir string, args ...string) {
+	t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("git %v failed: %v\n%s", args, err, out)
+	}
+}
+
+func openTestDB(t *testing.T) *state.DB {
+	t.Helper()
+	db, err := state.Open(":memory:")
+	if err != nil {
+		t.Fatalf("failed to open test database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// poison replaces the cached value for key, keeping its stamp, so that a
+// lookup returning it proves the cache was read.
+func poison(t *testing.T, db *state.DB, key string) {
+	t.Helper()
+	e, err := db.GetCacheEntry(key)
+	if err != nil {
+		t.Fatalf("GetCacheEntry(%q) failed: %v", key, err)
+	}
+	e.Value = "cached"
+	if err := db.PutCacheEntry(e); err != nil {
+		t.Fatalf("PutCacheEntry() failed: %v", err)
+	}
+}
+
+func TestCurrentBranch(t *testing.T) {
+	repo := setupTestRepo(t)
+	db := openTestDB(t)
+	c := New(db)
+
+	if got, err := c.CurrentBranch(repo); err != nil || got != "main" {
+		t.Fatalf("CurrentBranch() = %q, %v; want main", got, err)
+	}
+	poison(t, db, "branch:"+repo)
+	if got, _ := c.CurrentBranch(repo); got != "cached" {
+		t.Errorf("CurrentBranch() = %q, want the cached value", got)
+	}
+
+	// Checking out a branch rewrites HEAD
+	time.Sleep(10 * time.Millisecond)
+	run(t, repo, "checkout", "-q", "-b", "feature")
+	if got, _ := c.CurrentBranch(repo); got != "feature" {
+		t.Errorf("CurrentBranch() after checkout = %q, want feature", got)
+	}
+}
+
+func TestRemoteURL(t *testing.T) {
+	repo := setupTestRepo(t)
+	db := openTestDB(t)
+	c := New(db)
+
+	if got, err := c.RemoteURL(repo, "origin"); err != nil || got != "https://example.com/a.git" {
+		t.Fatalf("RemoteURL() = %q, %v", got, err)
+	}
+	poison(t, db, "remote:origin:"+repo)
+	if got, _ := c.RemoteURL(repo, "origin"); got != "cached" {
+		t.Errorf("RemoteURL() = %q, want the cached value", got)
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	run(t, repo, "remote", "set-url", "origin", "https://example.com/b.git")
+	if got, _ := c.RemoteURL(repo, "origin"); got != "https://example.com/b.git" {
+		t.Errorf("RemoteURL() after set-url = %q", got)
+	}
+}
+
+func TestRepoRoot(t *testing.T) {
+	repo := setupTestRepo(t)
+	db := openTestDB(t)
+	c := New(db)
+	sub := filepath.Join(repo, "sub")
+	if err := os.Mkdir(sub, 0755); err != nil {
+		t.Fatalf("failed to create subdirectory: %v", err)
+	}
+
+	if got, err := c.RepoRoot(sub); err != nil || got != repo {
+		t.Fatalf("RepoRoot() = %q, %v; want %q", got, err, repo)
+	}
+	if e, err := db.GetCacheEntry("root:" + sub); err != nil || e.Value != repo {
+		t.Errorf("cache entry = %+v, %v; want %q", e, err, repo)
+	}
+
+	// A repository created between sub and the cached root takes over
+	run(t, repo, "init", "-q", sub)
+	if got, _ := c.RepoRoot(sub); got != sub {
+		t.Errorf("RepoRoot() with a nested repository = %q, want %q", got, sub)
+	}
+}
+
+func TestExpiryAndDisabled(t *testing.T) {
+	repo := setupTestRepo(t)
+	db := openTestDB(t)
+	c := New(db)
+
+	if _, err := c.CurrentBranch(repo); err != nil {
+		t.Fatalf("CurrentBranch() failed: %v", err)
+	}
+	poison(t, db, "branch:"+repo)
+
+	SetDisabled(true)
+	got, _ := c.CurrentBranch(repo)
+	SetDisabled(false)
+	if got != "main" {
+		t.Errorf("CurrentBranch() with caching disabled = %q, want main", got)
+	}
+
+	poison(t, db, "branch:"+repo)
+	c.now = func() time.Time { return time.Now().Add(DefaultTTL) }
+	if got, _ := c.CurrentBranch(repo); got != "main" {
+		t.Errorf("CurrentBranch() after TTL = %q, want main", got)
+	}
+}
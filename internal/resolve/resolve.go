@@ -0,0 +1,203 @@
+// Package resolve finds the environment a command-line argument names: its
+// ID, a unique prefix of the ID, its branch name, or a path in its
+// workspace. Every command that takes an environment resolves it here, so
+// they all accept the same forms and fail with the same messages.
+//
+// Arguments written as paths (absolute, or starting with ".") are looked
+// up by path only, so "choir env status ." names the environment whose
+// workspace contains the current directory.
+//
+// Visible environments (see VisibleStatuses) are preferred at each step, so
+// an argument that names one active environment resolves to it even if
+// failed or removed environments share the prefix or branch. IDs are tried
+// before branches: a branch whose name is also an ID prefix, such as
+// "a1b2", is only found if no environment's ID starts with it.
+package resolve
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/Quidge/choir/internal/gitutil"
+	"github.com/Quidge/choir/internal/state"
+)
+
+// VisibleStatuses are the statuses shown by default in `choir env list`.
+var VisibleStatuses = []state.EnvironmentStatus{
+	state.StatusProvisioning,
+	state.StatusReady,
+	state.StatusStopped,
+}
+
+// IsVisible reports whether environments with status are shown by default.
+func IsVisible(status state.EnvironmentStatus) bool {
+	return slices.Contains(VisibleStatuses, status)
+}
+
+// ErrInvalid is returned for arguments that can't name an environment:
+// they are neither ID prefixes nor valid branch names.
+var ErrInvalid = errors.New("not an environment ID or branch name")
+
+// AmbiguousError is returned when an argument matches more than one
+// environment. Its message lists them, so the user can pick one.
+type AmbiguousError struct {
+	Arg     string
+	Branch  bool // Arg matched as a branch name rather than an ID prefix
+	Matches []*state.Environment
+}
+
+func (e *AmbiguousError) Error() string {
+	var sb strings.Builder
+	if e.Branch {
+		fmt.Fprintf(&sb, "ambiguous branch %q: matches %d environments\n", e.Arg, len(e.Matches))
+	} else {
+		fmt.Fprintf(&sb, "ambiguous environment ID %q: matches %d environments\n", e.Arg, len(e.Matches))
+	}
+
+	sb.WriteString("\nMatching environments:\n")
+	for _, env := range e.Matches {
+		visibility := "visible"
+		if !IsVisible(env.Status) {
+			visibility = "hidden, use --all to see"
+		}
+		fmt.Fprintf(&sb, "  %s  %s  %s  (%s)\n", state.ShortID(env.ID), env.Status, env.BranchName, visibility)
+	}
+
+	if e.Branch {
+		sb.WriteString("\nHint: use the environment's ID instead")
+	} else {
+		sb.WriteString("\nHint: use a longer prefix or run \"choir env list --all\" to see hidden environments")
+	}
+	return sb.String()
+}
+
+// Unwrap makes AmbiguousError match state.ErrAmbiguousPrefix.
+func (e *AmbiguousError) Unwrap() error {
+	return state.ErrAmbiguousPrefix
+}
+
+// NotFoundError is returned when no environment matches an argument.
+type NotFoundError struct {
+	Arg  string
+	Path bool // Arg is a path outside every environment's workspace
+}
+
+func (e *NotFoundError) Error() string {
+	if e.Path {
+		return fmt.Sprintf("%s is not in an environment's workspace", e.Arg)
+	}
+	return fmt.Sprintf("environment %q not found", e.Arg)
+}
+
+// Unwrap makes NotFoundError match state.ErrEnvironmentNotFound.
+func (e *NotFoundError) Unwrap() error {
+	return state.ErrEnvironmentNotFound
+}
+
+// Environment returns the environment arg names: by path if it is written
+// as one, else by ID or unique ID prefix, or else by branch name. Failures
+// are user-facing: a *NotFoundError, an *AmbiguousError, or one matching
+// ErrInvalid.
+func Environment(db *state.DB, arg string) (*state.Environment, error) {
+	if isPath(arg) {
+		return byPath(db, arg)
+	}
+
+	env, err := byPrefix(db, arg)
+	isPrefix := !errors.Is(err, state.ErrInvalidPrefix)
+	if isPrefix && !errors.Is(err, state.ErrEnvironmentNotFound) {
+		return env, err
+	}
+
+	if !gitutil.IsValidBranchName(arg) {
+		if !isPrefix {
+			return nil, fmt.Errorf("invalid environment %q: %w", arg, ErrInvalid)
+		}
+		return nil, &NotFoundError{Arg: arg}
+	}
+	env, err = byBranch(db, arg)
+	if errors.Is(err, state.ErrEnvironmentNotFound) {
+		return nil, &NotFoundError{Arg: arg}
+	}
+	return env, err
+}
+
+// byPrefix finds the environment whose ID starts with prefix, preferring
+// visible ones. It returns the state package's errors.
+func byPrefix(db *state.DB, prefix string) (*state.Environment, error) {
+	env, err := db.GetEnvironmentByPrefixFiltered(prefix, VisibleStatuses)
+	if errors.Is(err, state.ErrEnvironmentNotFound) {
+		// Fall back to hidden environments
+		env, err = db.GetEnvironmentByPrefix(prefix)
+	}
+	var ambiguous *state.AmbiguousPrefixError
+	if errors.As(err, &ambiguous) {
+		return nil, &AmbiguousError{Arg: prefix, Matches: ambiguous.Matches}
+	}
+	if err != nil && !errors.Is(err, state.ErrEnvironmentNotFound) && !errors.Is(err, state.ErrInvalidPrefix) {
+		return nil, fmt.Errorf("failed to get environment: %w", err)
+	}
+	return env, err
+}
+
+// byBranch finds the environment on branch, preferring visible ones.
+func byBranch(db *state.DB, branch string) (*state.Environment, error) {
+	for _, statuses := range [][]state.EnvironmentStatus{VisibleStatuses, nil} {
+		envs, err := db.ListEnvironments(state.ListOptions{Branch: branch, Statuses: statuses})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get environment: %w", err)
+		}
+		switch len(envs) {
+		case 0:
+			continue
+		case 1:
+			return envs[0], nil
+		default:
+			return nil, &AmbiguousError{Arg: branch, Branch: true, Matches: envs}
+		}
+	}
+	return nil, state.ErrEnvironmentNotFound
+}
+
+// isPath reports whether arg is written as a filesystem path (absolute, or
+// relative starting with "." or "..") rather than an ID or branch name.
+func isPath(arg string) bool {
+	return filepath.IsAbs(arg) || arg == "." || arg == ".." ||
+		strings.HasPrefix(arg, "./") || strings.HasPrefix(arg, "../")
+}
+
+// byPath finds the environment whose workspace is path or contains it, by
+// its backend ID. Only backends whose workspaces are host directories
+// (worktrees) can be found this way.
+func byPath(db *state.DB, path string) (*state.Environment, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, fmt.Errorf("invalid path %s: %w", path, err)
+	}
+	// Workspaces are recorded by the path they were created at, which may
+	// go through a symlink (e.g., /var on macOS) or not
+	dirs := []string{abs}
+	if real, err := filepath.EvalSymlinks(abs); err == nil && real != abs {
+		dirs = append(dirs, real)
+	}
+	for _, dir := range dirs {
+		for {
+			env, err := db.GetEnvironmentByBackendID(dir)
+			if err == nil {
+				return env, nil
+			}
+			if !errors.Is(err, state.ErrEnvironmentNotFound) {
+				return nil, err
+			}
+			parent := filepath.Dir(dir)
+			if parent == dir {
+				break
+			}
+			dir = parent
+		}
+	}
+	return nil, &NotFoundError{Arg: abs, Path: true}
+}
@@ -0,0 +1,318 @@
+package resolve
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Quidge/choir/internal/state"
+)
+
+func TestEnvironment(t *testing.T) {
+	db, err := state.Open(":memory:")
+	if err != nil {
+		t.Fatalf("failed to open test database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	envs := []*state.Environment{
+		{ID: "440707e51272440707e51272440707e5", Status: state.StatusReady},
+		{ID: "4406ed1dd8ba4406ed1dd8ba4406ed1d", Status: state.StatusFailed},
+		{ID: "55aa00000000000000000000000000aa", Status: state.StatusFailed},
+		{ID: "55bb00000000000000000000000000bb", Status: state.StatusRemoved},
+		{ID: "66aa00000000000000000000000000aa", Status: state.StatusReady, BranchName: "feature/login"},
+		{ID: "66bb00000000000000000000000000bb", Status: state.StatusReady, BranchName: "feature/retry"},
+		{ID: "66cc00000000000000000000000000cc", Status: state.StatusRemoved, BranchName: "feature/retry"},
+		{ID: "77aa00000000000000000000000000aa", Status: state.StatusReady, BranchName: "shared"},
+		{ID: "77bb00000000000000000000000000bb", Status: state.StatusStopped, BranchName: "shared"},
+		{ID: "88aa00000000000000000000000000aa", Status: state.StatusReady, BranchName: "55aa"},
+	}
+	for _, env := range envs {
+		env.Backend = "local"
+		env.RepoPath = "/test"
+		if env.BranchName == "" {
+			env.BranchName = "env/" + state.ShortID(env.ID)
+		}
+		env.BaseBranch = "main"
+		env.CreatedAt = time.Now()
+		if err := db.CreateEnvironment(env); err != nil {
+			t.Fatalf("failed to create environment: %v", err)
+		}
+	}
+
+	t.Run("prefers visible match", func(t *testing.T) {
+		env, err := Environment(db, "44")
+		if err != nil {
+			t.Fatalf("Environment() failed: %v", err)
+		}
+		if env.ID != envs[0].ID {
+			t.Errorf("resolved %s, want visible %s", env.ID, envs[0].ID)
+		}
+	})
+
+	t.Run("falls back to hidden match", func(t *testing.T) {
+		env, err := Environment(db, "4406")
+		if err != nil {
+			t.Fatalf("Environment() failed: %v", err)
+		}
+		if env.Status != state.StatusFailed {
+			t.Errorf("resolved status %s, want failed", env.Status)
+		}
+	})
+
+	t.Run("ambiguous among hidden", func(t *testing.T) {
+		_, err := Environment(db, "55")
+		if err == nil || !strings.Contains(err.Error(), "matches 2 environments") {
+			t.Errorf("Environment() error = %v, want ambiguity error", err)
+		}
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		_, err := Environment(db, "ff")
+		if err == nil || !strings.Contains(err.Error(), "not found") {
+			t.Errorf("Environment() error = %v, want not found", err)
+		}
+	})
+
+	t.Run("by branch", func(t *testing.T) {
+		env, err := Environment(db, "feature/login")
+		if err != nil {
+			t.Fatalf("Environment() failed: %v", err)
+		}
+		if env.ID != envs[4].ID {
+			t.Errorf("resolved %s, want %s", env.ID, envs[4].ID)
+		}
+	})
+
+	t.Run("branch prefers visible match", func(t *testing.T) {
+		env, err := Environment(db, "feature/retry")
+		if err != nil {
+			t.Fatalf("Environment() failed: %v", err)
+		}
+		if env.ID != envs[5].ID {
+			t.Errorf("resolved %s, want visible %s", env.ID, envs[5].ID)
+		}
+	})
+
+	t.Run("ambiguous branch", func(t *testing.T) {
+		_, err := Environment(db, "shared")
+		var ambiguous *AmbiguousError
+		if !errors.As(err, &ambiguous) || !ambiguous.Branch || len(ambiguous.Matches) != 2 {
+			t.Errorf("Environment() error = %v, want branch ambiguity error", err)
+		}
+	})
+
+	t.Run("ID prefix before branch", func(t *testing.T) {
+		env, err := Environment(db, "55aa")
+		if err != nil {
+			t.Fatalf("Environment() failed: %v", err)
+		}
+		if env.ID != envs[2].ID {
+			t.Errorf("resolved %s (branch %s), want %s", env.ID, env.BranchName, envs[2].ID)
+		}
+	})
+
+	t.Run("not a branch either", func(t *testing.T) {
+		_, err := Environment(db, "xy_z")
+		if !errors.Is(err, state.ErrEnvironmentNotFound) {
+			t.Errorf("Environment() error = %v, want not found", err)
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		_, err := Environment(db, "a..b")
+		if !errors.Is(err, ErrInvalid) {
+			t.Errorf("Environment() error = %v, want ErrInvalid", err)
+		}
+	})
+}
+
+func TestIsVisible(t *testing.T) {
+	tests := []struct {
+		status  state.EnvironmentStatus
+		visible bool
+	}{
+		{state.StatusProvisioning, true},
+		{state.StatusReady, true},
+		{state.StatusFailed, false},
+		{state.StatusRemoved, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.status), func(t *testing.T) {
+			if got := IsVisible(tt.status); got != tt.visible {
+				t.Errorf("IsVisible(%q) = %v, want %v", tt.status, got, tt.visible)
+			}
+		})
+	}
+}
+
+func TestAmbiguousError(t *testing.T) {
+	now := time.Now()
+
+	t.Run("all visible", func(t *testing.T) {
+		err := &AmbiguousError{
+			Arg: "abc",
+			Matches: []*state.Environment{
+				{ID: "abc123def456abc123def456abc12345", Status: state.StatusReady, CreatedAt: now},
+				{ID: "abc456def789abc456def789abc45678", Status: state.StatusProvisioning, CreatedAt: now},
+			},
+		}
+
+		msg := err.Error()
+
+		// Check header
+		if !strings.Contains(msg, `ambiguous environment ID "abc"`) {
+			t.Errorf("expected header with prefix, got: %s", msg)
+		}
+		if !strings.Contains(msg, "matches 2 environments") {
+			t.Errorf("expected match count, got: %s", msg)
+		}
+
+		// Check environment listings
+		if !strings.Contains(msg, "abc123def456") {
+			t.Errorf("expected first short ID, got: %s", msg)
+		}
+		if !strings.Contains(msg, "abc456def789") {
+			t.Errorf("expected second short ID, got: %s", msg)
+		}
+
+		// Check visibility labels - both should be visible
+		if strings.Count(msg, "(visible)") != 2 {
+			t.Errorf("expected 2 visible labels, got: %s", msg)
+		}
+
+		// Check hint
+		if !strings.Contains(msg, "use a longer prefix") {
+			t.Errorf("expected hint about longer prefix, got: %s", msg)
+		}
+		if !strings.Contains(msg, `choir env list --all`) {
+			t.Errorf("expected hint about --all flag, got: %s", msg)
+		}
+	})
+
+	t.Run("all hidden", func(t *testing.T) {
+		err := &AmbiguousError{
+			Arg: "def",
+			Matches: []*state.Environment{
+				{ID: "def123abc456def123abc456def12345", Status: state.StatusFailed, CreatedAt: now},
+				{ID: "def456abc789def456abc789def45678", Status: state.StatusRemoved, CreatedAt: now},
+			},
+		}
+
+		msg := err.Error()
+
+		// Both should be hidden
+		if strings.Contains(msg, "(visible)") {
+			t.Errorf("expected no visible labels, got: %s", msg)
+		}
+		if strings.Count(msg, "hidden, use --all to see") != 2 {
+			t.Errorf("expected 2 hidden labels, got: %s", msg)
+		}
+	})
+
+	t.Run("mixed visible and hidden", func(t *testing.T) {
+		err := &AmbiguousError{
+			Arg: "44",
+			Matches: []*state.Environment{
+				{ID: "440707e51272440707e51272440707e5", Status: state.StatusReady, CreatedAt: now},
+				{ID: "4406ed1dd8ba4406ed1dd8ba4406ed1d", Status: state.StatusFailed, CreatedAt: now},
+			},
+		}
+
+		msg := err.Error()
+
+		// Check the exact scenario from the issue
+		if !strings.Contains(msg, `ambiguous environment ID "44"`) {
+			t.Errorf("expected header with prefix, got: %s", msg)
+		}
+
+		// One visible, one hidden
+		if strings.Count(msg, "(visible)") != 1 {
+			t.Errorf("expected 1 visible label, got: %s", msg)
+		}
+		if strings.Count(msg, "hidden, use --all to see") != 1 {
+			t.Errorf("expected 1 hidden label, got: %s", msg)
+		}
+
+		// Check status is shown
+		if !strings.Contains(msg, "ready") {
+			t.Errorf("expected ready status, got: %s", msg)
+		}
+		if !strings.Contains(msg, "failed") {
+			t.Errorf("expected failed status, got: %s", msg)
+		}
+	})
+
+	t.Run("large number of matches", func(t *testing.T) {
+		matches := make([]*state.Environment, 5)
+		for i := range matches {
+			matches[i] = &state.Environment{
+				ID:        "aaa123456789012345678901234567" + string(rune('0'+i)),
+				Status:    state.StatusReady,
+				CreatedAt: now,
+			}
+		}
+
+		err := &AmbiguousError{
+			Arg:     "aaa",
+			Matches: matches,
+		}
+
+		msg := err.Error()
+
+		if !strings.Contains(msg, "matches 5 environments") {
+			t.Errorf("expected 5 matches, got: %s", msg)
+		}
+	})
+}
+
+func TestEnvironmentByPath(t *testing.T) {
+	db, err := state.Open(":memory:")
+	if err != nil {
+		t.Fatalf("failed to open test database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	workspace := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(workspace, "src", "pkg"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	env := &state.Environment{
+		ID:         "99aa00000000000000000000000000aa",
+		Backend:    "local",
+		BackendID:  workspace,
+		RepoPath:   "/test",
+		BranchName: "env/99aa",
+		BaseBranch: "main",
+		CreatedAt:  time.Now(),
+		Status:     state.StatusReady,
+	}
+	if err := db.CreateEnvironment(env); err != nil {
+		t.Fatalf("failed to create environment: %v", err)
+	}
+
+	for _, arg := range []string{workspace, filepath.Join(workspace, "src", "pkg")} {
+		got, err := Environment(db, arg)
+		if err != nil || got.ID != env.ID {
+			t.Errorf("Environment(%q) = %v, %v; want %s", arg, got, err, env.ID)
+		}
+	}
+
+	t.Chdir(filepath.Join(workspace, "src"))
+	for _, arg := range []string{".", "./pkg", ".."} {
+		got, err := Environment(db, arg)
+		if err != nil || got.ID != env.ID {
+			t.Errorf("Environment(%q) = %v, %v; want %s", arg, got, err, env.ID)
+		}
+	}
+
+	_, err = Environment(db, t.TempDir())
+	var notFound *NotFoundError
+	if !errors.As(err, &notFound) || !notFound.Path {
+		t.Errorf("Environment(outside) error = %v, want path not found", err)
+	}
+}
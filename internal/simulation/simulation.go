@@ -0,0 +1,440 @@
+// Package simulation drives randomized environment lifecycle operations
+// against the fake backend and an in-memory state database, checking
+// invariants after every step.
+//
+// Each operation calls the same lifecycle code the commands in cmd/env do
+// (env.Provision, env.ExecCommand, env.StopEnvironment,
+// env.StartEnvironment, env.RemoveEnvironment, and env.ReconcileAll), with
+// the fake backend standing in for the configured one, so state-machine bugs
+// in them that only show up under unusual interleavings of failures surface
+// as invariant violations with a reproducible seed.
+package simulation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Quidge/choir/cmd/env"
+	"github.com/Quidge/choir/internal/backend"
+	"github.com/Quidge/choir/internal/backend/fake"
+	"github.com/Quidge/choir/internal/config"
+	"github.com/Quidge/choir/internal/state"
+)
+
+// Config controls a simulation run.
+type Config struct {
+	// Seed seeds the random source. Runs with the same seed and Steps
+	// perform the same sequence of operations.
+	Seed int64
+
+	// Steps is the number of operations to perform.
+	Steps int
+
+	// FaultRate is the probability (0-1) that any backend operation fails.
+	FaultRate float64
+}
+
+// Stats summarizes a completed run.
+type Stats struct {
+	Ops      map[string]int // Operations performed, by name
+	Faults   int            // Backend faults injected
+	Orphaned int            // Workspaces left behind by failed destroys
+}
+
+// Violation is returned when an invariant does not hold.
+type Violation struct {
+	Seed    int64
+	Step    int
+	Op      string
+	Message string
+	History []string // Most recent operations, oldest first
+}
+
+func (v *Violation) Error() string {
+	return fmt.Sprintf("invariant violated at step %d (%s, seed %d): %s\nrecent operations:\n  %s",
+		v.Step, v.Op, v.Seed, v.Message, strings.Join(v.History, "\n  "))
+}
+
+// historySize is the number of recent operations kept for violation reports.
+const historySize = 20
+
+// recordTables are the tables holding records kept for an environment,
+// which must not outlive it.
+var recordTables = []string{"commands", "setup_steps", "diagnostics", "agent_runs", "port_forwards"}
+
+// Simulator holds the state of a simulation run.
+type Simulator struct {
+	cfg     Config
+	rng     *rand.Rand
+	db      *state.DB
+	be      *fake.Backend
+	restore func()
+
+	// orphaned tracks workspaces whose destroy failed with an injected
+	// fault. Removal deletes the record anyway, so these are the only
+	// workspaces allowed to exist without a record.
+	orphaned map[string]bool
+
+	// lost tracks workspaces deleted behind choir's back since the last
+	// reconcile. Until then, their environments may still claim them.
+	lost map[string]bool
+
+	// faults is off while the simulator changes the fake backend itself.
+	faults bool
+
+	stats   Stats
+	history []string
+}
+
+// New returns a simulator backed by an in-memory database and a fake
+// backend, which the lifecycle operations in package env use until Close.
+// They also read the global config and keep setup logs in the data
+// directory, so callers should point XDG_CONFIG_HOME and XDG_DATA_HOME at
+// scratch directories.
+func New(cfg Config) (*Simulator, error) {
+	db, err := state.Open(":memory:")
+	if err != nil {
+		return nil, fmt.Errorf("failed to open state database: %w", err)
+	}
+
+	s := &Simulator{
+		cfg:      cfg,
+		rng:      rand.New(rand.NewSource(cfg.Seed)),
+		db:       db,
+		be:       fake.New(),
+		orphaned: make(map[string]bool),
+		lost:     make(map[string]bool),
+		faults:   true,
+		stats:    Stats{Ops: make(map[string]int)},
+	}
+	s.be.Fault = func(op fake.Op, backendID string) error {
+		if !s.faults || s.rng.Float64() >= s.cfg.FaultRate {
+			return nil
+		}
+		s.stats.Faults++
+		if op == fake.OpDestroy {
+			s.orphaned[backendID] = true
+		}
+		return fmt.Errorf("%w: %s", fake.ErrInjected, op)
+	}
+	s.be.ExecFunc = func(backendID, command string) (string, int) {
+		return "ok\n", s.rng.Intn(2)
+	}
+	s.restore = env.UseBackend(s.be)
+	return s, nil
+}
+
+// Close releases the simulator's database and stops package env using its
+// backend.
+func (s *Simulator) Close() error {
+	s.restore()
+	return s.db.Close()
+}
+
+// Run performs cfg.Steps random operations, checking invariants after each.
+// It returns a *Violation on the first invariant failure.
+func (s *Simulator) Run(ctx context.Context) (Stats, error) {
+	ops := []struct {
+		name   string
+		weight int
+		run    func(ctx context.Context) error
+	}{
+		{"create", 4, s.create},
+		{"exec", 4, s.exec},
+		{"stop", 2, s.stop},
+		{"start", 2, s.start},
+		{"rm", 4, s.rm},
+		{"lose", 1, s.lose},
+		{"reconcile", 1, s.reconcile},
+	}
+	total := 0
+	for _, op := range ops {
+		total += op.weight
+	}
+
+	for step := 0; step < s.cfg.Steps; step++ {
+		if err := ctx.Err(); err != nil {
+			return s.stats, err
+		}
+
+		pick := s.rng.Intn(total)
+		for _, op := range ops {
+			if pick >= op.weight {
+				pick -= op.weight
+				continue
+			}
+			if err := op.run(ctx); err != nil {
+				return s.stats, fmt.Errorf("step %d (%s): %w", step, op.name, err)
+			}
+			s.stats.Ops[op.name]++
+			if err := s.CheckInvariants(ctx); err != nil {
+				return s.stats, &Violation{
+					Seed:    s.cfg.Seed,
+					Step:    step,
+					Op:      op.name,
+					Message: err.Error(),
+					History: s.history,
+				}
+			}
+			break
+		}
+	}
+
+	s.stats.Orphaned = s.countOrphaned(ctx)
+	return s.stats, nil
+}
+
+func (s *Simulator) record(format string, args ...any) {
+	s.history = append(s.history, fmt.Sprintf(format, args...))
+	if len(s.history) > historySize {
+		s.history = s.history[len(s.history)-historySize:]
+	}
+}
+
+// outcome describes the result of a lifecycle operation for the history.
+func outcome(err error) string {
+	if err != nil {
+		return "failed: " + err.Error()
+	}
+	return "ok"
+}
+
+// pick returns a random environment in one of the given statuses (any if
+// none given), or nil if there are none.
+func (s *Simulator) pick(statuses ...state.EnvironmentStatus) (*state.Environment, error) {
+	envs, err := s.db.ListEnvironments(state.ListOptions{Statuses: statuses})
+	if err != nil {
+		return nil, err
+	}
+	if len(envs) == 0 {
+		return nil, nil
+	}
+	// ListEnvironments orders by creation time, which can tie; sort by ID
+	// so picks are reproducible for a given seed.
+	sort.Slice(envs, func(i, j int) bool { return envs[i].ID < envs[j].ID })
+	return envs[s.rng.Intn(len(envs))], nil
+}
+
+// newID returns an environment ID drawn from the simulation's random
+// source, so runs with the same seed create the same environments.
+func (s *Simulator) newID() string {
+	return fmt.Sprintf("%016x%016x", s.rng.Uint64(), s.rng.Uint64())
+}
+
+// create provisions a new environment as `choir env create` does.
+func (s *Simulator) create(ctx context.Context) error {
+	id := s.newID()
+	e := &state.Environment{
+		ID:         id,
+		Backend:    "fake",
+		RepoPath:   "/sim/repo",
+		BranchName: "env/" + state.ShortID(id),
+		BaseBranch: "main",
+		CreatedAt:  time.Now(),
+	}
+	_, err := env.Provision(ctx, s.db, e, env.ProvisionSpec{
+		Backend: s.be,
+		Config:  &config.CreateConfig{ID: id, SetupCommands: []string{"true"}},
+	})
+	s.record("create %s: %s", state.ShortID(id), outcome(err))
+	return nil
+}
+
+// exec runs a command in a ready environment as `choir env exec` does.
+func (s *Simulator) exec(ctx context.Context) error {
+	e, err := s.pick(state.StatusReady)
+	if err != nil || e == nil {
+		return err
+	}
+	res, err := env.ExecCommand(ctx, s.db, e, "make test", "")
+	s.record("exec %s: exit %d, %s", state.ShortID(e.ID), res.ExitCode, outcome(err))
+	return nil
+}
+
+// stop stops a ready environment as `choir env stop` does.
+func (s *Simulator) stop(ctx context.Context) error {
+	e, err := s.pick(state.StatusReady)
+	if err != nil || e == nil {
+		return err
+	}
+	err = env.StopEnvironment(ctx, s.db, e)
+	s.record("stop %s: %s", state.ShortID(e.ID), outcome(err))
+	return nil
+}
+
+// start starts a stopped environment as `choir env start` does.
+func (s *Simulator) start(ctx context.Context) error {
+	e, err := s.pick(state.StatusStopped)
+	if err != nil || e == nil {
+		return err
+	}
+	err = env.StartEnvironment(ctx, s.db, e)
+	s.record("start %s: %s", state.ShortID(e.ID), outcome(err))
+	return nil
+}
+
+// rm removes any environment as `choir env rm --force` does.
+func (s *Simulator) rm(ctx context.Context) error {
+	e, err := s.pick()
+	if err != nil || e == nil {
+		return err
+	}
+	err = env.RemoveEnvironment(ctx, s.db, e, env.RemoveOptions{Force: true, NoBackup: true})
+	s.record("rm %s (%s): %s", state.ShortID(e.ID), e.Status, outcome(err))
+	return nil
+}
+
+// lose deletes a random workspace behind choir's back, as a user deleting
+// a worktree by hand or a VM dying would.
+func (s *Simulator) lose(ctx context.Context) error {
+	ids, err := s.be.List(ctx)
+	if err != nil || len(ids) == 0 {
+		return err
+	}
+	id := ids[s.rng.Intn(len(ids))]
+	s.faults = false
+	err = s.be.Destroy(ctx, id)
+	s.faults = true
+	if err != nil {
+		return err
+	}
+	s.lost[id] = true
+	s.record("lose workspace %s", id)
+	return nil
+}
+
+// reconcile reconciles every environment as `choir gc` and the daemon do.
+func (s *Simulator) reconcile(ctx context.Context) error {
+	changed := 0
+	err := env.ReconcileAll(ctx, s.db, time.Now(), func(*state.Environment, env.Action) { changed++ })
+	s.record("reconcile: %d changed, %s", changed, outcome(err))
+	if err == nil {
+		clear(s.lost)
+	}
+	return nil
+}
+
+// CheckInvariants verifies that the database and backend are consistent:
+//   - no environment is left provisioning once an operation completes
+//   - ready environments have a running workspace, and stopped ones a
+//     stopped workspace, unless it was lost since the last reconcile
+//   - each workspace belongs to exactly one environment, unless it was
+//     orphaned by a failed destroy
+//   - command history, setup journals, diagnostics, agent runs, and port
+//     forwards only reference existing environments
+func (s *Simulator) CheckInvariants(ctx context.Context) error {
+	envs, err := s.db.ListEnvironments(state.ListOptions{})
+	if err != nil {
+		return err
+	}
+
+	owners := make(map[string]string)
+	envIDs := make(map[string]bool)
+	for _, e := range envs {
+		envIDs[e.ID] = true
+		short := state.ShortID(e.ID)
+
+		if !state.IsValidStatus(e.Status) {
+			return fmt.Errorf("environment %s has invalid status %q", short, e.Status)
+		}
+		if e.Status == state.StatusProvisioning {
+			return fmt.Errorf("environment %s stuck in provisioning", short)
+		}
+
+		if e.BackendID != "" {
+			if other, ok := owners[e.BackendID]; ok {
+				return fmt.Errorf("environments %s and %s share workspace %s", other, short, e.BackendID)
+			}
+			owners[e.BackendID] = short
+		}
+
+		want := backend.StateRunning
+		switch e.Status {
+		case state.StatusReady:
+		case state.StatusStopped:
+			want = backend.StateStopped
+		default:
+			continue
+		}
+		if e.BackendID == "" {
+			return fmt.Errorf("%s environment %s has no workspace", e.Status, short)
+		}
+		st, err := s.be.Status(ctx, e.BackendID)
+		if err != nil {
+			return err
+		}
+		if st.State == backend.StateNotFound && s.lost[e.BackendID] {
+			continue
+		}
+		if st.State != want {
+			return fmt.Errorf("%s environment %s has workspace in state %s", e.Status, short, st.State)
+		}
+	}
+
+	workspaces, err := s.be.List(ctx)
+	if err != nil {
+		return err
+	}
+	for _, id := range workspaces {
+		if _, ok := owners[id]; !ok && !s.orphaned[id] {
+			return fmt.Errorf("workspace %s has no environment record", id)
+		}
+	}
+
+	for _, table := range recordTables {
+		rows, err := s.db.QueryContext(ctx, "SELECT DISTINCT environment_id FROM "+table)
+		if err != nil {
+			return err
+		}
+		var stale []string
+		for rows.Next() {
+			var id string
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				return err
+			}
+			if !envIDs[id] {
+				stale = append(stale, state.ShortID(id))
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		if len(stale) > 0 {
+			return fmt.Errorf("%s reference missing environments %s", strings.ReplaceAll(table, "_", " "), strings.Join(stale, ", "))
+		}
+	}
+	return nil
+}
+
+// countOrphaned returns the number of workspaces left without a record.
+func (s *Simulator) countOrphaned(ctx context.Context) int {
+	envs, err := s.db.ListEnvironments(state.ListOptions{})
+	if err != nil {
+		return 0
+	}
+	owned := make(map[string]bool, len(envs))
+	for _, e := range envs {
+		owned[e.BackendID] = true
+	}
+	workspaces, _ := s.be.List(ctx)
+	n := 0
+	for _, id := range workspaces {
+		if !owned[id] {
+			n++
+		}
+	}
+	return n
+}
+
+// IsViolation reports whether err is an invariant violation.
+func IsViolation(err error) bool {
+	var v *Violation
+	return errors.As(err, &v)
+}
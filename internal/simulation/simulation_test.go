@@ -0,0 +1,79 @@
+package simulation
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Quidge/choir/internal/state"
+)
+
+// newSimulator returns a simulator for cfg whose lifecycle operations keep
+// their config and data in scratch directories.
+func newSimulator(t *testing.T, cfg Config) *Simulator {
+	t.Helper()
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	sim, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New() failed: %v", err)
+	}
+	t.Cleanup(func() { sim.Close() })
+	return sim
+}
+
+func TestLifecycleInvariants(t *testing.T) {
+	steps := 5000
+	if testing.Short() {
+		steps = 200
+	}
+
+	for _, tt := range []struct {
+		name      string
+		seed      int64
+		faultRate float64
+	}{
+		{"no faults", 1, 0},
+		{"occasional faults", 2, 0.05},
+		{"frequent faults", 3, 0.3},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			sim := newSimulator(t, Config{Seed: tt.seed, Steps: steps, FaultRate: tt.faultRate})
+			stats, err := sim.Run(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, op := range []string{"create", "exec", "stop", "start", "rm", "lose", "reconcile"} {
+				if stats.Ops[op] == 0 {
+					t.Errorf("expected every operation to run, got %v", stats.Ops)
+					break
+				}
+			}
+			if tt.faultRate > 0 && stats.Faults == 0 {
+				t.Error("expected injected faults")
+			}
+			t.Logf("ops=%v faults=%d orphaned=%d", stats.Ops, stats.Faults, stats.Orphaned)
+		})
+	}
+}
+
+func TestCheckInvariantsDetectsStuckProvisioning(t *testing.T) {
+	sim := newSimulator(t, Config{Seed: 1})
+
+	// Simulate a create that died between recording and provisioning
+	sim.be.Fault = nil
+	if err := sim.create(context.Background()); err != nil {
+		t.Fatalf("create() failed: %v", err)
+	}
+	env, err := sim.pick()
+	if err != nil || env == nil {
+		t.Fatalf("pick() = %v, %v", env, err)
+	}
+	env.Status = state.StatusProvisioning
+	if err := sim.db.UpdateEnvironment(env); err != nil {
+		t.Fatalf("UpdateEnvironment() failed: %v", err)
+	}
+
+	if err := sim.CheckInvariants(context.Background()); err == nil {
+		t.Error("CheckInvariants() should report stuck provisioning")
+	}
+}
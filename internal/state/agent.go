@@ -0,0 +1,179 @@
+package state
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// AgentRun is a coding agent started in an environment by
+// `choir env run-agent`.
+type AgentRun struct {
+	ID            int64     // Auto-assigned row ID
+	EnvironmentID string    // Environment the agent runs in
+	Command       string    // Agent command line as passed to the shell
+	ProcessID     string    // Backend process ID (a host PID for worktrees)
+	StartedAt     time.Time // When the agent started
+	FinishedAt    time.Time // When it exited; zero if it hasn't (or choir didn't see it)
+	ExitCode      int       // Exit code; meaningful only once finished
+	Status        AgentRunStatus
+}
+
+// AgentRunStatus is what became of an agent run.
+type AgentRunStatus string
+
+const (
+	AgentRunning AgentRunStatus = "running" // Started and not seen to exit
+	AgentExited  AgentRunStatus = "exited"  // Exited on its own
+	AgentCrashed AgentRunStatus = "crashed" // Killed by a signal, or vanished
+	AgentStopped AgentRunStatus = "stopped" // Stopped by "choir env stop"
+)
+
+// Finished reports whether the agent's exit was recorded.
+func (r *AgentRun) Finished() bool {
+	return !r.FinishedAt.IsZero()
+}
+
+// ErrNoAgentRun is returned by LatestAgentRun when no agent was ever
+// started in the environment.
+var ErrNoAgentRun = errors.New("no agent run")
+
+// StartAgentRun records that an agent started. The run's ID and status are
+// set on success.
+func (db *DB) StartAgentRun(run *AgentRun) error {
+	result, err := db.Exec(`
+		INSERT INTO agent_runs (environment_id, command, process_id, started_at)
+		VALUES (?, ?, ?, ?)`,
+		run.EnvironmentID, run.Command, run.ProcessID, run.StartedAt.UTC().Format(time.RFC3339Nano),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to record agent run: %w", err)
+	}
+	run.ID, err = result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("failed to get agent run ID: %w", err)
+	}
+	run.Status = AgentRunning
+	return nil
+}
+
+// FinishAgentRun records that the agent run with the given ID exited. A
+// negative exit code, for an agent killed by a signal or that disappeared,
+// marks the run crashed, unless it was being stopped.
+func (db *DB) FinishAgentRun(id int64, at time.Time, exitCode int) error {
+	_, err := db.Exec(`
+		UPDATE agent_runs SET finished_at = ?, exit_code = ?,
+			status = CASE WHEN status = 'stopped' THEN status WHEN ? < 0 THEN 'crashed' ELSE 'exited' END
+		WHERE id = ?`,
+		at.UTC().Format(time.RFC3339Nano), exitCode, exitCode, id,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to record agent exit: %w", err)
+	}
+	return nil
+}
+
+// StopAgentRun marks the agent run with the given ID as stopped on purpose,
+// before it is signaled, so its exit isn't taken for a crash.
+func (db *DB) StopAgentRun(id int64) error {
+	if _, err := db.Exec(`UPDATE agent_runs SET status = 'stopped' WHERE id = ?`, id); err != nil {
+		return fmt.Errorf("failed to record agent stop: %w", err)
+	}
+	return nil
+}
+
+// LatestAgentRun returns the most recently started agent run in an
+// environment, or ErrNoAgentRun.
+func (db *DB) LatestAgentRun(environmentID string) (*AgentRun, error) {
+	r, err := scanAgentRun(db.QueryRow(`
+		SELECT id, environment_id, command, process_id, started_at, finished_at, exit_code, status
+		FROM agent_runs WHERE environment_id = ?
+		ORDER BY started_at DESC, id DESC LIMIT 1`,
+		environmentID,
+	))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNoAgentRun
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get agent run: %w", err)
+	}
+	return r, nil
+}
+
+// ListAgentRuns returns the agent runs recorded for an environment, or for
+// all environments if environmentID is empty, oldest first.
+func (db *DB) ListAgentRuns(environmentID string) ([]*AgentRun, error) {
+	query := `SELECT id, environment_id, command, process_id, started_at, finished_at, exit_code, status
+		FROM agent_runs`
+	var args []any
+	if environmentID != "" {
+		query += " WHERE environment_id = ?"
+		args = append(args, environmentID)
+	}
+	rows, err := db.Query(query+" ORDER BY started_at, id", args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list agent runs: %w", err)
+	}
+	defer rows.Close()
+
+	var runs []*AgentRun
+	for rows.Next() {
+		r, err := scanAgentRun(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list agent runs: %w", err)
+		}
+		runs = append(runs, r)
+	}
+	return runs, rows.Err()
+}
+
+// insertAgentRun inserts run as recorded, finished or not, using ex, which
+// may be a transaction, and returns the new row ID.
+func insertAgentRun(ex execer, run *AgentRun) (int64, error) {
+	var finishedAt, exitCode any
+	if run.Finished() {
+		finishedAt = run.FinishedAt.UTC().Format(time.RFC3339Nano)
+		exitCode = run.ExitCode
+	}
+	result, err := ex.Exec(`
+		INSERT INTO agent_runs (environment_id, command, process_id, started_at, finished_at, exit_code, status)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		run.EnvironmentID, run.Command, run.ProcessID, run.StartedAt.UTC().Format(time.RFC3339Nano),
+		finishedAt, exitCode, run.Status,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to record agent run: %w", err)
+	}
+	return result.LastInsertId()
+}
+
+// scanAgentRun scans a row into an AgentRun.
+func scanAgentRun(s scanner) (*AgentRun, error) {
+	var r AgentRun
+	var startedAt string
+	var finishedAt sql.NullString
+	var exitCode sql.NullInt64
+	if err := s.Scan(&r.ID, &r.EnvironmentID, &r.Command, &r.ProcessID, &startedAt, &finishedAt, &exitCode, &r.Status); err != nil {
+		return nil, err
+	}
+	var err error
+	if r.StartedAt, err = time.Parse(time.RFC3339Nano, startedAt); err != nil {
+		return nil, fmt.Errorf("failed to parse started_at: %w", err)
+	}
+	if finishedAt.Valid {
+		if r.FinishedAt, err = time.Parse(time.RFC3339Nano, finishedAt.String); err != nil {
+			return nil, fmt.Errorf("failed to parse finished_at: %w", err)
+		}
+	}
+	r.ExitCode = int(exitCode.Int64)
+	return &r, nil
+}
+
+// DeleteAgentRuns removes all agent runs recorded for an environment.
+func (db *DB) DeleteAgentRuns(environmentID string) error {
+	if _, err := db.Exec(`DELETE FROM agent_runs WHERE environment_id = ?`, environmentID); err != nil {
+		return fmt.Errorf("failed to delete agent runs: %w", err)
+	}
+	return nil
+}
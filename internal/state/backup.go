@@ -0,0 +1,125 @@
+package state
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrNoBackup is returned by Rollback when there is no backup to restore.
+var ErrNoBackup = errors.New("no backup found")
+
+// backupSuffix precedes the schema version in backup file names, e.g.,
+// state.db.bak-v6.
+const backupSuffix = ".bak-v"
+
+// Backup is a copy of the state database taken before migrating it.
+type Backup struct {
+	Path      string
+	Version   int       // Schema version of the copy
+	CreatedAt time.Time // When the copy was taken
+}
+
+// backup copies the database to <path>.bak-v<version> before it is
+// migrated from version, replacing an older copy at the same version. The
+// copy is made with VACUUM INTO, so it is consistent and includes anything
+// still in the write-ahead log. In-memory databases are not backed up.
+func (db *DB) backup(version int) error {
+	if db.path == ":memory:" {
+		return nil
+	}
+	dest := db.path + backupSuffix + strconv.Itoa(version)
+	if err := os.Remove(dest); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to replace backup %s: %w", dest, err)
+	}
+	if _, err := db.Exec("VACUUM INTO ?", dest); err != nil {
+		return fmt.Errorf("failed to back up database to %s: %w", dest, err)
+	}
+	return nil
+}
+
+// Backups returns the backups of the database at path (DefaultDBPath if
+// empty), newest schema version first.
+func Backups(path string) ([]Backup, error) {
+	var err error
+	if path == "" {
+		path, err = DefaultDBPath()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	matches, err := filepath.Glob(path + backupSuffix + "*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list backups: %w", err)
+	}
+	var backups []Backup
+	for _, m := range matches {
+		version, err := strconv.Atoi(strings.TrimPrefix(m, path+backupSuffix))
+		if err != nil {
+			continue
+		}
+		info, err := os.Stat(m)
+		if err != nil {
+			continue
+		}
+		backups = append(backups, Backup{Path: m, Version: version, CreatedAt: info.ModTime()})
+	}
+	slices.SortFunc(backups, func(a, b Backup) int { return b.Version - a.Version })
+	return backups, nil
+}
+
+// Rollback replaces the database at path (DefaultDBPath if empty) with its
+// backup at schema version (the newest backup if version is 0) and returns
+// the backup restored. The database being replaced is kept as
+// <path>.pre-rollback. No other process may have the database open.
+//
+// The restored database has the backup's schema version, so the next Open
+// by a build with newer migrations applies them again.
+func Rollback(path string, version int) (Backup, error) {
+	var err error
+	if path == "" {
+		path, err = DefaultDBPath()
+		if err != nil {
+			return Backup{}, err
+		}
+	}
+
+	backups, err := Backups(path)
+	if err != nil {
+		return Backup{}, err
+	}
+	i := 0
+	if version != 0 {
+		i = slices.IndexFunc(backups, func(b Backup) bool { return b.Version == version })
+	}
+	if i < 0 || len(backups) == 0 {
+		return Backup{}, ErrNoBackup
+	}
+	b := backups[i]
+
+	data, err := os.ReadFile(b.Path)
+	if err != nil {
+		return Backup{}, fmt.Errorf("failed to read backup: %w", err)
+	}
+	// Set aside the current database with its write-ahead log, which holds
+	// changes not yet written to the main file
+	aside := path + ".pre-rollback"
+	for _, suffix := range []string{"", "-wal", "-shm"} {
+		if err := os.Remove(aside + suffix); err != nil && !os.IsNotExist(err) {
+			return Backup{}, fmt.Errorf("failed to remove %s: %w", aside+suffix, err)
+		}
+		if err := os.Rename(path+suffix, aside+suffix); err != nil && !os.IsNotExist(err) {
+			return Backup{}, fmt.Errorf("failed to set aside current database: %w", err)
+		}
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return Backup{}, fmt.Errorf("failed to restore backup: %w", err)
+	}
+	return b, nil
+}
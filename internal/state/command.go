@@ -0,0 +1,188 @@
+package state
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// CommandSource identifies how a recorded command was run.
+type CommandSource string
+
+const (
+	// SourceExec marks commands run via `choir env exec`.
+	SourceExec CommandSource = "exec"
+
+	// SourceSetup marks setup commands run while provisioning.
+	SourceSetup CommandSource = "setup"
+)
+
+// MaxCommandOutput is the maximum number of output bytes stored per command.
+// Longer output is truncated to its last MaxCommandOutput bytes, since the
+// end of the output usually contains the error that matters.
+const MaxCommandOutput = 4096
+
+// CommandRecord is a command executed in an environment.
+type CommandRecord struct {
+	ID            int64         // Auto-assigned row ID
+	EnvironmentID string        // Environment the command ran in
+	Source        CommandSource // How the command was run
+	Command       string        // Command line as passed to the shell
+	ExitCode      int           // Process exit code (-1 if it failed to start)
+	StartedAt     time.Time     // When the command started
+	Duration      time.Duration // How long the command ran
+	Output        string        // Tail of the combined output (may be truncated)
+}
+
+// TruncateOutput returns at most the last MaxCommandOutput bytes of output.
+// The cut is moved forward to a rune boundary so the result doesn't start
+// in the middle of a UTF-8 sequence.
+func TruncateOutput(output string) string {
+	if len(output) <= MaxCommandOutput {
+		return output
+	}
+	start := len(output) - MaxCommandOutput
+	for start < len(output) && !utf8.RuneStart(output[start]) {
+		start++
+	}
+	return output[start:]
+}
+
+// RecordCommand inserts a command record. The record's ID is set on success.
+// Output is truncated to MaxCommandOutput bytes before being stored.
+func (db *DB) RecordCommand(rec *CommandRecord) error {
+	id, err := insertCommand(db, rec)
+	if err != nil {
+		return err
+	}
+	rec.ID = id
+	return nil
+}
+
+// insertCommand inserts rec using ex, which may be a transaction, and
+// returns the new row ID.
+func insertCommand(ex execer, rec *CommandRecord) (int64, error) {
+	result, err := ex.Exec(`
+		INSERT INTO commands (
+			environment_id, source, command, exit_code,
+			started_at, duration_ms, output
+		) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		rec.EnvironmentID,
+		string(rec.Source),
+		rec.Command,
+		rec.ExitCode,
+		rec.StartedAt.UTC().Format(time.RFC3339Nano),
+		rec.Duration.Milliseconds(),
+		nullString(TruncateOutput(rec.Output)),
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to record command: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get command ID: %w", err)
+	}
+	return id, nil
+}
+
+// CommandListOptions specifies filters for listing commands.
+type CommandListOptions struct {
+	EnvironmentID string          // Filter by environment ID (exact match)
+	Sources       []CommandSource // Filter by source (any of these)
+}
+
+// ListCommands returns recorded commands in execution order (oldest first).
+func (db *DB) ListCommands(opts CommandListOptions) ([]*CommandRecord, error) {
+	query := `
+		SELECT id, environment_id, source, command, exit_code,
+		       started_at, duration_ms, output
+		FROM commands
+	`
+
+	var conditions []string
+	var args []any
+
+	if opts.EnvironmentID != "" {
+		conditions = append(conditions, "environment_id = ?")
+		args = append(args, opts.EnvironmentID)
+	}
+
+	if len(opts.Sources) > 0 {
+		placeholders := make([]string, len(opts.Sources))
+		for i, s := range opts.Sources {
+			placeholders[i] = "?"
+			args = append(args, string(s))
+		}
+		conditions = append(conditions, fmt.Sprintf("source IN (%s)", strings.Join(placeholders, ", ")))
+	}
+
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	query += " ORDER BY id ASC"
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list commands: %w", err)
+	}
+	defer rows.Close()
+
+	var cmds []*CommandRecord
+	for rows.Next() {
+		rec, err := scanCommand(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan command: %w", err)
+		}
+		cmds = append(cmds, rec)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating commands: %w", err)
+	}
+
+	return cmds, nil
+}
+
+// DeleteCommands removes all command records for an environment.
+func (db *DB) DeleteCommands(environmentID string) error {
+	if _, err := db.Exec("DELETE FROM commands WHERE environment_id = ?", environmentID); err != nil {
+		return fmt.Errorf("failed to delete commands: %w", err)
+	}
+	return nil
+}
+
+// scanCommand scans a row into a CommandRecord struct.
+func scanCommand(s scanner) (*CommandRecord, error) {
+	var rec CommandRecord
+	var output sql.NullString
+	var startedAt string
+	var durationMs int64
+
+	err := s.Scan(
+		&rec.ID,
+		&rec.EnvironmentID,
+		&rec.Source,
+		&rec.Command,
+		&rec.ExitCode,
+		&startedAt,
+		&durationMs,
+		&output,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	rec.Output = output.String
+	rec.Duration = time.Duration(durationMs) * time.Millisecond
+
+	rec.StartedAt, err = time.Parse(time.RFC3339Nano, startedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse started_at: %w", err)
+	}
+
+	return &rec, nil
+}
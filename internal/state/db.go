@@ -2,6 +2,7 @@ package state
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -29,10 +30,49 @@ func DefaultDBPath() (string, error) {
 	return filepath.Join(dataHome, "choir", "state.db"), nil
 }
 
-// Open opens or creates the state database at the given path.
+// Open opens or creates the state database at the given path, migrating
+// its schema if needed.
 // Use ":memory:" for an in-memory database (useful for testing).
 // If path is empty, uses DefaultDBPath().
 func Open(path string) (*DB, error) {
+	db, err := openDB(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// Run migrations to ensure schema is up to date
+	if err := db.migrate(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to run migrations: %w", err)
+	}
+	return db, nil
+}
+
+// Migrate opens or creates the state database at path and runs any pending
+// migrations, returning the schema versions before and after.
+func Migrate(path string) (from, to int, err error) {
+	db, err := openDB(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer db.Close()
+
+	// A new database has no schema_migrations table yet
+	from, _ = db.schemaVersion()
+	if err := db.migrate(); err != nil {
+		return from, from, fmt.Errorf("failed to run migrations: %w", err)
+	}
+	to, err = db.schemaVersion()
+	return from, to, err
+}
+
+// busyTimeoutPragma makes a connection wait up to five seconds for another
+// process's write to finish instead of failing with SQLITE_BUSY, as several
+// choir processes provisioning at once otherwise would.
+const busyTimeoutPragma = "_pragma=busy_timeout(5000)"
+
+// openDB opens or creates the database at path without migrating it.
+func openDB(path string) (*DB, error) {
 	var err error
 	if path == "" {
 		path, err = DefaultDBPath()
@@ -56,8 +96,10 @@ func Open(path string) (*DB, error) {
 		// access the same database. This is important for concurrent reads.
 		dsn = "file::memory:?cache=shared"
 	} else {
-		// For file-based databases, use WAL mode for better concurrent read performance
-		dsn = fmt.Sprintf("file:%s?_journal_mode=WAL", path)
+		// For file-based databases, use WAL mode for better concurrent read
+		// performance, and wait for other processes' writes rather than
+		// failing with SQLITE_BUSY
+		dsn = fmt.Sprintf("file:%s?%s", path, busyTimeoutPragma+"&_pragma=journal_mode(WAL)")
 	}
 
 	sqlDB, err := sql.Open("sqlite", dsn)
@@ -82,17 +124,84 @@ func Open(path string) (*DB, error) {
 		return nil, fmt.Errorf("failed to connect to database: %w", err)
 	}
 
-	db := &DB{
+	return &DB{
 		DB:   sqlDB,
 		path: path,
+	}, nil
+}
+
+// OpenReadOnly opens the state database at path for reading only, for
+// commands that never write. When the schema is current it skips migrations
+// and needs no write access to the database. If the database doesn't exist
+// yet or its schema is out of date, it falls back to Open, which creates or
+// migrates it.
+func OpenReadOnly(path string) (*DB, error) {
+	var err error
+	if path == "" {
+		path, err = DefaultDBPath()
+		if err != nil {
+			return nil, err
+		}
+	}
+	if path == ":memory:" {
+		return Open(path)
+	}
+	if _, err := os.Stat(path); err != nil {
+		return Open(path)
 	}
 
-	// Run migrations to ensure schema is up to date
-	if err := db.migrate(); err != nil {
+	sqlDB, err := sql.Open("sqlite", fmt.Sprintf("file:%s?mode=ro&%s", path, busyTimeoutPragma))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	sqlDB.SetMaxOpenConns(10)
+	sqlDB.SetMaxIdleConns(5)
+
+	db := &DB{
+		DB:   sqlDB,
+		path: path,
+	}
+	version, err := db.schemaVersion()
+	if err != nil || version < LatestSchemaVersion() {
+		// Not migrated yet (or not readable read-only); migrate now
 		sqlDB.Close()
-		return nil, fmt.Errorf("failed to run migrations: %w", err)
+		return Open(path)
 	}
+	return db, nil
+}
+
+// ErrSchemaBehind is returned by OpenCurrent when the database doesn't
+// exist yet or its schema is older than this build's.
+var ErrSchemaBehind = errors.New("state database schema is not current")
 
+// OpenCurrent opens the existing state database at path for reading and
+// writing without migrating it, for writes that can be skipped, such as
+// usage stats. It fails with ErrSchemaBehind rather than creating or
+// migrating the database (and backing it up) if the database doesn't exist
+// or its schema isn't current. If path is empty, uses DefaultDBPath().
+func OpenCurrent(path string) (*DB, error) {
+	var err error
+	if path == "" {
+		path, err = DefaultDBPath()
+		if err != nil {
+			return nil, err
+		}
+	}
+	if path != ":memory:" {
+		if _, err := os.Stat(path); err != nil {
+			return nil, ErrSchemaBehind
+		}
+	}
+
+	db, err := openDB(path)
+	if err != nil {
+		return nil, err
+	}
+	version, err := db.schemaVersion()
+	if err != nil || version < LatestSchemaVersion() {
+		db.Close()
+		return nil, ErrSchemaBehind
+	}
 	return db, nil
 }
 
@@ -0,0 +1,62 @@
+package state
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrNoDiagnostics is returned when no diagnostics were captured for an
+// environment.
+var ErrNoDiagnostics = errors.New("no diagnostics captured")
+
+// Diagnostics is the diagnostic bundle captured when an environment failed
+// (see package diag). Bundle is its JSON encoding.
+type Diagnostics struct {
+	EnvironmentID string
+	CapturedAt    time.Time
+	Bundle        string
+}
+
+// SaveDiagnostics stores d, replacing any bundle captured for the same
+// environment when it failed before.
+func (db *DB) SaveDiagnostics(d *Diagnostics) error {
+	_, err := db.Exec(`
+		INSERT OR REPLACE INTO diagnostics (environment_id, captured_at, bundle)
+		VALUES (?, ?, ?)`,
+		d.EnvironmentID, d.CapturedAt.UTC().Format(time.RFC3339Nano), d.Bundle,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save diagnostics: %w", err)
+	}
+	return nil
+}
+
+// GetDiagnostics returns the diagnostics captured for an environment, or
+// ErrNoDiagnostics.
+func (db *DB) GetDiagnostics(environmentID string) (*Diagnostics, error) {
+	var capturedAt string
+	d := &Diagnostics{EnvironmentID: environmentID}
+	err := db.QueryRow(`SELECT captured_at, bundle FROM diagnostics WHERE environment_id = ?`, environmentID).
+		Scan(&capturedAt, &d.Bundle)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNoDiagnostics
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get diagnostics: %w", err)
+	}
+	d.CapturedAt, err = time.Parse(time.RFC3339Nano, capturedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse captured_at: %w", err)
+	}
+	return d, nil
+}
+
+// DeleteDiagnostics removes the diagnostics captured for an environment.
+func (db *DB) DeleteDiagnostics(environmentID string) error {
+	if _, err := db.Exec(`DELETE FROM diagnostics WHERE environment_id = ?`, environmentID); err != nil {
+		return fmt.Errorf("failed to delete diagnostics: %w", err)
+	}
+	return nil
+}
@@ -14,6 +14,7 @@ type EnvironmentStatus string
 const (
 	StatusProvisioning EnvironmentStatus = "provisioning"
 	StatusReady        EnvironmentStatus = "ready"
+	StatusStopped      EnvironmentStatus = "stopped"
 	StatusFailed       EnvironmentStatus = "failed"
 	StatusRemoved      EnvironmentStatus = "removed"
 )
@@ -22,6 +23,7 @@ const (
 var ValidStatuses = []EnvironmentStatus{
 	StatusProvisioning,
 	StatusReady,
+	StatusStopped,
 	StatusFailed,
 	StatusRemoved,
 }
@@ -38,15 +40,34 @@ func IsValidStatus(s EnvironmentStatus) bool {
 
 // Environment represents a tracked environment in the state database.
 type Environment struct {
-	ID         string            // 32 hex chars
+	ID         string            // canonical form; see ValidID
 	Backend    string            // Backend type (e.g., "worktree")
 	BackendID  string            // Backend-specific identifier (may be empty)
 	RepoPath   string            // Path to the original repository
+	Remote     string            // Name of the git remote RemoteURL is from (may be empty)
 	RemoteURL  string            // Git remote URL (may be empty)
 	BranchName string            // Branch name (env/<short-id>)
 	BaseBranch string            // Branch environment was created from
 	CreatedAt  time.Time         // When environment was created
 	Status     EnvironmentStatus // Current status
+	ExpiresAt  time.Time         // When environment expires (zero if never)
+	Task       string            // What the environment was created to do (may be empty)
+	Profile    string            // Project config profile it was created with (may be empty)
+	RemovedAt  time.Time         // When environment was moved to the trash (zero unless removed)
+	CPUs       int               // CPUs allocated from the host (zero if the backend doesn't allocate them)
+	Memory     uint64            // Bytes of memory allocated from the host (zero if the backend doesn't allocate it)
+	Pooled     bool              // Waiting in its repository's warm pool to be taken by env create
+}
+
+// environmentColumns lists the environments columns in the order
+// scanEnvironment expects.
+const environmentColumns = `id, backend, backend_id, repo_path, remote_name, remote_url,
+		       branch_name, base_branch, created_at, status, expires_at, task, profile,
+		       removed_at, cpus, memory, pooled`
+
+// Expired reports whether env has an expiry time at or before now.
+func (e *Environment) Expired(now time.Time) bool {
+	return !e.ExpiresAt.IsZero() && !e.ExpiresAt.After(now)
 }
 
 // ErrEnvironmentNotFound is returned when an environment with the given ID does not exist.
@@ -70,16 +91,25 @@ func (e *AmbiguousPrefixError) Unwrap() error {
 	return ErrAmbiguousPrefix
 }
 
-// ErrInvalidPrefix is returned when an ID prefix contains non-hex characters.
-var ErrInvalidPrefix = errors.New("invalid ID prefix: must contain only hexadecimal characters")
+// ErrInvalidPrefix is returned when an ID prefix contains characters that
+// can't appear in an ID.
+var ErrInvalidPrefix = errors.New("invalid ID prefix: must contain only letters, digits, and hyphens")
+
+// ErrInvalidID is returned when an environment ID is not in canonical form.
+var ErrInvalidID = errors.New("invalid environment ID")
 
 // ErrInvalidStatus is returned when an invalid status is provided.
 var ErrInvalidStatus = errors.New("invalid status")
 
-// isHexString returns true if s contains only hexadecimal characters.
-func isHexString(s string) bool {
+// ErrUnexpectedStatus is returned when an environment is not in the status
+// a transition expects it to be in.
+var ErrUnexpectedStatus = errors.New("unexpected environment status")
+
+// isIDString returns true if s contains only characters allowed in a
+// canonical ID: lowercase letters, digits, and hyphens.
+func isIDString(s string) bool {
 	for _, c := range s {
-		if !((c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')) {
+		if !((c >= '0' && c <= '9') || (c >= 'a' && c <= 'z') || c == '-') {
 			return false
 		}
 	}
@@ -88,36 +118,57 @@ func isHexString(s string) bool {
 
 // CreateEnvironment inserts a new environment into the database.
 func (db *DB) CreateEnvironment(env *Environment) error {
+	if !ValidID(env.ID) {
+		return fmt.Errorf("%w: %q", ErrInvalidID, env.ID)
+	}
 	if !IsValidStatus(env.Status) {
 		return fmt.Errorf("%w: %s", ErrInvalidStatus, env.Status)
 	}
 
-	_, err := db.Exec(`
+	if err := insertEnvironment(db, env); err != nil {
+		return fmt.Errorf("failed to create environment: %w", err)
+	}
+	return nil
+}
+
+// execer is implemented by both *sql.DB and *sql.Tx.
+type execer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
+// insertEnvironment inserts env using ex, which may be a transaction.
+func insertEnvironment(ex execer, env *Environment) error {
+	_, err := ex.Exec(`
 		INSERT INTO environments (
-			id, backend, backend_id, repo_path, remote_url,
-			branch_name, base_branch, created_at, status
-		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			id, backend, backend_id, repo_path, remote_name, remote_url,
+			branch_name, base_branch, created_at, status, expires_at, task, profile,
+			removed_at, cpus, memory, pooled
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
 		env.ID,
 		env.Backend,
 		nullString(env.BackendID),
 		env.RepoPath,
+		nullString(env.Remote),
 		nullString(env.RemoteURL),
 		env.BranchName,
 		env.BaseBranch,
 		env.CreatedAt.UTC().Format(time.RFC3339),
 		string(env.Status),
+		nullTime(env.ExpiresAt),
+		nullString(env.Task),
+		nullString(env.Profile),
+		nullTime(env.RemovedAt),
+		nullInt(int64(env.CPUs)),
+		nullInt(int64(env.Memory)),
+		env.Pooled,
 	)
-	if err != nil {
-		return fmt.Errorf("failed to create environment: %w", err)
-	}
-	return nil
+	return err
 }
 
 // GetEnvironment retrieves an environment by full ID.
 func (db *DB) GetEnvironment(id string) (*Environment, error) {
 	row := db.QueryRow(`
-		SELECT id, backend, backend_id, repo_path, remote_url,
-		       branch_name, base_branch, created_at, status
+		SELECT `+environmentColumns+`
 		FROM environments WHERE id = ?`, id)
 
 	env, err := scanEnvironment(row)
@@ -130,18 +181,59 @@ func (db *DB) GetEnvironment(id string) (*Environment, error) {
 	return env, nil
 }
 
+// GetEnvironmentByBackendID retrieves the environment whose backend ID is
+// backendID, such as a worktree's path. If several have it, because a
+// removed environment's workspace was reused, the newest is returned.
+// Returns ErrEnvironmentNotFound if none has it.
+func (db *DB) GetEnvironmentByBackendID(backendID string) (*Environment, error) {
+	row := db.QueryRow(`
+		SELECT `+environmentColumns+`
+		FROM environments WHERE backend_id = ?
+		ORDER BY created_at DESC LIMIT 1`, backendID)
+
+	env, err := scanEnvironment(row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrEnvironmentNotFound
+		}
+		return nil, fmt.Errorf("failed to get environment: %w", err)
+	}
+	return env, nil
+}
+
 // GetEnvironmentByPrefix retrieves an environment by ID prefix.
 // Returns ErrEnvironmentNotFound if no match, ErrAmbiguousPrefix if multiple matches,
-// or ErrInvalidPrefix if the prefix contains non-hex characters.
+// or ErrInvalidPrefix if the prefix contains characters that can't appear in
+// an ID. The prefix is matched case-insensitively.
 func (db *DB) GetEnvironmentByPrefix(prefix string) (*Environment, error) {
-	if prefix == "" || !isHexString(prefix) {
+	return db.GetEnvironmentByPrefixFiltered(prefix, nil)
+}
+
+// GetEnvironmentByPrefixFiltered retrieves an environment by ID prefix,
+// considering only environments in one of the given statuses. If statuses is
+// empty, all environments are considered. Errors are the same as for
+// GetEnvironmentByPrefix.
+func (db *DB) GetEnvironmentByPrefixFiltered(prefix string, statuses []EnvironmentStatus) (*Environment, error) {
+	prefix = strings.ToLower(prefix)
+	if prefix == "" || !isIDString(prefix) {
 		return nil, ErrInvalidPrefix
 	}
 
-	rows, err := db.Query(`
-		SELECT id, backend, backend_id, repo_path, remote_url,
-		       branch_name, base_branch, created_at, status
-		FROM environments WHERE id LIKE ? || '%'`, prefix)
+	query := `
+		SELECT ` + environmentColumns + `
+		FROM environments WHERE id LIKE ? || '%'`
+	args := []any{prefix}
+
+	if len(statuses) > 0 {
+		placeholders := make([]string, len(statuses))
+		for i, s := range statuses {
+			placeholders[i] = "?"
+			args = append(args, string(s))
+		}
+		query += fmt.Sprintf(" AND status IN (%s)", strings.Join(placeholders, ", "))
+	}
+
+	rows, err := db.Query(query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query environments: %w", err)
 	}
@@ -170,7 +262,8 @@ func (db *DB) GetEnvironmentByPrefix(prefix string) (*Environment, error) {
 	}
 }
 
-// UpdateEnvironment updates an existing environment.
+// UpdateEnvironment updates an existing environment. Its creation time and
+// whether it is pooled aren't updated; see TakePooledEnvironment.
 func (db *DB) UpdateEnvironment(env *Environment) error {
 	if !IsValidStatus(env.Status) {
 		return fmt.Errorf("%w: %s", ErrInvalidStatus, env.Status)
@@ -181,18 +274,32 @@ func (db *DB) UpdateEnvironment(env *Environment) error {
 			backend = ?,
 			backend_id = ?,
 			repo_path = ?,
+			remote_name = ?,
 			remote_url = ?,
 			branch_name = ?,
 			base_branch = ?,
-			status = ?
+			status = ?,
+			expires_at = ?,
+			task = ?,
+			profile = ?,
+			removed_at = ?,
+			cpus = ?,
+			memory = ?
 		WHERE id = ?`,
 		env.Backend,
 		nullString(env.BackendID),
 		env.RepoPath,
+		nullString(env.Remote),
 		nullString(env.RemoteURL),
 		env.BranchName,
 		env.BaseBranch,
 		string(env.Status),
+		nullTime(env.ExpiresAt),
+		nullString(env.Task),
+		nullString(env.Profile),
+		nullTime(env.RemovedAt),
+		nullInt(int64(env.CPUs)),
+		nullInt(int64(env.Memory)),
 		env.ID,
 	)
 	if err != nil {
@@ -209,6 +316,65 @@ func (db *DB) UpdateEnvironment(env *Environment) error {
 	return nil
 }
 
+// BulkUpdateStatus transitions the given environments from one status to
+// another in a single transaction. Every environment must exist and currently
+// be in the from status; otherwise nothing is updated and an error wrapping
+// ErrEnvironmentNotFound or ErrUnexpectedStatus is returned.
+func (db *DB) BulkUpdateStatus(ids []string, from, to EnvironmentStatus) error {
+	if !IsValidStatus(from) {
+		return fmt.Errorf("%w: %s", ErrInvalidStatus, from)
+	}
+	if !IsValidStatus(to) {
+		return fmt.Errorf("%w: %s", ErrInvalidStatus, to)
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare("UPDATE environments SET status = ? WHERE id = ? AND status = ?")
+	if err != nil {
+		return fmt.Errorf("failed to prepare status update: %w", err)
+	}
+	defer stmt.Close()
+
+	for _, id := range ids {
+		result, err := stmt.Exec(string(to), id, string(from))
+		if err != nil {
+			return fmt.Errorf("failed to update environment %s: %w", id, err)
+		}
+
+		rows, err := result.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("failed to check rows affected: %w", err)
+		}
+		if rows == 1 {
+			continue
+		}
+
+		// Distinguish a missing environment from one in the wrong status
+		var current string
+		err = tx.QueryRow("SELECT status FROM environments WHERE id = ?", id).Scan(&current)
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("%w: %s", ErrEnvironmentNotFound, id)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to get environment %s: %w", id, err)
+		}
+		return fmt.Errorf("%w: %s is %s, expected %s", ErrUnexpectedStatus, id, current, from)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit status update: %w", err)
+	}
+	return nil
+}
+
 // DeleteEnvironment removes an environment from the database.
 func (db *DB) DeleteEnvironment(id string) error {
 	result, err := db.Exec("DELETE FROM environments WHERE id = ?", id)
@@ -226,19 +392,143 @@ func (db *DB) DeleteEnvironment(id string) error {
 	return nil
 }
 
+// environmentRecordTables are the tables holding records kept for an
+// environment, keyed by environment_id. A table added for them must be
+// listed here so the records go with their environment.
+var environmentRecordTables = []string{"commands", "setup_steps", "diagnostics", "agent_runs", "port_forwards"}
+
+// PurgeEnvironment deletes an environment's record together with the
+// records kept for it: command history, setup journal, diagnostics, agent
+// runs, and port forwards. It runs in one transaction. Returns
+// ErrEnvironmentNotFound if the environment has no record, after still
+// deleting any records left for it.
+func (db *DB) PurgeEnvironment(id string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	found, err := purgeEnvironment(tx, id)
+	if err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit environment deletion: %w", err)
+	}
+	if !found {
+		return ErrEnvironmentNotFound
+	}
+	return nil
+}
+
+// purgeEnvironment deletes environment id and its records using ex, which
+// may be a transaction, and reports whether it had a record.
+func purgeEnvironment(ex execer, id string) (bool, error) {
+	for _, table := range environmentRecordTables {
+		if _, err := ex.Exec("DELETE FROM "+table+" WHERE environment_id = ?", id); err != nil {
+			return false, fmt.Errorf("failed to delete %s for %s: %w", strings.ReplaceAll(table, "_", " "), id, err)
+		}
+	}
+	result, err := ex.Exec("DELETE FROM environments WHERE id = ?", id)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete environment %s: %w", id, err)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to check rows affected: %w", err)
+	}
+	return rows > 0, nil
+}
+
 // ListOptions specifies filters for listing environments.
 type ListOptions struct {
 	RepoPath string              // Filter by repository path (exact match)
 	Backend  string              // Filter by backend name
+	Branch   string              // Filter by branch name (exact match)
 	Statuses []EnvironmentStatus // Filter by status (any of these)
+	Pooled   PoolFilter          // Filter by whether environments are pooled (default: either)
+
+	ExpiredBefore time.Time // Only environments expiring at or before this time
+	CreatedBefore time.Time // Only environments created before this time
+	RemovedBefore time.Time // Only environments moved to the trash before this time
+
+	Sort   SortOrder // Result order (default SortCreated)
+	Limit  int       // Maximum number of results; 0 for no limit
+	Offset int       // Number of results to skip, for paging with Limit
+}
+
+// PoolFilter selects environments by whether they are waiting in a warm
+// pool (see Environment.Pooled).
+type PoolFilter int
+
+const (
+	PoolAny     PoolFilter = iota // Pooled or not
+	PoolExclude                   // Only environments that aren't pooled
+	PoolOnly                      // Only pooled environments
+)
+
+// condition returns the WHERE condition for f, or "" for PoolAny.
+func (f PoolFilter) condition() string {
+	switch f {
+	case PoolExclude:
+		return "pooled = 0"
+	case PoolOnly:
+		return "pooled = 1"
+	}
+	return ""
+}
+
+// SortOrder selects the order ListEnvironments returns environments in.
+type SortOrder string
+
+const (
+	// SortCreated orders by creation time, newest first.
+	SortCreated SortOrder = "created"
+
+	// SortStatus orders by status through the lifecycle (provisioning,
+	// ready, stopped, failed, removed), newest first within a status.
+	SortStatus SortOrder = "status"
+
+	// SortLastUsed orders by the most recent command run in the
+	// environment (or its creation, if none), most recent first.
+	SortLastUsed SortOrder = "last-used"
+
+	// SortName orders by branch name.
+	SortName SortOrder = "name"
+)
+
+// SortOrders contains all valid sort orders.
+var SortOrders = []SortOrder{SortCreated, SortStatus, SortLastUsed, SortName}
+
+// orderBy returns the ORDER BY clause for o, or an error if o is unknown.
+func (o SortOrder) orderBy() (string, error) {
+	switch o {
+	case "", SortCreated:
+		return "created_at DESC", nil
+	case SortStatus:
+		var b strings.Builder
+		b.WriteString("CASE status")
+		for i, s := range ValidStatuses {
+			fmt.Fprintf(&b, " WHEN '%s' THEN %d", s, i)
+		}
+		b.WriteString(" END, created_at DESC")
+		return b.String(), nil
+	case SortLastUsed:
+		return `COALESCE(
+			(SELECT MAX(julianday(started_at)) FROM commands WHERE environment_id = environments.id),
+			julianday(created_at)) DESC, created_at DESC`, nil
+	case SortName:
+		return "branch_name, created_at DESC", nil
+	}
+	return "", fmt.Errorf("unknown sort order %q", o)
 }
 
 // ListEnvironments returns all environments matching the given filters.
 // If no filters are specified, returns all environments.
 func (db *DB) ListEnvironments(opts ListOptions) ([]*Environment, error) {
 	query := `
-		SELECT id, backend, backend_id, repo_path, remote_url,
-		       branch_name, base_branch, created_at, status
+		SELECT ` + environmentColumns + `
 		FROM environments
 	`
 
@@ -255,6 +545,11 @@ func (db *DB) ListEnvironments(opts ListOptions) ([]*Environment, error) {
 		args = append(args, opts.Backend)
 	}
 
+	if opts.Branch != "" {
+		conditions = append(conditions, "branch_name = ?")
+		args = append(args, opts.Branch)
+	}
+
 	if len(opts.Statuses) > 0 {
 		placeholders := make([]string, len(opts.Statuses))
 		for i, s := range opts.Statuses {
@@ -264,11 +559,46 @@ func (db *DB) ListEnvironments(opts ListOptions) ([]*Environment, error) {
 		conditions = append(conditions, fmt.Sprintf("status IN (%s)", strings.Join(placeholders, ", ")))
 	}
 
+	if c := opts.Pooled.condition(); c != "" {
+		conditions = append(conditions, c)
+	}
+
+	if !opts.ExpiredBefore.IsZero() {
+		conditions = append(conditions, "expires_at IS NOT NULL AND expires_at <= ?")
+		args = append(args, opts.ExpiredBefore.UTC().Format(time.RFC3339))
+	}
+
+	if !opts.CreatedBefore.IsZero() {
+		conditions = append(conditions, "created_at < ?")
+		args = append(args, opts.CreatedBefore.UTC().Format(time.RFC3339))
+	}
+
+	if !opts.RemovedBefore.IsZero() {
+		conditions = append(conditions, "removed_at IS NOT NULL AND removed_at < ?")
+		args = append(args, opts.RemovedBefore.UTC().Format(time.RFC3339))
+	}
+
 	if len(conditions) > 0 {
 		query += " WHERE " + strings.Join(conditions, " AND ")
 	}
 
-	query += " ORDER BY created_at DESC"
+	orderBy, err := opts.Sort.orderBy()
+	if err != nil {
+		return nil, err
+	}
+	query += " ORDER BY " + orderBy
+
+	if opts.Limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, opts.Limit)
+	}
+	if opts.Offset > 0 {
+		if opts.Limit <= 0 {
+			query += " LIMIT -1" // SQLite requires LIMIT with OFFSET
+		}
+		query += " OFFSET ?"
+		args = append(args, opts.Offset)
+	}
 
 	rows, err := db.Query(query, args...)
 	if err != nil {
@@ -292,7 +622,8 @@ func (db *DB) ListEnvironments(opts ListOptions) ([]*Environment, error) {
 	return envs, nil
 }
 
-// CountEnvironments returns the number of environments matching the given filters.
+// CountEnvironments returns the number of environments matching the given
+// filters. Sort, Limit, and Offset are ignored.
 func (db *DB) CountEnvironments(opts ListOptions) (int, error) {
 	query := "SELECT COUNT(*) FROM environments"
 
@@ -318,6 +649,25 @@ func (db *DB) CountEnvironments(opts ListOptions) (int, error) {
 		conditions = append(conditions, fmt.Sprintf("status IN (%s)", strings.Join(placeholders, ", ")))
 	}
 
+	if c := opts.Pooled.condition(); c != "" {
+		conditions = append(conditions, c)
+	}
+
+	if !opts.ExpiredBefore.IsZero() {
+		conditions = append(conditions, "expires_at IS NOT NULL AND expires_at <= ?")
+		args = append(args, opts.ExpiredBefore.UTC().Format(time.RFC3339))
+	}
+
+	if !opts.CreatedBefore.IsZero() {
+		conditions = append(conditions, "created_at < ?")
+		args = append(args, opts.CreatedBefore.UTC().Format(time.RFC3339))
+	}
+
+	if !opts.RemovedBefore.IsZero() {
+		conditions = append(conditions, "removed_at IS NOT NULL AND removed_at < ?")
+		args = append(args, opts.RemovedBefore.UTC().Format(time.RFC3339))
+	}
+
 	if len(conditions) > 0 {
 		query += " WHERE " + strings.Join(conditions, " AND ")
 	}
@@ -331,6 +681,32 @@ func (db *DB) CountEnvironments(opts ListOptions) (int, error) {
 	return count, nil
 }
 
+// TakePooledEnvironment takes the oldest ready environment from the warm
+// pool of repoPath's environments created with backend and remote: it is
+// no longer pooled and is recorded as created at now. Each pooled
+// environment is taken at most once, however many processes try. Returns
+// ErrEnvironmentNotFound if the pool has none ready.
+func (db *DB) TakePooledEnvironment(repoPath, backend, remote string, now time.Time) (*Environment, error) {
+	var id string
+	err := db.QueryRow(`
+		UPDATE environments SET pooled = 0, created_at = ?
+		WHERE id = (
+			SELECT id FROM environments
+			WHERE pooled = 1 AND status = ? AND repo_path = ? AND backend = ? AND COALESCE(remote_name, '') = ?
+			ORDER BY created_at, id LIMIT 1
+		) AND pooled = 1
+		RETURNING id`,
+		now.UTC().Format(time.RFC3339), string(StatusReady), repoPath, backend, remote,
+	).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrEnvironmentNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to take pooled environment: %w", err)
+	}
+	return db.GetEnvironment(id)
+}
+
 // scanner is an interface for sql.Row and sql.Rows.
 type scanner interface {
 	Scan(dest ...any) error
@@ -339,7 +715,8 @@ type scanner interface {
 // scanEnvironment scans a row into an Environment struct.
 func scanEnvironment(s scanner) (*Environment, error) {
 	var env Environment
-	var backendID, remoteURL sql.NullString
+	var backendID, remote, remoteURL, expiresAt, task, profile, removedAt sql.NullString
+	var cpus, memory sql.NullInt64
 	var createdAt string
 
 	err := s.Scan(
@@ -347,24 +724,51 @@ func scanEnvironment(s scanner) (*Environment, error) {
 		&env.Backend,
 		&backendID,
 		&env.RepoPath,
+		&remote,
 		&remoteURL,
 		&env.BranchName,
 		&env.BaseBranch,
 		&createdAt,
 		&env.Status,
+		&expiresAt,
+		&task,
+		&profile,
+		&removedAt,
+		&cpus,
+		&memory,
+		&env.Pooled,
 	)
 	if err != nil {
 		return nil, err
 	}
 
 	env.BackendID = backendID.String
+	env.Remote = remote.String
 	env.RemoteURL = remoteURL.String
+	env.Task = task.String
+	env.Profile = profile.String
+	env.CPUs = int(cpus.Int64)
+	env.Memory = uint64(memory.Int64)
 
 	env.CreatedAt, err = time.Parse(time.RFC3339, createdAt)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse created_at: %w", err)
 	}
 
+	if expiresAt.Valid {
+		env.ExpiresAt, err = time.Parse(time.RFC3339, expiresAt.String)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse expires_at: %w", err)
+		}
+	}
+
+	if removedAt.Valid {
+		env.RemovedAt, err = time.Parse(time.RFC3339, removedAt.String)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse removed_at: %w", err)
+		}
+	}
+
 	return &env, nil
 }
 
@@ -375,3 +779,19 @@ func nullString(s string) sql.NullString {
 	}
 	return sql.NullString{String: s, Valid: true}
 }
+
+// nullInt converts zero to NULL for optional fields.
+func nullInt(n int64) sql.NullInt64 {
+	if n == 0 {
+		return sql.NullInt64{}
+	}
+	return sql.NullInt64{Int64: n, Valid: true}
+}
+
+// nullTime converts a zero time to NULL and others to RFC3339 text.
+func nullTime(t time.Time) sql.NullString {
+	if t.IsZero() {
+		return sql.NullString{}
+	}
+	return sql.NullString{String: t.UTC().Format(time.RFC3339), Valid: true}
+}
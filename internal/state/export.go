@@ -0,0 +1,290 @@
+package state
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// SnapshotVersion is the format version of exported snapshots.
+const SnapshotVersion = 1
+
+// Snapshot is a portable copy of the state database, used to back up or
+// migrate records between machines.
+type Snapshot struct {
+	Version      int                   `json:"version"`
+	ExportedAt   time.Time             `json:"exported_at"`
+	Environments []SnapshotEnvironment `json:"environments"`
+	Commands     []SnapshotCommand     `json:"commands"`
+	AgentRuns    []SnapshotAgentRun    `json:"agent_runs,omitempty"`
+}
+
+// SnapshotEnvironment is the exported form of an Environment.
+type SnapshotEnvironment struct {
+	ID         string            `json:"id"`
+	Backend    string            `json:"backend"`
+	BackendID  string            `json:"backend_id,omitempty"`
+	RepoPath   string            `json:"repo_path"`
+	Remote     string            `json:"remote,omitempty"`
+	RemoteURL  string            `json:"remote_url,omitempty"`
+	BranchName string            `json:"branch_name"`
+	BaseBranch string            `json:"base_branch"`
+	CreatedAt  time.Time         `json:"created_at"`
+	Status     EnvironmentStatus `json:"status"`
+	ExpiresAt  time.Time         `json:"expires_at,omitzero"`
+	Task       string            `json:"task,omitempty"`
+	Profile    string            `json:"profile,omitempty"`
+	RemovedAt  time.Time         `json:"removed_at,omitzero"`
+	CPUs       int               `json:"cpus,omitempty"`
+	Memory     uint64            `json:"memory,omitempty"`
+	Pooled     bool              `json:"pooled,omitempty"`
+}
+
+// SnapshotOf returns the exported form of env.
+func SnapshotOf(env *Environment) SnapshotEnvironment {
+	return SnapshotEnvironment{
+		ID:         env.ID,
+		Backend:    env.Backend,
+		BackendID:  env.BackendID,
+		RepoPath:   env.RepoPath,
+		Remote:     env.Remote,
+		RemoteURL:  env.RemoteURL,
+		BranchName: env.BranchName,
+		BaseBranch: env.BaseBranch,
+		CreatedAt:  env.CreatedAt.UTC(),
+		Status:     env.Status,
+		ExpiresAt:  env.ExpiresAt,
+		Task:       env.Task,
+		Profile:    env.Profile,
+		RemovedAt:  env.RemovedAt,
+		CPUs:       env.CPUs,
+		Memory:     env.Memory,
+		Pooled:     env.Pooled,
+	}
+}
+
+// Environment converts se back to an Environment.
+func (se SnapshotEnvironment) Environment() *Environment {
+	return &Environment{
+		ID:         se.ID,
+		Backend:    se.Backend,
+		BackendID:  se.BackendID,
+		RepoPath:   se.RepoPath,
+		Remote:     se.Remote,
+		RemoteURL:  se.RemoteURL,
+		BranchName: se.BranchName,
+		BaseBranch: se.BaseBranch,
+		CreatedAt:  se.CreatedAt,
+		Status:     se.Status,
+		ExpiresAt:  se.ExpiresAt,
+		Task:       se.Task,
+		Profile:    se.Profile,
+		RemovedAt:  se.RemovedAt,
+		CPUs:       se.CPUs,
+		Memory:     se.Memory,
+		Pooled:     se.Pooled,
+	}
+}
+
+// SnapshotCommand is the exported form of a CommandRecord.
+// Row IDs are not exported; they are reassigned on import.
+type SnapshotCommand struct {
+	EnvironmentID string        `json:"environment_id"`
+	Source        CommandSource `json:"source"`
+	Command       string        `json:"command"`
+	ExitCode      int           `json:"exit_code"`
+	StartedAt     time.Time     `json:"started_at"`
+	DurationMs    int64         `json:"duration_ms"`
+	Output        string        `json:"output,omitempty"`
+}
+
+// SnapshotAgentRun is the exported form of an AgentRun.
+// Row IDs are not exported; they are reassigned on import.
+type SnapshotAgentRun struct {
+	EnvironmentID string         `json:"environment_id"`
+	Command       string         `json:"command"`
+	ProcessID     string         `json:"process_id"`
+	StartedAt     time.Time      `json:"started_at"`
+	FinishedAt    time.Time      `json:"finished_at,omitzero"`
+	ExitCode      int            `json:"exit_code,omitempty"`
+	Status        AgentRunStatus `json:"status"`
+}
+
+// ConflictMode controls how Import handles environments whose ID already exists.
+type ConflictMode string
+
+const (
+	// ConflictFail aborts the import without changes if any ID already exists.
+	ConflictFail ConflictMode = "fail"
+
+	// ConflictSkip keeps existing environments and ignores the imported copies.
+	ConflictSkip ConflictMode = "skip"
+
+	// ConflictOverwrite replaces existing environments, and everything
+	// recorded for them (see DB.PurgeEnvironment), with the imported copies.
+	ConflictOverwrite ConflictMode = "overwrite"
+)
+
+// ErrDuplicateID is returned by Import in ConflictFail mode when an imported
+// environment ID already exists.
+var ErrDuplicateID = errors.New("environment ID already exists")
+
+// ImportResult summarizes the outcome of an Import.
+type ImportResult struct {
+	Imported    int // Environments inserted
+	Skipped     int // Existing environments kept (ConflictSkip)
+	Overwritten int // Existing environments replaced (ConflictOverwrite)
+	Commands    int // Command records inserted
+	AgentRuns   int // Agent runs inserted
+}
+
+// Export returns a snapshot of all environments, command history, and
+// agent runs.
+func (db *DB) Export() (*Snapshot, error) {
+	envs, err := db.ListEnvironments(ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	cmds, err := db.ListCommands(CommandListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	runs, err := db.ListAgentRuns("")
+	if err != nil {
+		return nil, err
+	}
+
+	snap := &Snapshot{
+		Version:      SnapshotVersion,
+		ExportedAt:   time.Now().UTC(),
+		Environments: make([]SnapshotEnvironment, 0, len(envs)),
+		Commands:     make([]SnapshotCommand, 0, len(cmds)),
+	}
+	for _, env := range envs {
+		snap.Environments = append(snap.Environments, SnapshotOf(env))
+	}
+	for _, c := range cmds {
+		snap.Commands = append(snap.Commands, SnapshotCommand{
+			EnvironmentID: c.EnvironmentID,
+			Source:        c.Source,
+			Command:       c.Command,
+			ExitCode:      c.ExitCode,
+			StartedAt:     c.StartedAt.UTC(),
+			DurationMs:    c.Duration.Milliseconds(),
+			Output:        c.Output,
+		})
+	}
+	for _, r := range runs {
+		snap.AgentRuns = append(snap.AgentRuns, SnapshotAgentRun{
+			EnvironmentID: r.EnvironmentID,
+			Command:       r.Command,
+			ProcessID:     r.ProcessID,
+			StartedAt:     r.StartedAt.UTC(),
+			FinishedAt:    r.FinishedAt,
+			ExitCode:      r.ExitCode,
+			Status:        r.Status,
+		})
+	}
+	return snap, nil
+}
+
+// Import loads a snapshot in a single transaction. Duplicate environment IDs
+// are handled according to mode; on any error nothing is imported.
+// Command records and agent runs are imported only for environments that
+// were inserted or overwritten.
+func (db *DB) Import(snap *Snapshot, mode ConflictMode) (ImportResult, error) {
+	var result ImportResult
+
+	if snap.Version != SnapshotVersion {
+		return ImportResult{}, fmt.Errorf("unsupported snapshot version %d (expected %d)", snap.Version, SnapshotVersion)
+	}
+	switch mode {
+	case ConflictFail, ConflictSkip, ConflictOverwrite:
+	default:
+		return ImportResult{}, fmt.Errorf("invalid conflict mode %q: must be fail, skip, or overwrite", mode)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return ImportResult{}, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	imported := make(map[string]bool, len(snap.Environments))
+	for _, se := range snap.Environments {
+		env := se.Environment()
+		if !IsValidStatus(env.Status) {
+			return ImportResult{}, fmt.Errorf("environment %s: %w: %s", env.ID, ErrInvalidStatus, env.Status)
+		}
+
+		var exists bool
+		if err := tx.QueryRow("SELECT EXISTS(SELECT 1 FROM environments WHERE id = ?)", env.ID).Scan(&exists); err != nil {
+			return ImportResult{}, fmt.Errorf("failed to check environment %s: %w", env.ID, err)
+		}
+
+		if exists {
+			switch mode {
+			case ConflictFail:
+				return ImportResult{}, fmt.Errorf("%w: %s", ErrDuplicateID, env.ID)
+			case ConflictSkip:
+				result.Skipped++
+				continue
+			case ConflictOverwrite:
+				if _, err := purgeEnvironment(tx, env.ID); err != nil {
+					return ImportResult{}, err
+				}
+				result.Overwritten++
+			}
+		} else {
+			result.Imported++
+		}
+
+		if err := insertEnvironment(tx, env); err != nil {
+			return ImportResult{}, fmt.Errorf("failed to import environment %s: %w", env.ID, err)
+		}
+		imported[env.ID] = true
+	}
+
+	for _, sc := range snap.Commands {
+		if !imported[sc.EnvironmentID] {
+			continue
+		}
+		rec := &CommandRecord{
+			EnvironmentID: sc.EnvironmentID,
+			Source:        sc.Source,
+			Command:       sc.Command,
+			ExitCode:      sc.ExitCode,
+			StartedAt:     sc.StartedAt,
+			Duration:      time.Duration(sc.DurationMs) * time.Millisecond,
+			Output:        sc.Output,
+		}
+		if _, err := insertCommand(tx, rec); err != nil {
+			return ImportResult{}, err
+		}
+		result.Commands++
+	}
+
+	for _, sr := range snap.AgentRuns {
+		if !imported[sr.EnvironmentID] {
+			continue
+		}
+		run := &AgentRun{
+			EnvironmentID: sr.EnvironmentID,
+			Command:       sr.Command,
+			ProcessID:     sr.ProcessID,
+			StartedAt:     sr.StartedAt,
+			FinishedAt:    sr.FinishedAt,
+			ExitCode:      sr.ExitCode,
+			Status:        sr.Status,
+		}
+		if _, err := insertAgentRun(tx, run); err != nil {
+			return ImportResult{}, err
+		}
+		result.AgentRuns++
+	}
+
+	if err := tx.Commit(); err != nil {
+		return ImportResult{}, fmt.Errorf("failed to commit import: %w", err)
+	}
+	return result, nil
+}
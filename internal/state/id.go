@@ -4,27 +4,77 @@ import (
 	"crypto/rand"
 	"encoding/hex"
 	"fmt"
+	"strings"
+	"sync/atomic"
 )
 
-// IDLength is the full length of an environment ID in hex characters.
+// IDLength is the default length of a generated environment ID in hex
+// characters.
 const IDLength = 32
 
-// ShortIDLength is the display length of an environment ID.
+// MinIDLength and MaxIDLength bound the length of any environment ID,
+// however it was generated.
+const (
+	MinIDLength = 8
+	MaxIDLength = 64
+)
+
+// ShortIDLength is the default display length of an environment ID.
 const ShortIDLength = 12
 
+// shortIDLength is the display length used by ShortID.
+var shortIDLength atomic.Int64
+
+func init() {
+	shortIDLength.Store(ShortIDLength)
+}
+
+// SetShortIDLength sets the display length used by ShortID, e.g., from
+// naming.short_id_length in the global config. Lengths below 4 are raised
+// to 4 so that short IDs stay usable as prefixes.
+func SetShortIDLength(n int) {
+	shortIDLength.Store(int64(max(n, 4)))
+}
+
 // GenerateID generates a new 32-character hex ID using crypto/rand.
 func GenerateID() (string, error) {
-	b := make([]byte, IDLength/2) // 16 bytes = 128 bits
+	return GenerateHexID(IDLength)
+}
+
+// GenerateHexID generates a new random ID of n lowercase hex characters.
+func GenerateHexID(n int) (string, error) {
+	if n < MinIDLength || n > MaxIDLength {
+		return "", fmt.Errorf("invalid ID length %d: must be between %d and %d", n, MinIDLength, MaxIDLength)
+	}
+	b := make([]byte, (n+1)/2)
 	if _, err := rand.Read(b); err != nil {
 		return "", fmt.Errorf("failed to generate ID: %w", err)
 	}
-	return hex.EncodeToString(b), nil
+	return hex.EncodeToString(b)[:n], nil
+}
+
+// ValidID reports whether id is in canonical form: MinIDLength to
+// MaxIDLength lowercase letters and digits, optionally in hyphen-separated
+// words (e.g., "brave-otter-3f9c"). The state database stores only
+// canonical IDs, so that any prefix of one can be matched literally.
+func ValidID(id string) bool {
+	if len(id) < MinIDLength || len(id) > MaxIDLength {
+		return false
+	}
+	if !isIDString(id) {
+		return false
+	}
+	return !strings.HasPrefix(id, "-") && !strings.HasSuffix(id, "-") && !strings.Contains(id, "--")
 }
 
-// ShortID returns the first 12 characters of an ID for display.
+// ShortID returns an ID for display: the first 12 characters (or the length
+// set with SetShortIDLength) of a hex ID. Word IDs, which contain hyphens,
+// are returned whole, since cutting one mid-word would make it harder to
+// read rather than easier.
 func ShortID(id string) string {
-	if len(id) < ShortIDLength {
+	n := int(shortIDLength.Load())
+	if len(id) <= n || strings.Contains(id, "-") {
 		return id
 	}
-	return id[:ShortIDLength]
+	return id[:n]
 }
@@ -0,0 +1,130 @@
+package state
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrImageNotFound is returned when no image matches.
+var ErrImageNotFound = errors.New("image not found")
+
+// Image is a base image a backend baked so workspaces can be cloned from
+// it instead of installing packages each time (see backend.ImageBaker).
+type Image struct {
+	ID         int64     // Auto-assigned row ID
+	Backend    string    // Backend that baked it and stores it
+	Key        string    // Identifies the base image and packages (see backend.ImageSpec.Key)
+	BaseImage  string    // Image it was baked from
+	Packages   []string  // Packages baked in
+	ImageID    string    // Backend's ID for it
+	CreatedAt  time.Time // When it was baked
+	LastUsedAt time.Time // When a workspace was last created from it
+}
+
+// imageColumns lists the images columns in the order scanImage expects.
+const imageColumns = `id, backend, key, base_image, packages, image_id, created_at, last_used_at`
+
+// AddImage records img unless an image with its backend and key is
+// recorded already, and reports whether it was added. The image's ID is
+// set when it is.
+func (db *DB) AddImage(img *Image) (bool, error) {
+	packages, err := json.Marshal(img.Packages)
+	if err != nil {
+		return false, fmt.Errorf("failed to encode packages: %w", err)
+	}
+	result, err := db.Exec(`
+		INSERT OR IGNORE INTO images (backend, key, base_image, packages, image_id, created_at, last_used_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		img.Backend, img.Key, img.BaseImage, string(packages), img.ImageID,
+		img.CreatedAt.UTC().Format(time.RFC3339), img.LastUsedAt.UTC().Format(time.RFC3339),
+	)
+	if err != nil {
+		return false, fmt.Errorf("failed to record image: %w", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to check rows affected: %w", err)
+	}
+	if n == 0 {
+		return false, nil
+	}
+	img.ID, err = result.LastInsertId()
+	if err != nil {
+		return false, fmt.Errorf("failed to get image ID: %w", err)
+	}
+	return true, nil
+}
+
+// GetImage returns the image backend baked for key.
+func (db *DB) GetImage(backend, key string) (*Image, error) {
+	row := db.QueryRow(`SELECT `+imageColumns+` FROM images WHERE backend = ? AND key = ?`, backend, key)
+	img, err := scanImage(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: %s", ErrImageNotFound, key)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get image: %w", err)
+	}
+	return img, nil
+}
+
+// ListImages returns every recorded image, most recently used first.
+func (db *DB) ListImages() ([]*Image, error) {
+	rows, err := db.Query(`SELECT ` + imageColumns + ` FROM images ORDER BY last_used_at DESC, id DESC`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list images: %w", err)
+	}
+	defer rows.Close()
+
+	var images []*Image
+	for rows.Next() {
+		img, err := scanImage(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan image: %w", err)
+		}
+		images = append(images, img)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list images: %w", err)
+	}
+	return images, nil
+}
+
+// TouchImage records that a workspace was created from image id at t.
+func (db *DB) TouchImage(id int64, t time.Time) error {
+	if _, err := db.Exec(`UPDATE images SET last_used_at = ? WHERE id = ?`, t.UTC().Format(time.RFC3339), id); err != nil {
+		return fmt.Errorf("failed to update image: %w", err)
+	}
+	return nil
+}
+
+// DeleteImage removes the record of image id.
+func (db *DB) DeleteImage(id int64) error {
+	if _, err := db.Exec(`DELETE FROM images WHERE id = ?`, id); err != nil {
+		return fmt.Errorf("failed to delete image: %w", err)
+	}
+	return nil
+}
+
+// scanImage scans a row into an Image.
+func scanImage(s scanner) (*Image, error) {
+	var img Image
+	var packages, createdAt, lastUsedAt string
+	err := s.Scan(&img.ID, &img.Backend, &img.Key, &img.BaseImage, &packages, &img.ImageID, &createdAt, &lastUsedAt)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(packages), &img.Packages); err != nil {
+		return nil, fmt.Errorf("failed to parse packages: %w", err)
+	}
+	if img.CreatedAt, err = time.Parse(time.RFC3339, createdAt); err != nil {
+		return nil, fmt.Errorf("failed to parse created_at: %w", err)
+	}
+	if img.LastUsedAt, err = time.Parse(time.RFC3339, lastUsedAt); err != nil {
+		return nil, fmt.Errorf("failed to parse last_used_at: %w", err)
+	}
+	return &img, nil
+}
@@ -0,0 +1,95 @@
+package state
+
+import (
+	"fmt"
+)
+
+// MetricValue is a persisted metric sample. Metrics are stored in the
+// database rather than in memory because most choir invocations are
+// short-lived processes; a long-running exporter reads them back.
+type MetricValue struct {
+	Name   string  // Sample name (e.g., "choir_environments_created_total")
+	Labels string  // Rendered label set (e.g., `backend="local"`), or ""
+	Value  float64 // Accumulated value
+}
+
+// AddMetrics adds each delta's value to the stored sample with the same
+// name and labels, creating samples as needed. All deltas are applied in a
+// single transaction so related samples (such as histogram buckets) stay
+// consistent.
+func (db *DB) AddMetrics(deltas []MetricValue) error {
+	if len(deltas) == 0 {
+		return nil
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(`
+		INSERT INTO metrics (name, labels, value) VALUES (?, ?, ?)
+		ON CONFLICT(name, labels) DO UPDATE SET value = value + excluded.value`)
+	if err != nil {
+		return fmt.Errorf("failed to prepare metric update: %w", err)
+	}
+	defer stmt.Close()
+
+	for _, d := range deltas {
+		if _, err := stmt.Exec(d.Name, d.Labels, d.Value); err != nil {
+			return fmt.Errorf("failed to update metric %s: %w", d.Name, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit metrics: %w", err)
+	}
+	return nil
+}
+
+// ListMetrics returns all persisted metric samples ordered by name and labels.
+func (db *DB) ListMetrics() ([]MetricValue, error) {
+	rows, err := db.Query("SELECT name, labels, value FROM metrics ORDER BY name, labels")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list metrics: %w", err)
+	}
+	defer rows.Close()
+
+	var values []MetricValue
+	for rows.Next() {
+		var v MetricValue
+		if err := rows.Scan(&v.Name, &v.Labels, &v.Value); err != nil {
+			return nil, fmt.Errorf("failed to scan metric: %w", err)
+		}
+		values = append(values, v)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate metrics: %w", err)
+	}
+	return values, nil
+}
+
+// CountByStatus returns the number of environments in each status.
+// Statuses with no environments are omitted.
+func (db *DB) CountByStatus() (map[EnvironmentStatus]int, error) {
+	rows, err := db.Query("SELECT status, COUNT(*) FROM environments GROUP BY status")
+	if err != nil {
+		return nil, fmt.Errorf("failed to count environments: %w", err)
+	}
+	defer rows.Close()
+
+	counts := make(map[EnvironmentStatus]int)
+	for rows.Next() {
+		var status string
+		var n int
+		if err := rows.Scan(&status, &n); err != nil {
+			return nil, fmt.Errorf("failed to scan count: %w", err)
+		}
+		counts[EnvironmentStatus(status)] = n
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate counts: %w", err)
+	}
+	return counts, nil
+}
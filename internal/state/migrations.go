@@ -4,6 +4,9 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"os"
+	"slices"
+	"time"
 )
 
 // migration represents a database schema migration.
@@ -62,6 +65,293 @@ CREATE INDEX idx_environments_status ON environments(status);
 DROP TABLE IF EXISTS agents;
 `,
 	},
+	{
+		version: 3,
+		name:    "create_commands_table",
+		up: `
+CREATE TABLE commands (
+    id              INTEGER PRIMARY KEY AUTOINCREMENT,
+    environment_id  TEXT NOT NULL,
+    source          TEXT NOT NULL,
+    command         TEXT NOT NULL,
+    exit_code       INTEGER NOT NULL,
+    started_at      TEXT NOT NULL,
+    duration_ms     INTEGER NOT NULL,
+    output          TEXT
+);
+
+CREATE INDEX idx_commands_environment ON commands(environment_id);
+`,
+	},
+	{
+		version: 4,
+		name:    "create_metrics_table",
+		up: `
+CREATE TABLE metrics (
+    name    TEXT NOT NULL,
+    labels  TEXT NOT NULL,
+    value   REAL NOT NULL,
+    PRIMARY KEY (name, labels)
+);
+`,
+	},
+	{
+		version: 5,
+		name:    "add_environments_expires_at",
+		up: `
+ALTER TABLE environments ADD COLUMN expires_at TEXT;
+
+CREATE INDEX idx_environments_expires_at ON environments(expires_at);
+`,
+	},
+	{
+		version: 6,
+		name:    "create_setup_steps_table",
+		up: `
+CREATE TABLE setup_steps (
+    environment_id  TEXT NOT NULL,
+    step            INTEGER NOT NULL,
+    name            TEXT NOT NULL,
+    started_at      TEXT NOT NULL,
+    finished_at     TEXT,
+    error           TEXT,
+    PRIMARY KEY (environment_id, step)
+);
+`,
+	},
+	{
+		version: 7,
+		name:    "create_repo_cache_table",
+		up: `
+CREATE TABLE repo_cache (
+    key        TEXT PRIMARY KEY,
+    value      TEXT NOT NULL,
+    stamp      TEXT NOT NULL,
+    cached_at  TEXT NOT NULL
+);
+`,
+	},
+	{
+		version: 8,
+		name:    "add_environments_created_at_index",
+		up: `
+CREATE INDEX idx_environments_created_at ON environments(created_at);
+`,
+	},
+	{
+		version: 9,
+		name:    "create_diagnostics_table",
+		up: `
+CREATE TABLE diagnostics (
+    environment_id  TEXT PRIMARY KEY,
+    captured_at     TEXT NOT NULL,
+    bundle          TEXT NOT NULL
+);
+`,
+	},
+	{
+		version: 10,
+		name:    "add_environments_remote_name",
+		up: `
+ALTER TABLE environments ADD COLUMN remote_name TEXT;
+`,
+	},
+	{
+		version: 11,
+		name:    "add_environments_task",
+		up: `
+ALTER TABLE environments ADD COLUMN task TEXT;
+`,
+	},
+	{
+		version: 12,
+		name:    "create_agent_runs_table",
+		up: `
+CREATE TABLE agent_runs (
+    id              INTEGER PRIMARY KEY AUTOINCREMENT,
+    environment_id  TEXT NOT NULL,
+    command         TEXT NOT NULL,
+    process_id      TEXT NOT NULL,
+    started_at      TEXT NOT NULL,
+    finished_at     TEXT,
+    exit_code       INTEGER
+);
+
+CREATE INDEX idx_agent_runs_environment ON agent_runs(environment_id, started_at);
+`,
+	},
+	{
+		version: 13,
+		name:    "add_agent_runs_status",
+		up: `
+ALTER TABLE agent_runs ADD COLUMN status TEXT NOT NULL DEFAULT 'running';
+UPDATE agent_runs SET status = CASE WHEN exit_code < 0 THEN 'crashed' ELSE 'exited' END
+WHERE finished_at IS NOT NULL;
+`,
+	},
+	{
+		version: 14,
+		name:    "create_port_forwards_table",
+		up: `
+CREATE TABLE port_forwards (
+    id              INTEGER PRIMARY KEY AUTOINCREMENT,
+    environment_id  TEXT NOT NULL,
+    guest_port      INTEGER NOT NULL,
+    host_port       INTEGER NOT NULL,
+    forward_id      TEXT NOT NULL,
+    created_at      TEXT NOT NULL
+);
+
+CREATE INDEX idx_port_forwards_environment ON port_forwards(environment_id);
+`,
+	},
+	{
+		version: 15,
+		name:    "add_environments_profile",
+		up: `
+ALTER TABLE environments ADD COLUMN profile TEXT;
+`,
+	},
+	{
+		version: 16,
+		name:    "add_environments_removed_at",
+		up: `
+ALTER TABLE environments ADD COLUMN removed_at TEXT;
+`,
+	},
+	{
+		version: 17,
+		name:    "add_environments_resources",
+		up: `
+ALTER TABLE environments ADD COLUMN cpus INTEGER;
+ALTER TABLE environments ADD COLUMN memory INTEGER;
+`,
+	},
+	{
+		version: 18,
+		name:    "create_provision_queue_table",
+		up: `
+CREATE TABLE provision_queue (
+    id              INTEGER PRIMARY KEY AUTOINCREMENT,
+    environment_id  TEXT NOT NULL UNIQUE,
+    pid             INTEGER NOT NULL,
+    queued_at       TEXT NOT NULL,
+    started_at      TEXT
+);
+`,
+	},
+	{
+		version: 19,
+		name:    "create_images_table",
+		up: `
+CREATE TABLE images (
+    id              INTEGER PRIMARY KEY AUTOINCREMENT,
+    backend         TEXT NOT NULL,
+    key             TEXT NOT NULL,
+    base_image      TEXT NOT NULL,
+    packages        TEXT NOT NULL,
+    image_id        TEXT NOT NULL,
+    created_at      TEXT NOT NULL,
+    last_used_at    TEXT NOT NULL,
+    UNIQUE (backend, key)
+);
+`,
+	},
+	{
+		version: 20,
+		name:    "add_environments_pooled",
+		up: `
+ALTER TABLE environments ADD COLUMN pooled INTEGER NOT NULL DEFAULT 0;
+`,
+	},
+}
+
+// MigrationStatus describes a schema migration and whether it has been
+// applied to a database.
+type MigrationStatus struct {
+	Version   int
+	Name      string
+	Applied   bool
+	AppliedAt time.Time // Zero if not applied
+}
+
+// MigrationStatuses reports every migration this build knows of, and any
+// applied by a newer build, for the database at path (DefaultDBPath if
+// empty). Unlike Open, it never creates or migrates the database: a missing
+// database has every migration pending.
+func MigrationStatuses(path string) ([]MigrationStatus, error) {
+	var err error
+	if path == "" {
+		path, err = DefaultDBPath()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	applied := make(map[int]MigrationStatus)
+	if _, statErr := os.Stat(path); path == ":memory:" || statErr == nil {
+		db, err := openDB(path)
+		if err != nil {
+			return nil, err
+		}
+		defer db.Close()
+		applied, err = db.appliedMigrations()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var statuses []MigrationStatus
+	for _, m := range migrations {
+		s, ok := applied[m.version]
+		if !ok {
+			s = MigrationStatus{Version: m.version, Name: m.name}
+		}
+		delete(applied, m.version)
+		statuses = append(statuses, s)
+	}
+	for _, s := range applied {
+		statuses = append(statuses, s)
+	}
+	slices.SortFunc(statuses, func(a, b MigrationStatus) int { return a.Version - b.Version })
+	return statuses, nil
+}
+
+// appliedMigrations returns the migrations recorded in schema_migrations by
+// version, or none if the table doesn't exist yet.
+func (db *DB) appliedMigrations() (map[int]MigrationStatus, error) {
+	applied := make(map[int]MigrationStatus)
+	var exists int
+	err := db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'schema_migrations'`).Scan(&exists)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema: %w", err)
+	}
+	if exists == 0 {
+		return applied, nil
+	}
+
+	rows, err := db.Query(`SELECT version, name, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read applied migrations: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var s MigrationStatus
+		var appliedAt string
+		if err := rows.Scan(&s.Version, &s.Name, &appliedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan migration: %w", err)
+		}
+		s.Applied = true
+		// applied_at is written by SQLite's datetime('now'), in UTC
+		s.AppliedAt, _ = time.Parse(time.DateTime, appliedAt)
+		applied[s.Version] = s
+	}
+	return applied, rows.Err()
+}
+
+// LatestSchemaVersion returns the schema version this build migrates to.
+func LatestSchemaVersion() int {
+	return migrations[len(migrations)-1].version
 }
 
 // migrate runs all pending migrations.
@@ -84,6 +374,13 @@ func (db *DB) migrate() error {
 		return fmt.Errorf("failed to get schema version: %w", err)
 	}
 
+	// Back up an existing database before changing its schema
+	if currentVersion > 0 && currentVersion < LatestSchemaVersion() {
+		if err := db.backup(currentVersion); err != nil {
+			return err
+		}
+	}
+
 	// Run pending migrations
 	for _, m := range migrations {
 		if m.version <= currentVersion {
@@ -0,0 +1,83 @@
+package state
+
+import (
+	"fmt"
+	"time"
+)
+
+// PortForward is a workspace port forwarded to the host by
+// `choir env port` or at creation from the project's ports config.
+type PortForward struct {
+	ID            int64     // Auto-assigned row ID
+	EnvironmentID string    // Environment whose workspace the port is in
+	GuestPort     int       // Port in the workspace
+	HostPort      int       // Port on the host
+	ForwardID     string    // Backend's ID for the forward
+	CreatedAt     time.Time // When the forward was started
+}
+
+// AddPortForward records an active port forward. The forward's ID is set
+// on success.
+func (db *DB) AddPortForward(f *PortForward) error {
+	result, err := db.Exec(`
+		INSERT INTO port_forwards (environment_id, guest_port, host_port, forward_id, created_at)
+		VALUES (?, ?, ?, ?, ?)`,
+		f.EnvironmentID, f.GuestPort, f.HostPort, f.ForwardID, f.CreatedAt.UTC().Format(time.RFC3339Nano),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to record port forward: %w", err)
+	}
+	f.ID, err = result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("failed to get port forward ID: %w", err)
+	}
+	return nil
+}
+
+// ListPortForwards returns the port forwards recorded for an environment,
+// by host port.
+func (db *DB) ListPortForwards(environmentID string) ([]*PortForward, error) {
+	rows, err := db.Query(`
+		SELECT id, environment_id, guest_port, host_port, forward_id, created_at
+		FROM port_forwards WHERE environment_id = ?
+		ORDER BY host_port, id`,
+		environmentID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list port forwards: %w", err)
+	}
+	defer rows.Close()
+
+	var forwards []*PortForward
+	for rows.Next() {
+		var f PortForward
+		var createdAt string
+		if err := rows.Scan(&f.ID, &f.EnvironmentID, &f.GuestPort, &f.HostPort, &f.ForwardID, &createdAt); err != nil {
+			return nil, fmt.Errorf("failed to scan port forward: %w", err)
+		}
+		if f.CreatedAt, err = time.Parse(time.RFC3339Nano, createdAt); err != nil {
+			return nil, fmt.Errorf("failed to parse created_at: %w", err)
+		}
+		forwards = append(forwards, &f)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list port forwards: %w", err)
+	}
+	return forwards, nil
+}
+
+// DeletePortForward removes the record of one port forward.
+func (db *DB) DeletePortForward(id int64) error {
+	if _, err := db.Exec(`DELETE FROM port_forwards WHERE id = ?`, id); err != nil {
+		return fmt.Errorf("failed to delete port forward: %w", err)
+	}
+	return nil
+}
+
+// DeletePortForwards removes all port forwards recorded for an environment.
+func (db *DB) DeletePortForwards(environmentID string) error {
+	if _, err := db.Exec(`DELETE FROM port_forwards WHERE environment_id = ?`, environmentID); err != nil {
+		return fmt.Errorf("failed to delete port forwards: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package state
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// QueuedProvision is an environment waiting in, or holding a slot of, the
+// provision queue, which limits how many environments are provisioned at
+// once across choir processes.
+type QueuedProvision struct {
+	ID            int64     // Auto-assigned row ID; lower IDs were queued first
+	EnvironmentID string    // Environment to provision
+	PID           int       // Process that will provision it
+	QueuedAt      time.Time // When it joined the queue
+	StartedAt     time.Time // When it got a slot (zero while waiting)
+}
+
+// Running reports whether q holds a slot.
+func (q *QueuedProvision) Running() bool {
+	return !q.StartedAt.IsZero()
+}
+
+// EnqueueProvision adds environmentID to the end of the provision queue,
+// to be provisioned by process pid. An environment already queued is
+// queued again at the end.
+func (db *DB) EnqueueProvision(environmentID string, pid int) error {
+	_, err := db.Exec(`
+		INSERT OR REPLACE INTO provision_queue (environment_id, pid, queued_at)
+		VALUES (?, ?, ?)`,
+		environmentID, pid, time.Now().UTC().Format(time.RFC3339Nano),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to queue provision: %w", err)
+	}
+	return nil
+}
+
+// StartProvision gives environmentID a provisioning slot if it is first in
+// line and fewer than limit environments hold one, and reports whether it
+// did. A limit of zero or less means no limit. The check and the claim are
+// one statement, so concurrent callers can't both take the last slot.
+func (db *DB) StartProvision(environmentID string, limit int) (bool, error) {
+	result, err := db.Exec(`
+		UPDATE provision_queue SET started_at = ?
+		WHERE environment_id = ? AND started_at IS NULL
+		  AND (? <= 0 OR (
+		    (SELECT COUNT(*) FROM provision_queue WHERE started_at IS NOT NULL) < ?
+		    AND NOT EXISTS (
+		      SELECT 1 FROM provision_queue q
+		      WHERE q.started_at IS NULL AND q.id < provision_queue.id)))`,
+		time.Now().UTC().Format(time.RFC3339Nano), environmentID, limit, limit,
+	)
+	if err != nil {
+		return false, fmt.Errorf("failed to start provision: %w", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to check rows affected: %w", err)
+	}
+	return n == 1, nil
+}
+
+// FinishProvision removes environmentID from the provision queue, freeing
+// its slot if it held one.
+func (db *DB) FinishProvision(environmentID string) error {
+	if _, err := db.Exec(`DELETE FROM provision_queue WHERE environment_id = ?`, environmentID); err != nil {
+		return fmt.Errorf("failed to remove provision from queue: %w", err)
+	}
+	return nil
+}
+
+// ListProvisionQueue returns the provision queue: environments holding a
+// slot and those waiting for one, in the order they were queued.
+func (db *DB) ListProvisionQueue() ([]*QueuedProvision, error) {
+	rows, err := db.Query(`
+		SELECT id, environment_id, pid, queued_at, started_at
+		FROM provision_queue ORDER BY id`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list provision queue: %w", err)
+	}
+	defer rows.Close()
+
+	var queue []*QueuedProvision
+	for rows.Next() {
+		var q QueuedProvision
+		var queuedAt string
+		var startedAt sql.NullString
+		if err := rows.Scan(&q.ID, &q.EnvironmentID, &q.PID, &queuedAt, &startedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan provision queue: %w", err)
+		}
+		if q.QueuedAt, err = time.Parse(time.RFC3339Nano, queuedAt); err != nil {
+			return nil, fmt.Errorf("failed to parse queued_at: %w", err)
+		}
+		if startedAt.Valid {
+			if q.StartedAt, err = time.Parse(time.RFC3339Nano, startedAt.String); err != nil {
+				return nil, fmt.Errorf("failed to parse started_at: %w", err)
+			}
+		}
+		queue = append(queue, &q)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list provision queue: %w", err)
+	}
+	return queue, nil
+}
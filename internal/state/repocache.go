@@ -0,0 +1,54 @@
+package state
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrCacheMiss is returned when the repo cache has no entry for a key.
+var ErrCacheMiss = errors.New("cache miss")
+
+// CacheEntry is a cached piece of repository metadata (see package
+// repocache). Stamp records the state of the files the value was derived
+// from, so a reader can tell whether the value is still current.
+type CacheEntry struct {
+	Key      string
+	Value    string
+	Stamp    string
+	CachedAt time.Time
+}
+
+// GetCacheEntry returns the repo cache entry for key, or ErrCacheMiss.
+func (db *DB) GetCacheEntry(key string) (*CacheEntry, error) {
+	var cachedAt string
+	e := &CacheEntry{Key: key}
+	err := db.QueryRow(`SELECT value, stamp, cached_at FROM repo_cache WHERE key = ?`, key).
+		Scan(&e.Value, &e.Stamp, &cachedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrCacheMiss
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read repo cache: %w", err)
+	}
+	e.CachedAt, err = time.Parse(time.RFC3339Nano, cachedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse cached_at: %w", err)
+	}
+	return e, nil
+}
+
+// PutCacheEntry stores e in the repo cache, replacing any entry with the
+// same key.
+func (db *DB) PutCacheEntry(e *CacheEntry) error {
+	_, err := db.Exec(`
+		INSERT OR REPLACE INTO repo_cache (key, value, stamp, cached_at)
+		VALUES (?, ?, ?, ?)`,
+		e.Key, e.Value, e.Stamp, e.CachedAt.UTC().Format(time.RFC3339Nano),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to write repo cache: %w", err)
+	}
+	return nil
+}
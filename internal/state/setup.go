@@ -0,0 +1,114 @@
+package state
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// SetupStep is one journaled step of an environment's setup. A step that
+// started but never finished was interrupted, typically because the process
+// running setup crashed or was killed.
+type SetupStep struct {
+	EnvironmentID string
+	Step          int       // 1-based position in the setup sequence
+	Name          string    // Human-readable step, e.g. the setup command
+	StartedAt     time.Time // When the step started
+	FinishedAt    time.Time // When it finished; zero if it never did
+	Error         string    // Failure message; empty if it succeeded
+}
+
+// Finished reports whether the step ran to completion (successfully or not).
+func (s *SetupStep) Finished() bool {
+	return !s.FinishedAt.IsZero()
+}
+
+// StartSetupStep journals that a setup step started, replacing any record
+// of the same step from an earlier attempt.
+func (db *DB) StartSetupStep(environmentID string, step int, name string, at time.Time) error {
+	_, err := db.Exec(`
+		INSERT OR REPLACE INTO setup_steps (environment_id, step, name, started_at)
+		VALUES (?, ?, ?, ?)`,
+		environmentID, step, name, at.UTC().Format(time.RFC3339Nano),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to journal setup step: %w", err)
+	}
+	return nil
+}
+
+// FinishSetupStep journals that a setup step finished, with its error
+// message if it failed.
+func (db *DB) FinishSetupStep(environmentID string, step int, at time.Time, errMsg string) error {
+	_, err := db.Exec(`
+		UPDATE setup_steps SET finished_at = ?, error = ?
+		WHERE environment_id = ? AND step = ?`,
+		at.UTC().Format(time.RFC3339Nano), nullString(errMsg), environmentID, step,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to journal setup step: %w", err)
+	}
+	return nil
+}
+
+// ListSetupSteps returns an environment's journaled setup steps in order.
+func (db *DB) ListSetupSteps(environmentID string) ([]*SetupStep, error) {
+	rows, err := db.Query(`
+		SELECT environment_id, step, name, started_at, finished_at, error
+		FROM setup_steps WHERE environment_id = ? ORDER BY step`,
+		environmentID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list setup steps: %w", err)
+	}
+	defer rows.Close()
+
+	var steps []*SetupStep
+	for rows.Next() {
+		var s SetupStep
+		var startedAt string
+		var finishedAt, errMsg sql.NullString
+		if err := rows.Scan(&s.EnvironmentID, &s.Step, &s.Name, &startedAt, &finishedAt, &errMsg); err != nil {
+			return nil, fmt.Errorf("failed to scan setup step: %w", err)
+		}
+		if s.StartedAt, err = time.Parse(time.RFC3339Nano, startedAt); err != nil {
+			return nil, fmt.Errorf("failed to parse started_at: %w", err)
+		}
+		if finishedAt.Valid {
+			if s.FinishedAt, err = time.Parse(time.RFC3339Nano, finishedAt.String); err != nil {
+				return nil, fmt.Errorf("failed to parse finished_at: %w", err)
+			}
+		}
+		s.Error = errMsg.String
+		steps = append(steps, &s)
+	}
+	return steps, rows.Err()
+}
+
+// ErrNoInterruptedStep is returned by InterruptedSetupStep when every
+// journaled step finished.
+var ErrNoInterruptedStep = errors.New("no interrupted setup step")
+
+// InterruptedSetupStep returns the last setup step of an environment that
+// started but never finished, or ErrNoInterruptedStep.
+func (db *DB) InterruptedSetupStep(environmentID string) (*SetupStep, error) {
+	steps, err := db.ListSetupSteps(environmentID)
+	if err != nil {
+		return nil, err
+	}
+	for i := len(steps) - 1; i >= 0; i-- {
+		if !steps[i].Finished() {
+			return steps[i], nil
+		}
+	}
+	return nil, ErrNoInterruptedStep
+}
+
+// DeleteSetupSteps removes an environment's setup journal.
+func (db *DB) DeleteSetupSteps(environmentID string) error {
+	if _, err := db.Exec("DELETE FROM setup_steps WHERE environment_id = ?", environmentID); err != nil {
+		return fmt.Errorf("failed to delete setup steps: %w", err)
+	}
+	return nil
+}
@@ -2,8 +2,12 @@ package state
 
 import (
 	"errors"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
+	"unicode/utf8"
 )
 
 // openTestDB creates an in-memory database for testing.
@@ -76,6 +80,204 @@ func TestMigrations(t *testing.T) {
 	}
 }
 
+func TestOpenReadOnly(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.db")
+
+	// A missing database is created and migrated
+	db, err := OpenReadOnly(path)
+	if err != nil {
+		t.Fatalf("OpenReadOnly() of a new database failed: %v", err)
+	}
+	if v, _ := db.SchemaVersion(); v != LatestSchemaVersion() {
+		t.Errorf("SchemaVersion() = %d, want %d", v, LatestSchemaVersion())
+	}
+	env := &Environment{
+		ID: "abc123def456abc123def456abc12345", Backend: "local", RepoPath: "/test",
+		BranchName: "env/abc123de", BaseBranch: "main", CreatedAt: time.Now(), Status: StatusReady,
+	}
+	if err := db.CreateEnvironment(env); err != nil {
+		t.Fatalf("CreateEnvironment() failed: %v", err)
+	}
+	db.Close()
+
+	// A current database is opened read-only
+	db, err = OpenReadOnly(path)
+	if err != nil {
+		t.Fatalf("OpenReadOnly() failed: %v", err)
+	}
+	defer db.Close()
+	if _, err := db.GetEnvironment(env.ID); err != nil {
+		t.Errorf("GetEnvironment() failed: %v", err)
+	}
+	if err := db.DeleteEnvironment(env.ID); err == nil {
+		t.Error("DeleteEnvironment() through a read-only handle succeeded")
+	}
+}
+
+func TestOpenCurrent(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.db")
+
+	// A missing database isn't created
+	if _, err := OpenCurrent(path); !errors.Is(err, ErrSchemaBehind) {
+		t.Fatalf("OpenCurrent() of a missing database = %v, want ErrSchemaBehind", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("OpenCurrent() created the database")
+	}
+
+	db, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	// A current database is opened for writing
+	db, err = OpenCurrent(path)
+	if err != nil {
+		t.Fatalf("OpenCurrent() failed: %v", err)
+	}
+	if _, err := db.Exec("DELETE FROM schema_migrations WHERE version = ?", LatestSchemaVersion()); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	// One that is behind isn't migrated
+	if _, err := OpenCurrent(path); !errors.Is(err, ErrSchemaBehind) {
+		t.Fatalf("OpenCurrent() of an old schema = %v, want ErrSchemaBehind", err)
+	}
+	db, err = openDB(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if v, _ := db.SchemaVersion(); v != LatestSchemaVersion()-1 {
+		t.Errorf("SchemaVersion() = %d after OpenCurrent(), want %d", v, LatestSchemaVersion()-1)
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.db")
+
+	from, to, err := Migrate(path)
+	if err != nil {
+		t.Fatalf("Migrate() failed: %v", err)
+	}
+	if from != 0 || to != LatestSchemaVersion() {
+		t.Errorf("Migrate() = %d, %d; want 0, %d", from, to, LatestSchemaVersion())
+	}
+
+	from, to, err = Migrate(path)
+	if err != nil || from != to {
+		t.Errorf("second Migrate() = %d, %d, %v; want no change", from, to, err)
+	}
+}
+
+func TestBackupAndRollback(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.db")
+	older := LatestSchemaVersion() - 1
+
+	// Create a database at the previous schema version with a record in it
+	all := migrations
+	migrations = migrations[:len(migrations)-1]
+	db, err := Open(path)
+	migrations = all
+	if err != nil {
+		t.Fatalf("Open() failed: %v", err)
+	}
+	// Inserted by hand, since the latest schema may have columns this one lacks
+	env := &Environment{ID: "abc123def456abc123def456abc12345"}
+	if _, err := db.Exec(`INSERT INTO environments (id, backend, repo_path, branch_name, base_branch, created_at, status)
+		VALUES (?, 'local', '', '', '', ?, 'ready')`, env.ID, time.Now().UTC().Format(time.RFC3339)); err != nil {
+		t.Fatalf("inserting environment failed: %v", err)
+	}
+	db.Close()
+
+	// Migrating it takes a backup first
+	db, err = Open(path)
+	if err != nil {
+		t.Fatalf("Open() failed: %v", err)
+	}
+	if err := db.DeleteEnvironment(env.ID); err != nil {
+		t.Fatalf("DeleteEnvironment() failed: %v", err)
+	}
+	db.Close()
+
+	backups, err := Backups(path)
+	if err != nil || len(backups) != 1 || backups[0].Version != older {
+		t.Fatalf("Backups() = %+v, %v; want one at version %d", backups, err, older)
+	}
+
+	if _, err := Rollback(path, 99); !errors.Is(err, ErrNoBackup) {
+		t.Errorf("Rollback(99) error = %v, want ErrNoBackup", err)
+	}
+	b, err := Rollback(path, 0)
+	if err != nil {
+		t.Fatalf("Rollback() failed: %v", err)
+	}
+	if b.Version != older {
+		t.Errorf("Rollback() restored version %d, want %d", b.Version, older)
+	}
+	if _, err := os.Stat(path + ".pre-rollback"); err != nil {
+		t.Errorf("replaced database not kept: %v", err)
+	}
+
+	restored, err := openDB(path)
+	if err != nil {
+		t.Fatalf("openDB() failed: %v", err)
+	}
+	defer restored.Close()
+	if v, _ := restored.SchemaVersion(); v != older {
+		t.Errorf("restored SchemaVersion() = %d, want %d", v, older)
+	}
+	var n int
+	if err := restored.QueryRow(`SELECT COUNT(*) FROM environments WHERE id = ?`, env.ID).Scan(&n); err != nil || n != 1 {
+		t.Errorf("environment deleted after the backup is missing from the restored database: %d, %v", n, err)
+	}
+}
+
+func TestMigrationStatuses(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.db")
+
+	statuses, err := MigrationStatuses(path)
+	if err != nil {
+		t.Fatalf("MigrationStatuses() failed: %v", err)
+	}
+	if len(statuses) != len(migrations) {
+		t.Fatalf("MigrationStatuses() returned %d migrations, want %d", len(statuses), len(migrations))
+	}
+	for _, s := range statuses {
+		if s.Applied {
+			t.Errorf("migration %d applied before the database exists", s.Version)
+		}
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("MigrationStatuses() created the database: %v", err)
+	}
+
+	if _, _, err := Migrate(path); err != nil {
+		t.Fatalf("Migrate() failed: %v", err)
+	}
+	statuses, err = MigrationStatuses(path)
+	if err != nil {
+		t.Fatalf("MigrationStatuses() failed: %v", err)
+	}
+	for i, s := range statuses {
+		if !s.Applied || s.AppliedAt.IsZero() || s.Version != i+1 || s.Name != migrations[i].name {
+			t.Errorf("statuses[%d] = %+v, want migration %d applied", i, s, i+1)
+		}
+	}
+}
+
+func TestEnvironmentIndexes(t *testing.T) {
+	db := openTestDB(t)
+	for _, index := range []string{"idx_environments_status", "idx_environments_repo", "idx_environments_created_at"} {
+		var n int
+		if err := db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'index' AND name = ?`, index).Scan(&n); err != nil || n != 1 {
+			t.Errorf("index %s: count = %d, err = %v", index, n, err)
+		}
+	}
+}
+
 func TestGenerateID(t *testing.T) {
 	id, err := GenerateID()
 	if err != nil {
@@ -119,6 +321,65 @@ func TestShortID(t *testing.T) {
 	}
 }
 
+func TestSetShortIDLength(t *testing.T) {
+	t.Cleanup(func() { SetShortIDLength(ShortIDLength) })
+
+	SetShortIDLength(6)
+	if got := ShortID("abc123def456abc1"); got != "abc123" {
+		t.Errorf("ShortID() = %q, want %q", got, "abc123")
+	}
+	if got := ShortID("brave-otter-3f9c"); got != "brave-otter-3f9c" {
+		t.Errorf("ShortID(word ID) = %q, want the whole ID", got)
+	}
+}
+
+func TestValidID(t *testing.T) {
+	tests := []struct {
+		id   string
+		want bool
+	}{
+		{"abc123def456abc123def456abc12345", true},
+		{"abc123de", true},
+		{"brave-otter-3f9c", true},
+		{"abc123d", false},
+		{"ABC123DEF456", false},
+		{"brave--otter", false},
+		{"-brave-otter", false},
+		{"brave_otter_3f9c", false},
+		{strings.Repeat("a", MaxIDLength+1), false},
+	}
+	for _, tt := range tests {
+		if got := ValidID(tt.id); got != tt.want {
+			t.Errorf("ValidID(%q) = %v, want %v", tt.id, got, tt.want)
+		}
+	}
+}
+
+func TestWordIDPrefix(t *testing.T) {
+	db := openTestDB(t)
+
+	env := &Environment{ID: "brave-otter-3f9c", Backend: "local", Status: StatusReady, CreatedAt: time.Now()}
+	if err := db.CreateEnvironment(env); err != nil {
+		t.Fatalf("CreateEnvironment() failed: %v", err)
+	}
+
+	for _, prefix := range []string{"brave", "brave-ot", "BRAVE-OTTER"} {
+		got, err := db.GetEnvironmentByPrefix(prefix)
+		if err != nil {
+			t.Errorf("GetEnvironmentByPrefix(%q) failed: %v", prefix, err)
+			continue
+		}
+		if got.ID != env.ID {
+			t.Errorf("GetEnvironmentByPrefix(%q) = %q, want %q", prefix, got.ID, env.ID)
+		}
+	}
+
+	err := db.CreateEnvironment(&Environment{ID: "Brave-Otter", Backend: "local", Status: StatusReady, CreatedAt: time.Now()})
+	if !errors.Is(err, ErrInvalidID) {
+		t.Errorf("CreateEnvironment(non-canonical ID) error = %v, want ErrInvalidID", err)
+	}
+}
+
 func TestCRUD(t *testing.T) {
 	db := openTestDB(t)
 
@@ -128,7 +389,12 @@ func TestCRUD(t *testing.T) {
 		Backend:    "local",
 		BackendID:  "/path/to/worktree",
 		RepoPath:   "/home/user/project",
+		Remote:     "upstream",
 		RemoteURL:  "git@github.com:user/project.git",
+		Task:       "Fix the flaky login test",
+		Profile:    "gpu",
+		CPUs:       4,
+		Memory:     8 << 30,
 		BranchName: "env/abc123def456",
 		BaseBranch: "main",
 		CreatedAt:  now,
@@ -160,6 +426,18 @@ func TestCRUD(t *testing.T) {
 		if got.RepoPath != env.RepoPath {
 			t.Errorf("RepoPath = %q, want %q", got.RepoPath, env.RepoPath)
 		}
+		if got.Task != env.Task {
+			t.Errorf("Task = %q, want %q", got.Task, env.Task)
+		}
+		if got.Profile != env.Profile {
+			t.Errorf("Profile = %q, want %q", got.Profile, env.Profile)
+		}
+		if got.CPUs != env.CPUs || got.Memory != env.Memory {
+			t.Errorf("CPUs, Memory = %d, %d; want %d, %d", got.CPUs, got.Memory, env.CPUs, env.Memory)
+		}
+		if got.Remote != env.Remote {
+			t.Errorf("Remote = %q, want %q", got.Remote, env.Remote)
+		}
 		if got.RemoteURL != env.RemoteURL {
 			t.Errorf("RemoteURL = %q, want %q", got.RemoteURL, env.RemoteURL)
 		}
@@ -418,11 +696,127 @@ func TestOptionalFields(t *testing.T) {
 	if got.BackendID != "" {
 		t.Errorf("BackendID = %q, want empty", got.BackendID)
 	}
+	if got.Remote != "" {
+		t.Errorf("Remote = %q, want empty", got.Remote)
+	}
 	if got.RemoteURL != "" {
 		t.Errorf("RemoteURL = %q, want empty", got.RemoteURL)
 	}
 }
 
+func TestExpiry(t *testing.T) {
+	db := openTestDB(t)
+	now := time.Now().Truncate(time.Second)
+
+	for id, expires := range map[string]time.Time{
+		"aaaa0000000000000000000000000000": {},
+		"bbbb0000000000000000000000000000": now.Add(-time.Hour),
+		"cccc0000000000000000000000000000": now.Add(time.Hour),
+	} {
+		env := &Environment{
+			ID:         id,
+			Backend:    "local",
+			RepoPath:   "/test",
+			BranchName: "env/" + id[:4],
+			BaseBranch: "main",
+			CreatedAt:  now,
+			Status:     StatusReady,
+			ExpiresAt:  expires,
+		}
+		if err := db.CreateEnvironment(env); err != nil {
+			t.Fatalf("CreateEnvironment() failed: %v", err)
+		}
+	}
+
+	got, err := db.GetEnvironment("cccc0000000000000000000000000000")
+	if err != nil {
+		t.Fatalf("GetEnvironment() failed: %v", err)
+	}
+	if !got.ExpiresAt.Equal(now.Add(time.Hour)) {
+		t.Errorf("ExpiresAt = %v, want %v", got.ExpiresAt, now.Add(time.Hour))
+	}
+	if got.Expired(now) || !got.Expired(now.Add(2*time.Hour)) {
+		t.Error("Expired() did not compare against ExpiresAt")
+	}
+
+	never, err := db.GetEnvironment("aaaa0000000000000000000000000000")
+	if err != nil {
+		t.Fatalf("GetEnvironment() failed: %v", err)
+	}
+	if !never.ExpiresAt.IsZero() || never.Expired(now.Add(1000*time.Hour)) {
+		t.Errorf("environment without TTL has ExpiresAt = %v", never.ExpiresAt)
+	}
+
+	expired, err := db.ListEnvironments(ListOptions{ExpiredBefore: now})
+	if err != nil {
+		t.Fatalf("ListEnvironments() failed: %v", err)
+	}
+	if len(expired) != 1 || expired[0].ID != "bbbb0000000000000000000000000000" {
+		t.Errorf("ListEnvironments(ExpiredBefore) = %v, want only bbbb...", expired)
+	}
+
+	// Clearing the expiry persists
+	got.ExpiresAt = time.Time{}
+	if err := db.UpdateEnvironment(got); err != nil {
+		t.Fatalf("UpdateEnvironment() failed: %v", err)
+	}
+	got, _ = db.GetEnvironment(got.ID)
+	if !got.ExpiresAt.IsZero() {
+		t.Errorf("ExpiresAt after clear = %v, want zero", got.ExpiresAt)
+	}
+}
+
+func TestRemovedAt(t *testing.T) {
+	db := openTestDB(t)
+	now := time.Now().Truncate(time.Second)
+
+	for id, removed := range map[string]time.Time{
+		"aaaa0000000000000000000000000000": {},
+		"bbbb0000000000000000000000000000": now.Add(-48 * time.Hour),
+		"cccc0000000000000000000000000000": now.Add(-time.Hour),
+	} {
+		env := &Environment{
+			ID:         id,
+			Backend:    "local",
+			RepoPath:   "/test",
+			BranchName: "env/" + id[:4],
+			BaseBranch: "main",
+			CreatedAt:  now.Add(-72 * time.Hour),
+			Status:     StatusRemoved,
+			RemovedAt:  removed,
+		}
+		if removed.IsZero() {
+			env.Status = StatusReady
+		}
+		if err := db.CreateEnvironment(env); err != nil {
+			t.Fatalf("CreateEnvironment() failed: %v", err)
+		}
+	}
+
+	got, err := db.GetEnvironment("cccc0000000000000000000000000000")
+	if err != nil || !got.RemovedAt.Equal(now.Add(-time.Hour)) {
+		t.Errorf("RemovedAt = %v, %v; want %v", got.RemovedAt, err, now.Add(-time.Hour))
+	}
+
+	due, err := db.ListEnvironments(ListOptions{RemovedBefore: now.Add(-24 * time.Hour)})
+	if err != nil {
+		t.Fatalf("ListEnvironments() failed: %v", err)
+	}
+	if len(due) != 1 || due[0].ID != "bbbb0000000000000000000000000000" {
+		t.Errorf("ListEnvironments(RemovedBefore) = %v, want only bbbb...", due)
+	}
+
+	// Restoring clears it
+	got.Status = StatusReady
+	got.RemovedAt = time.Time{}
+	if err := db.UpdateEnvironment(got); err != nil {
+		t.Fatalf("UpdateEnvironment() failed: %v", err)
+	}
+	if got, _ = db.GetEnvironment(got.ID); !got.RemovedAt.IsZero() {
+		t.Errorf("RemovedAt after clear = %v, want zero", got.RemovedAt)
+	}
+}
+
 func TestListEnvironments(t *testing.T) {
 	db := openTestDB(t)
 
@@ -522,6 +916,26 @@ func TestListEnvironments(t *testing.T) {
 		}
 	})
 
+	t.Run("filter by branch", func(t *testing.T) {
+		got, err := db.ListEnvironments(ListOptions{Branch: "env/3"})
+		if err != nil {
+			t.Fatalf("ListEnvironments() failed: %v", err)
+		}
+		if len(got) != 1 || got[0].ID != "env3abc123456789012345678901234" {
+			t.Errorf("ListEnvironments(branch=env/3) = %v, want env3...", got)
+		}
+	})
+
+	t.Run("filter by creation time", func(t *testing.T) {
+		got, err := db.ListEnvironments(ListOptions{CreatedBefore: time.Now().Add(-90 * time.Minute)})
+		if err != nil {
+			t.Fatalf("ListEnvironments() failed: %v", err)
+		}
+		if len(got) != 2 || got[0].ID != "env2abc123456789012345678901234" || got[1].ID != "env1abc123456789012345678901234" {
+			t.Errorf("ListEnvironments(created before 90m ago) = %v, want env2..., env1...", got)
+		}
+	})
+
 	t.Run("filter by single status", func(t *testing.T) {
 		got, err := db.ListEnvironments(ListOptions{Statuses: []EnvironmentStatus{StatusReady}})
 		if err != nil {
@@ -568,6 +982,70 @@ func TestListEnvironments(t *testing.T) {
 		}
 	})
 
+	ids := func(envs []*Environment) string {
+		var short []string
+		for _, e := range envs {
+			short = append(short, e.ID[:4])
+		}
+		return strings.Join(short, ",")
+	}
+
+	t.Run("sort", func(t *testing.T) {
+		// env1 is the oldest but ran a command most recently
+		if err := db.RecordCommand(&CommandRecord{
+			EnvironmentID: "env1abc123456789012345678901234",
+			Source:        SourceExec,
+			Command:       "true",
+			StartedAt:     time.Now().Add(time.Minute),
+		}); err != nil {
+			t.Fatalf("RecordCommand() failed: %v", err)
+		}
+
+		tests := []struct {
+			sort SortOrder
+			want string
+		}{
+			{SortCreated, "env4,env3,env2,env1"},
+			{SortStatus, "env2,env3,env1,env4"},
+			{SortLastUsed, "env1,env4,env3,env2"},
+			{SortName, "env1,env2,env3,env4"},
+		}
+		for _, tt := range tests {
+			got, err := db.ListEnvironments(ListOptions{Sort: tt.sort})
+			if err != nil {
+				t.Fatalf("ListEnvironments(sort=%s) failed: %v", tt.sort, err)
+			}
+			if ids(got) != tt.want {
+				t.Errorf("ListEnvironments(sort=%s) = %s, want %s", tt.sort, ids(got), tt.want)
+			}
+		}
+
+		if _, err := db.ListEnvironments(ListOptions{Sort: "size"}); err == nil {
+			t.Error("ListEnvironments(sort=size) succeeded, want error")
+		}
+	})
+
+	t.Run("limit and offset", func(t *testing.T) {
+		tests := []struct {
+			limit, offset int
+			want          string
+		}{
+			{2, 0, "env4,env3"},
+			{2, 2, "env2,env1"},
+			{0, 3, "env1"},
+			{10, 4, ""},
+		}
+		for _, tt := range tests {
+			got, err := db.ListEnvironments(ListOptions{Limit: tt.limit, Offset: tt.offset})
+			if err != nil {
+				t.Fatalf("ListEnvironments(limit=%d, offset=%d) failed: %v", tt.limit, tt.offset, err)
+			}
+			if ids(got) != tt.want {
+				t.Errorf("ListEnvironments(limit=%d, offset=%d) = %s, want %s", tt.limit, tt.offset, ids(got), tt.want)
+			}
+		}
+	})
+
 	t.Run("no matches", func(t *testing.T) {
 		got, err := db.ListEnvironments(ListOptions{RepoPath: "/nonexistent"})
 		if err != nil {
@@ -655,3 +1133,808 @@ func TestConcurrentReads(t *testing.T) {
 		}
 	}
 }
+
+func TestCommandHistory(t *testing.T) {
+	db := openTestDB(t)
+
+	envID := "cmdhist123456789012345678901234"
+	started := time.Now().Truncate(time.Millisecond)
+
+	recs := []*CommandRecord{
+		{EnvironmentID: envID, Source: SourceExec, Command: "make build", ExitCode: 0, StartedAt: started, Duration: 1500 * time.Millisecond, Output: "ok\n"},
+		{EnvironmentID: envID, Source: SourceExec, Command: "make test", ExitCode: 2, StartedAt: started.Add(time.Second), Duration: 3 * time.Second},
+		{EnvironmentID: "other12345678901234567890123456", Source: SourceExec, Command: "ls", StartedAt: started},
+	}
+	for _, rec := range recs {
+		if err := db.RecordCommand(rec); err != nil {
+			t.Fatalf("RecordCommand() failed: %v", err)
+		}
+		if rec.ID == 0 {
+			t.Error("RecordCommand() did not set ID")
+		}
+	}
+
+	t.Run("filters by environment in order", func(t *testing.T) {
+		cmds, err := db.ListCommands(CommandListOptions{EnvironmentID: envID})
+		if err != nil {
+			t.Fatalf("ListCommands() failed: %v", err)
+		}
+		if len(cmds) != 2 {
+			t.Fatalf("ListCommands() returned %d commands, want 2", len(cmds))
+		}
+		if cmds[0].Command != "make build" || cmds[1].Command != "make test" {
+			t.Errorf("unexpected order: %q, %q", cmds[0].Command, cmds[1].Command)
+		}
+		if cmds[1].ExitCode != 2 {
+			t.Errorf("ExitCode = %d, want 2", cmds[1].ExitCode)
+		}
+		if cmds[0].Duration != 1500*time.Millisecond {
+			t.Errorf("Duration = %v, want 1.5s", cmds[0].Duration)
+		}
+		if !cmds[0].StartedAt.Equal(started) {
+			t.Errorf("StartedAt = %v, want %v", cmds[0].StartedAt, started)
+		}
+		if cmds[0].Output != "ok\n" {
+			t.Errorf("Output = %q, want %q", cmds[0].Output, "ok\n")
+		}
+	})
+
+	t.Run("delete removes only that environment", func(t *testing.T) {
+		if err := db.DeleteCommands(envID); err != nil {
+			t.Fatalf("DeleteCommands() failed: %v", err)
+		}
+		cmds, err := db.ListCommands(CommandListOptions{})
+		if err != nil {
+			t.Fatalf("ListCommands() failed: %v", err)
+		}
+		if len(cmds) != 1 {
+			t.Errorf("ListCommands() returned %d commands, want 1", len(cmds))
+		}
+	})
+}
+
+func TestSetupJournal(t *testing.T) {
+	db := openTestDB(t)
+
+	envID := "setupjournal12345678901234567890"
+	started := time.Now().Truncate(time.Millisecond)
+
+	if _, err := db.InterruptedSetupStep(envID); !errors.Is(err, ErrNoInterruptedStep) {
+		t.Errorf("InterruptedSetupStep() on empty journal = %v, want ErrNoInterruptedStep", err)
+	}
+
+	// Step 1 succeeds, step 2 fails, step 3 is interrupted
+	steps := []string{"write environment", "npm ci", "npm install"}
+	for i, name := range steps {
+		if err := db.StartSetupStep(envID, i+1, name, started); err != nil {
+			t.Fatalf("StartSetupStep() failed: %v", err)
+		}
+	}
+	if err := db.FinishSetupStep(envID, 1, started.Add(time.Second), ""); err != nil {
+		t.Fatalf("FinishSetupStep() failed: %v", err)
+	}
+	if err := db.FinishSetupStep(envID, 2, started.Add(time.Second), "exit status 1"); err != nil {
+		t.Fatalf("FinishSetupStep() failed: %v", err)
+	}
+
+	got, err := db.ListSetupSteps(envID)
+	if err != nil {
+		t.Fatalf("ListSetupSteps() failed: %v", err)
+	}
+	if len(got) != 3 {
+		t.Fatalf("ListSetupSteps() returned %d steps, want 3", len(got))
+	}
+	if !got[0].Finished() || got[0].Error != "" || !got[0].StartedAt.Equal(started) {
+		t.Errorf("step 1 = %+v, want finished without error", got[0])
+	}
+	if got[1].Error != "exit status 1" {
+		t.Errorf("step 2 Error = %q, want %q", got[1].Error, "exit status 1")
+	}
+
+	step, err := db.InterruptedSetupStep(envID)
+	if err != nil {
+		t.Fatalf("InterruptedSetupStep() failed: %v", err)
+	}
+	if step.Step != 3 || step.Name != "npm install" {
+		t.Errorf("InterruptedSetupStep() = step %d %q, want step 3 %q", step.Step, step.Name, "npm install")
+	}
+
+	if err := db.DeleteSetupSteps(envID); err != nil {
+		t.Fatalf("DeleteSetupSteps() failed: %v", err)
+	}
+	if got, _ := db.ListSetupSteps(envID); len(got) != 0 {
+		t.Errorf("ListSetupSteps() after delete returned %d steps, want 0", len(got))
+	}
+}
+
+func TestTruncateOutput(t *testing.T) {
+	short := "hello"
+	if got := TruncateOutput(short); got != short {
+		t.Errorf("TruncateOutput(%q) = %q", short, got)
+	}
+
+	long := strings.Repeat("a", MaxCommandOutput) + "tail"
+	got := TruncateOutput(long)
+	if len(got) != MaxCommandOutput {
+		t.Errorf("len(TruncateOutput()) = %d, want %d", len(got), MaxCommandOutput)
+	}
+	if !strings.HasSuffix(got, "tail") {
+		t.Error("TruncateOutput() should keep the end of the output")
+	}
+
+	// A cut inside a multi-byte rune skips to the next rune
+	multi := "é" + strings.Repeat("a", MaxCommandOutput-1)
+	got = TruncateOutput(multi)
+	if !utf8.ValidString(got) {
+		t.Errorf("TruncateOutput() returned invalid UTF-8: %q", got[:4])
+	}
+	if len(got) != MaxCommandOutput-1 {
+		t.Errorf("len(TruncateOutput()) = %d, want %d", len(got), MaxCommandOutput-1)
+	}
+}
+
+func TestBulkUpdateStatus(t *testing.T) {
+	db := openTestDB(t)
+
+	ids := []string{
+		"bulk0123456789012345678901234567",
+		"bulk1123456789012345678901234567",
+		"bulk2123456789012345678901234567",
+	}
+	for _, id := range ids {
+		env := &Environment{
+			ID:         id,
+			Backend:    "local",
+			RepoPath:   "/test",
+			BranchName: "test",
+			BaseBranch: "main",
+			CreatedAt:  time.Now(),
+			Status:     StatusReady,
+		}
+		if err := db.CreateEnvironment(env); err != nil {
+			t.Fatalf("CreateEnvironment() failed: %v", err)
+		}
+	}
+
+	t.Run("invalid status", func(t *testing.T) {
+		err := db.BulkUpdateStatus(ids, StatusReady, "bogus")
+		if !errors.Is(err, ErrInvalidStatus) {
+			t.Errorf("BulkUpdateStatus() error = %v, want ErrInvalidStatus", err)
+		}
+	})
+
+	t.Run("missing environment rolls back", func(t *testing.T) {
+		err := db.BulkUpdateStatus([]string{ids[0], "missing"}, StatusReady, StatusFailed)
+		if !errors.Is(err, ErrEnvironmentNotFound) {
+			t.Errorf("BulkUpdateStatus() error = %v, want ErrEnvironmentNotFound", err)
+		}
+		env, _ := db.GetEnvironment(ids[0])
+		if env.Status != StatusReady {
+			t.Errorf("status = %s, want ready after rollback", env.Status)
+		}
+	})
+
+	t.Run("transitions all", func(t *testing.T) {
+		if err := db.BulkUpdateStatus(ids[:2], StatusReady, StatusFailed); err != nil {
+			t.Fatalf("BulkUpdateStatus() failed: %v", err)
+		}
+		count, _ := db.CountEnvironments(ListOptions{Statuses: []EnvironmentStatus{StatusFailed}})
+		if count != 2 {
+			t.Errorf("failed count = %d, want 2", count)
+		}
+	})
+
+	t.Run("unexpected status", func(t *testing.T) {
+		err := db.BulkUpdateStatus(ids, StatusReady, StatusRemoved)
+		if !errors.Is(err, ErrUnexpectedStatus) {
+			t.Errorf("BulkUpdateStatus() error = %v, want ErrUnexpectedStatus", err)
+		}
+	})
+}
+
+// seedBenchEnvironments creates n ready environments in a file-backed database.
+func seedBenchEnvironments(b *testing.B, n int) (*DB, []*Environment) {
+	b.Helper()
+	db, err := Open(b.TempDir() + "/bench.db")
+	if err != nil {
+		b.Fatalf("Open() failed: %v", err)
+	}
+	b.Cleanup(func() { db.Close() })
+
+	envs := make([]*Environment, n)
+	for i := range envs {
+		id, err := GenerateID()
+		if err != nil {
+			b.Fatalf("GenerateID() failed: %v", err)
+		}
+		envs[i] = &Environment{
+			ID:         id,
+			Backend:    "local",
+			RepoPath:   "/bench",
+			BranchName: "env/" + ShortID(id),
+			BaseBranch: "main",
+			CreatedAt:  time.Now(),
+			Status:     StatusReady,
+		}
+		if err := db.CreateEnvironment(envs[i]); err != nil {
+			b.Fatalf("CreateEnvironment() failed: %v", err)
+		}
+	}
+	return db, envs
+}
+
+func BenchmarkUpdateEnvironmentLoop1k(b *testing.B) {
+	db, envs := seedBenchEnvironments(b, 1000)
+
+	from, to := StatusReady, StatusFailed
+	for b.Loop() {
+		for _, env := range envs {
+			env.Status = to
+			if err := db.UpdateEnvironment(env); err != nil {
+				b.Fatalf("UpdateEnvironment() failed: %v", err)
+			}
+		}
+		from, to = to, from
+	}
+}
+
+func BenchmarkBulkUpdateStatus1k(b *testing.B) {
+	db, envs := seedBenchEnvironments(b, 1000)
+	ids := make([]string, len(envs))
+	for i, env := range envs {
+		ids[i] = env.ID
+	}
+
+	from, to := StatusReady, StatusFailed
+	for b.Loop() {
+		if err := db.BulkUpdateStatus(ids, from, to); err != nil {
+			b.Fatalf("BulkUpdateStatus() failed: %v", err)
+		}
+		from, to = to, from
+	}
+}
+
+func TestExportImport(t *testing.T) {
+	src, err := Open(t.TempDir() + "/src.db")
+	if err != nil {
+		t.Fatalf("Open() failed: %v", err)
+	}
+	defer src.Close()
+
+	created := time.Now().UTC().Truncate(time.Second)
+	env := &Environment{
+		ID:         "export12345678901234567890123456",
+		Backend:    "local",
+		BackendID:  "/path/to/worktree",
+		RepoPath:   "/test",
+		BranchName: "env/export123456",
+		BaseBranch: "main",
+		CreatedAt:  created,
+		Status:     StatusReady,
+	}
+	if err := src.CreateEnvironment(env); err != nil {
+		t.Fatalf("CreateEnvironment() failed: %v", err)
+	}
+	if err := src.RecordCommand(&CommandRecord{
+		EnvironmentID: env.ID, Source: SourceExec, Command: "make", StartedAt: created, Duration: time.Second,
+	}); err != nil {
+		t.Fatalf("RecordCommand() failed: %v", err)
+	}
+	run := &AgentRun{EnvironmentID: env.ID, Command: "claude", ProcessID: "42", StartedAt: created}
+	if err := src.StartAgentRun(run); err != nil {
+		t.Fatalf("StartAgentRun() failed: %v", err)
+	}
+	if err := src.FinishAgentRun(run.ID, created.Add(time.Minute), 3); err != nil {
+		t.Fatalf("FinishAgentRun() failed: %v", err)
+	}
+
+	snap, err := src.Export()
+	if err != nil {
+		t.Fatalf("Export() failed: %v", err)
+	}
+	if len(snap.Environments) != 1 || len(snap.Commands) != 1 || len(snap.AgentRuns) != 1 {
+		t.Fatalf("Export() = %d envs, %d commands, %d agent runs; want 1, 1, 1",
+			len(snap.Environments), len(snap.Commands), len(snap.AgentRuns))
+	}
+
+	dst, err := Open(t.TempDir() + "/dst.db")
+	if err != nil {
+		t.Fatalf("Open() failed: %v", err)
+	}
+	defer dst.Close()
+
+	t.Run("imports into empty database", func(t *testing.T) {
+		result, err := dst.Import(snap, ConflictFail)
+		if err != nil {
+			t.Fatalf("Import() failed: %v", err)
+		}
+		if result.Imported != 1 || result.Commands != 1 || result.AgentRuns != 1 {
+			t.Errorf("Import() = %+v, want 1 environment, 1 command, and 1 agent run", result)
+		}
+		got, err := dst.GetEnvironment(env.ID)
+		if err != nil {
+			t.Fatalf("GetEnvironment() failed: %v", err)
+		}
+		if !got.CreatedAt.Equal(created) || got.BackendID != env.BackendID {
+			t.Errorf("imported environment = %+v, want %+v", got, env)
+		}
+		gotRun, err := dst.LatestAgentRun(env.ID)
+		if err != nil {
+			t.Fatalf("LatestAgentRun() failed: %v", err)
+		}
+		if gotRun.Command != "claude" || gotRun.ExitCode != 3 || gotRun.Status != AgentExited ||
+			!gotRun.FinishedAt.Equal(created.Add(time.Minute)) {
+			t.Errorf("imported agent run = %+v", gotRun)
+		}
+	})
+
+	t.Run("fail mode rejects duplicates", func(t *testing.T) {
+		_, err := dst.Import(snap, ConflictFail)
+		if !errors.Is(err, ErrDuplicateID) {
+			t.Errorf("Import() error = %v, want ErrDuplicateID", err)
+		}
+	})
+
+	t.Run("skip mode keeps existing", func(t *testing.T) {
+		result, err := dst.Import(snap, ConflictSkip)
+		if err != nil {
+			t.Fatalf("Import() failed: %v", err)
+		}
+		if result.Skipped != 1 || result.Commands != 0 {
+			t.Errorf("Import() = %+v, want 1 skipped and no commands", result)
+		}
+	})
+
+	t.Run("overwrite mode replaces existing", func(t *testing.T) {
+		addEnvironmentRecords(t, dst, env.ID)
+		snap.Environments[0].Status = StatusFailed
+		result, err := dst.Import(snap, ConflictOverwrite)
+		if err != nil {
+			t.Fatalf("Import() failed: %v", err)
+		}
+		if result.Overwritten != 1 {
+			t.Errorf("Import() = %+v, want 1 overwritten", result)
+		}
+		got, _ := dst.GetEnvironment(env.ID)
+		if got.Status != StatusFailed {
+			t.Errorf("status = %s, want failed", got.Status)
+		}
+		cmds, _ := dst.ListCommands(CommandListOptions{EnvironmentID: env.ID})
+		if len(cmds) != 1 {
+			t.Errorf("got %d commands after overwrite, want 1", len(cmds))
+		}
+		if runs, _ := dst.ListAgentRuns(env.ID); len(runs) != 1 {
+			t.Errorf("got %d agent runs after overwrite, want 1", len(runs))
+		}
+		checkNoEnvironmentRecords(t, dst, env.ID)
+	})
+
+	t.Run("invalid mode", func(t *testing.T) {
+		if _, err := dst.Import(snap, "merge"); err == nil {
+			t.Error("Import() with invalid mode should fail")
+		}
+	})
+}
+
+func TestPurgeEnvironment(t *testing.T) {
+	db := openTestDB(t)
+	env := &Environment{
+		ID: "purge1234567890123456789012345678", Backend: "local", RepoPath: "/test",
+		BranchName: "env/purge123", BaseBranch: "main", CreatedAt: time.Now(), Status: StatusReady,
+	}
+	if err := db.CreateEnvironment(env); err != nil {
+		t.Fatalf("CreateEnvironment() failed: %v", err)
+	}
+	addEnvironmentRecords(t, db, env.ID)
+
+	if err := db.PurgeEnvironment(env.ID); err != nil {
+		t.Fatalf("PurgeEnvironment() failed: %v", err)
+	}
+	if _, err := db.GetEnvironment(env.ID); !errors.Is(err, ErrEnvironmentNotFound) {
+		t.Errorf("GetEnvironment() after purge = %v, want ErrEnvironmentNotFound", err)
+	}
+	checkNoEnvironmentRecords(t, db, env.ID)
+
+	// Records left without an environment are still removed
+	addEnvironmentRecords(t, db, env.ID)
+	if err := db.PurgeEnvironment(env.ID); !errors.Is(err, ErrEnvironmentNotFound) {
+		t.Errorf("PurgeEnvironment() of a missing environment = %v, want ErrEnvironmentNotFound", err)
+	}
+	checkNoEnvironmentRecords(t, db, env.ID)
+}
+
+// addEnvironmentRecords records a command, setup step, diagnostics, agent
+// run, and port forward for environment id.
+func addEnvironmentRecords(t *testing.T, db *DB, id string) {
+	t.Helper()
+	now := time.Now()
+	if err := db.RecordCommand(&CommandRecord{EnvironmentID: id, Source: SourceExec, Command: "old", StartedAt: now}); err != nil {
+		t.Fatalf("RecordCommand() failed: %v", err)
+	}
+	if err := db.StartSetupStep(id, 0, "old step", now); err != nil {
+		t.Fatalf("StartSetupStep() failed: %v", err)
+	}
+	if err := db.SaveDiagnostics(&Diagnostics{EnvironmentID: id, CapturedAt: now, Bundle: "{}"}); err != nil {
+		t.Fatalf("SaveDiagnostics() failed: %v", err)
+	}
+	if err := db.StartAgentRun(&AgentRun{EnvironmentID: id, Command: "old", StartedAt: now}); err != nil {
+		t.Fatalf("StartAgentRun() failed: %v", err)
+	}
+	if err := db.AddPortForward(&PortForward{EnvironmentID: id, GuestPort: 3000, HostPort: 3000, CreatedAt: now}); err != nil {
+		t.Fatalf("AddPortForward() failed: %v", err)
+	}
+}
+
+// checkNoEnvironmentRecords fails t if any setup step, diagnostics, port
+// forward, or command or agent run named "old" is recorded for environment
+// id.
+func checkNoEnvironmentRecords(t *testing.T, db *DB, id string) {
+	t.Helper()
+	cmds, _ := db.ListCommands(CommandListOptions{EnvironmentID: id})
+	for _, c := range cmds {
+		if c.Command == "old" {
+			t.Error("command history survived")
+		}
+	}
+	runs, _ := db.ListAgentRuns(id)
+	for _, r := range runs {
+		if r.Command == "old" {
+			t.Error("agent run survived")
+		}
+	}
+	if steps, _ := db.ListSetupSteps(id); len(steps) != 0 {
+		t.Errorf("%d setup steps survived", len(steps))
+	}
+	if _, err := db.GetDiagnostics(id); !errors.Is(err, ErrNoDiagnostics) {
+		t.Errorf("GetDiagnostics() = %v, want ErrNoDiagnostics", err)
+	}
+	if forwards, _ := db.ListPortForwards(id); len(forwards) != 0 {
+		t.Errorf("%d port forwards survived", len(forwards))
+	}
+}
+
+func TestGetByPrefixFiltered(t *testing.T) {
+	db := openTestDB(t)
+
+	for _, e := range []struct {
+		id     string
+		status EnvironmentStatus
+	}{
+		{"abc100000000000000000000000000aa", StatusReady},
+		{"abc200000000000000000000000000bb", StatusFailed},
+	} {
+		env := &Environment{
+			ID:         e.id,
+			Backend:    "local",
+			RepoPath:   "/test",
+			BranchName: "test",
+			BaseBranch: "main",
+			CreatedAt:  time.Now(),
+			Status:     e.status,
+		}
+		if err := db.CreateEnvironment(env); err != nil {
+			t.Fatalf("CreateEnvironment() failed: %v", err)
+		}
+	}
+
+	env, err := db.GetEnvironmentByPrefixFiltered("abc", []EnvironmentStatus{StatusReady})
+	if err != nil {
+		t.Fatalf("GetEnvironmentByPrefixFiltered() failed: %v", err)
+	}
+	if env.Status != StatusReady {
+		t.Errorf("status = %s, want ready", env.Status)
+	}
+
+	_, err = db.GetEnvironmentByPrefixFiltered("abc2", []EnvironmentStatus{StatusReady})
+	if !errors.Is(err, ErrEnvironmentNotFound) {
+		t.Errorf("error = %v, want ErrEnvironmentNotFound", err)
+	}
+
+	_, err = db.GetEnvironmentByPrefixFiltered("abc", nil)
+	if !errors.Is(err, ErrAmbiguousPrefix) {
+		t.Errorf("error = %v, want ErrAmbiguousPrefix", err)
+	}
+}
+
+func TestGetByBackendID(t *testing.T) {
+	db := openTestDB(t)
+
+	for i, id := range []string{"abc100000000000000000000000000aa", "abc200000000000000000000000000bb"} {
+		env := &Environment{
+			ID:         id,
+			Backend:    "local",
+			BackendID:  "/worktrees/choir-abc",
+			RepoPath:   "/test",
+			BranchName: "test",
+			BaseBranch: "main",
+			CreatedAt:  time.Now().Add(time.Duration(i) * time.Minute),
+			Status:     StatusReady,
+		}
+		if err := db.CreateEnvironment(env); err != nil {
+			t.Fatalf("CreateEnvironment() failed: %v", err)
+		}
+	}
+
+	env, err := db.GetEnvironmentByBackendID("/worktrees/choir-abc")
+	if err != nil {
+		t.Fatalf("GetEnvironmentByBackendID() failed: %v", err)
+	}
+	if env.ID != "abc200000000000000000000000000bb" {
+		t.Errorf("ID = %s, want the newest environment", env.ID)
+	}
+	if _, err := db.GetEnvironmentByBackendID("/worktrees/other"); !errors.Is(err, ErrEnvironmentNotFound) {
+		t.Errorf("error = %v, want ErrEnvironmentNotFound", err)
+	}
+}
+
+func TestAgentRuns(t *testing.T) {
+	db := openTestDB(t)
+
+	envID := "agentruns1234567890123456789012"
+	if _, err := db.LatestAgentRun(envID); !errors.Is(err, ErrNoAgentRun) {
+		t.Errorf("LatestAgentRun() with no runs = %v, want ErrNoAgentRun", err)
+	}
+
+	started := time.Now().Truncate(time.Millisecond)
+	first := &AgentRun{EnvironmentID: envID, Command: "claude", ProcessID: "100", StartedAt: started}
+	if err := db.StartAgentRun(first); err != nil {
+		t.Fatalf("StartAgentRun() failed: %v", err)
+	}
+	if err := db.FinishAgentRun(first.ID, started.Add(time.Minute), 2); err != nil {
+		t.Fatalf("FinishAgentRun() failed: %v", err)
+	}
+	second := &AgentRun{EnvironmentID: envID, Command: "claude", ProcessID: "200", StartedAt: started.Add(2 * time.Minute)}
+	if err := db.StartAgentRun(second); err != nil {
+		t.Fatalf("StartAgentRun() failed: %v", err)
+	}
+
+	got, err := db.LatestAgentRun(envID)
+	if err != nil {
+		t.Fatalf("LatestAgentRun() failed: %v", err)
+	}
+	if got.ID != second.ID || got.ProcessID != "200" || got.Finished() || got.Status != AgentRunning {
+		t.Errorf("LatestAgentRun() = %+v, want running run with process 200", got)
+	}
+
+	if err := db.FinishAgentRun(second.ID, started.Add(3*time.Minute), 0); err != nil {
+		t.Fatalf("FinishAgentRun() failed: %v", err)
+	}
+	got, err = db.LatestAgentRun(envID)
+	if err != nil {
+		t.Fatalf("LatestAgentRun() failed: %v", err)
+	}
+	if !got.Finished() || got.ExitCode != 0 || got.Status != AgentExited || !got.FinishedAt.Equal(started.Add(3*time.Minute)) {
+		t.Errorf("LatestAgentRun() = %+v, want exited with code 0", got)
+	}
+
+	t.Run("killed agents crashed unless stopped", func(t *testing.T) {
+		for i, stop := range []bool{false, true} {
+			run := &AgentRun{EnvironmentID: envID, Command: "claude", ProcessID: "300", StartedAt: started.Add(time.Duration(4+i) * time.Minute)}
+			if err := db.StartAgentRun(run); err != nil {
+				t.Fatalf("StartAgentRun() failed: %v", err)
+			}
+			want := AgentCrashed
+			if stop {
+				if err := db.StopAgentRun(run.ID); err != nil {
+					t.Fatalf("StopAgentRun() failed: %v", err)
+				}
+				want = AgentStopped
+			}
+			if err := db.FinishAgentRun(run.ID, time.Now(), -1); err != nil {
+				t.Fatalf("FinishAgentRun() failed: %v", err)
+			}
+			got, err := db.LatestAgentRun(envID)
+			if err != nil {
+				t.Fatalf("LatestAgentRun() failed: %v", err)
+			}
+			if got.Status != want {
+				t.Errorf("stopped=%v: Status = %q, want %q", stop, got.Status, want)
+			}
+		}
+	})
+
+	if err := db.DeleteAgentRuns(envID); err != nil {
+		t.Fatalf("DeleteAgentRuns() failed: %v", err)
+	}
+	if _, err := db.LatestAgentRun(envID); !errors.Is(err, ErrNoAgentRun) {
+		t.Errorf("LatestAgentRun() after delete = %v, want ErrNoAgentRun", err)
+	}
+}
+
+func TestPortForwards(t *testing.T) {
+	db := openTestDB(t)
+
+	envID := "portfwd12345678901234567890123"
+	for _, f := range []*PortForward{
+		{EnvironmentID: envID, GuestPort: 80, HostPort: 8080, ForwardID: "a", CreatedAt: time.Now()},
+		{EnvironmentID: envID, GuestPort: 3000, HostPort: 3000, ForwardID: "b", CreatedAt: time.Now()},
+		{EnvironmentID: "other1234567890123456789012345", GuestPort: 80, HostPort: 80, ForwardID: "c", CreatedAt: time.Now()},
+	} {
+		if err := db.AddPortForward(f); err != nil {
+			t.Fatalf("AddPortForward() failed: %v", err)
+		}
+		if f.ID == 0 {
+			t.Error("AddPortForward() didn't set ID")
+		}
+	}
+
+	got, err := db.ListPortForwards(envID)
+	if err != nil {
+		t.Fatalf("ListPortForwards() failed: %v", err)
+	}
+	if len(got) != 2 || got[0].HostPort != 3000 || got[1].HostPort != 8080 || got[1].GuestPort != 80 || got[1].ForwardID != "a" {
+		t.Fatalf("ListPortForwards() = %+v, want forwards by host port", got)
+	}
+
+	if err := db.DeletePortForward(got[0].ID); err != nil {
+		t.Fatalf("DeletePortForward() failed: %v", err)
+	}
+	if got, _ := db.ListPortForwards(envID); len(got) != 1 {
+		t.Errorf("ListPortForwards() after delete returned %d forwards, want 1", len(got))
+	}
+	if err := db.DeletePortForwards(envID); err != nil {
+		t.Fatalf("DeletePortForwards() failed: %v", err)
+	}
+	if got, _ := db.ListPortForwards(envID); len(got) != 0 {
+		t.Errorf("ListPortForwards() after DeletePortForwards returned %d forwards, want 0", len(got))
+	}
+	if got, _ := db.ListPortForwards("other1234567890123456789012345"); len(got) != 1 {
+		t.Errorf("DeletePortForwards() removed another environment's forwards")
+	}
+}
+
+func TestProvisionQueue(t *testing.T) {
+	db := openTestDB(t)
+
+	for _, id := range []string{"first", "second", "third"} {
+		if err := db.EnqueueProvision(id, 100); err != nil {
+			t.Fatalf("EnqueueProvision(%s) failed: %v", id, err)
+		}
+	}
+	start := func(id string, limit int) bool {
+		t.Helper()
+		ok, err := db.StartProvision(id, limit)
+		if err != nil {
+			t.Fatalf("StartProvision(%s) failed: %v", id, err)
+		}
+		return ok
+	}
+
+	if start("second", 2) {
+		t.Error("second started ahead of first")
+	}
+	if !start("first", 2) || !start("second", 2) {
+		t.Fatal("first two didn't start with a limit of 2")
+	}
+	if start("third", 2) {
+		t.Error("third started with both slots taken")
+	}
+	if start("first", 2) {
+		t.Error("first started twice")
+	}
+
+	if err := db.FinishProvision("first"); err != nil {
+		t.Fatalf("FinishProvision() failed: %v", err)
+	}
+	if !start("third", 2) {
+		t.Error("third didn't start after first finished")
+	}
+
+	queue, err := db.ListProvisionQueue()
+	if err != nil {
+		t.Fatalf("ListProvisionQueue() failed: %v", err)
+	}
+	if len(queue) != 2 || queue[0].EnvironmentID != "second" || !queue[1].Running() || queue[1].PID != 100 {
+		t.Errorf("ListProvisionQueue() = %+v, want second and third running", queue)
+	}
+
+	// Without a limit, order doesn't matter
+	if err := db.EnqueueProvision("fourth", 100); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.EnqueueProvision("fifth", 100); err != nil {
+		t.Fatal(err)
+	}
+	if !start("fifth", 0) {
+		t.Error("fifth didn't start without a limit")
+	}
+}
+
+func TestImages(t *testing.T) {
+	db := openTestDB(t)
+	created := time.Now().Add(-time.Hour).Truncate(time.Second)
+
+	img := &Image{
+		Backend:    "lima",
+		Key:        "abc123",
+		BaseImage:  "ubuntu:24.04",
+		Packages:   []string{"git", "jq"},
+		ImageID:    "choir-image-abc123",
+		CreatedAt:  created,
+		LastUsedAt: created,
+	}
+	added, err := db.AddImage(img)
+	if err != nil || !added || img.ID == 0 {
+		t.Fatalf("AddImage() = %v, %v (ID %d); want added", added, err, img.ID)
+	}
+	dup := *img
+	dup.ImageID = "choir-image-other"
+	if added, err := db.AddImage(&dup); err != nil || added {
+		t.Errorf("AddImage() of a duplicate key = %v, %v; want not added", added, err)
+	}
+
+	got, err := db.GetImage("lima", "abc123")
+	if err != nil {
+		t.Fatalf("GetImage() failed: %v", err)
+	}
+	if got.ImageID != img.ImageID || len(got.Packages) != 2 || !got.CreatedAt.Equal(created) {
+		t.Errorf("GetImage() = %+v, want %+v", got, img)
+	}
+	if _, err := db.GetImage("other", "abc123"); !errors.Is(err, ErrImageNotFound) {
+		t.Errorf("GetImage() for another backend error = %v, want ErrImageNotFound", err)
+	}
+
+	other := &Image{Backend: "lima", Key: "def456", ImageID: "choir-image-def456", CreatedAt: created, LastUsedAt: created}
+	if _, err := db.AddImage(other); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.TouchImage(img.ID, time.Now()); err != nil {
+		t.Fatalf("TouchImage() failed: %v", err)
+	}
+	images, err := db.ListImages()
+	if err != nil || len(images) != 2 || images[0].Key != "abc123" {
+		t.Fatalf("ListImages() = %v, %v; want abc123 first as most recently used", images, err)
+	}
+
+	if err := db.DeleteImage(img.ID); err != nil {
+		t.Fatalf("DeleteImage() failed: %v", err)
+	}
+	if _, err := db.GetImage("lima", "abc123"); !errors.Is(err, ErrImageNotFound) {
+		t.Errorf("GetImage() after delete error = %v, want ErrImageNotFound", err)
+	}
+}
+
+func TestTakePooledEnvironment(t *testing.T) {
+	db := openTestDB(t)
+	created := time.Now().Add(-time.Hour)
+
+	add := func(id string, status EnvironmentStatus, pooled bool, repo string, age time.Duration) {
+		t.Helper()
+		err := db.CreateEnvironment(&Environment{
+			ID: id, Backend: "local", RepoPath: repo, BranchName: "env/" + id, BaseBranch: "main",
+			Remote: "origin", Status: status, Pooled: pooled, CreatedAt: created.Add(-age),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	add("pooled-newer", StatusReady, true, "/repo", 0)
+	add("pooled-older", StatusReady, true, "/repo", time.Minute)
+	add("pooled-busy", StatusProvisioning, true, "/repo", 2*time.Minute)
+	add("pooled-elsewhere", StatusReady, true, "/other", 3*time.Minute)
+	add("taken-already", StatusReady, false, "/repo", 4*time.Minute)
+
+	if n, err := db.CountEnvironments(ListOptions{RepoPath: "/repo", Pooled: PoolOnly}); err != nil || n != 3 {
+		t.Errorf("CountEnvironments(PoolOnly) = %d, %v; want 3", n, err)
+	}
+	if envs, err := db.ListEnvironments(ListOptions{Pooled: PoolExclude}); err != nil || len(envs) != 1 || envs[0].ID != "taken-already" {
+		t.Errorf("ListEnvironments(PoolExclude) = %v, %v; want only taken-already", envs, err)
+	}
+
+	now := time.Now().Truncate(time.Second)
+	for _, want := range []string{"pooled-older", "pooled-newer"} {
+		env, err := db.TakePooledEnvironment("/repo", "local", "origin", now)
+		if err != nil {
+			t.Fatalf("TakePooledEnvironment() failed: %v", err)
+		}
+		if env.ID != want || env.Pooled || !env.CreatedAt.Equal(now) {
+			t.Errorf("TakePooledEnvironment() = %s (pooled %v, created %v), want %s no longer pooled and created now", env.ID, env.Pooled, env.CreatedAt, want)
+		}
+	}
+	if _, err := db.TakePooledEnvironment("/repo", "local", "origin", now); !errors.Is(err, ErrEnvironmentNotFound) {
+		t.Errorf("TakePooledEnvironment() with none ready error = %v, want ErrEnvironmentNotFound", err)
+	}
+	if _, err := db.TakePooledEnvironment("/other", "local", "upstream", now); !errors.Is(err, ErrEnvironmentNotFound) {
+		t.Errorf("TakePooledEnvironment() for another remote error = %v, want ErrEnvironmentNotFound", err)
+	}
+}
@@ -0,0 +1,257 @@
+// Package table renders aligned text tables for terminal output.
+//
+// Unlike text/tabwriter it measures cells by display width, so wide
+// characters (CJK, emoji) and combining marks don't break alignment, and it
+// can shrink columns to fit a terminal, eliding long values with "…".
+package table
+
+import (
+	"io"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// ellipsis marks elided text. It is one column wide.
+const ellipsis = "…"
+
+// gap is the number of spaces between columns.
+const gap = 2
+
+// Column describes a table column.
+type Column struct {
+	// Header is the column title.
+	Header string
+
+	// Min is the narrowest width the column may shrink to when the table is
+	// wider than the render width. Zero means the column never shrinks.
+	Min int
+
+	// ElideStart elides the start of long values instead of the end,
+	// keeping the most specific part of paths visible.
+	ElideStart bool
+}
+
+// Table accumulates rows and renders them aligned.
+type Table struct {
+	cols       []Column
+	rows       [][]string
+	styles     []string
+	cellStyles []map[int]string // Per-row styles by column index
+}
+
+// New returns a table with the given columns.
+func New(cols ...Column) *Table {
+	return &Table{cols: cols}
+}
+
+// Row appends a row. Missing cells are blank; extra cells are ignored.
+func (t *Table) Row(cells ...string) {
+	t.StyledRow("", cells...)
+}
+
+// StyledRow appends a row wrapped in the ANSI SGR style (e.g., "1" for bold).
+// The style doesn't count toward column widths.
+func (t *Table) StyledRow(style string, cells ...string) {
+	row := make([]string, len(t.cols))
+	copy(row, cells)
+	t.rows = append(t.rows, row)
+	t.styles = append(t.styles, style)
+	t.cellStyles = append(t.cellStyles, nil)
+}
+
+// StyleCell wraps cell col of the most recently added row in the ANSI SGR
+// style, on top of any row style. It does nothing if no row has been added
+// or col is out of range.
+func (t *Table) StyleCell(col int, style string) {
+	if len(t.rows) == 0 || col < 0 || col >= len(t.cols) {
+		return
+	}
+	last := len(t.rows) - 1
+	if t.cellStyles[last] == nil {
+		t.cellStyles[last] = make(map[int]string)
+	}
+	t.cellStyles[last][col] = style
+}
+
+// Render writes the table to w, shrinking columns that allow it so lines fit
+// in width display columns. If width is zero or negative, or the columns
+// can't shrink enough, lines are as wide as their content requires.
+func (t *Table) Render(w io.Writer, width int) error {
+	widths := t.fit(width)
+
+	var b strings.Builder
+	t.writeLine(&b, headers(t.cols), widths, "", nil)
+	b.WriteString("\n")
+	for i, row := range t.rows {
+		if t.styles[i] == "" {
+			t.writeLine(&b, row, widths, "", t.cellStyles[i])
+		} else {
+			b.WriteString("\033[" + t.styles[i] + "m")
+			t.writeLine(&b, row, widths, t.styles[i], t.cellStyles[i])
+			b.WriteString("\033[0m")
+		}
+		b.WriteString("\n")
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// fit returns the width of each column, shrinking shrinkable columns
+// (widest first) until the table fits in width.
+func (t *Table) fit(width int) []int {
+	widths := make([]int, len(t.cols))
+	for i, c := range t.cols {
+		widths[i] = Width(c.Header)
+	}
+	for _, row := range t.rows {
+		for i, cell := range row {
+			widths[i] = max(widths[i], Width(cell))
+		}
+	}
+	if width <= 0 {
+		return widths
+	}
+
+	total := gap * (len(widths) - 1)
+	for _, w := range widths {
+		total += w
+	}
+	for total > width {
+		widest := -1
+		for i, c := range t.cols {
+			if c.Min > 0 && widths[i] > max(c.Min, Width(c.Header)) &&
+				(widest < 0 || widths[i] > widths[widest]) {
+				widest = i
+			}
+		}
+		if widest < 0 {
+			break // Nothing left to shrink
+		}
+		widths[widest]--
+		total--
+	}
+	return widths
+}
+
+// writeLine writes one row, without a newline, padded to widths.
+// The last column is not padded. Styled cells are reset afterwards to
+// rowStyle.
+func (t *Table) writeLine(b *strings.Builder, cells []string, widths []int, rowStyle string, cellStyles map[int]string) {
+	for i, cell := range cells {
+		if t.cols[i].ElideStart {
+			cell = TruncateStart(cell, widths[i])
+		} else {
+			cell = Truncate(cell, widths[i])
+		}
+		if style := cellStyles[i]; style != "" {
+			b.WriteString("\033[" + style + "m" + cell + "\033[0m")
+			if rowStyle != "" {
+				b.WriteString("\033[" + rowStyle + "m")
+			}
+		} else {
+			b.WriteString(cell)
+		}
+		if i < len(cells)-1 {
+			b.WriteString(strings.Repeat(" ", widths[i]-Width(cell)+gap))
+		}
+	}
+}
+
+func headers(cols []Column) []string {
+	out := make([]string, len(cols))
+	for i, c := range cols {
+		out[i] = c.Header
+	}
+	return out
+}
+
+// Truncate shortens s to at most width display columns, replacing the
+// elided end with "…".
+func Truncate(s string, width int) string {
+	if Width(s) <= width {
+		return s
+	}
+	if width <= 0 {
+		return ""
+	}
+	var b strings.Builder
+	used := 0
+	for _, r := range s {
+		rw := runeWidth(r)
+		if used+rw > width-1 {
+			break
+		}
+		b.WriteRune(r)
+		used += rw
+	}
+	return b.String() + ellipsis
+}
+
+// TruncateStart shortens s to at most width display columns, replacing the
+// elided start with "…".
+func TruncateStart(s string, width int) string {
+	if Width(s) <= width {
+		return s
+	}
+	if width <= 0 {
+		return ""
+	}
+	used := 0
+	start := len(s)
+	for start > 0 {
+		r, size := utf8.DecodeLastRuneInString(s[:start])
+		rw := runeWidth(r)
+		if used+rw > width-1 {
+			break
+		}
+		start -= size
+		used += rw
+	}
+	return ellipsis + s[start:]
+}
+
+// Width returns the number of terminal columns s occupies.
+func Width(s string) int {
+	n := 0
+	for _, r := range s {
+		n += runeWidth(r)
+	}
+	return n
+}
+
+// runeWidth returns the number of terminal columns r occupies: 0 for
+// combining marks and format characters, 2 for East Asian wide and
+// fullwidth characters and emoji, and 1 otherwise.
+func runeWidth(r rune) int {
+	switch {
+	case r == 0, unicode.Is(unicode.Mn, r), unicode.Is(unicode.Me, r), unicode.Is(unicode.Cf, r):
+		return 0
+	case r < 0x1100:
+		return 1
+	}
+	for _, rg := range wideRanges {
+		if r >= rg[0] && r <= rg[1] {
+			return 2
+		}
+	}
+	return 1
+}
+
+// wideRanges are the main East Asian wide/fullwidth and emoji blocks.
+var wideRanges = [][2]rune{
+	{0x1100, 0x115F},   // Hangul Jamo
+	{0x2E80, 0x303E},   // CJK radicals, symbols, punctuation
+	{0x3041, 0x33FF},   // Kana, CJK compatibility
+	{0x3400, 0x4DBF},   // CJK extension A
+	{0x4E00, 0x9FFF},   // CJK unified ideographs
+	{0xA000, 0xA4CF},   // Yi
+	{0xAC00, 0xD7A3},   // Hangul syllables
+	{0xF900, 0xFAFF},   // CJK compatibility ideographs
+	{0xFE30, 0xFE4F},   // CJK compatibility forms
+	{0xFF00, 0xFF60},   // Fullwidth forms
+	{0xFFE0, 0xFFE6},   // Fullwidth signs
+	{0x1F300, 0x1F64F}, // Pictographs, emoticons
+	{0x1F900, 0x1F9FF}, // Supplemental symbols and pictographs
+	{0x20000, 0x3FFFD}, // CJK extensions B and beyond
+}
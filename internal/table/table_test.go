@@ -0,0 +1,114 @@
+package table
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestWidth(t *testing.T) {
+	tests := []struct {
+		in   string
+		want int
+	}{
+		{"", 0},
+		{"env/abc", 7},
+		{"機能", 4},
+		{"한글", 4},
+		{"é", 1}, // e + combining acute
+		{"fix-🐛", 6},
+	}
+	for _, tt := range tests {
+		if got := Width(tt.in); got != tt.want {
+			t.Errorf("Width(%q) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	tests := []struct {
+		in    string
+		width int
+		want  string
+		start string
+	}{
+		{"short", 10, "short", "short"},
+		{"feature/long", 8, "feature…", "…re/long"},
+		{"機能ブランチ", 7, "機能ブ…", "…ランチ"},
+		{"abc", 0, "", ""},
+	}
+	for _, tt := range tests {
+		if got := Truncate(tt.in, tt.width); got != tt.want {
+			t.Errorf("Truncate(%q, %d) = %q, want %q", tt.in, tt.width, got, tt.want)
+		}
+		if got := TruncateStart(tt.in, tt.width); got != tt.start {
+			t.Errorf("TruncateStart(%q, %d) = %q, want %q", tt.in, tt.width, got, tt.start)
+		}
+	}
+}
+
+func TestRender(t *testing.T) {
+	tbl := New(
+		Column{Header: "ID"},
+		Column{Header: "BRANCH", Min: 8},
+		Column{Header: "PATH", Min: 8, ElideStart: true},
+	)
+	tbl.Row("a1", "機能/ブランチ", "/home/user/worktrees/choir-a1")
+	tbl.StyledRow("1", "b2", "env/b2", "/tmp/b2")
+
+	var b strings.Builder
+	if err := tbl.Render(&b, 0); err != nil {
+		t.Fatalf("Render() failed: %v", err)
+	}
+	lines := strings.Split(strings.TrimSuffix(b.String(), "\n"), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("Render() produced %d lines, want 3:\n%s", len(lines), b.String())
+	}
+
+	// Columns line up by display width despite the wide characters
+	col := func(line, prefix string) int {
+		return Width(line[:strings.Index(line, prefix)])
+	}
+	if col(lines[0], "PATH") != col(lines[1], "/home") {
+		t.Errorf("PATH column misaligned:\n%s", b.String())
+	}
+	if !strings.HasPrefix(lines[2], "\033[1m") || !strings.HasSuffix(lines[2], "\033[0m") {
+		t.Errorf("styled row = %q, want bold", lines[2])
+	}
+
+	// Constrained, shrinkable columns are elided to fit
+	b.Reset()
+	if err := tbl.Render(&b, 30); err != nil {
+		t.Fatalf("Render() failed: %v", err)
+	}
+	for _, line := range strings.Split(strings.TrimSuffix(b.String(), "\n"), "\n") {
+		line = strings.TrimSuffix(strings.TrimPrefix(line, "\033[1m"), "\033[0m")
+		if w := Width(line); w > 30 {
+			t.Errorf("line %q is %d columns wide, want <= 30", line, w)
+		}
+	}
+	if !strings.Contains(b.String(), "  …es/choir-a1") {
+		t.Errorf("expected path elided at the start:\n%s", b.String())
+	}
+}
+
+func TestStyleCell(t *testing.T) {
+	tbl := New(Column{Header: "ID"}, Column{Header: "STATUS"}, Column{Header: "BRANCH"})
+	tbl.StyleCell(1, "31") // No rows yet: ignored
+	tbl.Row("a1", "ready", "env/a1")
+	tbl.StyleCell(1, "32")
+	tbl.StyledRow("1", "b2", "failed", "env/b2")
+	tbl.StyleCell(1, "31")
+
+	var b strings.Builder
+	if err := tbl.Render(&b, 0); err != nil {
+		t.Fatalf("Render() failed: %v", err)
+	}
+	lines := strings.Split(strings.TrimSuffix(b.String(), "\n"), "\n")
+	if want := "a1  \033[32mready\033[0m   env/a1"; lines[1] != want {
+		t.Errorf("styled cell row = %q, want %q", lines[1], want)
+	}
+	// The row style resumes after the styled cell
+	if want := "\033[1mb2  \033[31mfailed\033[0m\033[1m  env/b2\033[0m"; lines[2] != want {
+		t.Errorf("styled cell in styled row = %q, want %q", lines[2], want)
+	}
+}
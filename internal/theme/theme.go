@@ -0,0 +1,162 @@
+// Package theme decides how environment statuses are drawn in list output:
+// the color (an ANSI SGR style) and symbol for each status.
+//
+// Modes:
+//
+//	color          colored statuses (the default)
+//	high-contrast  bold colors that don't depend on telling red from green,
+//	               plus a symbol before each status
+//	symbols        symbols only, for terminals without color
+//	plain          no color or symbols
+//
+// The theme: section of the global config selects the mode and overrides
+// individual colors and symbols. Colors are only used when the output is a
+// terminal and NO_COLOR is unset; symbols are part of the text and always
+// shown.
+package theme
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/Quidge/choir/internal/config"
+)
+
+// Theme modes.
+const (
+	ModeColor        = "color"
+	ModeHighContrast = "high-contrast"
+	ModeSymbols      = "symbols"
+	ModePlain        = "plain"
+)
+
+// statuses are the environment statuses a theme styles.
+var statuses = []string{"provisioning", "ready", "stopped", "failed", "removed"}
+
+// modeStyles and modeSymbols are each mode's defaults by status.
+var (
+	modeStyles = map[string]map[string]string{
+		ModeColor: {
+			"provisioning": "33",
+			"ready":        "32",
+			"stopped":      "34",
+			"failed":       "31",
+			"removed":      "2",
+		},
+		ModeHighContrast: {
+			"provisioning": "1;33",
+			"ready":        "1;36",
+			"stopped":      "1",
+			"failed":       "1;7",
+			"removed":      "2",
+		},
+	}
+	modeSymbols = map[string]map[string]string{
+		ModeHighContrast: defaultSymbols,
+		ModeSymbols:      defaultSymbols,
+	}
+	defaultSymbols = map[string]string{
+		"provisioning": "~",
+		"ready":        "+",
+		"stopped":      "-",
+		"failed":       "!",
+		"removed":      "x",
+	}
+)
+
+// sgrNames maps color and attribute names to SGR parameters.
+var sgrNames = map[string]string{
+	"bold": "1", "dim": "2", "underline": "4", "reverse": "7",
+	"black": "30", "red": "31", "green": "32", "yellow": "33",
+	"blue": "34", "magenta": "35", "cyan": "36", "white": "37",
+	"bright-black": "90", "bright-red": "91", "bright-green": "92", "bright-yellow": "93",
+	"bright-blue": "94", "bright-magenta": "95", "bright-cyan": "96", "bright-white": "97",
+}
+
+// Theme holds the style and symbol for each status.
+type Theme struct {
+	styles  map[string]string
+	symbols map[string]string
+}
+
+// New returns the theme described by cfg. If color is false, statuses are
+// never styled.
+func New(cfg config.ThemeConfig, color bool) (*Theme, error) {
+	mode := cfg.Mode
+	if mode == "" {
+		mode = ModeColor
+	}
+	switch mode {
+	case ModeColor, ModeHighContrast, ModeSymbols, ModePlain:
+	default:
+		return nil, fmt.Errorf("unknown theme mode %q (want %s, %s, %s, or %s)",
+			mode, ModeColor, ModeHighContrast, ModeSymbols, ModePlain)
+	}
+
+	t := &Theme{styles: make(map[string]string), symbols: make(map[string]string)}
+	for _, status := range statuses {
+		t.styles[status] = modeStyles[mode][status]
+		t.symbols[status] = modeSymbols[mode][status]
+	}
+	for status, color := range cfg.Colors {
+		if !slices.Contains(statuses, status) {
+			return nil, fmt.Errorf("theme colors: unknown status %q", status)
+		}
+		style, err := ParseStyle(color)
+		if err != nil {
+			return nil, fmt.Errorf("theme colors: %s: %w", status, err)
+		}
+		t.styles[status] = style
+	}
+	for status, symbol := range cfg.Symbols {
+		if !slices.Contains(statuses, status) {
+			return nil, fmt.Errorf("theme symbols: unknown status %q", status)
+		}
+		t.symbols[status] = symbol
+	}
+	if !color {
+		clear(t.styles)
+	}
+	return t, nil
+}
+
+// UseColor reports whether output to a terminal (or not) should be colored:
+// only on a terminal, and never when NO_COLOR is set.
+func UseColor(terminal bool) bool {
+	return terminal && os.Getenv("NO_COLOR") == ""
+}
+
+// ParseStyle converts space-separated color and attribute names (e.g.,
+// "bold cyan") or SGR numbers into an SGR style such as "1;36".
+func ParseStyle(s string) (string, error) {
+	var params []string
+	for word := range strings.FieldsSeq(s) {
+		if code, ok := sgrNames[word]; ok {
+			params = append(params, code)
+			continue
+		}
+		if n, err := strconv.Atoi(word); err == nil && n >= 0 && n <= 255 {
+			params = append(params, word)
+			continue
+		}
+		return "", fmt.Errorf("unknown color %q", word)
+	}
+	return strings.Join(params, ";"), nil
+}
+
+// Label returns the text for status: its symbol, if the theme has one,
+// followed by the status.
+func (t *Theme) Label(status string) string {
+	if symbol := t.symbols[status]; symbol != "" {
+		return symbol + " " + status
+	}
+	return status
+}
+
+// Style returns the SGR style for status, or "" for none.
+func (t *Theme) Style(status string) string {
+	return t.styles[status]
+}
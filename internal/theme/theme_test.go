@@ -0,0 +1,62 @@
+package theme
+
+import (
+	"testing"
+
+	"github.com/Quidge/choir/internal/config"
+)
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name      string
+		cfg       config.ThemeConfig
+		color     bool
+		wantLabel string
+		wantStyle string
+		wantErr   bool
+	}{
+		{name: "default", color: true, wantLabel: "failed", wantStyle: "31"},
+		{name: "no color", color: false, wantLabel: "failed", wantStyle: ""},
+		{name: "high contrast", cfg: config.ThemeConfig{Mode: ModeHighContrast}, color: true, wantLabel: "! failed", wantStyle: "1;7"},
+		{name: "symbols", cfg: config.ThemeConfig{Mode: ModeSymbols}, color: true, wantLabel: "! failed", wantStyle: ""},
+		{name: "plain", cfg: config.ThemeConfig{Mode: ModePlain}, color: true, wantLabel: "failed", wantStyle: ""},
+		{
+			name:      "overrides",
+			cfg:       config.ThemeConfig{Colors: map[string]string{"failed": "bold bright-magenta"}, Symbols: map[string]string{"failed": "✗"}},
+			color:     true,
+			wantLabel: "✗ failed",
+			wantStyle: "1;95",
+		},
+		{name: "unknown mode", cfg: config.ThemeConfig{Mode: "neon"}, wantErr: true},
+		{name: "unknown status", cfg: config.ThemeConfig{Colors: map[string]string{"done": "red"}}, wantErr: true},
+		{name: "unknown color", cfg: config.ThemeConfig{Colors: map[string]string{"ready": "teal"}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			th, err := New(tt.cfg, tt.color)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("New() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if got := th.Label("failed"); got != tt.wantLabel {
+				t.Errorf("Label() = %q, want %q", got, tt.wantLabel)
+			}
+			if got := th.Style("failed"); got != tt.wantStyle {
+				t.Errorf("Style() = %q, want %q", got, tt.wantStyle)
+			}
+		})
+	}
+}
+
+func TestUseColor(t *testing.T) {
+	t.Setenv("NO_COLOR", "")
+	if !UseColor(true) || UseColor(false) {
+		t.Error("UseColor() should follow whether output is a terminal")
+	}
+	t.Setenv("NO_COLOR", "1")
+	if UseColor(true) {
+		t.Error("UseColor() = true with NO_COLOR set")
+	}
+}
@@ -0,0 +1,210 @@
+// Package trash keeps what removing an environment would otherwise lose, so
+// it can be restored later.
+//
+// Each entry is a directory under Dir() named by the environment's ID. An
+// environment removed with "choir env rm" has its workspace moved there
+// until "choir gc" purges it; "choir env restore" moves it back. Purging,
+// or removing an environment for good, leaves an entry.json describing it
+// and a git bundle with the environment's unpushed commits and a snapshot
+// of its uncommitted changes, if it had any. "choir trash restore" fetches
+// the bundle back into the repository.
+package trash
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	entryFile  = "entry.json"
+	bundleFile = "backup.bundle"
+)
+
+var (
+	// ErrNotFound is returned by Find when no entry matches.
+	ErrNotFound = errors.New("trash entry not found")
+
+	// ErrAmbiguous is returned by Find when more than one entry matches.
+	ErrAmbiguous = errors.New("ambiguous trash entry")
+)
+
+// Entry describes an environment's work saved in the trash.
+type Entry struct {
+	ID               string    `json:"id"`                // Full environment ID
+	Branch           string    `json:"branch,omitempty"`  // Environment branch; empty if its HEAD was detached
+	Repo             string    `json:"repo"`              // Repository the bundle's commits belong to
+	Ref              string    `json:"ref"`               // Ref in the bundle holding the saved work
+	RemovedAt        time.Time `json:"removed_at"`        // When the environment was removed
+	UnpushedCommits  int       `json:"unpushed_commits"`  // Commits on the branch found nowhere else
+	UncommittedFiles int       `json:"uncommitted_files"` // Files in the snapshot commit; 0 if there is none
+
+	dir string
+}
+
+// Dir returns the base directory for the trash.
+// This follows the XDG Base Directory specification:
+// - Uses $XDG_DATA_HOME/choir/trash/ if XDG_DATA_HOME is set
+// - Falls back to ~/.local/share/choir/trash/
+func Dir() (string, error) {
+	dataDir := os.Getenv("XDG_DATA_HOME")
+	if dataDir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("failed to get home directory: %w", err)
+		}
+		dataDir = filepath.Join(home, ".local", "share")
+	}
+	return filepath.Join(dataDir, "choir", "trash"), nil
+}
+
+// EntryDir returns the directory of the environment id's entry, where
+// backends also move its workspace while it is in the trash.
+func EntryDir(id string) (string, error) {
+	base, err := Dir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(base, id), nil
+}
+
+// New returns an entry for the environment id, creating its directory.
+// The caller writes the bundle to BundlePath and then calls Save.
+func New(id string) (*Entry, error) {
+	dir, err := EntryDir(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create trash entry: %w", err)
+	}
+	return &Entry{ID: id, RemovedAt: time.Now().UTC(), dir: dir}, nil
+}
+
+// BundlePath returns the path of the entry's git bundle.
+func (e *Entry) BundlePath() string {
+	return filepath.Join(e.dir, bundleFile)
+}
+
+// Save writes the entry's description.
+func (e *Entry) Save() error {
+	data, err := json.MarshalIndent(e, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(e.dir, entryFile), append(data, '\n'), 0600); err != nil {
+		return fmt.Errorf("failed to save trash entry: %w", err)
+	}
+	return nil
+}
+
+// Delete removes the entry's description and bundle, and its directory
+// unless a workspace is still trashed there.
+func (e *Entry) Delete() error {
+	for _, name := range []string{entryFile, bundleFile} {
+		if err := os.Remove(filepath.Join(e.dir, name)); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to delete trash entry: %w", err)
+		}
+	}
+	_ = os.Remove(e.dir) // Only if empty
+	return nil
+}
+
+// List returns the entries in the trash, most recently removed first.
+// Directories without a readable entry.json, such as ones holding only a
+// trashed workspace, are skipped.
+func List() ([]*Entry, error) {
+	base, err := Dir()
+	if err != nil {
+		return nil, err
+	}
+	dirents, err := os.ReadDir(base)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read trash: %w", err)
+	}
+
+	var entries []*Entry
+	for _, d := range dirents {
+		if !d.IsDir() {
+			continue
+		}
+		e, err := load(filepath.Join(base, d.Name()))
+		if err != nil {
+			continue
+		}
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].RemovedAt.After(entries[j].RemovedAt)
+	})
+	return entries, nil
+}
+
+// load reads the entry in dir.
+func load(dir string) (*Entry, error) {
+	data, err := os.ReadFile(filepath.Join(dir, entryFile))
+	if err != nil {
+		return nil, err
+	}
+	var e Entry
+	if err := json.Unmarshal(data, &e); err != nil {
+		return nil, fmt.Errorf("invalid trash entry %s: %w", dir, err)
+	}
+	e.dir = dir
+	return &e, nil
+}
+
+// Find returns the entry whose environment ID starts with prefix.
+func Find(prefix string) (*Entry, error) {
+	entries, err := List()
+	if err != nil {
+		return nil, err
+	}
+	var matches []*Entry
+	for _, e := range entries {
+		if strings.HasPrefix(e.ID, prefix) {
+			matches = append(matches, e)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return nil, fmt.Errorf("%w: %q", ErrNotFound, prefix)
+	case 1:
+		return matches[0], nil
+	default:
+		return nil, fmt.Errorf("%w %q: matches %d entries; use a longer prefix", ErrAmbiguous, prefix, len(matches))
+	}
+}
+
+// Restore fetches the saved work into the entry's repository as branch,
+// which defaults to the environment's branch. An existing branch is only
+// updated if that fast-forwards it, so restoring never discards commits.
+// It returns the branch restored to.
+func (e *Entry) Restore(ctx context.Context, branch string) (string, error) {
+	if branch == "" {
+		branch = e.Branch
+	}
+	if branch == "" {
+		return "", errors.New("the environment's HEAD was detached; name a branch to restore to")
+	}
+	if _, err := os.Stat(e.Repo); err != nil {
+		return "", fmt.Errorf("repository %s is gone: %w", e.Repo, err)
+	}
+
+	cmd := exec.CommandContext(ctx, "git", "fetch", "--quiet", e.BundlePath(), e.Ref+":refs/heads/"+branch)
+	cmd.Dir = e.Repo
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return "", fmt.Errorf("failed to restore to branch %s: %w\noutput: %s", branch, err, strings.TrimSpace(string(out)))
+	}
+	return branch, nil
+}
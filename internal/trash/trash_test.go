@@ -0,0 +1,63 @@
+package trash
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestListAndFind(t *testing.T) {
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+
+	if entries, err := List(); err != nil || len(entries) != 0 {
+		t.Fatalf("List() of a missing trash = %v, %v; want nothing", entries, err)
+	}
+
+	for i, id := range []string{"aaaa1111", "aaaa2222", "bbbb1111"} {
+		e, err := New(id)
+		if err != nil {
+			t.Fatalf("New(%q) failed: %v", id, err)
+		}
+		e.RemovedAt = time.Date(2025, 1, 1+i, 0, 0, 0, 0, time.UTC)
+		if err := e.Save(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// An interrupted removal leaves a directory without entry.json
+	base, _ := Dir()
+	if err := os.Mkdir(filepath.Join(base, "cccc1111"), 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := List()
+	if err != nil {
+		t.Fatalf("List() failed: %v", err)
+	}
+	var ids []string
+	for _, e := range entries {
+		ids = append(ids, e.ID)
+	}
+	if len(ids) != 3 || ids[0] != "bbbb1111" || ids[2] != "aaaa1111" {
+		t.Errorf("List() = %v, want newest first without the incomplete entry", ids)
+	}
+
+	if e, err := Find("bb"); err != nil || e.ID != "bbbb1111" {
+		t.Errorf("Find(bb) = %v, %v", e, err)
+	}
+	if _, err := Find("aaaa"); !errors.Is(err, ErrAmbiguous) {
+		t.Errorf("Find(aaaa) error = %v, want ErrAmbiguous", err)
+	}
+	if _, err := Find("cccc"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Find(cccc) error = %v, want ErrNotFound", err)
+	}
+
+	e, _ := Find("bbbb")
+	if err := e.Delete(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Find("bbbb"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Find() after Delete() error = %v, want ErrNotFound", err)
+	}
+}